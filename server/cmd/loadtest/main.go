@@ -0,0 +1,261 @@
+// Command loadtest simulates bots polling and trading against a running server and reports the latency
+// and throughput of every endpoint against a performance budget. It is meant to run against a local
+// server with the simulated market (SIMULATOR_CONFIG), so no external API quota is used.
+//
+// Bots authenticate with the API keys given with -keys, and missing bots are created by joining the
+// competition given with -competition. The command exits with status 1 if the budget is exceeded.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// options are the command line flags
+type options struct {
+	url           string
+	keys          []string
+	competition   string
+	entryCode     string
+	bots          int
+	duration      time.Duration
+	pollInterval  time.Duration
+	tradeInterval time.Duration
+	tickers       []string
+	budget        budget
+}
+
+// bot is a simulated bot with its own API key
+type bot struct {
+	key      string
+	holdings map[string]int // Shares bought by the load test, so sells never exceed them
+}
+
+func main() {
+	opts := parseOptions()
+	client := &http.Client{Timeout: 30 * time.Second}
+	stats := newRecorder()
+
+	err := waitUntilReady(client, opts.url, time.Minute)
+	if err != nil {
+		log.Fatalf("server is not ready: %v\n", err)
+	}
+
+	bots, err := setUpBots(client, opts, stats)
+	if err != nil {
+		log.Fatalf("error setting up bots: %v\n", err)
+	}
+
+	log.Printf("running %d bots against %s for %v\n", len(bots), opts.url, opts.duration)
+
+	start := time.Now()
+	deadline := start.Add(opts.duration)
+	var wg sync.WaitGroup
+	for _, b := range bots {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(client, opts, b, stats, deadline)
+		}()
+	}
+
+	wg.Wait()
+
+	report := stats.report(time.Since(start))
+	report.print(os.Stdout)
+
+	if violations := opts.budget.check(report); len(violations) > 0 {
+		fmt.Println()
+		for _, violation := range violations {
+			fmt.Println("BUDGET EXCEEDED:", violation)
+		}
+
+		os.Exit(1)
+	}
+
+	fmt.Println("\nwithin budget")
+}
+
+// parseOptions parses the command line flags
+func parseOptions() *options {
+	opts := &options{}
+	var keys, tickers string
+
+	flag.StringVar(&opts.url, "url", "http://localhost:8080/v1", "base URL of the server")
+	flag.StringVar(&keys, "keys", "", "comma separated API keys of existing bots")
+	flag.StringVar(&opts.competition, "competition", "", "competition to join to create the bots missing from -keys")
+	flag.StringVar(&opts.entryCode, "entry-code", "", "entry code of the competition")
+	flag.IntVar(&opts.bots, "bots", 10, "number of simulated bots")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "how long the load runs")
+	flag.DurationVar(&opts.pollInterval, "poll-interval", time.Second, "time between the polls of each bot")
+	flag.DurationVar(&opts.tradeInterval, "trade-interval", 10*time.Second, "time between the trades of each bot, 0 disables trading")
+	flag.StringVar(&tickers, "tickers", "ALPHA,BETA,GAMMA", "comma separated tickers to trade, the tickers of simulator.example.json by default")
+	flag.DurationVar(&opts.budget.p95, "p95", 250*time.Millisecond, "budget of the 95th percentile latency of every endpoint")
+	flag.DurationVar(&opts.budget.p99, "p99", time.Second, "budget of the 99th percentile latency of every endpoint")
+	flag.Float64Var(&opts.budget.errorRate, "max-error-rate", 0.01, "budget of the share of requests that fail with a server or network error")
+	flag.Parse()
+
+	opts.url = strings.TrimSuffix(opts.url, "/")
+	opts.keys = splitList(keys)
+	opts.tickers = splitList(tickers)
+
+	if opts.bots <= 0 || len(opts.tickers) == 0 {
+		log.Fatalf("-bots must be positive and -tickers must not be empty\n")
+	}
+
+	return opts
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(list string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// waitUntilReady polls /readyz until the server finished warming up or the timeout passes
+func waitUntilReady(client *http.Client, url string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		response, err := client.Get(strings.TrimSuffix(url, "/v1") + "/readyz")
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return nil
+			}
+
+			err = fmt.Errorf("readyz returned %d", response.StatusCode)
+		}
+
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// setUpBots returns the bots of the given API keys and joins the competition for the missing bots
+func setUpBots(client *http.Client, opts *options, stats *recorder) ([]*bot, error) {
+	bots := make([]*bot, 0, opts.bots)
+	for _, key := range opts.keys {
+		if len(bots) == opts.bots {
+			break
+		}
+
+		bots = append(bots, &bot{key: key, holdings: make(map[string]int)})
+	}
+
+	if len(bots) < opts.bots && opts.competition == "" {
+		return nil, fmt.Errorf("%d API keys given for %d bots, set -competition to create the rest", len(bots), opts.bots)
+	}
+
+	for i := len(bots); i < opts.bots; i++ {
+		body, _ := json.Marshal(map[string]string{"entryCode": opts.entryCode, "displayName": fmt.Sprintf("loadtest-%d", i)})
+		response, status, err := request(client, stats, "POST /public/competitions/:id/join", http.MethodPost,
+			fmt.Sprintf("%s/public/competitions/%s/join", opts.url, opts.competition), "", body)
+		if err != nil || status != http.StatusOK {
+			return nil, fmt.Errorf("error joining competition %s: status %d: %v %s", opts.competition, status, err, response)
+		}
+
+		joined := struct {
+			Payload struct {
+				APIKey string `json:"apiKey"`
+			} `json:"payload"`
+		}{}
+		if err := json.Unmarshal(response, &joined); err != nil || joined.Payload.APIKey == "" {
+			return nil, fmt.Errorf("unexpected join response: %s", response)
+		}
+
+		bots = append(bots, &bot{key: joined.Payload.APIKey, holdings: make(map[string]int)})
+	}
+
+	return bots, nil
+}
+
+// run polls and trades as a bot until the deadline. Bots start at random offsets so their requests spread out.
+func run(client *http.Client, opts *options, b *bot, stats *recorder, deadline time.Time) {
+	time.Sleep(rand.N(opts.pollInterval))
+
+	nextTrade := time.Now().Add(rand.N(max(opts.tradeInterval, time.Millisecond)))
+	for polls := 0; time.Now().Before(deadline); polls++ {
+		// Bots alternate between their prices and their portfolio, like a typical trading loop
+		if polls%2 == 0 {
+			request(client, stats, "GET /live_stock_data", http.MethodGet, opts.url+"/live_stock_data", b.key, nil)
+		} else {
+			request(client, stats, "GET /portfolio", http.MethodGet, opts.url+"/portfolio", b.key, nil)
+		}
+
+		if opts.tradeInterval > 0 && time.Now().After(nextTrade) {
+			trade(client, opts, b, stats)
+			nextTrade = nextTrade.Add(opts.tradeInterval)
+		}
+
+		time.Sleep(opts.pollInterval)
+	}
+}
+
+// trade buys a share of a random ticker, or sells one the bot bought earlier
+func trade(client *http.Client, opts *options, b *bot, stats *recorder) {
+	ticker := opts.tickers[rand.IntN(len(opts.tickers))]
+	action := "buy"
+	if b.holdings[ticker] > 0 && rand.IntN(2) == 0 {
+		action = "sell"
+	}
+
+	body, _ := json.Marshal(map[string]any{"action": action, "ticker": ticker, "numShares": 1, "tag": "loadtest"})
+	_, status, err := request(client, stats, "POST /transact", http.MethodPost, opts.url+"/transact", b.key, body)
+	if err != nil || status != http.StatusOK {
+		return
+	}
+
+	if action == "buy" {
+		b.holdings[ticker]++
+	} else {
+		b.holdings[ticker]--
+	}
+}
+
+// request sends a request, records its latency and status under the endpoint and returns the response body
+func request(client *http.Client, stats *recorder, endpoint, method, url, key string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if key != "" {
+		req.Header.Set("Authorization", key)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	response, err := client.Do(req)
+	if err != nil {
+		stats.record(endpoint, time.Since(start), 0)
+		return nil, 0, err
+	}
+
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	stats.record(endpoint, time.Since(start), response.StatusCode)
+
+	return data, response.StatusCode, err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// endpointStats collects the requests of an endpoint
+type endpointStats struct {
+	latencies    []time.Duration
+	clientErrors int // 4xx responses, such as rejected trades
+	serverErrors int // 5xx responses and requests that failed without a response
+}
+
+// recorder collects the requests of every endpoint
+type recorder struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointStats
+}
+
+// newRecorder creates an empty recorder
+func newRecorder() *recorder {
+	return &recorder{endpoints: make(map[string]*endpointStats)}
+}
+
+// record adds a request with its latency and status, 0 if it failed without a response
+func (r *recorder) record(endpoint string, latency time.Duration, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.endpoints[endpoint]
+	if !ok {
+		stats = &endpointStats{}
+		r.endpoints[endpoint] = stats
+	}
+
+	stats.latencies = append(stats.latencies, latency)
+	switch {
+	case status == 0 || status >= 500:
+		stats.serverErrors++
+	case status >= 400:
+		stats.clientErrors++
+	}
+}
+
+// endpointReport summarizes the requests of an endpoint
+type endpointReport struct {
+	Endpoint     string
+	Requests     int
+	ClientErrors int
+	ServerErrors int
+	Throughput   float64 // Requests per second
+	P50          time.Duration
+	P95          time.Duration
+	P99          time.Duration
+	Max          time.Duration
+}
+
+// ErrorRate returns the share of requests that failed with a server or network error
+func (er *endpointReport) ErrorRate() float64 {
+	if er.Requests == 0 {
+		return 0
+	}
+
+	return float64(er.ServerErrors) / float64(er.Requests)
+}
+
+// report summarizes a load test
+type report struct {
+	Duration  time.Duration
+	Endpoints []*endpointReport
+}
+
+// report summarizes the recorded requests of a load test that ran for the given duration
+func (r *recorder) report(duration time.Duration) *report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &report{Duration: duration}
+	for endpoint, stats := range r.endpoints {
+		latencies := slices.Clone(stats.latencies)
+		slices.Sort(latencies)
+
+		result.Endpoints = append(result.Endpoints, &endpointReport{
+			Endpoint:     endpoint,
+			Requests:     len(latencies),
+			ClientErrors: stats.clientErrors,
+			ServerErrors: stats.serverErrors,
+			Throughput:   float64(len(latencies)) / duration.Seconds(),
+			P50:          percentile(latencies, 0.50),
+			P95:          percentile(latencies, 0.95),
+			P99:          percentile(latencies, 0.99),
+			Max:          latencies[len(latencies)-1],
+		})
+	}
+
+	sort.Slice(result.Endpoints, func(a, b int) bool {
+		return result.Endpoints[a].Endpoint < result.Endpoints[b].Endpoint
+	})
+
+	return result
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	index := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[min(max(index, 0), len(sorted)-1)]
+}
+
+// print writes the report as a table
+func (r *report) print(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "endpoint\trequests\t4xx\t5xx/failed\treq/s\tp50\tp95\tp99\tmax\t")
+
+	total := 0
+	for _, endpoint := range r.Endpoints {
+		total += endpoint.Requests
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%.1f\t%v\t%v\t%v\t%v\t\n",
+			endpoint.Endpoint, endpoint.Requests, endpoint.ClientErrors, endpoint.ServerErrors, endpoint.Throughput,
+			endpoint.P50.Round(time.Microsecond), endpoint.P95.Round(time.Microsecond),
+			endpoint.P99.Round(time.Microsecond), endpoint.Max.Round(time.Microsecond))
+	}
+
+	table.Flush()
+	fmt.Fprintf(w, "\n%d requests in %v (%.1f req/s)\n", total, r.Duration.Round(time.Millisecond), float64(total)/r.Duration.Seconds())
+}
+
+// budget is the performance every endpoint must stay within
+type budget struct {
+	p95       time.Duration
+	p99       time.Duration
+	errorRate float64
+}
+
+// check returns a description of every endpoint that exceeded the budget
+func (b budget) check(r *report) []string {
+	violations := make([]string, 0)
+	for _, endpoint := range r.Endpoints {
+		if endpoint.P95 > b.p95 {
+			violations = append(violations, fmt.Sprintf("%s p95 %v > %v", endpoint.Endpoint, endpoint.P95, b.p95))
+		}
+
+		if endpoint.P99 > b.p99 {
+			violations = append(violations, fmt.Sprintf("%s p99 %v > %v", endpoint.Endpoint, endpoint.P99, b.p99))
+		}
+
+		if rate := endpoint.ErrorRate(); rate > b.errorRate {
+			violations = append(violations, fmt.Sprintf("%s error rate %.2f%% > %.2f%%", endpoint.Endpoint, rate*100, b.errorRate*100))
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,498 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// maxAlertsPerBot is the largest number of price alerts a bot can wait on at once
+const maxAlertsPerBot = 50
+
+// Triggered alerts returned by GetAlertHistory unless a limit is requested
+const (
+	defaultAlertHistoryLimit = 100
+	maxAlertHistoryLimit     = 500
+)
+
+// AlertRequestData represents a request to create a price alert
+type AlertRequestData struct {
+	Ticker    string  `json:"ticker" binding:"required,ticker"`               // Ticker symbol to watch
+	Condition string  `json:"condition" binding:"required,oneof=above below"` // Whether the price must rise to or fall to the level
+	Price     float64 `json:"price" binding:"required,gt=0"`                  // Price level of the condition
+	Webhook   string  `json:"webhook" binding:"max=2048"`                     // Optional URL the triggered alert is posted to
+	Note      string  `json:"note" binding:"max=200"`                         // Optional text returned with the triggered alert
+}
+
+// alertBook indexes the waiting price alerts of every bot by ticker, so price updates only visit
+// the alerts of tickers with a price. It also makes sure only one webhook delivery runs at a time.
+type alertBook struct {
+	mu        sync.Mutex
+	tickers   map[string]map[string]*models.PriceAlert // Waiting alerts by ticker and alert ID
+	deliverMu sync.Mutex                               // Held while triggered alerts are being delivered
+}
+
+// newAlertBook creates an empty alert book
+func newAlertBook() *alertBook {
+	return &alertBook{tickers: make(map[string]map[string]*models.PriceAlert)}
+}
+
+// add makes an alert wait for its condition
+func (ab *alertBook) add(alert *models.PriceAlert) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	alerts, ok := ab.tickers[alert.Ticker]
+	if !ok {
+		alerts = make(map[string]*models.PriceAlert)
+		ab.tickers[alert.Ticker] = alerts
+	}
+
+	alerts[alert.ID] = alert
+}
+
+// remove stops an alert from waiting
+func (ab *alertBook) remove(ticker, id string) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	alerts := ab.tickers[ticker]
+	delete(alerts, id)
+	if len(alerts) == 0 {
+		delete(ab.tickers, ticker)
+	}
+}
+
+// removeBot stops every alert of a bot from waiting
+func (ab *alertBook) removeBot(botID string) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	for ticker, alerts := range ab.tickers {
+		for id, alert := range alerts {
+			if alert.Bot.ID == botID {
+				delete(alerts, id)
+			}
+		}
+
+		if len(alerts) == 0 {
+			delete(ab.tickers, ticker)
+		}
+	}
+}
+
+// botAlerts returns the waiting alerts of a bot, oldest first
+func (ab *alertBook) botAlerts(botID string) []*models.PriceAlert {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	botAlerts := make([]*models.PriceAlert, 0)
+	for _, alerts := range ab.tickers {
+		for _, alert := range alerts {
+			if alert.Bot.ID == botID {
+				botAlerts = append(botAlerts, alert)
+			}
+		}
+	}
+
+	sortAlerts(botAlerts)
+	return botAlerts
+}
+
+// triggered returns the waiting alerts whose conditions the prices meet
+func (ab *alertBook) triggered(prices map[string]float64) []*models.PriceAlert {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	triggered := make([]*models.PriceAlert, 0)
+	for ticker, alerts := range ab.tickers {
+		price, ok := prices[ticker]
+		if !ok {
+			continue
+		}
+
+		for _, alert := range alerts {
+			if alert.Triggered(price) {
+				triggered = append(triggered, alert)
+			}
+		}
+	}
+
+	sortAlerts(triggered)
+	return triggered
+}
+
+// sortAlerts sorts alerts by when they were created, oldest first
+func sortAlerts(alerts []*models.PriceAlert) {
+	sort.Slice(alerts, func(a, b int) bool {
+		if !alerts[a].CreatedAt.Equal(alerts[b].CreatedAt) {
+			return alerts[a].CreatedAt.Before(alerts[b].CreatedAt)
+		}
+
+		return alerts[a].ID < alerts[b].ID
+	})
+}
+
+// loadAlerts indexes the waiting price alerts of every bot, so alerts survive a restart
+func (bw *BotWorker) loadAlerts() error {
+	docs, err := bw.db.Collection(bw.collections.PriceAlerts).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving price alerts: %v", err)
+	}
+
+	for _, doc := range docs {
+		alert := &models.PriceAlert{}
+		if doc.DataTo(alert) != nil || alert.Bot == nil {
+			continue
+		}
+
+		alert.ID = doc.Ref.ID
+		bw.alerts.add(alert)
+		bw.watchlist.AddTickers(alert.Ticker)
+	}
+
+	return nil
+}
+
+// evaluateAlerts triggers every waiting alert whose condition the latest prices meet
+func (bw *BotWorker) evaluateAlerts() {
+	triggered := bw.alerts.triggered(bw.latestPrices)
+	for _, alert := range triggered {
+		err := bw.triggerAlert(alert, bw.latestPrices[alert.Ticker])
+		if err != nil {
+			log.Printf("error triggering price alert %s of %s: %v\n", alert.ID, alert.Bot.ID, err)
+		}
+	}
+
+	if len(triggered) > 0 {
+		bw.deliverAlertsAsync()
+	}
+}
+
+// triggerAlert replaces a waiting alert with its entry in the alert history in a single Firestore
+// transaction and sends it to the bot's stream. Alerts deleted in the meantime are dropped.
+func (bw *BotWorker) triggerAlert(alert *models.PriceAlert, price float64) error {
+	alertRef := bw.db.Collection(bw.collections.PriceAlerts).Doc(alert.ID)
+	historyRef := bw.db.Collection(bw.collections.AlertHistory).Doc(alert.ID)
+	triggered := alert.Trigger(price, time.Now())
+
+	stale := false
+	err := bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		stale = false
+		doc, err := tx.Get(alertRef)
+		if doc != nil && !doc.Exists() {
+			stale = true
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(alertRef)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(historyRef, triggered)
+	})
+	if err != nil {
+		return err
+	}
+
+	bw.alerts.remove(alert.Ticker, alert.ID)
+	if !stale {
+		bw.publish(alert.Bot.ID, &DataPacket{"price_alert", triggered})
+	}
+
+	return nil
+}
+
+// deliverAlertsAsync delivers triggered alerts in the background, failed deliveries are retried by the alert_delivery job
+func (bw *BotWorker) deliverAlertsAsync() {
+	go func() {
+		if err := bw.deliverAlerts(); err != nil {
+			log.Printf("error delivering price alerts: %v\n", err)
+		}
+	}()
+}
+
+// deliverAlerts posts every pending triggered alert that is due to its webhook and records the attempt.
+// Returns immediately if another delivery is running.
+func (bw *BotWorker) deliverAlerts() error {
+	if !bw.alerts.deliverMu.TryLock() {
+		return nil
+	}
+	defer bw.alerts.deliverMu.Unlock()
+
+	docs, err := bw.db.Collection(bw.collections.AlertHistory).Where("status", "==", models.AlertPending).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving pending price alerts: %v", err)
+	}
+
+	for _, doc := range docs {
+		triggered := &models.TriggeredAlert{}
+		if doc.DataTo(triggered) != nil || !triggered.Due(time.Now()) {
+			continue
+		}
+
+		triggered.ID = doc.Ref.ID
+		triggered.RecordAttempt(postPacket(triggered.Webhook, &DataPacket{"price_alert", triggered}), time.Now())
+		if triggered.Status == models.AlertDeadLetter {
+			log.Printf("price alert %s of %s dead lettered after %d attempts: %s\n", triggered.ID, triggered.Bot.ID, triggered.Attempts, triggered.LastError)
+		}
+
+		_, err = doc.Ref.Update(context.Background(), []firestore.Update{
+			{Path: "status", Value: triggered.Status},
+			{Path: "attempts", Value: triggered.Attempts},
+			{Path: "nextAttempt", Value: triggered.NextAttempt},
+			{Path: "deliveredAt", Value: triggered.DeliveredAt},
+			{Path: "lastError", Value: triggered.LastError},
+		})
+		if err != nil {
+			log.Printf("error recording delivery of price alert %s: %v\n", triggered.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// CreateAlert creates a price alert for the authenticated bot.
+// @Summary Create a price alert
+// @Description Creates an alert that triggers once, on the first price update where the ticker's price is at or above, or at or below, a level. The triggered alert is sent to the stream as a price_alert event, posted to the webhook if one is given, and recorded in the alert history
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param alert body AlertRequestData true "Price alert"
+// @Success 200 {object} DataPacket "Created price alert"
+// @Failure 400 {object} ResultData "Invalid price alert or too many alerts"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /alerts [post]
+func (bw *BotWorker) CreateAlert(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	request := &AlertRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	alert := &models.PriceAlert{
+		Ticker:        symbols.Canonical(request.Ticker),
+		Condition:     request.Condition,
+		Price:         request.Price,
+		Webhook:       strings.TrimSpace(request.Webhook),
+		Note:          request.Note,
+		CreatedAt:     time.Now(),
+		Bot:           ref,
+		SchemaVersion: bw.migrator.Latest(bw.collections.PriceAlerts),
+	}
+
+	err = alert.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	if len(bw.alerts.botAlerts(ref.ID)) >= maxAlertsPerBot {
+		c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: a bot can wait on at most %d price alerts", maxAlertsPerBot), false))
+		return
+	}
+
+	// The alert is stored before it can trigger so that it survives a restart
+	alert.ID = newID()
+	_, err = bw.db.Collection(bw.collections.PriceAlerts).Doc(alert.ID).Create(context.Background(), alert)
+	if err != nil {
+		log.Printf("error saving price alert %s: %v\n", alert.ID, err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save price alert", false))
+		return
+	}
+
+	bw.watchlist.AddTickers(alert.Ticker)
+	bw.alerts.add(alert)
+	c.JSON(200, &DataPacket{"price_alert", alert})
+}
+
+// GetAlerts returns the price alerts the authenticated bot is waiting on.
+// @Summary Get price alerts
+// @Description Retrieves the price alerts of the authenticated bot that have not triggered yet, oldest first
+// @Tags alerts
+// @Produce json
+// @Success 200 {object} DataPacket "Waiting price alerts"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /alerts [get]
+func (bw *BotWorker) GetAlerts(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"price_alerts", bw.alerts.botAlerts(ref.ID)})
+}
+
+// DeleteAlert deletes a price alert that has not triggered yet.
+// @Summary Delete a price alert
+// @Description Deletes a price alert of the authenticated bot that has not triggered yet
+// @Tags alerts
+// @Produce json
+// @Param id path string true "Price alert ID"
+// @Success 200 {object} ResultData "Price alert deleted"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Price alert not found"
+// @Router /alerts/{id} [delete]
+func (bw *BotWorker) DeleteAlert(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	alertRef := bw.db.Collection(bw.collections.PriceAlerts).Doc(c.Param("id"))
+	doc, err := alertRef.Get(context.Background())
+	alert := &models.PriceAlert{}
+	if err != nil || doc.DataTo(alert) != nil || alert.Bot == nil || alert.Bot.ID != ref.ID {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: price alert not found", false))
+		return
+	}
+
+	_, err = alertRef.Delete(context.Background(), firestore.Exists)
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: price alert not found", false))
+		return
+	}
+
+	bw.alerts.remove(alert.Ticker, alertRef.ID)
+	c.JSON(200, NewResultPacket("price alert deleted", true))
+}
+
+// GetAlertHistory returns the triggered price alerts of the authenticated bot with their delivery status.
+// @Summary Get the price alert history
+// @Description Lists the triggered price alerts of the authenticated bot, newest first, with the price that triggered them and the status of their webhook delivery, so bots can reconcile alerts they missed while offline
+// @Tags alerts
+// @Produce json
+// @Param since query string false "Only return alerts triggered after this RFC 3339 time"
+// @Param status query string false "Only return alerts with this delivery status: pending, delivered, dead_letter or stream_only"
+// @Param limit query int false "Number of alerts, 100 by default and at most 500"
+// @Success 200 {object} DataPacket "Triggered price alerts"
+// @Failure 400 {object} ResultData "Invalid query"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /alerts/history [get]
+func (bw *BotWorker) GetAlertHistory(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	limit := defaultAlertHistoryLimit
+	if query := c.Query("limit"); query != "" {
+		parsed, err := strconv.Atoi(query)
+		if err != nil || parsed <= 0 || parsed > maxAlertHistoryLimit {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: limit must be between 1 and 500", false))
+			return
+		}
+
+		limit = parsed
+	}
+
+	query := bw.db.Collection(bw.collections.AlertHistory).Where("bot", "==", ref)
+	if since := c.Query("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: since must be an RFC 3339 time", false))
+			return
+		}
+
+		query = query.Where("triggeredAt", ">", parsed)
+	}
+
+	if status := c.Query("status"); status != "" {
+		switch status {
+		case models.AlertPending, models.AlertDelivered, models.AlertDeadLetter, models.AlertStreamOnly:
+			query = query.Where("status", "==", status)
+		default:
+			c.AbortWithStatusJSON(400, NewResultPacket("error: status must be pending, delivered, dead_letter or stream_only", false))
+			return
+		}
+	}
+
+	docs, err := query.OrderBy("triggeredAt", firestore.Desc).Limit(limit).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve price alert history", false))
+		return
+	}
+
+	history := make([]*models.TriggeredAlert, 0, len(docs))
+	for _, doc := range docs {
+		triggered := &models.TriggeredAlert{}
+		if doc.DataTo(triggered) == nil {
+			triggered.ID = doc.Ref.ID
+			history = append(history, triggered)
+		}
+	}
+
+	c.JSON(200, &DataPacket{"price_alert_history", history})
+}
+
+// RedeliverAlert schedules another round of webhook deliveries for a dead lettered alert.
+// @Summary Redeliver a price alert
+// @Description Moves a dead lettered price alert of the authenticated bot back to pending, so its webhook delivery is retried from the first attempt, for example after fixing the webhook
+// @Tags alerts
+// @Produce json
+// @Param id path string true "Price alert ID"
+// @Success 200 {object} DataPacket "Requeued price alert"
+// @Failure 400 {object} ResultData "The alert is not dead lettered"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Price alert not found"
+// @Router /alerts/history/{id}/redeliver [post]
+func (bw *BotWorker) RedeliverAlert(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	historyRef := bw.db.Collection(bw.collections.AlertHistory).Doc(c.Param("id"))
+	doc, err := historyRef.Get(context.Background())
+	triggered := &models.TriggeredAlert{}
+	if err != nil || doc.DataTo(triggered) != nil || triggered.Bot == nil || triggered.Bot.ID != ref.ID {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: price alert not found", false))
+		return
+	}
+
+	triggered.ID = historyRef.ID
+	err = triggered.Requeue(time.Now())
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	_, err = historyRef.Update(context.Background(), []firestore.Update{
+		{Path: "status", Value: triggered.Status},
+		{Path: "attempts", Value: triggered.Attempts},
+		{Path: "nextAttempt", Value: triggered.NextAttempt},
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to requeue price alert", false))
+		return
+	}
+
+	bw.deliverAlertsAsync()
+	c.JSON(200, &DataPacket{"price_alert", triggered})
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// Lookbacks of the risk estimates of a trade analysis, in trading days
+const (
+	defaultRiskDays = 60
+	maxRiskDays     = 756
+)
+
+// SimulatedFill is the fill a proposed trade would get at the live price
+type SimulatedFill struct {
+	Ticker    string  `json:"ticker"`    // Stock ticker symbol
+	Action    string  `json:"action"`    // "buy" or "sell"
+	NumShares float64 `json:"numShares"` // Number of shares traded
+	Session   string  `json:"session"`   // Trading session the trade would execute in
+	FillPrice float64 `json:"fillPrice"` // Price per share, after session slippage
+	Fees      float64 `json:"fees"`      // Fees that would be charged
+	Total     float64 `json:"total"`     // Cash that would be paid for a buy or received for a sell, after fees
+	Currency  string  `json:"currency"`  // Currency of the fill price, fees and total
+}
+
+// TradeAnalysis is the impact of a proposed trade on a portfolio, without executing it
+type TradeAnalysis struct {
+	Fill             *SimulatedFill          `json:"fill"`             // Fill the trade would get
+	Accepted         bool                    `json:"accepted"`         // Whether every rule would pass
+	Error            string                  `json:"error"`            // Reason the trade would be rejected, empty if accepted
+	CompetitionRules []models.RuleEvaluation `json:"competitionRules"` // Competition rules that would apply
+	Rules            []models.RuleEvaluation `json:"rules"`            // Price protection and portfolio rules that would apply
+	PriceTime        time.Time               `json:"priceTime"`        // When the live prices were last updated
+	Before           *models.Exposure        `json:"before"`           // Portfolio before the trade
+	After            *models.Exposure        `json:"after"`            // Portfolio after the trade, nil if it would be rejected
+}
+
+// simulatedPortfolio copies the parts of a portfolio a trade changes, so it can be executed without side effects
+func simulatedPortfolio(portfolio *models.Portfolio) *models.Portfolio {
+	copied := *portfolio
+	copied.Holdings = make(map[string]*models.Holding, len(portfolio.Holdings))
+	for ticker, holding := range portfolio.Holdings {
+		copied.Holdings[ticker] = holding.Copy()
+	}
+
+	copied.ClosedPositions = slices.Clone(portfolio.ClosedPositions)
+
+	return &copied
+}
+
+// exposure values a portfolio at the live prices and estimates the risk of its positions
+func (bw *BotWorker) exposure(portfolio *models.Portfolio, days int) *models.Exposure {
+	exposure := models.CalculateExposure(portfolio, bw.latestPrices, bw.sectors)
+	exposure.Risk = bw.watchlist.Daily().EstimateRisk(exposure.Positions, days)
+	return exposure
+}
+
+// AnalyzeTrade reports the impact of a proposed trade without executing it.
+// @Summary Analyze a proposed trade
+// @Description Simulates a transaction at the live price and reports whether it would pass every rule, and the portfolio weights, sector exposure, estimated risk and buying power before and after it. Nothing is executed or recorded
+// @Tags transactions
+// @Accept json
+// @Produce json
+// @Param transaction body TransactionRequestData true "Proposed transaction"
+// @Param days query int false "Trading days of history the risk estimates are based on (default 60, at most 756)"
+// @Success 200 {object} DataPacket "Trade analysis"
+// @Failure 400 {object} ValidationErrorData "Malformed or invalid request body"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "No live price for the ticker"
+// @Router /analyze/trade [post]
+func (bw *BotWorker) AnalyzeTrade(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	days := defaultRiskDays
+	if query, ok := c.GetQuery("days"); ok {
+		parsed, err := strconv.Atoi(query)
+		if err != nil || parsed < 2 || parsed > maxRiskDays {
+			c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: days must be between 2 and %d", maxRiskDays), false))
+			return
+		}
+
+		days = parsed
+	}
+
+	request, ok := bw.parseTransactionRequest(c)
+	if !ok {
+		return
+	}
+
+	price, ok := bw.latestPrices[request.Ticker]
+	if !ok {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: no live price for "+request.Ticker+", add the ticker and wait for a price update first", false))
+		return
+	}
+
+	simulated := simulatedPortfolio(portfolio)
+	transaction := &models.Transaction{
+		Time:      time.Now(),
+		NumShares: request.NumShares,
+		UnitCost:  price,
+		Ticker:    request.Ticker,
+		Action:    request.Action,
+		Currency:  portfolio.CurrencyOfRecord(),
+	}
+
+	decision := &models.OrderDecision{
+		Time:           transaction.Time,
+		Action:         request.Action,
+		Ticker:         request.Ticker,
+		NumShares:      request.NumShares,
+		LimitPrice:     request.LimitPrice,
+		ReferencePrice: request.ReferencePrice,
+		MaxSlippageBps: request.MaxSlippageBps,
+	}
+
+	err := bw.executeTransaction(simulated, transaction, decision)
+
+	fill := &SimulatedFill{
+		Ticker:    transaction.Ticker,
+		Action:    transaction.Action,
+		NumShares: transaction.NumShares,
+		Session:   transaction.Session,
+		FillPrice: transaction.UnitCost,
+		Fees:      transaction.Fee,
+		Total:     money.Default().Add(transaction.Value(), transaction.Fee),
+		Currency:  transaction.CurrencyOfRecord(),
+	}
+
+	// Sellers receive the traded value less the fee
+	if transaction.Action == "sell" {
+		fill.Total = money.Default().Sub(transaction.Value(), transaction.Fee)
+	}
+
+	analysis := &TradeAnalysis{
+		Fill:             fill,
+		Accepted:         err == nil,
+		CompetitionRules: decision.CompetitionRules,
+		Rules:            decision.Rules,
+		PriceTime:        bw.pricesTime,
+		Before:           bw.exposure(portfolio, days),
+	}
+
+	if err != nil {
+		analysis.Error = err.Error()
+	} else {
+		analysis.After = bw.exposure(simulated, days)
+	}
+
+	c.JSON(200, &DataPacket{"trade_analysis", analysis})
+}
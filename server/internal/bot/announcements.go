@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"github.com/olahol/melody"
+	"google.golang.org/api/iterator"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Announcements returned by GetAnnouncements unless a limit is requested
+const (
+	defaultAnnouncementLimit = 50
+	maxAnnouncementLimit     = 200
+)
+
+// AnnouncementRequestData represents an admin request to post an announcement
+type AnnouncementRequestData struct {
+	Category    string `json:"category"`                             // "general", "rule_change" or "downtime", "general" if empty
+	Title       string `json:"title" binding:"required,max=200"`     // Short summary
+	Message     string `json:"message" binding:"required,max=10000"` // Full text of the announcement
+	Competition string `json:"competition"`                          // ID of the competition addressed, empty for every bot
+}
+
+// PostAnnouncement stores an announcement and pushes it to the bots it addresses.
+// @Summary Post an announcement
+// @Description Posts a message, such as a rule change or downtime notice, to every bot or to the bots of one competition. Connected bots receive it over the WebSocket as an announcement event and every bot can fetch it from GET /announcements
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param announcement body AnnouncementRequestData true "Announcement"
+// @Success 200 {object} DataPacket "Posted announcement"
+// @Failure 400 {object} ResultData "Invalid announcement"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Router /admin/announcements [post]
+func (bw *BotWorker) PostAnnouncement(c *gin.Context) {
+	request := &AnnouncementRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	announcement := &models.Announcement{
+		Category:    request.Category,
+		Title:       request.Title,
+		Message:     request.Message,
+		Competition: request.Competition,
+		// Firestore stores microseconds, so the pushed time can be passed back as since
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+
+	err = announcement.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	var competitionRef *firestore.DocumentRef
+	if announcement.Competition != "" {
+		competitionRef = bw.db.Collection(bw.collections.Competitions).Doc(announcement.Competition)
+		if _, err := competitionRef.Get(context.Background()); err != nil {
+			c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+			return
+		}
+	}
+
+	ref, _, err := bw.db.Collection(bw.collections.Announcements).Add(context.Background(), announcement)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save announcement", false))
+		return
+	}
+
+	announcement.ID = ref.ID
+	bw.announce(announcement, competitionRef)
+
+	audience := "every bot"
+	if competitionRef != nil {
+		audience = "competition " + competitionRef.ID
+	}
+
+	bw.audit(c, "announcement.post", fmt.Sprintf("posted %s announcement %q to %s", announcement.Category, announcement.Title, audience), announcement)
+	c.JSON(200, &DataPacket{"announcement", announcement})
+}
+
+// announce pushes an announcement over the WebSocket to every bot, or only to the bots of its competition
+func (bw *BotWorker) announce(announcement *models.Announcement, competitionRef *firestore.DocumentRef) {
+	packet := &DataPacket{"announcement", announcement}
+	if competitionRef == nil {
+		bw.broadcast(packet)
+		return
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Bots).Where("competition", "==", competitionRef).Select().Documents(context.Background()).GetAll()
+	if err != nil {
+		log.Printf("error retrieving bots of competition %s for announcement %s: %v\n", competitionRef.ID, announcement.ID, err)
+		return
+	}
+
+	bots := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		bots[doc.Ref.ID] = true
+	}
+
+	err = bw.send(packet, func(s *melody.Session) bool {
+		id, _ := s.Get("bot")
+		botID, _ := id.(string)
+		return bots[botID]
+	})
+	if err != nil {
+		log.Printf("error publishing announcement %s: %v\n", announcement.ID, err)
+	}
+}
+
+// GetAnnouncements returns the announcements addressed to the authenticated bot, oldest first.
+// @Summary Get announcements
+// @Description Lists the announcements addressed to every bot or to the authenticated bot's competition, oldest first. Pass the createdAt of the last announcement received as since to only fetch newer ones. When more announcements follow, the X-Next-Cursor header carries the cursor of the next page
+// @Tags announcements
+// @Produce json
+// @Param since query string false "Only return announcements posted after this RFC 3339 time"
+// @Param limit query int false "Number of announcements, 50 by default and at most 200"
+// @Param cursor query string false "Cursor of the page to return, from the X-Next-Cursor header of the previous page"
+// @Success 200 {object} DataPacket "Announcements"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, missing on the last page"
+// @Failure 400 {object} ResultData "Invalid since, limit or cursor"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /announcements [get]
+func (bw *BotWorker) GetAnnouncements(c *gin.Context) {
+	var since time.Time
+	if query := c.Query("since"); query != "" {
+		parsed, err := time.Parse(time.RFC3339Nano, query)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: since must be an RFC 3339 time", false))
+			return
+		}
+
+		since = parsed
+	}
+
+	page, ok := parsePageRequest(c, defaultAnnouncementLimit, maxAnnouncementLimit)
+	if !ok {
+		return
+	}
+
+	portfolio, _, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	competition := ""
+	if portfolio.Competition != nil {
+		competition = portfolio.Competition.ID
+	}
+
+	// Announcements of other competitions are skipped while reading, so the query is not limited
+	query := bw.db.Collection(bw.collections.Announcements).Where("createdAt", ">", since)
+	iter := page.order(query, "createdAt", firestore.Asc).Documents(context.Background())
+	defer iter.Stop()
+
+	announcements := make([]*models.Announcement, 0)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error retrieving announcements", false))
+			return
+		}
+
+		announcement := &models.Announcement{}
+		if doc.DataTo(announcement) != nil || !announcement.Addresses(competition) {
+			continue
+		}
+
+		if len(announcements) == page.limit {
+			last := announcements[len(announcements)-1]
+			setNextCursor(c, timeCursor(last.CreatedAt, last.ID))
+			break
+		}
+
+		announcement.ID = doc.Ref.ID
+		announcements = append(announcements, announcement)
+	}
+
+	c.JSON(200, &DataPacket{"announcements", announcements})
+}
@@ -0,0 +1,187 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// maxAnomalies is the number of recent price anomalies kept for the admin endpoint
+const maxAnomalies = 100
+
+// AnomalyStatus reports the recent price anomalies and the live prices waiting in quarantine
+type AnomalyStatus struct {
+	MaxJump     float64                         `json:"maxJump"`     // Factor a price can move by between updates before it is quarantined, 0 only rejects invalid prices
+	Quarantined map[string]*models.PriceAnomaly `json:"quarantined"` // Latest quarantined live price of each ticker whose prices are being rejected
+	Anomalies   []*models.PriceAnomaly          `json:"anomalies"`   // Recent anomalies, newest first
+}
+
+// anomalyTracker keeps the recent price anomalies. While a ticker's live prices are quarantined it keeps
+// its previous price, until a plausible price arrives or an administrator accepts the new price level.
+type anomalyTracker struct {
+	mu          sync.Mutex
+	maxJump     float64
+	anomalies   []*models.PriceAnomaly
+	quarantined map[string]*models.PriceAnomaly // Latest quarantined live price by ticker
+	accepted    map[string]bool                 // Tickers whose next live price is used without a jump check
+}
+
+// newAnomalyTracker creates an anomaly tracker configured by PRICE_ANOMALY_MAX_JUMP,
+// which defaults to models.DefaultMaxPriceJump. 0 disables the jump check.
+func newAnomalyTracker() (*anomalyTracker, error) {
+	tracker := &anomalyTracker{
+		maxJump:     models.DefaultMaxPriceJump,
+		anomalies:   make([]*models.PriceAnomaly, 0),
+		quarantined: make(map[string]*models.PriceAnomaly),
+		accepted:    make(map[string]bool),
+	}
+
+	if env := os.Getenv("PRICE_ANOMALY_MAX_JUMP"); env != "" {
+		parsed, err := strconv.ParseFloat(env, 64)
+		if err != nil || (parsed != 0 && parsed <= 1) {
+			return nil, fmt.Errorf("invalid PRICE_ANOMALY_MAX_JUMP, must be 0 or greater than 1: %s", env)
+		}
+
+		tracker.maxJump = parsed
+	}
+
+	return tracker, nil
+}
+
+// record adds an anomaly to the recent anomalies and alerts administrators in the log
+func (at *anomalyTracker) record(anomaly *models.PriceAnomaly) {
+	log.Printf("ALERT: quarantined %s price %g of %s: %s\n", anomaly.Source, anomaly.Price, anomaly.Ticker, anomaly.Reason)
+
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	at.anomalies = append([]*models.PriceAnomaly{anomaly}, at.anomalies...)
+	if len(at.anomalies) > maxAnomalies {
+		at.anomalies = at.anomalies[:maxAnomalies]
+	}
+
+	if anomaly.Source == models.AnomalySourceLive {
+		at.quarantined[anomaly.Ticker] = anomaly
+	}
+}
+
+// check returns the anomaly of a live price compared to the previous price of its ticker, nil if it is plausible.
+// A ticker's first price after an administrator accepted its price level is only checked for validity.
+func (at *anomalyTracker) check(ticker string, previous, price float64, now time.Time) *models.PriceAnomaly {
+	at.mu.Lock()
+	if at.accepted[ticker] {
+		previous = 0
+	}
+
+	reason := models.CheckPrice(previous, price, 1, at.maxJump)
+	if reason == "" {
+		delete(at.accepted, ticker)
+		delete(at.quarantined, ticker)
+	}
+
+	at.mu.Unlock()
+
+	if reason == "" {
+		return nil
+	}
+
+	anomaly := &models.PriceAnomaly{
+		Ticker:   ticker,
+		Source:   models.AnomalySourceLive,
+		Date:     now,
+		Previous: previous,
+		Price:    price,
+		Reason:   reason,
+	}
+
+	at.record(anomaly)
+	return anomaly
+}
+
+// accept lets the next live price of a quarantined ticker through without a jump check.
+// Returns false if the ticker's prices are not quarantined.
+func (at *anomalyTracker) accept(ticker string) bool {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if _, ok := at.quarantined[ticker]; !ok {
+		return false
+	}
+
+	at.accepted[ticker] = true
+	return true
+}
+
+// status returns the recent anomalies and a copy of the quarantined prices
+func (at *anomalyTracker) status() *AnomalyStatus {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	quarantined := make(map[string]*models.PriceAnomaly, len(at.quarantined))
+	for ticker, anomaly := range at.quarantined {
+		quarantined[ticker] = anomaly
+	}
+
+	return &AnomalyStatus{MaxJump: at.maxJump, Quarantined: quarantined, Anomalies: append([]*models.PriceAnomaly{}, at.anomalies...)}
+}
+
+// filterPrices quarantines live prices that are invalid or jumped implausibly far from the previous
+// live price, or from the previous close if the ticker has no live price yet. Quarantined tickers keep
+// their previous live price, or are left out if they have none, so bad ticks never reach valuations or fills.
+func (bw *BotWorker) filterPrices(prices map[string]float64, now time.Time) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	for ticker, price := range prices {
+		previous, ok := bw.latestPrices[ticker]
+		if !ok {
+			previous, _ = previousClose(bw.watchlist.Daily(), ticker, day)
+		}
+
+		if bw.anomalies.check(ticker, previous, price, now) == nil {
+			continue
+		}
+
+		if current, ok := bw.latestPrices[ticker]; ok {
+			prices[ticker] = current
+		} else {
+			delete(prices, ticker)
+		}
+	}
+}
+
+// GetAnomalies returns the recent price anomalies.
+// @Summary Get price anomalies
+// @Description Lists the recent downloaded bars and live prices that were quarantined because they were not positive or moved more than PRICE_ANOMALY_MAX_JUMP times from the previous price without a matching split factor, and the tickers whose live prices are currently rejected
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Anomaly status"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/anomalies [get]
+func (bw *BotWorker) GetAnomalies(c *gin.Context) {
+	c.JSON(200, &DataPacket{"anomalies", bw.anomalies.status()})
+}
+
+// AcceptPriceLevel accepts the new price level of a ticker whose live prices are quarantined.
+// @Summary Accept a quarantined price level
+// @Description Uses the next live price of the ticker without comparing it to the previous price, for genuine moves such as a split that the live prices do not report. The ticker's later prices are checked against the accepted price
+// @Tags admin
+// @Produce json
+// @Param ticker path string true "Ticker symbol"
+// @Success 200 {object} ResultData "Price level accepted"
+// @Failure 404 {object} ResultData "Ticker prices are not quarantined"
+// @Router /admin/anomalies/{ticker}/accept [post]
+func (bw *BotWorker) AcceptPriceLevel(c *gin.Context) {
+	ticker := symbols.Canonical(c.Param("ticker"))
+	if !bw.anomalies.accept(ticker) {
+		c.AbortWithStatusJSON(404, NewResultPacket(fmt.Sprintf("error: live prices of %s are not quarantined", ticker), false))
+		return
+	}
+
+	c.JSON(200, NewResultPacket(fmt.Sprintf("the next live price of %s will be accepted", ticker), true))
+}
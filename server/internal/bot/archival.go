@@ -0,0 +1,458 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/export"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// defaultArchiveAfterDays is how many days after it ended a competition is archived unless ARCHIVE_AFTER_DAYS is set
+const defaultArchiveAfterDays = 30
+
+// competitionArchive is the documents of a competition that are moved to cold storage
+type competitionArchive struct {
+	competition  *firestore.DocumentSnapshot
+	bots         []*firestore.DocumentSnapshot
+	shadows      []*firestore.DocumentSnapshot
+	transactions []*firestore.DocumentSnapshot
+	decisions    []*firestore.DocumentSnapshot
+	orderGroups  []*firestore.DocumentSnapshot
+	alerts       []*firestore.DocumentSnapshot
+	alertHistory []*firestore.DocumentSnapshot
+	digests      []*firestore.DocumentSnapshot
+	standings    []export.StandingSnapshot
+}
+
+// removable returns every document that is removed from Firestore once the archive is stored.
+// The competition itself is kept and marked as archived.
+func (ca *competitionArchive) removable() []*firestore.DocumentSnapshot {
+	docs := make([]*firestore.DocumentSnapshot, 0)
+	for _, group := range [][]*firestore.DocumentSnapshot{ca.transactions, ca.decisions, ca.orderGroups, ca.alerts, ca.alertHistory, ca.digests, ca.shadows, ca.bots} {
+		docs = append(docs, group...)
+	}
+
+	return docs
+}
+
+// parseArchiveAfter parses ARCHIVE_AFTER_DAYS, which defaults to defaultArchiveAfterDays
+func parseArchiveAfter() (int, error) {
+	env := os.Getenv("ARCHIVE_AFTER_DAYS")
+	if env == "" {
+		return defaultArchiveAfterDays, nil
+	}
+
+	days, err := strconv.Atoi(env)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("invalid ARCHIVE_AFTER_DAYS, must be a non-negative number of days: %s", env)
+	}
+
+	return days, nil
+}
+
+// archiveObject returns the name of the cold storage object holding the archive of a competition
+func archiveObject(competitionID string) string {
+	return "competitions/" + competitionID + ".ndjson.gz"
+}
+
+// archiveCompetitions archives every competition that ended at least ARCHIVE_AFTER_DAYS ago and is not archived yet
+func (bw *BotWorker) archiveCompetitions() error {
+	if bw.archive == nil {
+		return nil
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Competitions).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving competitions: %v", err)
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -bw.archiveAfterDays)
+	errs := make([]error, 0)
+	for _, doc := range docs {
+		competition := &models.Competition{}
+		if doc.DataTo(competition) != nil || !competition.ArchivedAt.IsZero() || competition.Ends.IsZero() || competition.Ends.After(cutoff) {
+			continue
+		}
+
+		manifest, err := bw.archiveCompetition(doc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error archiving competition %s: %v", doc.Ref.ID, err))
+			continue
+		}
+
+		log.Printf("archived competition %s: %v\n", doc.Ref.ID, manifest.Records)
+	}
+
+	return errors.Join(errs...)
+}
+
+// collectArchive loads every document of a competition: its bots with their shadow portfolios, their transactions,
+// order decisions and order groups, the bots' price alerts with their alert history, and the competition's digests.
+// The daily leaderboard snapshots are calculated from the bots' account value histories.
+func (bw *BotWorker) collectArchive(competition *firestore.DocumentSnapshot) (*competitionArchive, error) {
+	ctx := context.Background()
+	archive := &competitionArchive{competition: competition}
+
+	var err error
+	archive.bots, err = bw.db.Collection(bw.collections.Bots).Where("competition", "==", competition.Ref).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving bots: %v", err)
+	}
+
+	histories := make(map[string][]*models.AccountValueHistory, len(archive.bots))
+	portfolios := make([]*firestore.DocumentSnapshot, 0, len(archive.bots))
+	for _, bot := range archive.bots {
+		shadows, err := bot.Ref.Collection(bw.collections.Shadows).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving shadow portfolios of %s: %v", bot.Ref.ID, err)
+		}
+
+		archive.shadows = append(archive.shadows, shadows...)
+		portfolios = append(append(portfolios, bot), shadows...)
+
+		// Price alerts belong to the bot, not to its shadow portfolios
+		alerts, err := bw.db.Collection(bw.collections.PriceAlerts).Where("bot", "==", bot.Ref).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving price alerts of %s: %v", bot.Ref.ID, err)
+		}
+
+		archive.alerts = append(archive.alerts, alerts...)
+
+		history, err := bw.db.Collection(bw.collections.AlertHistory).Where("bot", "==", bot.Ref).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving alert history of %s: %v", bot.Ref.ID, err)
+		}
+
+		archive.alertHistory = append(archive.alertHistory, history...)
+	}
+
+	for _, doc := range portfolios {
+		portfolio := &models.Portfolio{}
+		err = doc.DataTo(portfolio)
+		if err != nil {
+			return nil, fmt.Errorf("error loading portfolio %s: %v", doc.Ref.Path, err)
+		}
+
+		if !portfolio.Shadow {
+			histories[doc.Ref.ID] = portfolio.HistoricalAccountValue
+		}
+
+		transactions, err := bw.db.GetAll(ctx, portfolio.TransactionReferences)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving transactions of %s: %v", doc.Ref.Path, err)
+		}
+
+		for _, transaction := range transactions {
+			if transaction.Exists() {
+				archive.transactions = append(archive.transactions, transaction)
+			}
+		}
+
+		decisions, err := bw.db.Collection(bw.collections.OrderDecisions).Where("bot", "==", doc.Ref).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving order decisions of %s: %v", doc.Ref.Path, err)
+		}
+
+		archive.decisions = append(archive.decisions, decisions...)
+
+		groups, err := bw.db.Collection(bw.collections.OrderGroups).Where("bot", "==", doc.Ref).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving order groups of %s: %v", doc.Ref.Path, err)
+		}
+
+		archive.orderGroups = append(archive.orderGroups, groups...)
+	}
+
+	archive.digests, err = competition.Ref.Collection(competitionDigests).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving digests: %v", err)
+	}
+
+	archive.standings = export.Standings(histories)
+	return archive, nil
+}
+
+// archiveCompetition writes a competition's documents to cold storage as compressed newline delimited JSON, marks the
+// competition as archived and removes the archived documents from Firestore. The bots' order groups, protections and
+// price alerts are dropped from memory first, so they stop triggering against removed portfolios. Documents that fail
+// to be removed are logged and kept, the competition stays archived since its archive is complete.
+func (bw *BotWorker) archiveCompetition(competition *firestore.DocumentSnapshot) (*export.ArchiveManifestData, error) {
+	archive, err := bw.collectArchive(competition)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &export.ArchiveManifestData{
+		Competition: competition.Ref.ID,
+		CreatedAt:   time.Now(),
+		Records: map[string]int{
+			export.ArchiveCompetition:  1,
+			export.ArchiveBot:          len(archive.bots),
+			export.ArchiveShadow:       len(archive.shadows),
+			export.ArchiveTransaction:  len(archive.transactions),
+			export.ArchiveDecision:     len(archive.decisions),
+			export.ArchiveOrderGroup:   len(archive.orderGroups),
+			export.ArchiveAlert:        len(archive.alerts),
+			export.ArchiveAlertHistory: len(archive.alertHistory),
+			export.ArchiveDigest:       len(archive.digests),
+			export.ArchiveStanding:     len(archive.standings),
+		},
+	}
+
+	ctx := context.Background()
+	name := archiveObject(competition.Ref.ID)
+	err = bw.archive.Upload(ctx, name, "application/x-ndjson", func(w io.Writer) error {
+		writer := export.NewArchiveWriter(w)
+		err := writer.WriteData(export.ArchiveManifest, manifest)
+		if err != nil {
+			return err
+		}
+
+		err = writer.WriteDocument(export.ArchiveCompetition, competition)
+		if err != nil {
+			return err
+		}
+
+		for _, group := range []struct {
+			kind string
+			docs []*firestore.DocumentSnapshot
+		}{
+			{export.ArchiveBot, archive.bots},
+			{export.ArchiveShadow, archive.shadows},
+			{export.ArchiveTransaction, archive.transactions},
+			{export.ArchiveDecision, archive.decisions},
+			{export.ArchiveOrderGroup, archive.orderGroups},
+			{export.ArchiveAlert, archive.alerts},
+			{export.ArchiveAlertHistory, archive.alertHistory},
+			{export.ArchiveDigest, archive.digests},
+		} {
+			for _, doc := range group.docs {
+				err = writer.WriteDocument(group.kind, doc)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, standing := range archive.standings {
+			err = writer.WriteData(export.ArchiveStanding, standing)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = competition.Ref.Update(ctx, []firestore.Update{
+		{Path: "archivedAt", Value: manifest.CreatedAt},
+		{Path: "archive", Value: name},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marking competition as archived: %v", err)
+	}
+
+	bw.releaseArchived(archive)
+
+	writer := bw.db.BulkWriter(ctx)
+	jobs := make(map[string]*firestore.BulkWriterJob)
+	for _, doc := range archive.removable() {
+		job, err := writer.Delete(doc.Ref)
+		if err != nil {
+			log.Printf("error removing archived document %s: %v\n", doc.Ref.Path, err)
+			continue
+		}
+
+		jobs[doc.Ref.Path] = job
+	}
+
+	writer.End()
+	for path, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("error removing archived document %s: %v\n", path, err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// releaseArchived drops the order groups, protections and price alerts of an archived competition's bots and shadow
+// portfolios from memory
+func (bw *BotWorker) releaseArchived(archive *competitionArchive) {
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	for _, doc := range append(slices.Clone(archive.bots), archive.shadows...) {
+		bw.orders.RemoveBot(doc.Ref.ID)
+		bw.protections.removePortfolio(doc.Ref)
+	}
+
+	for _, bot := range archive.bots {
+		bw.alerts.removeBot(bot.Ref.ID)
+	}
+}
+
+// restoreCompetition writes every archived document of a competition back to Firestore and clears its archived mark.
+// The archive is kept in cold storage. Restored order groups, protections and price alerts are loaded into memory at the next start. Returns the number of restored documents of each kind.
+func (bw *BotWorker) restoreCompetition(ref *firestore.DocumentRef, name string) (map[string]int, error) {
+	ctx := context.Background()
+	restored := make(map[string]int)
+	failed := 0
+
+	writer := bw.db.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0)
+	err := bw.archive.Download(ctx, name, func(r io.Reader) error {
+		return export.ReadArchive(r, bw.db, func(record *export.ArchiveRecord) error {
+			// The competition document was never removed
+			if record.Path == "" || record.Kind == export.ArchiveCompetition {
+				return nil
+			}
+
+			job, err := writer.Set(bw.db.Doc(record.Path), record.Data)
+			if err != nil {
+				return fmt.Errorf("error restoring %s: %v", record.Path, err)
+			}
+
+			jobs = append(jobs, job)
+			restored[record.Kind]++
+			return nil
+		})
+	})
+
+	writer.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			failed++
+			log.Printf("error restoring archived document: %v\n", err)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if failed > 0 {
+		return nil, fmt.Errorf("%d documents failed to restore", failed)
+	}
+
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "archivedAt", Value: firestore.Delete},
+		{Path: "archive", Value: firestore.Delete},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error clearing archived mark: %v", err)
+	}
+
+	return restored, nil
+}
+
+// loadArchivable loads the competition of the request for archival, aborting the request if cold storage is disabled
+// or the competition does not exist
+func (bw *BotWorker) loadArchivable(c *gin.Context) (*firestore.DocumentSnapshot, *models.Competition, bool) {
+	if bw.archive == nil {
+		c.AbortWithStatusJSON(503, NewResultPacket("error: cold storage is not configured", false))
+		return nil, nil, false
+	}
+
+	doc, err := bw.db.Collection(bw.collections.Competitions).Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+		return nil, nil, false
+	}
+
+	competition := &models.Competition{}
+	err = doc.DataTo(competition)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load competition", false))
+		return nil, nil, false
+	}
+
+	return doc, competition, true
+}
+
+// ArchiveCompetition moves a finished competition to cold storage right away.
+// @Summary Archive a competition
+// @Description Exports the bots, shadow portfolios, transactions, order decisions, order groups, price alerts, alert history, digests and daily leaderboard snapshots of a competition that ended to cold storage as compressed newline delimited JSON, then removes them from Firestore. Their order groups, protections and price alerts stop triggering. The competition document is kept and marked as archived
+// @Tags admin
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Success 200 {object} DataPacket "Archive manifest"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Failure 409 {object} ResultData "Competition has not ended or is already archived"
+// @Failure 500 {object} ResultData "Archival failed"
+// @Failure 503 {object} ResultData "Cold storage is not configured"
+// @Router /admin/competitions/{id}/archive [post]
+func (bw *BotWorker) ArchiveCompetition(c *gin.Context) {
+	doc, competition, ok := bw.loadArchivable(c)
+	if !ok {
+		return
+	}
+
+	switch {
+	case !competition.ArchivedAt.IsZero():
+		c.AbortWithStatusJSON(409, NewResultPacket("error: competition is already archived", false))
+		return
+	case competition.Ends.IsZero() || time.Now().Before(competition.Ends):
+		c.AbortWithStatusJSON(409, NewResultPacket("error: only competitions that ended can be archived", false))
+		return
+	}
+
+	manifest, err := bw.archiveCompetition(doc)
+	if err != nil {
+		log.Printf("error archiving competition %s: %v\n", doc.Ref.ID, err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to archive competition", false))
+		return
+	}
+
+	bw.audit(c, "competition.archive", fmt.Sprintf("archived competition %s to %s", doc.Ref.ID, archiveObject(doc.Ref.ID)), manifest)
+	c.JSON(200, &DataPacket{"competition_archive", manifest})
+}
+
+// RestoreCompetition restores an archived competition from cold storage.
+// @Summary Restore an archived competition
+// @Description Writes every archived document of a competition back to Firestore and clears its archived mark. The archive is kept in cold storage
+// @Tags admin
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Success 200 {object} DataPacket "Number of restored documents by kind"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Failure 409 {object} ResultData "Competition is not archived"
+// @Failure 500 {object} ResultData "Restore failed"
+// @Failure 503 {object} ResultData "Cold storage is not configured"
+// @Router /admin/competitions/{id}/restore [post]
+func (bw *BotWorker) RestoreCompetition(c *gin.Context) {
+	doc, competition, ok := bw.loadArchivable(c)
+	if !ok {
+		return
+	}
+
+	if competition.ArchivedAt.IsZero() {
+		c.AbortWithStatusJSON(409, NewResultPacket("error: competition is not archived", false))
+		return
+	}
+
+	restored, err := bw.restoreCompetition(doc.Ref, competition.Archive)
+	if err != nil {
+		log.Printf("error restoring competition %s: %v\n", doc.Ref.ID, err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to restore competition", false))
+		return
+	}
+
+	bw.audit(c, "competition.restore", fmt.Sprintf("restored competition %s from %s", doc.Ref.ID, competition.Archive), restored)
+	c.JSON(200, &DataPacket{"competition_restore", restored})
+}
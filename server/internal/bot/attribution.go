@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// maxStrategyTagLength is the longest strategy tag a transaction or order group accepts
+const maxStrategyTagLength = 64
+
+// GetAttribution decomposes the profit and loss of the portfolio by ticker and strategy tag.
+// @Summary Get performance attribution
+// @Description Replays the portfolio's transactions as FIFO lots and attributes the realized and unrealized gains and the fees of a period to every ticker and strategy tag. Shares held at the start of the period are marked at the previous close, and shares held at the end at the close of the end date, or the live price if the period ends today
+// @Tags portfolio
+// @Produce json
+// @Param start query string false "First day of the period as YYYY-MM-DD, defaults to the inception of the portfolio"
+// @Param end query string false "Last day of the period as YYYY-MM-DD, defaults to today"
+// @Success 200 {object} DataPacket "Attribution"
+// @Failure 400 {object} ResultData "Invalid period"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /portfolio/attribution [get]
+func (bw *BotWorker) GetAttribution(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+
+	var start time.Time
+	if query := c.Query("start"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil || parsed.After(today) {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: start must be a date formatted as YYYY-MM-DD, not in the future", false))
+			return
+		}
+
+		start = parsed
+	}
+
+	end := today
+	if query := c.Query("end"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil || parsed.Before(start) {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: end must be a date formatted as YYYY-MM-DD on or after start", false))
+			return
+		}
+
+		end = parsed
+	}
+
+	transactions, err := bw.loadTransactions(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
+
+	history := bw.watchlist.Daily()
+	startPrice := func(ticker string) (float64, bool) {
+		price, _ := previousClose(history, ticker, start)
+		return price, price > 0
+	}
+
+	// Periods that end today are marked at the live prices, earlier periods at the close of their last day
+	endPrice := func(ticker string) (float64, bool) {
+		price, ok := bw.latestPrices[ticker]
+		return price, ok
+	}
+
+	periodEnd := now
+	if end.Before(today) {
+		periodEnd = end.Add(24*time.Hour - time.Nanosecond)
+		endPrice = func(ticker string) (float64, bool) {
+			price, _ := previousClose(history, ticker, end.Add(24*time.Hour))
+			return price, price > 0
+		}
+	}
+
+	attribution := models.Attribute(transactions, start, periodEnd, startPrice, endPrice, portfolio.CurrencyOfRecord())
+	c.JSON(200, &DataPacket{"attribution", attribution})
+}
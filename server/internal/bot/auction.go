@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// queuedForOpenReason is the reason recorded when an order is queued for the open
+const queuedForOpenReason = "market closed, fills at the next session's opening price"
+
+// marketClosed checks whether the exchange of a ticker has no open session at a time, after any market override
+func (bw *BotWorker) marketClosed(ticker string, t time.Time) bool {
+	session, _ := bw.sessionAt(bw.exchangeFor(ticker), t)
+	return session == nil
+}
+
+// queuesForOpen checks whether a trade of a ticker requested at a time waits for the next session's opening price
+func (bw *BotWorker) queuesForOpen(ticker string, t time.Time) bool {
+	return bw.openingAuction && bw.marketClosed(ticker, t)
+}
+
+// openingLimit returns the worst price a transaction request accepts, from its limit price and its largest
+// acceptable slippage from its reference price, or 0 if it accepts any price
+func openingLimit(request *TransactionRequestData) float64 {
+	limit := request.LimitPrice
+	if request.ReferencePrice <= 0 || request.MaxSlippageBps <= 0 {
+		return limit
+	}
+
+	if request.Action == "buy" {
+		worst := request.ReferencePrice * (10000 + request.MaxSlippageBps) / 10000
+		if limit <= 0 || worst < limit {
+			return worst
+		}
+
+		return limit
+	}
+
+	return max(limit, request.ReferencePrice*(10000-request.MaxSlippageBps)/10000)
+}
+
+// queueForOpen places a transaction requested while the market of its ticker is closed as an order that fills at
+// the next session's opening price, instead of rejecting it or filling it at the last price before the close, and
+// responds with 202 and the order group. A limit price or slippage bound of the request becomes the limit price of
+// the order.
+func (bw *BotWorker) queueForOpen(c *gin.Context, ref *firestore.DocumentRef, request *TransactionRequestData) {
+	order := &OrderRequestData{Type: models.OrderTypeMarket, Action: request.Action, Ticker: request.Ticker, NumShares: request.NumShares}
+	if limit := openingLimit(request); limit > 0 {
+		order.Type = models.OrderTypeLimit
+		order.LimitPrice = limit
+	}
+
+	group, err := buildOrderGroup(&OrderGroupRequestData{
+		Type:        models.OrderGroupSingle,
+		TimeInForce: models.TimeInForceGTC,
+		Orders:      []*OrderRequestData{order},
+		Tag:         request.Tag,
+	}, ref)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	group.SchemaVersion = bw.migrator.Latest(bw.collections.OrderGroups)
+	group.QueueForOpen(group.Orders[0], queuedForOpenReason, group.CreatedAt)
+
+	// The group is stored before the market opens so that it survives a restart
+	err = bw.saveOrderGroup(group)
+	if err != nil {
+		log.Printf("error saving order group %s: %v\n", group.ID, err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to queue transaction for the open", false))
+		return
+	}
+
+	bw.watchlist.AddTickers(request.Ticker)
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	bw.orders.Add(group)
+	bw.publish(ref.ID, &DataPacket{"order_group_update", group})
+	c.Header("Location", "/orders")
+	c.JSON(202, &DataPacket{"order_group", group})
+}
+
+// queueMarketOrdersForOpen queues the market orders of a group placed while their market is closed for the next
+// session's opening price. Limit and stop orders stay open, as their price condition protects them.
+func (bw *BotWorker) queueMarketOrdersForOpen(group *models.OrderGroup) {
+	for _, order := range group.Orders {
+		if order.Type == models.OrderTypeMarket && order.Status == models.OrderStatusOpen && bw.queuesForOpen(order.Ticker, group.CreatedAt) {
+			group.QueueForOpen(order, queuedForOpenReason, group.CreatedAt)
+		}
+	}
+}
+
+// openQueuedOrders activates the orders of a ticker queued for the open once a price was fetched during a session
+// after they were queued, which is the first price of the session they wait for, so the fills that follow use the
+// opening price. Queued limit orders the opening price does not satisfy are rejected, like a transaction whose limit
+// price is breached. The caller must hold the lock of the order book.
+func (bw *BotWorker) openQueuedOrders(ticker string, now time.Time, changed map[string]*models.OrderGroup) {
+	price, ok := bw.latestPrices[ticker]
+	if !ok || price <= 0 || bw.pricesErr != nil || bw.halts.active(ticker, now) != nil {
+		return
+	}
+
+	// Prices fetched while the market was closed are the last prices of the previous session
+	priced := bw.priceTime(ticker)
+	if bw.marketClosed(ticker, priced) || bw.marketClosed(ticker, now) {
+		return
+	}
+
+	for _, entry := range bw.orders.Queued(ticker) {
+		order := entry.Order
+		if priced.Before(order.UpdatedAt) {
+			continue
+		}
+
+		switch {
+		case order.Type == models.OrderTypeLimit && order.Action == "buy" && price > order.LimitPrice:
+			entry.Group.Reject(order, fmt.Sprintf("opening price %g is above the limit price %g", price, order.LimitPrice), now)
+		case order.Type == models.OrderTypeLimit && order.Action == "sell" && price < order.LimitPrice:
+			entry.Group.Reject(order, fmt.Sprintf("opening price %g is below the limit price %g", price, order.LimitPrice), now)
+		default:
+			// The fill that follows stores the opened group, if the server restarts first the order opens again
+			entry.Group.Open(order, fmt.Sprintf("market opened at %g", price), now)
+			bw.orders.Reindex(entry.Group)
+			changed[entry.Group.ID] = entry.Group
+			continue
+		}
+
+		// A lost rejection only means the order is evaluated again after a restart
+		if err := bw.saveOrderGroup(entry.Group); err != nil {
+			log.Printf("error saving order group %s: %v\n", entry.Group.ID, err)
+		}
+
+		bw.orders.Reindex(entry.Group)
+		changed[entry.Group.ID] = entry.Group
+	}
+}
@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Audit entries returned by GetAuditLog unless a limit is requested
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// audit records an administrative action in the audit trail. Failures are logged, the action is not undone.
+func (bw *BotWorker) audit(c *gin.Context, action, detail string, data any) {
+	entry := &models.AuditEntry{
+		Time:     time.Now(),
+		Action:   action,
+		Detail:   detail,
+		Data:     data,
+		ClientIP: c.ClientIP(),
+	}
+
+	log.Printf("audit: %s: %s\n", action, detail)
+	_, _, err := bw.db.Collection(bw.collections.AuditLog).Add(context.Background(), entry)
+	if err != nil {
+		log.Printf("error recording audit entry %s: %v\n", action, err)
+	}
+}
+
+// GetAuditLog returns the most recent administrative actions.
+// @Summary Get the audit trail
+// @Description Lists the most recent administrative actions, newest first. When more entries follow, the X-Next-Cursor header carries the cursor of the next page
+// @Tags admin
+// @Produce json
+// @Param limit query int false "Number of entries, 50 by default and at most 500"
+// @Param cursor query string false "Cursor of the page to return, from the X-Next-Cursor header of the previous page"
+// @Param action query string false "Only return entries of this action"
+// @Success 200 {object} DataPacket "Audit entries"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, missing on the last page"
+// @Failure 400 {object} ResultData "Invalid limit or cursor"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/audit [get]
+func (bw *BotWorker) GetAuditLog(c *gin.Context) {
+	page, ok := parsePageRequest(c, defaultAuditLimit, maxAuditLimit)
+	if !ok {
+		return
+	}
+
+	query := bw.db.Collection(bw.collections.AuditLog).Query
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action", "==", action)
+	}
+
+	docs, err := page.query(query, "time", firestore.Desc).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error retrieving audit trail", false))
+		return
+	}
+
+	docs = page.page(c, docs, "time")
+	entries := make([]*models.AuditEntry, 0, len(docs))
+	for _, doc := range docs {
+		entry := &models.AuditEntry{}
+		if doc.DataTo(entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	c.JSON(200, &DataPacket{"audit", entries})
+}
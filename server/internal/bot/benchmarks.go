@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// BenchmarkPerformance is the performance of a benchmark since the inception of a portfolio
+type BenchmarkPerformance struct {
+	*models.Benchmark
+	Price        float64 `json:"price"`        // Live price, 0 without one
+	Return       float64 `json:"return"`       // Return of the benchmark since the portfolio's inception
+	ExcessReturn float64 `json:"excessReturn"` // Return of the portfolio minus the return of the benchmark
+}
+
+// benchmark returns the benchmark with the given ticker, false if the ticker is not a benchmark
+func (bw *BotWorker) benchmark(ticker string) (*models.Benchmark, bool) {
+	for _, benchmark := range bw.benchmarks {
+		if benchmark.Ticker == ticker {
+			return benchmark, true
+		}
+	}
+
+	return nil, false
+}
+
+// watchBenchmarks adds every benchmark to the watchlist
+func (bw *BotWorker) watchBenchmarks() {
+	for _, benchmark := range bw.benchmarks {
+		bw.watchlist.AddTickers(benchmark.Ticker)
+	}
+}
+
+// benchmarkValues returns the daily values of investing a portfolio's inception value in a benchmark at its
+// inception, with the value at the live price for today. Returns nil if the benchmark has no history since then.
+func (bw *BotWorker) benchmarkValues(benchmark *models.Benchmark, portfolio *models.Portfolio, now time.Time) []*models.AccountValueHistory {
+	inceptionDate, inceptionValue := portfolio.Inception()
+	values := bw.watchlist.Daily().BenchmarkValues(benchmark.Ticker, inceptionDate, inceptionValue)
+	if len(values) == 0 {
+		return nil
+	}
+
+	// The history holds adjusted closes, so today's value scales the last one by the move of the live price.
+	// Once today's close is in the history it is used instead.
+	if price, ok := bw.latestPrices[benchmark.Ticker]; ok {
+		if lastClose, date := previousClose(bw.watchlist.Daily(), benchmark.Ticker, now); lastClose > 0 && date.Equal(values[len(values)-1].Date) {
+			values = append(values, &models.AccountValueHistory{Date: now, Value: values[len(values)-1].Value * price / lastClose})
+		}
+	}
+
+	return values
+}
+
+// tradeableRule rejects buys of benchmarks that are not tradeable. Sells are allowed, so shares bought
+// before the benchmark was configured can still be sold.
+func (bw *BotWorker) tradeableRule(transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "tradeable", Passed: true}
+	if benchmark, ok := bw.benchmark(transaction.Ticker); ok && !benchmark.Tradeable && transaction.Action == "buy" {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot buy %s, it is a benchmark %s that is not tradeable", transaction.Ticker, benchmark.Kind)
+	}
+
+	return evaluation
+}
+
+// GetBenchmarks returns the benchmarks and their performance since the inception of the authenticated portfolio.
+// @Summary Get benchmarks
+// @Description Lists the indices and ETFs portfolios are measured against, with their live price, whether they can be traded and their return since the inception of the authenticated portfolio compared with the portfolio's return
+// @Tags portfolio
+// @Produce json
+// @Success 200 {object} DataPacket "Benchmarks"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /benchmarks [get]
+func (bw *BotWorker) GetBenchmarks(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	portfolioReturn, _ := portfolio.Returns(portfolio.AccountValue, now)
+
+	performances := make([]*BenchmarkPerformance, 0, len(bw.benchmarks))
+	for _, benchmark := range bw.benchmarks {
+		performance := &BenchmarkPerformance{Benchmark: benchmark, Price: bw.latestPrices[benchmark.Ticker]}
+		if values := bw.benchmarkValues(benchmark, portfolio, now); len(values) > 0 {
+			performance.Return = values[len(values)-1].Value/values[0].Value - 1
+			performance.ExcessReturn = portfolioReturn - performance.Return
+		}
+
+		performances = append(performances, performance)
+	}
+
+	c.JSON(200, &DataPacket{"benchmarks", performances})
+}
@@ -6,14 +6,28 @@ package bot
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/gin-gonic/gin"
+	"github.com/olahol/melody"
+	"github.com/ugorji/go/codec"
+	"urjith.dev/algobattle/pkg/hooks"
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/migrations"
 	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+	"urjith.dev/algobattle/pkg/scheduler"
 	"urjith.dev/algobattle/pkg/services"
+	"urjith.dev/algobattle/pkg/symbols"
 )
 
 // DataPacket represents a data packet sent over WebSocket
@@ -32,6 +46,20 @@ func (dp *DataPacket) JSON() []byte {
 	return b
 }
 
+// msgpackHandle encodes MessagePack with the json field names, and times as the MessagePack timestamp extension
+var msgpackHandle = &codec.MsgpackHandle{WriteExt: true}
+
+// MsgPack converts the DataPacket to MessagePack, with the same field names as its JSON
+func (dp *DataPacket) MsgPack() []byte {
+	var b []byte
+	err := codec.NewEncoderBytes(&b, msgpackHandle).Encode(dp)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
 // ResultData represents a result message
 type ResultData struct {
 	Message string `json:"payload"`
@@ -53,138 +81,579 @@ type AuthData struct {
 
 // TransactionRequestData represents a transaction request
 type TransactionRequestData struct {
-	Action    string  `json:"action"`
-	NumShares float64 `json:"numShares"`
-	Ticker    string  `json:"ticker"`
+	Action         string  `json:"action" binding:"required,oneof=buy sell"`
+	NumShares      float64 `json:"numShares" binding:"required,gt=0"`
+	Ticker         string  `json:"ticker" binding:"required,ticker"`
+	LimitPrice     float64 `json:"limitPrice" binding:"gte=0"`                                  // Optional worst acceptable fill price
+	ReferencePrice float64 `json:"referencePrice" binding:"gte=0,required_with=MaxSlippageBps"` // Optional price the decision was based on, required with maxSlippageBps
+	MaxSlippageBps float64 `json:"maxSlippageBps" binding:"gte=0"`                              // Optional largest acceptable adverse move from referencePrice in basis points
+	Tag            string  `json:"tag" binding:"max=64"`                                        // Optional strategy tag used for performance attribution
+}
+
+// StalePricesKey is the context key that makes price endpoints serve the previous prices
+const StalePricesKey = "stale_prices"
+
+// TransactionConfirmation describes an executed transaction and the resulting state of the portfolio
+type TransactionConfirmation struct {
+	ID            string          `json:"id"`            // ID of the transaction document
+	DecisionID    string          `json:"decisionId"`    // ID of the recorded order decision
+	Time          time.Time       `json:"time"`          // When the transaction was executed
+	Action        string          `json:"action"`        // "buy" or "sell"
+	Ticker        string          `json:"ticker"`        // Stock ticker symbol
+	NumShares     float64         `json:"numShares"`     // Number of shares bought or sold
+	Session       string          `json:"session"`       // Trading session the transaction was executed in
+	FillPrice     float64         `json:"fillPrice"`     // Price per share, after session slippage
+	PriceSource   string          `json:"priceSource"`   // Data source that provided the price
+	Fees          float64         `json:"fees"`          // Fees charged for the transaction
+	Total         float64         `json:"total"`         // Cash paid for a buy or received for a sell, after fees
+	Currency      string          `json:"currency"`      // Currency of the fill price, fees, total and cash
+	CompetitionID string          `json:"competitionId"` // ID of the competition the bot belongs to, empty outside a competition
+	CashAfter     float64         `json:"cashAfter"`     // Cash balance after the transaction
+	Position      *models.Holding `json:"position"`      // Holding of the ticker after the transaction
+}
+
+// newTransactionConfirmation creates the confirmation of a transaction executed on a portfolio
+func newTransactionConfirmation(portfolio *models.Portfolio, transaction *models.Transaction, transactionRef *firestore.DocumentRef) *TransactionConfirmation {
+	confirmation := &TransactionConfirmation{
+		ID:        transactionRef.ID,
+		Time:      transaction.Time,
+		Action:    transaction.Action,
+		Ticker:    transaction.Ticker,
+		NumShares: transaction.NumShares,
+		Session:   transaction.Session,
+		FillPrice: transaction.UnitCost,
+		Fees:      transaction.Fee,
+		Total:     transaction.Value(),
+		Currency:  transaction.CurrencyOfRecord(),
+		CashAfter: portfolio.Cash,
+		Position:  &models.Holding{},
+	}
+
+	// Buyers pay the fee on top of the traded value and sellers receive the traded value less the fee
+	if transaction.Action == "sell" {
+		confirmation.Total = money.Default().Sub(confirmation.Total, transaction.Fee)
+	} else {
+		confirmation.Total = money.Default().Add(confirmation.Total, transaction.Fee)
+	}
+
+	if transaction.Decision != nil {
+		confirmation.DecisionID = transaction.Decision.ID
+	}
+
+	if portfolio.Competition != nil {
+		confirmation.CompetitionID = portfolio.Competition.ID
+	}
+
+	confirmation.Position = portfolio.Position(transaction.Ticker)
+
+	return confirmation
 }
 
+// Default cron schedules for the background jobs, evaluated in UTC.
+// They can be overridden with the environment variables of the same name.
+const (
+	defaultPriceUpdateCron   = "*/5 14-21 * * *"  // Every 5 minutes during trading hours
+	extendedPriceUpdateCron  = "*/5 0,8-23 * * *" // Every 5 minutes during the pre-market, regular and after-hours sessions
+	defaultDailyDownloadCron = "0 0 * * *"        // Once a day at midnight
+	defaultValuationCron     = "30 21 * * *"      // Once a day after the market closes
+	defaultSettlementCron    = "5 21 * * *"       // Once a day at the end of the trading day
+	defaultMigrationCron     = "0 3 * * *"        // Once a day outside trading hours
+	defaultEarningsCron      = "0 6 * * *"        // Once a day before the market opens
+	defaultListingCron       = "0 5 * * *"        // Once a day before any market opens
+	defaultIntegrityCron     = "45 * * * *"       // Once an hour
+	defaultEventDeliveryCron = "* * * * *"        // Every minute, retrying events that failed to publish
+	defaultAlertDeliveryCron = "* * * * *"        // Every minute, retrying price alerts whose webhook failed
+	defaultCollusionCron     = "15 22 * * *"      // Once a day after the market closes
+	defaultWeeklySummaryCron = "0 22 * * 5"       // Once a week after the market closes on Friday
+	defaultUniverseCron      = "0 4 1 1,4,7,10 *" // Once a quarter, before index changes take effect
+	defaultDigestCron        = "0 7 * * *"        // Once a day, summarizing the previous day
+	defaultArchiveCron       = "30 3 * * *"       // Once a day outside trading hours
+	defaultReconcileCron     = "0 2 * * *"        // Once a night, after the day's valuations
+	defaultJobJitter         = 10 * time.Second   // Maximum random delay added to each run
+)
+
 // BotWorker manages bots and their portfolios
 type BotWorker struct {
-	db           *firestore.Client
-	tiingo       *services.Tiingo
+	db           *firestore.Client // Used directly by everything but the store's trade, auth and valuation paths
+	tiingo       *services.Tiingo  // Used directly for the history cache, indicators and ticker metadata
+	watchlist    Watchlist         // Watched tickers and their daily history, backed by tiingo
+	prices       PriceSource
+	store        PortfolioStore
+	earnings     *services.EarningsCalendar
+	fx           *services.FXRates
+	pubsub       *services.PubSub // Topic events are published to, nil if events are disabled
+	mailer       services.Mailer  // Sends email notifications, nil if emails are disabled
+	digests      *digestDelivery
+	archive      *services.ColdStorage // Stores archives of finished competitions, nil if archival is disabled
+	markets      *market.Registry
+	listings     *listingCache
+	sectors      models.SectorMap
+	benchmarks   []*models.Benchmark
+	scheduler    *scheduler.Scheduler
+	usage        *usageTracker
+	migrator     *migrations.Migrator
+	orders       OrderBook
+	protections  *protectionBook
+	alerts       *alertBook
+	universes    *universeTracker
+	stream       *melody.Melody
+	public       *publicFeed
+	windows      *windowCache
+	leaderboards *leaderboardCache
+	tickers      *tickerTracker
+	datasets     *datasetTracker
+	indicators   *indicatorTracker
+	halts        *haltTracker
+	overrides    *overrideTracker
+	valuations   *valuationTracker
+	trades       *tradeLocks
+	pipeline     *transactionQueue
+	collusion    *collusionTracker
+	reconciler   *reconciliationTracker
+	tradeHooks   []*hooks.Hook // Custom competition rules, run in order before the built-in rules
+	collections  Collections
+	integrity    *integrityTracker
+	anomalies    *anomalyTracker
+	events       *eventTracker // Nil if events are disabled
+	warmup       *warmupTracker
 	latestPrices map[string]float64
+	stalePrices  map[string]float64   // Prices before the last update, served when faults are injected
+	priceTimes   map[string]time.Time // When each latest price was fetched, older than pricesTime for prices kept under quota pressure
+	pricesTime   time.Time
+	priceSource  string // Data source that provided the latest prices
+	pricesErr    error  // Error of the last failed price update, nil if the prices are current
+
+	participation           float64  // Percent of a ticker's average daily volume that can trade per price update, 0 if unlimited
+	turnoverCap             float64  // Multiple of its equity a portfolio can trade per UTC day, 0 if unlimited
+	archiveAfterDays        int      // Days after a competition ends before it is archived
+	marginCallPercent       float64  // Percent of the inception value below which bots receive margin calls, 0 if disabled
+	marketHoursEnforced     bool     // Whether trades outside every enabled session are rejected
+	openingAuction          bool     // Whether trades requested while the market is closed fill at the next session's opening price
+	earningsBlackoutEnabled bool     // Whether bots' earnings blackout windows are enforced
+	blockedWords            []string // Words that flag a bot profile for review
 }
 
-// NewBotWorker creates a new BotWorker
-func NewBotWorker(db *firestore.Client, tiingo *services.Tiingo) *BotWorker {
+// NewBotWorker creates a new BotWorker and registers its background jobs with the scheduler.
+// The scheduler is started by NewBotWorker, and the server warms up in the background until it is ready. Transaction and valuation events are only published if pubsub is not nil, and email notifications are only sent if mailer is not nil.
+// Live prices, portfolio storage and the order book are injected, so authentication, trades, order fills and
+// valuations can run against in-memory fakes. Everything else uses db and tiingo directly.
+func NewBotWorker(
+	db *firestore.Client,
+	tiingo *services.Tiingo,
+	prices PriceSource,
+	store PortfolioStore,
+	orders OrderBook,
+	earnings *services.EarningsCalendar,
+	fx *services.FXRates,
+	pubsub *services.PubSub,
+	mailer services.Mailer,
+	archive *services.ColdStorage,
+	collections Collections,
+	markets *market.Registry,
+	sched *scheduler.Scheduler,
+) (*BotWorker, error) {
+	halts, err := newHaltTracker()
+	if err != nil {
+		return nil, err
+	}
+
+	integrity, err := newIntegrityTracker()
+	if err != nil {
+		return nil, err
+	}
+
+	anomalies, err := newAnomalyTracker()
+	if err != nil {
+		return nil, err
+	}
+
+	collusion, err := newCollusionTracker()
+	if err != nil {
+		return nil, err
+	}
+
+	reconciler, err := newReconciliationTracker()
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline, err := newTransactionQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	participation, err := parseParticipation()
+	if err != nil {
+		return nil, err
+	}
+
+	turnoverCap, err := parseTurnoverCap()
+	if err != nil {
+		return nil, err
+	}
+
+	marginCallPercent, err := parseMarginCallPercent()
+	if err != nil {
+		return nil, err
+	}
+
+	digests, err := parseDigestDelivery()
+	if err != nil {
+		return nil, err
+	}
+
+	archiveAfterDays, err := parseArchiveAfter()
+	if err != nil {
+		return nil, err
+	}
+
+	tradeHooks, err := parseTradeHooks()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sectors of tickers are only used for analytics, tickers missing from the map are reported as unknown
+	sectors := models.SectorMap{}
+	if path := os.Getenv("SECTORS_FILE"); path != "" {
+		sectors, err = models.LoadSectorMap(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading SECTORS_FILE: %v", err)
+		}
+	}
+
+	// Benchmarks are watched like any other ticker but are not tradeable unless configured so
+	benchmarks := make([]*models.Benchmark, 0)
+	if path := os.Getenv("BENCHMARKS_FILE"); path != "" {
+		benchmarks, err = models.LoadBenchmarks(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading BENCHMARKS_FILE: %v", err)
+		}
+	}
+
 	bw := &BotWorker{
 		db:           db,
 		tiingo:       tiingo,
+		watchlist:    tiingo,
+		prices:       prices,
+		store:        store,
+		earnings:     earnings,
+		fx:           fx,
+		pubsub:       pubsub,
+		mailer:       mailer,
+		digests:      digests,
+		archive:      archive,
+		markets:      markets,
+		listings:     newListingCache(),
+		sectors:      sectors,
+		benchmarks:   benchmarks,
+		scheduler:    sched,
+		usage:        newUsageTracker(),
+		migrator:     migrations.NewMigrator(db),
+		orders:       orders,
+		protections:  newProtectionBook(),
+		alerts:       newAlertBook(),
+		universes:    newUniverseTracker(),
+		stream:       newStream(),
+		public:       newPublicFeed(),
+		windows:      newWindowCache(),
+		leaderboards: newLeaderboardCache(),
+		tickers:      newTickerTracker(),
+		datasets:     newDatasetTracker(),
+		indicators:   newIndicatorTracker(),
+		halts:        halts,
+		overrides:    newOverrideTracker(),
+		valuations:   newValuationTracker(),
+		trades:       newTradeLocks(),
+		pipeline:     pipeline,
+		collusion:    collusion,
+		reconciler:   reconciler,
+		tradeHooks:   tradeHooks,
+		collections:  collections,
+		integrity:    integrity,
+		anomalies:    anomalies,
+		warmup:       newWarmupTracker(),
 		latestPrices: make(map[string]float64),
+		stalePrices:  make(map[string]float64),
+		priceTimes:   make(map[string]time.Time),
+
+		participation:           participation,
+		turnoverCap:             turnoverCap,
+		archiveAfterDays:        archiveAfterDays,
+		marginCallPercent:       marginCallPercent,
+		marketHoursEnforced:     os.Getenv("MARKET_HOURS_RULE") == "true",
+		openingAuction:          os.Getenv("OPENING_AUCTION") == "true",
+		earningsBlackoutEnabled: os.Getenv("EARNINGS_BLACKOUT_RULE") == "true",
+		blockedWords:            strings.Split(os.Getenv("PROFILE_BLOCKED_WORDS"), ","),
+	}
+
+	if pubsub != nil {
+		bw.events = newEventTracker(pubsub.Topic)
 	}
 
-	accountValuer := make(chan bool)
-	bw.startPriceUpdater(accountValuer)
-	bw.startDailyDownloader()
-	bw.startAccountValueCalculator(accountValuer)
+	// Downloaded bars are checked like live prices, so admins see every quarantined price in one place
+	tiingo.MaxPriceJump = anomalies.maxJump
+	tiingo.OnAnomaly = anomalies.record
+	tiingo.OnProgress = bw.tickers.setBars
 
-	return bw
+	// The cache is loaded before anything can download into it
+	bw.loadCache()
+	bw.watchBenchmarks()
+
+	err = bw.registerMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.migrateRestored()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.loadOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.loadProtections()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.loadAlerts()
+	if err != nil {
+		return nil, err
+	}
+
+	// Universes are loaded before trades so buys in restricted competitions are not rejected after a restart
+	err = bw.refreshUniverses()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.resumeOnboarding()
+	if err != nil {
+		return nil, err
+	}
+
+	err = bw.registerJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	sched.Start()
+	bw.pipeline.start(bw.executeQueued)
+
+	// Trades are rejected until the watchlist is covered and the live prices were fetched
+	go bw.warmUp()
+
+	return bw, nil
 }
 
-// startPriceUpdater starts a goroutine that updates prices every 5 minutes during trading hours
-func (bw *BotWorker) startPriceUpdater(accountValuer chan bool) {
-	liveDownloader := time.NewTicker(time.Minute * 5)
-	go func() {
-		for ; true; <-liveDownloader.C {
-			if time.Now().In(time.UTC).Hour() < 14 || time.Now().In(time.UTC).Hour() > 21 {
-				log.Println("skipping data download because it is not in the trading hours")
-				continue
-			}
+// registerJobs registers the background jobs of the bot worker
+func (bw *BotWorker) registerJobs() error {
+	jitter := defaultJobJitter
+	if env := os.Getenv("JOB_JITTER"); env != "" {
+		parsed, err := time.ParseDuration(env)
+		if err != nil {
+			return fmt.Errorf("invalid JOB_JITTER: %v", err)
+		}
+
+		jitter = parsed
+	}
+
+	// Prices are also needed during the extended sessions when they are enabled
+	priceUpdateCron := defaultPriceUpdateCron
+	if bw.markets.HasSession(market.SessionPreMarket) || bw.markets.HasSession(market.SessionAfterHours) {
+		priceUpdateCron = extendedPriceUpdateCron
+	}
 
-			bw.updateCurrPrices()
-			accountValuer <- true
+	jobs := []struct {
+		name       string
+		cron       string
+		runOnStart bool
+		fn         scheduler.JobFunc
+	}{
+		{"price_update", getEnvDefault("PRICE_UPDATE_CRON", priceUpdateCron), false, bw.updatePricesAndValues},
+		{"daily_download", getEnvDefault("DAILY_DOWNLOAD_CRON", defaultDailyDownloadCron), true, bw.downloadDailyHistory},
+		{"account_valuation", getEnvDefault("VALUATION_CRON", defaultValuationCron), true, bw.calculateAccountValues},
+		{"settlement", getEnvDefault("SETTLEMENT_CRON", defaultSettlementCron), false, bw.settle},
+		{"migrations", getEnvDefault("MIGRATION_CRON", defaultMigrationCron), true, bw.migrateAll},
+		{"earnings_refresh", getEnvDefault("EARNINGS_CRON", defaultEarningsCron), true, bw.refreshEarnings},
+		{"listing_refresh", getEnvDefault("LISTING_CRON", defaultListingCron), true, bw.refreshListings},
+		{"cache_integrity", getEnvDefault("INTEGRITY_CHECK_CRON", defaultIntegrityCron), false, bw.checkCacheIntegrity},
+		{"event_delivery", getEnvDefault("EVENT_DELIVERY_CRON", defaultEventDeliveryCron), true, bw.deliverEvents},
+		{"alert_delivery", getEnvDefault("ALERT_DELIVERY_CRON", defaultAlertDeliveryCron), true, bw.deliverAlerts},
+		{"collusion_scan", getEnvDefault("COLLUSION_CRON", defaultCollusionCron), true, bw.scanCollusion},
+		{"weekly_summary", getEnvDefault("WEEKLY_SUMMARY_CRON", defaultWeeklySummaryCron), false, bw.sendWeeklySummaries},
+		{"universe_refresh", getEnvDefault("UNIVERSE_CRON", defaultUniverseCron), false, bw.refreshUniverses},
+		{"competition_digest", getEnvDefault("DIGEST_CRON", defaultDigestCron), false, bw.sendDigests},
+		{"competition_archival", getEnvDefault("ARCHIVE_CRON", defaultArchiveCron), false, bw.archiveCompetitions},
+		{"portfolio_reconciliation", getEnvDefault("RECONCILE_CRON", defaultReconcileCron), false, bw.reconcilePortfolios},
+	}
+
+	for _, job := range jobs {
+		err := bw.scheduler.Add(job.name, job.cron, jitter, job.runOnStart, job.fn)
+		if err != nil {
+			return fmt.Errorf("error registering job %s: %v", job.name, err)
 		}
-	}()
+	}
+
+	return nil
 }
 
-// startDailyDownloader starts a goroutine that downloads ticker data daily
-func (bw *BotWorker) startDailyDownloader() {
-	dailyDownloader := time.NewTicker(time.Hour * 24)
-	go func() {
-		for ; true; <-dailyDownloader.C {
-			err := bw.tiingo.DownloadAllTickers()
-			if err != nil {
-				log.Printf("error downloading daily stock data: %v\n", err)
-			}
-		}
-	}()
+// getEnvDefault returns the value of an environment variable, or def if it is unset
+func getEnvDefault(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return def
 }
 
-// startAccountValueCalculator starts a goroutine that calculates account values
-func (bw *BotWorker) startAccountValueCalculator(accountValuer chan bool) {
+// updatePricesAndValues updates the live prices, checks the circuit breakers, fills triggered orders
+// and then recalculates all account values.
+// Orders are not filled and accounts are not revalued when the prices could not be updated.
+func (bw *BotWorker) updatePricesAndValues() error {
+	err := bw.updateCurrPrices()
+	if err != nil {
+		return fmt.Errorf("error updating prices: %w", err)
+	}
+
+	bw.checkCircuitBreakers()
+	bw.evaluateOrders()
+	bw.evaluateProtections()
+	bw.evaluateAlerts()
+	return bw.calculateAccountValues()
+}
+
+// downloadDailyHistory downloads the history of watched tickers whose cached history ends before the last
+// closed trading day of their exchange, so runs on weekends and holidays use none of the request quota
+func (bw *BotWorker) downloadDailyHistory() error {
+	now := time.Now()
+	return bw.tiingo.DownloadStaleTickers(func(ticker string) time.Time {
+		return bw.exchangeFor(ticker).LastClosedDay(now)
+	})
+}
+
+// calculateAccountValues makes sure every held ticker is watched and recalculates all account values
+func (bw *BotWorker) calculateAccountValues() error {
 	// TODO: Change this to a webhook
-	go func() {
-		for ; true; <-accountValuer {
-			docs, err := bw.db.Collection("bots").Documents(context.Background()).GetAll()
-			if err != nil {
-				log.Printf("error retrieving bots: %v\n", err)
-				continue
-			}
+	stored, err := bw.store.Portfolios(context.Background())
+	if err != nil {
+		return fmt.Errorf("error retrieving portfolios: %v", err)
+	}
 
-			for _, doc := range docs {
-				portfolio := &models.Portfolio{}
-				doc.DataTo(portfolio)
+	portfolios := make([]*models.Portfolio, 0, len(stored))
+	missing := make(map[string]bool)
+	for _, entry := range stored {
+		portfolios = append(portfolios, entry.Portfolio)
 
-				for ticker, _ := range portfolio.Holdings {
-					bw.tiingo.AddTickers(ticker)
-				}
+		for ticker := range entry.Portfolio.Holdings {
+			bw.watchlist.AddTickers(ticker)
+			if _, ok := bw.latestPrices[ticker]; !ok {
+				missing[ticker] = true
 			}
+		}
+	}
 
-			err = bw.addTickers()
-			if err != nil {
-				log.Printf("error downloading ticker data: %v\n", err)
-			}
+	bw.updateTickerPriorities(portfolios)
 
-			for _, doc := range docs {
-				go bw.calculateAccountValue(doc)
-			}
+	// Held tickers without prices are fetched in the background, the portfolios holding them are valued
+	// with a fallback price and flagged until the next valuation after the fetch
+	pending := make([]string, 0, len(missing))
+	for ticker := range missing {
+		pending = append(pending, ticker)
+	}
+
+	bw.fetchPendingTickers(pending)
+
+	valued := make([]*models.Portfolio, len(stored))
+	wg := sync.WaitGroup{}
+	for i, entry := range stored {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			valued[i] = bw.calculateAccountValue(entry)
+		}()
+	}
+
+	wg.Wait()
+	bw.publishStandings(stored, valued)
+
+	partial := 0
+	for _, portfolio := range valued {
+		if portfolio != nil && len(portfolio.PendingTickers) > 0 {
+			partial++
 		}
-	}()
+	}
+
+	bw.valuations.record(missing, len(stored), partial, time.Now())
+
+	return nil
 }
 
-// calculateAccountValue calculates the account value for a portfolio
-func (bw *BotWorker) calculateAccountValue(doc *firestore.DocumentSnapshot) {
-	portfolio := &models.Portfolio{}
-	doc.DataTo(portfolio)
-	log.Printf("calculating portfolio: %v\n", doc.Ref.ID)
+// calculateAccountValue calculates the account value for a portfolio.
+// Holdings without a live price are valued at a fallback price and listed in the portfolio's pending tickers.
+func (bw *BotWorker) calculateAccountValue(stored *StoredPortfolio) *models.Portfolio {
+	portfolio, ref := stored.Portfolio, stored.Ref
+	log.Printf("calculating portfolio: %v\n", ref.ID)
 
 	oldAccountValue := portfolio.AccountValue
+	oldPending := portfolio.PendingTickers
 
 	// Calculate the portfolio value
-	if !bw.calculatePortfolioValue(portfolio, doc.Ref.ID) {
-		return
+	portfolio.PendingTickers = bw.calculatePortfolioValue(portfolio, ref.ID)
+
+	// A fallback price can understate the account value, so margin calls wait for the live prices
+	if len(portfolio.PendingTickers) == 0 {
+		bw.checkMarginCall(ref, portfolio)
 	}
 
 	// Update historical values
 	historyChanged := bw.updateHistoricalValue(portfolio)
 
 	// Save updates if needed
-	if !historyChanged && oldAccountValue == portfolio.AccountValue {
-		log.Printf("no change in account value for portfolio: %v\n", doc.Ref.ID)
-		return
+	if !historyChanged && oldAccountValue == portfolio.AccountValue && slices.Equal(oldPending, portfolio.PendingTickers) {
+		log.Printf("no change in account value for portfolio: %v\n", ref.ID)
+		return portfolio
+	}
+
+	bw.savePortfolioUpdates(portfolio, ref)
+	if oldAccountValue != portfolio.AccountValue {
+		bw.enqueueValuationEvent(ref, portfolio, oldAccountValue)
 	}
 
-	bw.savePortfolioUpdates(portfolio, doc)
+	return portfolio
 }
 
-// calculatePortfolioValue calculates the current value of a portfolio based on holdings
-// Returns false if any ticker data is missing
-func (bw *BotWorker) calculatePortfolioValue(portfolio *models.Portfolio, portfolioID string) bool {
-	portfolio.AccountValue = portfolio.Cash
-	hasAllData := true
+// calculatePortfolioValue calculates the current value of a portfolio based on holdings.
+// Holdings without a live price are valued at their last close, or at their purchase price if the
+// ticker has no history yet. Returns the tickers valued at a fallback price, sorted.
+func (bw *BotWorker) calculatePortfolioValue(portfolio *models.Portfolio, portfolioID string) []string {
+	policy := money.Default()
+	values := []float64{portfolio.Cash}
+	pending := make([]string, 0)
+	today := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
 
 	for ticker, holding := range portfolio.Holdings {
 		price, ok := bw.latestPrices[ticker]
 		if !ok {
-			log.Printf("failed to find ticker data for \"%s\" while calculating portfolio: %v\nadding %s to watchlist...\n", ticker, portfolioID, ticker)
-			bw.tiingo.AddTickers(ticker)
-			hasAllData = false
+			price, _ = previousClose(bw.watchlist.Daily(), ticker, today)
+			if price == 0 {
+				price = holding.PurchaseValue
+			}
+
+			log.Printf("no live price for \"%s\" while calculating portfolio %v, valued at fallback price %g until it is fetched\n", ticker, portfolioID, price)
+			pending = append(pending, ticker)
 		}
 
-		portfolio.AccountValue += holding.NumShares * price
+		values = append(values, policy.Cost(holding.NumShares, price))
 	}
 
-	return hasAllData
+	portfolio.AccountValue = policy.Sum(values...)
+	sort.Strings(pending)
+
+	return pending
 }
 
 // updateHistoricalValue updates the historical account value records
@@ -215,12 +684,9 @@ func (bw *BotWorker) updateHistoricalValue(portfolio *models.Portfolio) bool {
 }
 
 // savePortfolioUpdates saves the updated portfolio values to the database
-func (bw *BotWorker) savePortfolioUpdates(portfolio *models.Portfolio, doc *firestore.DocumentSnapshot) {
-	log.Printf("updated portfolio: %v\nlatest account value: %v\n", doc.Ref.ID, portfolio.AccountValue)
-	_, err := doc.Ref.Update(context.Background(), []firestore.Update{
-		{Path: "accountValue", Value: portfolio.AccountValue},
-		{Path: "historicalAccountValue", Value: portfolio.HistoricalAccountValue},
-	})
+func (bw *BotWorker) savePortfolioUpdates(portfolio *models.Portfolio, ref *firestore.DocumentRef) {
+	log.Printf("updated portfolio: %v\nlatest account value: %v\n", ref.ID, portfolio.AccountValue)
+	err := bw.store.SaveValuation(context.Background(), ref, portfolio)
 	if err != nil {
 		log.Println(err)
 	}
@@ -230,69 +696,53 @@ func (bw *BotWorker) savePortfolioUpdates(portfolio *models.Portfolio, doc *fire
 // It loads the user's portfolio and sets it in the context for downstream handlers.
 // This middleware should be applied to all routes that require authentication.
 func (bw *BotWorker) AuthHandler(c *gin.Context) {
+	// Trades measure their latency from here, before any database lookup
+	c.Set("received", time.Now())
+
 	// Get API key from Authorization header
 	apikey := c.GetHeader("Authorization")
 
 	// Find the bot with the matching API key
-	bot, err := bw.db.Collection("bots").Where("apiKey", "==", apikey).Documents(context.Background()).Next()
-	if err != nil || bot == nil {
+	ref, portfolio, err := bw.store.FindBot(context.Background(), apikey)
+	if err != nil {
 		c.AbortWithStatusJSON(401, NewResultPacket("error finding bot with specified api key", false))
 		return
 	}
 
-	// Load the portfolio data
-	portfolio := &models.Portfolio{}
-	bot.DataTo(portfolio)
-
-	// Set the database reference and portfolio in the context
-	c.Set("db_ref", bot.Ref)
-	c.Set("bot", portfolio)
-}
+	// Lazily upgrade bots that the batch migration has not reached yet
+	if portfolio.SchemaVersion < bw.migrator.Latest(bw.collections.Bots) {
+		_, err = bw.migrator.MigrateDocument(context.Background(), bw.collections.Bots, ref)
+		if err == nil {
+			portfolio, err = bw.store.LoadPortfolio(context.Background(), ref)
+		}
 
-// SavePortfolio saves the updated portfolio to the database.
-// This middleware should be applied after handlers that modify the portfolio.
-// @Summary Save portfolio changes
-// @Description Saves any changes made to the portfolio during the request
-// @Tags portfolio
-// @Accept json
-// @Produce json
-// @Success 200 {object} ResultData "Portfolio saved"
-// @Failure 401 {object} ResultData "Not authenticated"
-// @Router /transact [post]
-func (bw *BotWorker) SavePortfolio(c *gin.Context) {
-	// Get the database reference from the context
-	refUntyped, ok := c.Get("db_ref")
-	if !ok {
-		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
-		return
+		if err != nil {
+			log.Printf("error migrating bot %s: %v\n", ref.ID, err)
+			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bot", false))
+			return
+		}
 	}
 
-	// Get the portfolio from the context
-	botUntyped, ok := c.Get("bot")
-	if !ok {
-		c.AbortWithStatusJSON(401, NewResultPacket("error: failed to save portfolio information", false))
-		return
-	}
+	// Set the database reference and portfolio in the context
+	c.Set("owner_ref", ref)
+	c.Set("db_ref", ref)
+	c.Set("bot", portfolio)
 
-	// Update the portfolio in the database
-	ref := refUntyped.(*firestore.DocumentRef)
-	ref.Update(context.Background(), []firestore.Update{
-		{Path: "cash", Value: botUntyped.(*models.Portfolio).Cash},
-		{Path: "holdings", Value: botUntyped.(*models.Portfolio).Holdings},
-		{Path: "transactions", Value: botUntyped.(*models.Portfolio).TransactionReferences},
-	})
+	// Requests may operate on a shadow portfolio of the bot instead
+	bw.loadShadowPortfolio(c, ref)
 }
 
 // AddTicker adds one or more tickers to the watchlist for monitoring.
+// The history of new tickers is downloaded in the background, and its progress can be polled with GetTickerStatus.
 // @Summary Add ticker to watchlist
-// @Description Adds one or more stock tickers to the watchlist for price monitoring and data collection
+// @Description Adds one or more stock tickers to the watchlist and starts downloading the history of uncached tickers in the background
 // @Tags stocks
 // @Accept json
 // @Produce json
 // @Param ticker query []string true "Ticker symbols to add (can specify multiple)"
-// @Success 200 {object} ResultData "Tickers added successfully"
+// @Success 200 {object} DataPacket "Every ticker is already available"
+// @Success 202 {object} DataPacket "Download job started"
 // @Failure 400 {object} ResultData "Invalid request"
-// @Failure 500 {object} ResultData "Server error"
 // @Router /add_ticker [get]
 func (bw *BotWorker) AddTicker(c *gin.Context) {
 	// Get ticker symbols from query parameters
@@ -302,53 +752,123 @@ func (bw *BotWorker) AddTicker(c *gin.Context) {
 		return
 	}
 
-	// Add tickers to the watchlist and download their data
-	err := bw.addTickers(tickers...)
-	if err != nil {
-		log.Printf("error while adding ticker: %v\n", err)
-		c.AbortWithStatusJSON(500, NewResultPacket("failed to add at least one ticker", false))
+	for i, ticker := range tickers {
+		normalized, err := symbols.Normalize(ticker)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+			return
+		}
+
+		tickers[i] = normalized
+	}
+
+	// Add tickers to the watchlist and download their data in the background
+	job := bw.startTickerJob(tickers...)
+	if job.JobID == "" {
+		c.JSON(200, &DataPacket{"ticker_job", job})
 		return
 	}
 
-	// Return success response
-	c.JSON(200, NewResultPacket(fmt.Sprintf("successfully added tickers: %v", tickers), true))
+	c.JSON(202, &DataPacket{"ticker_job", job})
 }
 
-// addTickers adds tickers to the watchlist
+// addTickers adds tickers to the watchlist and downloads their history
 func (bw *BotWorker) addTickers(tickers ...string) error {
-	bw.tiingo.AddTickers(tickers...)
+	bw.watchlist.AddTickers(tickers...)
 	bw.updateCurrPrices()
+
+	bw.tickers.downloadMu.Lock()
+	defer bw.tickers.downloadMu.Unlock()
+
 	return bw.tiingo.DownloadMissingTickers()
 }
 
 // GetDailyStockData returns historical daily stock data for all watched tickers.
+// Without a range only the rows held in memory are returned. Rows of a range that
+// are older than the history retention are loaded from the archive on demand.
+// Rows can be resampled into weekly or monthly series with the freq parameter.
+// The response is JSON, MessagePack or protobuf depending on the Accept header.
 // @Summary Get historical stock data
-// @Description Retrieves daily historical stock data for all tickers in the watchlist
+// @Description Retrieves daily, weekly or monthly historical stock data for all tickers in the watchlist, as JSON, MessagePack (Accept: application/msgpack) or protobuf (Accept: application/x-protobuf, see proto/stock_data.proto)
 // @Tags stocks
 // @Accept json
-// @Produce json
-// @Success 200 {object} DataPacket "Historical daily stock data"
+// @Produce json,application/msgpack,application/x-protobuf
+// @Param start query string false "First date of the range (YYYY-MM-DD)"
+// @Param end query string false "Last date of the range (YYYY-MM-DD)"
+// @Param freq query string false "Frequency of the rows: daily (default), weekly or monthly"
+// @Success 200 {object} DataPacket "Historical stock data"
+// @Failure 400 {object} ResultData "Invalid date range or frequency"
 // @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
 // @Router /daily_stock_data [get]
 func (bw *BotWorker) GetDailyStockData(c *gin.Context) {
-	// Pack and return the daily cache as JSON
-	c.JSON(200, &DataPacket{"daily_stock_data", bw.tiingo.DailyCache.Pack()})
+	frequency, err := models.ParseFrequency(c.Query("freq"))
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	startQuery, hasStart := c.GetQuery("start")
+	endQuery, hasEnd := c.GetQuery("end")
+	if !hasStart && !hasEnd && frequency == models.Daily {
+		// Pack and return the daily cache in the negotiated format
+		renderStockData(c, "daily_stock_data", bw.watchlist.Daily().Pack())
+		return
+	}
+
+	var start, end time.Time
+	if hasStart {
+		start, err = time.Parse(time.DateOnly, startQuery)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: start must be a date formatted as YYYY-MM-DD", false))
+			return
+		}
+	}
+
+	if hasEnd {
+		end, err = time.Parse(time.DateOnly, endQuery)
+		if err != nil || end.Before(start) {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: end must be a date formatted as YYYY-MM-DD on or after start", false))
+			return
+		}
+	}
+
+	rows := make([]*models.Row, 0)
+	if hasStart || hasEnd {
+		rows, err = bw.tiingo.ArchivedRows(start, end)
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error loading archived history: "+err.Error(), false))
+			return
+		}
+	}
+
+	history := &models.History{
+		Tickers: bw.watchlist.Daily().Tickers,
+		Rows:    models.Resample(append(rows, bw.watchlist.Daily().Range(start, end)...), frequency),
+	}
+
+	renderStockData(c, "daily_stock_data", history.Pack())
 }
 
 // MakeTransaction executes a buy or sell transaction for a stock.
 // @Summary Execute a stock transaction
-// @Description Processes a buy or sell transaction for a specified ticker and number of shares
+// @Description Processes a buy or sell transaction for a specified ticker and number of shares. With async, the transaction is queued and executed by a worker in the order the bot queued its transactions, and its status is polled or received on the WebSocket. When the opening auction is enabled, a transaction requested while the ticker's market is closed is queued as an order that fills at the next session's opening price
 // @Tags transactions
 // @Accept json
 // @Produce json
 // @Param transaction body TransactionRequestData true "Transaction details"
-// @Success 200 {object} ResultData "Transaction successful"
+// @Param async query bool false "Queue the transaction and return 202 with its ID instead of waiting for it"
+// @Success 200 {object} DataPacket "Transaction confirmation"
+// @Success 202 {object} DataPacket "Queued transaction, or order group queued for the open"
+// @Failure 400 {object} ValidationErrorData "Malformed or invalid request body"
 // @Failure 401 {object} ResultData "Not authenticated or insufficient funds/shares"
+// @Failure 409 {object} ResultData "Another transaction of the bot is still in progress"
 // @Failure 500 {object} ResultData "Server error"
+// @Failure 503 {object} ResultData "Price source unavailable or transaction queue full"
 // @Router /transact [post]
 func (bw *BotWorker) MakeTransaction(c *gin.Context) {
 	// Get the portfolio from context
-	portfolio, ref, ok := bw.getPortfolioFromContext(c)
+	_, ref, ok := bw.getPortfolioFromContext(c)
 	if !ok {
 		return
 	}
@@ -359,26 +879,97 @@ func (bw *BotWorker) MakeTransaction(c *gin.Context) {
 		return
 	}
 
-	// Get the current price for the ticker
-	cost, ok := bw.latestPrices[request.Ticker]
-	if !ok {
-		c.AbortWithStatusJSON(500, NewResultPacket("error: ticker data not available, make sure to subscribe and receive a ticker data update first", false))
+	if bw.queuesForOpen(request.Ticker, time.Now()) {
+		bw.queueForOpen(c, ref, request)
 		return
 	}
 
-	// Create and execute the transaction
-	transaction, ok := bw.createAndExecuteTransaction(c, portfolio, request, cost, ref)
-	if !ok {
+	if c.Query("async") == "true" {
+		bw.queueTransaction(c, ref, request)
 		return
 	}
 
-	// Save the transaction to the database
-	ok = bw.saveTransactionToDatabase(c, portfolio, transaction)
+	// Only one trade of a bot runs at a time, including the trades of its shadow portfolios and order fills
+	unlock, ok := bw.lockTrades(c, ref)
 	if !ok {
 		return
 	}
+	defer unlock()
+
+	portfolio, confirmation, err := bw.transact(ref, request, c.GetTime("received"))
+	if err != nil {
+		c.AbortWithStatusJSON(err.status, NewResultPacket(err.message, false))
+		return
+	}
+
+	c.Set("bot", portfolio)
+	c.JSON(200, &DataPacket{"transaction_confirmation", confirmation})
+}
 
-	c.JSON(200, NewResultPacket("successfully executed transaction", true))
+// tradeError is a transaction that was rejected or failed, with the status code it is reported with
+type tradeError struct {
+	status  int
+	message string
+}
+
+// Error returns the reason the transaction did not execute
+func (te *tradeError) Error() string {
+	return te.message
+}
+
+// transact executes a requested transaction on a portfolio and saves it. The caller must hold the trade lock of the
+// portfolio's bot. Returns the portfolio after the transaction and its confirmation.
+func (bw *BotWorker) transact(ref *firestore.DocumentRef, request *TransactionRequestData, receivedAt time.Time) (*models.Portfolio, *TransactionConfirmation, *tradeError) {
+	// The portfolio loaded during authentication may predate a trade that finished while this one waited
+	portfolio, err := bw.store.LoadPortfolio(context.Background(), ref)
+	if err != nil {
+		return nil, nil, &tradeError{500, "error: failed to retrieve portfolio information"}
+	}
+
+	// Record the inputs of the decision so it can be replayed later
+	decisionRef, decision := bw.newOrderDecision(portfolio, request, ref)
+
+	// Get the current price for the ticker
+	cost, ok := bw.latestPrices[request.Ticker]
+	if !ok {
+		message := "error: ticker data not available, make sure to subscribe and receive a ticker data update first"
+		decision.Rules = []models.RuleEvaluation{{Rule: "price_available", Passed: false, Detail: message}}
+		bw.saveOrderDecision(decisionRef, decision, errors.New(message))
+		return nil, nil, &tradeError{500, message}
+	}
+
+	// Trades must not fill at prices the data source could not confirm
+	if err := bw.pricesErr; err != nil {
+		message := fmt.Sprintf("error: price source unavailable (%s), prices were last updated at %s", failureReason(err), bw.pricesTime.UTC().Format(time.RFC3339))
+		decision.Rules = []models.RuleEvaluation{{Rule: "price_current", Passed: false, Detail: message}}
+		bw.saveOrderDecision(decisionRef, decision, errors.New(message))
+		return nil, nil, &tradeError{503, message}
+	}
+
+	// Create and execute the transaction
+	transaction, tradeErr := bw.createAndExecuteTransaction(portfolio, request, cost, receivedAt, ref, decisionRef, decision)
+	if tradeErr != nil {
+		return nil, nil, tradeErr
+	}
+
+	// Save the transaction and the portfolio it changed, only once the transaction executed
+	tradeErr = bw.saveTransactionToDatabase(portfolio, ref, transaction)
+	if tradeErr != nil {
+		return nil, nil, tradeErr
+	}
+
+	decision.Transaction = portfolio.TransactionReferences[len(portfolio.TransactionReferences)-1]
+	bw.saveOrderDecision(decisionRef, decision, nil)
+
+	bw.usage.recordTransaction(ownerOf(ref).ID)
+	bw.recordCollusionTrade(ref, transaction.Ticker, transaction.Action, transaction.Time)
+	bw.afterFill(portfolio, transaction)
+
+	confirmation := newTransactionConfirmation(portfolio, transaction, decision.Transaction)
+	confirmation.PriceSource = decision.PriceSource
+
+	bw.enqueueTransactionEvent(ref, &TransactionEventData{TransactionConfirmation: confirmation, Tag: transaction.Tag})
+	return portfolio, confirmation, nil
 }
 
 // getPortfolioFromContext retrieves the portfolio and database reference from the context
@@ -413,33 +1004,56 @@ func (bw *BotWorker) getPortfolioFromContext(c *gin.Context) (*models.Portfolio,
 	return portfolio, ref, true
 }
 
-// parseTransactionRequest parses the transaction request from the request body
-func (bw *BotWorker) parseTransactionRequest(c *gin.Context) (*TransactionRequestData, bool) {
-	// Read and parse the request body
-	body, err := c.GetRawData()
+// reloadPortfolio reads the current state of a portfolio and replaces the one in the context with it
+func (bw *BotWorker) reloadPortfolio(c *gin.Context, ref *firestore.DocumentRef) (*models.Portfolio, bool) {
+	portfolio, err := bw.store.LoadPortfolio(context.Background(), ref)
 	if err != nil {
-		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve request body", false))
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve portfolio information", false))
 		return nil, false
 	}
 
+	c.Set("bot", portfolio)
+	return portfolio, true
+}
+
+// parseTransactionRequest binds and validates the transaction request from the request body
+func (bw *BotWorker) parseTransactionRequest(c *gin.Context) (*TransactionRequestData, bool) {
 	request := &TransactionRequestData{}
-	err = json.Unmarshal(body, request)
+	err := c.ShouldBindJSON(request)
 	if err != nil {
-		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to parse request body", false))
+		abortWithBindingError(c, err)
 		return nil, false
 	}
 
+	request.Ticker = symbols.Canonical(request.Ticker)
+
+	// Quantities and limits must be expressible in the ticker's precision, so the trade executes the same for every client
+	precision := bw.precisionFor(request.Ticker)
+	if err := precision.CheckShares(request.NumShares); err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: invalid numShares for "+request.Ticker+": "+err.Error(), false))
+		return nil, false
+	}
+
+	if request.LimitPrice > 0 {
+		if err := precision.CheckPrice(request.LimitPrice); err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: invalid limitPrice for "+request.Ticker+": "+err.Error(), false))
+			return nil, false
+		}
+	}
+
 	return request, true
 }
 
 // createAndExecuteTransaction creates and executes a transaction
 func (bw *BotWorker) createAndExecuteTransaction(
-	c *gin.Context,
 	portfolio *models.Portfolio,
 	request *TransactionRequestData,
 	cost float64,
+	receivedAt time.Time,
 	ref *firestore.DocumentRef,
-) (*models.Transaction, bool) {
+	decisionRef *firestore.DocumentRef,
+	decision *models.OrderDecision,
+) (*models.Transaction, *tradeError) {
 	// Create the transaction object
 	transaction := &models.Transaction{
 		Time:      time.Now(),
@@ -447,46 +1061,57 @@ func (bw *BotWorker) createAndExecuteTransaction(
 		UnitCost:  cost,
 		Ticker:    request.Ticker,
 		Action:    request.Action,
+		Currency:  portfolio.CurrencyOfRecord(),
+		Tag:       request.Tag,
+		Timing:    &models.ExecutionTiming{Source: models.SourceRequest, ReceivedAt: receivedAt, PriceTime: bw.priceTime(request.Ticker)},
 		Bot:       ref,
+		Decision:  decisionRef,
 	}
 
+	// Record the price used for the decision
+	decision.Time = transaction.Time
+	decision.Price = cost
+
 	// Execute the transaction on the portfolio
-	err := portfolio.Execute(transaction)
+	err := bw.executeTransaction(portfolio, transaction, decision)
 	if err != nil {
-		c.AbortWithStatusJSON(401, NewResultPacket(err.Error(), false))
-		return nil, false
+		bw.saveOrderDecision(decisionRef, decision, err)
+		return nil, &tradeError{401, err.Error()}
 	}
 
-	return transaction, true
+	return transaction, nil
 }
 
-// saveTransactionToDatabase saves the transaction to the database
+// saveTransactionToDatabase saves an executed transaction and the portfolio it changed in a single
+// Firestore transaction, so the stored portfolio never reflects a trade that was not recorded or the reverse
 func (bw *BotWorker) saveTransactionToDatabase(
-	c *gin.Context,
 	portfolio *models.Portfolio,
+	ref *firestore.DocumentRef,
 	transaction *models.Transaction,
-) bool {
-	// Save the transaction to the database
-	doc, _, err := bw.db.Collection("transactions").Add(context.Background(), transaction)
+) *tradeError {
+	doc, err := bw.store.SaveTransaction(context.Background(), ref, portfolio, transaction)
 	if err != nil {
-		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save transaction", false))
-		return false
+		log.Printf("error saving transaction of %s: %v\n", ref.ID, err)
+		return &tradeError{500, "error: failed to save transaction"}
 	}
 
 	// Add the transaction reference to the portfolio
 	portfolio.TransactionReferences = append(portfolio.TransactionReferences, doc)
-	return true
+	return nil
 }
 
 // GetPortfolio returns the user's portfolio with all holdings and transactions.
 // @Summary Get user portfolio
-// @Description Retrieves the authenticated user's portfolio including cash balance, holdings, and transaction history
+// @Description Retrieves the authenticated user's portfolio including cash balance, holdings, and transaction history. Amounts are in the portfolio's currency of record, and the main amounts can also be converted to a display currency
 // @Tags portfolio
 // @Accept json
 // @Produce json
+// @Param currency query string false "ISO 4217 code of a display currency, such as EUR"
 // @Success 200 {object} DataPacket "Portfolio data"
+// @Failure 400 {object} ResultData "Invalid currency"
 // @Failure 401 {object} ResultData "Not authenticated"
 // @Failure 500 {object} ResultData "Server error"
+// @Failure 503 {object} ResultData "Exchange rate unavailable"
 // @Router /portfolio [get]
 func (bw *BotWorker) GetPortfolio(c *gin.Context) {
 	// Get the bot from the context (set by AuthHandler)
@@ -504,17 +1129,17 @@ func (bw *BotWorker) GetPortfolio(c *gin.Context) {
 	}
 
 	// Load all transactions from references
-	portfolio.Transactions = make([]*models.Transaction, 0, len(portfolio.TransactionReferences))
-	for _, ref := range portfolio.TransactionReferences {
-		doc, err := ref.Get(context.Background())
-		if err != nil {
-			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
-			return
-		}
+	if err := bw.loadPortfolioTransactions(context.Background(), portfolio); err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
 
-		transaction := &models.Transaction{}
-		doc.DataTo(transaction)
-		portfolio.Transactions = append(portfolio.Transactions, transaction)
+	if currency := c.Query("currency"); currency != "" && !bw.convertForDisplay(c, portfolio, currency) {
+		return
+	}
+
+	if bw.turnoverCap > 0 {
+		portfolio.TurnoverAllowance = portfolio.AllowanceAt(bw.turnoverCap, time.Now())
 	}
 
 	// Return the portfolio as JSON
@@ -528,15 +1153,117 @@ func (bw *BotWorker) GetPortfolio(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Success 200 {object} DataPacket "Live stock price data"
+// @Header 200 {string} X-Prices-Updated "When the prices were last updated"
+// @Header 200 {string} X-Price-Source "Data source that provided the prices"
+// @Header 200 {string} X-Prices-Stale "Set to true when the last price update failed"
+// @Header 200 {string} X-Data-Source-Error "Reason the last price update failed"
 // @Failure 401 {object} ResultData "Not authenticated"
 // @Router /live_stock_data [get]
 func (bw *BotWorker) GetLiveStockData(c *gin.Context) {
+	c.Header("X-Prices-Updated", bw.pricesTime.UTC().Format(time.RFC3339))
+	c.Header("X-Price-Source", bw.priceSource)
+	if err := bw.pricesErr; err != nil {
+		c.Header("X-Prices-Stale", "true")
+		c.Header("X-Data-Source-Error", string(failureReason(err)))
+	}
+
+	// Serve the previous prices when fault injection asks for stale data
+	if c.GetBool(StalePricesKey) {
+		c.JSON(200, &DataPacket{"live_stock_data", bw.stalePrices})
+		return
+	}
+
 	// Return the latest prices as JSON
 	c.JSON(200, &DataPacket{"live_stock_data", bw.latestPrices})
 }
 
-// updateCurrPrices updates the current prices
-func (bw *BotWorker) updateCurrPrices() {
-	bw.latestPrices = bw.tiingo.FetchCurrPrices()
-	log.Printf("updated prices: %v\n", bw.latestPrices)
+// updateCurrPrices updates the current prices. If the update fails, the previous
+// prices are kept and marked stale until an update succeeds. When every price source
+// has used its quota down to the reserve, only held tickers and tickers with open
+// orders are refreshed, and the other tickers keep their previous prices.
+func (bw *BotWorker) updateCurrPrices() error {
+	tickers := bw.watchlist.Tickers()
+	constrained := bw.prices.Constrained()
+	if constrained {
+		tickers = bw.watchlist.Critical(tickers)
+		if len(tickers) == 0 {
+			return nil
+		}
+	}
+
+	prices, source, err := bw.prices.Fetch(tickers)
+	if err != nil {
+		bw.pricesErr = err
+		log.Printf("error updating prices, keeping prices from %v: %v\n", bw.pricesTime, err)
+		return err
+	}
+
+	now := time.Now()
+	bw.filterPrices(prices, now)
+
+	times := make(map[string]time.Time, len(prices))
+	for ticker := range prices {
+		times[ticker] = now
+	}
+
+	if constrained {
+		for ticker, price := range bw.latestPrices {
+			if _, ok := prices[ticker]; !ok {
+				prices[ticker] = price
+				times[ticker] = bw.priceTimes[ticker]
+			}
+		}
+	}
+
+	bw.stalePrices = bw.latestPrices
+	bw.latestPrices = prices
+	bw.priceTimes = times
+	bw.pricesTime = now
+	bw.priceSource = source
+	bw.pricesErr = nil
+	log.Printf("updated prices from %s: %v\n", source, bw.latestPrices)
+
+	bw.publishPrices()
+	return nil
+}
+
+// failureReason returns the reason a data source request failed
+func failureReason(err error) services.FailureReason {
+	var sourceErr *services.SourceError
+	if errors.As(err, &sourceErr) {
+		return sourceErr.Reason
+	}
+
+	return services.ReasonUnavailable
+}
+
+// GetJobs returns the status and run metrics of all scheduled background jobs.
+// @Summary Get scheduled job status
+// @Description Retrieves the schedule, last run status and metrics of every background job
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Job statuses"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/jobs [get]
+func (bw *BotWorker) GetJobs(c *gin.Context) {
+	c.JSON(200, &DataPacket{"jobs", bw.scheduler.Status()})
+}
+
+// RunJob triggers a scheduled background job immediately.
+// @Summary Run a job now
+// @Description Runs the named background job outside of its schedule
+// @Tags admin
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 200 {object} ResultData "Job started"
+// @Failure 404 {object} ResultData "Job not found"
+// @Router /admin/jobs/{name}/run [post]
+func (bw *BotWorker) RunJob(c *gin.Context) {
+	err := bw.scheduler.RunNow(c.Param("name"))
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket(err.Error(), false))
+		return
+	}
+
+	c.JSON(200, NewResultPacket(fmt.Sprintf("started job %s", c.Param("name")), true))
 }
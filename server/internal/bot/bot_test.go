@@ -0,0 +1,413 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// serve sends a request with an API key and optional X-Portfolio header through AuthHandler and a handler
+func serve(bw *BotWorker, handler gin.HandlerFunc, apiKey, shadow, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", bw.AuthHandler, handler)
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Authorization", apiKey)
+	if shadow != "" {
+		request.Header.Set(portfolioHeader, shadow)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// testPortfolio returns a bot portfolio with 10000 in cash and the given API key
+func testPortfolio(apiKey string) *models.Portfolio {
+	portfolio := models.NewPortfolio(10000)
+	portfolio.APIKey = apiKey
+	return portfolio
+}
+
+func TestAuthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKey     string
+		shadow     string
+		wantStatus int
+		wantRef    string
+		wantCash   float64
+	}{
+		{"bot", "key", "", 200, "bot1", 10000},
+		{"shadow portfolio", "key", "shadow1", 200, "shadow1", 500},
+		{"unknown api key", "other", "", 401, "", 0},
+		{"missing api key", "", "", 401, "", 0},
+		{"unknown shadow portfolio", "key", "shadow2", 404, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			bot := store.addBot("bot1", testPortfolio("key"))
+			store.addShadow(bot, "shadow1", models.NewPortfolio(500))
+			bw := newTestWorker(t, store, newFixedPrices(nil), newFixedWatchlist(models.NewHistory()))
+
+			var ref, owner *firestore.DocumentRef
+			var portfolio *models.Portfolio
+			recorder := serve(bw, func(c *gin.Context) {
+				portfolio, ref, _ = bw.getPortfolioFromContext(c)
+				owner, _ = ownerRef(c)
+				c.Status(200)
+			}, tt.apiKey, tt.shadow, "")
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			if ref.ID != tt.wantRef || owner.ID != "bot1" {
+				t.Errorf("portfolio %s of bot %s, want %s of bot1", ref.ID, owner.ID, tt.wantRef)
+			}
+
+			if portfolio.Cash != tt.wantCash {
+				t.Errorf("cash = %g, want %g", portfolio.Cash, tt.wantCash)
+			}
+		})
+	}
+}
+
+func TestMakeTransaction(t *testing.T) {
+	tests := []struct {
+		name         string
+		shadow       string
+		body         string
+		wantStatus   int
+		wantCash     float64
+		wantShares   float64
+		wantDecision bool // Whether a decision is recorded
+	}{
+		{"buy", "", `{"action": "buy", "ticker": "AAPL", "numShares": 10}`, 200, 8500, 10, true},
+		{"buy for a shadow portfolio", "shadow1", `{"action": "buy", "ticker": "AAPL", "numShares": 2}`, 200, 200, 2, true},
+		{"insufficient cash", "", `{"action": "buy", "ticker": "AAPL", "numShares": 100}`, 401, 10000, 0, true},
+		{"sell without shares", "", `{"action": "sell", "ticker": "AAPL", "numShares": 1}`, 401, 10000, 0, true},
+		{"ticker without a price", "", `{"action": "buy", "ticker": "MSFT", "numShares": 1}`, 500, 10000, 0, true},
+		{"invalid request", "", `{"action": "hold", "ticker": "AAPL", "numShares": 1}`, 400, 10000, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			bot := store.addBot("bot1", testPortfolio("key"))
+			shadow := store.addShadow(bot, "shadow1", models.NewPortfolio(500))
+			bw := newTestWorker(t, store, newFixedPrices(map[string]float64{"AAPL": 150}), newFixedWatchlist(models.NewHistory()), "AAPL", "MSFT")
+			if err := bw.updateCurrPrices(); err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := serve(bw, bw.MakeTransaction, "key", tt.shadow, tt.body)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			ref, untouched := bot, shadow
+			if tt.shadow != "" {
+				ref, untouched = shadow, bot
+			}
+
+			portfolio := store.stored(ref)
+			if portfolio.Cash != tt.wantCash {
+				t.Errorf("stored cash = %g, want %g", portfolio.Cash, tt.wantCash)
+			}
+
+			shares := 0.0
+			if holding, ok := portfolio.Holdings["AAPL"]; ok {
+				shares = holding.NumShares
+			}
+
+			if shares != tt.wantShares {
+				t.Errorf("stored shares = %g, want %g", shares, tt.wantShares)
+			}
+
+			if len(store.portfolios[untouched.Path].TransactionReferences) != 0 {
+				t.Errorf("transaction stored in %s", untouched.ID)
+			}
+
+			if (len(store.decisions) == 1) != tt.wantDecision {
+				t.Fatalf("recorded %d decisions, want a decision %v", len(store.decisions), tt.wantDecision)
+			}
+
+			for _, decision := range store.decisions {
+				if decision.Accepted != (tt.wantStatus == 200) {
+					t.Errorf("decision accepted = %v, error %q", decision.Accepted, decision.Error)
+				}
+			}
+
+			if tt.wantStatus != 200 {
+				if len(store.transactions) != 0 {
+					t.Errorf("stored %d transactions of a rejected trade", len(store.transactions))
+				}
+
+				return
+			}
+
+			packet := &struct {
+				Type    string                  `json:"type"`
+				Payload TransactionConfirmation `json:"payload"`
+			}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), packet); err != nil {
+				t.Fatal(err)
+			}
+
+			confirmation := packet.Payload
+			if _, ok := store.transactions[confirmation.ID]; !ok || len(portfolio.TransactionReferences) != 1 || portfolio.TransactionReferences[0].ID != confirmation.ID {
+				t.Errorf("transaction %s was not stored with the portfolio", confirmation.ID)
+			}
+
+			if confirmation.FillPrice != 150 || confirmation.CashAfter != tt.wantCash || confirmation.PriceSource != "fixed" {
+				t.Errorf("confirmation = %g at %g from %q, want %g at 150 from fixed", confirmation.CashAfter, confirmation.FillPrice, confirmation.PriceSource, tt.wantCash)
+			}
+
+			if decision, ok := store.decisions[confirmation.DecisionID]; !ok || decision.Transaction.ID != confirmation.ID {
+				t.Errorf("decision %s does not reference transaction %s", confirmation.DecisionID, confirmation.ID)
+			}
+		})
+	}
+}
+
+func TestMakeTransactionPriceSourceDown(t *testing.T) {
+	store := newMemoryStore()
+	bot := store.addBot("bot1", testPortfolio("key"))
+	prices := newFixedPrices(map[string]float64{"AAPL": 150})
+	bw := newTestWorker(t, store, prices, newFixedWatchlist(models.NewHistory()), "AAPL")
+	if err := bw.updateCurrPrices(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous price is kept but trades must not fill at it
+	prices.err = &services.SourceError{Source: "fixed", Op: "prices", Reason: services.ReasonUnavailable, Err: errors.New("down")}
+	if err := bw.updateCurrPrices(); err == nil {
+		t.Fatal("price update succeeded while the source is down")
+	}
+
+	recorder := serve(bw, bw.MakeTransaction, "key", "", `{"action": "buy", "ticker": "AAPL", "numShares": 1}`)
+	if recorder.Code != 503 {
+		t.Fatalf("status = %d, want 503: %s", recorder.Code, recorder.Body)
+	}
+
+	if portfolio := store.stored(bot); portfolio.Cash != 10000 || len(store.transactions) != 0 {
+		t.Errorf("trade executed with cash %g and %d transactions while the source is down", portfolio.Cash, len(store.transactions))
+	}
+}
+
+func TestCalculateAccountValues(t *testing.T) {
+	store := newMemoryStore()
+	portfolio := testPortfolio("key")
+	portfolio.Cash = 1000
+	portfolio.Holdings["AAPL"] = &models.Holding{NumShares: 10, PurchaseValue: 100}
+	bot := store.addBot("bot1", portfolio)
+
+	shadowPortfolio := models.NewPortfolio(0)
+	shadowPortfolio.Holdings["MSFT"] = &models.Holding{NumShares: 4, PurchaseValue: 50}
+	shadow := store.addShadow(bot, "shadow1", shadowPortfolio)
+
+	watchlist := newFixedWatchlist(models.NewHistory())
+	bw := newTestWorker(t, store, newFixedPrices(map[string]float64{"AAPL": 150, "MSFT": 60}), watchlist, "AAPL", "MSFT")
+	if err := bw.updateCurrPrices(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bw.calculateAccountValues(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []struct {
+		ref   *firestore.DocumentRef
+		value float64
+	}{{bot, 2500}, {shadow, 240}} {
+		valued := store.stored(want.ref)
+		if valued.AccountValue != want.value {
+			t.Errorf("account value of %s = %g, want %g", want.ref.ID, valued.AccountValue, want.value)
+		}
+
+		if len(valued.HistoricalAccountValue) != 1 || valued.HistoricalAccountValue[0].Value != want.value {
+			t.Errorf("historical account values of %s = %v, want one of %g", want.ref.ID, valued.HistoricalAccountValue, want.value)
+		}
+	}
+
+	// Shadow portfolios are valued but left out of the standings
+	if len(bw.public.standings) != 1 || bw.public.standings["bot1"] == nil || bw.public.standings["bot1"].AccountValue != 2500 {
+		t.Errorf("standings = %v, want only bot1 at 2500", bw.public.standings)
+	}
+
+	held := make([]string, 0)
+	for _, priority := range watchlist.priorities {
+		if priority.Tier == services.TierHeld {
+			held = append(held, priority.Ticker)
+		}
+	}
+
+	slices.Sort(held)
+	if !slices.Equal(held, []string{"AAPL", "MSFT"}) {
+		t.Errorf("held tickers = %v, want [AAPL MSFT]", held)
+	}
+}
+
+func TestCalculatePortfolioValueFallsBack(t *testing.T) {
+	// MSFT has no live price and falls back on its last close, TSLA has no history either and falls back on its purchase value
+	bw := newTestWorker(t, newMemoryStore(), newFixedPrices(nil), newFixedWatchlist(dailyHistory("MSFT", 2, 3)))
+	bw.latestPrices["AAPL"] = 150
+
+	portfolio := models.NewPortfolio(1000)
+	portfolio.Holdings["AAPL"] = &models.Holding{NumShares: 1, PurchaseValue: 100}
+	portfolio.Holdings["MSFT"] = &models.Holding{NumShares: 2, PurchaseValue: 90}
+	portfolio.Holdings["TSLA"] = &models.Holding{NumShares: 3, PurchaseValue: 50}
+
+	pending := bw.calculatePortfolioValue(portfolio, "bot1")
+	if !slices.Equal(pending, []string{"MSFT", "TSLA"}) {
+		t.Errorf("pending = %v, want [MSFT TSLA]", pending)
+	}
+
+	if want := 1000 + 150 + 2*103 + 3*50.0; portfolio.AccountValue != want {
+		t.Errorf("account value = %g, want %g", portfolio.AccountValue, want)
+	}
+}
+
+func TestEvaluateOrders(t *testing.T) {
+	store := newMemoryStore()
+	bot := store.addBot("bot1", testPortfolio("key"))
+
+	// Only the AAPL limit is crossed by the prices
+	for _, order := range []*OrderRequestData{
+		{Type: models.OrderTypeLimit, Action: "buy", Ticker: "AAPL", NumShares: 5, LimitPrice: 145},
+		{Type: models.OrderTypeLimit, Action: "buy", Ticker: "MSFT", NumShares: 5, LimitPrice: 90},
+	} {
+		group, err := buildOrderGroup(&OrderGroupRequestData{Type: models.OrderGroupSingle, Orders: []*OrderRequestData{order}}, bot)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		store.SaveOrderGroup(context.Background(), group)
+	}
+
+	watchlist := newFixedWatchlist(models.NewHistory())
+	bw := newTestWorker(t, store, newFixedPrices(map[string]float64{"AAPL": 140, "MSFT": 100}), watchlist, "AAPL", "MSFT")
+	if err := bw.loadOrders(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bw.updateCurrPrices(); err != nil {
+		t.Fatal(err)
+	}
+
+	bw.evaluateOrders()
+
+	portfolio := store.stored(bot)
+	if holding := portfolio.Holdings["AAPL"]; portfolio.Cash != 9300 || holding == nil || holding.NumShares != 5 {
+		t.Fatalf("stored portfolio = %g cash and %v AAPL, want 9300 and 5 shares", portfolio.Cash, holding)
+	}
+
+	if len(portfolio.TransactionReferences) != 1 || store.transactions[portfolio.TransactionReferences[0].ID] == nil {
+		t.Errorf("fill was not stored with the portfolio")
+	}
+
+	for _, group := range store.groups {
+		order := group.Orders[0]
+		switch order.Ticker {
+		case "AAPL":
+			if group.Status != models.OrderGroupCompleted || order.Status != models.OrderStatusFilled || order.FilledShares != 5 {
+				t.Errorf("stored AAPL group %s with order %s of %g shares, want completed and filled", group.Status, order.Status, order.FilledShares)
+			}
+		case "MSFT":
+			if group.Status != models.OrderGroupActive || order.Status != models.OrderStatusOpen {
+				t.Errorf("stored MSFT group %s with order %s, want active and open", group.Status, order.Status)
+			}
+		}
+	}
+
+	if open := bw.orders.OpenTickers(); len(open) != 1 || open["MSFT"] != 1 {
+		t.Errorf("open orders by ticker = %v, want one of MSFT", open)
+	}
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	if entries := bw.orders.Crossable("MSFT", 90); len(entries) != 1 || entries[0].Order.Ticker != "MSFT" || entries[0].Group.Bot.ID != "bot1" {
+		t.Errorf("crossable MSFT orders = %v, want the open limit of bot1", entries)
+	}
+}
+
+func TestReleaseArchived(t *testing.T) {
+	store := newMemoryStore()
+	archived := store.addBot("bot1", testPortfolio("key1"))
+	shadow := store.addShadow(archived, "shadow1", testPortfolio(""))
+	other := store.addBot("bot2", testPortfolio("key2"))
+
+	bw := newTestWorker(t, store, newFixedPrices(nil), newFixedWatchlist(models.NewHistory()), "AAPL")
+	bw.orders.Lock()
+	for _, ref := range []*firestore.DocumentRef{archived, shadow, other} {
+		order := &OrderRequestData{Type: models.OrderTypeLimit, Action: "buy", Ticker: "AAPL", NumShares: 5, LimitPrice: 145}
+		group, err := buildOrderGroup(&OrderGroupRequestData{Type: models.OrderGroupSingle, Orders: []*OrderRequestData{order}}, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bw.orders.Add(group)
+		bw.protections.set(&protectedPosition{ref: ref, ticker: "AAPL", protection: &models.PositionProtection{StopLoss: 200}})
+	}
+	bw.orders.Unlock()
+
+	for _, ref := range []*firestore.DocumentRef{archived, other} {
+		bw.alerts.add(&models.PriceAlert{ID: ref.ID, Ticker: "AAPL", Condition: "above", Price: 100, Bot: ref})
+	}
+
+	bw.releaseArchived(&competitionArchive{
+		bots:    []*firestore.DocumentSnapshot{{Ref: archived}},
+		shadows: []*firestore.DocumentSnapshot{{Ref: shadow}},
+	})
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	if groups := bw.orders.ActiveGroups(); len(groups) != 1 || groups[0].Bot.ID != "bot2" {
+		t.Errorf("active groups = %v, want only the group of bot2", groups)
+	}
+
+	for _, ref := range []*firestore.DocumentRef{archived, shadow} {
+		if groups := bw.orders.BotGroups(ref.ID); len(groups) != 0 {
+			t.Errorf("%s still has %d groups", ref.ID, len(groups))
+		}
+	}
+
+	if entries := bw.orders.Crossable("AAPL", 140); len(entries) != 1 || entries[0].Group.Bot.ID != "bot2" {
+		t.Errorf("crossable AAPL orders = %v, want only the order of bot2", entries)
+	}
+
+	triggered := bw.protections.triggered(map[string]float64{"AAPL": 150})
+	if len(triggered) != 1 {
+		t.Fatalf("%d protections triggered, want only the one of bot2", len(triggered))
+	}
+
+	for position := range triggered {
+		if position.ref.ID != "bot2" {
+			t.Errorf("protection of %s triggered, want bot2", position.ref.ID)
+		}
+	}
+
+	if alerts := bw.alerts.triggered(map[string]float64{"AAPL": 150}); len(alerts) != 1 || alerts[0].Bot.ID != "bot2" {
+		t.Errorf("triggered alerts = %v, want only the alert of bot2", alerts)
+	}
+}
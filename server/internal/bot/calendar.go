@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// BlackoutRequestData represents a request to set the earnings blackout window
+type BlackoutRequestData struct {
+	Minutes int `json:"minutes"` // Minutes before and after an earnings release in which trades are blocked, 0 disables
+}
+
+// refreshEarnings refreshes the earnings calendar
+func (bw *BotWorker) refreshEarnings() error {
+	return bw.earnings.Refresh()
+}
+
+// GetEarningsCalendar returns upcoming earnings releases for the requested or watched tickers.
+// @Summary Get earnings calendar
+// @Description Retrieves upcoming earnings releases for the given tickers, or for every watched ticker if none are given
+// @Tags calendar
+// @Produce json
+// @Param ticker query []string false "Ticker symbols (defaults to the watchlist)"
+// @Success 200 {object} DataPacket "Upcoming earnings"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /calendar/earnings [get]
+func (bw *BotWorker) GetEarningsCalendar(c *gin.Context) {
+	tickers, ok := c.GetQueryArray("ticker")
+	if !ok {
+		tickers = bw.watchlist.Tickers()
+	}
+
+	c.JSON(200, &DataPacket{"earnings_calendar", gin.H{
+		"updatedAt": bw.earnings.UpdatedAt(),
+		"events":    bw.earnings.Upcoming(tickers...),
+	}})
+}
+
+// SetEarningsBlackout sets the authenticated bot's earnings blackout window.
+// @Summary Set earnings blackout
+// @Description Sets how many minutes around an earnings release trades are blocked for the authenticated bot, when the competition enables the rule
+// @Tags calendar
+// @Accept json
+// @Produce json
+// @Param blackout body BlackoutRequestData true "Blackout window"
+// @Success 200 {object} ResultData "Blackout window set"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Router /calendar/blackout [put]
+func (bw *BotWorker) SetEarningsBlackout(c *gin.Context) {
+	portfolio, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	request := &BlackoutRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil || request.Minutes < 0 {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: minutes must be a non-negative integer", false))
+		return
+	}
+
+	_, err = ref.Update(context.Background(), []firestore.Update{
+		{Path: "earningsBlackoutMinutes", Value: request.Minutes},
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save blackout window", false))
+		return
+	}
+
+	portfolio.EarningsBlackoutMinutes = request.Minutes
+
+	message := fmt.Sprintf("earnings blackout set to %d minutes", request.Minutes)
+	if !bw.earningsBlackoutEnabled {
+		message += " (the earnings blackout rule is not enabled for this competition)"
+	}
+
+	c.JSON(200, NewResultPacket(message, true))
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Collections names the Firestore collections the bot worker reads and writes, so tests, staging and
+// production can use separate collections of the same project without code changes
+type Collections struct {
+	Bots           string // Bot portfolios
+	Shadows        string // Shadow portfolios, a subcollection of every bot
+	Transactions   string // Executed transactions
+	OrderDecisions string // Every transact request with its rule evaluations
+	OrderGroups    string // Conditional order groups
+	Competitions   string // Competitions
+	Tickers        string // Exchange listings of tickers
+	OnboardingJobs string // Bulk ticker downloads
+	EventOutbox    string // Events waiting to be published
+	AuditLog       string // Administrative actions
+	Universes      string // Index universes, with the log of their changes in a subcollection
+	Announcements  string // Messages from the organizers to the bots
+	SpectatorKeys  string // Read-only API keys of people observing a bot
+	PriceAlerts    string // Price alerts waiting to trigger
+	AlertHistory   string // Triggered price alerts with their webhook delivery
+	ReconcileFlags string // Portfolios that diverged from their transactions, kept for admin review
+}
+
+// DefaultCollections returns the collection names used in production
+func DefaultCollections() Collections {
+	return Collections{
+		Bots:           "bots",
+		Shadows:        "shadows",
+		Transactions:   "transactions",
+		OrderDecisions: "order_decisions",
+		OrderGroups:    "order_groups",
+		Competitions:   "competitions",
+		Tickers:        "tickers",
+		OnboardingJobs: "onboarding_jobs",
+		EventOutbox:    "event_outbox",
+		AuditLog:       "audit_log",
+		Universes:      "universes",
+		Announcements:  "announcements",
+		SpectatorKeys:  "spectator_keys",
+		PriceAlerts:    "price_alerts",
+		AlertHistory:   "alert_history",
+		ReconcileFlags: "reconciliation_flags",
+	}
+}
+
+// NewCollections returns the default collection names with a prefix, such as "staging_", prepended to each.
+// An empty prefix returns the default names.
+func NewCollections(prefix string) (Collections, error) {
+	if strings.ContainsAny(prefix, "/.") || strings.HasPrefix(prefix, "__") {
+		return Collections{}, fmt.Errorf("invalid collection prefix %q, it must not contain '/' or '.' or start with '__'", prefix)
+	}
+
+	collections := DefaultCollections()
+	for _, name := range []*string{
+		&collections.Bots,
+		&collections.Shadows,
+		&collections.Transactions,
+		&collections.OrderDecisions,
+		&collections.OrderGroups,
+		&collections.Competitions,
+		&collections.Tickers,
+		&collections.OnboardingJobs,
+		&collections.EventOutbox,
+		&collections.AuditLog,
+		&collections.Universes,
+		&collections.Announcements,
+		&collections.SpectatorKeys,
+		&collections.PriceAlerts,
+		&collections.AlertHistory,
+		&collections.ReconcileFlags,
+	} {
+		*name = prefix + *name
+	}
+
+	return collections, nil
+}
@@ -0,0 +1,409 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Collusion detection defaults, unless set with the environment variables of the same name
+const (
+	defaultCollusionWindow    = 5 * time.Minute // Time between opposite trades of two bots that counts as a match
+	defaultCollusionMatches   = 3               // Matches that flag a pair of bots
+	defaultCollusionMaxVolume = 1_000_000       // Average daily volume below which a ticker is illiquid
+	defaultCollusionLookback  = 30              // Days of transactions analyzed
+	collusionConcentration    = 0.25            // Share of a pair's trades that must be matches to flag the pair
+	maxCollusionExamples      = 10              // Matches listed as examples of each pair
+	maxCollusionPairs         = 100             // Pairs listed in a report, highest risk first
+)
+
+// CollusionMatch is a pair of opposite trades of the same illiquid ticker by two bots within the collusion window
+type CollusionMatch struct {
+	Ticker   string    `json:"ticker"`   // Traded ticker
+	Buyer    string    `json:"buyer"`    // Bot that bought
+	Seller   string    `json:"seller"`   // Bot that sold
+	BuyTime  time.Time `json:"buyTime"`  // When the buyer traded
+	SellTime time.Time `json:"sellTime"` // When the seller traded
+	Value    float64   `json:"value"`    // Smaller traded value of the two trades
+	OffHours bool      `json:"offHours"` // Whether either trade was outside the regular session, when quotes are thin or stale
+}
+
+// CollusionPair summarizes the matches of two bots
+type CollusionPair struct {
+	Bots          [2]string         `json:"bots"`          // IDs of the two bots, in sorted order
+	Matches       int               `json:"matches"`       // Opposite trades of the same illiquid ticker within the window
+	OffHours      int               `json:"offHours"`      // Matches with a trade outside the regular session
+	MatchedValue  float64           `json:"matchedValue"`  // Total value of the matches
+	Tickers       []string          `json:"tickers"`       // Tickers of the matches
+	Concentration float64           `json:"concentration"` // Share of the two bots' trades that are part of a match
+	Score         float64           `json:"score"`         // Risk score, higher is more suspicious
+	Flagged       bool              `json:"flagged"`       // Whether the pair is flagged for review and, if enabled, blocked
+	Examples      []*CollusionMatch `json:"examples"`      // Most recent matches
+}
+
+// CollusionReport is the result of a collusion scan
+type CollusionReport struct {
+	GeneratedAt  time.Time        `json:"generatedAt"`  // When the scan ran
+	Since        time.Time        `json:"since"`        // Start of the analyzed transactions
+	Window       float64          `json:"window"`       // Seconds between opposite trades that count as a match
+	MaxVolume    float64          `json:"maxVolume"`    // Average daily volume below which a ticker is illiquid
+	MinMatches   int              `json:"minMatches"`   // Matches that flag a pair
+	Transactions int              `json:"transactions"` // Analyzed transactions
+	Flagged      int              `json:"flagged"`      // Flagged pairs
+	Pairs        []*CollusionPair `json:"pairs"`        // Pairs with at least one match, highest risk first
+}
+
+// recentTrade is a recent trade of a bot, kept to check the collusion rule
+type recentTrade struct {
+	bot    string
+	action string
+	time   time.Time
+}
+
+// collusionTracker keeps the last collusion report, the flagged pairs and the recent trades of every ticker
+type collusionTracker struct {
+	mu         sync.Mutex
+	window     time.Duration
+	minMatches int
+	maxVolume  float64
+	lookback   int
+	block      bool                       // Whether the collusion rule rejects trades of flagged pairs
+	report     *CollusionReport           // Last report, nil if no scan ran
+	partners   map[string]map[string]bool // Flagged partners of each bot
+	recent     map[string][]recentTrade   // Trades within the window by ticker, oldest first
+}
+
+// newCollusionTracker creates a collusion tracker configured by COLLUSION_WINDOW_SECONDS, COLLUSION_MIN_MATCHES,
+// COLLUSION_MAX_VOLUME, COLLUSION_LOOKBACK_DAYS and COLLUSION_RULE
+func newCollusionTracker() (*collusionTracker, error) {
+	tracker := &collusionTracker{
+		window:     defaultCollusionWindow,
+		minMatches: defaultCollusionMatches,
+		maxVolume:  defaultCollusionMaxVolume,
+		lookback:   defaultCollusionLookback,
+		block:      os.Getenv("COLLUSION_RULE") == "true",
+		partners:   make(map[string]map[string]bool),
+		recent:     make(map[string][]recentTrade),
+	}
+
+	seconds := int(defaultCollusionWindow.Seconds())
+	for key, value := range map[string]*int{
+		"COLLUSION_WINDOW_SECONDS": &seconds,
+		"COLLUSION_MIN_MATCHES":    &tracker.minMatches,
+		"COLLUSION_LOOKBACK_DAYS":  &tracker.lookback,
+	} {
+		if env := os.Getenv(key); env != "" {
+			parsed, err := strconv.Atoi(env)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid %s: %s", key, env)
+			}
+
+			*value = parsed
+		}
+	}
+
+	if env := os.Getenv("COLLUSION_MAX_VOLUME"); env != "" {
+		parsed, err := strconv.ParseFloat(env, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid COLLUSION_MAX_VOLUME: %s", env)
+		}
+
+		tracker.maxVolume = parsed
+	}
+
+	tracker.window = time.Duration(seconds) * time.Second
+	return tracker, nil
+}
+
+// recordTrade adds an executed trade to the recent trades of its ticker and drops trades older than the window
+func (ct *collusionTracker) recordTrade(bot, ticker, action string, at time.Time) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	trades := ct.recent[ticker]
+	start := sort.Search(len(trades), func(i int) bool {
+		return at.Sub(trades[i].time) <= ct.window
+	})
+
+	ct.recent[ticker] = append(trades[start:], recentTrade{bot, action, at})
+}
+
+// counterpart returns a flagged partner of the bot that traded the ticker in the opposite direction within the window,
+// or an empty string if there is none
+func (ct *collusionTracker) counterpart(bot, ticker, action string, at time.Time) string {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	partners := ct.partners[bot]
+	if len(partners) == 0 {
+		return ""
+	}
+
+	for _, trade := range ct.recent[ticker] {
+		if partners[trade.bot] && trade.action != action && at.Sub(trade.time).Abs() <= ct.window {
+			return trade.bot
+		}
+	}
+
+	return ""
+}
+
+// setReport stores a report and flags its flagged pairs as partners
+func (ct *collusionTracker) setReport(report *CollusionReport) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.report = report
+	ct.partners = make(map[string]map[string]bool)
+	for _, pair := range report.Pairs {
+		if !pair.Flagged {
+			continue
+		}
+
+		for i, bot := range pair.Bots {
+			if ct.partners[bot] == nil {
+				ct.partners[bot] = make(map[string]bool)
+			}
+
+			ct.partners[bot][pair.Bots[1-i]] = true
+		}
+	}
+}
+
+// collusionTrade is a transaction of a bot, as analyzed by a collusion scan
+type collusionTrade struct {
+	bot      string
+	action   string
+	time     time.Time
+	value    float64
+	offHours bool
+}
+
+// scanCollusion analyzes the transactions of the lookback period for pairs of bots that repeatedly trade the same
+// illiquid ticker in opposite directions within the collusion window, and stores the report.
+// Shadow portfolios are left out, since their trades cannot move value between bots.
+func (bw *BotWorker) scanCollusion() error {
+	now := time.Now()
+	since := now.AddDate(0, 0, -bw.collusion.lookback)
+
+	docs, err := bw.db.Collection(bw.collections.Transactions).Where("time", ">=", since).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving transactions: %v", err)
+	}
+
+	byTicker := make(map[string][]*collusionTrade)
+	tradesPerBot := make(map[string]int)
+	analyzed := 0
+	for _, doc := range docs {
+		transaction := &models.Transaction{}
+		if doc.DataTo(transaction) != nil || transaction.Bot == nil || ownerOf(transaction.Bot) != transaction.Bot {
+			continue
+		}
+
+		analyzed++
+		tradesPerBot[transaction.Bot.ID]++
+		byTicker[transaction.Ticker] = append(byTicker[transaction.Ticker], &collusionTrade{
+			bot:      transaction.Bot.ID,
+			action:   transaction.Action,
+			time:     transaction.Time,
+			value:    transaction.Value(),
+			offHours: transaction.Session != market.SessionRegular,
+		})
+	}
+
+	report := bw.collusion.analyze(byTicker, tradesPerBot, func(ticker string) bool {
+		// Tickers without cached volume are treated as illiquid, so they are not a blind spot
+		return averageDailyVolume(bw.watchlist.Daily(), ticker, now) < bw.collusion.maxVolume
+	})
+
+	report.GeneratedAt = now
+	report.Since = since
+	report.Transactions = analyzed
+	bw.collusion.setReport(report)
+
+	if report.Flagged > 0 {
+		log.Printf("ALERT: collusion scan flagged %d pairs of bots\n", report.Flagged)
+	}
+
+	return nil
+}
+
+// analyze matches opposite trades of different bots in the same illiquid ticker within the window
+// and summarizes the matches of every pair of bots
+func (ct *collusionTracker) analyze(byTicker map[string][]*collusionTrade, tradesPerBot map[string]int, illiquid func(string) bool) *CollusionReport {
+	type pairState struct {
+		pair    *CollusionPair
+		tickers map[string]bool
+		trades  map[*collusionTrade]bool // Distinct trades that are part of a match
+	}
+
+	pairs := make(map[[2]string]*pairState)
+	for ticker, trades := range byTicker {
+		if !illiquid(ticker) {
+			continue
+		}
+
+		sort.Slice(trades, func(i, j int) bool {
+			return trades[i].time.Before(trades[j].time)
+		})
+
+		for i, first := range trades {
+			for _, second := range trades[i+1:] {
+				if second.time.Sub(first.time) > ct.window {
+					break
+				}
+
+				if first.bot == second.bot || first.action == second.action {
+					continue
+				}
+
+				key := [2]string{first.bot, second.bot}
+				if key[0] > key[1] {
+					key[0], key[1] = key[1], key[0]
+				}
+
+				state, ok := pairs[key]
+				if !ok {
+					state = &pairState{&CollusionPair{Bots: key}, make(map[string]bool), make(map[*collusionTrade]bool)}
+					pairs[key] = state
+				}
+
+				buy, sell := first, second
+				if buy.action != "buy" {
+					buy, sell = sell, buy
+				}
+
+				match := &CollusionMatch{
+					Ticker:   ticker,
+					Buyer:    buy.bot,
+					Seller:   sell.bot,
+					BuyTime:  buy.time,
+					SellTime: sell.time,
+					Value:    math.Min(buy.value, sell.value),
+					OffHours: buy.offHours || sell.offHours,
+				}
+
+				state.pair.Matches++
+				state.pair.MatchedValue += match.Value
+				if match.OffHours {
+					state.pair.OffHours++
+				}
+
+				state.pair.Examples = append(state.pair.Examples, match)
+				state.tickers[ticker] = true
+				state.trades[first] = true
+				state.trades[second] = true
+			}
+		}
+	}
+
+	report := &CollusionReport{
+		Window:     ct.window.Seconds(),
+		MaxVolume:  ct.maxVolume,
+		MinMatches: ct.minMatches,
+		Pairs:      make([]*CollusionPair, 0, len(pairs)),
+	}
+
+	for key, state := range pairs {
+		pair := state.pair
+		pair.Concentration = float64(len(state.trades)) / float64(tradesPerBot[key[0]]+tradesPerBot[key[1]])
+
+		// Off-hours matches weigh double, since thin quotes make them the easiest way to move value
+		pair.Score = float64(pair.Matches+pair.OffHours) * pair.Concentration
+		pair.Flagged = pair.Matches >= ct.minMatches && pair.Concentration >= collusionConcentration
+		if pair.Flagged {
+			report.Flagged++
+		}
+
+		for ticker := range state.tickers {
+			pair.Tickers = append(pair.Tickers, ticker)
+		}
+
+		sort.Strings(pair.Tickers)
+
+		sort.Slice(pair.Examples, func(i, j int) bool {
+			return pair.Examples[i].BuyTime.After(pair.Examples[j].BuyTime)
+		})
+
+		if len(pair.Examples) > maxCollusionExamples {
+			pair.Examples = pair.Examples[:maxCollusionExamples]
+		}
+
+		report.Pairs = append(report.Pairs, pair)
+	}
+
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		if report.Pairs[i].Flagged != report.Pairs[j].Flagged {
+			return report.Pairs[i].Flagged
+		}
+
+		return report.Pairs[i].Score > report.Pairs[j].Score
+	})
+
+	// Flagged pairs sort first and are kept even beyond the limit, since they are blocked
+	if limit := max(maxCollusionPairs, report.Flagged); len(report.Pairs) > limit {
+		report.Pairs = report.Pairs[:limit]
+	}
+
+	return report
+}
+
+// collusionRule rejects a trade of a bot in a flagged pair when its partner traded the same ticker in the opposite
+// direction within the collusion window. The rule only applies when COLLUSION_RULE is enabled.
+func (bw *BotWorker) collusionRule(transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "collusion", Passed: true}
+	if !bw.collusion.block || transaction.Bot == nil || ownerOf(transaction.Bot) != transaction.Bot {
+		return evaluation
+	}
+
+	if partner := bw.collusion.counterpart(transaction.Bot.ID, transaction.Ticker, transaction.Action, transaction.Time); partner != "" {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot %s %s within %v of an opposite trade by bot %s, the pair is flagged for coordinated trading",
+			transaction.Action, transaction.Ticker, bw.collusion.window, partner)
+	}
+
+	return evaluation
+}
+
+// recordCollusionTrade adds a trade executed on the portfolio at ref to the recent trades checked by the collusion rule.
+// Trades of shadow portfolios are ignored.
+func (bw *BotWorker) recordCollusionTrade(ref *firestore.DocumentRef, ticker, action string, at time.Time) {
+	if ownerOf(ref) != ref {
+		return
+	}
+
+	bw.collusion.recordTrade(ref.ID, ticker, action, at)
+}
+
+// GetCollusionReport returns the last collusion scan.
+// @Summary Get the collusion report
+// @Description Reports the pairs of bots that repeatedly traded the same illiquid ticker in opposite directions within a short window, from the last run of the collusion_scan job. Flagged pairs are blocked from such trades when COLLUSION_RULE is enabled
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Collusion report"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "No scan ran yet"
+// @Router /admin/collusion [get]
+func (bw *BotWorker) GetCollusionReport(c *gin.Context) {
+	bw.collusion.mu.Lock()
+	report := bw.collusion.report
+	bw.collusion.mu.Unlock()
+
+	if report == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: no collusion scan ran yet, run the collusion_scan job", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"collusion_report", report})
+}
@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// ComparedBot summarizes one side of a comparison
+type ComparedBot struct {
+	BotID        string  `json:"botId"`        // ID of the bot or shadow portfolio
+	DisplayName  string  `json:"displayName"`  // Public name, the ID if it has none
+	AccountValue float64 `json:"accountValue"` // Latest calculated account value
+	Return       float64 `json:"return"`       // Return over the compared days
+}
+
+// OverlappingHolding is a ticker held by both compared bots
+type OverlappingHolding struct {
+	Ticker         string  `json:"ticker"`         // Ticker symbol
+	NumShares      float64 `json:"numShares"`      // Shares held by the bot
+	OtherNumShares float64 `json:"otherNumShares"` // Shares held by the other bot
+	Weight         float64 `json:"weight"`         // Share of the bot's account value, 0 without a live price
+	OtherWeight    float64 `json:"otherWeight"`    // Share of the other bot's account value, 0 without a live price
+}
+
+// Comparison compares the performance and holdings of two bots
+type Comparison struct {
+	Bot                 *ComparedBot              `json:"bot"`                 // The bot being compared
+	Other               *ComparedBot              `json:"other"`               // The bot it is compared against
+	Curve               []*models.ComparisonPoint `json:"curve"`               // Account values of both bots on the days both were valued
+	RelativeReturn      float64                   `json:"relativeReturn"`      // Return of the bot minus the return of the other bot
+	Correlation         float64                   `json:"correlation"`         // Correlation of the bots' day-to-day returns
+	OverlappingHoldings []*OverlappingHolding     `json:"overlappingHoldings"` // Tickers held by both bots
+}
+
+// loadPublicBot loads the portfolio of a bot whose profile is public
+func (bw *BotWorker) loadPublicBot(id string) (*models.Portfolio, bool) {
+	if id == "" {
+		return nil, false
+	}
+
+	doc, err := bw.db.Collection(bw.collections.Bots).Doc(id).Get(context.Background())
+	if err != nil {
+		return nil, false
+	}
+
+	portfolio := &models.Portfolio{}
+	if doc.DataTo(portfolio) != nil || !portfolio.Profile.Public() {
+		return nil, false
+	}
+
+	return portfolio, true
+}
+
+// comparedValues returns the daily account values of a portfolio with its latest account value for today
+func comparedValues(portfolio *models.Portfolio, now time.Time) []*models.AccountValueHistory {
+	values := append(make([]*models.AccountValueHistory, 0, len(portfolio.HistoricalAccountValue)+1), portfolio.HistoricalAccountValue...)
+	return append(values, &models.AccountValueHistory{Date: now, Value: portfolio.AccountValue})
+}
+
+// overlappingHoldings returns the tickers held by both portfolios, sorted by ticker
+func (bw *BotWorker) overlappingHoldings(portfolio, other *models.Portfolio) []*OverlappingHolding {
+	overlap := make([]*OverlappingHolding, 0)
+	for ticker, holding := range portfolio.Holdings {
+		otherHolding, ok := other.Holdings[ticker]
+		if !ok || holding.NumShares == 0 || otherHolding.NumShares == 0 {
+			continue
+		}
+
+		entry := &OverlappingHolding{Ticker: ticker, NumShares: holding.NumShares, OtherNumShares: otherHolding.NumShares}
+		if price, ok := bw.latestPrices[ticker]; ok {
+			if portfolio.AccountValue > 0 {
+				entry.Weight = holding.NumShares * price / portfolio.AccountValue
+			}
+
+			if other.AccountValue > 0 {
+				entry.OtherWeight = otherHolding.NumShares * price / other.AccountValue
+			}
+		}
+
+		overlap = append(overlap, entry)
+	}
+
+	sort.Slice(overlap, func(i, j int) bool {
+		return overlap[i].Ticker < overlap[j].Ticker
+	})
+
+	return overlap
+}
+
+// ComparePortfolios compares the authenticated bot, or a public bot, against another public bot or a benchmark.
+// @Summary Compare two bots
+// @Description Aligns the daily account values of two bots and reports their relative return, the correlation of their daily returns and the tickers both hold. The other bot must have a public profile. With benchmark, the bot is compared against investing its inception value in the benchmark at its inception
+// @Tags portfolio
+// @Produce json
+// @Param bot query string false "Bot to compare, \"me\" (default) for the authenticated bot or the ID of a public bot"
+// @Param other query string false "ID of the public bot to compare against, required without benchmark"
+// @Param benchmark query string false "Ticker of a benchmark to compare against instead of a bot"
+// @Success 200 {object} DataPacket "Comparison"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Bot not found or not public, or unknown benchmark"
+// @Router /compare [get]
+func (bw *BotWorker) ComparePortfolios(c *gin.Context) {
+	portfolio, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	botID := ref.ID
+	if id := c.DefaultQuery("bot", "me"); id != "me" {
+		portfolio, ok = bw.loadPublicBot(id)
+		if !ok {
+			c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found or not public", false))
+			return
+		}
+
+		botID = id
+	}
+
+	now := time.Now()
+	if ticker, ok := c.GetQuery("benchmark"); ok {
+		bw.compareWithBenchmark(c, portfolio, botID, symbols.Canonical(ticker), now)
+		return
+	}
+
+	otherID := c.Query("other")
+	other, ok := bw.loadPublicBot(otherID)
+	if !ok {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: other bot not found or not public", false))
+		return
+	}
+
+	curve := models.AlignAccountValues(comparedValues(portfolio, now), comparedValues(other, now))
+
+	comparison := &Comparison{
+		Bot:                 &ComparedBot{BotID: botID, DisplayName: portfolio.Profile.PublicName(botID), AccountValue: portfolio.AccountValue},
+		Other:               &ComparedBot{BotID: otherID, DisplayName: other.Profile.PublicName(otherID), AccountValue: other.AccountValue},
+		Curve:               curve,
+		Correlation:         models.ReturnCorrelation(curve),
+		OverlappingHoldings: bw.overlappingHoldings(portfolio, other),
+	}
+
+	comparison.summarizeCurve()
+	c.JSON(200, &DataPacket{"comparison", comparison})
+}
+
+// summarizeCurve sets the returns of the compared sides to the returns of the last day of the curve
+func (comparison *Comparison) summarizeCurve() {
+	if len(comparison.Curve) == 0 {
+		return
+	}
+
+	last := comparison.Curve[len(comparison.Curve)-1]
+	comparison.Bot.Return = last.Return
+	comparison.Other.Return = last.OtherReturn
+	comparison.RelativeReturn = last.Return - last.OtherReturn
+}
+
+// compareWithBenchmark compares a portfolio against investing its inception value in a benchmark at its inception
+func (bw *BotWorker) compareWithBenchmark(c *gin.Context, portfolio *models.Portfolio, botID, ticker string, now time.Time) {
+	benchmark, ok := bw.benchmark(ticker)
+	if !ok {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: "+ticker+" is not a benchmark, see /benchmarks", false))
+		return
+	}
+
+	values := bw.benchmarkValues(benchmark, portfolio, now)
+	curve := models.AlignAccountValues(comparedValues(portfolio, now), values)
+
+	comparison := &Comparison{
+		Bot:                 &ComparedBot{BotID: botID, DisplayName: portfolio.Profile.PublicName(botID), AccountValue: portfolio.AccountValue},
+		Other:               &ComparedBot{BotID: benchmark.Ticker, DisplayName: benchmark.Name},
+		Curve:               curve,
+		Correlation:         models.ReturnCorrelation(curve),
+		OverlappingHoldings: make([]*OverlappingHolding, 0),
+	}
+
+	if len(values) > 0 {
+		comparison.Other.AccountValue = values[len(values)-1].Value
+	}
+
+	comparison.summarizeCurve()
+	c.JSON(200, &DataPacket{"comparison", comparison})
+}
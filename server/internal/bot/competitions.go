@@ -0,0 +1,347 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Errors returned when joining a competition
+var (
+	errRegistrationClosed = errors.New("error: registration for this competition is closed")
+	errInvalidEntryCode   = errors.New("error: invalid entry code")
+	errCompetitionFull    = errors.New("error: this competition is full")
+)
+
+// JoinRequestData represents a request to join a competition
+type JoinRequestData struct {
+	EntryCode   string `json:"entryCode"`   // Code given out by the organizer
+	DisplayName string `json:"displayName"` // Display name of the new bot
+}
+
+// CompetitionInfo describes a competition without its entry code
+type CompetitionInfo struct {
+	ID                 string    `json:"id"`                 // ID of the competition document
+	Name               string    `json:"name"`               // Display name
+	Description        string    `json:"description"`        // Description shown to participants
+	StartingCash       float64   `json:"startingCash"`       // Cash every bot starts with
+	RegistrationOpens  time.Time `json:"registrationOpens"`  // When bots may start joining
+	RegistrationCloses time.Time `json:"registrationCloses"` // When entries lock
+	Starts             time.Time `json:"starts"`             // When trading starts
+	Ends               time.Time `json:"ends"`               // When trading ends
+	RequiresEntryCode  bool      `json:"requiresEntryCode"`  // Whether an entry code is needed to join
+	MaxEntrants        int       `json:"maxEntrants"`        // Maximum number of bots, 0 for no limit
+	Entrants           int       `json:"entrants"`           // Number of bots that joined
+	RankingMetric      string    `json:"rankingMetric"`      // Official ranking metric of the leaderboard
+	Universe           string    `json:"universe"`           // Index whose constituents bots may buy, empty if every ticker can be bought
+}
+
+// JoinResult contains the credentials of a bot created by joining a competition
+type JoinResult struct {
+	BotID         string `json:"botId"`         // ID of the new bot
+	APIKey        string `json:"apiKey"`        // API key to authenticate the bot, only shown once
+	CompetitionID string `json:"competitionId"` // ID of the joined competition
+}
+
+// competitionInfo builds the public description of a competition
+func competitionInfo(id string, competition *models.Competition) *CompetitionInfo {
+	return &CompetitionInfo{
+		ID:                 id,
+		Name:               competition.Name,
+		Description:        competition.Description,
+		StartingCash:       competition.StartingCash,
+		RegistrationOpens:  competition.RegistrationOpens,
+		RegistrationCloses: competition.RegistrationCloses,
+		Starts:             competition.Starts,
+		Ends:               competition.Ends,
+		RequiresEntryCode:  competition.EntryCode != "",
+		MaxEntrants:        competition.MaxEntrants,
+		Entrants:           competition.Entrants,
+		RankingMetric:      competition.Metric(),
+		Universe:           competition.Universe,
+	}
+}
+
+// newAPIKey generates a random API key
+func newAPIKey() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loadCompetition loads the competition a bot belongs to, nil if it does not belong to one
+func (bw *BotWorker) loadCompetition(portfolio *models.Portfolio) (*models.Competition, error) {
+	if portfolio.Competition == nil {
+		return nil, nil
+	}
+
+	doc, err := portfolio.Competition.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	competition := &models.Competition{}
+	err = doc.DataTo(competition)
+	return competition, err
+}
+
+// GetOpenCompetitions lists the competitions whose registration is open.
+// @Summary List open competitions
+// @Description Retrieves every competition that bots can currently join
+// @Tags competitions
+// @Produce json
+// @Success 200 {object} DataPacket "Open competitions"
+// @Router /public/competitions [get]
+func (bw *BotWorker) GetOpenCompetitions(c *gin.Context) {
+	now := time.Now()
+	docs := bw.db.Collection(bw.collections.Competitions).Where("registrationCloses", ">", now).Documents(context.Background())
+	defer docs.Stop()
+
+	open := make([]*CompetitionInfo, 0)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve competitions", false))
+			return
+		}
+
+		competition := &models.Competition{}
+		if doc.DataTo(competition) != nil || !competition.RegistrationOpen(now) {
+			continue
+		}
+
+		open = append(open, competitionInfo(doc.Ref.ID, competition))
+	}
+
+	c.JSON(200, &DataPacket{"competitions", open})
+}
+
+// JoinCompetition creates a bot in a competition whose registration is open.
+// @Summary Join a competition
+// @Description Creates a new bot in the competition and returns its API key. Requires the entry code if the competition has one
+// @Tags competitions
+// @Accept json
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Param join body JoinRequestData true "Entry details"
+// @Success 200 {object} DataPacket "New bot credentials"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 403 {object} ResultData "Registration closed, invalid entry code or competition full"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Router /public/competitions/{id}/join [post]
+func (bw *BotWorker) JoinCompetition(c *gin.Context) {
+	request := &JoinRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	profile := &models.BotProfile{DisplayName: request.DisplayName, Links: make([]*models.ProfileLink, 0), UpdatedAt: time.Now()}
+	err = profile.Validate()
+	if err != nil || profile.DisplayName == "" {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: a displayName of at most 32 characters is required", false))
+		return
+	}
+
+	profile.Moderate(bw.blockedWords)
+
+	competitionRef := bw.db.Collection(bw.collections.Competitions).Doc(c.Param("id"))
+	botRef := bw.db.Collection(bw.collections.Bots).NewDoc()
+	apiKey := newAPIKey()
+
+	err = bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(competitionRef)
+		if err != nil {
+			return err
+		}
+
+		competition := &models.Competition{}
+		err = doc.DataTo(competition)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case !competition.RegistrationOpen(time.Now()):
+			return errRegistrationClosed
+		case subtle.ConstantTimeCompare([]byte(request.EntryCode), []byte(competition.EntryCode)) != 1:
+			return errInvalidEntryCode
+		case competition.Full():
+			return errCompetitionFull
+		}
+
+		portfolio := models.NewPortfolio(competition.StartingCash)
+		portfolio.AccountValue = competition.StartingCash
+		portfolio.HistoricalAccountValue = make([]*models.AccountValueHistory, 0)
+		portfolio.InceptionValue = competition.StartingCash
+		portfolio.InceptionDate = time.Now()
+		portfolio.APIKey = apiKey
+		portfolio.Competition = competitionRef
+		portfolio.CostBasisMethod = competition.CostBasis()
+		portfolio.Profile = profile
+		portfolio.SchemaVersion = bw.migrator.Latest(bw.collections.Bots)
+
+		err = tx.Create(botRef, portfolio)
+		if err != nil {
+			return err
+		}
+
+		return tx.Update(competitionRef, []firestore.Update{{Path: "entrants", Value: firestore.Increment(1)}})
+	})
+
+	switch {
+	case errors.Is(err, errRegistrationClosed), errors.Is(err, errInvalidEntryCode), errors.Is(err, errCompetitionFull):
+		c.AbortWithStatusJSON(403, NewResultPacket(err.Error(), false))
+		return
+	case err != nil:
+		log.Printf("error joining competition %s: %v\n", competitionRef.ID, err)
+		c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"joined", &JoinResult{
+		BotID:         botRef.ID,
+		APIKey:        apiKey,
+		CompetitionID: competitionRef.ID,
+	}})
+}
+
+// ResetPortfolio resets the authenticated bot's portfolio to the competition's starting cash.
+// Resets are only allowed while registration is open.
+// @Summary Reset portfolio
+// @Description Clears the holdings and history of the authenticated bot and restores its starting cash, while the competition's registration is open
+// @Tags portfolio
+// @Produce json
+// @Success 200 {object} ResultData "Portfolio reset"
+// @Failure 400 {object} ResultData "Bot is not in a competition"
+// @Failure 403 {object} ResultData "Registration closed"
+// @Failure 409 {object} ResultData "A transaction of the bot is still in progress"
+// @Router /reset [post]
+func (bw *BotWorker) ResetPortfolio(c *gin.Context) {
+	portfolio, ref, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	competition, err := bw.loadCompetition(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load competition", false))
+		return
+	}
+
+	if competition == nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: only bots in a competition can be reset", false))
+		return
+	}
+
+	if !competition.RegistrationOpen(time.Now()) {
+		c.AbortWithStatusJSON(403, NewResultPacket("error: portfolios cannot be reset after registration closes", false))
+		return
+	}
+
+	// A trade finishing after the reset would restore the holdings it cleared
+	unlock, ok := bw.lockTrades(c, ref)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	_, err = ref.Update(context.Background(), []firestore.Update{
+		{Path: "cash", Value: competition.StartingCash},
+		{Path: "accountValue", Value: competition.StartingCash},
+		{Path: "holdings", Value: make(map[string]*models.Holding)},
+		{Path: "closedPositions", Value: make([]*models.ClosedPosition, 0)},
+		{Path: "transactions", Value: make([]*firestore.DocumentRef, 0)},
+		{Path: "historicalAccountValue", Value: make([]*models.AccountValueHistory, 0)},
+		{Path: "inceptionValue", Value: competition.StartingCash},
+		{Path: "inceptionDate", Value: time.Now()},
+		{Path: "turnover", Value: firestore.Delete},
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to reset portfolio", false))
+		return
+	}
+
+	c.JSON(200, NewResultPacket("portfolio reset", true))
+}
+
+// CreateCompetition creates a competition.
+// @Summary Create a competition
+// @Description Creates a competition with a registration window, starting cash, cost basis method, optional entry code and universe restriction
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param competition body models.Competition true "Competition"
+// @Success 200 {object} DataPacket "Created competition"
+// @Failure 400 {object} ResultData "Invalid competition or unknown universe"
+// @Router /admin/competitions [post]
+func (bw *BotWorker) CreateCompetition(c *gin.Context) {
+	competition := &models.Competition{}
+	err := c.ShouldBindJSON(competition)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	competition.Entrants = 0
+	err = competition.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	if competition.Universe != "" && !bw.universes.known(competition.Universe) {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: unknown universe "+competition.Universe, false))
+		return
+	}
+
+	// The method is fixed when the competition is created, so restarting with another COST_BASIS_METHOD keeps it
+	competition.CostBasisMethod = competition.CostBasis()
+
+	ref, _, err := bw.db.Collection(bw.collections.Competitions).Add(context.Background(), competition)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to create competition", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"competition", gin.H{"id": ref.ID, "competition": competition}})
+}
+
+// GetCompetitions lists every competition including entry codes.
+// @Summary List all competitions
+// @Description Retrieves every competition with its entry code and number of entrants
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Competitions"
+// @Router /admin/competitions [get]
+func (bw *BotWorker) GetCompetitions(c *gin.Context) {
+	docs, err := bw.db.Collection(bw.collections.Competitions).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve competitions", false))
+		return
+	}
+
+	competitions := make(map[string]*models.Competition, len(docs))
+	for _, doc := range docs {
+		competition := &models.Competition{}
+		if doc.DataTo(competition) == nil {
+			competitions[doc.Ref.ID] = competition
+		}
+	}
+
+	c.JSON(200, &DataPacket{"competitions", competitions})
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// TradingRules are the competition rules checked before every trade
+type TradingRules struct {
+	MarketHours                 bool     `json:"marketHours"`                 // Whether trades outside every session of the ticker's exchange are rejected
+	OpeningAuction              bool     `json:"openingAuction"`              // Whether trades requested while the market is closed fill at the next session's opening price
+	EarningsBlackout            bool     `json:"earningsBlackout"`            // Whether the bot's earnings blackout window is enforced
+	EarningsBlackoutMinutes     int      `json:"earningsBlackoutMinutes"`     // Minutes around an earnings release the bot blocks its own trades
+	CircuitBreakerPercent       float64  `json:"circuitBreakerPercent"`       // Move from the previous close in percent that halts a ticker, 0 if disabled
+	MarketCircuitBreakerPercent float64  `json:"marketCircuitBreakerPercent"` // Average decline in percent that halts the market, 0 if disabled
+	CircuitBreakerHaltMinutes   int      `json:"circuitBreakerHaltMinutes"`   // How long circuit breaker halts last
+	LiquidityParticipation      float64  `json:"liquidityParticipation"`      // Percent of a ticker's average daily volume that can trade per price update, 0 if unlimited
+	DailyTurnoverCap            float64  `json:"dailyTurnoverCap"`            // Multiple of its equity a portfolio can trade per UTC day, 0 if unlimited
+	CollusionBlocking           bool     `json:"collusionBlocking"`           // Whether opposite trades of flagged pairs of bots are rejected
+	UntradeableTickers          []string `json:"untradeableTickers"`          // Benchmarks that cannot be bought, every other ticker can be traded
+	CustomRules                 []string `json:"customRules"`                 // Names of the custom rule hooks, checked in order before the other rules
+}
+
+// CompetitionConfig is a snapshot of the rules that apply to a bot, so bots can configure themselves
+type CompetitionConfig struct {
+	Competition     *CompetitionInfo              `json:"competition"`     // Competition the bot belongs to, nil outside a competition
+	StartingCash    float64                       `json:"startingCash"`    // Cash the portfolio started with
+	Currency        string                        `json:"currency"`        // Currency of record of the portfolio
+	RankingMetric   string                        `json:"rankingMetric"`   // Metric the leaderboard is ranked by
+	ScoringRules    []models.ScoringRule          `json:"scoringRules"`    // Bonuses and penalties applied to the composite score at settlement
+	CostBasisMethod models.CostBasisMethod        `json:"costBasisMethod"` // How sold shares are matched to purchases
+	CashPrecision   money.Policy                  `json:"cashPrecision"`   // Precision and rounding of cash amounts
+	Exchanges       []*market.Exchange            `json:"exchanges"`       // Trading sessions of every exchange with their fees, slippage and precision
+	Instruments     []*market.InstrumentPrecision `json:"instruments"`     // Tickers whose precision differs from their exchange's
+	Rules           *TradingRules                 `json:"rules"`           // Rules checked before every trade
+	Halts           []*Halt                       `json:"halts"`           // Active trading halts
+}
+
+// GetCompetitionConfig returns the rules that apply to the authenticated bot.
+// @Summary Get competition configuration
+// @Description Returns a snapshot of the rules affecting the authenticated bot: its competition, starting cash, ranking metric and scoring rules, the trading sessions with their fees, the trading rules, the tickers that cannot be traded and the active halts
+// @Tags competitions
+// @Produce json
+// @Success 200 {object} DataPacket "Competition configuration"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /competition [get]
+func (bw *BotWorker) GetCompetitionConfig(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	competition, err := bw.loadCompetition(portfolio)
+	if err != nil {
+		log.Printf("error loading competition of bot: %v\n", err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load competition", false))
+		return
+	}
+
+	_, startingCash := portfolio.Inception()
+	config := &CompetitionConfig{
+		StartingCash:    startingCash,
+		Currency:        portfolio.CurrencyOfRecord(),
+		RankingMetric:   models.MetricAccountValue,
+		ScoringRules:    make([]models.ScoringRule, 0),
+		CostBasisMethod: portfolio.CostBasis(),
+		CashPrecision:   money.Default(),
+		Exchanges:       bw.markets.Exchanges(),
+		Instruments:     bw.markets.Instruments(),
+		Rules: &TradingRules{
+			MarketHours:                 bw.marketHoursEnforced,
+			OpeningAuction:              bw.openingAuction,
+			EarningsBlackout:            bw.earningsBlackoutEnabled,
+			EarningsBlackoutMinutes:     portfolio.EarningsBlackoutMinutes,
+			CircuitBreakerPercent:       bw.halts.tickerLimit,
+			MarketCircuitBreakerPercent: bw.halts.marketLimit,
+			CircuitBreakerHaltMinutes:   int(bw.halts.duration.Minutes()),
+			LiquidityParticipation:      bw.participation,
+			DailyTurnoverCap:            bw.turnoverCap,
+			CollusionBlocking:           bw.collusion.block,
+			UntradeableTickers:          make([]string, 0),
+			CustomRules:                 bw.tradeHookNames(),
+		},
+		Halts: bw.halts.list(time.Now()),
+	}
+
+	for _, benchmark := range bw.benchmarks {
+		if !benchmark.Tradeable {
+			config.Rules.UntradeableTickers = append(config.Rules.UntradeableTickers, benchmark.Ticker)
+		}
+	}
+
+	if competition != nil {
+		config.Competition = competitionInfo(portfolio.Competition.ID, competition)
+		config.StartingCash = competition.StartingCash
+		config.RankingMetric = competition.Metric()
+		if competition.ScoringRules != nil {
+			config.ScoringRules = competition.ScoringRules
+		}
+	}
+
+	c.JSON(200, &DataPacket{"competition_config", config})
+}
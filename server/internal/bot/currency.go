@@ -0,0 +1,26 @@
+package bot
+
+import (
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// convertForDisplay converts the main amounts of a portfolio to a display currency using the cached
+// exchange rates. Returns false after aborting the request if the currency is invalid or its rate is unavailable.
+func (bw *BotWorker) convertForDisplay(c *gin.Context, portfolio *models.Portfolio, currency string) bool {
+	currency, err := money.ParseCurrency(currency)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return false
+	}
+
+	rate, err := bw.fx.Rate(portfolio.CurrencyOfRecord(), currency)
+	if err != nil {
+		c.AbortWithStatusJSON(503, NewResultPacket("error: exchange rate unavailable: "+err.Error(), false))
+		return false
+	}
+
+	portfolio.Display = portfolio.DisplayIn(currency, rate.Rate, rate.Time, rate.Stale)
+	return true
+}
@@ -0,0 +1,306 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olahol/melody"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/scheduler"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// activeBotWindow is how recently a bot must have made a request to count as active on the dashboard
+const activeBotWindow = time.Hour
+
+// tierNames names the download priority tiers of tickers
+var tierNames = map[services.Tier]string{
+	services.TierWatched: "watched",
+	services.TierOrdered: "ordered",
+	services.TierHeld:    "held",
+}
+
+// DashboardOverview summarizes the operational state of the server
+type DashboardOverview struct {
+	Time            time.Time             `json:"time"`            // When the overview was collected
+	Ready           bool                  `json:"ready"`           // Whether the server finished warming up
+	WatchedTickers  int                   `json:"watchedTickers"`  // Number of tickers on the watchlist
+	CachedTickers   int                   `json:"cachedTickers"`   // Number of tickers with history in the daily cache
+	CacheNewest     time.Time             `json:"cacheNewest"`     // Date of the newest row of the daily cache, zero if empty
+	CacheSavedAt    time.Time             `json:"cacheSavedAt"`    // When the daily cache was last saved to disk, zero if never
+	PricesUpdatedAt time.Time             `json:"pricesUpdatedAt"` // When the live prices were last updated, zero if never
+	PriceSource     string                `json:"priceSource"`     // Data source that provided the live prices
+	PricesError     string                `json:"pricesError"`     // Reason the last price update failed, empty if the prices are current
+	OldestPriceAge  float64               `json:"oldestPriceAge"`  // Age in seconds of the oldest live price
+	Sessions        int                   `json:"sessions"`        // Connected bot WebSocket sessions
+	PublicSessions  int                   `json:"publicSessions"`  // Connected public leaderboard WebSocket sessions
+	ActiveBots      int                   `json:"activeBots"`      // Bots that made a request within the last hour
+	Jobs            []scheduler.JobStatus `json:"jobs"`            // Status of every background job
+}
+
+// WatchedTicker is the state of a ticker on the watchlist
+type WatchedTicker struct {
+	Ticker         string    `json:"ticker"`         // Ticker symbol
+	State          string    `json:"state"`          // Onboarding state, "ready" for tickers that were cached on startup
+	Priority       string    `json:"priority"`       // Download priority: "held", "ordered" or "watched"
+	LastBar        time.Time `json:"lastBar"`        // Date of the newest cached bar, zero if the history is not cached
+	Price          float64   `json:"price"`          // Live price, 0 if the ticker has none yet
+	PriceUpdatedAt time.Time `json:"priceUpdatedAt"` // When the live price was fetched, zero if the ticker has none yet
+	PriceAge       float64   `json:"priceAge"`       // Age in seconds of the live price, 0 if the ticker has none yet
+	Halted         bool      `json:"halted"`         // Whether trading in the ticker is halted
+}
+
+// CacheStatus reports the size and freshness of the history caches
+type CacheStatus struct {
+	SavedAt time.Time              `json:"savedAt"` // When the daily cache was last saved to disk, zero if never
+	Memory  *models.HistoryMemory  `json:"memory"`  // Rows of the daily cache held in memory
+	Archive *services.ArchiveStats `json:"archive"` // Rows evicted from memory to yearly shards
+	Stale   []string               `json:"stale"`   // Cached tickers whose newest bar is older than the newest row, sorted
+}
+
+// SessionInfo describes a connected WebSocket session of a bot
+type SessionInfo struct {
+	BotID       string    `json:"botId"`       // ID of the bot the session belongs to
+	RemoteAddr  string    `json:"remoteAddr"`  // Network address of the client
+	UserAgent   string    `json:"userAgent"`   // User agent the client connected with
+	ConnectedAt time.Time `json:"connectedAt"` // When the session was opened
+}
+
+// BotActivity reports when a bot was last active
+type BotActivity struct {
+	BotID         string    `json:"botId"`         // ID of the bot document
+	DisplayName   string    `json:"displayName"`   // Display name of the bot's profile, empty if it has none
+	AccountValue  float64   `json:"accountValue"`  // Account value of the last valuation
+	LastRequest   time.Time `json:"lastRequest"`   // Time of the bot's most recent request since the server started, zero if none
+	Requests      int64     `json:"requests"`      // Requests made since the server started
+	Transactions  int64     `json:"transactions"`  // Transactions executed since the server started
+	Sessions      int       `json:"sessions"`      // Connected WebSocket sessions
+	LastHeartbeat time.Time `json:"lastHeartbeat"` // When the bot last sent a heartbeat, zero if it never did
+	Alive         bool      `json:"alive"`         // Whether the bot sent a heartbeat within the heartbeat timeout
+}
+
+// sessions returns the open WebSocket sessions of a hub, empty if the hub is closed
+func sessions(hub *melody.Melody) []*melody.Session {
+	open, err := hub.Sessions()
+	if err != nil {
+		return make([]*melody.Session, 0)
+	}
+
+	return open
+}
+
+// GetDashboard returns an overview of the server's operational state.
+// @Summary Get the operations dashboard overview
+// @Description Summarizes the watchlist, daily cache, live prices, WebSocket sessions, bot activity and background jobs. The other dashboard endpoints report the details
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Dashboard overview"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/dashboard [get]
+func (bw *BotWorker) GetDashboard(c *gin.Context) {
+	now := time.Now()
+	overview := &DashboardOverview{
+		Time:            now,
+		Ready:           bw.warmup.ready(),
+		WatchedTickers:  len(bw.watchlist.Tickers()),
+		CachedTickers:   len(bw.watchlist.Daily().Tickers),
+		CacheSavedAt:    bw.tiingo.CacheSavedAt(),
+		PricesUpdatedAt: bw.pricesTime,
+		PriceSource:     bw.priceSource,
+		Sessions:        len(sessions(bw.stream)),
+		PublicSessions:  len(sessions(bw.public.hub)),
+		Jobs:            bw.scheduler.Status(),
+	}
+
+	if rows := bw.watchlist.Daily().Rows; len(rows) > 0 {
+		overview.CacheNewest = rows[len(rows)-1].Date
+	}
+
+	if bw.pricesErr != nil {
+		overview.PricesError = string(failureReason(bw.pricesErr))
+	}
+
+	for _, fetched := range bw.priceTimes {
+		overview.OldestPriceAge = max(overview.OldestPriceAge, now.Sub(fetched).Seconds())
+	}
+
+	for _, usage := range bw.usage.summary().Bots {
+		if now.Sub(usage.LastRequest) <= activeBotWindow {
+			overview.ActiveBots++
+		}
+	}
+
+	c.JSON(200, &DataPacket{"dashboard", overview})
+}
+
+// GetDashboardWatchlist returns the state of every watched ticker.
+// @Summary Get the watchlist state
+// @Description Lists every watched ticker with its onboarding state, download priority, newest cached bar and the age of its live price
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Watched tickers sorted by symbol"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/dashboard/watchlist [get]
+func (bw *BotWorker) GetDashboardWatchlist(c *gin.Context) {
+	now := time.Now()
+	lastBars := bw.watchlist.Daily().LastDates()
+	prices, priceTimes := bw.latestPrices, bw.priceTimes
+
+	priorities := make(map[string]*services.TickerPriority)
+	for _, priority := range bw.tiingo.Priorities.Order(bw.watchlist.Tickers()) {
+		priorities[priority.Ticker] = priority
+	}
+
+	watchlist := make([]*WatchedTicker, 0, len(priorities))
+	for _, ticker := range bw.watchlist.Tickers() {
+		watched := &WatchedTicker{
+			Ticker:   ticker,
+			State:    TickerReady,
+			Priority: tierNames[priorities[ticker].Tier],
+			LastBar:  lastBars[ticker],
+			Halted:   bw.halts.active(ticker, now) != nil,
+		}
+
+		if status := bw.tickers.status(ticker); status != nil {
+			watched.State = status.State
+		}
+
+		if price, ok := prices[ticker]; ok {
+			watched.Price = price
+			watched.PriceUpdatedAt = priceTimes[ticker]
+			watched.PriceAge = now.Sub(watched.PriceUpdatedAt).Seconds()
+		}
+
+		watchlist = append(watchlist, watched)
+	}
+
+	c.JSON(200, &DataPacket{"dashboard_watchlist", watchlist})
+}
+
+// GetDashboardCache returns the size and freshness of the history caches.
+// @Summary Get the cache state
+// @Description Reports the memory of the daily cache, the archived shards on disk, when the cache was last saved and the cached tickers whose history is behind the newest row
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Cache status"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/dashboard/cache [get]
+func (bw *BotWorker) GetDashboardCache(c *gin.Context) {
+	archive, err := bw.tiingo.ArchiveStats()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error reading history archive: "+err.Error(), false))
+		return
+	}
+
+	status := &CacheStatus{
+		SavedAt: bw.tiingo.CacheSavedAt(),
+		Memory:  bw.watchlist.Daily().MemoryUsage(),
+		Archive: archive,
+		Stale:   make([]string, 0),
+	}
+
+	for ticker, lastBar := range bw.watchlist.Daily().LastDates() {
+		if lastBar.Before(status.Memory.Newest) {
+			status.Stale = append(status.Stale, ticker)
+		}
+	}
+
+	sort.Strings(status.Stale)
+	c.JSON(200, &DataPacket{"dashboard_cache", status})
+}
+
+// GetDashboardSessions returns the connected WebSocket sessions of bots.
+// @Summary Get connected WebSocket sessions
+// @Description Lists the WebSocket sessions of bots, oldest first. Public leaderboard sessions are anonymous and only counted by the overview
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Bot sessions"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/dashboard/sessions [get]
+func (bw *BotWorker) GetDashboardSessions(c *gin.Context) {
+	open := sessions(bw.stream)
+	infos := make([]*SessionInfo, 0, len(open))
+	for _, session := range open {
+		info := &SessionInfo{
+			BotID:      session.MustGet("bot").(string),
+			RemoteAddr: session.Request.RemoteAddr,
+			UserAgent:  session.Request.UserAgent(),
+		}
+
+		if connected, ok := session.Get("connected"); ok {
+			info.ConnectedAt = connected.(time.Time)
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+
+	c.JSON(200, &DataPacket{"dashboard_sessions", infos})
+}
+
+// GetDashboardBots returns when every bot was last active.
+// @Summary Get bot activity
+// @Description Lists every bot with its most recent request, request and transaction counts since the server started, connected WebSocket sessions and last heartbeat, most recently active first
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Bot activity"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/dashboard/bots [get]
+func (bw *BotWorker) GetDashboardBots(c *gin.Context) {
+	docs, err := bw.db.Collection(bw.collections.Bots).Select("profile", "accountValue", "lastHeartbeat").Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bots", false))
+		return
+	}
+
+	now := time.Now()
+	connected := make(map[string]int)
+	for _, session := range sessions(bw.stream) {
+		connected[session.MustGet("bot").(string)]++
+	}
+
+	usage := make(map[string]*BotUsage)
+	for _, botUsage := range bw.usage.summary().Bots {
+		usage[botUsage.BotID] = botUsage
+	}
+
+	activity := make([]*BotActivity, 0, len(docs))
+	for _, doc := range docs {
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil {
+			continue
+		}
+
+		bot := &BotActivity{
+			BotID:         doc.Ref.ID,
+			AccountValue:  portfolio.AccountValue,
+			Sessions:      connected[doc.Ref.ID],
+			LastHeartbeat: portfolio.LastHeartbeat,
+			Alive:         alive(portfolio.LastHeartbeat, now),
+		}
+		if portfolio.Profile != nil {
+			bot.DisplayName = portfolio.Profile.DisplayName
+		}
+
+		if botUsage, ok := usage[doc.Ref.ID]; ok {
+			bot.LastRequest = botUsage.LastRequest
+			bot.Requests = botUsage.Requests
+			bot.Transactions = botUsage.Transactions
+		}
+
+		activity = append(activity, bot)
+	}
+
+	sort.SliceStable(activity, func(i, j int) bool {
+		return activity[i].LastRequest.After(activity[j].LastRequest)
+	})
+
+	c.JSON(200, &DataPacket{"dashboard_bots", activity})
+}
@@ -0,0 +1,315 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/export"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// datasetFolder is where generated dataset archives are stored
+const datasetFolder = "./data/datasets"
+
+// Dataset job states
+const (
+	DatasetRunning = "running" // The archive is being generated
+	DatasetReady   = "ready"   // The archive can be downloaded
+	DatasetFailed  = "failed"  // Generation failed, see Error
+)
+
+// DatasetJob reports the progress of a dataset export
+type DatasetJob struct {
+	ID          string                  `json:"id"`          // ID of the dataset
+	Competition string                  `json:"competition"` // ID of the exported competition, empty for every bot
+	State       string                  `json:"state"`       // Generation state
+	Error       string                  `json:"error"`       // Reason generation failed, empty otherwise
+	Started     time.Time               `json:"started"`     // When generation started
+	Finished    time.Time               `json:"finished"`    // When generation finished, zero while running
+	Bytes       int64                   `json:"bytes"`       // Size of the archive
+	Manifest    *export.DatasetManifest `json:"manifest"`    // Contents of the archive, nil until it is ready
+}
+
+// datasetTracker tracks dataset exports since the server started
+type datasetTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*DatasetJob
+}
+
+// newDatasetTracker creates an empty dataset tracker
+func newDatasetTracker() *datasetTracker {
+	return &datasetTracker{jobs: make(map[string]*DatasetJob)}
+}
+
+// get returns a copy of a job, or nil if it is unknown
+func (dt *datasetTracker) get(id string) *DatasetJob {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	job, ok := dt.jobs[id]
+	if !ok {
+		return nil
+	}
+
+	copied := *job
+	return &copied
+}
+
+// finish records the outcome of a job
+func (dt *datasetTracker) finish(id string, manifest *export.DatasetManifest, bytes int64, err error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	job := dt.jobs[id]
+	job.Finished = time.Now()
+	if err != nil {
+		job.State = DatasetFailed
+		job.Error = err.Error()
+		return
+	}
+
+	job.State = DatasetReady
+	job.Manifest = manifest
+	job.Bytes = bytes
+}
+
+// datasetPath returns the path of the archive of a dataset
+func datasetPath(id string) string {
+	return filepath.Join(datasetFolder, "dataset-"+id+".zip")
+}
+
+// buildDataset collects the bots of a competition, or every bot, into a dataset.
+// Bots are anonymized by numbering them in document order.
+func (bw *BotWorker) buildDataset(id, competitionID string) (*export.Dataset, error) {
+	manifest := &export.DatasetManifest{ID: id, Competition: competitionID, CreatedAt: time.Now()}
+
+	query := bw.db.Collection(bw.collections.Bots).Query
+	if competitionID != "" {
+		competitionDoc, err := bw.db.Collection(bw.collections.Competitions).Doc(competitionID).Get(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving competition: %v", err)
+		}
+
+		competition := &models.Competition{}
+		err = competitionDoc.DataTo(competition)
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Start, manifest.End = competition.Starts, competition.Ends
+		query = query.Where("competition", "==", competitionDoc.Ref)
+	}
+
+	docs, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving bots: %v", err)
+	}
+
+	sort.Slice(docs, func(a, b int) bool {
+		return docs[a].Ref.ID < docs[b].Ref.ID
+	})
+
+	dataset := &export.Dataset{Manifest: manifest, Transactions: make([]export.DatasetTransaction, 0)}
+	histories := make(map[string][]*models.AccountValueHistory, len(docs))
+	tickers := make(map[string]bool)
+	first, last := time.Time{}, time.Time{}
+
+	for i, doc := range docs {
+		portfolio := &models.Portfolio{}
+		doc.DataTo(portfolio)
+
+		name := fmt.Sprintf("bot_%03d", i+1)
+		histories[name] = portfolio.HistoricalAccountValue
+
+		transactionDocs, err := bw.db.GetAll(context.Background(), portfolio.TransactionReferences)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving transactions: %v", err)
+		}
+
+		for _, transactionDoc := range transactionDocs {
+			if !transactionDoc.Exists() {
+				continue
+			}
+
+			transaction := &models.Transaction{}
+			transactionDoc.DataTo(transaction)
+			dataset.Transactions = append(dataset.Transactions, export.DatasetTransaction{Bot: name, Transaction: transaction})
+			tickers[transaction.Ticker] = true
+
+			if first.IsZero() || transaction.Time.Before(first) {
+				first = transaction.Time
+			}
+
+			if transaction.Time.After(last) {
+				last = transaction.Time
+			}
+		}
+
+		for ticker := range portfolio.Holdings {
+			tickers[ticker] = true
+		}
+	}
+
+	sort.SliceStable(dataset.Transactions, func(a, b int) bool {
+		return dataset.Transactions[a].Transaction.Time.Before(dataset.Transactions[b].Transaction.Time)
+	})
+
+	// Without competition dates the period spans the traded history
+	if manifest.Start.IsZero() {
+		manifest.Start = first
+	}
+
+	if manifest.End.IsZero() {
+		manifest.End = last
+	}
+
+	manifest.Bots = len(docs)
+	manifest.Transactions = len(dataset.Transactions)
+	manifest.Tickers = make([]string, 0, len(tickers))
+	for ticker := range tickers {
+		manifest.Tickers = append(manifest.Tickers, ticker)
+	}
+
+	sort.Strings(manifest.Tickers)
+
+	if !manifest.Start.IsZero() {
+		start := manifest.Start.UTC().Truncate(24 * time.Hour)
+		dataset.Prices, err = bw.tiingo.ArchivedRows(start, manifest.End)
+		if err != nil {
+			return nil, fmt.Errorf("error loading archived history: %v", err)
+		}
+
+		dataset.Prices = append(dataset.Prices, bw.watchlist.Daily().Range(start, manifest.End)...)
+	}
+
+	dataset.Standings = export.Standings(histories)
+
+	return dataset, nil
+}
+
+// generateDataset builds a dataset and writes its archive
+func (bw *BotWorker) generateDataset(id, competitionID string) {
+	manifest, bytes, err := bw.writeDataset(id, competitionID)
+	if err != nil {
+		log.Printf("error generating dataset %s: %v\n", id, err)
+	}
+
+	bw.datasets.finish(id, manifest, bytes, err)
+}
+
+// writeDataset builds a dataset and writes its archive, returning its manifest and size
+func (bw *BotWorker) writeDataset(id, competitionID string) (*export.DatasetManifest, int64, error) {
+	dataset, err := bw.buildDataset(id, competitionID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = os.MkdirAll(datasetFolder, 0777)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Write to a temporary file so a partial archive is never downloaded
+	partial := datasetPath(id) + ".partial"
+	file, err := os.Create(partial)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = export.WriteDataset(file, dataset)
+	closeErr := file.Close()
+	if err = errors.Join(err, closeErr); err != nil {
+		os.Remove(partial)
+		return nil, 0, err
+	}
+
+	info, err := os.Stat(partial)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return dataset.Manifest, info.Size(), os.Rename(partial, datasetPath(id))
+}
+
+// CreateDataset starts generating a dataset of a competition, or of every bot, in the background.
+// @Summary Export a training dataset
+// @Description Starts bundling the price history, anonymized transactions and daily standings of a competition into a zip archive
+// @Tags admin
+// @Produce json
+// @Param competition query string false "ID of the competition, every bot is exported if omitted"
+// @Success 202 {object} DataPacket "Started dataset job"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/datasets [post]
+func (bw *BotWorker) CreateDataset(c *gin.Context) {
+	job := &DatasetJob{
+		ID:          newID(),
+		Competition: c.Query("competition"),
+		State:       DatasetRunning,
+		Started:     time.Now(),
+	}
+
+	bw.datasets.mu.Lock()
+	bw.datasets.jobs[job.ID] = job
+	copied := *job
+	bw.datasets.mu.Unlock()
+
+	go bw.generateDataset(job.ID, job.Competition)
+
+	c.JSON(202, &DataPacket{"dataset_job", &copied})
+}
+
+// GetDataset returns the progress of a dataset export.
+// @Summary Get dataset export status
+// @Description Reports whether a dataset archive is still being generated, ready to download or failed
+// @Tags admin
+// @Produce json
+// @Param id path string true "Dataset ID"
+// @Success 200 {object} DataPacket "Dataset job"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Unknown dataset"
+// @Router /admin/datasets/{id} [get]
+func (bw *BotWorker) GetDataset(c *gin.Context) {
+	job := bw.datasets.get(c.Param("id"))
+	if job == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: dataset not found", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"dataset_job", job})
+}
+
+// DownloadDataset returns the archive of a generated dataset.
+// @Summary Download a dataset
+// @Description Downloads the zip archive of a dataset that is ready
+// @Tags admin
+// @Produce application/zip
+// @Param id path string true "Dataset ID"
+// @Success 200 {file} file "Dataset archive"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Unknown dataset"
+// @Failure 409 {object} ResultData "Dataset not ready"
+// @Router /admin/datasets/{id}/download [get]
+func (bw *BotWorker) DownloadDataset(c *gin.Context) {
+	id := c.Param("id")
+	if job := bw.datasets.get(id); job != nil && job.State != DatasetReady {
+		c.AbortWithStatusJSON(409, NewResultPacket("error: dataset is "+job.State, false))
+		return
+	}
+
+	// Archives from before a restart can still be downloaded
+	path := datasetPath(id)
+	if _, err := os.Stat(path); err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: dataset not found", false))
+		return
+	}
+
+	c.FileAttachment(path, filepath.Base(path))
+}
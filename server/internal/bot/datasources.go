@@ -0,0 +1,33 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// DataSourceStatus reports the health of every data source and where the live prices come from
+type DataSourceStatus struct {
+	PriceSource   string                   `json:"priceSource"`   // Data source that provided the latest prices
+	PricesUpdated time.Time                `json:"pricesUpdated"` // When the prices were last updated
+	PricesStale   bool                     `json:"pricesStale"`   // Whether the last price update failed
+	Sources       []*services.SourceHealth `json:"sources"`       // Health of every data source
+}
+
+// GetDataSources returns the health and quota usage of every data source.
+// @Summary Get data source health
+// @Description Reports consecutive failures, last success and hourly quota usage of each data source, and which source provides the live prices
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Data source health"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/datasources [get]
+func (bw *BotWorker) GetDataSources(c *gin.Context) {
+	c.JSON(200, &DataPacket{"datasources", &DataSourceStatus{
+		PriceSource:   bw.priceSource,
+		PricesUpdated: bw.pricesTime,
+		PricesStale:   bw.pricesErr != nil,
+		Sources:       bw.prices.Monitor().Health(),
+	}})
+}
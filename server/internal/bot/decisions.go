@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// ReplayResult compares a recorded order decision with the outcome of replaying its inputs
+type ReplayResult struct {
+	Decision      *models.OrderDecision   `json:"decision"`      // The recorded decision
+	ReplayedRules []models.RuleEvaluation `json:"replayedRules"` // Rule evaluations from the replay
+	Accepted      bool                    `json:"accepted"`      // Whether the replay accepted the transaction
+	Error         string                  `json:"error"`         // Reason the replay rejected the transaction
+	CashAfter     float64                 `json:"cashAfter"`     // Cash balance after the replayed transaction
+	HoldingAfter  *models.Holding         `json:"holdingAfter"`  // Holding of the ticker after the replayed transaction
+	Matches       bool                    `json:"matches"`       // Whether the replay reached the recorded outcome
+}
+
+// newOrderDecision creates a decision record for a transaction request, snapshotting
+// the parts of the portfolio the decision depends on before anything is modified
+func (bw *BotWorker) newOrderDecision(
+	portfolio *models.Portfolio,
+	request *TransactionRequestData,
+	ref *firestore.DocumentRef,
+) (*firestore.DocumentRef, *models.OrderDecision) {
+	decision := &models.OrderDecision{
+		Time:            time.Now(),
+		Bot:             ref,
+		Action:          request.Action,
+		Ticker:          request.Ticker,
+		NumShares:       request.NumShares,
+		PriceTime:       bw.pricesTime,
+		PriceSource:     bw.priceSource,
+		CashBefore:      portfolio.Cash,
+		CostBasisMethod: portfolio.CostBasisMethod,
+
+		LimitPrice:     request.LimitPrice,
+		ReferencePrice: request.ReferencePrice,
+		MaxSlippageBps: request.MaxSlippageBps,
+	}
+
+	if holding, ok := portfolio.Holdings[request.Ticker]; ok {
+		decision.HoldingBefore = holding.Copy()
+	}
+
+	return bw.store.NewOrderDecision(), decision
+}
+
+// saveOrderDecision stores the outcome of a decision.
+// Failing to store a decision is logged but does not fail the request.
+func (bw *BotWorker) saveOrderDecision(ref *firestore.DocumentRef, decision *models.OrderDecision, err error) {
+	decision.Accepted = err == nil
+	if err != nil {
+		decision.Error = err.Error()
+	}
+
+	err = bw.store.SaveOrderDecision(context.Background(), ref, decision)
+	if err != nil {
+		log.Printf("error saving order decision %s: %v\n", ref.ID, err)
+	}
+}
+
+// ReplayOrderDecision replays a recorded order decision against its recorded inputs.
+// @Summary Replay an order decision
+// @Description Re-evaluates the trading rules for a recorded transaction request using the recorded price, time and portfolio state
+// @Tags admin
+// @Produce json
+// @Param id path string true "Order decision ID"
+// @Success 200 {object} DataPacket "Replay result"
+// @Failure 404 {object} ResultData "Decision not found"
+// @Router /admin/decisions/{id}/replay [get]
+func (bw *BotWorker) ReplayOrderDecision(c *gin.Context) {
+	doc, err := bw.db.Collection(bw.collections.OrderDecisions).Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: order decision not found", false))
+		return
+	}
+
+	decision := &models.OrderDecision{}
+	err = doc.DataTo(decision)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to parse order decision", false))
+		return
+	}
+
+	result := &ReplayResult{Decision: decision}
+
+	// A request rejected before evaluation has nothing further to replay
+	if len(decision.Rules) > 0 && decision.Rules[0].Rule == "price_available" {
+		result.ReplayedRules = decision.Rules
+		result.Error = decision.Error
+		result.Matches = !decision.Accepted
+		c.JSON(200, &DataPacket{"replay", result})
+		return
+	}
+
+	portfolio := decision.ReplayPortfolio()
+	transaction := decision.ReplayTransaction()
+
+	// Competition rules depend on external state such as the earnings calendar,
+	// so their recorded outcomes are replayed as they were
+	result.ReplayedRules = append(decision.PriceRules(), portfolio.Evaluate(transaction)...)
+	err = models.FirstFailure(decision.CompetitionRules)
+	if err == nil {
+		err = models.FirstFailure(decision.PriceRules())
+	}
+
+	if err == nil {
+		err = portfolio.Execute(transaction)
+	}
+
+	result.Accepted = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	result.CashAfter = portfolio.Cash
+	result.HoldingAfter = portfolio.Holdings[decision.Ticker]
+	result.Matches = result.Accepted == decision.Accepted && result.Error == decision.Error
+
+	c.JSON(200, &DataPacket{"replay", result})
+}
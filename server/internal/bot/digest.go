@@ -0,0 +1,303 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// competitionDigests is the subcollection of a competition that stores its daily digests by date
+const competitionDigests = "digests"
+
+// digestListLimit is the number of recent digests returned for a competition
+const digestListLimit = 30
+
+// digestKind is the email template of competition digests
+const digestKind = "competition_digest"
+
+// digestDelivery configures where daily competition digests are delivered besides Firestore
+type digestDelivery struct {
+	recipients []string // Addresses digests are emailed to, from DIGEST_EMAILS
+	webhook    string   // URL digests are posted to as JSON, from DIGEST_WEBHOOK_URL
+}
+
+// parseDigestDelivery parses the comma separated addresses of DIGEST_EMAILS and the URL of DIGEST_WEBHOOK_URL.
+// Digests are only stored in Firestore if neither is set.
+func parseDigestDelivery() (*digestDelivery, error) {
+	delivery := &digestDelivery{recipients: make([]string, 0)}
+	for _, address := range strings.Split(os.Getenv("DIGEST_EMAILS"), ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		if _, err := mail.ParseAddress(address); err != nil {
+			return nil, fmt.Errorf("invalid DIGEST_EMAILS address %q: %v", address, err)
+		}
+
+		delivery.recipients = append(delivery.recipients, address)
+	}
+
+	if env := os.Getenv("DIGEST_WEBHOOK_URL"); env != "" {
+		parsed, err := url.Parse(env)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid DIGEST_WEBHOOK_URL, must be an http or https URL: %s", env)
+		}
+
+		delivery.webhook = env
+	}
+
+	return delivery, nil
+}
+
+// sendDigests produces the digest of the previous UTC day for every competition that was trading,
+// stores it with the competition and delivers it to the organizers. Rerunning the job for the same
+// day replaces its stored digests.
+func (bw *BotWorker) sendDigests() error {
+	now := time.Now()
+	day := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	end := day.AddDate(0, 0, 1)
+
+	docs, err := bw.db.Collection(bw.collections.Competitions).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving competitions: %v", err)
+	}
+
+	var transactions []*models.Transaction
+	var decisions []*models.OrderDecision
+	errs := make([]error, 0)
+	for _, doc := range docs {
+		competition := &models.Competition{}
+		if doc.DataTo(competition) != nil || !competition.Starts.Before(end) || (!competition.Ends.IsZero() && !competition.Ends.After(day)) {
+			continue
+		}
+
+		// The trades and requests of the day are shared by every competition, so they are only loaded once
+		if transactions == nil {
+			transactions, decisions, err = bw.loadDigestDay(day, end)
+			if err != nil {
+				return err
+			}
+		}
+
+		digest, err := bw.buildDigest(doc.Ref, competition, day, transactions, decisions, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error building digest of competition %s: %v", doc.Ref.ID, err))
+			continue
+		}
+
+		_, err = doc.Ref.Collection(competitionDigests).Doc(day.Format(time.DateOnly)).Set(context.Background(), digest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error saving digest of competition %s: %v", doc.Ref.ID, err))
+			continue
+		}
+
+		log.Printf("produced digest of competition %s for %s: %d trades, %d violations\n", doc.Ref.ID, day.Format(time.DateOnly), digest.Trades, digest.Violations)
+		if err := bw.deliverDigest(digest); err != nil {
+			errs = append(errs, fmt.Errorf("error delivering digest of competition %s: %v", doc.Ref.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadDigestDay loads the transactions and order decisions of a day
+func (bw *BotWorker) loadDigestDay(day, end time.Time) ([]*models.Transaction, []*models.OrderDecision, error) {
+	transactionDocs, err := bw.db.Collection(bw.collections.Transactions).Where("time", ">=", day).Where("time", "<", end).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving transactions: %v", err)
+	}
+
+	transactions := make([]*models.Transaction, 0, len(transactionDocs))
+	for _, doc := range transactionDocs {
+		transaction := &models.Transaction{}
+		if doc.DataTo(transaction) == nil && transaction.Bot != nil {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	decisionDocs, err := bw.db.Collection(bw.collections.OrderDecisions).Where("time", ">=", day).Where("time", "<", end).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving order decisions: %v", err)
+	}
+
+	decisions := make([]*models.OrderDecision, 0, len(decisionDocs))
+	for _, doc := range decisionDocs {
+		decision := &models.OrderDecision{}
+		if doc.DataTo(decision) == nil && decision.Bot != nil {
+			decisions = append(decisions, decision)
+		}
+	}
+
+	return transactions, decisions, nil
+}
+
+// buildDigest summarizes the trades and rejected requests of a competition's bots and their shadow portfolios over a day.
+// The most improved bot is the one with the highest return from the valuation before the day to the last one of the day.
+func (bw *BotWorker) buildDigest(
+	ref *firestore.DocumentRef,
+	competition *models.Competition,
+	day time.Time,
+	transactions []*models.Transaction,
+	decisions []*models.OrderDecision,
+	now time.Time,
+) (*models.CompetitionDigest, error) {
+	docs, err := bw.db.Collection(bw.collections.Bots).Where("competition", "==", ref).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	end := day.AddDate(0, 0, 1)
+	digest := &models.CompetitionDigest{
+		CompetitionID:    ref.ID,
+		Name:             competition.Name,
+		Day:              day,
+		Bots:             len(docs),
+		Tickers:          make([]*models.TickerVolume, 0),
+		ViolationsByRule: make(map[string]int),
+		CreatedAt:        now,
+	}
+
+	bots := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		bots[doc.Ref.ID] = true
+
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil {
+			continue
+		}
+
+		period := portfolio.ReturnBetween(day, end)
+		if period == nil || (digest.MostImproved != nil && period.Return <= digest.MostImproved.Return) {
+			continue
+		}
+
+		digest.MostImproved = &models.DigestBot{BotID: doc.Ref.ID, Name: portfolio.Profile.PublicName(doc.Ref.ID), Return: period.Return}
+	}
+
+	traded := make([]*models.Transaction, 0)
+	active := make(map[string]bool)
+	for _, transaction := range transactions {
+		if id := ownerOf(transaction.Bot).ID; bots[id] {
+			traded = append(traded, transaction)
+			active[id] = true
+		}
+	}
+
+	digest.AddTransactions(traded)
+	digest.ActiveBots = len(active)
+
+	for _, decision := range decisions {
+		if bots[ownerOf(decision.Bot).ID] {
+			digest.AddViolation(decision)
+		}
+	}
+
+	return digest, nil
+}
+
+// deliverDigest emails a digest to every address of DIGEST_EMAILS and posts it to DIGEST_WEBHOOK_URL
+func (bw *BotWorker) deliverDigest(digest *models.CompetitionDigest) error {
+	errs := make([]error, 0)
+	if bw.mailer != nil && len(bw.digests.recipients) > 0 {
+		email, err := renderEmail(digestKind, &notificationEmail{Data: digest})
+		if err != nil {
+			return err
+		}
+
+		for _, recipient := range bw.digests.recipients {
+			ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+			email.To = recipient
+			if err := bw.mailer.Send(ctx, email); err != nil {
+				errs = append(errs, fmt.Errorf("error emailing %s: %v", recipient, err))
+			}
+
+			cancel()
+		}
+	}
+
+	if bw.digests.webhook != "" {
+		if err := postPacket(bw.digests.webhook, &DataPacket{digestKind, digest}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// postPacket posts a data packet as JSON to a webhook, which must respond with a 2xx status
+func postPacket(webhook string, packet *DataPacket) error {
+	body, err := json.Marshal(packet)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error posting to webhook: %v", err)
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// GetCompetitionDigests returns the most recent daily digests of a competition.
+// @Summary Get competition digests
+// @Description Retrieves the daily digests of a competition, newest first. Each digest summarizes a UTC day: the number of trades, the volume by ticker, the most improved bot and the requests rejected by trading rules
+// @Tags admin
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Success 200 {object} DataPacket "Digests"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/competitions/{id}/digests [get]
+func (bw *BotWorker) GetCompetitionDigests(c *gin.Context) {
+	ref := bw.db.Collection(bw.collections.Competitions).Doc(c.Param("id"))
+	if _, err := ref.Get(context.Background()); err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+		return
+	}
+
+	docs, err := ref.Collection(competitionDigests).OrderBy("day", firestore.Desc).Limit(digestListLimit).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve digests", false))
+		return
+	}
+
+	digests := make([]*models.CompetitionDigest, 0, len(docs))
+	for _, doc := range docs {
+		digest := &models.CompetitionDigest{}
+		if doc.DataTo(digest) == nil {
+			digests = append(digests, digest)
+		}
+	}
+
+	c.JSON(200, &DataPacket{"competition_digests", digests})
+}
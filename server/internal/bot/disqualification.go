@@ -0,0 +1,334 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// DisqualificationRequestData represents an admin request to disqualify a bot
+type DisqualificationRequestData struct {
+	Reason      string    `json:"reason" binding:"required,max=2000"` // Rule the bot broke, shown to the bot
+	EffectiveAt time.Time `json:"effectiveAt"`                        // When the disqualification takes effect, now if zero. Cannot be in the future
+}
+
+// AppealRequestData represents a bot's appeal of its disqualification
+type AppealRequestData struct {
+	Statement string `json:"statement" binding:"required,max=5000"` // Why the bot should be reinstated
+}
+
+// DecisionRequestData represents an admin decision on a disqualification
+type DecisionRequestData struct {
+	Decision string `json:"decision" binding:"required,max=2000"` // Reason for the decision, shown to the bot
+}
+
+// RequireEligible rejects requests of disqualified bots. It is applied to the routes that trade or
+// change a portfolio, so a disqualified bot can still read its data and appeal.
+func (bw *BotWorker) RequireEligible(c *gin.Context) {
+	portfolio, _, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	if portfolio.Disqualified() {
+		c.AbortWithStatusJSON(403, NewResultPacket(fmt.Sprintf("error: the bot is disqualified: %s", portfolio.Disqualification.Reason), false))
+	}
+}
+
+// disqualificationRule rejects the trades of disqualified bots, including fills of orders placed before
+func disqualificationRule(portfolio *models.Portfolio) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "not_disqualified", Passed: true}
+	if portfolio.Disqualified() {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("the bot is disqualified: %s", portfolio.Disqualification.Reason)
+	}
+
+	return evaluation
+}
+
+// updateDisqualification applies a change to the disqualification of a bot in a Firestore transaction.
+// Returns the updated disqualification, and an error if the bot does not exist, or from change.
+func (bw *BotWorker) updateDisqualification(ref *firestore.DocumentRef, change func(*models.Portfolio) (*models.Disqualification, error)) (*models.Disqualification, *models.Portfolio, error) {
+	var disqualification *models.Disqualification
+	portfolio := &models.Portfolio{}
+
+	err := bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		err = doc.DataTo(portfolio)
+		if err != nil {
+			return err
+		}
+
+		disqualification, err = change(portfolio)
+		if err != nil {
+			return err
+		}
+
+		return tx.Update(ref, []firestore.Update{{Path: "disqualification", Value: disqualification}})
+	})
+
+	return disqualification, portfolio, err
+}
+
+// loadPathBot returns the reference of the bot in the path, aborting with 404 if it does not exist
+func (bw *BotWorker) loadPathBot(c *gin.Context) (*firestore.DocumentRef, bool) {
+	ref := bw.db.Collection(bw.collections.Bots).Doc(c.Param("id"))
+	if _, err := ref.Get(context.Background()); err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found", false))
+		return nil, false
+	}
+
+	return ref, true
+}
+
+// DisqualifyBot disqualifies a bot and freezes its portfolio.
+// @Summary Disqualify a bot
+// @Description Disqualifies a bot for breaking the rules. Its portfolio at the effective time is recorded, its open orders are cancelled and its protections stop, it can no longer trade and it is left out of the leaderboards and scoring. The bot document and its history are kept, so the bot can appeal and be reinstated
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Bot ID"
+// @Param disqualification body DisqualificationRequestData true "Disqualification"
+// @Success 200 {object} DataPacket "Disqualification"
+// @Failure 400 {object} ResultData "Invalid request or the bot is already disqualified"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /admin/bots/{id}/disqualify [post]
+func (bw *BotWorker) DisqualifyBot(c *gin.Context) {
+	request := &DisqualificationRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	now := time.Now()
+	effectiveAt := request.EffectiveAt
+	if effectiveAt.IsZero() {
+		effectiveAt = now
+	}
+
+	if effectiveAt.After(now) {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: effectiveAt cannot be in the future", false))
+		return
+	}
+
+	ref, ok := bw.loadPathBot(c)
+	if !ok {
+		return
+	}
+
+	disqualification, portfolio, err := bw.updateDisqualification(ref, func(portfolio *models.Portfolio) (*models.Disqualification, error) {
+		if portfolio.Shadow {
+			return nil, fmt.Errorf("shadow portfolios cannot be disqualified")
+		}
+
+		if portfolio.Disqualified() {
+			return nil, fmt.Errorf("the bot is already %s", portfolio.Disqualification.Status)
+		}
+
+		return models.NewDisqualification(portfolio, strings.TrimSpace(request.Reason), effectiveAt, now), nil
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	cancelled := bw.freezeBot(ref, portfolio, now)
+	bw.windows.invalidate(portfolio.Competition)
+	bw.publish(ref.ID, &DataPacket{"disqualification", disqualification})
+
+	bw.audit(c, "bot.disqualify", fmt.Sprintf("disqualified bot %s effective %s and cancelled %d order groups: %s",
+		ref.ID, effectiveAt.Format(time.RFC3339), cancelled, disqualification.Reason), disqualification)
+	c.JSON(200, &DataPacket{"disqualification", disqualification})
+}
+
+// freezeBot cancels the active order groups of a bot and its shadow portfolios and stops watching the
+// protections of its holdings. The stored protections are kept for a reinstatement. Returns the cancelled groups.
+func (bw *BotWorker) freezeBot(ref *firestore.DocumentRef, portfolio *models.Portfolio, now time.Time) int {
+	for ticker := range portfolio.Holdings {
+		bw.protections.remove(ref, ticker, nil)
+	}
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	cancelled := 0
+	for _, group := range bw.orders.ActiveGroups() {
+		if ownerOf(group.Bot).ID != ref.ID {
+			continue
+		}
+
+		group.Cancel("bot disqualified", now)
+		bw.orders.Reindex(group)
+		if err := bw.saveOrderGroup(group); err != nil {
+			log.Printf("error saving order group %s: %v\n", group.ID, err)
+		}
+
+		cancelled++
+		bw.publish(group.Bot.ID, &DataPacket{"order_group_update", group})
+	}
+
+	return cancelled
+}
+
+// ReinstateBot lifts the disqualification of a bot.
+// @Summary Reinstate a disqualified bot
+// @Description Reinstates a disqualified bot, whether or not it appealed and even after its appeal was rejected. The bot can trade again, its protections are restored and it returns to the leaderboards. Orders cancelled by the disqualification are not restored
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Bot ID"
+// @Param decision body DecisionRequestData true "Decision"
+// @Success 200 {object} DataPacket "Disqualification"
+// @Failure 400 {object} ResultData "Invalid request or the bot is not disqualified"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /admin/bots/{id}/reinstate [post]
+func (bw *BotWorker) ReinstateBot(c *gin.Context) {
+	request := &DecisionRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	ref, ok := bw.loadPathBot(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	disqualification, portfolio, err := bw.updateDisqualification(ref, func(portfolio *models.Portfolio) (*models.Disqualification, error) {
+		if portfolio.Disqualification == nil {
+			return nil, fmt.Errorf("the bot is not disqualified")
+		}
+
+		return portfolio.Disqualification, portfolio.Disqualification.Reinstate(strings.TrimSpace(request.Decision), now)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	for ticker, holding := range portfolio.Holdings {
+		if holding.Protection != nil {
+			bw.protections.set(&protectedPosition{ref: ref, ticker: ticker, protection: holding.Protection})
+		}
+	}
+
+	bw.windows.invalidate(portfolio.Competition)
+	bw.publish(ref.ID, &DataPacket{"disqualification", disqualification})
+
+	bw.audit(c, "bot.reinstate", fmt.Sprintf("reinstated bot %s: %s", ref.ID, disqualification.Decision), disqualification)
+	c.JSON(200, &DataPacket{"disqualification", disqualification})
+}
+
+// UpholdDisqualification rejects the appeal of a disqualified bot.
+// @Summary Reject a disqualification appeal
+// @Description Rejects the appeal of a disqualified bot, which makes the disqualification final. An admin can still reinstate the bot later
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Bot ID"
+// @Param decision body DecisionRequestData true "Decision"
+// @Success 200 {object} DataPacket "Disqualification"
+// @Failure 400 {object} ResultData "Invalid request or the bot has no pending appeal"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /admin/bots/{id}/uphold [post]
+func (bw *BotWorker) UpholdDisqualification(c *gin.Context) {
+	request := &DecisionRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	ref, ok := bw.loadPathBot(c)
+	if !ok {
+		return
+	}
+
+	disqualification, _, err := bw.updateDisqualification(ref, func(portfolio *models.Portfolio) (*models.Disqualification, error) {
+		if portfolio.Disqualification == nil {
+			return nil, fmt.Errorf("the bot is not disqualified")
+		}
+
+		return portfolio.Disqualification, portfolio.Disqualification.Uphold(strings.TrimSpace(request.Decision), time.Now())
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	bw.publish(ref.ID, &DataPacket{"disqualification", disqualification})
+
+	bw.audit(c, "bot.uphold_disqualification", fmt.Sprintf("rejected the appeal of bot %s: %s", ref.ID, disqualification.Decision), disqualification)
+	c.JSON(200, &DataPacket{"disqualification", disqualification})
+}
+
+// GetDisqualification returns the disqualification of the authenticated bot.
+// @Summary Get disqualification
+// @Description Retrieves the disqualification of the authenticated bot with its reason, frozen portfolio and the state of its appeal. The payload is null if the bot was never disqualified
+// @Tags disqualification
+// @Produce json
+// @Success 200 {object} DataPacket "Disqualification"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /disqualification [get]
+func (bw *BotWorker) GetDisqualification(c *gin.Context) {
+	portfolio, _, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, &DataPacket{"disqualification", portfolio.Disqualification})
+}
+
+// AppealDisqualification files an appeal against the disqualification of the authenticated bot.
+// @Summary Appeal a disqualification
+// @Description Appeals the disqualification of the authenticated bot with a statement for the organizers. A bot can appeal once, and stays disqualified until an admin decides
+// @Tags disqualification
+// @Accept json
+// @Produce json
+// @Param appeal body AppealRequestData true "Appeal"
+// @Success 200 {object} DataPacket "Disqualification"
+// @Failure 400 {object} ResultData "Invalid request, or the bot is not disqualified or already appealed"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /disqualification/appeal [post]
+func (bw *BotWorker) AppealDisqualification(c *gin.Context) {
+	request := &AppealRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	disqualification, _, err := bw.updateDisqualification(ref, func(portfolio *models.Portfolio) (*models.Disqualification, error) {
+		if portfolio.Disqualification == nil {
+			return nil, fmt.Errorf("the bot is not disqualified")
+		}
+
+		return portfolio.Disqualification, portfolio.Disqualification.FileAppeal(strings.TrimSpace(request.Statement), time.Now())
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	bw.audit(c, "bot.appeal", fmt.Sprintf("bot %s appealed its disqualification", ref.ID), disqualification)
+	c.JSON(200, &DataPacket{"disqualification", disqualification})
+}
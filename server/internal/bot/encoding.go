@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// negotiateFormat picks the media type of a response from the Accept header: JSON, MessagePack or,
+// if the response has a protobuf schema, protobuf. JSON is served when nothing else is accepted.
+func negotiateFormat(c *gin.Context, protobuf bool) string {
+	offered := []string{binding.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK}
+	if protobuf {
+		offered = append(offered, binding.MIMEPROTOBUF)
+	}
+
+	switch c.NegotiateFormat(offered...) {
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		return binding.MIMEMSGPACK2
+	case binding.MIMEPROTOBUF:
+		return binding.MIMEPROTOBUF
+	default:
+		return binding.MIMEJSON
+	}
+}
+
+// renderStockData writes a stock data packet in the format negotiated from the Accept header
+func renderStockData(c *gin.Context, packetType string, history *models.PackedHistory) {
+	c.Writer.Header().Add("Vary", "Accept")
+	switch negotiateFormat(c, true) {
+	case binding.MIMEMSGPACK2:
+		c.Data(200, binding.MIMEMSGPACK2, (&DataPacket{packetType, history}).MsgPack())
+	case binding.MIMEPROTOBUF:
+		c.Data(200, binding.MIMEPROTOBUF, history.MarshalProto(packetType))
+	default:
+		c.JSON(200, &DataPacket{packetType, history})
+	}
+}
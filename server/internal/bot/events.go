@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// eventDeliveryBatch is the largest number of outbox entries published at once
+const eventDeliveryBatch = 500
+
+// TransactionEventData is the payload of a transaction.executed event
+type TransactionEventData struct {
+	*TransactionConfirmation
+	Tag          string `json:"tag,omitempty"`          // Strategy tag of the transaction
+	OrderGroupID string `json:"orderGroupId,omitempty"` // ID of the order group, empty for direct transactions
+	OrderID      string `json:"orderId,omitempty"`      // ID of the filled order, empty for direct transactions
+}
+
+// ValuationEventData is the payload of a portfolio.valued event
+type ValuationEventData struct {
+	AccountValue  float64 `json:"accountValue"`  // Account value at the latest prices
+	PreviousValue float64 `json:"previousValue"` // Account value before the valuation
+	Cash          float64 `json:"cash"`          // Available cash
+	Currency      string  `json:"currency"`      // Currency of every amount
+}
+
+// EventDeliveryStats reports the delivery of events to the Pub/Sub topic
+type EventDeliveryStats struct {
+	Topic         string    `json:"topic"`         // Topic the events are published to
+	Published     int       `json:"published"`     // Events published since the server started
+	Failures      int       `json:"failures"`      // Failed delivery attempts since the server started
+	LastPublished time.Time `json:"lastPublished"` // When events were last published, zero if never
+	LastError     string    `json:"lastError"`     // Error of the last failed attempt, empty if the last attempt succeeded
+}
+
+// eventTracker counts delivered events and makes sure only one delivery runs at a time
+type eventTracker struct {
+	deliverMu sync.Mutex // Held while the outbox is being delivered
+	mu        sync.Mutex // Protects stats
+	stats     EventDeliveryStats
+}
+
+// newEventTracker creates a tracker for the events published to a topic
+func newEventTracker(topic string) *eventTracker {
+	return &eventTracker{stats: EventDeliveryStats{Topic: topic}}
+}
+
+// summary returns a copy of the delivery statistics, nil if events are disabled
+func (et *eventTracker) summary() *EventDeliveryStats {
+	if et == nil {
+		return nil
+	}
+
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	stats := et.stats
+	return &stats
+}
+
+// record updates the statistics after a delivery attempt
+func (et *eventTracker) record(published int, err error) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	et.stats.Published += published
+	if published > 0 {
+		et.stats.LastPublished = time.Now()
+	}
+
+	if err != nil {
+		et.stats.Failures++
+		et.stats.LastError = err.Error()
+	} else {
+		et.stats.LastError = ""
+	}
+}
+
+// eventsEnabled reports whether events are published to a Pub/Sub topic
+func (bw *BotWorker) eventsEnabled() bool {
+	return bw.pubsub != nil
+}
+
+// newOutboxEntry encodes an event for the outbox
+func newOutboxEntry(event *models.Event) (*models.OutboxEntry, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding event %s: %v", event.ID, err)
+	}
+
+	return &models.OutboxEntry{Type: event.Type, SchemaVersion: event.SchemaVersion, Payload: string(payload), CreatedAt: time.Now()}, nil
+}
+
+// newTransactionEvent creates the event of a transaction executed on the portfolio at ref
+func newTransactionEvent(ref *firestore.DocumentRef, data *TransactionEventData) (*models.Event, error) {
+	portfolio := ""
+	if owner := ownerOf(ref); owner != ref {
+		portfolio = ref.ID
+	}
+
+	return models.NewEvent("transaction-"+data.ID, models.EventTransactionExecuted, data.Time, ownerOf(ref).ID, portfolio, data)
+}
+
+// enqueueEvent adds an event to the outbox and starts delivering the outbox in the background.
+// Events that cannot be added are logged and dropped.
+func (bw *BotWorker) enqueueEvent(event *models.Event, err error) {
+	if !bw.eventsEnabled() {
+		return
+	}
+
+	if err != nil {
+		log.Printf("error creating event: %v\n", err)
+		return
+	}
+
+	entry, err := newOutboxEntry(event)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	_, err = bw.db.Collection(bw.collections.EventOutbox).Doc(event.ID).Set(context.Background(), entry)
+	if err != nil {
+		log.Printf("error adding event %s to the outbox: %v\n", event.ID, err)
+		return
+	}
+
+	bw.deliverEventsAsync()
+}
+
+// enqueueTransactionEvent adds the event of a transaction executed on the portfolio at ref to the outbox
+func (bw *BotWorker) enqueueTransactionEvent(ref *firestore.DocumentRef, data *TransactionEventData) {
+	if !bw.eventsEnabled() {
+		return
+	}
+
+	bw.enqueueEvent(newTransactionEvent(ref, data))
+}
+
+// enqueueValuationEvent adds the event of a changed account value to the outbox
+func (bw *BotWorker) enqueueValuationEvent(ref *firestore.DocumentRef, portfolio *models.Portfolio, previousValue float64) {
+	if !bw.eventsEnabled() {
+		return
+	}
+
+	shadow := ""
+	if owner := ownerOf(ref); owner != ref {
+		shadow = ref.ID
+	}
+
+	bw.enqueueEvent(models.NewEvent(newID(), models.EventPortfolioValued, time.Now(), ownerOf(ref).ID, shadow, &ValuationEventData{
+		AccountValue:  portfolio.AccountValue,
+		PreviousValue: previousValue,
+		Cash:          portfolio.Cash,
+		Currency:      portfolio.CurrencyOfRecord(),
+	}))
+}
+
+// deliverEventsAsync delivers the outbox in the background, events that fail are retried by the event_delivery job
+func (bw *BotWorker) deliverEventsAsync() {
+	if !bw.eventsEnabled() {
+		return
+	}
+
+	go func() {
+		if err := bw.deliverEvents(); err != nil {
+			log.Printf("error delivering events: %v\n", err)
+		}
+	}()
+}
+
+// deliverEvents publishes the outbox to the Pub/Sub topic, oldest events first, and removes the published
+// entries. Entries are only removed after the topic accepted them, so an event may be published more than
+// once but is never lost. Returns immediately if another delivery is running.
+func (bw *BotWorker) deliverEvents() error {
+	if !bw.eventsEnabled() {
+		return nil
+	}
+
+	if !bw.events.deliverMu.TryLock() {
+		return nil
+	}
+	defer bw.events.deliverMu.Unlock()
+
+	ctx := context.Background()
+	for {
+		docs, err := bw.db.Collection(bw.collections.EventOutbox).OrderBy("createdAt", firestore.Asc).Limit(eventDeliveryBatch).Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("error reading event outbox: %v", err)
+		}
+
+		if len(docs) == 0 {
+			return nil
+		}
+
+		messages := make([]*services.PubSubMessage, 0, len(docs))
+		for _, doc := range docs {
+			entry := &models.OutboxEntry{}
+			doc.DataTo(entry)
+			messages = append(messages, &services.PubSubMessage{
+				Data: []byte(entry.Payload),
+				Attributes: map[string]string{
+					"eventId":       doc.Ref.ID,
+					"type":          entry.Type,
+					"schemaVersion": strconv.Itoa(entry.SchemaVersion),
+				},
+			})
+		}
+
+		_, err = bw.pubsub.Publish(ctx, messages)
+		if err != nil {
+			bw.events.record(0, err)
+			for _, doc := range docs {
+				doc.Ref.Update(ctx, []firestore.Update{
+					{Path: "attempts", Value: firestore.Increment(1)},
+					{Path: "lastError", Value: err.Error()},
+				})
+			}
+
+			return err
+		}
+
+		writer := bw.db.BulkWriter(ctx)
+		for _, doc := range docs {
+			_, err = writer.Delete(doc.Ref)
+			if err != nil {
+				log.Printf("error removing event %s from the outbox: %v\n", doc.Ref.ID, err)
+			}
+		}
+
+		writer.End()
+		bw.events.record(len(docs), nil)
+
+		if len(docs) < eventDeliveryBatch {
+			return nil
+		}
+	}
+}
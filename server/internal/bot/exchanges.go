@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// TickerListing is the exchange listing of a ticker, stored in the tickers collection
+type TickerListing struct {
+	Exchange  string    `firestore:"exchange"`  // Exchange code reported by Tiingo
+	Name      string    `firestore:"name"`      // Company or fund name
+	UpdatedAt time.Time `firestore:"updatedAt"` // When the listing was fetched
+}
+
+// MarketStatus describes the trading session of a ticker's exchange
+type MarketStatus struct {
+	Ticker   string `json:"ticker"`   // Ticker symbol
+	Exchange string `json:"exchange"` // Exchange the ticker trades on
+	TimeZone string `json:"timeZone"` // Time zone of the exchange
+	Session  string `json:"session"`  // Current session, "closed" outside every session
+	Open     bool   `json:"open"`     // Whether the ticker can currently be traded in a session
+	Halt     *Halt  `json:"halt"`     // Active trading halt of the ticker or the market, nil if not halted
+
+	Override *MarketOverride `json:"override"` // Administrator override of the exchange's calendar, nil if the calendar applies
+}
+
+// listingCache caches the exchange code of every ticker whose listing is known
+type listingCache struct {
+	mu        sync.RWMutex
+	exchanges map[string]string
+	resolving map[string]bool
+}
+
+// newListingCache creates an empty listing cache
+func newListingCache() *listingCache {
+	return &listingCache{
+		exchanges: make(map[string]string),
+		resolving: make(map[string]bool),
+	}
+}
+
+// precisionFor returns the tick size and share precision of a ticker
+func (bw *BotWorker) precisionFor(ticker string) market.Precision {
+	return bw.markets.Precision(ticker, bw.exchangeFor(ticker))
+}
+
+// exchangeFor returns the exchange a ticker trades on. Tickers whose listing is not known yet
+// use the default exchange while their listing is fetched in the background.
+func (bw *BotWorker) exchangeFor(ticker string) *market.Exchange {
+	ticker = symbols.Canonical(ticker)
+
+	bw.listings.mu.Lock()
+	code, ok := bw.listings.exchanges[ticker]
+	if !ok && !bw.listings.resolving[ticker] {
+		bw.listings.resolving[ticker] = true
+		go bw.resolveListing(ticker)
+	}
+	bw.listings.mu.Unlock()
+
+	if !ok {
+		return bw.markets.Default()
+	}
+
+	return bw.markets.Exchange(code)
+}
+
+// resolveListing fetches and stores the exchange listing of a ticker
+func (bw *BotWorker) resolveListing(ticker string) error {
+	defer func() {
+		bw.listings.mu.Lock()
+		delete(bw.listings.resolving, ticker)
+		bw.listings.mu.Unlock()
+	}()
+
+	metadata, err := bw.tiingo.Metadata(ticker)
+	if err != nil {
+		log.Printf("error fetching listing of %s: %v\n", ticker, err)
+		return err
+	}
+
+	listing := &TickerListing{Exchange: metadata.ExchangeCode, Name: metadata.Name, UpdatedAt: time.Now()}
+	_, err = bw.db.Collection(bw.collections.Tickers).Doc(ticker).Set(context.Background(), listing)
+	if err != nil {
+		log.Printf("error saving listing of %s: %v\n", ticker, err)
+	}
+
+	bw.listings.mu.Lock()
+	bw.listings.exchanges[ticker] = listing.Exchange
+	bw.listings.mu.Unlock()
+
+	return nil
+}
+
+// refreshListings loads the stored listings and fetches the listings of watched tickers that have none
+func (bw *BotWorker) refreshListings() error {
+	docs, err := bw.db.Collection(bw.collections.Tickers).Documents(context.Background()).GetAll()
+	if err != nil {
+		return err
+	}
+
+	bw.listings.mu.Lock()
+	for _, doc := range docs {
+		listing := &TickerListing{}
+		if doc.DataTo(listing) == nil {
+			bw.listings.exchanges[doc.Ref.ID] = listing.Exchange
+		}
+	}
+	bw.listings.mu.Unlock()
+
+	for _, ticker := range bw.watchlist.Tickers() {
+		bw.listings.mu.RLock()
+		_, ok := bw.listings.exchanges[ticker]
+		bw.listings.mu.RUnlock()
+
+		if !ok {
+			bw.resolveListing(ticker)
+		}
+	}
+
+	return nil
+}
+
+// GetMarketStatus returns the exchange and current trading session of tickers.
+// @Summary Get market status
+// @Description Reports the exchange, time zone, current trading session, calendar override and trading halt of each ticker
+// @Tags stocks
+// @Produce json
+// @Param ticker query []string true "Ticker symbols (can specify multiple)"
+// @Success 200 {object} DataPacket "Market status"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Router /market_status [get]
+func (bw *BotWorker) GetMarketStatus(c *gin.Context) {
+	tickers, ok := c.GetQueryArray("ticker")
+	if !ok {
+		c.AbortWithStatusJSON(400, NewResultPacket("error parsing ticker query", false))
+		return
+	}
+
+	now := time.Now()
+	statuses := make([]*MarketStatus, 0, len(tickers))
+	for _, ticker := range tickers {
+		ticker = symbols.Canonical(ticker)
+		exchange := bw.exchangeFor(ticker)
+
+		status := &MarketStatus{
+			Ticker:   ticker,
+			Exchange: exchange.Code,
+			TimeZone: exchange.TimeZone,
+			Session:  market.SessionClosed,
+		}
+
+		session, override := bw.sessionAt(exchange, now)
+		if session != nil {
+			status.Session = session.Name
+			status.Open = true
+		}
+
+		status.Override = override
+
+		// Halted tickers cannot be traded even during a session
+		if status.Halt = bw.halts.active(ticker, now); status.Halt != nil {
+			status.Open = false
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(200, &DataPacket{"market_status", statuses})
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/export"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// ExportTransactions returns every transaction of the portfolio as a file that brokerage tools can import.
+// @Summary Export transactions
+// @Description Downloads the transactions of the portfolio as broker style CSV, a QIF investment register or an OFX investment statement
+// @Tags transactions
+// @Produce text/csv,application/qif,application/x-ofx
+// @Param format query string false "Export format: csv (default), qif or ofx"
+// @Success 200 {file} file "Exported transactions"
+// @Failure 400 {object} ResultData "Unknown format"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /transactions/export [get]
+func (bw *BotWorker) ExportTransactions(c *gin.Context) {
+	portfolio, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	format, err := export.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	docs, err := bw.db.GetAll(context.Background(), portfolio.TransactionReferences)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
+
+	records := make([]export.Record, 0, len(docs))
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+
+		transaction := &models.Transaction{}
+		doc.DataTo(transaction)
+		records = append(records, export.Record{ID: doc.Ref.ID, Transaction: transaction})
+	}
+
+	sort.SliceStable(records, func(a, b int) bool {
+		return records[a].Transaction.Time.Before(records[b].Transaction.Time)
+	})
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"algobattle-%s.%s\"", ref.ID, format))
+
+	err = export.Write(c.Writer, format, ref.ID, records)
+	if err != nil {
+		log.Printf("error exporting transactions of %s: %v\n", ref.ID, err)
+	}
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// defaultFairnessDays is the number of days the fairness report covers unless a start is requested
+const defaultFairnessDays = 7
+
+// priceTime returns when the latest price of a ticker was fetched, falling back to the last price update
+func (bw *BotWorker) priceTime(ticker string) time.Time {
+	if fetched, ok := bw.priceTimes[ticker]; ok {
+		return fetched
+	}
+
+	return bw.pricesTime
+}
+
+// GetFairness reports how long trades waited and how stale their fill prices were.
+// @Summary Get trade fairness report
+// @Description Summarizes the latency from request to execution and the age of fill prices of the transactions in a period, overall, by what executed them and by bot, so organizers can check that no bots are advantaged by when they trade relative to price updates
+// @Tags admin
+// @Produce json
+// @Param competition query string false "Only report the bots of this competition"
+// @Param start query string false "First day as YYYY-MM-DD, defaults to 7 days ago"
+// @Param end query string false "Last day as YYYY-MM-DD, defaults to today"
+// @Success 200 {object} DataPacket "Fairness report"
+// @Failure 400 {object} ResultData "Invalid period"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/fairness [get]
+func (bw *BotWorker) GetFairness(c *gin.Context) {
+	var bots map[string]bool
+	if competitionID := c.Query("competition"); competitionID != "" {
+		var err error
+		bots, _, err = bw.competitionBots(competitionID)
+		if err != nil {
+			c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+			return
+		}
+	}
+
+	end := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	start := end.AddDate(0, 0, -defaultFairnessDays)
+	if query := c.Query("start"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: start must be a date formatted as YYYY-MM-DD", false))
+			return
+		}
+
+		start = parsed
+	}
+
+	if query := c.Query("end"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil || parsed.Before(start) {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: end must be a date formatted as YYYY-MM-DD on or after start", false))
+			return
+		}
+
+		// The end day is included
+		end = parsed.AddDate(0, 0, 1)
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Transactions).Where("time", ">=", start).Where("time", "<", end).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transactions", false))
+		return
+	}
+
+	transactions := make([]*models.Transaction, 0, len(docs))
+	for _, doc := range docs {
+		transaction := &models.Transaction{}
+		if doc.DataTo(transaction) != nil || transaction.Bot == nil {
+			continue
+		}
+
+		if bots != nil && !bots[ownerOf(transaction.Bot).ID] {
+			continue
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	botOf := func(transaction *models.Transaction) string {
+		return ownerOf(transaction.Bot).ID
+	}
+
+	c.JSON(200, &DataPacket{"fairness", models.SummarizeFairness(transactions, botOf, start, end)})
+}
@@ -0,0 +1,387 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/migrations"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// refs creates document references without connecting to Firestore
+var refs = &firestore.Client{}
+
+// memoryStore is a PortfolioStore that keeps everything in memory. Loaded portfolios are copies and saving
+// only changes the fields Firestore would update, so handlers cannot change a stored portfolio without saving it.
+type memoryStore struct {
+	mu           sync.Mutex
+	collections  Collections
+	portfolios   map[string]*models.Portfolio      // Stored portfolios by document path
+	refs         map[string]*firestore.DocumentRef // References of the stored portfolios by document path
+	transactions map[string]*models.Transaction
+	decisions    map[string]*models.OrderDecision
+	groups       map[string]*models.OrderGroup
+	events       []*models.Event
+}
+
+// newMemoryStore creates an empty in-memory store with the default collections
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		collections:  DefaultCollections(),
+		portfolios:   make(map[string]*models.Portfolio),
+		refs:         make(map[string]*firestore.DocumentRef),
+		transactions: make(map[string]*models.Transaction),
+		decisions:    make(map[string]*models.OrderDecision),
+		groups:       make(map[string]*models.OrderGroup),
+	}
+}
+
+// addBot stores the portfolio of a bot and returns its reference
+func (ms *memoryStore) addBot(id string, portfolio *models.Portfolio) *firestore.DocumentRef {
+	ref := refs.Collection(ms.collections.Bots).Doc(id)
+	ms.portfolios[ref.Path] = portfolio
+	ms.refs[ref.Path] = ref
+	return ref
+}
+
+// addShadow stores a shadow portfolio of a bot and returns its reference
+func (ms *memoryStore) addShadow(bot *firestore.DocumentRef, id string, portfolio *models.Portfolio) *firestore.DocumentRef {
+	ref := bot.Collection(ms.collections.Shadows).Doc(id)
+	ms.portfolios[ref.Path] = portfolio
+	ms.refs[ref.Path] = ref
+	return ref
+}
+
+// stored returns a copy of the stored portfolio at ref, nil if there is none
+func (ms *memoryStore) stored(ref *firestore.DocumentRef) *models.Portfolio {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	portfolio, ok := ms.portfolios[ref.Path]
+	if !ok {
+		return nil
+	}
+
+	return copyPortfolio(portfolio)
+}
+
+// copyPortfolio copies the parts of a portfolio that trades and valuations change
+func copyPortfolio(portfolio *models.Portfolio) *models.Portfolio {
+	copied := *portfolio
+	copied.Holdings = make(map[string]*models.Holding, len(portfolio.Holdings))
+	for ticker, holding := range portfolio.Holdings {
+		copied.Holdings[ticker] = holding.Copy()
+	}
+
+	copied.HistoricalAccountValue = make([]*models.AccountValueHistory, 0, len(portfolio.HistoricalAccountValue))
+	for _, history := range portfolio.HistoricalAccountValue {
+		value := *history
+		copied.HistoricalAccountValue = append(copied.HistoricalAccountValue, &value)
+	}
+
+	copied.ClosedPositions = slices.Clone(portfolio.ClosedPositions)
+	copied.TransactionReferences = slices.Clone(portfolio.TransactionReferences)
+	copied.PendingTickers = slices.Clone(portfolio.PendingTickers)
+	if portfolio.Turnover != nil {
+		turnover := *portfolio.Turnover
+		copied.Turnover = &turnover
+	}
+
+	return &copied
+}
+
+func (ms *memoryStore) LoadPortfolio(ctx context.Context, ref *firestore.DocumentRef) (*models.Portfolio, error) {
+	portfolio := ms.stored(ref)
+	if portfolio == nil {
+		return nil, errors.New("portfolio not found")
+	}
+
+	return portfolio, nil
+}
+
+func (ms *memoryStore) FindBot(ctx context.Context, apiKey string) (*firestore.DocumentRef, *models.Portfolio, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for path, portfolio := range ms.portfolios {
+		if apiKey != "" && portfolio.APIKey == apiKey {
+			return ms.refs[path], copyPortfolio(portfolio), nil
+		}
+	}
+
+	return nil, nil, errBotNotFound
+}
+
+func (ms *memoryStore) Portfolios(ctx context.Context) ([]*StoredPortfolio, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	portfolios := make([]*StoredPortfolio, 0, len(ms.portfolios))
+	for _, path := range slices.Sorted(maps.Keys(ms.portfolios)) {
+		portfolios = append(portfolios, &StoredPortfolio{Ref: ms.refs[path], Portfolio: copyPortfolio(ms.portfolios[path])})
+	}
+
+	return portfolios, nil
+}
+
+func (ms *memoryStore) SaveValuation(ctx context.Context, ref *firestore.DocumentRef, portfolio *models.Portfolio) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, ok := ms.portfolios[ref.Path]
+	if !ok {
+		return errors.New("portfolio not found")
+	}
+
+	valued := copyPortfolio(portfolio)
+	stored.AccountValue = valued.AccountValue
+	stored.HistoricalAccountValue = valued.HistoricalAccountValue
+	stored.PendingTickers = valued.PendingTickers
+	return nil
+}
+
+func (ms *memoryStore) SaveTransaction(ctx context.Context, ref *firestore.DocumentRef, portfolio *models.Portfolio, transaction *models.Transaction) (*firestore.DocumentRef, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	doc := refs.Collection(ms.collections.Transactions).NewDoc()
+	err := ms.update(ref, portfolio, append(slices.Clone(portfolio.TransactionReferences), doc))
+	if err != nil {
+		return nil, err
+	}
+
+	ms.transactions[doc.ID] = transaction
+	return doc, nil
+}
+
+func (ms *memoryStore) FillOrder(ctx context.Context, ref *firestore.DocumentRef, fill func(portfolio *models.Portfolio, transactionRef *firestore.DocumentRef) (*OrderFill, error)) (*firestore.DocumentRef, error) {
+	portfolio, err := ms.LoadPortfolio(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	transactionRef := refs.Collection(ms.collections.Transactions).NewDoc()
+	filled, err := fill(portfolio, transactionRef)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	portfolio.TransactionReferences = append(portfolio.TransactionReferences, transactionRef)
+	err = ms.update(ref, portfolio, portfolio.TransactionReferences)
+	if err != nil {
+		return nil, err
+	}
+
+	ms.transactions[transactionRef.ID] = filled.Transaction
+	ms.groups[filled.Group.ID] = filled.Group.Copy()
+	if filled.Event != nil {
+		ms.events = append(ms.events, filled.Event)
+	}
+
+	return transactionRef, nil
+}
+
+// update stores the state a transaction changes in a portfolio. The caller must hold mu.
+func (ms *memoryStore) update(ref *firestore.DocumentRef, portfolio *models.Portfolio, references []*firestore.DocumentRef) error {
+	stored, ok := ms.portfolios[ref.Path]
+	if !ok {
+		return errors.New("portfolio not found")
+	}
+
+	traded := copyPortfolio(portfolio)
+	stored.Cash = traded.Cash
+	stored.Holdings = traded.Holdings
+	stored.ClosedPositions = traded.ClosedPositions
+	stored.Turnover = traded.Turnover
+	stored.TransactionReferences = references
+	return nil
+}
+
+func (ms *memoryStore) NewOrderDecision() *firestore.DocumentRef {
+	return refs.Collection(ms.collections.OrderDecisions).NewDoc()
+}
+
+func (ms *memoryStore) SaveOrderDecision(ctx context.Context, ref *firestore.DocumentRef, decision *models.OrderDecision) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	saved := *decision
+	ms.decisions[ref.ID] = &saved
+	return nil
+}
+
+func (ms *memoryStore) ActiveOrderGroups(ctx context.Context) ([]*models.OrderGroup, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	groups := make([]*models.OrderGroup, 0)
+	for _, group := range ms.groups {
+		if group.Status == models.OrderGroupActive {
+			groups = append(groups, group.Copy())
+		}
+	}
+
+	return groups, nil
+}
+
+func (ms *memoryStore) SaveOrderGroup(ctx context.Context, group *models.OrderGroup) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.groups[group.ID] = group.Copy()
+	return nil
+}
+
+// fixedPrices is a PriceSource that quotes fixed prices
+type fixedPrices struct {
+	prices  map[string]float64
+	err     error // Returned by Fetch instead of the prices if set
+	monitor *services.SourceMonitor
+}
+
+// newFixedPrices creates a price source that quotes the given prices
+func newFixedPrices(prices map[string]float64) *fixedPrices {
+	return &fixedPrices{prices: prices, monitor: services.NewSourceMonitor()}
+}
+
+func (fp *fixedPrices) Fetch(tickers []string) (map[string]float64, string, error) {
+	if fp.err != nil {
+		return nil, "", fp.err
+	}
+
+	prices := make(map[string]float64, len(tickers))
+	for _, ticker := range tickers {
+		if price, ok := fp.prices[ticker]; ok {
+			prices[ticker] = price
+		}
+	}
+
+	return prices, "fixed", nil
+}
+
+func (fp *fixedPrices) Constrained() bool {
+	return false
+}
+
+func (fp *fixedPrices) Monitor() *services.SourceMonitor {
+	return fp.monitor
+}
+
+// fixedWatchlist is a Watchlist over a fixed daily history
+type fixedWatchlist struct {
+	mu         sync.Mutex
+	tickers    map[string]bool
+	history    *models.History
+	priorities []*services.TickerPriority
+}
+
+// newFixedWatchlist creates a watchlist over a daily history
+func newFixedWatchlist(history *models.History) *fixedWatchlist {
+	return &fixedWatchlist{tickers: make(map[string]bool), history: history}
+}
+
+func (fw *fixedWatchlist) AddTickers(tickers ...string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for _, ticker := range tickers {
+		fw.tickers[ticker] = true
+	}
+}
+
+func (fw *fixedWatchlist) Tickers() []string {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(fw.tickers))
+}
+
+func (fw *fixedWatchlist) Daily() *models.History {
+	return fw.history
+}
+
+func (fw *fixedWatchlist) Prioritize(priorities []*services.TickerPriority) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.priorities = priorities
+}
+
+func (fw *fixedWatchlist) Critical(tickers []string) []string {
+	return tickers
+}
+
+// newTestWorker creates a bot worker over in-memory fakes, with an in-memory order book, events disabled and every
+// competition rule at its default. Tickers trade on the default exchange, so no listing is fetched. The worker has
+// no Firestore client or Tiingo, so only handlers that go through the store, prices and watchlist can be tested.
+func newTestWorker(t *testing.T, store PortfolioStore, prices PriceSource, watchlist Watchlist, tickers ...string) *BotWorker {
+	t.Helper()
+
+	if err := RegisterValidators(); err != nil {
+		t.Fatal(err)
+	}
+
+	markets, err := market.NewRegistry(market.ExtendedHours{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	halts, err := newHaltTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anomalies, err := newAnomalyTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collusion, err := newCollusionTracker()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bw := &BotWorker{
+		watchlist:    watchlist,
+		prices:       prices,
+		store:        store,
+		markets:      markets,
+		listings:     newListingCache(),
+		usage:        newUsageTracker(),
+		migrator:     migrations.NewMigrator(nil),
+		orders:       NewOrderBook(),
+		protections:  newProtectionBook(),
+		alerts:       newAlertBook(),
+		universes:    newUniverseTracker(),
+		stream:       newStream(),
+		public:       newPublicFeed(),
+		halts:        halts,
+		overrides:    newOverrideTracker(),
+		valuations:   newValuationTracker(),
+		trades:       newTradeLocks(),
+		collusion:    collusion,
+		collections:  DefaultCollections(),
+		anomalies:    anomalies,
+		latestPrices: make(map[string]float64),
+		stalePrices:  make(map[string]float64),
+		priceTimes:   make(map[string]time.Time),
+	}
+
+	for _, ticker := range tickers {
+		bw.listings.exchanges[ticker] = markets.Default().Code
+		watchlist.AddTickers(ticker)
+	}
+
+	return bw
+}
@@ -0,0 +1,331 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Halt sources
+const (
+	HaltSourceAdmin          = "admin"           // Halted by an administrator
+	HaltSourceCircuitBreaker = "circuit_breaker" // Halted by an extreme price move
+)
+
+// defaultHaltDuration is how long circuit breaker halts last unless CIRCUIT_BREAKER_HALT_MINUTES is set
+const defaultHaltDuration = 15 * time.Minute
+
+// Halt is a trading halt of a single ticker, or of the whole market when Ticker is empty
+type Halt struct {
+	Ticker string    `json:"ticker"` // Halted ticker, empty for a market-wide halt
+	Source string    `json:"source"` // "admin" or "circuit_breaker"
+	Reason string    `json:"reason"` // Why trading was halted
+	Start  time.Time `json:"start"`  // When the halt started
+	Until  time.Time `json:"until"`  // When trading resumes, zero until an administrator resumes it
+}
+
+// Active checks whether the halt is still in effect at the given time
+func (h *Halt) Active(now time.Time) bool {
+	return h.Until.IsZero() || now.Before(h.Until)
+}
+
+// HaltRequestData represents a request to halt trading
+type HaltRequestData struct {
+	Ticker  string `json:"ticker"`  // Ticker to halt, empty to halt the whole market
+	Reason  string `json:"reason"`  // Why trading is halted
+	Minutes int    `json:"minutes"` // How long the halt lasts, 0 until it is resumed
+}
+
+// haltTracker tracks the active trading halts and the circuit breakers that trigger them
+type haltTracker struct {
+	mu          sync.Mutex
+	halts       map[string]*Halt     // Active halts by ticker, the market-wide halt under ""
+	tripped     map[string]time.Time // Day each circuit breaker last tripped, so it trips at most once a day
+	tickerLimit float64              // Move from the previous close in percent that halts a ticker, 0 disables
+	marketLimit float64              // Average decline from the previous close in percent that halts the market, 0 disables
+	duration    time.Duration        // How long circuit breaker halts last
+}
+
+// newHaltTracker creates a halt tracker configured from the CIRCUIT_BREAKER_PERCENT,
+// MARKET_CIRCUIT_BREAKER_PERCENT and CIRCUIT_BREAKER_HALT_MINUTES environment variables
+func newHaltTracker() (*haltTracker, error) {
+	tracker := &haltTracker{
+		halts:    make(map[string]*Halt),
+		tripped:  make(map[string]time.Time),
+		duration: defaultHaltDuration,
+	}
+
+	for key, limit := range map[string]*float64{
+		"CIRCUIT_BREAKER_PERCENT":        &tracker.tickerLimit,
+		"MARKET_CIRCUIT_BREAKER_PERCENT": &tracker.marketLimit,
+	} {
+		if env := os.Getenv(key); env != "" {
+			parsed, err := strconv.ParseFloat(env, 64)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("invalid %s: %s", key, env)
+			}
+
+			*limit = parsed
+		}
+	}
+
+	if env := os.Getenv("CIRCUIT_BREAKER_HALT_MINUTES"); env != "" {
+		minutes, err := strconv.Atoi(env)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("invalid CIRCUIT_BREAKER_HALT_MINUTES: %s", env)
+		}
+
+		tracker.duration = time.Duration(minutes) * time.Minute
+	}
+
+	return tracker, nil
+}
+
+// active returns the halt that applies to a ticker at the given time, or nil if it can be traded.
+// A market-wide halt applies to every ticker.
+func (ht *haltTracker) active(ticker string, now time.Time) *Halt {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	for _, key := range []string{"", ticker} {
+		if halt, ok := ht.halts[key]; ok && halt.Active(now) {
+			return halt
+		}
+	}
+
+	return nil
+}
+
+// list returns every active halt, the market-wide halt first and then by ticker
+func (ht *haltTracker) list(now time.Time) []*Halt {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	halts := make([]*Halt, 0, len(ht.halts))
+	for _, halt := range ht.halts {
+		if halt.Active(now) {
+			halts = append(halts, halt)
+		}
+	}
+
+	sort.Slice(halts, func(i, j int) bool {
+		return halts[i].Ticker < halts[j].Ticker
+	})
+
+	return halts
+}
+
+// halt starts a halt, replacing any halt of the same ticker
+func (ht *haltTracker) halt(halt *Halt) {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	ht.halts[halt.Ticker] = halt
+}
+
+// resume ends the halt of a ticker, or the market-wide halt for an empty ticker.
+// Returns the ended halt, or nil if the ticker was not halted.
+func (ht *haltTracker) resume(ticker string, now time.Time) *Halt {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	halt, ok := ht.halts[ticker]
+	if !ok {
+		return nil
+	}
+
+	delete(ht.halts, ticker)
+	if !halt.Active(now) {
+		return nil
+	}
+
+	return halt
+}
+
+// expire removes the halts that ended before the given time and returns them
+func (ht *haltTracker) expire(now time.Time) []*Halt {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	expired := make([]*Halt, 0)
+	for ticker, halt := range ht.halts {
+		if !halt.Active(now) {
+			delete(ht.halts, ticker)
+			expired = append(expired, halt)
+		}
+	}
+
+	return expired
+}
+
+// trip checks whether a circuit breaker may trip at the given time and records that it tripped.
+// Each circuit breaker trips at most once a day, and never while its ticker is already halted.
+func (ht *haltTracker) trip(ticker string, now time.Time) bool {
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	if halt, ok := ht.halts[ticker]; ok && halt.Active(now) || ht.tripped[ticker].Equal(day) {
+		return false
+	}
+
+	ht.tripped[ticker] = day
+	return true
+}
+
+// checkCircuitBreakers lifts the halts that ended and halts the tickers, or the whole market,
+// whose latest prices moved too far from the previous close. Every change is broadcast to all bots.
+func (bw *BotWorker) checkCircuitBreakers() {
+	now := time.Now()
+	for _, halt := range bw.halts.expire(now) {
+		bw.broadcast(&DataPacket{"trading_resumed", halt})
+	}
+
+	if bw.halts.tickerLimit <= 0 && bw.halts.marketLimit <= 0 {
+		return
+	}
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	total, count := 0.0, 0
+	for ticker, price := range bw.latestPrices {
+		reference, _ := previousClose(bw.watchlist.Daily(), ticker, day)
+		if reference <= 0 || price <= 0 {
+			continue
+		}
+
+		change := (price/reference - 1) * 100
+		total += change
+		count++
+
+		if bw.halts.tickerLimit > 0 && math.Abs(change) >= bw.halts.tickerLimit && bw.halts.trip(ticker, now) {
+			bw.startHalt(&Halt{
+				Ticker: ticker,
+				Source: HaltSourceCircuitBreaker,
+				Reason: fmt.Sprintf("%s moved %.2f%% from its previous close", ticker, change),
+				Start:  now,
+				Until:  now.Add(bw.halts.duration),
+			})
+		}
+	}
+
+	if count == 0 || bw.halts.marketLimit <= 0 {
+		return
+	}
+
+	if average := total / float64(count); -average >= bw.halts.marketLimit && bw.halts.trip("", now) {
+		bw.startHalt(&Halt{
+			Source: HaltSourceCircuitBreaker,
+			Reason: fmt.Sprintf("watched tickers declined %.2f%% on average from their previous close", -average),
+			Start:  now,
+			Until:  now.Add(bw.halts.duration),
+		})
+	}
+}
+
+// startHalt starts a halt and broadcasts it to all bots
+func (bw *BotWorker) startHalt(halt *Halt) {
+	bw.halts.halt(halt)
+	log.Printf("trading halted for %q until %v: %s\n", halt.Ticker, halt.Until, halt.Reason)
+	bw.broadcast(&DataPacket{"trading_halted", halt})
+}
+
+// tradingHaltRule rejects trades of halted tickers and trades during a market-wide halt
+func (bw *BotWorker) tradingHaltRule(transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "trading_halt", Passed: true}
+	if halt := bw.halts.active(transaction.Ticker, transaction.Time); halt != nil {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot trade %s while trading is halted: %s", transaction.Ticker, halt.Reason)
+	}
+
+	return evaluation
+}
+
+// GetHalts returns the active trading halts.
+// @Summary Get trading halts
+// @Description Retrieves every active trading halt, the market-wide halt first
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Active halts"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/halts [get]
+func (bw *BotWorker) GetHalts(c *gin.Context) {
+	c.JSON(200, &DataPacket{"halts", bw.halts.list(time.Now())})
+}
+
+// HaltTrading halts trading of a ticker or of the whole market.
+// @Summary Halt trading
+// @Description Halts trading of a ticker, or of the whole market when no ticker is given, for a number of minutes or until it is resumed
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param halt body HaltRequestData true "Halt details"
+// @Success 200 {object} DataPacket "Started halt"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/halts [post]
+func (bw *BotWorker) HaltTrading(c *gin.Context) {
+	request := &HaltRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil || request.Minutes < 0 {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: invalid halt request", false))
+		return
+	}
+
+	now := time.Now()
+	halt := &Halt{
+		Ticker: symbols.Canonical(request.Ticker),
+		Source: HaltSourceAdmin,
+		Reason: request.Reason,
+		Start:  now,
+	}
+
+	if halt.Reason == "" {
+		halt.Reason = "halted by an administrator"
+	}
+
+	if request.Minutes > 0 {
+		halt.Until = now.Add(time.Duration(request.Minutes) * time.Minute)
+	}
+
+	bw.startHalt(halt)
+	c.JSON(200, &DataPacket{"halt", halt})
+}
+
+// ResumeTrading ends the halt of a ticker or the market-wide halt.
+// @Summary Resume trading
+// @Description Ends the halt of a ticker, or the market-wide halt when no ticker is given
+// @Tags admin
+// @Produce json
+// @Param ticker query string false "Halted ticker, omit for the market-wide halt"
+// @Success 200 {object} DataPacket "Ended halt"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Not halted"
+// @Router /admin/halts [delete]
+func (bw *BotWorker) ResumeTrading(c *gin.Context) {
+	ticker := symbols.Canonical(c.Query("ticker"))
+
+	halt := bw.halts.resume(ticker, time.Now())
+	if halt == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: trading is not halted", false))
+		return
+	}
+
+	log.Printf("trading resumed for %q\n", ticker)
+	bw.broadcast(&DataPacket{"trading_resumed", halt})
+	c.JSON(200, &DataPacket{"halt", halt})
+
+	// Orders and protected positions of the ticker were held back during the halt
+	go func() {
+		bw.evaluateOrders()
+		bw.evaluateProtections()
+	}()
+}
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	heartbeatTimeout       = 5 * time.Minute // How long after its last heartbeat a bot still counts as alive
+	heartbeatWriteInterval = time.Minute     // Minimum time between stored heartbeats of a bot
+)
+
+// HeartbeatData is the response to a heartbeat
+type HeartbeatData struct {
+	Time          time.Time `json:"time"`          // When the heartbeat was received
+	LastHeartbeat time.Time `json:"lastHeartbeat"` // Stored heartbeat shown to organizers, at most a minute older than time
+	Timeout       int       `json:"timeout"`       // Seconds after the last heartbeat until the bot no longer counts as alive
+}
+
+// alive checks whether a bot's last heartbeat is recent enough for its automation to count as running
+func alive(lastHeartbeat, now time.Time) bool {
+	return !lastHeartbeat.IsZero() && now.Sub(lastHeartbeat) <= heartbeatTimeout
+}
+
+// Heartbeat records that the authenticated bot's automation is running.
+// Heartbeats are stored at most once a minute, so bots can send them as often as they like.
+// @Summary Send a heartbeat
+// @Description Records that the bot's automation is running. Organizers see the last heartbeat on the leaderboards and admin views, and bots without a heartbeat in the last 5 minutes are shown as not alive
+// @Tags health
+// @Produce json
+// @Success 200 {object} DataPacket "Heartbeat"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /heartbeat [post]
+func (bw *BotWorker) Heartbeat(c *gin.Context) {
+	portfolio, ref, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(portfolio.LastHeartbeat) >= heartbeatWriteInterval {
+		_, err := ref.Update(context.Background(), []firestore.Update{{Path: "lastHeartbeat", Value: now}})
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save heartbeat", false))
+			return
+		}
+
+		portfolio.LastHeartbeat = now
+	}
+
+	c.JSON(200, &DataPacket{"heartbeat", &HeartbeatData{
+		Time:          now,
+		LastHeartbeat: portfolio.LastHeartbeat,
+		Timeout:       int(heartbeatTimeout.Seconds()),
+	}})
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"urjith.dev/algobattle/pkg/hooks"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// parseTradeHooks creates the custom rule hooks enabled in TRADE_HOOKS_FILE, none if it is not set
+func parseTradeHooks() ([]*hooks.Hook, error) {
+	path := os.Getenv("TRADE_HOOKS_FILE")
+	if path == "" {
+		return make([]*hooks.Hook, 0), nil
+	}
+
+	enabled, err := hooks.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading TRADE_HOOKS_FILE: %v", err)
+	}
+
+	return enabled, nil
+}
+
+// hookRules runs every hook's ValidateTrade in order. Each hook is a rule named after it,
+// and a hook that panics fails its rule instead of taking the server down.
+func (bw *BotWorker) hookRules(portfolio *models.Portfolio, transaction *models.Transaction) []models.RuleEvaluation {
+	evaluations := make([]models.RuleEvaluation, 0, len(bw.tradeHooks))
+	for _, hook := range bw.tradeHooks {
+		evaluation := models.RuleEvaluation{Rule: "hook:" + hook.Name, Passed: true}
+		if err := validateWithHook(hook, portfolio, transaction); err != nil {
+			evaluation.Passed = false
+			evaluation.Detail = err.Error()
+		}
+
+		evaluations = append(evaluations, evaluation)
+	}
+
+	return evaluations
+}
+
+// validateWithHook calls a hook's ValidateTrade, returning an error if it panics
+func validateWithHook(hook *hooks.Hook, portfolio *models.Portfolio, transaction *models.Transaction) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("hook %s panicked validating a trade of %s: %v\n", hook.Name, transaction.Ticker, r)
+			err = fmt.Errorf("rule %s failed to evaluate the trade", hook.Name)
+		}
+	}()
+
+	return hook.ValidateTrade(context.Background(), portfolio, transaction)
+}
+
+// afterFill runs every hook's AfterFill once a trade was stored. Errors and panics are logged.
+func (bw *BotWorker) afterFill(portfolio *models.Portfolio, transaction *models.Transaction) {
+	for _, hook := range bw.tradeHooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("hook %s panicked after a fill of %s: %v\n", hook.Name, transaction.Ticker, r)
+				}
+			}()
+
+			if err := hook.AfterFill(context.Background(), portfolio, transaction); err != nil {
+				log.Printf("error in hook %s after a fill of %s: %v\n", hook.Name, transaction.Ticker, err)
+			}
+		}()
+	}
+}
+
+// tradeHookNames returns the names of the enabled hooks in the order they run
+func (bw *BotWorker) tradeHookNames() []string {
+	names := make([]string, 0, len(bw.tradeHooks))
+	for _, hook := range bw.tradeHooks {
+		names = append(names, hook.Name)
+	}
+
+	return names
+}
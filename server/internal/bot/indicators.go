@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/indicators"
+)
+
+// IndicatorStatus reports the configured indicators and the progress of their recalculation
+type IndicatorStatus struct {
+	ConfigPath     string    `json:"configPath"`     // Config file the indicators are loaded from, empty if none
+	Indicators     []string  `json:"indicators"`     // Names of the calculated indicators
+	ReloadedAt     time.Time `json:"reloadedAt"`     // When the config was last reloaded, zero if it never was
+	Recalculating  bool      `json:"recalculating"`  // Whether indicator values are being recalculated
+	RecalculatedAt time.Time `json:"recalculatedAt"` // When the last recalculation finished, zero if none did
+	Error          string    `json:"error"`          // Reason the last recalculation failed, empty otherwise
+}
+
+// indicatorTracker tracks indicator reloads since the server started
+type indicatorTracker struct {
+	mu     sync.Mutex
+	status IndicatorStatus
+}
+
+// newIndicatorTracker creates an indicator tracker with no reloads
+func newIndicatorTracker() *indicatorTracker {
+	return &indicatorTracker{}
+}
+
+// start marks a recalculation as running. Returns false if one is already running.
+func (it *indicatorTracker) start() bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if it.status.Recalculating {
+		return false
+	}
+
+	it.status.Recalculating = true
+	it.status.ReloadedAt = time.Now()
+	it.status.Error = ""
+	return true
+}
+
+// finish records the outcome of a recalculation
+func (it *indicatorTracker) finish(err error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	it.status.Recalculating = false
+	it.status.RecalculatedAt = time.Now()
+	if err != nil {
+		it.status.Error = err.Error()
+	}
+}
+
+// indicatorStatus returns the current indicator status
+func (bw *BotWorker) indicatorStatus() *IndicatorStatus {
+	bw.indicators.mu.Lock()
+	status := bw.indicators.status
+	bw.indicators.mu.Unlock()
+
+	status.ConfigPath = bw.tiingo.IndicatorsPath
+	status.Indicators = indicatorNames(bw.tiingo.CurrentIndicators())
+	return &status
+}
+
+// indicatorNames returns the names of the given indicators
+func indicatorNames(list []indicators.Indicator) []string {
+	names := make([]string, 0, len(list))
+	for _, indicator := range list {
+		names = append(names, indicator.Name())
+	}
+
+	return names
+}
+
+// recalculateIndicators recalculates every indicator value of the daily cache.
+// Downloads of new tickers wait until it finishes, so they use the new indicators.
+func (bw *BotWorker) recalculateIndicators() {
+	bw.tickers.downloadMu.Lock()
+	defer bw.tickers.downloadMu.Unlock()
+
+	err := bw.tiingo.RecalculateIndicators()
+	if err != nil {
+		log.Printf("error recalculating indicators: %v\n", err)
+	}
+
+	bw.indicators.finish(err)
+}
+
+// GetIndicators returns the configured indicators and the progress of their recalculation.
+// @Summary Get indicator config
+// @Description Lists the indicators calculated for every ticker, the config file they are loaded from and whether a recalculation is running
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Indicator status"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/indicators [get]
+func (bw *BotWorker) GetIndicators(c *gin.Context) {
+	c.JSON(200, &DataPacket{"indicators", bw.indicatorStatus()})
+}
+
+// ReloadIndicators reloads the indicator config file and recalculates every indicator in the background.
+// @Summary Reload indicator config
+// @Description Reloads the indicator config file and starts recalculating the indicators of every cached ticker. Values of removed indicators are deleted.
+// @Tags admin
+// @Produce json
+// @Success 202 {object} DataPacket "Indicator status"
+// @Failure 400 {object} ResultData "Missing or invalid config file"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 409 {object} ResultData "A recalculation is already running"
+// @Router /admin/indicators/reload [post]
+func (bw *BotWorker) ReloadIndicators(c *gin.Context) {
+	if !bw.indicators.start() {
+		c.AbortWithStatusJSON(409, NewResultPacket("error: indicators are already being recalculated", false))
+		return
+	}
+
+	_, err := bw.tiingo.LoadIndicators()
+	if err != nil {
+		bw.indicators.mu.Lock()
+		bw.indicators.status.Recalculating = false
+		bw.indicators.mu.Unlock()
+
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	go bw.recalculateIndicators()
+
+	c.JSON(202, &DataPacket{"indicators", bw.indicatorStatus()})
+}
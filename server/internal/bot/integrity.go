@@ -0,0 +1,221 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Repairs of the daily cache made when the integrity check finds violations
+const (
+	RepairNone       = ""           // Violations are only reported
+	RepairQuarantine = "quarantine" // Affected tickers are removed from the cache until the next full download
+	RepairRebuild    = "rebuild"    // Affected tickers are removed from the cache and downloaded again
+)
+
+// maxIntegrityActions is the number of recent repairs kept for the admin endpoint
+const maxIntegrityActions = 100
+
+// IntegrityAction is a repair of the daily cache
+type IntegrityAction struct {
+	Time      time.Time `json:"time"`      // When the repair was made
+	Action    string    `json:"action"`    // "sort", "quarantine" or "rebuild"
+	Ticker    string    `json:"ticker"`    // Repaired ticker, empty when the rows were sorted
+	Rows      int       `json:"rows"`      // Rows of the ticker removed from the cache
+	File      string    `json:"file"`      // File the removed history was written to
+	Automatic bool      `json:"automatic"` // Whether the integrity check made the repair
+	Error     string    `json:"error"`     // Error of the repair, empty if it succeeded
+}
+
+// TickerRebuild is a rebuild of a ticker and the download that restores its history
+type TickerRebuild struct {
+	*IntegrityAction
+	Job *TickerJob `json:"job"` // Download of the ticker's history
+}
+
+// IntegrityStatus reports the last integrity check of the daily cache and the recent repairs
+type IntegrityStatus struct {
+	Repair  string                  `json:"repair"`  // Repair made by the check, empty if violations are only reported
+	Report  *models.IntegrityReport `json:"report"`  // Result of the last check, nil if it never ran
+	Actions []*IntegrityAction      `json:"actions"` // Recent repairs, newest first
+}
+
+// integrityTracker keeps the result of the last cache integrity check
+type integrityTracker struct {
+	mu      sync.Mutex
+	repair  string
+	report  *models.IntegrityReport
+	actions []*IntegrityAction
+}
+
+// newIntegrityTracker creates an integrity tracker configured by INTEGRITY_REPAIR
+func newIntegrityTracker() (*integrityTracker, error) {
+	repair := os.Getenv("INTEGRITY_REPAIR")
+	switch repair {
+	case RepairNone, RepairQuarantine, RepairRebuild:
+	default:
+		return nil, fmt.Errorf("invalid INTEGRITY_REPAIR: %s", repair)
+	}
+
+	return &integrityTracker{repair: repair, actions: make([]*IntegrityAction, 0)}, nil
+}
+
+// record adds a repair to the recent repairs
+func (it *integrityTracker) record(action *IntegrityAction) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	it.actions = append([]*IntegrityAction{action}, it.actions...)
+	if len(it.actions) > maxIntegrityActions {
+		it.actions = it.actions[:maxIntegrityActions]
+	}
+}
+
+// status returns the last report and a copy of the recent repairs
+func (it *integrityTracker) status() *IntegrityStatus {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	return &IntegrityStatus{Repair: it.repair, Report: it.report, Actions: append([]*IntegrityAction{}, it.actions...)}
+}
+
+// summary returns the last report without its violations, or nil if the check never ran
+func (it *integrityTracker) summary() *models.IntegrityReport {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if it.report == nil {
+		return nil
+	}
+
+	return it.report.Summary()
+}
+
+// checkCacheIntegrity validates the daily cache and repairs it as configured by INTEGRITY_REPAIR.
+// The job fails when violations are found so they show up in the job status.
+func (bw *BotWorker) checkCacheIntegrity() error {
+	report := bw.tiingo.CheckCache()
+
+	bw.integrity.mu.Lock()
+	bw.integrity.report = report
+	repair := bw.integrity.repair
+	bw.integrity.mu.Unlock()
+
+	if report.Count == 0 {
+		return nil
+	}
+
+	log.Printf("cache integrity check found %d violations in %d tickers\n", report.Count, len(report.Affected))
+	if repair == RepairNone {
+		return fmt.Errorf("found %d violations", report.Count)
+	}
+
+	if report.ByKind[models.ViolationUnsortedRows] > 0 || report.ByKind[models.ViolationDuplicateDate] > 0 {
+		bw.tickers.downloadMu.Lock()
+		bw.tiingo.SortCache()
+		bw.tickers.downloadMu.Unlock()
+
+		bw.integrity.record(&IntegrityAction{Time: time.Now(), Action: "sort", Automatic: true})
+	}
+
+	for _, ticker := range report.Affected {
+		bw.repairTicker(ticker, repair, true)
+	}
+
+	return fmt.Errorf("found %d violations, repaired %d tickers with %s", report.Count, len(report.Affected), repair)
+}
+
+// repairTicker quarantines a ticker, and downloads it again when it is rebuilt
+func (bw *BotWorker) repairTicker(ticker, repair string, automatic bool) (*IntegrityAction, *TickerJob) {
+	action := &IntegrityAction{Time: time.Now(), Action: repair, Ticker: ticker, Automatic: automatic}
+
+	// Downloads are paused so that a ticker is not removed while its history is being written
+	bw.tickers.downloadMu.Lock()
+	rows, file, err := bw.tiingo.QuarantineTicker(ticker)
+	bw.tickers.downloadMu.Unlock()
+
+	action.Rows = rows
+	action.File = file
+	if err != nil {
+		log.Printf("error quarantining %s: %v\n", ticker, err)
+		action.Error = err.Error()
+	}
+
+	bw.integrity.record(action)
+
+	if repair != RepairRebuild {
+		return action, nil
+	}
+
+	return action, bw.startTickerJob(ticker)
+}
+
+// GetIntegrity returns the last integrity check of the daily cache.
+// @Summary Get cache integrity
+// @Description Reports the violations found by the last check of the daily cache (unsorted or duplicate rows, ticker ranges that do not match their rows, NaN or infinite values) and the recent repairs. The check runs on INTEGRITY_CHECK_CRON and can be run now with POST /admin/jobs/cache_integrity/run
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Integrity status"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/integrity [get]
+func (bw *BotWorker) GetIntegrity(c *gin.Context) {
+	c.JSON(200, &DataPacket{"integrity", bw.integrity.status()})
+}
+
+// QuarantineTicker removes a corrupted ticker from the daily cache.
+// @Summary Quarantine a ticker
+// @Description Removes the history of a ticker from the daily cache and writes it to the quarantine folder for inspection. The ticker stays on the watchlist and is downloaded again by the next daily download
+// @Tags admin
+// @Produce json
+// @Param ticker path string true "Ticker symbol"
+// @Success 200 {object} DataPacket "Repair"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Ticker not cached"
+// @Failure 500 {object} ResultData "Failed to write the quarantined history"
+// @Router /admin/integrity/tickers/{ticker}/quarantine [post]
+func (bw *BotWorker) QuarantineTicker(c *gin.Context) {
+	bw.repairTickerHandler(c, RepairQuarantine)
+}
+
+// RebuildTicker removes a corrupted ticker from the daily cache and downloads it again.
+// @Summary Rebuild a ticker
+// @Description Quarantines the history of a ticker and downloads it again in the background. Poll GET /ticker_status for progress
+// @Tags admin
+// @Produce json
+// @Param ticker path string true "Ticker symbol"
+// @Success 202 {object} DataPacket "Repair and the started download"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Ticker not cached"
+// @Failure 500 {object} ResultData "Failed to write the quarantined history"
+// @Router /admin/integrity/tickers/{ticker}/rebuild [post]
+func (bw *BotWorker) RebuildTicker(c *gin.Context) {
+	bw.repairTickerHandler(c, RepairRebuild)
+}
+
+// repairTickerHandler quarantines or rebuilds the ticker of a request
+func (bw *BotWorker) repairTickerHandler(c *gin.Context, repair string) {
+	ticker := symbols.Canonical(c.Param("ticker"))
+	if !bw.tiingo.Cached(ticker) {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: ticker is not cached", false))
+		return
+	}
+
+	action, job := bw.repairTicker(ticker, repair, false)
+	if action.Error != "" {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to quarantine ticker: "+action.Error, false))
+		return
+	}
+
+	if job == nil {
+		c.JSON(200, &DataPacket{"integrity_action", action})
+		return
+	}
+
+	c.JSON(202, &DataPacket{"integrity_action", &TickerRebuild{IntegrityAction: action, Job: job}})
+}
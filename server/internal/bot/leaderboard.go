@@ -0,0 +1,423 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// maxLeaderboardPage is the largest page of a paged competition leaderboard, and the page size if only a cursor is given
+const maxLeaderboardPage = 500
+
+// CompetitionLeaderboard ranks the bots of a competition
+type CompetitionLeaderboard struct {
+	CompetitionID  string           `json:"competitionId"`  // ID of the competition
+	Metric         string           `json:"metric"`         // Metric the entries are ranked by
+	OfficialMetric string           `json:"officialMetric"` // Ranking metric chosen by the organizer
+	Time           time.Time        `json:"time"`           // When the leaderboard was calculated
+	Version        string           `json:"version"`        // Hash of the ranked entries, also sent as the ETag
+	Entries        []*StandingEntry `json:"entries"`        // Ranked entries
+	Stats          *PeerStats       `json:"stats"`          // Distribution of the ranked entries, nil without entries
+	Standing       *PeerStanding    `json:"standing"`       // Standing of the bot requested with the bot parameter, nil otherwise
+}
+
+// Distribution summarizes a set of values with its quartiles
+type Distribution struct {
+	Min    float64 `json:"min"`    // Lowest value
+	Q1     float64 `json:"q1"`     // First quartile, a quarter of the values are lower
+	Median float64 `json:"median"` // Median, half of the values are lower
+	Q3     float64 `json:"q3"`     // Third quartile, three quarters of the values are lower
+	Max    float64 `json:"max"`    // Highest value
+	Mean   float64 `json:"mean"`   // Arithmetic mean
+}
+
+// PeerStats is the distribution of the returns and account values of the bots on a leaderboard
+type PeerStats struct {
+	Count        int           `json:"count"`        // Number of ranked bots
+	Return       *Distribution `json:"return"`       // Returns since each bot's inception
+	AccountValue *Distribution `json:"accountValue"` // Account values
+}
+
+// PeerStanding is where a bot stands among the other bots of a leaderboard
+type PeerStanding struct {
+	BotID      string  `json:"botId"`      // ID of the bot
+	Rank       int     `json:"rank"`       // 1-based position by the ranking metric
+	Percentile float64 `json:"percentile"` // Share of the other ranked bots the bot ranks above, from 0 to 100
+}
+
+// CompetitionLeaderboardDelta lists the changes of a competition leaderboard since an earlier version
+type CompetitionLeaderboardDelta struct {
+	CompetitionID string `json:"competitionId"` // ID of the competition
+	Metric        string `json:"metric"`        // Metric the entries are ranked by
+	Since         string `json:"since"`         // Version the changes are relative to
+	Version       string `json:"version"`       // Current version of the leaderboard
+	Full          bool   `json:"full"`          // Whether the since version was unknown, so changed lists every entry
+	LeaderboardDelta
+}
+
+// leaderboardVersions is how many recent versions of each competition leaderboard deltas can be requested against
+const leaderboardVersions = 20
+
+// leaderboardSnapshot is the entries of a version of a leaderboard by bot ID
+type leaderboardSnapshot struct {
+	version string
+	entries map[string]*StandingEntry
+	stats   *PeerStats
+}
+
+// leaderboardCache keeps the recent versions of competition leaderboards by competition and metric, oldest first
+type leaderboardCache struct {
+	mu        sync.Mutex
+	snapshots map[string][]*leaderboardSnapshot
+}
+
+// newLeaderboardCache creates an empty leaderboard cache
+func newLeaderboardCache() *leaderboardCache {
+	return &leaderboardCache{snapshots: make(map[string][]*leaderboardSnapshot)}
+}
+
+// record stores a leaderboard as the latest version of its competition and metric, unless it did not change,
+// and returns the entries of the requested earlier version, nil if it is not cached. The statistics of the entries
+// are calculated once per version and set on the leaderboard.
+func (lc *leaderboardCache) record(board *CompetitionLeaderboard, since string) map[string]*StandingEntry {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	key := board.CompetitionID + "/" + board.Metric
+	snapshots := lc.snapshots[key]
+	if len(snapshots) == 0 || snapshots[len(snapshots)-1].version != board.Version {
+		snapshot := &leaderboardSnapshot{version: board.Version, entries: make(map[string]*StandingEntry, len(board.Entries)), stats: newPeerStats(board.Entries)}
+		for _, entry := range board.Entries {
+			snapshot.entries[entry.BotID] = entry
+		}
+
+		snapshots = append(snapshots, snapshot)
+		if len(snapshots) > leaderboardVersions {
+			snapshots = snapshots[len(snapshots)-leaderboardVersions:]
+		}
+
+		lc.snapshots[key] = snapshots
+	}
+
+	board.Stats = snapshots[len(snapshots)-1].stats
+	for _, snapshot := range snapshots {
+		if snapshot.version == since {
+			return snapshot.entries
+		}
+	}
+
+	return nil
+}
+
+// newPeerStats calculates the distribution of the returns and account values of ranked entries, nil without entries
+func newPeerStats(entries []*StandingEntry) *PeerStats {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	returns := make([]float64, len(entries))
+	values := make([]float64, len(entries))
+	for i, entry := range entries {
+		returns[i] = entry.Return
+		values[i] = entry.AccountValue
+	}
+
+	return &PeerStats{Count: len(entries), Return: newDistribution(returns), AccountValue: newDistribution(values)}
+}
+
+// newDistribution summarizes values with their quartiles, interpolating linearly between the closest values
+func newDistribution(values []float64) *Distribution {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	quantile := func(q float64) float64 {
+		position := q * float64(len(sorted)-1)
+		lower := int(position)
+		if lower+1 >= len(sorted) {
+			return sorted[lower]
+		}
+
+		return sorted[lower] + (position-float64(lower))*(sorted[lower+1]-sorted[lower])
+	}
+
+	mean := 0.0
+	for _, value := range sorted {
+		mean += value
+	}
+
+	return &Distribution{
+		Min:    sorted[0],
+		Q1:     quantile(0.25),
+		Median: quantile(0.5),
+		Q3:     quantile(0.75),
+		Max:    sorted[len(sorted)-1],
+		Mean:   mean / float64(len(sorted)),
+	}
+}
+
+// newPeerStanding finds a bot among ranked entries, nil if it is not ranked
+func newPeerStanding(entries []*StandingEntry, botID string) *PeerStanding {
+	for _, entry := range entries {
+		if entry.BotID != botID {
+			continue
+		}
+
+		standing := &PeerStanding{BotID: botID, Rank: entry.Rank, Percentile: 100}
+		if len(entries) > 1 {
+			standing.Percentile = float64(len(entries)-entry.Rank) / float64(len(entries)-1) * 100
+		}
+
+		return standing
+	}
+
+	return nil
+}
+
+// leaderboardVersion hashes the ranked entries of a leaderboard, so unchanged leaderboards have the same version
+func leaderboardVersion(metric string, entries []*StandingEntry) string {
+	encoded, err := json.Marshal(struct {
+		Metric  string
+		Entries []*StandingEntry
+	}{metric, entries})
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:16])
+}
+
+// newLeaderboardDelta lists the entries of a leaderboard that are new or whose rank or value changed since the
+// given entries, like the deltas of the public feed. Without earlier entries every entry is listed.
+func newLeaderboardDelta(board *CompetitionLeaderboard, since string, previous map[string]*StandingEntry) *CompetitionLeaderboardDelta {
+	delta := &CompetitionLeaderboardDelta{
+		CompetitionID: board.CompetitionID,
+		Metric:        board.Metric,
+		Since:         since,
+		Version:       board.Version,
+		Full:          previous == nil,
+		LeaderboardDelta: LeaderboardDelta{
+			Time:    board.Time,
+			Changed: make([]*StandingEntry, 0),
+			Removed: make([]string, 0),
+		},
+	}
+
+	ranked := make(map[string]bool, len(board.Entries))
+	for _, entry := range board.Entries {
+		ranked[entry.BotID] = true
+		if earlier, ok := previous[entry.BotID]; !ok || *earlier != *entry {
+			delta.Changed = append(delta.Changed, entry)
+		}
+	}
+
+	for id := range previous {
+		if !ranked[id] {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+
+	sort.Strings(delta.Removed)
+	return delta
+}
+
+// RankingRequestData represents a request to change the official ranking metric of a competition
+type RankingRequestData struct {
+	RankingMetric string `json:"rankingMetric"` // "account_value", "return", "annualized_return" or "score"
+}
+
+// GetCompetitionLeaderboard ranks the bots of a competition by its official ranking metric.
+// Bots use their latest live value if they have one, and their stored account value otherwise.
+// @Summary Get a competition leaderboard
+// @Description Ranks the bots of a competition by its official metric, or by the metric given in the query. Returns are measured from each bot's own inception, so bots that joined late are compared fairly. With a window, bots are ranked by their return over the last days of valuations instead. The response carries an ETag, and a request with a matching If-None-Match header returns 304. With since, only the entries that are new or whose rank or value changed since that version are returned. With a limit or cursor, a page of the ranked entries is returned and the X-Next-Cursor header carries the cursor of the next page. Pages continue after the last bot of the previous page, so a bot whose rank changed between two pages may be skipped or repeated, and the version of each page tells whether the ranking changed. Every leaderboard carries the quartiles of the returns and account values of all ranked bots, and with bot, the percentile of that bot
+// @Tags competitions
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Param metric query string false "Ranking metric: account_value, return, annualized_return or score"
+// @Param window query string false "Rank by the return over a rolling window of days instead, such as 7d or 30d"
+// @Param since query string false "Version of an earlier leaderboard, to only return the changes since then"
+// @Param bot query string false "ID of a bot to report the percentile of among the ranked bots"
+// @Param limit query int false "Page through the ranked entries, with this many entries per page and at most 500"
+// @Param cursor query string false "Cursor of the page to return, from the X-Next-Cursor header of the previous page"
+// @Param If-None-Match header string false "ETag of the leaderboard the client has"
+// @Success 200 {object} DataPacket "Competition leaderboard, or its changes with since"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, missing on the last page"
+// @Success 304 "Leaderboard unchanged"
+// @Failure 400 {object} ResultData "Invalid metric, window, limit or cursor"
+// @Failure 404 {object} ResultData "Competition not found, or the requested bot is not ranked"
+// @Router /public/competitions/{id}/leaderboard [get]
+func (bw *BotWorker) GetCompetitionLeaderboard(c *gin.Context) {
+	competitionDoc, err := bw.db.Collection(bw.collections.Competitions).Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+		return
+	}
+
+	competition := &models.Competition{}
+	if competitionDoc.DataTo(competition) != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to read competition", false))
+		return
+	}
+
+	if window := c.Query("window"); window != "" {
+		days, err := parseWindow(window)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+			return
+		}
+
+		board, err := bw.windowLeaderboard(competitionDoc.Ref, days, time.Now())
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve bots", false))
+			return
+		}
+
+		c.JSON(200, &DataPacket{"competition_window_leaderboard", board})
+		return
+	}
+
+	metric := c.DefaultQuery("metric", competition.Metric())
+	if metric == "" || !models.ValidRankingMetric(metric) {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: metric must be account_value, return, annualized_return or score", false))
+		return
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Bots).Where("competition", "==", competitionDoc.Ref).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve bots", false))
+		return
+	}
+
+	bw.public.mu.Lock()
+	live := make(map[string]float64, len(bw.public.standings))
+	for id, entry := range bw.public.standings {
+		live[id] = entry.AccountValue
+	}
+	bw.public.mu.Unlock()
+
+	now := time.Now()
+	standings := make(map[string]*StandingEntry, len(docs))
+	for _, doc := range docs {
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil || portfolio.Disqualified() {
+			continue
+		}
+
+		value, ok := live[doc.Ref.ID]
+		if !ok {
+			value = portfolio.AccountValue
+		}
+
+		standings[doc.Ref.ID] = newStandingEntry(doc.Ref.ID, portfolio, value, now)
+	}
+
+	board := &CompetitionLeaderboard{
+		CompetitionID:  competitionDoc.Ref.ID,
+		Metric:         metric,
+		OfficialMetric: competition.Metric(),
+		Time:           now,
+		Entries:        rankStandings(standings, metric),
+	}
+	board.Version = leaderboardVersion(board.Metric, board.Entries)
+
+	since := c.Query("since")
+	previous := bw.leaderboards.record(board, since)
+	if botID := c.Query("bot"); botID != "" {
+		board.Standing = newPeerStanding(board.Entries, botID)
+		if board.Standing == nil {
+			c.AbortWithStatusJSON(404, NewResultPacket("error: bot "+botID+" is not ranked in this competition", false))
+			return
+		}
+	}
+
+	if since != "" {
+		c.JSON(200, &DataPacket{"competition_leaderboard_delta", newLeaderboardDelta(board, since, previous)})
+		return
+	}
+
+	// The full leaderboard stays recorded for deltas, pages are copies of it with an ETag of their own
+	etag := `"` + board.Version + `"`
+	if c.Query("limit") != "" || c.Query("cursor") != "" {
+		page, ok := parsePageRequest(c, maxLeaderboardPage, maxLeaderboardPage)
+		if !ok {
+			return
+		}
+
+		paged := *board
+		paged.Entries = pageStandings(c, board.Entries, page)
+		board = &paged
+		etag = fmt.Sprintf(`"%s-%d-%s"`, board.Version, page.limit, page.cursor.encode())
+	}
+
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(304)
+		return
+	}
+
+	c.JSON(200, &DataPacket{"competition_leaderboard", board})
+}
+
+// pageStandings returns a page of ranked entries and sends the cursor of the next page if there is one. The page
+// starts after the bot of the cursor, or after its rank if the bot is no longer ranked.
+func pageStandings(c *gin.Context, entries []*StandingEntry, page *pageRequest) []*StandingEntry {
+	start := 0
+	if page.cursor != nil {
+		start = min(max(int(page.cursor.key), 0), len(entries))
+		for i, entry := range entries {
+			if entry.BotID == page.cursor.id {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	end := min(start+page.limit, len(entries))
+	if end < len(entries) {
+		last := entries[end-1]
+		setNextCursor(c, &pageCursor{key: int64(last.Rank), id: last.BotID})
+	}
+
+	return entries[start:end]
+}
+
+// SetRankingMetric changes the official ranking metric of a competition.
+// @Summary Set the ranking metric of a competition
+// @Description Chooses whether the competition leaderboard ranks bots by account value, return since inception, annualized return or composite score
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Param ranking body RankingRequestData true "Ranking metric"
+// @Success 200 {object} ResultData "Ranking metric updated"
+// @Failure 400 {object} ResultData "Invalid metric"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Router /admin/competitions/{id}/ranking [put]
+func (bw *BotWorker) SetRankingMetric(c *gin.Context) {
+	request := &RankingRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil || request.RankingMetric == "" || !models.ValidRankingMetric(request.RankingMetric) {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: rankingMetric must be account_value, return, annualized_return or score", false))
+		return
+	}
+
+	ref := bw.db.Collection(bw.collections.Competitions).Doc(c.Param("id"))
+	_, err = ref.Update(context.Background(), []firestore.Update{{Path: "rankingMetric", Value: request.RankingMetric}})
+	if err != nil {
+		log.Printf("error setting ranking metric of competition %s: %v\n", ref.ID, err)
+		c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+		return
+	}
+
+	c.JSON(200, NewResultPacket("ranking metric set to "+request.RankingMetric, true))
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// liquidityVolumeDays is the number of cached trading days a ticker's average daily volume is taken over
+const liquidityVolumeDays = 20
+
+// parseParticipation parses LIQUIDITY_PARTICIPATION_PERCENT, the share of a ticker's average daily volume
+// that can trade in a single price update. Returns 0, which disables the limit, if it is unset.
+func parseParticipation() (float64, error) {
+	env := os.Getenv("LIQUIDITY_PARTICIPATION_PERCENT")
+	if env == "" {
+		return 0, nil
+	}
+
+	percent, err := strconv.ParseFloat(env, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid LIQUIDITY_PARTICIPATION_PERCENT: %s", env)
+	}
+
+	return percent, nil
+}
+
+// averageDailyVolume returns the average volume of a ticker over the last cached trading days before day,
+// 0 if the cache has no volume for the ticker
+func averageDailyVolume(history *models.History, ticker string, day time.Time) float64 {
+	// The rows before the day end right before the first row on or after it
+	end, _ := history.CeilRow(day)
+	index := end - 1
+
+	total, days := int64(0), 0
+	for i := index; i >= 0 && i > index-2*liquidityVolumeDays && days < liquidityVolumeDays; i-- {
+		if period, ok := history.Rows[i].Data.Load(ticker); ok && period.Volume > 0 {
+			total += period.Volume
+			days++
+		}
+	}
+
+	if days == 0 {
+		return 0
+	}
+
+	return float64(total) / float64(days)
+}
+
+// liquidityLimit returns the largest number of shares of a ticker that can trade in a single price update,
+// at least one share. Returns +Inf if the limit is disabled or the ticker has no cached volume.
+func (bw *BotWorker) liquidityLimit(ticker string, now time.Time) float64 {
+	if bw.participation <= 0 {
+		return math.Inf(1)
+	}
+
+	volume := averageDailyVolume(bw.watchlist.Daily(), ticker, now)
+	if volume <= 0 {
+		return math.Inf(1)
+	}
+
+	return max(math.Floor(volume*bw.participation/100), 1)
+}
+
+// liquidityRule rejects transactions larger than the shares of a ticker that can trade in a single price update.
+// Conditional orders are filled in parts that never exceed the limit, so larger trades must be placed as orders.
+func (bw *BotWorker) liquidityRule(transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "liquidity", Passed: true}
+	if limit := bw.liquidityLimit(transaction.Ticker, transaction.Time); transaction.NumShares > limit {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot trade %g shares of %s at once, at most %g shares (%g%% of its average daily volume) trade per price update, place a conditional order to fill over several updates",
+			transaction.NumShares, transaction.Ticker, limit, bw.participation)
+	}
+
+	return evaluation
+}
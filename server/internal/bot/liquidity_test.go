@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+func TestAverageDailyVolume(t *testing.T) {
+	history := dailyHistory("AAPL", 2, 3, 4, 5, 8)
+
+	tests := []struct {
+		name    string
+		history *models.History
+		ticker  string
+		day     time.Time
+		want    float64
+	}{
+		{"row dated on the day is excluded", history, "AAPL", testDay(4), 2500},
+		{"day of the last row", history, "AAPL", testDay(8), 3500},
+		{"day without a row", history, "AAPL", testDay(6), 3500},
+		{"after the last row", history, "AAPL", testDay(20), 4400},
+		{"day of the first row", history, "AAPL", testDay(2), 0},
+		{"unknown ticker", history, "TSLA", testDay(8), 0},
+		{"empty history", models.NewHistory(), "AAPL", testDay(8), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := averageDailyVolume(tt.history, tt.ticker, tt.day); got != tt.want {
+				t.Errorf("averageDailyVolume = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAverageDailyVolumeWindow(t *testing.T) {
+	// Only the last liquidityVolumeDays days before the day count
+	days := make([]int, 0, liquidityVolumeDays+5)
+	for d := 1; d <= liquidityVolumeDays+5; d++ {
+		days = append(days, d)
+	}
+
+	history := dailyHistory("AAPL", days...)
+	last := liquidityVolumeDays + 5
+
+	// Days 5 to 24 are averaged, the row on the 25th is excluded
+	want := 1000 * float64(5+last-1) / 2
+	if got := averageDailyVolume(history, "AAPL", testDay(last)); got != want {
+		t.Errorf("averageDailyVolume = %g, want %g", got, want)
+	}
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// RuntimeMetrics reports the memory and goroutines of the server process
+type RuntimeMetrics struct {
+	HeapAlloc  uint64 `json:"heapAlloc"`  // Bytes of allocated heap objects
+	HeapInuse  uint64 `json:"heapInuse"`  // Bytes in in-use heap spans
+	Sys        uint64 `json:"sys"`        // Total bytes obtained from the OS
+	NumGC      uint32 `json:"numGC"`      // Number of completed GC cycles
+	Goroutines int    `json:"goroutines"` // Number of running goroutines
+}
+
+// Metrics reports the memory used by the history cache and the server
+type Metrics struct {
+	Time    time.Time              `json:"time"`    // When the metrics were collected
+	History *models.HistoryMemory  `json:"history"` // Rows of the daily cache held in memory
+	Archive *services.ArchiveStats `json:"archive"` // Rows evicted from memory to yearly shards
+	Runtime *RuntimeMetrics        `json:"runtime"` // Memory of the whole process
+
+	Integrity *models.IntegrityReport `json:"integrity"` // Violation counts of the last cache integrity check, nil if it never ran
+	Events    *EventDeliveryStats     `json:"events"`    // Delivery of events to Pub/Sub, nil if events are disabled
+	Valuation *ValuationStats         `json:"valuation"` // Held tickers the last valuation had no live price for
+	Quota     *services.BudgetUsage   `json:"quota"`     // Tiingo requests each feature used this hour
+	Queue     *TransactionQueueStats  `json:"queue"`     // Load of the asynchronous transaction queue
+}
+
+// GetMetrics returns the memory usage of the history cache and the server.
+// @Summary Get server metrics
+// @Description Reports the estimated memory of the daily history cache, the archived shards on disk, process memory statistics, the Tiingo quota used by each feature and the load of the transaction queue
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Server metrics"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /metrics [get]
+func (bw *BotWorker) GetMetrics(c *gin.Context) {
+	archive, err := bw.tiingo.ArchiveStats()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error reading history archive: "+err.Error(), false))
+		return
+	}
+
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+
+	c.JSON(200, &DataPacket{"metrics", &Metrics{
+		Time:    time.Now(),
+		History: bw.watchlist.Daily().MemoryUsage(),
+		Archive: archive,
+		Runtime: &RuntimeMetrics{
+			HeapAlloc:  memStats.HeapAlloc,
+			HeapInuse:  memStats.HeapInuse,
+			Sys:        memStats.Sys,
+			NumGC:      memStats.NumGC,
+			Goroutines: runtime.NumGoroutine(),
+		},
+		Integrity: bw.integrity.summary(),
+		Events:    bw.events.summary(),
+		Valuation: bw.valuations.stats(),
+		Quota:     bw.tiingo.Budget.Usage(),
+		Queue:     bw.pipeline.snapshot(),
+	}})
+}
@@ -0,0 +1,310 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/migrations"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// registerMigrations registers the schema migrations of every collection the bot worker owns.
+// New migrations must be appended with the next version number and never edited once released.
+func (bw *BotWorker) registerMigrations() error {
+	err := bw.migrator.Register(bw.collections.Bots, portfolioMigrations()...)
+	if err != nil {
+		return err
+	}
+
+	// Shadow portfolios are created at the schema version of bots, so they share the migrations of bots
+	err = bw.migrator.RegisterGroup(bw.collections.Shadows, portfolioMigrations()...)
+	if err != nil {
+		return err
+	}
+
+	err = bw.migrator.Register(bw.collections.OrderGroups, migrations.Migration{
+		Version:     1,
+		Description: "normalize the tickers of orders to their canonical spelling",
+		Migrate: func(data map[string]any) error {
+			orders, _ := data["orders"].([]any)
+			for _, order := range orders {
+				canonicalizeTicker(order)
+			}
+
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = bw.migrator.Register(bw.collections.PriceAlerts, migrations.Migration{
+		Version:     1,
+		Description: "normalize tickers to their canonical spelling",
+		Migrate: func(data map[string]any) error {
+			canonicalizeTicker(data)
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.migrator.Register(bw.collections.Transactions, migrations.Migration{
+		Version:     1,
+		Description: "normalize tickers to upper case and actions to lower case",
+		Migrate: func(data map[string]any) error {
+			if ticker, ok := data["ticker"].(string); ok {
+				data["ticker"] = strings.ToUpper(ticker)
+			}
+
+			if action, ok := data["action"].(string); ok {
+				data["action"] = strings.ToLower(action)
+			}
+
+			return nil
+		},
+	}, migrations.Migration{
+		Version:     2,
+		Description: "record the base currency as the currency of existing transactions",
+		Migrate:     setBaseCurrency,
+	}, migrations.Migration{
+		Version:     3,
+		Description: "normalize tickers to their canonical spelling",
+		Migrate: func(data map[string]any) error {
+			canonicalizeTicker(data)
+			return nil
+		},
+	})
+}
+
+// portfolioMigrations returns the migrations of bot and shadow portfolio documents
+func portfolioMigrations() []migrations.Migration {
+	return []migrations.Migration{{
+		Version:     1,
+		Description: "initialize missing cash, holdings, transactions and historical account values",
+		Migrate: func(data map[string]any) error {
+			if _, ok := data["cash"]; !ok {
+				data["cash"] = 0.0
+			}
+
+			if data["holdings"] == nil {
+				data["holdings"] = map[string]any{}
+			}
+
+			if data["transactions"] == nil {
+				data["transactions"] = []any{}
+			}
+
+			if data["historicalAccountValue"] == nil {
+				data["historicalAccountValue"] = []any{}
+			}
+
+			return nil
+		},
+	}, {
+		Version:     2,
+		Description: "record the base currency as the currency of record of existing portfolios",
+		Migrate:     setBaseCurrency,
+	}, {
+		Version:     3,
+		Description: "move holdings without shares to the closed positions",
+		Migrate:     closeEmptyHoldings,
+	}, {
+		Version:     4,
+		Description: "merge holdings of the same security held under different ticker spellings",
+		Migrate:     canonicalizeHoldings,
+	}, {
+		Version:     5,
+		Description: "record the cost basis method existing portfolios were traded with",
+		Migrate:     setCostBasisMethod,
+	}}
+}
+
+// migrateRestored migrates the collections that the order book, protections and price alerts are restored from, so
+// they are indexed under the tickers that receive prices even before the first batch migration ran
+func (bw *BotWorker) migrateRestored() error {
+	for _, collection := range []string{bw.collections.Bots, bw.collections.Shadows, bw.collections.OrderGroups, bw.collections.PriceAlerts} {
+		report, err := bw.migrator.MigrateCollection(context.Background(), collection)
+		if err != nil {
+			return fmt.Errorf("error migrating %s: %v", collection, err)
+		}
+
+		if report.Failed > 0 {
+			log.Printf("%d documents in %s failed to migrate: %v\n", report.Failed, collection, report.Errors)
+		}
+	}
+
+	return nil
+}
+
+// canonicalizeTicker normalizes the ticker field of raw document data to its canonical spelling
+func canonicalizeTicker(data any) {
+	if data, ok := data.(map[string]any); ok {
+		if ticker, ok := data["ticker"].(string); ok {
+			data["ticker"] = symbols.Canonical(ticker)
+		}
+	}
+}
+
+// setBaseCurrency sets the currency of a document to the base currency if it has none
+func setBaseCurrency(data map[string]any) error {
+	if currency, _ := data["currency"].(string); currency == "" {
+		data["currency"] = money.BaseCurrency
+	}
+
+	return nil
+}
+
+// setCostBasisMethod records the cost basis method of a portfolio that has none. Until portfolios stored their
+// method every portfolio used COST_BASIS_METHOD, and holdings with lots were traded with FIFO whatever it is now.
+func setCostBasisMethod(data map[string]any) error {
+	if method, _ := data["costBasisMethod"].(string); method != "" {
+		return nil
+	}
+
+	method := models.DefaultCostBasisMethod()
+	holdings, _ := data["holdings"].(map[string]any)
+	for _, holding := range holdings {
+		if holding, ok := holding.(map[string]any); ok {
+			if lots, _ := holding["lots"].([]any); len(lots) > 0 {
+				method = models.FIFO
+				break
+			}
+		}
+	}
+
+	data["costBasisMethod"] = string(method)
+	return nil
+}
+
+// closeEmptyHoldings removes the holdings that were sold completely before closed positions were recorded.
+// When they were closed is unknown, so their closing time is left zero.
+func closeEmptyHoldings(data map[string]any) error {
+	closed, _ := data["closedPositions"].([]any)
+	if closed == nil {
+		closed = []any{}
+	}
+
+	holdings, _ := data["holdings"].(map[string]any)
+	tickers := make([]string, 0, len(holdings))
+	for ticker := range holdings {
+		tickers = append(tickers, ticker)
+	}
+
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		holding, ok := holdings[ticker].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if numShares, _ := holding["numShares"].(float64); numShares > models.DustShares {
+			continue
+		}
+
+		realizedGain, _ := holding["realizedGain"].(float64)
+		closed = append(closed, map[string]any{"ticker": ticker, "realizedGain": realizedGain, "closedAt": time.Time{}})
+		delete(holdings, ticker)
+	}
+
+	data["closedPositions"] = closed
+	return nil
+}
+
+// canonicalizeHoldings renames the holdings and closed positions of a portfolio to the canonical spelling of their
+// tickers. A holding held under two spellings, such as "BRK-B" and "BRK.B", is merged into one with the shares,
+// realized gains and lots of both and their average purchase price.
+func canonicalizeHoldings(data map[string]any) error {
+	holdings, _ := data["holdings"].(map[string]any)
+	tickers := make([]string, 0, len(holdings))
+	for ticker := range holdings {
+		tickers = append(tickers, ticker)
+	}
+
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		canonical := symbols.Canonical(ticker)
+		if canonical == ticker {
+			continue
+		}
+
+		holding := holdings[ticker]
+		delete(holdings, ticker)
+
+		existing, ok := holdings[canonical].(map[string]any)
+		moved, movedOk := holding.(map[string]any)
+		if !ok || !movedOk {
+			holdings[canonical] = holding
+			continue
+		}
+
+		mergeHolding(existing, moved)
+	}
+
+	closed, _ := data["closedPositions"].([]any)
+	for _, position := range closed {
+		canonicalizeTicker(position)
+	}
+
+	return nil
+}
+
+// mergeHolding adds the shares, realized gain and lots of a holding to another holding of the same security
+func mergeHolding(holding, other map[string]any) {
+	numShares, _ := holding["numShares"].(float64)
+	otherShares, _ := other["numShares"].(float64)
+	purchaseValue, _ := holding["purchaseValue"].(float64)
+	otherValue, _ := other["purchaseValue"].(float64)
+	realizedGain, _ := holding["realizedGain"].(float64)
+	otherGain, _ := other["realizedGain"].(float64)
+
+	holding["numShares"] = numShares + otherShares
+	holding["realizedGain"] = realizedGain + otherGain
+	if numShares+otherShares > 0 {
+		holding["purchaseValue"] = (numShares*purchaseValue + otherShares*otherValue) / (numShares + otherShares)
+	}
+
+	lots, _ := holding["lots"].([]any)
+	otherLots, _ := other["lots"].([]any)
+	if len(otherLots) > 0 {
+		lots = append(lots, otherLots...)
+		sort.SliceStable(lots, func(i, j int) bool {
+			first, _ := lots[i].(map[string]any)
+			second, _ := lots[j].(map[string]any)
+			firstTime, _ := first["time"].(time.Time)
+			secondTime, _ := second["time"].(time.Time)
+			return firstTime.Before(secondTime)
+		})
+
+		holding["lots"] = lots
+	}
+
+	if holding["protection"] == nil && other["protection"] != nil {
+		holding["protection"] = other["protection"]
+	}
+}
+
+// migrateAll runs the batch migration of every collection
+func (bw *BotWorker) migrateAll() error {
+	return bw.migrator.MigrateAll(context.Background())
+}
+
+// GetMigrations returns the registered migrations and last batch report of every collection.
+// @Summary Get schema migrations
+// @Description Retrieves the latest schema version, registered migrations and last batch report of every collection
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Migration status"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/migrations [get]
+func (bw *BotWorker) GetMigrations(c *gin.Context) {
+	c.JSON(200, &DataPacket{"migrations", bw.migrator.Status()})
+}
@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"testing"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+func TestSetCostBasisMethod(t *testing.T) {
+	models.SetDefaultCostBasisMethod(models.AverageCost)
+
+	tests := []struct {
+		name string
+		data map[string]any
+		want string
+	}{
+		{"no holdings", map[string]any{}, "average"},
+		{"holdings without lots", map[string]any{"holdings": map[string]any{"AAPL": map[string]any{"numShares": 5.0}}}, "average"},
+		{"holdings with lots", map[string]any{"holdings": map[string]any{
+			"AAPL": map[string]any{"numShares": 5.0},
+			"MSFT": map[string]any{"numShares": 2.0, "lots": []any{map[string]any{"numShares": 2.0}}},
+		}}, "fifo"},
+		{"method already recorded", map[string]any{"costBasisMethod": "fifo"}, "fifo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := setCostBasisMethod(tt.data); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := tt.data["costBasisMethod"]; got != tt.want {
+				t.Errorf("costBasisMethod = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
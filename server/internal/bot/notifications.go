@@ -0,0 +1,391 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// defaultMarginCallPercent is the percent of its inception value a bot's account value can fall to before a margin call
+const defaultMarginCallPercent = 50.0
+
+// notificationTimeout is how long sending a single email can take
+const notificationTimeout = 30 * time.Second
+
+//go:embed templates/email/*.tmpl
+var emailFS embed.FS
+
+// Email templates, each kind defines "<kind>.subject", "<kind>.text" and "<kind>.html"
+var (
+	emailTextTemplates = template.Must(template.ParseFS(emailFS, "templates/email/*.tmpl"))
+	emailHTMLTemplates = htmltemplate.Must(htmltemplate.ParseFS(emailFS, "templates/email/*.tmpl"))
+)
+
+// NotificationsRequestData represents a request to change the email notifications of the authenticated bot
+type NotificationsRequestData struct {
+	Email string   `json:"email"` // Address notifications are sent to, empty to turn notifications off
+	Kinds []string `json:"kinds"` // Kinds of notifications to send
+}
+
+// NotificationsStatus reports the email notifications of a bot
+type NotificationsStatus struct {
+	Enabled   bool                         `json:"enabled"`   // Whether the server can send emails
+	Available []string                     `json:"available"` // Every kind of notification
+	Settings  *models.NotificationSettings `json:"settings"`  // Notifications the bot opted into
+}
+
+// WarningRequestData represents an admin request to warn a bot that it may be disqualified
+type WarningRequestData struct {
+	Reason string `json:"reason" binding:"required"` // Why the bot may be disqualified, included in the email
+}
+
+// APIKeyRotation is the result of rotating the API key of a bot
+type APIKeyRotation struct {
+	APIKey    string    `json:"apiKey"`    // New API key, only shown once
+	RotatedAt time.Time `json:"rotatedAt"` // When the key was rotated
+	Notified  bool      `json:"notified"`  // Whether a confirmation email is being sent
+}
+
+// notificationEmail is the data email templates are rendered with
+type notificationEmail struct {
+	BotID    string // ID of the bot document
+	BotName  string // Display name of the bot, the bot ID if it has none
+	Currency string // Currency of the bot's amounts
+	Data     any    // Data of the notification kind
+}
+
+// marginCallData is the data of a margin call email
+type marginCallData struct {
+	AccountValue   float64
+	InceptionValue float64
+	Cash           float64
+	Percent        float64 // Account value in percent of the inception value
+	Threshold      float64 // Percent of the inception value that triggers a margin call
+	Positions      int
+}
+
+// weeklySummaryData is the data of a weekly summary email
+type weeklySummaryData struct {
+	WeekEnd      time.Time
+	AccountValue float64
+	Cash         float64
+	WeekReturn   float64 // Return over the week in percent
+	TotalReturn  float64 // Return since inception in percent
+	Positions    int
+}
+
+// parseMarginCallPercent parses MARGIN_CALL_PERCENT, which defaults to defaultMarginCallPercent. 0 disables margin calls.
+func parseMarginCallPercent() (float64, error) {
+	env := os.Getenv("MARGIN_CALL_PERCENT")
+	if env == "" {
+		return defaultMarginCallPercent, nil
+	}
+
+	percent, err := strconv.ParseFloat(env, 64)
+	if err != nil || percent < 0 || percent >= 100 {
+		return 0, fmt.Errorf("invalid MARGIN_CALL_PERCENT, must be between 0 and 100: %s", env)
+	}
+
+	return percent, nil
+}
+
+// renderEmail renders the subject and bodies of a kind of notification
+func renderEmail(kind string, data *notificationEmail) (*services.Email, error) {
+	email := &services.Email{}
+	for _, part := range []struct {
+		name   string
+		target *string
+		html   bool
+	}{{kind + ".subject", &email.Subject, false}, {kind + ".text", &email.Text, false}, {kind + ".html", &email.HTML, true}} {
+		buffer := &bytes.Buffer{}
+
+		var err error
+		if part.html {
+			err = emailHTMLTemplates.ExecuteTemplate(buffer, part.name, data)
+		} else {
+			err = emailTextTemplates.ExecuteTemplate(buffer, part.name, data)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error rendering %s: %v", part.name, err)
+		}
+
+		*part.target = buffer.String()
+	}
+
+	return email, nil
+}
+
+// notify emails a notification to the owner of a bot if it opted into the kind, and records when it was sent.
+// The email is sent in the background, returns whether it was queued.
+func (bw *BotWorker) notify(ref *firestore.DocumentRef, portfolio *models.Portfolio, kind string, data any) bool {
+	if bw.mailer == nil || !portfolio.Notifications.Wants(kind) {
+		return false
+	}
+
+	email, err := renderEmail(kind, &notificationEmail{
+		BotID:    ref.ID,
+		BotName:  portfolio.Profile.PublicName(ref.ID),
+		Currency: money.OrBase(portfolio.Currency),
+		Data:     data,
+	})
+	if err != nil {
+		log.Printf("error rendering %s notification of bot %s: %v\n", kind, ref.ID, err)
+		return false
+	}
+
+	email.To = portfolio.Notifications.Email
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		defer cancel()
+
+		err := bw.mailer.Send(ctx, email)
+		if err != nil {
+			log.Printf("error sending %s notification of bot %s: %v\n", kind, ref.ID, err)
+			return
+		}
+
+		log.Printf("sent %s notification of bot %s\n", kind, ref.ID)
+		_, err = ref.Update(context.Background(), []firestore.Update{{FieldPath: firestore.FieldPath{"notifications", "lastSent", kind}, Value: time.Now()}})
+		if err != nil {
+			log.Printf("error recording %s notification of bot %s: %v\n", kind, ref.ID, err)
+		}
+	}()
+
+	return true
+}
+
+// checkMarginCall sends a margin call when a bot's account value fell below MARGIN_CALL_PERCENT of its
+// inception value, at most once a day. Shadow portfolios never receive margin calls.
+func (bw *BotWorker) checkMarginCall(ref *firestore.DocumentRef, portfolio *models.Portfolio) {
+	if bw.marginCallPercent == 0 || portfolio.InceptionValue <= 0 || ownerOf(ref) != ref {
+		return
+	}
+
+	percent := portfolio.AccountValue / portfolio.InceptionValue * 100
+	if percent >= bw.marginCallPercent || !portfolio.Notifications.Wants(models.NotificationMarginCall) {
+		return
+	}
+
+	now := time.Now().UTC()
+	if last := portfolio.Notifications.LastSent[models.NotificationMarginCall]; last.UTC().Truncate(24 * time.Hour).Equal(now.Truncate(24 * time.Hour)) {
+		return
+	}
+
+	bw.notify(ref, portfolio, models.NotificationMarginCall, &marginCallData{
+		AccountValue:   portfolio.AccountValue,
+		InceptionValue: portfolio.InceptionValue,
+		Cash:           portfolio.Cash,
+		Percent:        percent,
+		Threshold:      bw.marginCallPercent,
+		Positions:      len(portfolio.Holdings),
+	})
+}
+
+// sendWeeklySummaries emails the performance of the past week to every bot that opted into weekly summaries
+func (bw *BotWorker) sendWeeklySummaries() error {
+	if bw.mailer == nil {
+		return nil
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Bots).Where("notifications.kinds", "array-contains", models.NotificationWeeklySummary).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving bots: %v", err)
+	}
+
+	now := time.Now()
+	weekAgo := now.AddDate(0, 0, -7)
+	for _, doc := range docs {
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil {
+			continue
+		}
+
+		// The week starts at the last value recorded a week ago, or the inception value for newer bots
+		weekStart := portfolio.InceptionValue
+		for _, history := range portfolio.HistoricalAccountValue {
+			if history.Date.After(weekAgo) {
+				break
+			}
+
+			weekStart = history.Value
+		}
+
+		summary := &weeklySummaryData{
+			WeekEnd:      now,
+			AccountValue: portfolio.AccountValue,
+			Cash:         portfolio.Cash,
+			Positions:    len(portfolio.Holdings),
+		}
+
+		if weekStart > 0 {
+			summary.WeekReturn = (portfolio.AccountValue/weekStart - 1) * 100
+		}
+
+		if portfolio.InceptionValue > 0 {
+			summary.TotalReturn = (portfolio.AccountValue/portfolio.InceptionValue - 1) * 100
+		}
+
+		bw.notify(doc.Ref, portfolio, models.NotificationWeeklySummary, summary)
+	}
+
+	return nil
+}
+
+// GetNotifications returns the email notifications of the authenticated bot.
+// @Summary Get email notifications
+// @Description Retrieves the email address and kinds of notifications the authenticated bot opted into, and whether the server can send emails
+// @Tags notifications
+// @Produce json
+// @Success 200 {object} DataPacket "Notification settings"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /notifications [get]
+func (bw *BotWorker) GetNotifications(c *gin.Context) {
+	portfolio, _, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	settings := portfolio.Notifications
+	if settings == nil {
+		settings = &models.NotificationSettings{Kinds: make([]string, 0)}
+	}
+
+	c.JSON(200, &DataPacket{"notifications", &NotificationsStatus{Enabled: bw.mailer != nil, Available: models.NotificationKinds, Settings: settings}})
+}
+
+// UpdateNotifications replaces the email notifications of the authenticated bot.
+// @Summary Update email notifications
+// @Description Opts the authenticated bot into the given kinds of notifications: margin_call, disqualification_warning, weekly_summary and api_key_rotated. An empty list of kinds turns notifications off
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param notifications body NotificationsRequestData true "Notification settings"
+// @Success 200 {object} DataPacket "Updated settings"
+// @Failure 400 {object} ResultData "Invalid settings"
+// @Router /notifications [put]
+func (bw *BotWorker) UpdateNotifications(c *gin.Context) {
+	portfolio, ref, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	request := &NotificationsRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	settings := &models.NotificationSettings{Email: request.Email, Kinds: request.Kinds}
+	if settings.Kinds == nil {
+		settings.Kinds = make([]string, 0)
+	}
+
+	err = settings.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	// Keep the send times, so changing the address does not repeat today's margin call
+	if portfolio.Notifications != nil {
+		settings.LastSent = portfolio.Notifications.LastSent
+	}
+
+	_, err = ref.Update(context.Background(), []firestore.Update{{Path: "notifications", Value: settings}})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save notifications", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"notifications", &NotificationsStatus{Enabled: bw.mailer != nil, Available: models.NotificationKinds, Settings: settings}})
+}
+
+// RotateAPIKey replaces the API key of the authenticated bot and emails a confirmation if the bot opted in.
+// @Summary Rotate API key
+// @Description Replaces the API key of the authenticated bot. The previous key stops working immediately and the new key is only shown once
+// @Tags notifications
+// @Produce json
+// @Success 200 {object} DataPacket "New API key"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /api_key/rotate [post]
+func (bw *BotWorker) RotateAPIKey(c *gin.Context) {
+	portfolio, ref, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	rotation := &APIKeyRotation{APIKey: newAPIKey(), RotatedAt: time.Now()}
+	_, err := ref.Update(context.Background(), []firestore.Update{{Path: "apiKey", Value: rotation.APIKey}})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to rotate api key", false))
+		return
+	}
+
+	log.Printf("rotated api key of bot %s\n", ref.ID)
+	rotation.Notified = bw.notify(ref, portfolio, models.NotificationAPIKeyRotated, &struct {
+		RotatedAt time.Time
+		ClientIP  string
+	}{rotation.RotatedAt, c.ClientIP()})
+
+	c.JSON(200, &DataPacket{"api_key", rotation})
+}
+
+// WarnBot warns a bot that it may be disqualified, by email if the bot opted into warnings.
+// @Summary Warn a bot of disqualification
+// @Description Sends a disqualification warning to the owner of a bot that opted into disqualification_warning notifications. The warning is recorded in the audit trail either way
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Bot ID"
+// @Param warning body WarningRequestData true "Warning"
+// @Success 200 {object} ResultData "Warning recorded"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /admin/bots/{id}/warn [post]
+func (bw *BotWorker) WarnBot(c *gin.Context) {
+	request := &WarningRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: a reason is required", false))
+		return
+	}
+
+	doc, err := bw.db.Collection(bw.collections.Bots).Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found", false))
+		return
+	}
+
+	portfolio := &models.Portfolio{}
+	err = doc.DataTo(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bot", false))
+		return
+	}
+
+	notified := bw.notify(doc.Ref, portfolio, models.NotificationDisqualificationWarning, request)
+	bw.audit(c, "bot.warn", fmt.Sprintf("warned bot %s of disqualification (emailed: %v): %s", doc.Ref.ID, notified, request.Reason), request)
+
+	message := "warning recorded, the bot did not opt into warning emails"
+	if notified {
+		message = "warning recorded and emailed to the bot's owner"
+	}
+
+	c.JSON(200, NewResultPacket(message, true))
+}
@@ -0,0 +1,349 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/services"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Onboarding job statuses
+const (
+	OnboardingRunning   = "running"   // Tickers are still being downloaded
+	OnboardingCompleted = "completed" // Every ticker was downloaded or failed
+)
+
+// Limits of bulk ticker onboarding
+const (
+	maxOnboardingTickers   = 2000             // Most tickers a single job accepts
+	onboardingCheckpoint   = 25               // Downloads between two checkpoints
+	onboardingQuotaBackoff = time.Minute      // Wait before checking the quota again once it is used up
+	onboardingRetryBackoff = 30 * time.Second // Wait before retrying a download after the source failed
+	onboardingRetries      = 5                // Retries of a download before the ticker fails
+)
+
+// OnboardingJob is a bulk ticker download, stored in the onboarding_jobs collection.
+// Tickers only count as completed once their history is saved to the caches, so a job
+// resumed after a restart never skips a ticker that was not saved.
+type OnboardingJob struct {
+	ID        string            `json:"id" firestore:"-"`                // ID of the job document
+	Status    string            `json:"status" firestore:"status"`       // "running" or "completed"
+	Tickers   []string          `json:"tickers" firestore:"tickers"`     // Every requested ticker
+	Completed []string          `json:"completed" firestore:"completed"` // Tickers whose history is saved
+	Failed    map[string]string `json:"failed" firestore:"failed"`       // Error of every ticker that failed to download
+	CreatedAt time.Time         `json:"createdAt" firestore:"createdAt"` // When the job was created
+	UpdatedAt time.Time         `json:"updatedAt" firestore:"updatedAt"` // When the job last checkpointed
+	Remaining int               `json:"remaining" firestore:"-"`         // Tickers neither completed nor failed
+
+	Downloading []*TickerStatus `json:"downloading" firestore:"-"` // Tickers whose history is downloading with the bars received so far
+}
+
+// OnboardingRequestData represents a request to onboard many tickers at once
+type OnboardingRequestData struct {
+	Tickers []string `json:"tickers"` // Ticker symbols to download
+}
+
+// remaining returns the tickers of the job that are neither completed nor failed
+func (job *OnboardingJob) remaining() []string {
+	remaining := make([]string, 0, len(job.Tickers))
+	for _, ticker := range job.Tickers {
+		if _, failed := job.Failed[ticker]; !failed && !slices.Contains(job.Completed, ticker) {
+			remaining = append(remaining, ticker)
+		}
+	}
+
+	return remaining
+}
+
+// onboardingRun tracks the downloads of a running job between checkpoints
+type onboardingRun struct {
+	mu      sync.Mutex
+	ref     *firestore.DocumentRef
+	pending []string // Downloaded tickers that are not saved yet
+}
+
+// loadOnboardingJob loads an onboarding job by its document reference
+func loadOnboardingJob(ref *firestore.DocumentRef) (*OnboardingJob, error) {
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	job := &OnboardingJob{}
+	err = doc.DataTo(job)
+	if err != nil {
+		return nil, err
+	}
+
+	job.ID = doc.Ref.ID
+	if job.Failed == nil {
+		job.Failed = make(map[string]string)
+	}
+
+	job.Remaining = len(job.remaining())
+	return job, nil
+}
+
+// resumeOnboarding restarts the onboarding jobs that were running when the server stopped
+func (bw *BotWorker) resumeOnboarding() error {
+	docs, err := bw.db.Collection(bw.collections.OnboardingJobs).Where("status", "==", OnboardingRunning).Documents(context.Background()).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		job, err := loadOnboardingJob(doc.Ref)
+		if err != nil {
+			return fmt.Errorf("failed to load onboarding job %s: %v", doc.Ref.ID, err)
+		}
+
+		log.Printf("resuming onboarding job %s with %d of %d tickers remaining\n", job.ID, job.Remaining, len(job.Tickers))
+		bw.watchlist.AddTickers(job.Tickers...)
+		go bw.runOnboarding(doc.Ref, job.remaining())
+	}
+
+	return nil
+}
+
+// runOnboarding downloads tickers with a bounded pool of workers. Tickers are checkpointed after
+// every few downloads, and the job completes once every ticker was downloaded or failed.
+func (bw *BotWorker) runOnboarding(ref *firestore.DocumentRef, tickers []string) {
+	run := &onboardingRun{ref: ref}
+
+	bw.tickers.mu.Lock()
+	for _, ticker := range tickers {
+		bw.tickers.statuses[ticker] = &TickerStatus{Ticker: ticker, JobID: ref.ID, State: TickerQueued, UpdatedAt: time.Now()}
+	}
+	bw.tickers.mu.Unlock()
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for range bw.tiingo.Workers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ticker := range queue {
+				bw.onboardTicker(run, ticker)
+			}
+		}()
+	}
+
+	for _, ticker := range tickers {
+		queue <- ticker
+	}
+
+	close(queue)
+	wg.Wait()
+
+	bw.checkpointOnboarding(run)
+
+	_, err := ref.Update(context.Background(), []firestore.Update{
+		{Path: "status", Value: OnboardingCompleted},
+		{Path: "updatedAt", Value: time.Now()},
+	})
+	if err != nil {
+		log.Printf("error completing onboarding job %s: %v\n", ref.ID, err)
+	}
+
+	log.Printf("onboarding job %s completed\n", ref.ID)
+	bw.updateCurrPrices()
+}
+
+// onboardTicker downloads a single ticker of an onboarding job. Downloads wait while the
+// request quota is used up, so a bulk job never spends the requests reserved for held and
+// ordered tickers, and are retried a few times when the source fails.
+func (bw *BotWorker) onboardTicker(run *onboardingRun, ticker string) {
+	for bw.tiingo.Monitor.Budget(services.SourceTiingo) == 0 {
+		time.Sleep(onboardingQuotaBackoff)
+	}
+
+	bw.tickers.setState(ticker, TickerDownloading, nil)
+
+	err := bw.tiingo.HistoricalDaily(ticker)
+	for retry := 0; err != nil && retryable(err) && retry < onboardingRetries; retry++ {
+		log.Printf("error downloading %s, retrying: %v\n", ticker, err)
+		time.Sleep(onboardingRetryBackoff)
+		err = bw.tiingo.HistoricalDaily(ticker)
+	}
+
+	if err != nil {
+		log.Printf("error downloading %s: %v\n", ticker, err)
+		bw.tickers.setState(ticker, TickerFailed, err)
+		_, updateErr := run.ref.Update(context.Background(), []firestore.Update{
+			{FieldPath: firestore.FieldPath{"failed", ticker}, Value: err.Error()},
+		})
+		if updateErr != nil {
+			log.Printf("error recording failed ticker %s of onboarding job %s: %v\n", ticker, run.ref.ID, updateErr)
+		}
+
+		return
+	}
+
+	bw.tickers.setState(ticker, TickerCalculating, nil)
+
+	bw.tickers.downloadMu.Lock()
+	bw.tiingo.CalculateTickerIndicators(ticker)
+	bw.tickers.downloadMu.Unlock()
+
+	bw.tickers.setState(ticker, TickerReady, nil)
+	bw.resolveListing(ticker)
+
+	run.mu.Lock()
+	run.pending = append(run.pending, ticker)
+	full := len(run.pending) >= onboardingCheckpoint
+	run.mu.Unlock()
+
+	if full {
+		bw.checkpointOnboarding(run)
+	}
+}
+
+// retryable checks whether a failed download may succeed when it is retried
+func retryable(err error) bool {
+	switch failureReason(err) {
+	case services.ReasonNotFound, services.ReasonUnauthorized, services.ReasonNotConfigured:
+		return false
+	default:
+		return true
+	}
+}
+
+// checkpointOnboarding saves the caches and then marks the downloaded tickers as completed
+func (bw *BotWorker) checkpointOnboarding(run *onboardingRun) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if len(run.pending) == 0 {
+		return
+	}
+
+	bw.tickers.downloadMu.Lock()
+	err := bw.tiingo.SaveCaches()
+	bw.tickers.downloadMu.Unlock()
+	if err != nil {
+		// The tickers are downloaded again if the job is resumed before the next checkpoint
+		log.Printf("error saving caches for onboarding job %s: %v\n", run.ref.ID, err)
+		return
+	}
+
+	completed := make([]any, 0, len(run.pending))
+	for _, ticker := range run.pending {
+		completed = append(completed, ticker)
+	}
+
+	_, err = run.ref.Update(context.Background(), []firestore.Update{
+		{Path: "completed", Value: firestore.ArrayUnion(completed...)},
+		{Path: "updatedAt", Value: time.Now()},
+	})
+	if err != nil {
+		log.Printf("error checkpointing onboarding job %s: %v\n", run.ref.ID, err)
+		return
+	}
+
+	run.pending = run.pending[:0]
+}
+
+// OnboardTickers starts a bulk download of many tickers, such as every S&P 500 constituent.
+// @Summary Onboard tickers in bulk
+// @Description Adds up to 2000 tickers to the watchlist and downloads their history in the background with a bounded number of workers. Progress is checkpointed and resumed after a restart
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tickers body OnboardingRequestData true "Tickers to onboard"
+// @Success 202 {object} DataPacket "Started onboarding job"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/tickers/bulk [post]
+func (bw *BotWorker) OnboardTickers(c *gin.Context) {
+	request := &OnboardingRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	now := time.Now()
+	job := &OnboardingJob{
+		Status:    OnboardingRunning,
+		Tickers:   make([]string, 0, len(request.Tickers)),
+		Completed: make([]string, 0),
+		Failed:    make(map[string]string),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, ticker := range request.Tickers {
+		ticker = symbols.Canonical(ticker)
+		if ticker == "" || slices.Contains(job.Tickers, ticker) {
+			continue
+		}
+
+		job.Tickers = append(job.Tickers, ticker)
+
+		// Cached tickers are not downloaded again
+		if bw.tiingo.Cached(ticker) {
+			job.Completed = append(job.Completed, ticker)
+		}
+	}
+
+	if len(job.Tickers) == 0 || len(job.Tickers) > maxOnboardingTickers {
+		c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: between 1 and %d tickers are required", maxOnboardingTickers), false))
+		return
+	}
+
+	ref, _, err := bw.db.Collection(bw.collections.OnboardingJobs).Add(context.Background(), job)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to create onboarding job", false))
+		return
+	}
+
+	job.ID = ref.ID
+	job.Remaining = len(job.remaining())
+
+	bw.watchlist.AddTickers(slices.Clone(job.Tickers)...)
+	go bw.runOnboarding(ref, job.remaining())
+
+	c.JSON(202, &DataPacket{"onboarding_job", job})
+}
+
+// GetOnboardingJob returns the progress of a bulk ticker download.
+// @Summary Get onboarding job
+// @Description Reports the completed, failed and remaining tickers of a bulk ticker download as of its last checkpoint
+// @Tags admin
+// @Produce json
+// @Param id path string true "Onboarding job ID"
+// @Success 200 {object} DataPacket "Onboarding job"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Job not found"
+// @Router /admin/tickers/bulk/{id} [get]
+func (bw *BotWorker) GetOnboardingJob(c *gin.Context) {
+	job, err := loadOnboardingJob(bw.db.Collection(bw.collections.OnboardingJobs).Doc(c.Param("id")))
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: onboarding job not found", false))
+		return
+	}
+
+	job.Downloading = make([]*TickerStatus, 0)
+	bw.tickers.mu.Lock()
+	for _, status := range bw.tickers.statuses {
+		if status.JobID == job.ID && status.State == TickerDownloading {
+			copied := *status
+			job.Downloading = append(job.Downloading, &copied)
+		}
+	}
+	bw.tickers.mu.Unlock()
+
+	sort.Slice(job.Downloading, func(a, b int) bool {
+		return job.Downloading[a].Ticker < job.Downloading[b].Ticker
+	})
+
+	c.JSON(200, &DataPacket{"onboarding_job", job})
+}
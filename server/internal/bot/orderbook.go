@@ -0,0 +1,302 @@
+package bot
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/utils"
+)
+
+// BookEntry is an open order indexed by the price that triggers it
+type BookEntry struct {
+	Order   *models.Order      // The open order
+	Group   *models.OrderGroup // The group the order belongs to
+	trigger float64            // Price at which the order triggers
+}
+
+// compareBookEntries orders book entries by trigger price, breaking ties by order ID
+func compareBookEntries(a, b *BookEntry) int {
+	if c := cmp.Compare(a.trigger, b.trigger); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.Order.ID, b.Order.ID)
+}
+
+// tickerBook holds the open orders of a single ticker sorted by trigger price,
+// so a price tick only visits the orders it can actually trigger.
+type tickerBook struct {
+	fallTriggered *utils.TreeSet[*BookEntry] // Triggered when the price falls to or below the trigger: buy limits and sell stops
+	riseTriggered *utils.TreeSet[*BookEntry] // Triggered when the price rises to or above the trigger: sell limits and buy stops
+	market        map[string]*BookEntry      // Market orders, triggered by any price
+}
+
+// newTickerBook creates an empty ticker book
+func newTickerBook() *tickerBook {
+	return &tickerBook{
+		fallTriggered: utils.NewTreeSet[*BookEntry](compareBookEntries),
+		riseTriggered: utils.NewTreeSet[*BookEntry](compareBookEntries),
+		market:        make(map[string]*BookEntry),
+	}
+}
+
+// side returns the sorted set an order belongs in, or nil for market orders
+func (tb *tickerBook) side(order *models.Order) *utils.TreeSet[*BookEntry] {
+	switch {
+	case order.Type == models.OrderTypeLimit && order.Action == "buy",
+		order.Type == models.OrderTypeStop && order.Action == "sell":
+		return tb.fallTriggered
+	case order.Type == models.OrderTypeLimit, order.Type == models.OrderTypeStop:
+		return tb.riseTriggered
+	default:
+		return nil
+	}
+}
+
+// crossable returns every entry that the given price triggers, oldest order first
+func (tb *tickerBook) crossable(price float64) []*BookEntry {
+	// Falling side: every entry with trigger >= price
+	entries := tb.fallTriggered.Above(func(e *BookEntry) int {
+		return cmp.Compare(e.trigger, price)
+	})
+
+	// Rising side: every entry with trigger <= price
+	entries = append(entries, tb.riseTriggered.Below(func(e *BookEntry) int {
+		return cmp.Compare(e.trigger, price)
+	})...)
+
+	for _, entry := range tb.market {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Order.CreatedAt.Before(entries[b].Order.CreatedAt)
+	})
+
+	return entries
+}
+
+// orderBook holds the conditional order groups of every bot in memory.
+// Open orders are additionally indexed per ticker by trigger price.
+type orderBook struct {
+	sync.Mutex
+	groups  map[string]*models.OrderGroup // Groups by group ID
+	active  map[string]*models.OrderGroup // Active groups by group ID
+	byBot   map[string][]string           // Group IDs by bot ID, oldest first
+	tickers map[string]*tickerBook        // Open orders by ticker
+	indexed map[string]*BookEntry         // Indexed open orders by order ID
+	queued  map[string][]*BookEntry       // Orders queued for the open by ticker, oldest first
+}
+
+// NewOrderBook creates an empty in-memory order book
+func NewOrderBook() OrderBook {
+	return &orderBook{
+		groups:  make(map[string]*models.OrderGroup),
+		active:  make(map[string]*models.OrderGroup),
+		byBot:   make(map[string][]string),
+		tickers: make(map[string]*tickerBook),
+		indexed: make(map[string]*BookEntry),
+		queued:  make(map[string][]*BookEntry),
+	}
+}
+
+// Add adds a new group to the book. The caller must hold the lock.
+func (ob *orderBook) Add(group *models.OrderGroup) {
+	ob.groups[group.ID] = group
+	ob.byBot[group.Bot.ID] = append(ob.byBot[group.Bot.ID], group.ID)
+	ob.Reindex(group)
+}
+
+// Reindex brings the index in line with the status of a group's orders after it changed.
+// Open and partially filled orders are added to their ticker book and every other order is removed.
+// Orders queued for the open are indexed separately by ticker. The caller must hold the lock.
+func (ob *orderBook) Reindex(group *models.OrderGroup) {
+	if group.Status == models.OrderGroupActive {
+		ob.active[group.ID] = group
+	} else {
+		delete(ob.active, group.ID)
+	}
+
+	for _, order := range group.Orders {
+		ob.reindexQueued(order, group)
+		entry, indexed := ob.indexed[order.ID]
+
+		switch {
+		case order.Active() && !indexed:
+			ob.insert(order, group)
+		case !order.Active() && indexed:
+			ob.remove(entry)
+		}
+	}
+}
+
+// reindexQueued adds an order queued for the open to the queue of its ticker, or removes it once it left the queue.
+// The caller must hold the lock.
+func (ob *orderBook) reindexQueued(order *models.Order, group *models.OrderGroup) {
+	queue := ob.queued[order.Ticker]
+	index := slices.IndexFunc(queue, func(entry *BookEntry) bool {
+		return entry.Order.ID == order.ID
+	})
+
+	switch {
+	case order.Queued() && index < 0:
+		// Orders are queued when they are placed, so appending keeps the queue oldest first
+		ob.queued[order.Ticker] = append(queue, &BookEntry{Order: order, Group: group})
+	case !order.Queued() && index >= 0:
+		queue = slices.Delete(queue, index, index+1)
+		if len(queue) == 0 {
+			delete(ob.queued, order.Ticker)
+		} else {
+			ob.queued[order.Ticker] = queue
+		}
+	}
+}
+
+// insert indexes an open order. The caller must hold the lock.
+func (ob *orderBook) insert(order *models.Order, group *models.OrderGroup) {
+	book, ok := ob.tickers[order.Ticker]
+	if !ok {
+		book = newTickerBook()
+		ob.tickers[order.Ticker] = book
+	}
+
+	entry := &BookEntry{Order: order, Group: group}
+	switch order.Type {
+	case models.OrderTypeLimit:
+		entry.trigger = order.LimitPrice
+	case models.OrderTypeStop:
+		entry.trigger = order.StopPrice
+	}
+
+	if side := book.side(order); side != nil {
+		side.Insert(entry)
+	} else {
+		book.market[order.ID] = entry
+	}
+
+	ob.indexed[order.ID] = entry
+}
+
+// RemoveBot removes every group of a bot along with its open and queued orders, once the bot no longer exists.
+// The caller must hold the lock.
+func (ob *orderBook) RemoveBot(botID string) {
+	for _, id := range ob.byBot[botID] {
+		group := ob.groups[id]
+		for _, order := range group.Orders {
+			if entry, ok := ob.indexed[order.ID]; ok {
+				ob.remove(entry)
+			}
+
+			queue := ob.queued[order.Ticker]
+			queue = slices.DeleteFunc(queue, func(entry *BookEntry) bool {
+				return entry.Order.ID == order.ID
+			})
+			if len(queue) == 0 {
+				delete(ob.queued, order.Ticker)
+			} else {
+				ob.queued[order.Ticker] = queue
+			}
+		}
+
+		delete(ob.groups, id)
+		delete(ob.active, id)
+	}
+
+	delete(ob.byBot, botID)
+}
+
+// Group returns a group by ID. The caller must hold the lock.
+func (ob *orderBook) Group(id string) (*models.OrderGroup, bool) {
+	group, ok := ob.groups[id]
+	return group, ok
+}
+
+// BotGroups returns the groups placed by a bot, newest first. The caller must hold the lock.
+func (ob *orderBook) BotGroups(botID string) []*models.OrderGroup {
+	ids := ob.byBot[botID]
+	groups := make([]*models.OrderGroup, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		groups = append(groups, ob.groups[ids[i]])
+	}
+
+	return groups
+}
+
+// ActiveGroups returns every group that can still fill. The caller must hold the lock.
+func (ob *orderBook) ActiveGroups() []*models.OrderGroup {
+	groups := make([]*models.OrderGroup, 0, len(ob.active))
+	for _, group := range ob.active {
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// Tickers returns every ticker that has a ticker book. The caller must hold the lock.
+func (ob *orderBook) Tickers() []string {
+	tickers := make([]string, 0, len(ob.tickers))
+	for ticker := range ob.tickers {
+		tickers = append(tickers, ticker)
+	}
+
+	return tickers
+}
+
+// Crossable returns the open orders of a ticker that the given price triggers, oldest order first.
+// The caller must hold the lock.
+func (ob *orderBook) Crossable(ticker string, price float64) []*BookEntry {
+	book, ok := ob.tickers[ticker]
+	if !ok {
+		return nil
+	}
+
+	return book.crossable(price)
+}
+
+// QueuedTickers returns every ticker that has orders queued for the open. The caller must hold the lock.
+func (ob *orderBook) QueuedTickers() []string {
+	tickers := make([]string, 0, len(ob.queued))
+	for ticker := range ob.queued {
+		tickers = append(tickers, ticker)
+	}
+
+	return tickers
+}
+
+// Queued returns the orders of a ticker queued for the open, oldest first. The caller must hold the lock.
+func (ob *orderBook) Queued(ticker string) []*BookEntry {
+	return slices.Clone(ob.queued[ticker])
+}
+
+// OpenTickers returns the number of open or queued orders of every ticker that has any
+func (ob *orderBook) OpenTickers() map[string]int {
+	ob.Lock()
+	defer ob.Unlock()
+
+	counts := make(map[string]int)
+	for _, entry := range ob.indexed {
+		counts[entry.Order.Ticker]++
+	}
+
+	for ticker, queue := range ob.queued {
+		counts[ticker] += len(queue)
+	}
+
+	return counts
+}
+
+// remove removes an indexed order. The caller must hold the lock.
+func (ob *orderBook) remove(entry *BookEntry) {
+	book := ob.tickers[entry.Order.Ticker]
+	if side := book.side(entry.Order); side != nil {
+		side.Remove(entry)
+	} else {
+		delete(book.market, entry.Order.ID)
+	}
+
+	delete(ob.indexed, entry.Order.ID)
+}
@@ -0,0 +1,548 @@
+package bot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// OrderRequestData represents a single conditional order in an order request
+type OrderRequestData struct {
+	Type       string  `json:"type"`       // "market", "limit" or "stop"
+	Action     string  `json:"action"`     // "buy" or "sell"
+	Ticker     string  `json:"ticker"`     // Stock ticker symbol
+	NumShares  float64 `json:"numShares"`  // Number of shares to buy or sell
+	LimitPrice float64 `json:"limitPrice"` // Limit price for limit orders
+	StopPrice  float64 `json:"stopPrice"`  // Stop price for stop orders
+}
+
+// OrderGroupRequestData represents a request to place a group of linked orders
+type OrderGroupRequestData struct {
+	Type        string              `json:"type"`        // "single", "oco" or "bracket"
+	TimeInForce string              `json:"timeInForce"` // "DAY", "GTC" or "GTD", defaults to "GTC"
+	ExpiresAt   time.Time           `json:"expiresAt"`   // Expiry time of a GTD group
+	Orders      []*OrderRequestData `json:"orders"`      // Orders of a single or OCO group
+	Entry       *OrderRequestData   `json:"entry"`       // Entry order of a bracket
+	TakeProfit  float64             `json:"takeProfit"`  // Take-profit price of a bracket
+	StopLoss    float64             `json:"stopLoss"`    // Stop-loss price of a bracket
+	Tag         string              `json:"tag"`         // Optional strategy tag of the fills, used for performance attribution
+}
+
+// ruleError is returned when an order fails the trading rules, as opposed to failing to be saved
+type ruleError struct {
+	err error
+}
+
+// Error returns the reason the order was rejected
+func (re *ruleError) Error() string {
+	return re.err.Error()
+}
+
+// newID generates a random identifier for orders and order groups
+func newID() string {
+	b := make([]byte, 10)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// newOrder creates an order from a request
+func newOrder(request *OrderRequestData, groupID, role, status string, bot *firestore.DocumentRef, now time.Time) *models.Order {
+	return &models.Order{
+		ID:         newID(),
+		GroupID:    groupID,
+		Role:       role,
+		Type:       request.Type,
+		Action:     request.Action,
+		Ticker:     symbols.Canonical(request.Ticker),
+		NumShares:  request.NumShares,
+		LimitPrice: request.LimitPrice,
+		StopPrice:  request.StopPrice,
+		Status:     status,
+		Fills:      make([]*models.OrderFill, 0),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Bot:        bot,
+	}
+}
+
+// buildOrderGroup validates an order group request and builds the group
+func buildOrderGroup(request *OrderGroupRequestData, bot *firestore.DocumentRef) (*models.OrderGroup, error) {
+	now := time.Now()
+	group := &models.OrderGroup{
+		ID:          newID(),
+		Type:        request.Type,
+		Status:      models.OrderGroupActive,
+		TimeInForce: strings.ToUpper(request.TimeInForce),
+		Tag:         request.Tag,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Bot:         bot,
+	}
+
+	if len(request.Tag) > maxStrategyTagLength {
+		return nil, fmt.Errorf("tag must be at most %d characters", maxStrategyTagLength)
+	}
+
+	switch group.TimeInForce {
+	case "":
+		group.TimeInForce = models.TimeInForceGTC
+	case models.TimeInForceDay, models.TimeInForceGTC:
+	case models.TimeInForceGTD:
+		if !request.ExpiresAt.After(now) {
+			return nil, fmt.Errorf("GTD order group requires an expiresAt in the future")
+		}
+
+		group.ExpiresAt = request.ExpiresAt
+	default:
+		return nil, fmt.Errorf("invalid time in force: %s", request.TimeInForce)
+	}
+
+	switch request.Type {
+	case models.OrderGroupSingle, models.OrderGroupOCO:
+		switch {
+		case request.Type == models.OrderGroupSingle && len(request.Orders) != 1:
+			return nil, fmt.Errorf("single order group requires exactly one order")
+		case request.Type == models.OrderGroupOCO && len(request.Orders) < 2:
+			return nil, fmt.Errorf("oco order group requires at least two orders")
+		}
+
+		for _, orderRequest := range request.Orders {
+			group.Orders = append(group.Orders, newOrder(orderRequest, group.ID, models.OrderRoleLeg, models.OrderStatusOpen, bot, now))
+		}
+	case models.OrderGroupBracket:
+		switch {
+		case request.Entry == nil:
+			return nil, fmt.Errorf("bracket order group requires an entry order")
+		case request.Entry.Action != "buy":
+			return nil, fmt.Errorf("bracket entry must be a buy order")
+		case request.StopLoss <= 0 || request.TakeProfit <= request.StopLoss:
+			return nil, fmt.Errorf("bracket requires 0 < stopLoss < takeProfit")
+		}
+
+		entry := newOrder(request.Entry, group.ID, models.OrderRoleEntry, models.OrderStatusOpen, bot, now)
+		exit := &OrderRequestData{Action: "sell", Ticker: entry.Ticker, NumShares: entry.NumShares}
+
+		takeProfit := newOrder(exit, group.ID, models.OrderRoleTakeProfit, models.OrderStatusWaiting, bot, now)
+		takeProfit.Type = models.OrderTypeLimit
+		takeProfit.LimitPrice = request.TakeProfit
+
+		stopLoss := newOrder(exit, group.ID, models.OrderRoleStopLoss, models.OrderStatusWaiting, bot, now)
+		stopLoss.Type = models.OrderTypeStop
+		stopLoss.StopPrice = request.StopLoss
+
+		group.Orders = []*models.Order{entry, takeProfit, stopLoss}
+	default:
+		return nil, fmt.Errorf("invalid order group type: %s", request.Type)
+	}
+
+	for _, order := range group.Orders {
+		if err := order.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	group.Place(now)
+	return group, nil
+}
+
+// saveOrderGroup stores the current state of an order group
+func (bw *BotWorker) saveOrderGroup(group *models.OrderGroup) error {
+	return bw.store.SaveOrderGroup(context.Background(), group)
+}
+
+// loadOrders restores the active order groups from the store into the order book,
+// so that pending orders survive a restart
+func (bw *BotWorker) loadOrders() error {
+	groups, err := bw.store.ActiveOrderGroups(context.Background())
+	if err != nil {
+		return err
+	}
+
+	// Keep each bot's groups in placement order
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].CreatedAt.Before(groups[j].CreatedAt)
+	})
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	for _, group := range groups {
+		for _, order := range group.Orders {
+			bw.watchlist.AddTickers(order.Ticker)
+		}
+
+		bw.orders.Add(group)
+	}
+
+	log.Printf("restored %d active order groups\n", len(groups))
+	return nil
+}
+
+// checkOrderPrecision checks that the shares and prices of every order of a group are expressible in its ticker's precision
+func (bw *BotWorker) checkOrderPrecision(group *models.OrderGroup) error {
+	for _, order := range group.Orders {
+		precision := bw.precisionFor(order.Ticker)
+		if err := precision.CheckShares(order.NumShares); err != nil {
+			return fmt.Errorf("invalid numShares of %s order for %s: %v", order.Role, order.Ticker, err)
+		}
+
+		for _, price := range []struct {
+			name  string
+			value float64
+		}{{"limitPrice", order.LimitPrice}, {"stopPrice", order.StopPrice}} {
+			if price.value == 0 {
+				continue
+			}
+
+			if err := precision.CheckPrice(price.value); err != nil {
+				return fmt.Errorf("invalid %s of %s order for %s: %v", price.name, order.Role, order.Ticker, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PlaceOrders places a group of conditional orders that are executed server-side.
+// @Summary Place conditional orders
+// @Description Places a single conditional order, a one-cancels-other group or a bracket (entry, take-profit and stop-loss). When the opening auction is enabled, market orders placed while their market is closed are queued for the next session's opening price
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orders body OrderGroupRequestData true "Order group details"
+// @Success 200 {object} DataPacket "Placed order group"
+// @Failure 400 {object} ResultData "Invalid order group"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /orders [post]
+func (bw *BotWorker) PlaceOrders(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	request := &OrderGroupRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	group, err := buildOrderGroup(request, ref)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket(err.Error(), false))
+		return
+	}
+
+	group.SchemaVersion = bw.migrator.Latest(bw.collections.OrderGroups)
+
+	err = bw.checkOrderPrecision(group)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	bw.queueMarketOrdersForOpen(group)
+
+	// The group is stored before it can fill so that it survives a restart
+	err = bw.saveOrderGroup(group)
+	if err != nil {
+		log.Printf("error saving order group %s: %v\n", group.ID, err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save order group", false))
+		return
+	}
+
+	// Make sure prices are fetched for every ticker in the group
+	for _, order := range group.Orders {
+		bw.watchlist.AddTickers(order.Ticker)
+	}
+
+	bw.orders.Lock()
+	bw.orders.Add(group)
+	bw.publish(ref.ID, &DataPacket{"order_group_update", group})
+	c.JSON(200, &DataPacket{"order_group", group})
+	bw.orders.Unlock()
+
+	// Market orders can fill right away
+	go bw.evaluateOrders()
+}
+
+// GetOrders returns the order groups placed by the authenticated bot, newest first.
+// @Summary Get conditional orders
+// @Description Retrieves every order group placed by the authenticated bot, newest first
+// @Tags orders
+// @Produce json
+// @Success 200 {object} DataPacket "Order groups"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /orders [get]
+func (bw *BotWorker) GetOrders(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	bw.orders.Lock()
+	groups := bw.orders.BotGroups(ref.ID)
+
+	c.JSON(200, &DataPacket{"order_groups", groups})
+	bw.orders.Unlock()
+}
+
+// CancelOrders cancels every unfilled order in an order group.
+// @Summary Cancel conditional orders
+// @Description Cancels every order in the group that has not filled yet
+// @Tags orders
+// @Produce json
+// @Param id path string true "Order group ID"
+// @Success 200 {object} DataPacket "Cancelled order group"
+// @Failure 404 {object} ResultData "Order group not found"
+// @Router /orders/{id} [delete]
+func (bw *BotWorker) CancelOrders(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	group, ok := bw.orders.Group(c.Param("id"))
+	if !ok || group.Bot.ID != ref.ID {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: order group not found", false))
+		return
+	}
+
+	if group.Status != models.OrderGroupActive {
+		c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: order group is already %s", group.Status), false))
+		return
+	}
+
+	// Store the cancellation first so that a failed write does not revive the group after a restart
+	now := time.Now()
+	cancelled := group.Copy()
+	cancelled.Cancel("cancelled by bot", now)
+	err := bw.saveOrderGroup(cancelled)
+	if err != nil {
+		log.Printf("error saving order group %s: %v\n", group.ID, err)
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to cancel order group", false))
+		return
+	}
+
+	group.Cancel("cancelled by bot", now)
+	bw.orders.Reindex(group)
+	bw.publish(ref.ID, &DataPacket{"order_group_update", group})
+	c.JSON(200, &DataPacket{"order_group", group})
+}
+
+// evaluateOrders fills every open order whose price condition is met by the latest prices.
+// Only the orders each ticker's price can cross are visited. Filling an order can activate
+// or cancel linked orders, so each ticker is re-checked until none of its orders trigger.
+// The shares of a ticker filled per call are capped by its liquidity limit, oldest orders first,
+// and orders that do not fill completely stay partially filled until the next price update.
+func (bw *BotWorker) evaluateOrders() {
+	// Expired GTD groups must not fill
+	bw.expireOrders(false)
+
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	changed := make(map[string]*models.OrderGroup)
+	now := time.Now()
+
+	// Orders queued for the open join the open orders once their market opened
+	for _, ticker := range bw.orders.QueuedTickers() {
+		bw.openQueuedOrders(ticker, now, changed)
+	}
+
+	for _, ticker := range bw.orders.Tickers() {
+		price, ok := bw.latestPrices[ticker]
+		if !ok || price <= 0 {
+			continue
+		}
+
+		// Orders of halted tickers stay open until trading resumes
+		if bw.halts.active(ticker, now) != nil {
+			continue
+		}
+
+		// Likewise while an administrator forced the ticker's market closed
+		if override := bw.overrides.active(bw.exchangeFor(ticker).Code, now); override != nil && !override.Open {
+			continue
+		}
+
+		available := bw.liquidityLimit(ticker, now)
+		for progressed := true; progressed && available > 0; {
+			progressed = false
+
+			for _, entry := range bw.orders.Crossable(ticker, price) {
+				// An earlier fill may have cancelled this order
+				if !entry.Order.Triggered(price) {
+					continue
+				}
+
+				// Partial fills are rounded down to the ticker's share precision
+				numShares := bw.precisionFor(ticker).FloorShares(min(entry.Order.Remaining(), available))
+				if numShares <= 0 {
+					break
+				}
+
+				now := time.Now()
+				transactionRef, err := bw.fillOrder(entry.Group, entry.Order, numShares, price, now)
+				var rejected *ruleError
+				switch {
+				case errors.As(err, &rejected):
+					entry.Group.Reject(entry.Order, rejected.Error(), now)
+					// A lost rejection only means the order is evaluated again after a restart
+					if err := bw.saveOrderGroup(entry.Group); err != nil {
+						log.Printf("error saving order group %s: %v\n", entry.Group.ID, err)
+					}
+				case errors.Is(err, errTradeInProgress):
+					// Leave the order open so it fills on the next price update, once the bot's trade finished
+					continue
+				case err != nil:
+					// Leave the order open so it is retried on the next price update
+					log.Printf("error filling order %s: %v\n", entry.Order.ID, err)
+					continue
+				default:
+					entry.Group.Fill(entry.Order, numShares, price, transactionRef, now)
+					bw.usage.recordTransaction(ownerOf(entry.Order.Bot).ID)
+					bw.recordCollusionTrade(entry.Order.Bot, entry.Order.Ticker, entry.Order.Action, now)
+					available -= numShares
+				}
+
+				bw.orders.Reindex(entry.Group)
+				changed[entry.Group.ID] = entry.Group
+				progressed = true
+			}
+		}
+	}
+
+	for _, group := range changed {
+		bw.publish(group.Bot.ID, &DataPacket{"order_group_update", group})
+	}
+}
+
+// fillOrder executes numShares of an order at the given price against the bot's stored portfolio.
+// The filled group is stored atomically with the transaction, so a fill can never be
+// repeated after a restart. The caller applies the fill to its group with the same time.
+// Returns a *ruleError if the order fails the trading rules, or errTradeInProgress if another trade of the bot is running.
+func (bw *BotWorker) fillOrder(group *models.OrderGroup, order *models.Order, numShares, price float64, now time.Time) (*firestore.DocumentRef, error) {
+	request := &TransactionRequestData{Action: order.Action, NumShares: numShares, Ticker: order.Ticker, Tag: group.Tag}
+
+	var decisionRef *firestore.DocumentRef
+	var decision *models.OrderDecision
+	var portfolio *models.Portfolio
+	var transaction *models.Transaction
+
+	// Running trades of the bot write its portfolio without reading it again, so the order waits for the next price
+	// update instead. Waiting here would hold the order book's lock and stall the orders of every other bot.
+	unlock, ok := bw.trades.tryLock(ownerOf(order.Bot).ID)
+	if !ok {
+		return nil, errTradeInProgress
+	}
+	defer unlock()
+
+	transactionRef, err := bw.store.FillOrder(context.Background(), order.Bot, func(stored *models.Portfolio, transactionRef *firestore.DocumentRef) (*OrderFill, error) {
+		portfolio = stored
+		decisionRef, decision = bw.newOrderDecision(portfolio, request, order.Bot)
+		transaction = &models.Transaction{
+			Time:      decision.Time,
+			NumShares: numShares,
+			UnitCost:  price,
+			Ticker:    order.Ticker,
+			Action:    order.Action,
+			Currency:  portfolio.CurrencyOfRecord(),
+			Tag:       group.Tag,
+			Timing:    &models.ExecutionTiming{Source: models.SourceOrder, PriceTime: bw.priceTime(order.Ticker)},
+			Bot:       order.Bot,
+			Decision:  decisionRef,
+		}
+
+		decision.Price = price
+
+		err := bw.executeTransaction(portfolio, transaction, decision)
+		if err != nil {
+			return nil, err
+		}
+
+		filled := group.Copy()
+		filled.Fill(filled.Order(order.ID), numShares, price, transactionRef, now)
+		fill := &OrderFill{Transaction: transaction, Group: filled}
+
+		// The event is stored atomically with the fill, so it is published even after a restart
+		if bw.eventsEnabled() {
+			fill.Event, err = newTransactionEvent(order.Bot, &TransactionEventData{
+				TransactionConfirmation: newTransactionConfirmation(portfolio, transaction, transactionRef),
+				Tag:                     group.Tag,
+				OrderGroupID:            group.ID,
+				OrderID:                 order.ID,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return fill, nil
+	})
+
+	var rejected *ruleError
+	switch {
+	case errors.As(err, &rejected):
+		bw.saveOrderDecision(decisionRef, decision, rejected)
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+
+	decision.Transaction = transactionRef
+	bw.saveOrderDecision(decisionRef, decision, nil)
+
+	bw.afterFill(portfolio, transaction)
+	bw.deliverEventsAsync()
+
+	return transactionRef, nil
+}
+
+// expireOrders expires every active order group whose time in force has run out.
+// DAY groups only expire when called from the end-of-day settlement.
+func (bw *BotWorker) expireOrders(endOfDay bool) int {
+	bw.orders.Lock()
+	defer bw.orders.Unlock()
+
+	now := time.Now()
+	expired := 0
+	for _, group := range bw.orders.ActiveGroups() {
+		if !group.Expired(now, endOfDay) {
+			continue
+		}
+
+		group.Expire(now)
+		bw.orders.Reindex(group)
+		if err := bw.saveOrderGroup(group); err != nil {
+			log.Printf("error saving order group %s: %v\n", group.ID, err)
+		}
+
+		expired++
+		bw.publish(group.Bot.ID, &DataPacket{"order_group_expired", group})
+	}
+
+	return expired
+}
+
+// settle runs the end-of-day settlement, expiring DAY and overdue GTD order groups
+// and scoring the bots of every running competition
+func (bw *BotWorker) settle() error {
+	expired := bw.expireOrders(true)
+	log.Printf("settlement expired %d order groups\n", expired)
+	return bw.settleScores()
+}
@@ -0,0 +1,262 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/market"
+)
+
+// MarketOverride forces an exchange, or every exchange when Exchange is empty, open or closed regardless of its calendar
+type MarketOverride struct {
+	Exchange string    `json:"exchange"` // Overridden exchange code, empty for every exchange
+	Open     bool      `json:"open"`     // Whether the market is forced open, otherwise it is forced closed
+	Session  string    `json:"session"`  // Session traded in while forced open outside the calendar's sessions
+	Reason   string    `json:"reason"`   // Why the calendar is overridden
+	Start    time.Time `json:"start"`    // When the override started
+	Until    time.Time `json:"until"`    // When the calendar applies again, zero until the override is cleared
+}
+
+// Active checks whether the override is still in effect at the given time
+func (o *MarketOverride) Active(now time.Time) bool {
+	return o.Until.IsZero() || now.Before(o.Until)
+}
+
+// MarketOverrideRequestData represents a request to force the market open or closed
+type MarketOverrideRequestData struct {
+	Exchange string `json:"exchange"`                                                         // Exchange code or alias to override, empty for every exchange
+	Open     *bool  `json:"open" binding:"required"`                                          // Whether to force the market open or closed
+	Session  string `json:"session" binding:"omitempty,oneof=pre_market regular after_hours"` // Session to trade in while forced open, "regular" by default
+	Reason   string `json:"reason"`                                                           // Why the calendar is overridden
+	Minutes  int    `json:"minutes" binding:"gte=0"`                                          // How long the override lasts, 0 until it is cleared
+}
+
+// overrideTracker tracks the active market open/closed overrides by exchange code, the override of every exchange under ""
+type overrideTracker struct {
+	mu        sync.Mutex
+	overrides map[string]*MarketOverride
+}
+
+// newOverrideTracker creates an override tracker without overrides
+func newOverrideTracker() *overrideTracker {
+	return &overrideTracker{overrides: make(map[string]*MarketOverride)}
+}
+
+// active returns the override that applies to an exchange at the given time, or nil if its calendar applies.
+// An override of the exchange takes precedence over an override of every exchange.
+func (ot *overrideTracker) active(code string, now time.Time) *MarketOverride {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	for _, key := range []string{code, ""} {
+		if override, ok := ot.overrides[key]; ok && override.Active(now) {
+			return override
+		}
+	}
+
+	return nil
+}
+
+// list returns every active override, the override of every exchange first and then by exchange
+func (ot *overrideTracker) list(now time.Time) []*MarketOverride {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	overrides := make([]*MarketOverride, 0, len(ot.overrides))
+	for _, override := range ot.overrides {
+		if override.Active(now) {
+			overrides = append(overrides, override)
+		}
+	}
+
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Exchange < overrides[j].Exchange
+	})
+
+	return overrides
+}
+
+// set starts an override, replacing any override of the same exchange
+func (ot *overrideTracker) set(override *MarketOverride) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	ot.overrides[override.Exchange] = override
+}
+
+// clear ends the override of an exchange, or of every exchange for an empty code.
+// Returns the ended override, or nil if the exchange was not overridden.
+func (ot *overrideTracker) clear(code string, now time.Time) *MarketOverride {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	override, ok := ot.overrides[code]
+	if !ok {
+		return nil
+	}
+
+	delete(ot.overrides, code)
+	if !override.Active(now) {
+		return nil
+	}
+
+	return override
+}
+
+// sessionAt returns the session of an exchange at the given time, or nil if it is closed, applying the active
+// override. A market forced open outside its sessions trades in the override's session, without costs if the
+// exchange does not have that session. Also returns the applied override, nil if the calendar applies.
+func (bw *BotWorker) sessionAt(exchange *market.Exchange, t time.Time) (*market.Session, *MarketOverride) {
+	override := bw.overrides.active(exchange.Code, t)
+	session := exchange.SessionAt(t)
+	switch {
+	case override == nil:
+		return session, nil
+	case !override.Open:
+		return nil, override
+	case session != nil:
+		return session, override
+	}
+
+	if session = exchange.Session(override.Session); session != nil {
+		return session, override
+	}
+
+	return &market.Session{Name: override.Session}, override
+}
+
+// GetMarketOverrides returns the active market overrides.
+// @Summary Get market overrides
+// @Description Retrieves every active override of the market calendar, the override of every exchange first
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Active overrides"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/market_override [get]
+func (bw *BotWorker) GetMarketOverrides(c *gin.Context) {
+	c.JSON(200, &DataPacket{"market_overrides", bw.overrides.list(time.Now())})
+}
+
+// OverrideMarket forces an exchange, or every exchange, open or closed regardless of its calendar.
+// @Summary Override the market calendar
+// @Description Forces an exchange, or every exchange when none is given, open or closed for a number of minutes or until the override is cleared, such as for test days, demo sessions or unscheduled closures. The override is recorded in the audit trail
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param override body MarketOverrideRequestData true "Override details"
+// @Success 200 {object} DataPacket "Started override"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/market_override [put]
+func (bw *BotWorker) OverrideMarket(c *gin.Context) {
+	request := &MarketOverrideRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: invalid market override request", false))
+		return
+	}
+
+	code := ""
+	if request.Exchange = strings.TrimSpace(request.Exchange); request.Exchange != "" {
+		exchange, ok := bw.markets.Lookup(request.Exchange)
+		if !ok {
+			c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: unknown exchange %s", request.Exchange), false))
+			return
+		}
+
+		code = exchange.Code
+	}
+
+	if request.Session == "" {
+		request.Session = market.SessionRegular
+	}
+
+	now := time.Now()
+	override := &MarketOverride{
+		Exchange: code,
+		Open:     *request.Open,
+		Session:  request.Session,
+		Reason:   request.Reason,
+		Start:    now,
+	}
+
+	if override.Reason == "" {
+		override.Reason = "overridden by an administrator"
+	}
+
+	if request.Minutes > 0 {
+		override.Until = now.Add(time.Duration(request.Minutes) * time.Minute)
+	}
+
+	bw.overrides.set(override)
+
+	state := "closed"
+	if override.Open {
+		state = "open"
+	}
+
+	bw.audit(c, "market_override.set", fmt.Sprintf("forced %s %s until %v: %s", describeExchange(code), state, override.Until, override.Reason), override)
+	bw.broadcast(&DataPacket{"market_override", override})
+	c.JSON(200, &DataPacket{"market_override", override})
+
+	// Orders and protected positions held back by a forced closure can fill now
+	if override.Open {
+		go func() {
+			bw.evaluateOrders()
+			bw.evaluateProtections()
+		}()
+	}
+}
+
+// ClearMarketOverride ends the override of an exchange, or of every exchange, so its calendar applies again.
+// @Summary Clear a market override
+// @Description Ends the override of an exchange, or the override of every exchange when none is given. The change is recorded in the audit trail
+// @Tags admin
+// @Produce json
+// @Param exchange query string false "Overridden exchange code, omit for the override of every exchange"
+// @Success 200 {object} DataPacket "Ended override"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Not overridden"
+// @Router /admin/market_override [delete]
+func (bw *BotWorker) ClearMarketOverride(c *gin.Context) {
+	code := ""
+	if query := strings.TrimSpace(c.Query("exchange")); query != "" {
+		exchange, ok := bw.markets.Lookup(query)
+		if !ok {
+			c.AbortWithStatusJSON(404, NewResultPacket(fmt.Sprintf("error: unknown exchange %s", query), false))
+			return
+		}
+
+		code = exchange.Code
+	}
+
+	override := bw.overrides.clear(code, time.Now())
+	if override == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: the market is not overridden", false))
+		return
+	}
+
+	bw.audit(c, "market_override.clear", fmt.Sprintf("calendar applies again to %s", describeExchange(code)), override)
+	bw.broadcast(&DataPacket{"market_override_cleared", override})
+	c.JSON(200, &DataPacket{"market_override", override})
+
+	if !override.Open {
+		go func() {
+			bw.evaluateOrders()
+			bw.evaluateProtections()
+		}()
+	}
+}
+
+// describeExchange names an overridden exchange code for logs, "every exchange" for an empty code
+func describeExchange(code string) string {
+	if code == "" {
+		return "every exchange"
+	}
+
+	return code
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// nextCursorHeader carries the cursor of the next page of a listing, it is missing on the last page
+const nextCursorHeader = "X-Next-Cursor"
+
+// pageCursor is the position of the last item of a page. Listings order their items by a key and then by ID, so
+// items with the same key keep a stable order and a listing resumes after the cursor without skipping or repeating
+// items, even when items are added in between. The key is the time of Firestore documents in Unix nanoseconds, or
+// the rank of a leaderboard entry.
+type pageCursor struct {
+	key int64
+	id  string
+}
+
+// timeCursor returns the cursor of a document ordered by a time field
+func timeCursor(t time.Time, id string) *pageCursor {
+	return &pageCursor{key: t.UnixNano(), id: id}
+}
+
+// time returns the key of a cursor of a document ordered by a time field
+func (pc *pageCursor) time() time.Time {
+	return time.Unix(0, pc.key).UTC()
+}
+
+// encode returns the opaque cursor string, empty for the start of a listing
+func (pc *pageCursor) encode() string {
+	if pc == nil || pc.id == "" {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(pc.key, 10) + ":" + pc.id))
+}
+
+// parsePageCursor decodes a cursor returned by a listing
+func parsePageCursor(cursor string) (*pageCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	key, id, ok := strings.Cut(string(decoded), ":")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	parsed, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &pageCursor{key: parsed, id: id}, nil
+}
+
+// pageRequest is the size and the starting position of a page of a listing
+type pageRequest struct {
+	limit  int         // Number of items in the page
+	cursor *pageCursor // Position to resume after, nil for the first page
+}
+
+// parsePageRequest reads the limit and cursor query parameters of a listing. Returns false if the request was aborted.
+func parsePageRequest(c *gin.Context, defaultLimit, maxLimit int) (*pageRequest, bool) {
+	page := &pageRequest{limit: defaultLimit}
+	if query := c.Query("limit"); query != "" {
+		parsed, err := strconv.Atoi(query)
+		if err != nil || parsed <= 0 || parsed > maxLimit {
+			c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: limit must be between 1 and %d", maxLimit), false))
+			return nil, false
+		}
+
+		page.limit = parsed
+	}
+
+	if query := c.Query("cursor"); query != "" {
+		parsed, err := parsePageCursor(query)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+			return nil, false
+		}
+
+		page.cursor = parsed
+	}
+
+	return page, true
+}
+
+// order orders a query by a time field and then by document ID in the same direction, and starts it after the cursor
+func (p *pageRequest) order(query firestore.Query, field string, direction firestore.Direction) firestore.Query {
+	query = query.OrderBy(field, direction).OrderBy(firestore.DocumentID, direction)
+	if p.cursor != nil {
+		query = query.StartAfter(p.cursor.time(), p.cursor.id)
+	}
+
+	return query
+}
+
+// query orders a query like order and reads one document more than the page holds, which tells whether another
+// page follows
+func (p *pageRequest) query(query firestore.Query, field string, direction firestore.Direction) firestore.Query {
+	return p.order(query, field, direction).Limit(p.limit + 1)
+}
+
+// page drops the extra document read by query and sends the cursor of the next page if the extra document exists
+func (p *pageRequest) page(c *gin.Context, docs []*firestore.DocumentSnapshot, field string) []*firestore.DocumentSnapshot {
+	if len(docs) <= p.limit {
+		return docs
+	}
+
+	docs = docs[:p.limit]
+	setNextCursor(c, docCursor(docs[len(docs)-1], field))
+	return docs
+}
+
+// docCursor returns the cursor of a document ordered by a time field
+func docCursor(doc *firestore.DocumentSnapshot, field string) *pageCursor {
+	value, err := doc.DataAt(field)
+	t, ok := value.(time.Time)
+	if err != nil || !ok {
+		return nil
+	}
+
+	return timeCursor(t, doc.Ref.ID)
+}
+
+// setNextCursor sends the cursor of the next page if there is one
+func setNextCursor(c *gin.Context, cursor *pageCursor) {
+	if encoded := cursor.encode(); encoded != "" {
+		c.Header(nextCursorHeader, encoded)
+	}
+}
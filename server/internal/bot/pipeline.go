@@ -0,0 +1,275 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of the transaction queue, overridden by TRANSACTION_WORKERS and TRANSACTION_QUEUE_SIZE
+const (
+	defaultTransactionWorkers   = 8
+	defaultTransactionQueueSize = 1000
+)
+
+// queuedTransactionRetention is how long the status of a finished queued transaction can be polled
+const queuedTransactionRetention = time.Hour
+
+// Statuses of a queued transaction
+const (
+	TransactionQueued    = "queued"    // Waiting for a worker
+	TransactionExecuting = "executing" // Being executed by a worker
+	TransactionFilled    = "filled"    // Executed, the confirmation is set
+	TransactionRejected  = "rejected"  // Not executed, the code and error tell why
+)
+
+// errQueueFull is returned when a transaction is queued while the queue of its worker is full
+var errQueueFull = errors.New("transaction queue is full")
+
+// QueuedTransaction is a transaction queued for asynchronous execution and its status
+type QueuedTransaction struct {
+	ID           string                   `json:"id"`                     // ID to poll the status with
+	PortfolioID  string                   `json:"portfolioId"`            // ID of the bot or shadow portfolio that trades
+	Status       string                   `json:"status"`                 // "queued", "executing", "filled" or "rejected"
+	Request      *TransactionRequestData  `json:"request"`                // Requested transaction
+	QueuedAt     time.Time                `json:"queuedAt"`               // When the transaction was queued
+	CompletedAt  time.Time                `json:"completedAt,omitempty"`  // When the transaction was filled or rejected
+	Code         int                      `json:"code,omitempty"`         // Status code a synchronous request would have returned, only when rejected
+	Error        string                   `json:"error,omitempty"`        // Reason the transaction was rejected
+	Confirmation *TransactionConfirmation `json:"confirmation,omitempty"` // Confirmation of the filled transaction
+
+	ref        *firestore.DocumentRef // Portfolio that trades
+	receivedAt time.Time              // When the request was received
+}
+
+// TransactionQueueStats reports the load of the transaction queue
+type TransactionQueueStats struct {
+	Workers   int `json:"workers"`   // Workers executing queued transactions
+	Capacity  int `json:"capacity"`  // Transactions that can wait at once
+	Queued    int `json:"queued"`    // Transactions waiting for a worker
+	Executing int `json:"executing"` // Transactions being executed
+	Filled    int `json:"filled"`    // Transactions filled since the server started
+	Rejected  int `json:"rejected"`  // Transactions rejected since the server started
+}
+
+// transactionQueue executes queued transactions with a fixed pool of workers, so bursts of transactions are spread
+// over time instead of all reaching Firestore and the price store at once. All transactions of a bot, including those
+// of its shadow portfolios, go to the same worker, so they execute one at a time in the order they were queued, while
+// the transactions of other bots execute in parallel. The queue is kept in memory, transactions that are still
+// queued when the server stops are dropped.
+type transactionQueue struct {
+	mu       sync.Mutex
+	workers  []chan *QueuedTransaction     // Queue of each worker
+	capacity int                           // Transactions each worker can have waiting
+	statuses map[string]*QueuedTransaction // Queued and recently finished transactions by ID
+	stats    TransactionQueueStats
+}
+
+// newTransactionQueue creates a transaction queue configured by TRANSACTION_WORKERS and TRANSACTION_QUEUE_SIZE.
+// The workers are started by start.
+func newTransactionQueue() (*transactionQueue, error) {
+	workers := defaultTransactionWorkers
+	size := defaultTransactionQueueSize
+	for key, value := range map[string]*int{
+		"TRANSACTION_WORKERS":    &workers,
+		"TRANSACTION_QUEUE_SIZE": &size,
+	} {
+		if env := os.Getenv(key); env != "" {
+			parsed, err := strconv.Atoi(env)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid %s: %s", key, env)
+			}
+
+			*value = parsed
+		}
+	}
+
+	queue := &transactionQueue{
+		workers:  make([]chan *QueuedTransaction, workers),
+		capacity: max(size/workers, 1),
+		statuses: make(map[string]*QueuedTransaction),
+	}
+
+	for i := range queue.workers {
+		queue.workers[i] = make(chan *QueuedTransaction, queue.capacity)
+	}
+
+	queue.stats.Workers = workers
+	queue.stats.Capacity = queue.capacity * workers
+	return queue, nil
+}
+
+// start runs the workers, each executing the transactions of its queue in order with execute
+func (tq *transactionQueue) start(execute func(queued *QueuedTransaction)) {
+	for _, worker := range tq.workers {
+		go func() {
+			for queued := range worker {
+				execute(queued)
+			}
+		}()
+	}
+}
+
+// worker returns the queue of the worker that executes the transactions of a bot
+func (tq *transactionQueue) worker(botID string) chan *QueuedTransaction {
+	hash := fnv.New32a()
+	hash.Write([]byte(botID))
+	return tq.workers[hash.Sum32()%uint32(len(tq.workers))]
+}
+
+// enqueue queues a transaction of a portfolio. Returns a copy of the queued transaction, or errQueueFull if the
+// queue of the bot's worker is full.
+func (tq *transactionQueue) enqueue(ref *firestore.DocumentRef, request *TransactionRequestData, receivedAt time.Time) (*QueuedTransaction, error) {
+	now := time.Now()
+	queued := &QueuedTransaction{
+		ID:          newID(),
+		PortfolioID: ref.ID,
+		Status:      TransactionQueued,
+		Request:     request,
+		QueuedAt:    now,
+		ref:         ref,
+		receivedAt:  receivedAt,
+	}
+
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	// Sending while holding the lock keeps the transactions of a bot in the order their statuses were created
+	select {
+	case tq.worker(ownerOf(ref).ID) <- queued:
+	default:
+		return nil, errQueueFull
+	}
+
+	for id, status := range tq.statuses {
+		if !status.CompletedAt.IsZero() && now.Sub(status.CompletedAt) > queuedTransactionRetention {
+			delete(tq.statuses, id)
+		}
+	}
+
+	tq.statuses[queued.ID] = queued
+	tq.stats.Queued++
+	copied := *queued
+	return &copied, nil
+}
+
+// update changes the status of a queued transaction and returns a copy of it
+func (tq *transactionQueue) update(queued *QueuedTransaction, change func(queued *QueuedTransaction)) *QueuedTransaction {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	change(queued)
+	copied := *queued
+	return &copied
+}
+
+// get returns a copy of a queued or recently finished transaction of a bot, or nil if there is none
+func (tq *transactionQueue) get(id, botID string) *QueuedTransaction {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	queued, ok := tq.statuses[id]
+	if !ok || ownerOf(queued.ref).ID != botID {
+		return nil
+	}
+
+	copied := *queued
+	return &copied
+}
+
+// snapshot returns the current load of the queue
+func (tq *transactionQueue) snapshot() *TransactionQueueStats {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	stats := tq.stats
+	return &stats
+}
+
+// executeQueued executes a queued transaction once no other trade of its bot is running and publishes its final
+// status to the bot's WebSocket sessions
+func (bw *BotWorker) executeQueued(queued *QueuedTransaction) {
+	bw.pipeline.update(queued, func(queued *QueuedTransaction) {
+		queued.Status = TransactionExecuting
+		bw.pipeline.stats.Queued--
+		bw.pipeline.stats.Executing++
+	})
+
+	var confirmation *TransactionConfirmation
+	var tradeErr *tradeError
+
+	ctx, cancel := context.WithTimeout(context.Background(), tradeLockTimeout)
+	unlock, err := bw.trades.lock(ctx, ownerOf(queued.ref).ID)
+	cancel()
+	if err != nil {
+		tradeErr = &tradeError{409, "error: another transaction of this bot is still in progress"}
+	} else {
+		_, confirmation, tradeErr = bw.transact(queued.ref, queued.Request, queued.receivedAt)
+		unlock()
+	}
+
+	finished := bw.pipeline.update(queued, func(queued *QueuedTransaction) {
+		queued.CompletedAt = time.Now()
+		bw.pipeline.stats.Executing--
+		if tradeErr != nil {
+			queued.Status = TransactionRejected
+			queued.Code = tradeErr.status
+			queued.Error = tradeErr.message
+			bw.pipeline.stats.Rejected++
+			return
+		}
+
+		queued.Status = TransactionFilled
+		queued.Confirmation = confirmation
+		bw.pipeline.stats.Filled++
+	})
+
+	bw.publish(ownerOf(queued.ref).ID, &DataPacket{"queued_transaction", finished})
+}
+
+// queueTransaction queues a validated transaction request for a worker and responds with 202 and its status
+func (bw *BotWorker) queueTransaction(c *gin.Context, ref *firestore.DocumentRef, request *TransactionRequestData) {
+	queued, err := bw.pipeline.enqueue(ref, request, c.GetTime("received"))
+	if err != nil {
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(503, NewResultPacket("error: "+err.Error()+", try again later", false))
+		return
+	}
+
+	c.Header("Location", "/transactions/queue/"+queued.ID)
+	c.JSON(202, &DataPacket{"queued_transaction", queued})
+}
+
+// GetQueuedTransaction returns the status of a transaction queued by the authenticated bot.
+// @Summary Get a queued transaction
+// @Description Reports whether a transaction queued with async is still queued, executing, filled or rejected, with its confirmation once filled. Finished transactions can be polled for an hour, and transactions of shadow portfolios are visible to their bot
+// @Tags transactions
+// @Produce json
+// @Param id path string true "Queued transaction ID"
+// @Success 200 {object} DataPacket "Queued transaction"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Queued transaction not found"
+// @Router /transactions/queue/{id} [get]
+func (bw *BotWorker) GetQueuedTransaction(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	queued := bw.pipeline.get(c.Param("id"), ref.ID)
+	if queued == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: queued transaction not found", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"queued_transaction", queued})
+}
@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// transactionBatchSize is the number of transaction documents read by one Firestore GetAll
+const transactionBatchSize = 500
+
+// maxPortfolioBatch is the number of portfolios GetPortfolios returns at once
+const maxPortfolioBatch = 100
+
+// PortfolioEntry is a portfolio with the ID of its bot
+type PortfolioEntry struct {
+	BotID string `json:"botId"` // ID of the bot
+	*models.Portfolio
+}
+
+// PortfolioBatch is the result of loading many portfolios at once
+type PortfolioBatch struct {
+	Portfolios []*PortfolioEntry `json:"portfolios"` // Portfolios found, in the requested order
+	Missing    []string          `json:"missing"`    // Requested bot IDs without a portfolio
+}
+
+// loadTransactions loads every transaction of a portfolio
+func (bw *BotWorker) loadTransactions(portfolio *models.Portfolio) ([]*models.Transaction, error) {
+	err := bw.loadPortfolioTransactions(context.Background(), portfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	return portfolio.Transactions, nil
+}
+
+// loadPortfolioTransactions sets the transactions of portfolios from their references. The references of all portfolios are
+// read together with Firestore GetAll in batches of transactionBatchSize, so loading the portfolios of active traders
+// takes a few round trips instead of one per transaction. Referenced transactions that no longer exist are skipped.
+func (bw *BotWorker) loadPortfolioTransactions(ctx context.Context, portfolios ...*models.Portfolio) error {
+	refs := make([]*firestore.DocumentRef, 0)
+	for _, portfolio := range portfolios {
+		refs = append(refs, portfolio.TransactionReferences...)
+	}
+
+	docs := make([]*firestore.DocumentSnapshot, 0, len(refs))
+	for batch := range slices.Chunk(refs, transactionBatchSize) {
+		batchDocs, err := bw.db.GetAll(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		docs = append(docs, batchDocs...)
+	}
+
+	// GetAll returns the documents in the order of the references, so each portfolio takes the next run of them
+	for _, portfolio := range portfolios {
+		portfolio.Transactions = make([]*models.Transaction, 0, len(portfolio.TransactionReferences))
+		for _, doc := range docs[:len(portfolio.TransactionReferences)] {
+			transaction := &models.Transaction{}
+			if doc.Exists() && doc.DataTo(transaction) == nil {
+				portfolio.Transactions = append(portfolio.Transactions, transaction)
+			}
+		}
+
+		docs = docs[len(portfolio.TransactionReferences):]
+	}
+
+	return nil
+}
+
+// GetPortfolios returns many portfolios with their transactions at once.
+// @Summary Get portfolios
+// @Description Loads the portfolios of the bots listed in ids, or of every bot in a competition, with their holdings and transactions. At most 100 portfolios are returned at once, and the transactions of all of them are read together. The bots of a competition are paged by ID, and when more bots follow, the X-Next-Cursor header carries the cursor of the next page
+// @Tags admin
+// @Produce json
+// @Param ids query string false "Comma separated bot IDs, required unless competition is set"
+// @Param competition query string false "ID of a competition whose bots are loaded"
+// @Param limit query int false "Number of portfolios of a competition, 100 by default and at most 100"
+// @Param cursor query string false "Cursor of the page of a competition to return, from the X-Next-Cursor header of the previous page"
+// @Success 200 {object} DataPacket "Portfolios and the requested bot IDs without one"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page of a competition, missing on the last page"
+// @Failure 400 {object} ResultData "Neither or both of ids and competition set, more than 100 ids, or an invalid limit or cursor"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/portfolios [get]
+func (bw *BotWorker) GetPortfolios(c *gin.Context) {
+	ids := make([]string, 0)
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	competition := c.Query("competition")
+	if (len(ids) == 0) == (competition == "") {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: set either ids or competition", false))
+		return
+	}
+
+	var docs []*firestore.DocumentSnapshot
+	var err error
+	if competition != "" {
+		page, ok := parsePageRequest(c, maxPortfolioBatch, maxPortfolioBatch)
+		if !ok {
+			return
+		}
+
+		competitionRef := bw.db.Collection(bw.collections.Competitions).Doc(competition)
+		if _, err := competitionRef.Get(context.Background()); err != nil {
+			c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+			return
+		}
+
+		// Bots are paged by ID, so the cursor only carries the ID of the last bot of the page
+		query := bw.db.Collection(bw.collections.Bots).Where("competition", "==", competitionRef).OrderBy(firestore.DocumentID, firestore.Asc)
+		if page.cursor != nil {
+			query = query.StartAfter(page.cursor.id)
+		}
+
+		docs, err = query.Limit(page.limit + 1).Documents(context.Background()).GetAll()
+		if len(docs) > page.limit {
+			docs = docs[:page.limit]
+			setNextCursor(c, &pageCursor{id: docs[len(docs)-1].Ref.ID})
+		}
+	} else {
+		if len(ids) > maxPortfolioBatch {
+			c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: at most %d portfolios can be loaded at once", maxPortfolioBatch), false))
+			return
+		}
+
+		refs := make([]*firestore.DocumentRef, 0, len(ids))
+		for _, id := range ids {
+			refs = append(refs, bw.db.Collection(bw.collections.Bots).Doc(id))
+		}
+
+		docs, err = bw.db.GetAll(context.Background(), refs)
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve portfolio information", false))
+		return
+	}
+
+	batch := &PortfolioBatch{Portfolios: make([]*PortfolioEntry, 0, len(docs)), Missing: make([]string, 0)}
+	portfolios := make([]*models.Portfolio, 0, len(docs))
+	for _, doc := range docs {
+		portfolio := &models.Portfolio{}
+		if !doc.Exists() || doc.DataTo(portfolio) != nil {
+			batch.Missing = append(batch.Missing, doc.Ref.ID)
+			continue
+		}
+
+		batch.Portfolios = append(batch.Portfolios, &PortfolioEntry{BotID: doc.Ref.ID, Portfolio: portfolio})
+		portfolios = append(portfolios, portfolio)
+	}
+
+	if err := bw.loadPortfolioTransactions(context.Background(), portfolios...); err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"portfolios", batch})
+}
@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// ProfileRequestData represents a request to update the authenticated bot's profile
+type ProfileRequestData struct {
+	DisplayName string                `json:"displayName"` // Name shown instead of the bot ID
+	AvatarURL   string                `json:"avatarUrl"`   // HTTPS URL of the avatar image
+	Description string                `json:"description"` // Description of the bot's strategy
+	Links       []*models.ProfileLink `json:"links"`       // Links such as a repository or write-up
+}
+
+// ModerationRequestData represents an admin request to change the moderation state of a profile
+type ModerationRequestData struct {
+	Moderation string `json:"moderation"` // "visible" or "hidden"
+	Reason     string `json:"reason"`     // Reason shown to the bot owner
+}
+
+// PublicProfile is the profile of a bot as shown to anyone
+type PublicProfile struct {
+	BotID        string                `json:"botId"`        // ID of the bot document
+	DisplayName  string                `json:"displayName"`  // Display name, the bot ID if it has none
+	AvatarURL    string                `json:"avatarUrl"`    // HTTPS URL of the avatar image
+	Description  string                `json:"description"`  // Description of the bot's strategy
+	Links        []*models.ProfileLink `json:"links"`        // Links such as a repository or write-up
+	AccountValue float64               `json:"accountValue"` // Latest calculated account value
+}
+
+// newPublicProfile builds the public profile of a bot. Profiles that are not visible only show the bot ID.
+func newPublicProfile(botID string, portfolio *models.Portfolio) *PublicProfile {
+	profile := &PublicProfile{
+		BotID:        botID,
+		DisplayName:  portfolio.Profile.PublicName(botID),
+		Links:        make([]*models.ProfileLink, 0),
+		AccountValue: portfolio.AccountValue,
+	}
+
+	if portfolio.Profile.Public() {
+		profile.AvatarURL = portfolio.Profile.AvatarURL
+		profile.Description = portfolio.Profile.Description
+		if portfolio.Profile.Links != nil {
+			profile.Links = portfolio.Profile.Links
+		}
+	}
+
+	return profile
+}
+
+// loadOwner loads the portfolio of the authenticated bot itself, even when a shadow portfolio is selected
+func (bw *BotWorker) loadOwner(c *gin.Context) (*models.Portfolio, *firestore.DocumentRef, bool) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return nil, nil, false
+	}
+
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bot", false))
+		return nil, nil, false
+	}
+
+	portfolio := &models.Portfolio{}
+	err = doc.DataTo(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bot", false))
+		return nil, nil, false
+	}
+
+	return portfolio, ref, true
+}
+
+// GetProfile returns the authenticated bot's profile including its moderation state.
+// @Summary Get bot profile
+// @Description Retrieves the display name, avatar, description, links and moderation state of the authenticated bot
+// @Tags profile
+// @Produce json
+// @Success 200 {object} DataPacket "Bot profile"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /profile [get]
+func (bw *BotWorker) GetProfile(c *gin.Context) {
+	portfolio, _, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	profile := portfolio.Profile
+	if profile == nil {
+		profile = &models.BotProfile{Links: make([]*models.ProfileLink, 0), Moderation: models.ProfileVisible}
+	}
+
+	c.JSON(200, &DataPacket{"profile", profile})
+}
+
+// UpdateProfile replaces the authenticated bot's profile.
+// Profiles containing blocked words are flagged and hidden until an admin reviews them.
+// @Summary Update bot profile
+// @Description Replaces the display name, avatar, description and links of the authenticated bot
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param profile body ProfileRequestData true "Profile"
+// @Success 200 {object} DataPacket "Updated profile"
+// @Failure 400 {object} ResultData "Invalid profile"
+// @Router /profile [put]
+func (bw *BotWorker) UpdateProfile(c *gin.Context) {
+	portfolio, ref, ok := bw.loadOwner(c)
+	if !ok {
+		return
+	}
+
+	request := &ProfileRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	profile := &models.BotProfile{
+		DisplayName: request.DisplayName,
+		AvatarURL:   request.AvatarURL,
+		Description: request.Description,
+		Links:       request.Links,
+		UpdatedAt:   time.Now(),
+	}
+
+	if profile.Links == nil {
+		profile.Links = make([]*models.ProfileLink, 0)
+	}
+
+	err = profile.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	// Keep an admin's decision to hide the profile
+	if portfolio.Profile != nil && portfolio.Profile.Moderation == models.ProfileHidden {
+		profile.Moderation = models.ProfileHidden
+		profile.ModerationReason = portfolio.Profile.ModerationReason
+	}
+
+	profile.Moderate(bw.blockedWords)
+
+	_, err = ref.Update(context.Background(), []firestore.Update{{Path: "profile", Value: profile}})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save profile", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"profile", profile})
+}
+
+// GetPublicProfile returns the public profile of any bot.
+// @Summary Get public bot profile
+// @Description Retrieves the public profile of a bot without authentication. Profiles that are not visible only show the bot ID
+// @Tags profile
+// @Produce json
+// @Param id path string true "Bot ID"
+// @Success 200 {object} DataPacket "Public profile"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /public/bots/{id} [get]
+func (bw *BotWorker) GetPublicProfile(c *gin.Context) {
+	doc, err := bw.db.Collection(bw.collections.Bots).Doc(c.Param("id")).Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found", false))
+		return
+	}
+
+	portfolio := &models.Portfolio{}
+	err = doc.DataTo(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bot", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"public_profile", newPublicProfile(doc.Ref.ID, portfolio)})
+}
+
+// ModerateProfile changes the moderation state of a bot's profile.
+// @Summary Moderate a bot profile
+// @Description Shows or hides a bot's profile. Hidden profiles only show the bot ID publicly
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Bot ID"
+// @Param moderation body ModerationRequestData true "Moderation state"
+// @Success 200 {object} DataPacket "Updated profile"
+// @Failure 400 {object} ResultData "Invalid moderation state"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /admin/bots/{id}/moderation [put]
+func (bw *BotWorker) ModerateProfile(c *gin.Context) {
+	request := &ModerationRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil || (request.Moderation != models.ProfileVisible && request.Moderation != models.ProfileHidden) {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: moderation must be \"visible\" or \"hidden\"", false))
+		return
+	}
+
+	ref := bw.db.Collection(bw.collections.Bots).Doc(c.Param("id"))
+	profile := &models.BotProfile{}
+
+	err = bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		portfolio := &models.Portfolio{}
+		err = doc.DataTo(portfolio)
+		if err != nil {
+			return err
+		}
+
+		if portfolio.Profile != nil {
+			profile = portfolio.Profile
+		}
+
+		if profile.Links == nil {
+			profile.Links = make([]*models.ProfileLink, 0)
+		}
+
+		profile.Moderation = request.Moderation
+		profile.ModerationReason = request.Reason
+
+		return tx.Update(ref, []firestore.Update{{Path: "profile", Value: profile}})
+	})
+	if err != nil {
+		log.Printf("error moderating profile of bot %s: %v\n", ref.ID, err)
+		c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"profile", profile})
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Limits of the query parameters of a portfolio projection
+const (
+	defaultProjectionHorizon     = 21 // About a month of trading days
+	maxProjectionHorizon         = 252
+	defaultProjectionSimulations = 1000
+	minProjectionSimulations     = 100
+	maxProjectionSimulations     = 10000
+	defaultProjectionDays        = 252
+)
+
+// GetProjection projects the distribution of the portfolio's account value with a Monte Carlo simulation.
+// @Summary Project the portfolio's account value
+// @Description Simulates the account value of the current holdings after a horizon by drawing whole days of their historical daily returns with replacement, and reports percentiles of the simulated values and the probability of a loss. Positions are held without trading and cash earns nothing, so the projection is an illustration of risk rather than a forecast
+// @Tags portfolio
+// @Produce json
+// @Param horizon query int false "Trading days to project (default 21, at most 252)"
+// @Param simulations query int false "Number of simulated paths (default 1000, from 100 to 10000)"
+// @Param days query int false "Trading days of history the returns are drawn from (default 252, at most 756)"
+// @Param seed query int false "Seed of the random draws, to reproduce a projection"
+// @Success 200 {object} DataPacket "Projection"
+// @Failure 400 {object} ResultData "Invalid query"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Not enough price history of the holdings"
+// @Router /portfolio/projection [get]
+func (bw *BotWorker) GetProjection(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	horizon, simulations, days := defaultProjectionHorizon, defaultProjectionSimulations, defaultProjectionDays
+	for _, param := range []struct {
+		name     string
+		value    *int
+		min, max int
+	}{
+		{"horizon", &horizon, 1, maxProjectionHorizon},
+		{"simulations", &simulations, minProjectionSimulations, maxProjectionSimulations},
+		{"days", &days, 2, maxRiskDays},
+	} {
+		if query, ok := c.GetQuery(param.name); ok {
+			parsed, err := strconv.Atoi(query)
+			if err != nil || parsed < param.min || parsed > param.max {
+				c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: %s must be between %d and %d", param.name, param.min, param.max), false))
+				return
+			}
+
+			*param.value = parsed
+		}
+	}
+
+	// Random seeds stay below 2^53, so JavaScript clients can pass them back unchanged
+	seed := uint64(rand.Int64N(1 << 53))
+	if query, ok := c.GetQuery("seed"); ok {
+		parsed, err := strconv.ParseUint(query, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: seed must be a non-negative integer", false))
+			return
+		}
+
+		seed = parsed
+	}
+
+	exposure := models.CalculateExposure(portfolio, bw.latestPrices, bw.sectors)
+	projection := bw.watchlist.Daily().ProjectValue(exposure, days, horizon, simulations, seed)
+	if projection == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket(fmt.Sprintf("error: the holdings share fewer than 2 days of price history in the last %d trading days", days), false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"projection", projection})
+}
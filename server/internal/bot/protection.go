@@ -0,0 +1,447 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// ProtectionRequestData represents a request to protect a holding
+type ProtectionRequestData struct {
+	StopLoss   float64 `json:"stopLoss"`   // Price at or below which the position is closed, 0 for no stop-loss
+	TakeProfit float64 `json:"takeProfit"` // Price at or above which the position is closed, 0 for no take-profit
+}
+
+// ProtectionTriggerData is the payload of the position_protection_triggered stream event and the
+// position.protection_triggered event
+type ProtectionTriggerData struct {
+	Ticker      string                     `json:"ticker"`      // Ticker of the closed position
+	Trigger     string                     `json:"trigger"`     // "stop_loss" or "take_profit"
+	Price       float64                    `json:"price"`       // Live price that crossed the level
+	Protection  *models.PositionProtection `json:"protection"`  // The levels of the protection
+	Transaction *TransactionConfirmation   `json:"transaction"` // Confirmation of the sale that closed the position
+}
+
+// protectedPosition is a holding with a protection waiting to trigger
+type protectedPosition struct {
+	ref        *firestore.DocumentRef // Portfolio that holds the position, a bot or a shadow portfolio
+	ticker     string
+	protection *models.PositionProtection
+}
+
+// protectionBook indexes the protected holdings of every portfolio by ticker, so price updates only visit
+// the holdings of tickers with a price. Entries of positions closed by a trade are dropped when they trigger.
+type protectionBook struct {
+	mu      sync.Mutex
+	tickers map[string]map[string]*protectedPosition // Protected positions by ticker and portfolio path
+}
+
+// newProtectionBook creates an empty protection book
+func newProtectionBook() *protectionBook {
+	return &protectionBook{tickers: make(map[string]map[string]*protectedPosition)}
+}
+
+// set protects a holding, replacing its previous protection
+func (pb *protectionBook) set(position *protectedPosition) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	positions, ok := pb.tickers[position.ticker]
+	if !ok {
+		positions = make(map[string]*protectedPosition)
+		pb.tickers[position.ticker] = positions
+	}
+
+	positions[position.ref.Path] = position
+}
+
+// remove removes the protection of a holding if it is still the given protection, or any protection if nil
+func (pb *protectionBook) remove(ref *firestore.DocumentRef, ticker string, protection *models.PositionProtection) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	positions := pb.tickers[ticker]
+	position, ok := positions[ref.Path]
+	if !ok || (protection != nil && !position.protection.SetAt.Equal(protection.SetAt)) {
+		return
+	}
+
+	delete(positions, ref.Path)
+	if len(positions) == 0 {
+		delete(pb.tickers, ticker)
+	}
+}
+
+// removePortfolio removes the protections of every holding of a portfolio
+func (pb *protectionBook) removePortfolio(ref *firestore.DocumentRef) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	for ticker, positions := range pb.tickers {
+		delete(positions, ref.Path)
+		if len(positions) == 0 {
+			delete(pb.tickers, ticker)
+		}
+	}
+}
+
+// triggered returns the protected positions whose levels the prices cross, with their triggers
+func (pb *protectionBook) triggered(prices map[string]float64) map[*protectedPosition]string {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	triggered := make(map[*protectedPosition]string)
+	for ticker, positions := range pb.tickers {
+		price, ok := prices[ticker]
+		if !ok || price <= 0 {
+			continue
+		}
+
+		for _, position := range positions {
+			if trigger := position.protection.Triggered(price); trigger != "" {
+				triggered[position] = trigger
+			}
+		}
+	}
+
+	return triggered
+}
+
+// loadProtections indexes the protected holdings of every bot and shadow portfolio, so protections survive a restart
+func (bw *BotWorker) loadProtections() error {
+	docs, err := bw.db.Collection(bw.collections.Bots).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving bots: %v", err)
+	}
+
+	shadows, err := bw.db.CollectionGroup(bw.collections.Shadows).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving shadow portfolios: %v", err)
+	}
+
+	for _, doc := range append(docs, shadows...) {
+		// Protections of disqualified bots are restored when they are reinstated
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil || portfolio.Disqualified() {
+			continue
+		}
+
+		for ticker, holding := range portfolio.Holdings {
+			if holding.Protection != nil {
+				bw.protections.set(&protectedPosition{ref: doc.Ref, ticker: ticker, protection: holding.Protection})
+			}
+		}
+	}
+
+	return nil
+}
+
+// evaluateProtections closes every protected position whose stop-loss or take-profit the latest prices cross.
+// Positions of halted tickers and of markets an administrator closed are kept until trading resumes, and
+// positions whose sale fails the trading rules are retried on the next price update.
+func (bw *BotWorker) evaluateProtections() {
+	now := time.Now()
+	triggered := bw.protections.triggered(bw.latestPrices)
+
+	for position, trigger := range triggered {
+		if bw.halts.active(position.ticker, now) != nil {
+			continue
+		}
+
+		if override := bw.overrides.active(bw.exchangeFor(position.ticker).Code, now); override != nil && !override.Open {
+			continue
+		}
+
+		err := bw.closeProtectedPosition(position, trigger, bw.latestPrices[position.ticker])
+		if err != nil {
+			log.Printf("error closing protected %s position of %s: %v\n", position.ticker, position.ref.ID, err)
+		}
+	}
+}
+
+// closeProtectedPosition sells every share of a protected holding at the given price. The sale, the
+// events and the updated portfolio are stored in a single Firestore transaction. Protections that no
+// longer match the stored holding, because the position was closed or protected again, are dropped.
+func (bw *BotWorker) closeProtectedPosition(position *protectedPosition, trigger string, price float64) error {
+	unlock, err := bw.trades.lock(context.Background(), ownerOf(position.ref).ID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	transactionRef := bw.db.Collection(bw.collections.Transactions).NewDoc()
+
+	var decisionRef *firestore.DocumentRef
+	var decision *models.OrderDecision
+	var data *ProtectionTriggerData
+	var portfolio *models.Portfolio
+	var transaction *models.Transaction
+	stale := false
+
+	err = bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		stale = false
+		doc, err := tx.Get(position.ref)
+		if err != nil {
+			return err
+		}
+
+		portfolio = &models.Portfolio{}
+		err = doc.DataTo(portfolio)
+		if err != nil {
+			return err
+		}
+
+		holding, ok := portfolio.Holdings[position.ticker]
+		if !ok || holding.Protection == nil || !holding.Protection.SetAt.Equal(position.protection.SetAt) {
+			stale = true
+			return nil
+		}
+
+		request := &TransactionRequestData{Action: "sell", NumShares: holding.NumShares, Ticker: position.ticker}
+		decisionRef, decision = bw.newOrderDecision(portfolio, request, position.ref)
+		transaction = &models.Transaction{
+			Time:      decision.Time,
+			NumShares: holding.NumShares,
+			UnitCost:  price,
+			Ticker:    position.ticker,
+			Action:    "sell",
+			Currency:  portfolio.CurrencyOfRecord(),
+			Timing:    &models.ExecutionTiming{Source: models.SourceProtection, PriceTime: bw.priceTime(position.ticker)},
+			Bot:       position.ref,
+			Decision:  decisionRef,
+		}
+
+		decision.Price = price
+
+		err = bw.executeTransaction(portfolio, transaction, decision)
+		if err != nil {
+			return err
+		}
+
+		portfolio.TransactionReferences = append(portfolio.TransactionReferences, transactionRef)
+
+		err = tx.Create(transactionRef, transaction)
+		if err != nil {
+			return err
+		}
+
+		data = &ProtectionTriggerData{
+			Ticker:      position.ticker,
+			Trigger:     trigger,
+			Price:       price,
+			Protection:  position.protection,
+			Transaction: newTransactionConfirmation(portfolio, transaction, transactionRef),
+		}
+
+		// The events are added to the outbox atomically with the sale, so they are published even after a restart
+		if bw.eventsEnabled() {
+			transactionEvent, err := newTransactionEvent(position.ref, &TransactionEventData{TransactionConfirmation: data.Transaction})
+			if err != nil {
+				return err
+			}
+
+			protectionEvent, err := newProtectionEvent(position.ref, data)
+			if err != nil {
+				return err
+			}
+
+			for _, event := range []*models.Event{transactionEvent, protectionEvent} {
+				entry, err := newOutboxEntry(event)
+				if err != nil {
+					return err
+				}
+
+				err = tx.Set(bw.db.Collection(bw.collections.EventOutbox).Doc(event.ID), entry)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Update(position.ref, []firestore.Update{
+			{Path: "cash", Value: portfolio.Cash},
+			{Path: "holdings", Value: portfolio.Holdings},
+			{Path: "closedPositions", Value: portfolio.ClosedPositions},
+			{Path: "turnover", Value: portfolio.Turnover},
+			{Path: "transactions", Value: portfolio.TransactionReferences},
+		})
+	})
+
+	var rejected *ruleError
+	switch {
+	case errors.As(err, &rejected):
+		bw.saveOrderDecision(decisionRef, decision, rejected)
+		return err
+	case err != nil:
+		return err
+	}
+
+	bw.protections.remove(position.ref, position.ticker, position.protection)
+	if stale {
+		return nil
+	}
+
+	decision.Transaction = transactionRef
+	bw.saveOrderDecision(decisionRef, decision, nil)
+
+	bw.usage.recordTransaction(ownerOf(position.ref).ID)
+	bw.recordCollusionTrade(position.ref, position.ticker, "sell", data.Transaction.Time)
+	bw.afterFill(portfolio, transaction)
+	bw.publish(ownerOf(position.ref).ID, &DataPacket{"position_protection_triggered", data})
+	bw.deliverEventsAsync()
+
+	return nil
+}
+
+// newProtectionEvent creates the event of a protection that closed a position of the portfolio at ref
+func newProtectionEvent(ref *firestore.DocumentRef, data *ProtectionTriggerData) (*models.Event, error) {
+	portfolio := ""
+	if owner := ownerOf(ref); owner != ref {
+		portfolio = ref.ID
+	}
+
+	return models.NewEvent("protection-"+data.Transaction.ID, models.EventProtectionTriggered, data.Transaction.Time, ownerOf(ref).ID, portfolio, data)
+}
+
+// SetProtection attaches stop-loss and take-profit levels to a holding.
+// @Summary Protect a holding
+// @Description Attaches a stop-loss and/or take-profit level to a holding of the portfolio. When the live price crosses a level the whole position is sold, independent of conditional orders and without reserving shares or cash. Setting a protection replaces the previous one
+// @Tags portfolio
+// @Accept json
+// @Produce json
+// @Param ticker path string true "Ticker of the holding"
+// @Param protection body ProtectionRequestData true "Protection levels"
+// @Success 200 {object} DataPacket "Protected holding"
+// @Failure 400 {object} ResultData "Invalid levels"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Ticker not held"
+// @Failure 409 {object} ResultData "Another transaction of the bot is still in progress"
+// @Router /holdings/{ticker}/protection [put]
+func (bw *BotWorker) SetProtection(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	request := &ProtectionRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	ticker := symbols.Canonical(c.Param("ticker"))
+	// Firestore stores microseconds, so the protection is identified by the same time after it is loaded
+	protection := &models.PositionProtection{StopLoss: request.StopLoss, TakeProfit: request.TakeProfit, SetAt: time.Now().Truncate(time.Microsecond)}
+	err = protection.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	precision := bw.precisionFor(ticker)
+	for _, level := range []struct {
+		name  string
+		price float64
+	}{{"stopLoss", protection.StopLoss}, {"takeProfit", protection.TakeProfit}} {
+		if level.price == 0 {
+			continue
+		}
+
+		if err := precision.CheckPrice(level.price); err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: invalid "+level.name+" for "+ticker+": "+err.Error(), false))
+			return
+		}
+	}
+
+	// A level the price already crossed would close the position at once
+	if price, ok := bw.latestPrices[ticker]; ok && protection.Triggered(price) != "" {
+		c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: the stopLoss must be below and the takeProfit above the current price of %v", price), false))
+		return
+	}
+
+	// The holding must not be closed by a trade between the check and the update
+	unlock, ok := bw.lockTrades(c, ref)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	portfolio, ok := bw.reloadPortfolio(c, ref)
+	if !ok {
+		return
+	}
+
+	holding, held := portfolio.Holdings[ticker]
+	if !held {
+		c.AbortWithStatusJSON(404, NewResultPacket(fmt.Sprintf("error: %s is not held", ticker), false))
+		return
+	}
+
+	_, err = ref.Update(context.Background(), []firestore.Update{{FieldPath: firestore.FieldPath{"holdings", ticker, "protection"}, Value: protection}})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save protection", false))
+		return
+	}
+
+	holding.Protection = protection
+	bw.protections.set(&protectedPosition{ref: ref, ticker: ticker, protection: protection})
+
+	c.JSON(200, &DataPacket{"holding", holding})
+}
+
+// ClearProtection removes the stop-loss and take-profit levels of a holding.
+// @Summary Remove the protection of a holding
+// @Description Removes the stop-loss and take-profit levels of a holding, so the position is no longer closed automatically
+// @Tags portfolio
+// @Produce json
+// @Param ticker path string true "Ticker of the holding"
+// @Success 200 {object} DataPacket "Unprotected holding"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Ticker not held or not protected"
+// @Failure 409 {object} ResultData "Another transaction of the bot is still in progress"
+// @Router /holdings/{ticker}/protection [delete]
+func (bw *BotWorker) ClearProtection(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	ticker := symbols.Canonical(c.Param("ticker"))
+
+	unlock, ok := bw.lockTrades(c, ref)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	portfolio, ok := bw.reloadPortfolio(c, ref)
+	if !ok {
+		return
+	}
+
+	holding, held := portfolio.Holdings[ticker]
+	if !held || holding.Protection == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket(fmt.Sprintf("error: %s is not held or not protected", ticker), false))
+		return
+	}
+
+	_, err := ref.Update(context.Background(), []firestore.Update{{FieldPath: firestore.FieldPath{"holdings", ticker, "protection"}, Value: firestore.Delete}})
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to remove protection", false))
+		return
+	}
+
+	holding.Protection = nil
+	bw.protections.remove(ref, ticker, nil)
+
+	c.JSON(200, &DataPacket{"holding", holding})
+}
@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olahol/melody"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// StandingEntry is a sanitized leaderboard entry that is safe to show without authentication.
+// It deliberately omits holdings, cash and transactions.
+type StandingEntry struct {
+	BotID            string    `json:"botId"`            // ID of the bot document
+	Name             string    `json:"name"`             // Public display name of the bot, its ID if it has none
+	Rank             int       `json:"rank"`             // 1-based position by the ranking metric, account value on the public feed
+	AccountValue     float64   `json:"accountValue"`     // Account value rounded with the cash rounding policy
+	Return           float64   `json:"return"`           // Return since the bot's own inception, 0.05 is 5%
+	AnnualizedReturn float64   `json:"annualizedReturn"` // Return since inception, annualized for bots older than a year
+	Score            float64   `json:"score"`            // Composite score of the last settlement, the return in percent if never settled
+	LastHeartbeat    time.Time `json:"lastHeartbeat"`    // When the bot last sent a heartbeat, zero if it never did
+	Alive            bool      `json:"alive"`            // Whether the bot sent a heartbeat within the heartbeat timeout
+}
+
+// newStandingEntry creates an unranked leaderboard entry of a bot valued at the given account value
+func newStandingEntry(id string, portfolio *models.Portfolio, value float64, at time.Time) *StandingEntry {
+	total, annualized := portfolio.Returns(value, at)
+
+	score := total * 100
+	if portfolio.Score != nil {
+		score = portfolio.Score.Composite
+	}
+
+	return &StandingEntry{
+		BotID:            id,
+		Name:             portfolio.Profile.PublicName(id),
+		AccountValue:     money.Default().Round(value),
+		Return:           total,
+		AnnualizedReturn: annualized,
+		Score:            score,
+		LastHeartbeat:    portfolio.LastHeartbeat,
+		Alive:            alive(portfolio.LastHeartbeat, at),
+	}
+}
+
+// metricValue returns the value of an entry for a ranking metric
+func (entry *StandingEntry) metricValue(metric string) float64 {
+	switch metric {
+	case models.MetricReturn:
+		return entry.Return
+	case models.MetricAnnualizedReturn:
+		return entry.AnnualizedReturn
+	case models.MetricScore:
+		return entry.Score
+	default:
+		return entry.AccountValue
+	}
+}
+
+// LeaderboardDelta contains the leaderboard entries that changed since the previous update
+type LeaderboardDelta struct {
+	Time    time.Time        `json:"time"`    // When the valuation finished
+	Changed []*StandingEntry `json:"changed"` // Entries that are new or whose rank or value changed
+	Removed []string         `json:"removed"` // IDs of bots no longer on the leaderboard
+}
+
+// EquityTick contains the account value of every bot at a point in time
+type EquityTick struct {
+	Time   time.Time          `json:"time"`   // When the valuation finished
+	Values map[string]float64 `json:"values"` // Account value by bot ID, rounded with the cash rounding policy
+}
+
+// publicFeed broadcasts live standings to unauthenticated display clients
+type publicFeed struct {
+	mu        sync.Mutex
+	hub       *melody.Melody
+	standings map[string]*StandingEntry
+	updatedAt time.Time
+}
+
+// newPublicFeed creates the public feed and sends the current standings to every new client
+func newPublicFeed() *publicFeed {
+	feed := &publicFeed{
+		hub:       melody.New(),
+		standings: make(map[string]*StandingEntry),
+	}
+
+	// The feed is read-only and public, so display screens may connect from any origin
+	feed.hub.Upgrader.CheckOrigin = func(r *http.Request) bool {
+		return true
+	}
+
+	feed.hub.HandleConnect(func(s *melody.Session) {
+		err := s.Write(feed.snapshot().JSON())
+		if err != nil {
+			log.Printf("error sending leaderboard snapshot: %v\n", err)
+		}
+	})
+
+	feed.hub.HandleError(func(s *melody.Session, err error) {
+		log.Printf("public websocket error: %v\n", err)
+	})
+
+	return feed
+}
+
+// snapshot returns the full current standings as a data packet
+func (pf *publicFeed) snapshot() *DataPacket {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	return &DataPacket{"leaderboard_snapshot", &LeaderboardDelta{
+		Time:    pf.updatedAt,
+		Changed: sortedStandings(pf.standings, models.MetricAccountValue),
+		Removed: make([]string, 0),
+	}}
+}
+
+// update replaces the standings with the given entries, ranked by account value, and
+// broadcasts the leaderboard changes and an equity tick to every public client
+func (pf *publicFeed) update(standings map[string]*StandingEntry, now time.Time) {
+	ranked := rankStandings(standings, models.MetricAccountValue)
+	for _, entry := range ranked {
+		standings[entry.BotID] = entry
+	}
+
+	pf.mu.Lock()
+	delta := &LeaderboardDelta{
+		Time:    now,
+		Changed: make([]*StandingEntry, 0),
+		Removed: make([]string, 0),
+	}
+
+	for _, entry := range ranked {
+		previous, ok := pf.standings[entry.BotID]
+		if !ok || *previous != *entry {
+			delta.Changed = append(delta.Changed, entry)
+		}
+	}
+
+	for id := range pf.standings {
+		if _, ok := standings[id]; !ok {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+
+	pf.standings = standings
+	pf.updatedAt = now
+	pf.mu.Unlock()
+
+	tick := &EquityTick{Time: now, Values: make(map[string]float64, len(standings))}
+	for id, entry := range standings {
+		tick.Values[id] = entry.AccountValue
+	}
+
+	pf.broadcast(&DataPacket{"equity_tick", tick})
+	if len(delta.Changed) > 0 || len(delta.Removed) > 0 {
+		pf.broadcast(&DataPacket{"leaderboard_delta", delta})
+	}
+}
+
+// broadcast sends a data packet to every public client
+func (pf *publicFeed) broadcast(packet *DataPacket) {
+	err := pf.hub.Broadcast(packet.JSON())
+	if err != nil {
+		log.Printf("error broadcasting %s: %v\n", packet.Type, err)
+	}
+}
+
+// rankStandings returns copies of the entries sorted by a ranking metric with their ranks set
+func rankStandings(standings map[string]*StandingEntry, metric string) []*StandingEntry {
+	ranked := sortedStandings(standings, metric)
+	for i, entry := range ranked {
+		entry.Rank = i + 1
+	}
+
+	return ranked
+}
+
+// sortedStandings returns copies of the entries sorted by a descending ranking metric, ties broken by bot ID
+func sortedStandings(standings map[string]*StandingEntry, metric string) []*StandingEntry {
+	sorted := make([]*StandingEntry, 0, len(standings))
+	for _, entry := range standings {
+		copied := *entry
+		sorted = append(sorted, &copied)
+	}
+
+	sort.Slice(sorted, func(a, b int) bool {
+		if valueA, valueB := sorted[a].metricValue(metric), sorted[b].metricValue(metric); valueA != valueB {
+			return valueA > valueB
+		}
+
+		return sorted[a].BotID < sorted[b].BotID
+	})
+
+	return sorted
+}
+
+// publishStandings publishes the valued bots to the public feed. Shadow portfolios and disqualified bots are excluded.
+// Bots whose value could not be calculated keep their previous value, or their stored value if they have none.
+func (bw *BotWorker) publishStandings(stored []*StoredPortfolio, valued []*models.Portfolio) {
+	bw.public.mu.Lock()
+	previous := make(map[string]float64, len(bw.public.standings))
+	for id, entry := range bw.public.standings {
+		previous[id] = entry.AccountValue
+	}
+	bw.public.mu.Unlock()
+
+	now := time.Now()
+	standings := make(map[string]*StandingEntry, len(stored))
+	for i, entry := range stored {
+		if ownerOf(entry.Ref) != entry.Ref {
+			continue
+		}
+
+		portfolio := entry.Portfolio
+		if portfolio.Disqualified() {
+			continue
+		}
+
+		value := portfolio.AccountValue
+		if valued[i] != nil {
+			value = valued[i].AccountValue
+		} else if previousValue, ok := previous[entry.Ref.ID]; ok {
+			value = previousValue
+		}
+
+		standings[entry.Ref.ID] = newStandingEntry(entry.Ref.ID, portfolio, value, now)
+	}
+
+	bw.public.update(standings, now)
+}
+
+// PublicStream upgrades the request to a read-only WebSocket that receives live standings.
+// @Summary Subscribe to live standings
+// @Description Opens an unauthenticated WebSocket that receives a leaderboard snapshot, then leaderboard deltas and equity ticks after every valuation
+// @Tags stream
+// @Success 101 "Switching protocols"
+// @Router /public/ws [get]
+func (bw *BotWorker) PublicStream(c *gin.Context) {
+	err := bw.public.hub.HandleRequest(c.Writer, c.Request)
+	if err != nil {
+		log.Printf("error opening public websocket: %v\n", err)
+	}
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// maxPreviousCloseRows limits how many daily rows are searched for a ticker's previous close
+const maxPreviousCloseRows = 10
+
+// Quote is the latest price of a ticker with its change since the previous close
+type Quote struct {
+	Ticker            string    `json:"ticker"`            // Ticker symbol
+	Price             float64   `json:"price"`             // Latest price
+	Time              time.Time `json:"time"`              // When the price was last updated
+	Stale             bool      `json:"stale"`             // Whether the last price update failed
+	PreviousClose     float64   `json:"previousClose"`     // Close of the last trading day before today, 0 if unknown
+	PreviousCloseDate time.Time `json:"previousCloseDate"` // Date of the previous close, zero if unknown
+	Change            float64   `json:"change"`            // Price minus the previous close, 0 if the previous close is unknown
+	ChangePercent     float64   `json:"changePercent"`     // Change as a percentage of the previous close
+}
+
+// QuoteResult contains the quotes of the requested tickers
+type QuoteResult struct {
+	Quotes  map[string]*Quote `json:"quotes"`  // Quotes by ticker
+	Unknown []string          `json:"unknown"` // Requested tickers without a live price
+}
+
+// previousClose returns the close of a ticker on the last trading day before the given day
+func previousClose(history *models.History, ticker string, day time.Time) (float64, time.Time) {
+	// The rows before the day end right before the first row on or after it
+	end, _ := history.CeilRow(day)
+	index := end - 1
+	for i := index; i >= 0 && i > index-maxPreviousCloseRows; i-- {
+		if period, ok := history.Rows[i].Data.Load(ticker); ok {
+			return period.Close, history.Rows[i].Date
+		}
+	}
+
+	return 0, time.Time{}
+}
+
+// GetQuotes returns the latest price, day change and previous close of the requested tickers.
+// @Summary Get quotes
+// @Description Retrieves the latest price, day change and previous close of selected watched tickers
+// @Tags stocks
+// @Produce json
+// @Param tickers query string true "Comma separated ticker symbols"
+// @Success 200 {object} DataPacket "Quotes, with requested tickers that have no price listed as unknown"
+// @Header 200 {string} X-Price-Source "Data source that provided the prices"
+// @Failure 400 {object} ResultData "No tickers requested"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "None of the tickers has a price"
+// @Router /quote [get]
+func (bw *BotWorker) GetQuotes(c *gin.Context) {
+	tickers := make([]string, 0)
+	for _, ticker := range strings.Split(c.Query("tickers"), ",") {
+		if ticker = symbols.Canonical(ticker); ticker != "" {
+			tickers = append(tickers, ticker)
+		}
+	}
+
+	if len(tickers) == 0 {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: tickers must list at least one ticker", false))
+		return
+	}
+
+	// Serve the previous prices when fault injection asks for stale data
+	prices := bw.latestPrices
+	if c.GetBool(StalePricesKey) {
+		prices = bw.stalePrices
+	}
+
+	updated := bw.pricesTime
+	day := updated.UTC().Truncate(24 * time.Hour)
+	result := &QuoteResult{Quotes: make(map[string]*Quote, len(tickers)), Unknown: make([]string, 0)}
+
+	for _, ticker := range tickers {
+		price, ok := prices[ticker]
+		if !ok {
+			result.Unknown = append(result.Unknown, ticker)
+			continue
+		}
+
+		quote := &Quote{Ticker: ticker, Price: price, Time: updated, Stale: bw.pricesErr != nil}
+		quote.PreviousClose, quote.PreviousCloseDate = previousClose(bw.watchlist.Daily(), ticker, day)
+		if quote.PreviousClose > 0 {
+			quote.Change = price - quote.PreviousClose
+			quote.ChangePercent = quote.Change / quote.PreviousClose * 100
+		}
+
+		result.Quotes[ticker] = quote
+	}
+
+	if len(result.Quotes) == 0 {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: no live price for "+strings.Join(result.Unknown, ", ")+", add the tickers to the watchlist first", false))
+		return
+	}
+
+	c.Header("X-Price-Source", bw.priceSource)
+	c.JSON(200, &DataPacket{"quotes", result})
+}
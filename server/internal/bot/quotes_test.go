@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// testDay returns midnight UTC of a day in January 2024
+func testDay(d int) time.Time {
+	return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC)
+}
+
+// dailyHistory returns a history of a ticker with a bar on each of the given days of January 2024, closing at 100
+// plus the day with a volume of 1000 times the day
+func dailyHistory(ticker string, days ...int) *models.History {
+	history := models.NewHistory()
+	addDays(history, ticker, days...)
+	return history
+}
+
+// addDays adds bars of a ticker to a history like dailyHistory
+func addDays(history *models.History, ticker string, days ...int) {
+	periods := make([]models.PackedPeriod, 0, len(days))
+	for _, d := range days {
+		periods = append(periods, models.PackedPeriod{Date: testDay(d), Close: float64(100 + d), Volume: int64(1000 * d)})
+	}
+
+	history.AddData(periods, ticker, 0)
+}
+
+func TestPreviousClose(t *testing.T) {
+	history := dailyHistory("AAPL", 2, 3, 4, 5, 8)
+
+	// MSFT only traded on the 2nd, so its previous close on later days is further back
+	addDays(history, "MSFT", 2)
+
+	tests := []struct {
+		name      string
+		history   *models.History
+		ticker    string
+		day       time.Time
+		wantClose float64
+		wantDate  time.Time
+	}{
+		{"row dated on the day is excluded", history, "AAPL", testDay(4), 103, testDay(3)},
+		{"day of the last row", history, "AAPL", testDay(8), 105, testDay(5)},
+		{"day without a row", history, "AAPL", testDay(6), 105, testDay(5)},
+		{"later on the day of a row", history, "AAPL", testDay(4).Add(15 * time.Hour), 104, testDay(4)},
+		{"after the last row", history, "AAPL", testDay(20), 108, testDay(8)},
+		{"day of the first row", history, "AAPL", testDay(2), 0, time.Time{}},
+		{"before the first row", history, "AAPL", testDay(1), 0, time.Time{}},
+		{"ticker missing from the previous rows", history, "MSFT", testDay(5), 102, testDay(2)},
+		{"unknown ticker", history, "TSLA", testDay(5), 0, time.Time{}},
+		{"empty history", models.NewHistory(), "AAPL", testDay(5), 0, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			close, date := previousClose(tt.history, tt.ticker, tt.day)
+			if close != tt.wantClose || !date.Equal(tt.wantDate) {
+				t.Errorf("previousClose = %g on %v, want %g on %v", close, date, tt.wantClose, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestPreviousCloseSearchLimit(t *testing.T) {
+	// AAPL only traded on the 1st, MSFT on every day after it
+	history := dailyHistory("AAPL", 1)
+	for d := 2; d <= 2+maxPreviousCloseRows; d++ {
+		addDays(history, "MSFT", d)
+	}
+
+	if close, _ := previousClose(history, "AAPL", testDay(2+maxPreviousCloseRows)); close != 0 {
+		t.Errorf("previousClose = %g, want 0 beyond %d rows", close, maxPreviousCloseRows)
+	}
+
+	if close, _ := previousClose(history, "AAPL", testDay(1+maxPreviousCloseRows)); close != 101 {
+		t.Errorf("previousClose = %g, want 101 within %d rows", close, maxPreviousCloseRows)
+	}
+}
@@ -0,0 +1,344 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Reconciliation tolerances, unless set with RECONCILE_CASH_TOLERANCE and RECONCILE_SHARES_TOLERANCE
+const (
+	defaultReconcileCashTolerance   = 0.01 // One cent of the currency of record
+	defaultReconcileSharesTolerance = 1e-6 // Well above the rounding of fractional shares
+)
+
+// ReconciliationReport is the result of a reconciliation run
+type ReconciliationReport struct {
+	GeneratedAt time.Time                    `json:"generatedAt"` // When the run started
+	Duration    time.Duration                `json:"duration"`    // How long the run took in nanoseconds
+	Tolerance   models.ReconcileTolerance    `json:"tolerance"`   // Differences that are not flagged
+	Portfolios  int                          `json:"portfolios"`  // Portfolios reconciled
+	Skipped     []string                     `json:"skipped"`     // Portfolios without an inception value, which cannot be recomputed
+	Failed      []string                     `json:"failed"`      // Portfolios whose transactions could not be loaded
+	Divergent   []*models.ReconciliationFlag `json:"divergent"`   // Flags of the portfolios that diverged, including dismissed ones
+	Cleared     int                          `json:"cleared"`     // Open flags of portfolios that matched again
+}
+
+// reconciliationTracker keeps the tolerances and the last reconciliation report
+type reconciliationTracker struct {
+	mu        sync.Mutex
+	tolerance models.ReconcileTolerance
+	report    *ReconciliationReport // Last report, nil if no run finished
+}
+
+// newReconciliationTracker creates a reconciliation tracker configured by RECONCILE_CASH_TOLERANCE and RECONCILE_SHARES_TOLERANCE
+func newReconciliationTracker() (*reconciliationTracker, error) {
+	tracker := &reconciliationTracker{tolerance: models.ReconcileTolerance{
+		Cash:   defaultReconcileCashTolerance,
+		Shares: defaultReconcileSharesTolerance,
+	}}
+
+	for key, value := range map[string]*float64{
+		"RECONCILE_CASH_TOLERANCE":   &tracker.tolerance.Cash,
+		"RECONCILE_SHARES_TOLERANCE": &tracker.tolerance.Shares,
+	} {
+		if env := os.Getenv(key); env != "" {
+			parsed, err := strconv.ParseFloat(env, 64)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("invalid %s: %s", key, env)
+			}
+
+			*value = parsed
+		}
+	}
+
+	return tracker, nil
+}
+
+// reconcilePortfolio recomputes a portfolio from its transactions since its inception. The portfolio and its
+// transactions are read in one read-only transaction, so a trade saved during the run cannot show up in only one of them.
+// Returns nil divergences if the portfolio has no inception value to recompute from.
+func (bw *BotWorker) reconcilePortfolio(ref *firestore.DocumentRef, tolerance models.ReconcileTolerance) ([]*models.Divergence, error) {
+	var divergences []*models.Divergence
+	err := bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		portfolio := &models.Portfolio{}
+		err = doc.DataTo(portfolio)
+		if err != nil {
+			return err
+		}
+
+		if portfolio.InceptionValue == 0 {
+			divergences = nil
+			return nil
+		}
+
+		// Resets clear the portfolio but keep the transaction documents, so only trades since the inception count
+		docs, err := tx.Documents(bw.db.Collection(bw.collections.Transactions).Where("bot", "==", ref)).GetAll()
+		if err != nil {
+			return err
+		}
+
+		transactions := make([]*models.Transaction, 0, len(docs))
+		for _, doc := range docs {
+			transaction := &models.Transaction{}
+			err = doc.DataTo(transaction)
+			if err != nil {
+				return fmt.Errorf("error reading transaction %s: %v", doc.Ref.ID, err)
+			}
+
+			if !transaction.Time.Before(portfolio.InceptionDate) {
+				transactions = append(transactions, transaction)
+			}
+		}
+
+		divergences = models.Reconcile(portfolio, transactions, tolerance)
+		return nil
+	}, firestore.ReadOnly)
+
+	return divergences, err
+}
+
+// reconcilePortfolios recomputes the cash and holdings of every bot and shadow portfolio from its transactions and
+// flags the portfolios that diverge from their stored document for admin review. The job fails when a portfolio
+// diverges, so divergences show up in the job status before they decide a competition.
+func (bw *BotWorker) reconcilePortfolios() error {
+	start := time.Now()
+	bw.reconciler.mu.Lock()
+	tolerance := bw.reconciler.tolerance
+	bw.reconciler.mu.Unlock()
+
+	refs, err := bw.db.Collection(bw.collections.Bots).DocumentRefs(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving bots: %v", err)
+	}
+
+	shadows, err := bw.db.CollectionGroup(bw.collections.Shadows).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving shadow portfolios: %v", err)
+	}
+
+	for _, doc := range shadows {
+		refs = append(refs, doc.Ref)
+	}
+
+	flagDocs, err := bw.db.Collection(bw.collections.ReconcileFlags).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving reconciliation flags: %v", err)
+	}
+
+	flags := make(map[string]*models.ReconciliationFlag, len(flagDocs))
+	for _, doc := range flagDocs {
+		flag := &models.ReconciliationFlag{}
+		if doc.DataTo(flag) == nil {
+			flag.ID = doc.Ref.ID
+			flags[flag.ID] = flag
+		}
+	}
+
+	report := &ReconciliationReport{
+		GeneratedAt: start,
+		Tolerance:   tolerance,
+		Skipped:     make([]string, 0),
+		Failed:      make([]string, 0),
+		Divergent:   make([]*models.ReconciliationFlag, 0),
+	}
+
+	open := 0
+	for _, ref := range refs {
+		divergences, err := bw.reconcilePortfolio(ref, tolerance)
+		switch {
+		case err != nil:
+			log.Printf("error reconciling portfolio %s: %v\n", ref.ID, err)
+			report.Failed = append(report.Failed, ref.ID)
+			continue
+		case divergences == nil:
+			report.Skipped = append(report.Skipped, ref.ID)
+			continue
+		}
+
+		report.Portfolios++
+		now := time.Now()
+		flag, ok := flags[ref.ID]
+		if len(divergences) == 0 {
+			if ok && flag.Status == models.ReconciliationOpen {
+				flag.Status = models.ReconciliationCleared
+				bw.saveReconciliationFlag(flag)
+				report.Cleared++
+			}
+
+			continue
+		}
+
+		if !ok {
+			flag = &models.ReconciliationFlag{ID: ref.ID, Bot: ref, BotID: ownerOf(ref).ID, Shadow: ownerOf(ref) != ref}
+		}
+
+		if flag.Observe(divergences, now) {
+			open++
+		}
+
+		bw.saveReconciliationFlag(flag)
+		report.Divergent = append(report.Divergent, flag)
+	}
+
+	report.Duration = time.Since(start)
+	bw.reconciler.mu.Lock()
+	bw.reconciler.report = report
+	bw.reconciler.mu.Unlock()
+
+	if open > 0 {
+		log.Printf("ALERT: reconciliation found %d portfolios diverging from their transactions\n", open)
+		return fmt.Errorf("%d portfolios diverge from their transactions", open)
+	}
+
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("failed to reconcile %d portfolios", len(report.Failed))
+	}
+
+	return nil
+}
+
+// saveReconciliationFlag stores a reconciliation flag under the ID of its portfolio
+func (bw *BotWorker) saveReconciliationFlag(flag *models.ReconciliationFlag) {
+	_, err := bw.db.Collection(bw.collections.ReconcileFlags).Doc(flag.ID).Set(context.Background(), flag)
+	if err != nil {
+		log.Printf("error saving reconciliation flag of %s: %v\n", flag.ID, err)
+	}
+}
+
+// GetReconciliationReport returns the last reconciliation run.
+// @Summary Get the reconciliation report
+// @Description Reports the last run of the portfolio_reconciliation job, which recomputes the cash and holdings of every portfolio from its transactions and flags portfolios that diverge from their stored document by more than the tolerance
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Reconciliation report"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "No run finished yet"
+// @Router /admin/reconciliation [get]
+func (bw *BotWorker) GetReconciliationReport(c *gin.Context) {
+	bw.reconciler.mu.Lock()
+	report := bw.reconciler.report
+	bw.reconciler.mu.Unlock()
+
+	if report == nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: no reconciliation ran yet, run the portfolio_reconciliation job", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"reconciliation_report", report})
+}
+
+// GetReconciliationFlags lists the portfolios flagged by the reconciliation.
+// @Summary List reconciliation flags
+// @Description Lists the portfolios whose cash or holdings diverged from their transactions, most recently seen first
+// @Tags admin
+// @Produce json
+// @Param status query string false "Only return flags of this status: open (default), resolved, dismissed, cleared or all"
+// @Success 200 {object} DataPacket "Reconciliation flags"
+// @Failure 400 {object} ResultData "Invalid status"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/reconciliation/flags [get]
+func (bw *BotWorker) GetReconciliationFlags(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ReconciliationOpen)
+	query := bw.db.Collection(bw.collections.ReconcileFlags).Query
+	switch status {
+	case "all":
+	case models.ReconciliationOpen, models.ReconciliationResolved, models.ReconciliationDismissed, models.ReconciliationCleared:
+		query = query.Where("status", "==", status)
+	default:
+		c.AbortWithStatusJSON(400, NewResultPacket("error: status must be open, resolved, dismissed, cleared or all", false))
+		return
+	}
+
+	docs, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve reconciliation flags", false))
+		return
+	}
+
+	flags := make([]*models.ReconciliationFlag, 0, len(docs))
+	for _, doc := range docs {
+		flag := &models.ReconciliationFlag{}
+		if doc.DataTo(flag) == nil {
+			flag.ID = doc.Ref.ID
+			flags = append(flags, flag)
+		}
+	}
+
+	slices.SortFunc(flags, func(a, b *models.ReconciliationFlag) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+
+	c.JSON(200, &DataPacket{"reconciliation_flags", flags})
+}
+
+// ReconciliationReviewData is the review of a reconciliation flag
+type ReconciliationReviewData struct {
+	Status string `json:"status" binding:"required,oneof=resolved dismissed"` // "resolved" once the portfolio was corrected, "dismissed" to accept the divergence
+	Note   string `json:"note" binding:"max=2000"`                            // What was found or done
+}
+
+// ReviewReconciliationFlag records an admin's review of a reconciliation flag.
+// @Summary Review a reconciliation flag
+// @Description Marks a flagged portfolio as resolved once it was corrected, or dismisses the divergence. Resolved flags reopen if the next run still finds a divergence, dismissed flags only if the divergence changes
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "ID of the flagged portfolio"
+// @Param review body ReconciliationReviewData true "Review"
+// @Success 200 {object} DataPacket "Reconciliation flag"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Flag not found"
+// @Router /admin/reconciliation/flags/{id}/review [post]
+func (bw *BotWorker) ReviewReconciliationFlag(c *gin.Context) {
+	request := &ReconciliationReviewData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	ref := bw.db.Collection(bw.collections.ReconcileFlags).Doc(c.Param("id"))
+	flag := &models.ReconciliationFlag{}
+	err = bw.db.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		err = doc.DataTo(flag)
+		if err != nil {
+			return err
+		}
+
+		flag.Status = request.Status
+		flag.ReviewedAt = time.Now()
+		flag.ReviewNote = strings.TrimSpace(request.Note)
+		return tx.Set(ref, flag)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: reconciliation flag not found", false))
+		return
+	}
+
+	flag.ID = ref.ID
+	bw.audit(c, "reconciliation.review", fmt.Sprintf("marked the reconciliation flag of %s as %s: %s", ref.ID, flag.Status, flag.ReviewNote), flag)
+	c.JSON(200, &DataPacket{"reconciliation_flag", flag})
+}
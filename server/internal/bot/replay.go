@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// GetReplay returns the valuations and transactions of the portfolio as frames for playback.
+// @Summary Get portfolio replay
+// @Description Merges the portfolio's valuations and transactions into a time-ordered stream of frames with the account value, cash and shares of every position at each point, so a season can be animated without the raw history
+// @Tags portfolio
+// @Produce json
+// @Param start query string false "First day of the replay as YYYY-MM-DD, defaults to the inception of the portfolio"
+// @Param end query string false "Last day of the replay as YYYY-MM-DD, defaults to today"
+// @Success 200 {object} DataPacket "Replay"
+// @Failure 400 {object} ResultData "Invalid period"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /portfolio/replay [get]
+func (bw *BotWorker) GetReplay(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	var start, end time.Time
+	if query := c.Query("start"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: start must be a date formatted as YYYY-MM-DD", false))
+			return
+		}
+
+		start = parsed
+	}
+
+	if query := c.Query("end"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil || parsed.Before(start) {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: end must be a date formatted as YYYY-MM-DD on or after start", false))
+			return
+		}
+
+		// The end day is included
+		end = parsed.AddDate(0, 0, 1)
+	}
+
+	transactions, err := bw.loadTransactions(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"replay", models.BuildReplay(portfolio, transactions, start, end)})
+}
@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// maxWindowDays is the longest rolling window a leaderboard can be ranked over
+const maxWindowDays = 365
+
+// WindowEntry is a leaderboard entry ranked by the return over a rolling window
+type WindowEntry struct {
+	BotID string `json:"botId"` // ID of the bot document
+	Name  string `json:"name"`  // Public display name of the bot, its ID if it has none
+	Rank  int    `json:"rank"`  // 1-based position by the return over the window
+	*models.PeriodReturn
+}
+
+// WindowLeaderboard ranks the bots of a competition by their return over a rolling window of daily valuations
+type WindowLeaderboard struct {
+	CompetitionID string         `json:"competitionId"` // ID of the competition
+	Window        string         `json:"window"`        // Length of the window, such as "7d"
+	Start         time.Time      `json:"start"`         // Start of the window, returns are measured from the last valuation on or before it
+	End           time.Time      `json:"end"`           // End of the window, returns are measured to the last valuation before it
+	Time          time.Time      `json:"time"`          // When the leaderboard was calculated
+	Entries       []*WindowEntry `json:"entries"`       // Ranked entries, bots without a valuation in the window are omitted
+}
+
+// windowCache caches rolling window leaderboards for the rest of the day they were calculated on.
+// Windows end at midnight UTC, so a leaderboard only changes when the day does.
+type windowCache struct {
+	mu     sync.Mutex
+	day    time.Time
+	boards map[string]*WindowLeaderboard
+}
+
+// newWindowCache creates an empty window cache
+func newWindowCache() *windowCache {
+	return &windowCache{boards: make(map[string]*WindowLeaderboard)}
+}
+
+// get returns the cached leaderboard of a competition and window for a day, nil if it is not cached
+func (wc *windowCache) get(day time.Time, competitionID, window string) *WindowLeaderboard {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if !wc.day.Equal(day) {
+		return nil
+	}
+
+	return wc.boards[competitionID+"/"+window]
+}
+
+// put caches the leaderboard of a competition and window, dropping the leaderboards of earlier days
+func (wc *windowCache) put(day time.Time, board *WindowLeaderboard) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if !wc.day.Equal(day) {
+		wc.day = day
+		wc.boards = make(map[string]*WindowLeaderboard)
+	}
+
+	wc.boards[board.CompetitionID+"/"+board.Window] = board
+}
+
+// invalidate drops the cached leaderboards of a competition, after a change of the bots it ranks
+func (wc *windowCache) invalidate(competition *firestore.DocumentRef) {
+	if competition == nil {
+		return
+	}
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	for key, board := range wc.boards {
+		if board.CompetitionID == competition.ID {
+			delete(wc.boards, key)
+		}
+	}
+}
+
+// parseWindow parses a rolling window of whole days, such as "7d" or "30d"
+func parseWindow(window string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(window, "d"))
+	if err != nil || !strings.HasSuffix(window, "d") || days < 1 || days > maxWindowDays {
+		return 0, fmt.Errorf("window must be a number of days between 1d and %dd", maxWindowDays)
+	}
+
+	return days, nil
+}
+
+// windowLeaderboard ranks the bots of a competition by their return over the days before today, using the cached
+// leaderboard if it was already calculated today
+func (bw *BotWorker) windowLeaderboard(competition *firestore.DocumentRef, days int, now time.Time) (*WindowLeaderboard, error) {
+	window := fmt.Sprintf("%dd", days)
+	end := now.UTC().Truncate(24 * time.Hour)
+	if board := bw.windows.get(end, competition.ID, window); board != nil {
+		return board, nil
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Bots).Where("competition", "==", competition).Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	board := &WindowLeaderboard{
+		CompetitionID: competition.ID,
+		Window:        window,
+		Start:         end.AddDate(0, 0, -days),
+		End:           end,
+		Time:          now,
+		Entries:       make([]*WindowEntry, 0, len(docs)),
+	}
+
+	for _, doc := range docs {
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil || portfolio.Disqualified() {
+			continue
+		}
+
+		period := portfolio.ReturnBetween(board.Start, board.End)
+		if period == nil {
+			continue
+		}
+
+		board.Entries = append(board.Entries, &WindowEntry{BotID: doc.Ref.ID, Name: portfolio.Profile.PublicName(doc.Ref.ID), PeriodReturn: period})
+	}
+
+	sort.Slice(board.Entries, func(a, b int) bool {
+		if board.Entries[a].Return != board.Entries[b].Return {
+			return board.Entries[a].Return > board.Entries[b].Return
+		}
+
+		return board.Entries[a].BotID < board.Entries[b].BotID
+	})
+
+	for i, entry := range board.Entries {
+		entry.Rank = i + 1
+	}
+
+	bw.windows.put(end, board)
+	return board, nil
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// evaluateCompetitionRules checks a transaction against the competition rules,
+// which depend on state outside the portfolio such as the earnings calendar.
+// Custom rule hooks are checked first. The returned evaluations are in the order the rules are checked.
+func (bw *BotWorker) evaluateCompetitionRules(portfolio *models.Portfolio, transaction *models.Transaction) []models.RuleEvaluation {
+	return append(bw.hookRules(portfolio, transaction),
+		disqualificationRule(portfolio),
+		bw.tradeableRule(transaction),
+		bw.universeRule(portfolio, transaction),
+		bw.marketHoursRule(transaction),
+		bw.tradingHaltRule(transaction),
+		bw.liquidityRule(transaction),
+		bw.turnoverRule(portfolio, transaction),
+		bw.earningsBlackoutRule(portfolio, transaction),
+		bw.collusionRule(transaction),
+	)
+}
+
+// executeTransaction records the rule evaluations of a transaction in its decision and
+// executes it on the portfolio if every competition, price protection and portfolio rule passes.
+// Returns a *ruleError if the transaction was rejected.
+func (bw *BotWorker) executeTransaction(portfolio *models.Portfolio, transaction *models.Transaction, decision *models.OrderDecision) error {
+	bw.applySession(transaction)
+	decision.Price = transaction.UnitCost
+	decision.Fee = transaction.Fee
+	decision.Session = transaction.Session
+
+	decision.CompetitionRules = bw.evaluateCompetitionRules(portfolio, transaction)
+	decision.Rules = append(decision.PriceRules(), portfolio.Evaluate(transaction)...)
+
+	err := models.FirstFailure(decision.CompetitionRules)
+	if err == nil {
+		err = models.FirstFailure(decision.Rules)
+	}
+
+	if err == nil {
+		err = portfolio.Execute(transaction)
+	}
+
+	if err != nil {
+		return &ruleError{err}
+	}
+
+	return nil
+}
+
+// applySession labels a transaction with the trading session of its ticker's exchange at its time, after any
+// market override, and applies the session's slippage and fee. Transactions outside every session keep their price.
+// The price is then rounded to the ticker's tick size, so fills are the same whatever precision the quote had.
+func (bw *BotWorker) applySession(transaction *models.Transaction) {
+	exchange := bw.exchangeFor(transaction.Ticker)
+	precision := bw.markets.Precision(transaction.Ticker, exchange)
+
+	session, _ := bw.sessionAt(exchange, transaction.Time)
+	if session == nil {
+		transaction.Session = market.SessionClosed
+		transaction.UnitCost = precision.RoundPrice(transaction.UnitCost)
+		return
+	}
+
+	transaction.Session = session.Name
+	transaction.UnitCost = precision.RoundPrice(session.FillPrice(transaction.Action, transaction.UnitCost))
+	transaction.Fee = session.Fee(transaction.Value())
+}
+
+// marketHoursRule rejects trades outside every enabled session when the competition enforces market hours.
+// Trades while an administrator forced the market closed are rejected even if market hours are not enforced.
+func (bw *BotWorker) marketHoursRule(transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "market_hours", Passed: true}
+	override := bw.overrides.active(bw.exchangeFor(transaction.Ticker).Code, transaction.Time)
+	switch {
+	case override != nil && !override.Open:
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot trade %s while the market is closed: %s", transaction.Ticker, override.Reason)
+	case bw.marketHoursEnforced && transaction.Session == market.SessionClosed:
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot trade %s while the market is closed", transaction.Ticker)
+	}
+
+	return evaluation
+}
+
+// earningsBlackoutRule rejects trades within the bot's blackout window around an earnings release.
+// The rule only applies when the competition enables it and the bot has set a blackout window.
+func (bw *BotWorker) earningsBlackoutRule(portfolio *models.Portfolio, transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "earnings_blackout", Passed: true}
+	if !bw.earningsBlackoutEnabled || portfolio.EarningsBlackoutMinutes <= 0 {
+		return evaluation
+	}
+
+	event := bw.earnings.Nearest(transaction.Ticker, transaction.Time)
+	if event == nil {
+		return evaluation
+	}
+
+	window := time.Duration(portfolio.EarningsBlackoutMinutes) * time.Minute
+	if transaction.Time.After(event.ReportTime.Add(-window)) && transaction.Time.Before(event.ReportTime.Add(window)) {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot trade %s within %d minutes of its earnings release at %s",
+			transaction.Ticker, portfolio.EarningsBlackoutMinutes, event.ReportTime.Format(time.RFC3339))
+	}
+
+	return evaluation
+}
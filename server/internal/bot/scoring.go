@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// ScoringRequestData represents a request to replace the scoring rules of a competition
+type ScoringRequestData struct {
+	ScoringRules []models.ScoringRule `json:"scoringRules"` // Bonuses and penalties applied at settlement
+}
+
+// settleScores scores the bots of every competition that has started. Competitions that
+// ended are scored one last time at the first settlement after they end.
+func (bw *BotWorker) settleScores() error {
+	docs, err := bw.db.Collection(bw.collections.Competitions).Documents(context.Background()).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving competitions: %v", err)
+	}
+
+	now := time.Now()
+	errs := make([]error, 0)
+	for _, doc := range docs {
+		competition := &models.Competition{}
+		if doc.DataTo(competition) != nil || now.Before(competition.Starts) {
+			continue
+		}
+
+		scored, err := bw.scoreCompetition(doc.Ref, competition, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error scoring competition %s: %v", doc.Ref.ID, err))
+			continue
+		}
+
+		log.Printf("settlement scored %d bots of competition %s\n", scored, doc.Ref.ID)
+	}
+
+	return errors.Join(errs...)
+}
+
+// scoreCompetition calculates and stores the composite score of every bot in a competition.
+// Disqualified bots keep their last score. Bots that were already scored after the competition ended are skipped. Returns the number of scored bots.
+func (bw *BotWorker) scoreCompetition(ref *firestore.DocumentRef, competition *models.Competition, now time.Time) (int, error) {
+	docs, err := bw.db.Collection(bw.collections.Bots).Where("competition", "==", ref).Documents(context.Background()).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	scored := 0
+	for _, doc := range docs {
+		portfolio := &models.Portfolio{}
+		if doc.DataTo(portfolio) != nil || portfolio.Disqualified() {
+			continue
+		}
+
+		if !competition.Ends.IsZero() && portfolio.Score != nil && portfolio.Score.SettledAt.After(competition.Ends) {
+			continue
+		}
+
+		transactions, err := bw.loadTransactions(portfolio)
+		if err != nil {
+			return scored, err
+		}
+
+		metrics := models.CalculateScoreMetrics(portfolio, transactions, portfolio.AccountValue, now)
+		score := models.EvaluateScore(competition.ScoringRules, metrics, now)
+
+		_, err = doc.Ref.Update(context.Background(), []firestore.Update{{Path: "score", Value: score}})
+		if err != nil {
+			return scored, err
+		}
+
+		scored++
+	}
+
+	return scored, nil
+}
+
+// SetScoringRules replaces the scoring rules of a competition.
+// The new rules apply from the next settlement.
+// @Summary Set the scoring rules of a competition
+// @Description Replaces the bonuses and penalties applied to the composite score of every bot in the competition at settlement
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Competition ID"
+// @Param scoring body ScoringRequestData true "Scoring rules"
+// @Success 200 {object} ResultData "Scoring rules updated"
+// @Failure 400 {object} ResultData "Invalid scoring rules"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Router /admin/competitions/{id}/scoring [put]
+func (bw *BotWorker) SetScoringRules(c *gin.Context) {
+	request := &ScoringRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	if request.ScoringRules == nil {
+		request.ScoringRules = make([]models.ScoringRule, 0)
+	}
+
+	err = models.ValidateScoringRules(request.ScoringRules)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	ref := bw.db.Collection(bw.collections.Competitions).Doc(c.Param("id"))
+	_, err = ref.Update(context.Background(), []firestore.Update{{Path: "scoringRules", Value: request.ScoringRules}})
+	if err != nil {
+		log.Printf("error setting scoring rules of competition %s: %v\n", ref.ID, err)
+		c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+		return
+	}
+
+	c.JSON(200, NewResultPacket(fmt.Sprintf("%d scoring rules set", len(request.ScoringRules)), true))
+}
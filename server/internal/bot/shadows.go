@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// portfolioHeader selects a shadow portfolio for a request instead of the bot's main portfolio
+const portfolioHeader = "X-Portfolio"
+
+// defaultMaxShadows is the default number of shadow portfolios a bot may create
+const defaultMaxShadows = 5
+
+// ShadowRequestData represents a request to create a shadow portfolio
+type ShadowRequestData struct {
+	Name         string  `json:"name"`         // Display name of the shadow portfolio
+	StartingCash float64 `json:"startingCash"` // Starting cash, defaults to the main portfolio's account value
+}
+
+// ShadowInfo describes a shadow portfolio
+type ShadowInfo struct {
+	ID           string    `json:"id"`           // ID to pass in the X-Portfolio header
+	Name         string    `json:"name"`         // Display name
+	AccountValue float64   `json:"accountValue"` // Latest calculated account value
+	Cash         float64   `json:"cash"`         // Available cash
+	CreatedAt    time.Time `json:"createdAt"`    // When the shadow portfolio was created
+}
+
+// shadowInfo builds the description of a shadow portfolio document
+func shadowInfo(doc *firestore.DocumentSnapshot) (*ShadowInfo, error) {
+	portfolio := &models.Portfolio{}
+	err := doc.DataTo(portfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ShadowInfo{
+		ID:           doc.Ref.ID,
+		Name:         portfolio.ShadowName,
+		AccountValue: portfolio.AccountValue,
+		Cash:         portfolio.Cash,
+		CreatedAt:    doc.CreateTime,
+	}, nil
+}
+
+// ownerRef returns the database reference of the authenticated bot itself,
+// even when the request operates on one of its shadow portfolios
+func ownerRef(c *gin.Context) (*firestore.DocumentRef, bool) {
+	refUntyped, ok := c.Get("owner_ref")
+	if !ok {
+		return nil, false
+	}
+
+	ref, ok := refUntyped.(*firestore.DocumentRef)
+	return ref, ok
+}
+
+// ownerOf returns the bot that owns a portfolio reference, which is the reference itself
+// unless it points to a shadow portfolio. Shadow portfolios are the only portfolios stored
+// in a subcollection, so any portfolio with a parent document is a shadow.
+func ownerOf(ref *firestore.DocumentRef) *firestore.DocumentRef {
+	if ref.Parent != nil && ref.Parent.Parent != nil {
+		return ref.Parent.Parent
+	}
+
+	return ref
+}
+
+// loadShadowPortfolio swaps the portfolio in the context for the shadow portfolio
+// selected by the X-Portfolio header. Returns false if the request was aborted.
+func (bw *BotWorker) loadShadowPortfolio(c *gin.Context, bot *firestore.DocumentRef) bool {
+	shadowID := c.GetHeader(portfolioHeader)
+	if shadowID == "" {
+		return true
+	}
+
+	ref := bot.Collection(bw.collections.Shadows).Doc(shadowID)
+	portfolio, err := bw.store.LoadPortfolio(context.Background(), ref)
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket(fmt.Sprintf("error: shadow portfolio %s not found", shadowID), false))
+		return false
+	}
+
+	c.Set("db_ref", ref)
+	c.Set("bot", portfolio)
+	return true
+}
+
+// CreateShadow creates a shadow portfolio for the authenticated bot.
+// @Summary Create a shadow portfolio
+// @Description Creates a secondary portfolio with separate state that is used by sending its ID in the X-Portfolio header
+// @Tags shadows
+// @Accept json
+// @Produce json
+// @Param shadow body ShadowRequestData true "Shadow portfolio details"
+// @Success 200 {object} DataPacket "Created shadow portfolio"
+// @Failure 400 {object} ResultData "Invalid request or too many shadow portfolios"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /shadows [post]
+func (bw *BotWorker) CreateShadow(c *gin.Context) {
+	owner, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	request := &ShadowRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil || request.Name == "" || request.StartingCash < 0 {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: a name and a non-negative startingCash are required", false))
+		return
+	}
+
+	maxShadows := defaultMaxShadows
+	if env := getEnvDefault("MAX_SHADOW_PORTFOLIOS", ""); env != "" {
+		maxShadows, err = strconv.Atoi(env)
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error: invalid shadow portfolio limit", false))
+			return
+		}
+	}
+
+	existing, err := owner.Collection(bw.collections.Shadows).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve shadow portfolios", false))
+		return
+	}
+
+	if len(existing) >= maxShadows {
+		c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: a bot may have at most %d shadow portfolios", maxShadows), false))
+		return
+	}
+
+	main, err := bw.store.LoadPortfolio(context.Background(), owner)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve portfolio information", false))
+		return
+	}
+
+	// Default to the main portfolio's account value so variants start on equal footing
+	if request.StartingCash == 0 {
+		request.StartingCash = main.AccountValue
+	}
+
+	shadow := models.NewPortfolio(request.StartingCash)
+	shadow.AccountValue = request.StartingCash
+	shadow.HistoricalAccountValue = make([]*models.AccountValueHistory, 0)
+	shadow.InceptionValue = request.StartingCash
+	shadow.InceptionDate = time.Now()
+	shadow.Shadow = true
+	shadow.ShadowName = request.Name
+	shadow.Owner = owner
+	shadow.CostBasisMethod = main.CostBasis()
+	shadow.SchemaVersion = bw.migrator.Latest(bw.collections.Shadows)
+
+	ref, _, err := owner.Collection(bw.collections.Shadows).Add(context.Background(), shadow)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to create shadow portfolio", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"shadow", &ShadowInfo{
+		ID:           ref.ID,
+		Name:         request.Name,
+		AccountValue: shadow.AccountValue,
+		Cash:         shadow.Cash,
+		CreatedAt:    time.Now(),
+	}})
+}
+
+// GetShadows lists the shadow portfolios of the authenticated bot.
+// @Summary List shadow portfolios
+// @Description Retrieves every shadow portfolio of the authenticated bot
+// @Tags shadows
+// @Produce json
+// @Success 200 {object} DataPacket "Shadow portfolios"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /shadows [get]
+func (bw *BotWorker) GetShadows(c *gin.Context) {
+	owner, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	docs, err := owner.Collection(bw.collections.Shadows).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve shadow portfolios", false))
+		return
+	}
+
+	shadows := make([]*ShadowInfo, 0, len(docs))
+	for _, doc := range docs {
+		info, err := shadowInfo(doc)
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to parse shadow portfolio", false))
+			return
+		}
+
+		shadows = append(shadows, info)
+	}
+
+	c.JSON(200, &DataPacket{"shadows", shadows})
+}
+
+// DeleteShadow deletes a shadow portfolio of the authenticated bot.
+// Its transactions are kept for auditing.
+// @Summary Delete a shadow portfolio
+// @Description Deletes a shadow portfolio of the authenticated bot
+// @Tags shadows
+// @Produce json
+// @Param id path string true "Shadow portfolio ID"
+// @Success 200 {object} ResultData "Shadow portfolio deleted"
+// @Failure 404 {object} ResultData "Shadow portfolio not found"
+// @Router /shadows/{id} [delete]
+func (bw *BotWorker) DeleteShadow(c *gin.Context) {
+	owner, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	ref := owner.Collection(bw.collections.Shadows).Doc(c.Param("id"))
+	_, err := ref.Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: shadow portfolio not found", false))
+		return
+	}
+
+	_, err = ref.Delete(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to delete shadow portfolio", false))
+		return
+	}
+
+	c.JSON(200, NewResultPacket(fmt.Sprintf("deleted shadow portfolio %s", ref.ID), true))
+}
@@ -0,0 +1,289 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// SpectatorKeyRequestData represents an admin request to issue a spectator key
+type SpectatorKeyRequestData struct {
+	Name   string   `json:"name" binding:"required,max=200"` // Who the key is issued to, such as a mentor
+	Bot    string   `json:"bot" binding:"required"`          // ID of the bot the key may observe
+	Scopes []string `json:"scopes"`                          // "leaderboard", "market_data" and "portfolio", every scope if empty
+}
+
+// IssuedSpectatorKey is a newly issued spectator key with its secret, which is only returned once
+type IssuedSpectatorKey struct {
+	*models.SpectatorKey
+	APIKey string `json:"apiKey"` // Secret to send in the Authorization header
+}
+
+// SpectatorHolding is a holding of an observed bot
+type SpectatorHolding struct {
+	NumShares     float64 `json:"numShares"`     // Number of shares held
+	PurchaseValue float64 `json:"purchaseValue"` // Average purchase price per share
+	RealizedGain  float64 `json:"realizedGain"`  // Gain realized by selling shares of the ticker
+}
+
+// SpectatorPortfolio is the portfolio of a bot as shown to its spectators. It leaves out the
+// bot's settings, notification address, protection levels, purchase lots and transactions.
+type SpectatorPortfolio struct {
+	BotID                  string                        `json:"botId"`                  // ID of the bot
+	DisplayName            string                        `json:"displayName"`            // Public name, the bot ID if it has none
+	Currency               string                        `json:"currency"`               // Currency of the amounts
+	AccountValue           float64                       `json:"accountValue"`           // Latest calculated account value
+	Cash                   float64                       `json:"cash"`                   // Available cash
+	Return                 float64                       `json:"return"`                 // Return since inception
+	Holdings               map[string]*SpectatorHolding  `json:"holdings"`               // Holdings by ticker
+	ClosedPositions        []*models.ClosedPosition      `json:"closedPositions"`        // Positions sold completely, oldest first
+	HistoricalAccountValue []*models.AccountValueHistory `json:"historicalAccountValue"` // Daily account values
+	LastHeartbeat          time.Time                     `json:"lastHeartbeat"`          // When the bot last reported it is running
+	Disqualified           bool                          `json:"disqualified"`           // Whether the bot is disqualified
+}
+
+// newSpectatorPortfolio builds the sanitized view of a bot's portfolio
+func newSpectatorPortfolio(botID string, portfolio *models.Portfolio, now time.Time) *SpectatorPortfolio {
+	total, _ := portfolio.Returns(portfolio.AccountValue, now)
+	view := &SpectatorPortfolio{
+		BotID:                  botID,
+		DisplayName:            portfolio.Profile.PublicName(botID),
+		Currency:               portfolio.CurrencyOfRecord(),
+		AccountValue:           portfolio.AccountValue,
+		Cash:                   portfolio.Cash,
+		Return:                 total,
+		Holdings:               make(map[string]*SpectatorHolding, len(portfolio.Holdings)),
+		ClosedPositions:        portfolio.ClosedPositions,
+		HistoricalAccountValue: portfolio.HistoricalAccountValue,
+		LastHeartbeat:          portfolio.LastHeartbeat,
+		Disqualified:           portfolio.Disqualified(),
+	}
+
+	for ticker, holding := range portfolio.Holdings {
+		view.Holdings[ticker] = &SpectatorHolding{NumShares: holding.NumShares, PurchaseValue: holding.PurchaseValue, RealizedGain: holding.RealizedGain}
+	}
+
+	if view.ClosedPositions == nil {
+		view.ClosedPositions = make([]*models.ClosedPosition, 0)
+	}
+
+	if view.HistoricalAccountValue == nil {
+		view.HistoricalAccountValue = make([]*models.AccountValueHistory, 0)
+	}
+
+	return view
+}
+
+// SpectatorAuthHandler authenticates a request using a spectator key in the Authorization header
+// and sets the key in the context. Bot API keys are not accepted, and spectator keys are not accepted
+// by the bot routes, so spectators can never trade.
+func (bw *BotWorker) SpectatorAuthHandler(c *gin.Context) {
+	apikey := c.GetHeader("Authorization")
+	if apikey == "" {
+		c.AbortWithStatusJSON(401, NewResultPacket("error finding spectator key with specified api key", false))
+		return
+	}
+
+	doc, err := bw.db.Collection(bw.collections.SpectatorKeys).Where("apiKey", "==", apikey).Documents(context.Background()).Next()
+	if err != nil || doc == nil {
+		c.AbortWithStatusJSON(401, NewResultPacket("error finding spectator key with specified api key", false))
+		return
+	}
+
+	key := &models.SpectatorKey{}
+	if doc.DataTo(key) != nil || key.Bot == nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load spectator key", false))
+		return
+	}
+
+	key.ID = doc.Ref.ID
+	key.BotID = key.Bot.ID
+	c.Set("spectator", key)
+}
+
+// RequireScope returns middleware that rejects spectator keys without the scope
+func (bw *BotWorker) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := spectatorKey(c)
+		if !ok {
+			c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+			return
+		}
+
+		if !key.Allows(scope) {
+			c.AbortWithStatusJSON(403, NewResultPacket(fmt.Sprintf("error: the spectator key does not have the %s scope", scope), false))
+		}
+	}
+}
+
+// spectatorKey returns the spectator key set by SpectatorAuthHandler
+func spectatorKey(c *gin.Context) (*models.SpectatorKey, bool) {
+	keyUntyped, ok := c.Get("spectator")
+	if !ok {
+		return nil, false
+	}
+
+	key, ok := keyUntyped.(*models.SpectatorKey)
+	return key, ok
+}
+
+// GetSpectatorPortfolio returns the sanitized portfolio of the bot a spectator key observes.
+// @Summary Get the observed bot's portfolio
+// @Description Retrieves the account value, cash, holdings, closed positions and daily account values of the bot the spectator key was issued for. Settings, protection levels, purchase lots and transactions are left out
+// @Tags spectator
+// @Produce json
+// @Success 200 {object} DataPacket "Sanitized portfolio"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 403 {object} ResultData "The key does not have the portfolio scope"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /spectator/portfolio [get]
+func (bw *BotWorker) GetSpectatorPortfolio(c *gin.Context) {
+	key, ok := spectatorKey(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	doc, err := key.Bot.Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found", false))
+		return
+	}
+
+	portfolio := &models.Portfolio{}
+	if doc.DataTo(portfolio) != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load bot", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"spectator_portfolio", newSpectatorPortfolio(doc.Ref.ID, portfolio, time.Now())})
+}
+
+// CreateSpectatorKey issues a read-only spectator key for a bot.
+// @Summary Issue a spectator key
+// @Description Issues a read-only API key for a mentor or teacher observing a bot. The key can read leaderboards, market data and the bot's sanitized portfolio, as allowed by its scopes, and cannot trade. The secret is only returned in this response
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param key body SpectatorKeyRequestData true "Spectator key"
+// @Success 200 {object} DataPacket "Issued spectator key"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 404 {object} ResultData "Bot not found"
+// @Router /admin/spectator_keys [post]
+func (bw *BotWorker) CreateSpectatorKey(c *gin.Context) {
+	request := &SpectatorKeyRequestData{}
+	err := c.ShouldBindJSON(request)
+	if err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	key := &models.SpectatorKey{
+		Name:      request.Name,
+		Scopes:    request.Scopes,
+		CreatedAt: time.Now(),
+		APIKey:    newAPIKey(),
+		Bot:       bw.db.Collection(bw.collections.Bots).Doc(request.Bot),
+	}
+
+	err = key.Validate()
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	if _, err := key.Bot.Get(context.Background()); err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: bot not found", false))
+		return
+	}
+
+	ref, _, err := bw.db.Collection(bw.collections.SpectatorKeys).Add(context.Background(), key)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to save spectator key", false))
+		return
+	}
+
+	key.ID = ref.ID
+	key.BotID = key.Bot.ID
+
+	bw.audit(c, "spectator_key.create", fmt.Sprintf("issued spectator key %s to %q for bot %s", key.ID, key.Name, key.BotID), key)
+	c.JSON(200, &DataPacket{"spectator_key", &IssuedSpectatorKey{key, key.APIKey}})
+}
+
+// GetSpectatorKeys lists the issued spectator keys without their secrets.
+// @Summary List spectator keys
+// @Description Lists the issued spectator keys, oldest first, without their secrets
+// @Tags admin
+// @Produce json
+// @Param bot query string false "Only list the keys of this bot"
+// @Success 200 {object} DataPacket "Spectator keys"
+// @Router /admin/spectator_keys [get]
+func (bw *BotWorker) GetSpectatorKeys(c *gin.Context) {
+	query := bw.db.Collection(bw.collections.SpectatorKeys).Query
+	if bot := c.Query("bot"); bot != "" {
+		query = query.Where("bot", "==", bw.db.Collection(bw.collections.Bots).Doc(bot))
+	}
+
+	docs, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve spectator keys", false))
+		return
+	}
+
+	keys := make([]*models.SpectatorKey, 0, len(docs))
+	for _, doc := range docs {
+		key := &models.SpectatorKey{}
+		if doc.DataTo(key) != nil || key.Bot == nil {
+			continue
+		}
+
+		key.ID = doc.Ref.ID
+		key.BotID = key.Bot.ID
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(a, b int) bool {
+		return keys[a].CreatedAt.Before(keys[b].CreatedAt)
+	})
+
+	c.JSON(200, &DataPacket{"spectator_keys", keys})
+}
+
+// RevokeSpectatorKey deletes a spectator key, which stops it from authenticating right away.
+// @Summary Revoke a spectator key
+// @Description Deletes a spectator key so it can no longer be used
+// @Tags admin
+// @Produce json
+// @Param id path string true "Spectator key ID"
+// @Success 200 {object} ResultData "Spectator key revoked"
+// @Failure 404 {object} ResultData "Spectator key not found"
+// @Router /admin/spectator_keys/{id} [delete]
+func (bw *BotWorker) RevokeSpectatorKey(c *gin.Context) {
+	ref := bw.db.Collection(bw.collections.SpectatorKeys).Doc(c.Param("id"))
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: spectator key not found", false))
+		return
+	}
+
+	key := &models.SpectatorKey{}
+	doc.DataTo(key)
+	key.ID = ref.ID
+	if key.Bot != nil {
+		key.BotID = key.Bot.ID
+	}
+
+	_, err = ref.Delete(context.Background(), firestore.Exists)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to revoke spectator key", false))
+		return
+	}
+
+	bw.audit(c, "spectator_key.revoke", fmt.Sprintf("revoked spectator key %s of %q for bot %s", key.ID, key.Name, key.BotID), key)
+	c.JSON(200, NewResultPacket("spectator key revoked", true))
+}
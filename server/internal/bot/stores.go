@@ -0,0 +1,351 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+)
+
+// errBotNotFound is returned by PortfolioStore.FindBot when no bot has the API key
+var errBotNotFound = errors.New("no bot has the api key")
+
+// PriceSource provides the live prices the bot worker trades at. *services.PriceFeed implements it,
+// and tests can replace it with fixed prices.
+type PriceSource interface {
+	// Fetch fetches the latest price of each ticker and returns the name of the source that provided them
+	Fetch(tickers []string) (map[string]float64, string, error)
+
+	// Constrained checks whether the sources are short of quota, so only prioritized tickers are refreshed
+	Constrained() bool
+
+	// Monitor returns the monitor that records the health of the sources
+	Monitor() *services.SourceMonitor
+}
+
+// Watchlist keeps the watched tickers and provides the daily history that trades and valuations fall back on.
+// *services.Tiingo implements it, and tests can replace it with a fixed history.
+type Watchlist interface {
+	// AddTickers adds tickers to the watchlist, their history is downloaded by the next download
+	AddTickers(tickers ...string)
+
+	// Tickers returns the watched tickers in sorted order
+	Tickers() []string
+
+	// Daily returns the cached daily history of the watched tickers
+	Daily() *models.History
+
+	// Prioritize replaces the order in which tickers are downloaded and refreshed when the quota is constrained
+	Prioritize(priorities []*services.TickerPriority)
+
+	// Critical returns the tickers that are held or have open orders, which are still refreshed when the quota is constrained
+	Critical(tickers []string) []string
+}
+
+// StoredPortfolio is a portfolio and the document it is stored in
+type StoredPortfolio struct {
+	Ref       *firestore.DocumentRef // Bot or shadow portfolio document
+	Portfolio *models.Portfolio      // Portfolio as stored
+}
+
+// OrderFill is a fill of a conditional order, executed by the function passed to PortfolioStore.FillOrder
+type OrderFill struct {
+	Transaction *models.Transaction // The executed transaction
+	Group       *models.OrderGroup  // The order group after the fill
+	Event       *models.Event       // Event added to the outbox with the fill, nil if events are disabled
+}
+
+// PortfolioStore stores bot portfolios, the transactions and order decisions of their trades and their order groups.
+// NewPortfolioStore stores them in Firestore, and tests can keep them in memory. Document references only identify
+// portfolios, transactions and decisions, so in-memory stores can create them without a Firestore client.
+//
+// Only authentication, trades, order fills and valuations go through the store. Every other handler and job, such as
+// alerts, protections, competitions, archival and reconciliation, still uses the Firestore client directly and
+// cannot run against an in-memory store.
+type PortfolioStore interface {
+	// LoadPortfolio loads the portfolio of a bot or shadow portfolio document
+	LoadPortfolio(ctx context.Context, ref *firestore.DocumentRef) (*models.Portfolio, error)
+
+	// FindBot finds the bot with an API key. Returns errBotNotFound if no bot has the key.
+	FindBot(ctx context.Context, apiKey string) (*firestore.DocumentRef, *models.Portfolio, error)
+
+	// Portfolios loads every bot and shadow portfolio
+	Portfolios(ctx context.Context) ([]*StoredPortfolio, error)
+
+	// SaveValuation stores the account value, historical account values and pending tickers of a portfolio
+	SaveValuation(ctx context.Context, ref *firestore.DocumentRef, portfolio *models.Portfolio) error
+
+	// SaveTransaction atomically stores a transaction and the updated cash, holdings, closed positions, turnover and
+	// transaction references of the portfolio it executed against. Returns the reference of the stored transaction.
+	SaveTransaction(ctx context.Context, ref *firestore.DocumentRef, portfolio *models.Portfolio, transaction *models.Transaction) (*firestore.DocumentRef, error)
+
+	// FillOrder loads the portfolio at ref and calls fill with it and the reference the transaction will be stored at.
+	// The transaction is added to the portfolio's transaction references, and the transaction, the filled group, its
+	// event and the updated portfolio are stored atomically. Nothing is stored if fill returns an error, which is
+	// returned as is. Returns the reference of the stored transaction.
+	FillOrder(ctx context.Context, ref *firestore.DocumentRef, fill func(portfolio *models.Portfolio, transactionRef *firestore.DocumentRef) (*OrderFill, error)) (*firestore.DocumentRef, error)
+
+	// NewOrderDecision returns the reference a new order decision will be stored at
+	NewOrderDecision() *firestore.DocumentRef
+
+	// SaveOrderDecision stores an order decision
+	SaveOrderDecision(ctx context.Context, ref *firestore.DocumentRef, decision *models.OrderDecision) error
+
+	// ActiveOrderGroups loads every order group that can still fill
+	ActiveOrderGroups(ctx context.Context) ([]*models.OrderGroup, error)
+
+	// SaveOrderGroup stores the current state of an order group
+	SaveOrderGroup(ctx context.Context, group *models.OrderGroup) error
+}
+
+// firestoreStore stores portfolios and transactions in Firestore
+type firestoreStore struct {
+	db          *firestore.Client
+	collections Collections
+}
+
+// NewPortfolioStore creates a portfolio store backed by the given Firestore collections
+func NewPortfolioStore(db *firestore.Client, collections Collections) PortfolioStore {
+	return &firestoreStore{db: db, collections: collections}
+}
+
+// LoadPortfolio loads the portfolio of a bot or shadow portfolio document
+func (fs *firestoreStore) LoadPortfolio(ctx context.Context, ref *firestore.DocumentRef) (*models.Portfolio, error) {
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio := &models.Portfolio{}
+	err = doc.DataTo(portfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	return portfolio, nil
+}
+
+// FindBot queries the bot with an API key
+func (fs *firestoreStore) FindBot(ctx context.Context, apiKey string) (*firestore.DocumentRef, *models.Portfolio, error) {
+	doc, err := fs.db.Collection(fs.collections.Bots).Where("apiKey", "==", apiKey).Documents(ctx).Next()
+	if err == iterator.Done {
+		return nil, nil, errBotNotFound
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	portfolio := &models.Portfolio{}
+	err = doc.DataTo(portfolio)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc.Ref, portfolio, nil
+}
+
+// Portfolios reads the bots and the shadow portfolios, which live in a subcollection of their bot
+func (fs *firestoreStore) Portfolios(ctx context.Context) ([]*StoredPortfolio, error) {
+	docs, err := fs.db.Collection(fs.collections.Bots).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	shadows, err := fs.db.CollectionGroup(fs.collections.Shadows).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	portfolios := make([]*StoredPortfolio, 0, len(docs)+len(shadows))
+	for _, doc := range append(docs, shadows...) {
+		portfolio := &models.Portfolio{}
+		doc.DataTo(portfolio)
+		portfolios = append(portfolios, &StoredPortfolio{Ref: doc.Ref, Portfolio: portfolio})
+	}
+
+	return portfolios, nil
+}
+
+// SaveValuation updates the valuation fields of the portfolio document. Pending tickers are deleted once there are none.
+func (fs *firestoreStore) SaveValuation(ctx context.Context, ref *firestore.DocumentRef, portfolio *models.Portfolio) error {
+	var pending any = firestore.Delete
+	if len(portfolio.PendingTickers) > 0 {
+		pending = portfolio.PendingTickers
+	}
+
+	_, err := ref.Update(ctx, []firestore.Update{
+		{Path: "accountValue", Value: portfolio.AccountValue},
+		{Path: "historicalAccountValue", Value: portfolio.HistoricalAccountValue},
+		{Path: "pendingTickers", Value: pending},
+	})
+	return err
+}
+
+// SaveTransaction creates the transaction document and updates the portfolio in one Firestore transaction
+func (fs *firestoreStore) SaveTransaction(ctx context.Context, ref *firestore.DocumentRef, portfolio *models.Portfolio, transaction *models.Transaction) (*firestore.DocumentRef, error) {
+	doc := fs.db.Collection(fs.collections.Transactions).NewDoc()
+	references := append(portfolio.TransactionReferences, doc)
+
+	err := fs.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		err := tx.Create(doc, transaction)
+		if err != nil {
+			return err
+		}
+
+		return tx.Update(ref, portfolioUpdates(portfolio, references))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// FillOrder reads the portfolio and writes the fill in one Firestore transaction, so a fill can never be repeated after a restart
+func (fs *firestoreStore) FillOrder(ctx context.Context, ref *firestore.DocumentRef, fill func(portfolio *models.Portfolio, transactionRef *firestore.DocumentRef) (*OrderFill, error)) (*firestore.DocumentRef, error) {
+	transactionRef := fs.db.Collection(fs.collections.Transactions).NewDoc()
+
+	err := fs.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		portfolio := &models.Portfolio{}
+		err = doc.DataTo(portfolio)
+		if err != nil {
+			return err
+		}
+
+		filled, err := fill(portfolio, transactionRef)
+		if err != nil {
+			return err
+		}
+
+		portfolio.TransactionReferences = append(portfolio.TransactionReferences, transactionRef)
+
+		err = tx.Create(transactionRef, filled.Transaction)
+		if err != nil {
+			return err
+		}
+
+		// The event is added to the outbox atomically with the fill, so it is published even after a restart
+		if filled.Event != nil {
+			entry, err := newOutboxEntry(filled.Event)
+			if err != nil {
+				return err
+			}
+
+			err = tx.Set(fs.db.Collection(fs.collections.EventOutbox).Doc(filled.Event.ID), entry)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Set(fs.db.Collection(fs.collections.OrderGroups).Doc(filled.Group.ID), filled.Group)
+		if err != nil {
+			return err
+		}
+
+		return tx.Update(ref, portfolioUpdates(portfolio, portfolio.TransactionReferences))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transactionRef, nil
+}
+
+// portfolioUpdates returns the updates that store the state a transaction changes in a portfolio
+func portfolioUpdates(portfolio *models.Portfolio, references []*firestore.DocumentRef) []firestore.Update {
+	return []firestore.Update{
+		{Path: "cash", Value: portfolio.Cash},
+		{Path: "holdings", Value: portfolio.Holdings},
+		{Path: "closedPositions", Value: portfolio.ClosedPositions},
+		{Path: "turnover", Value: portfolio.Turnover},
+		{Path: "transactions", Value: references},
+	}
+}
+
+// NewOrderDecision returns a new document of the order decisions collection
+func (fs *firestoreStore) NewOrderDecision() *firestore.DocumentRef {
+	return fs.db.Collection(fs.collections.OrderDecisions).NewDoc()
+}
+
+// SaveOrderDecision writes an order decision to its document
+func (fs *firestoreStore) SaveOrderDecision(ctx context.Context, ref *firestore.DocumentRef, decision *models.OrderDecision) error {
+	_, err := ref.Set(ctx, decision)
+	return err
+}
+
+// ActiveOrderGroups queries the order groups with an active status
+func (fs *firestoreStore) ActiveOrderGroups(ctx context.Context) ([]*models.OrderGroup, error) {
+	docs, err := fs.db.Collection(fs.collections.OrderGroups).Where("status", "==", models.OrderGroupActive).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*models.OrderGroup, 0, len(docs))
+	for _, doc := range docs {
+		group := &models.OrderGroup{}
+		err = doc.DataTo(group)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load order group %s: %v", doc.Ref.ID, err)
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// SaveOrderGroup writes an order group to the document named after its ID
+func (fs *firestoreStore) SaveOrderGroup(ctx context.Context, group *models.OrderGroup) error {
+	_, err := fs.db.Collection(fs.collections.OrderGroups).Doc(group.ID).Set(ctx, group)
+	return err
+}
+
+// OrderBook holds the conditional order groups of every bot and indexes their open orders by trigger price.
+// Except for OpenTickers, the caller must hold the book's lock. NewOrderBook keeps the book in memory.
+type OrderBook interface {
+	sync.Locker
+
+	// Add adds a new group and indexes its open orders
+	Add(group *models.OrderGroup)
+
+	// Reindex brings the index in line with the status of a group's orders after it changed
+	Reindex(group *models.OrderGroup)
+
+	// RemoveBot removes every group of a bot along with its open and queued orders
+	RemoveBot(botID string)
+
+	// Group returns a group by ID
+	Group(id string) (*models.OrderGroup, bool)
+
+	// BotGroups returns the groups placed by a bot, newest first
+	BotGroups(botID string) []*models.OrderGroup
+
+	// ActiveGroups returns every group that can still fill
+	ActiveGroups() []*models.OrderGroup
+
+	// Tickers returns every ticker that has open orders
+	Tickers() []string
+
+	// Crossable returns the open orders of a ticker that the given price triggers, oldest order first
+	Crossable(ticker string, price float64) []*BookEntry
+
+	// QueuedTickers returns every ticker that has orders queued for the open
+	QueuedTickers() []string
+
+	// Queued returns the orders of a ticker queued for the open, oldest first
+	Queued(ticker string) []*BookEntry
+
+	// OpenTickers returns the number of open or queued orders of every ticker that has any. It acquires the lock itself.
+	OpenTickers() map[string]int
+}
@@ -0,0 +1,201 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/olahol/melody"
+)
+
+// Encodings of the WebSocket stream. JSON packets are sent as text frames and MessagePack packets as binary frames.
+const (
+	streamEncodingJSON    = "json"
+	streamEncodingMsgPack = "msgpack"
+)
+
+// streamEncodings lists every stream encoding, which are also the accepted WebSocket subprotocols
+var streamEncodings = []string{streamEncodingJSON, streamEncodingMsgPack}
+
+// PriceTickData is the payload of the price_tick stream event
+type PriceTickData struct {
+	Time   time.Time          `json:"time"`   // When the prices were fetched
+	Source string             `json:"source"` // Data source that provided the prices
+	Prices map[string]float64 `json:"prices"` // Latest price of every watched ticker
+}
+
+// newStream creates the WebSocket hub used to push events to bots
+func newStream() *melody.Melody {
+	stream := melody.New()
+
+	stream.HandleError(func(s *melody.Session, err error) {
+		log.Printf("websocket error for bot %v: %v\n", s.Keys["bot"], err)
+	})
+
+	return stream
+}
+
+// negotiateStreamEncoding picks the encoding of a stream request from the encoding query parameter or,
+// without it, from the first supported subprotocol the client offers in Sec-WebSocket-Protocol, or from
+// the Accept header. It also returns the subprotocol to accept, empty if the client offered none.
+// Streams default to JSON.
+func negotiateStreamEncoding(c *gin.Context) (encoding, subprotocol string, err error) {
+	r := c.Request
+	offered := make([]string, 0)
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				offered = append(offered, protocol)
+			}
+		}
+	}
+
+	if encoding = r.URL.Query().Get("encoding"); encoding != "" {
+		if !slices.Contains(streamEncodings, encoding) {
+			return "", "", fmt.Errorf("encoding must be one of %s", strings.Join(streamEncodings, ", "))
+		}
+
+		// Clients that offer subprotocols fail the handshake unless one of them is accepted
+		if len(offered) > 0 && !slices.Contains(offered, encoding) {
+			return "", "", fmt.Errorf("the encoding %s is not one of the offered subprotocols", encoding)
+		}
+
+		if len(offered) > 0 {
+			subprotocol = encoding
+		}
+
+		return encoding, subprotocol, nil
+	}
+
+	for _, protocol := range offered {
+		if slices.Contains(streamEncodings, protocol) {
+			return protocol, protocol, nil
+		}
+	}
+
+	// Stream packets have no protobuf schema, so only MessagePack is negotiated from the Accept header
+	if negotiateFormat(c, false) == binding.MIMEMSGPACK2 {
+		return streamEncodingMsgPack, "", nil
+	}
+
+	return streamEncodingJSON, "", nil
+}
+
+// sessionEncoding returns the encoding a stream session negotiated
+func sessionEncoding(s *melody.Session) string {
+	encoding, _ := s.Get("encoding")
+	if encoding, ok := encoding.(string); ok {
+		return encoding
+	}
+
+	return streamEncodingJSON
+}
+
+// send sends a data packet to every WebSocket session the filter accepts, in the encoding each session
+// negotiated. The packet is only encoded once per encoding, and only if a session uses that encoding.
+func (bw *BotWorker) send(packet *DataPacket, filter func(s *melody.Session) bool) error {
+	sessions, err := bw.stream.Sessions()
+	if err != nil {
+		return err
+	}
+
+	var text, binary []byte
+	errs := make([]error, 0)
+	for _, s := range sessions {
+		if !filter(s) {
+			continue
+		}
+
+		if sessionEncoding(s) == streamEncodingMsgPack {
+			if binary == nil {
+				binary = packet.MsgPack()
+			}
+
+			err = s.WriteBinary(binary)
+		} else {
+			if text == nil {
+				text = packet.JSON()
+			}
+
+			err = s.Write(text)
+		}
+
+		// Sessions that closed since they were listed are skipped
+		if err != nil && !s.IsClosed() {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// publish sends a data packet to every WebSocket session of a bot
+func (bw *BotWorker) publish(botID string, packet *DataPacket) {
+	err := bw.send(packet, func(s *melody.Session) bool {
+		id, ok := s.Get("bot")
+		return ok && id == botID
+	})
+	if err != nil {
+		log.Printf("error publishing %s to bot %s: %v\n", packet.Type, botID, err)
+	}
+}
+
+// broadcast sends a data packet to every WebSocket session of every bot
+func (bw *BotWorker) broadcast(packet *DataPacket) {
+	err := bw.send(packet, func(s *melody.Session) bool {
+		return true
+	})
+	if err != nil {
+		log.Printf("error broadcasting %s: %v\n", packet.Type, err)
+	}
+}
+
+// publishPrices sends the latest prices to every WebSocket session that subscribed to price ticks
+func (bw *BotWorker) publishPrices() {
+	err := bw.send(&DataPacket{"price_tick", &PriceTickData{Time: bw.pricesTime, Source: bw.priceSource, Prices: bw.latestPrices}}, func(s *melody.Session) bool {
+		prices, _ := s.Get("prices")
+		return prices == true
+	})
+	if err != nil {
+		log.Printf("error publishing price tick: %v\n", err)
+	}
+}
+
+// Stream upgrades the request to a WebSocket that receives events for the authenticated bot.
+// @Summary Subscribe to bot events
+// @Description Opens a WebSocket that receives order and account events for the authenticated bot. Packets are JSON text frames unless MessagePack binary frames are negotiated with the encoding query parameter, the msgpack subprotocol or the Accept header
+// @Tags stream
+// @Param encoding query string false "json (default) or msgpack"
+// @Param prices query bool false "Also receive a price_tick event after every price update"
+// @Success 101 "Switching protocols"
+// @Failure 400 {object} ResultData "Unsupported encoding"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /ws [get]
+func (bw *BotWorker) Stream(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	encoding, subprotocol, err := negotiateStreamEncoding(c)
+	if err != nil {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+		return
+	}
+
+	// The upgrader accepts the subprotocol set in the response headers
+	if subprotocol != "" {
+		c.Header("Sec-WebSocket-Protocol", subprotocol)
+	}
+
+	keys := map[string]any{"bot": ref.ID, "connected": time.Now(), "encoding": encoding, "prices": c.Query("prices") == "true"}
+	err = bw.stream.HandleRequestWithKeys(c.Writer, c.Request, keys)
+	if err != nil {
+		log.Printf("error opening websocket for bot %s: %v\n", ref.ID, err)
+	}
+}
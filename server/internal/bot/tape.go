@@ -0,0 +1,291 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// tapePageSize is the number of transactions read from Firestore per page of the trade tape
+const tapePageSize = 500
+
+// tapeFilterSize is the number of portfolios a query of the trade tape filters on, the most a Firestore in filter takes
+const tapeFilterSize = 30
+
+// TapeLine is a line of the trade tape, either a transaction or the end of the stream
+type TapeLine struct {
+	Type        string              `json:"type"`                  // "transaction" or "end"
+	ID          string              `json:"id,omitempty"`          // ID of the transaction document
+	BotID       string              `json:"botId,omitempty"`       // ID of the bot, the owning bot for shadow portfolios
+	ShadowID    string              `json:"shadowId,omitempty"`    // ID of the shadow portfolio that traded, empty for the bot itself
+	Transaction *models.Transaction `json:"transaction,omitempty"` // The transaction
+	Cursor      string              `json:"cursor"`                // Cursor to resume the stream after this line
+	Count       int                 `json:"count,omitempty"`       // Number of transactions streamed, only on the end line
+	Complete    bool                `json:"complete,omitempty"`    // Whether the range was streamed completely, only on the end line
+}
+
+// competitionBots returns the IDs of the bots that joined a competition and the competition's trading period
+func (bw *BotWorker) competitionBots(competitionID string) (map[string]bool, *models.Competition, error) {
+	competitionDoc, err := bw.db.Collection(bw.collections.Competitions).Doc(competitionID).Get(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	competition := &models.Competition{}
+	err = competitionDoc.DataTo(competition)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refs, err := bw.db.Collection(bw.collections.Bots).Where("competition", "==", competitionDoc.Ref).Select().Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bots := make(map[string]bool, len(refs))
+	for _, doc := range refs {
+		bots[doc.Ref.ID] = true
+	}
+
+	return bots, competition, nil
+}
+
+// competitionPortfolios returns the documents of the bots of a competition and of their shadow portfolios, which are
+// the portfolios whose transactions belong to the competition
+func (bw *BotWorker) competitionPortfolios(bots map[string]bool) ([]*firestore.DocumentRef, error) {
+	refs := make([]*firestore.DocumentRef, 0, len(bots))
+	for id := range bots {
+		refs = append(refs, bw.db.Collection(bw.collections.Bots).Doc(id))
+	}
+
+	shadows, err := bw.db.CollectionGroup(bw.collections.Shadows).Select().Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doc := range shadows {
+		if bots[ownerOf(doc.Ref).ID] {
+			refs = append(refs, doc.Ref)
+		}
+	}
+
+	return refs, nil
+}
+
+// tapeStream reads the transactions of one query of the trade tape in pages of tapePageSize, ordered by time and then
+// by ID
+type tapeStream struct {
+	query firestore.Query
+	start time.Time   // First time of the range, zero for no lower bound
+	after *pageCursor // Position of the last document read
+	lines []*TapeLine // Lines read but not streamed yet
+	done  bool        // Whether the last page was read
+}
+
+// peek returns the next line of the stream without removing it, reading the next page if the lines read so far were
+// streamed. Returns nil once every line was streamed.
+func (ts *tapeStream) peek(ctx context.Context) (*TapeLine, error) {
+	for len(ts.lines) == 0 && !ts.done {
+		page := ts.query
+		switch {
+		case ts.after.id != "":
+			page = page.StartAfter(ts.after.time(), ts.after.id)
+		case !ts.start.IsZero():
+			page = page.StartAt(ts.start)
+		}
+
+		docs, err := page.Limit(tapePageSize).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+
+		ts.done = len(docs) < tapePageSize
+		for _, doc := range docs {
+			if cursor := docCursor(doc, "time"); cursor != nil {
+				ts.after = cursor
+			}
+
+			transaction := &models.Transaction{}
+			if doc.DataTo(transaction) != nil || transaction.Bot == nil {
+				continue
+			}
+
+			owner := ownerOf(transaction.Bot)
+			line := &TapeLine{Type: "transaction", ID: doc.Ref.ID, BotID: owner.ID, Transaction: transaction}
+			if owner != transaction.Bot {
+				line.ShadowID = transaction.Bot.ID
+			}
+
+			ts.lines = append(ts.lines, line)
+		}
+	}
+
+	if len(ts.lines) == 0 {
+		return nil, nil
+	}
+
+	return ts.lines[0], nil
+}
+
+// tapeLineBefore checks whether a transaction line comes before another on the tape
+func tapeLineBefore(a, b *TapeLine) bool {
+	if !a.Transaction.Time.Equal(b.Transaction.Time) {
+		return a.Transaction.Time.Before(b.Transaction.Time)
+	}
+
+	return a.ID < b.ID
+}
+
+// StreamTransactions streams the trade tape of a date range as newline delimited JSON.
+// @Summary Stream the trade tape
+// @Description Streams every transaction in a date range, optionally of a single competition's bots and their shadow portfolios, as newline delimited JSON ordered by time. The transactions of a competition are filtered by Firestore, in queries of 30 portfolios whose results are merged. Every line carries a cursor, so an interrupted stream can be resumed after the last line received. The stream ends with a line of type "end" that reports whether the range was streamed completely
+// @Tags admin
+// @Produce application/x-ndjson
+// @Param competition query string false "Only stream the transactions of this competition's bots, its trading period is the default range"
+// @Param start query string false "First day of the range, formatted as YYYY-MM-DD"
+// @Param end query string false "Last day of the range, formatted as YYYY-MM-DD"
+// @Param cursor query string false "Resume after the line with this cursor"
+// @Param limit query int false "Stop after this many transactions, 0 for no limit"
+// @Success 200 {file} file "Newline delimited transactions"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Competition not found"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /admin/transactions/stream [get]
+func (bw *BotWorker) StreamTransactions(c *gin.Context) {
+	var start, end time.Time
+	var bots map[string]bool
+	if competitionID := c.Query("competition"); competitionID != "" {
+		var competition *models.Competition
+		var err error
+		bots, competition, err = bw.competitionBots(competitionID)
+		if err != nil {
+			c.AbortWithStatusJSON(404, NewResultPacket("error: competition not found", false))
+			return
+		}
+
+		start, end = competition.Starts, competition.Ends
+	}
+
+	if query := c.Query("start"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: start must be a date formatted as YYYY-MM-DD", false))
+			return
+		}
+
+		start = parsed
+	}
+
+	if query := c.Query("end"); query != "" {
+		parsed, err := time.Parse(time.DateOnly, query)
+		if err != nil || parsed.Before(start.Truncate(24*time.Hour)) {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: end must be a date formatted as YYYY-MM-DD on or after start", false))
+			return
+		}
+
+		// The end day is included
+		end = parsed.AddDate(0, 0, 1)
+	}
+
+	limit := 0
+	if query := c.Query("limit"); query != "" {
+		parsed, err := strconv.Atoi(query)
+		if err != nil || parsed < 0 {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: limit must be a non-negative number", false))
+			return
+		}
+
+		limit = parsed
+	}
+
+	position := timeCursor(start, "")
+	if query := c.Query("cursor"); query != "" {
+		parsed, err := parsePageCursor(query)
+		if err != nil {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: "+err.Error(), false))
+			return
+		}
+
+		position = parsed
+	}
+
+	query := bw.db.Collection(bw.collections.Transactions).Query
+	if !end.IsZero() {
+		query = query.Where("time", "<", end)
+	}
+
+	query = query.OrderBy("time", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc)
+
+	// A competition's transactions are read with one query per batch of its portfolios, so Firestore only returns the
+	// transactions of the competition, and the queries are merged by time
+	streams := []*tapeStream{{query: query, start: start, after: position}}
+	if bots != nil {
+		refs, err := bw.competitionPortfolios(bots)
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve the portfolios of the competition", false))
+			return
+		}
+
+		streams = make([]*tapeStream, 0, len(refs)/tapeFilterSize+1)
+		for batch := range slices.Chunk(refs, tapeFilterSize) {
+			streams = append(streams, &tapeStream{query: query.Where("bot", "in", batch), start: start, after: position})
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(200)
+
+	encoder := json.NewEncoder(c.Writer)
+	ctx := c.Request.Context()
+	count := 0
+	complete := false
+
+	for limit == 0 || count < limit {
+		var next *tapeStream
+		for _, stream := range streams {
+			line, err := stream.peek(ctx)
+			if err != nil {
+				log.Printf("error streaming transactions: %v\n", err)
+				return
+			}
+
+			if line != nil && (next == nil || tapeLineBefore(line, next.lines[0])) {
+				next = stream
+			}
+		}
+
+		if next == nil {
+			complete = true
+			break
+		}
+
+		line := next.lines[0]
+		next.lines = next.lines[1:]
+		position = timeCursor(line.Transaction.Time, line.ID)
+		line.Cursor = position.encode()
+
+		err := encoder.Encode(line)
+		if err != nil {
+			// The client went away, it can resume with the last cursor it received
+			return
+		}
+
+		count++
+		if count%tapePageSize == 0 {
+			c.Writer.Flush()
+		}
+	}
+
+	err := encoder.Encode(&TapeLine{Type: "end", Cursor: position.encode(), Count: count, Complete: complete})
+	if err != nil {
+		log.Printf("error ending transaction stream: %v\n", err)
+	}
+}
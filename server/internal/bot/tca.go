@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// GetTCA analyzes what executing the portfolio's trades cost.
+// @Summary Get transaction cost analysis
+// @Description Summarizes the fees paid, the estimated slippage against the daily VWAP and the holding periods of the portfolio's trades, in total and per ticker. The daily VWAP is estimated from the cached daily bar as (high + low + close) / 3, so trades of days that are not cached yet, such as today, have no slippage estimate. Holding periods match sales to purchases first in, first out
+// @Tags portfolio
+// @Produce json
+// @Success 200 {object} DataPacket "Transaction cost analysis"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /portfolio/tca [get]
+func (bw *BotWorker) GetTCA(c *gin.Context) {
+	portfolio, _, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	transactions, err := bw.loadTransactions(portfolio)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
+
+	history := bw.watchlist.Daily()
+	bar := func(ticker string, day time.Time) (*models.TickerPeriod, bool) {
+		start := day.UTC().Truncate(24 * time.Hour)
+		for _, row := range history.Range(start, start.Add(24*time.Hour-time.Nanosecond)) {
+			if period, ok := row.Data.Load(ticker); ok {
+				return period, true
+			}
+		}
+
+		return nil, false
+	}
+
+	analysis := models.AnalyzeTransactionCosts(transactions, bar, portfolio.CurrencyOfRecord(), time.Now().UTC())
+	c.JSON(200, &DataPacket{"tca", analysis})
+}
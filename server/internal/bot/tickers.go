@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Ticker onboarding states
+const (
+	TickerQueued      = "queued"                 // Waiting for another download to finish
+	TickerDownloading = "downloading"            // Downloading the full price history
+	TickerCalculating = "calculating_indicators" // Calculating indicators on the downloaded history
+	TickerReady       = "ready"                  // History and indicators are available
+	TickerFailed      = "failed"                 // The download failed, see Error
+	TickerUnknown     = "unknown"                // The ticker was never added
+)
+
+// TickerStatus reports the onboarding progress of a ticker
+type TickerStatus struct {
+	Ticker    string    `json:"ticker"`    // Ticker symbol
+	JobID     string    `json:"jobId"`     // ID of the job that last onboarded the ticker, empty if it was already cached
+	State     string    `json:"state"`     // Onboarding state
+	Error     string    `json:"error"`     // Reason the download failed, empty otherwise
+	Bars      int       `json:"bars"`      // Daily bars received so far, updated while the history downloads
+	UpdatedAt time.Time `json:"updatedAt"` // When the state last changed
+}
+
+// TickerJob is the response to an add ticker request
+type TickerJob struct {
+	JobID   string          `json:"jobId"`   // ID of the started job, empty if no ticker needed downloading
+	Tickers []*TickerStatus `json:"tickers"` // Status of every requested ticker
+}
+
+// tickerTracker tracks background ticker downloads.
+// Downloads run one at a time because the daily cache does not support concurrent inserts.
+type tickerTracker struct {
+	mu         sync.Mutex
+	downloadMu sync.Mutex
+	statuses   map[string]*TickerStatus
+}
+
+// newTickerTracker creates an empty ticker tracker
+func newTickerTracker() *tickerTracker {
+	return &tickerTracker{statuses: make(map[string]*TickerStatus)}
+}
+
+// setState updates the state of a ticker
+func (tt *tickerTracker) setState(ticker, state string, err error) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	status := tt.statuses[ticker]
+	status.State = state
+	status.UpdatedAt = time.Now()
+	if err != nil {
+		status.Error = err.Error()
+	}
+}
+
+// setBars records the daily bars received so far by the download of a ticker. Tickers without a status,
+// such as those of the daily download, are not tracked.
+func (tt *tickerTracker) setBars(ticker string, bars int) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if status, ok := tt.statuses[ticker]; ok {
+		status.Bars = bars
+		status.UpdatedAt = time.Now()
+	}
+}
+
+// status returns a copy of the status of a ticker, or nil if it is unknown
+func (tt *tickerTracker) status(ticker string) *TickerStatus {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	status, ok := tt.statuses[ticker]
+	if !ok {
+		return nil
+	}
+
+	copied := *status
+	return &copied
+}
+
+// pending checks whether a status belongs to a download that has not finished. The caller must hold mu.
+func pending(status *TickerStatus) bool {
+	return status.State != TickerReady && status.State != TickerFailed
+}
+
+// startTickerJob adds tickers to the watchlist and downloads the ones that are not cached in the background.
+// Tickers that are already cached or being downloaded are not downloaded again.
+func (bw *BotWorker) startTickerJob(tickers ...string) *TickerJob {
+	job := &TickerJob{Tickers: make([]*TickerStatus, 0, len(tickers))}
+	download := make([]string, 0, len(tickers))
+	id := newID()
+
+	bw.tickers.mu.Lock()
+	for _, ticker := range tickers {
+		ticker = symbols.Canonical(ticker)
+
+		status, ok := bw.tickers.statuses[ticker]
+		switch {
+		case ok && pending(status):
+		case bw.tiingo.Cached(ticker):
+			if !ok {
+				status = &TickerStatus{Ticker: ticker, State: TickerReady, UpdatedAt: time.Now()}
+				bw.tickers.statuses[ticker] = status
+			}
+		default:
+			status = &TickerStatus{Ticker: ticker, JobID: id, State: TickerQueued, UpdatedAt: time.Now()}
+			bw.tickers.statuses[ticker] = status
+			download = append(download, ticker)
+		}
+
+		copied := *status
+		job.Tickers = append(job.Tickers, &copied)
+	}
+	bw.tickers.mu.Unlock()
+
+	bw.watchlist.AddTickers(tickers...)
+	if len(download) == 0 {
+		return job
+	}
+
+	job.JobID = id
+	go bw.downloadTickers(download)
+
+	return job
+}
+
+// downloadTickers downloads the history and calculates the indicators of new tickers
+func (bw *BotWorker) downloadTickers(tickers []string) {
+	for _, ticker := range tickers {
+		bw.tickers.downloadMu.Lock()
+
+		bw.tickers.setState(ticker, TickerDownloading, nil)
+		err := bw.tiingo.HistoricalDaily(ticker)
+		if err != nil {
+			log.Printf("error downloading %s: %v\n", ticker, err)
+			bw.tickers.setState(ticker, TickerFailed, err)
+			bw.tickers.downloadMu.Unlock()
+			continue
+		}
+
+		bw.tickers.setState(ticker, TickerCalculating, nil)
+		bw.tiingo.CalculateTickerIndicators(ticker)
+
+		err = bw.tiingo.SaveCaches()
+		if err != nil {
+			log.Printf("error saving caches after downloading %s: %v\n", ticker, err)
+		}
+
+		bw.tickers.setState(ticker, TickerReady, nil)
+		bw.tickers.downloadMu.Unlock()
+
+		bw.resolveListing(ticker)
+	}
+
+	bw.updateCurrPrices()
+}
+
+// updateTickerPriorities ranks tickers for downloads and price refreshes under quota pressure.
+// Held tickers come first, weighted by the total value held across portfolios, followed by
+// tickers with open orders, weighted by their number of orders.
+func (bw *BotWorker) updateTickerPriorities(portfolios []*models.Portfolio) {
+	priorities := make(map[string]*services.TickerPriority)
+
+	for ticker, count := range bw.orders.OpenTickers() {
+		priorities[ticker] = &services.TickerPriority{Ticker: ticker, Tier: services.TierOrdered, Weight: float64(count)}
+	}
+
+	held := make(map[string]float64)
+	for _, portfolio := range portfolios {
+		for ticker, holding := range portfolio.Holdings {
+			// Tickers without a price yet are weighted by their shares
+			if price, ok := bw.latestPrices[ticker]; ok {
+				held[ticker] += holding.NumShares * price
+			} else {
+				held[ticker] += holding.NumShares
+			}
+		}
+	}
+
+	for ticker, value := range held {
+		priorities[ticker] = &services.TickerPriority{Ticker: ticker, Tier: services.TierHeld, Weight: value}
+	}
+
+	ranked := make([]*services.TickerPriority, 0, len(priorities))
+	for _, priority := range priorities {
+		ranked = append(ranked, priority)
+	}
+
+	bw.watchlist.Prioritize(ranked)
+}
+
+// GetTickerStatus returns the onboarding progress of tickers.
+// @Summary Get ticker status
+// @Description Reports whether the history of each ticker is queued, downloading, calculating indicators, ready or failed
+// @Tags stocks
+// @Produce json
+// @Param ticker query []string true "Ticker symbols (can specify multiple)"
+// @Success 200 {object} DataPacket "Ticker statuses"
+// @Failure 400 {object} ResultData "Invalid request"
+// @Router /ticker_status [get]
+func (bw *BotWorker) GetTickerStatus(c *gin.Context) {
+	tickers, ok := c.GetQueryArray("ticker")
+	if !ok {
+		c.AbortWithStatusJSON(400, NewResultPacket("error parsing ticker query", false))
+		return
+	}
+
+	statuses := make([]*TickerStatus, 0, len(tickers))
+	for _, ticker := range tickers {
+		ticker = symbols.Canonical(ticker)
+
+		status := bw.tickers.status(ticker)
+		if status == nil {
+			status = &TickerStatus{Ticker: ticker, State: TickerUnknown}
+			if bw.tiingo.Cached(ticker) {
+				status.State = TickerReady
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(200, &DataPacket{"ticker_status", statuses})
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// tradeLockTimeout is how long a trade waits for the earlier trades of the same bot
+const tradeLockTimeout = 10 * time.Second
+
+// errTradeInProgress is returned when an order cannot fill because another trade of its bot is running
+var errTradeInProgress = errors.New("another trade of the bot is in progress")
+
+// tradeLocks serializes the trades of each bot, so two trades of a bot can never execute against the
+// same portfolio state. Trades of different bots do not share a lock and run in parallel.
+type tradeLocks struct {
+	mu    sync.Mutex
+	locks map[string]*tradeLock
+}
+
+// tradeLock is the lock of a single bot, removed once no trade holds or waits for it
+type tradeLock struct {
+	held  chan struct{}
+	users int
+}
+
+// newTradeLocks creates trade locks without any held lock
+func newTradeLocks() *tradeLocks {
+	return &tradeLocks{locks: make(map[string]*tradeLock)}
+}
+
+// lock waits until no other trade of the bot is running and returns the function that releases the lock.
+// Returns the context's error if it is done before the lock is acquired.
+func (tl *tradeLocks) lock(ctx context.Context, botID string) (func(), error) {
+	tl.mu.Lock()
+	lock, ok := tl.locks[botID]
+	if !ok {
+		lock = &tradeLock{held: make(chan struct{}, 1)}
+		tl.locks[botID] = lock
+	}
+
+	lock.users++
+	tl.mu.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			tl.release(botID, lock)
+		}, nil
+	case <-ctx.Done():
+		tl.release(botID, lock)
+		return nil, ctx.Err()
+	}
+}
+
+// tryLock locks the trades of a bot if no other trade of the bot is running, without waiting.
+// Returns the function that releases the lock, or false if the lock is held.
+func (tl *tradeLocks) tryLock(botID string) (func(), bool) {
+	tl.mu.Lock()
+	lock, ok := tl.locks[botID]
+	if !ok {
+		lock = &tradeLock{held: make(chan struct{}, 1)}
+		tl.locks[botID] = lock
+	}
+
+	lock.users++
+	tl.mu.Unlock()
+
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			tl.release(botID, lock)
+		}, true
+	default:
+		tl.release(botID, lock)
+		return nil, false
+	}
+}
+
+// release removes a user of a bot's lock and drops the lock once it is unused
+func (tl *tradeLocks) release(botID string, lock *tradeLock) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	lock.users--
+	if lock.users == 0 {
+		delete(tl.locks, botID)
+	}
+}
+
+// lockTrades waits up to tradeLockTimeout for the running trades of the portfolio's bot and locks its trades.
+// Returns the function that releases the lock, or false if the request was aborted.
+func (bw *BotWorker) lockTrades(c *gin.Context, ref *firestore.DocumentRef) (func(), bool) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), tradeLockTimeout)
+	defer cancel()
+
+	unlock, err := bw.trades.lock(ctx, ownerOf(ref).ID)
+	if err != nil {
+		c.AbortWithStatusJSON(409, NewResultPacket("error: another transaction of this bot is still in progress", false))
+		return nil, false
+	}
+
+	return unlock, true
+}
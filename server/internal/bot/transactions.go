@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Transactions returned by GetTransactions unless a limit is requested
+const (
+	defaultTransactionLimit = 100
+	maxTransactionLimit     = 500
+)
+
+// TransactionEntry is a transaction with the ID of its document
+type TransactionEntry struct {
+	ID string `json:"id"` // ID of the transaction document
+	*models.Transaction
+}
+
+// GetTransactions returns a page of the transactions of the authenticated bot, newest first.
+// @Summary Get transactions
+// @Description Lists the transactions of the authenticated bot or the portfolio selected by the X-Portfolio header, newest first. When more transactions follow, the X-Next-Cursor header carries the cursor of the next page. Pages never skip or repeat a transaction, even when the bot trades while paging
+// @Tags transactions
+// @Produce json
+// @Param limit query int false "Number of transactions, 100 by default and at most 500"
+// @Param cursor query string false "Cursor of the page to return, from the X-Next-Cursor header of the previous page"
+// @Success 200 {object} DataPacket "Transactions"
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, missing on the last page"
+// @Failure 400 {object} ResultData "Invalid limit or cursor"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /transactions [get]
+func (bw *BotWorker) GetTransactions(c *gin.Context) {
+	_, ref, ok := bw.getPortfolioFromContext(c)
+	if !ok {
+		return
+	}
+
+	page, ok := parsePageRequest(c, defaultTransactionLimit, maxTransactionLimit)
+	if !ok {
+		return
+	}
+
+	query := bw.db.Collection(bw.collections.Transactions).Where("bot", "==", ref)
+	docs, err := page.query(query, "time", firestore.Desc).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to retrieve transaction information", false))
+		return
+	}
+
+	docs = page.page(c, docs, "time")
+	transactions := make([]*TransactionEntry, 0, len(docs))
+	for _, doc := range docs {
+		transaction := &models.Transaction{}
+		if doc.DataTo(transaction) == nil {
+			transactions = append(transactions, &TransactionEntry{ID: doc.Ref.ID, Transaction: transaction})
+		}
+	}
+
+	c.JSON(200, &DataPacket{"transactions", transactions})
+}
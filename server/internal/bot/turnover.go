@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// parseTurnoverCap parses DAILY_TURNOVER_CAP, the multiple of its equity a portfolio can trade per UTC day. 0 or unset disables the cap.
+func parseTurnoverCap() (float64, error) {
+	env := os.Getenv("DAILY_TURNOVER_CAP")
+	if env == "" {
+		return 0, nil
+	}
+
+	multiple, err := strconv.ParseFloat(env, 64)
+	if err != nil || multiple < 0 {
+		return 0, fmt.Errorf("invalid DAILY_TURNOVER_CAP, must be a non-negative multiple of equity: %s", env)
+	}
+
+	return multiple, nil
+}
+
+// turnoverRule rejects buys once a portfolio's trades of the day would exceed DAILY_TURNOVER_CAP times its equity
+// before the first trade of the day. Sells count towards the turnover but are always allowed, so positions can be closed.
+func (bw *BotWorker) turnoverRule(portfolio *models.Portfolio, transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "turnover", Passed: true}
+	if bw.turnoverCap == 0 || transaction.Action != "buy" {
+		return evaluation
+	}
+
+	allowance := portfolio.AllowanceAt(bw.turnoverCap, transaction.Time)
+	if value := transaction.Value(); value > allowance.Remaining {
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot buy %.2f worth of %s, only %.2f of today's turnover allowance (%gx equity of %.2f) remains until %s",
+			value, transaction.Ticker, allowance.Remaining, bw.turnoverCap, allowance.Equity, allowance.Resets.Format("2006-01-02 15:04 MST"))
+	}
+
+	return evaluation
+}
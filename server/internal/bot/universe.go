@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// universeChangeLimit is the number of recent changes returned with a universe
+const universeChangeLimit = 20
+
+// universeChanges is the subcollection of a universe that logs its changes
+const universeChanges = "changes"
+
+// UniverseData is a universe with its most recent changes
+type UniverseData struct {
+	Name     string                   `json:"name"`     // Name of the universe
+	Universe *models.Universe         `json:"universe"` // Current constituents
+	Changes  []*models.UniverseChange `json:"changes"`  // Most recent changes, newest first
+}
+
+// universeTracker holds the constituents of every universe and the universe of every competition
+type universeTracker struct {
+	mu           sync.RWMutex
+	universes    map[string]map[string]bool
+	competitions map[string]string // Universe of each competition by ID, loaded on first use
+}
+
+// newUniverseTracker creates a tracker without any universe
+func newUniverseTracker() *universeTracker {
+	return &universeTracker{
+		universes:    make(map[string]map[string]bool),
+		competitions: make(map[string]string),
+	}
+}
+
+// set replaces the constituents of a universe
+func (ut *universeTracker) set(name string, tickers []string) {
+	members := make(map[string]bool, len(tickers))
+	for _, ticker := range tickers {
+		members[ticker] = true
+	}
+
+	ut.mu.Lock()
+	ut.universes[name] = members
+	ut.mu.Unlock()
+}
+
+// known checks whether a universe has been loaded
+func (ut *universeTracker) known(name string) bool {
+	ut.mu.RLock()
+	defer ut.mu.RUnlock()
+
+	_, ok := ut.universes[name]
+	return ok
+}
+
+// contains checks whether a ticker is a constituent of a universe
+func (ut *universeTracker) contains(name, ticker string) bool {
+	ut.mu.RLock()
+	defer ut.mu.RUnlock()
+
+	return ut.universes[name][ticker]
+}
+
+// competitionUniverse returns the universe the portfolio's competition is restricted to, empty if it is not restricted.
+// The universe of a competition cannot change, so it is only loaded once.
+func (bw *BotWorker) competitionUniverse(portfolio *models.Portfolio) (string, error) {
+	if portfolio.Competition == nil {
+		return "", nil
+	}
+
+	id := portfolio.Competition.ID
+	bw.universes.mu.RLock()
+	universe, ok := bw.universes.competitions[id]
+	bw.universes.mu.RUnlock()
+	if ok {
+		return universe, nil
+	}
+
+	competition, err := bw.loadCompetition(portfolio)
+	if err != nil {
+		return "", err
+	}
+
+	bw.universes.mu.Lock()
+	bw.universes.competitions[id] = competition.Universe
+	bw.universes.mu.Unlock()
+
+	return competition.Universe, nil
+}
+
+// universeRule rejects buys of tickers outside the universe the bot's competition is restricted to.
+// Sells are allowed, so positions in tickers removed from the universe are grandfathered and can be closed.
+func (bw *BotWorker) universeRule(portfolio *models.Portfolio, transaction *models.Transaction) models.RuleEvaluation {
+	evaluation := models.RuleEvaluation{Rule: "universe", Passed: true}
+	if transaction.Action != "buy" {
+		return evaluation
+	}
+
+	universe, err := bw.competitionUniverse(portfolio)
+	switch {
+	case err != nil:
+		log.Printf("error loading universe of competition: %v\n", err)
+		evaluation.Passed = false
+		evaluation.Detail = "cannot check the universe of the competition"
+	case universe != "" && !bw.universes.contains(universe, transaction.Ticker):
+		evaluation.Passed = false
+		evaluation.Detail = fmt.Sprintf("cannot buy %s, it is not a constituent of the competition's universe %s", transaction.Ticker, universe)
+	}
+
+	return evaluation
+}
+
+// refreshUniverses loads the stored universes and applies the constituents configured in UNIVERSES_FILE.
+// Every change is logged in the universe's change log and broadcast to every connected bot.
+// Stored universes missing from the file are kept, so competitions restricted to them stay restricted.
+func (bw *BotWorker) refreshUniverses() error {
+	ctx := context.Background()
+	docs, err := bw.db.Collection(bw.collections.Universes).Documents(ctx).GetAll()
+	if err != nil {
+		return fmt.Errorf("error retrieving universes: %v", err)
+	}
+
+	stored := make(map[string]*models.Universe, len(docs))
+	for _, doc := range docs {
+		universe := &models.Universe{}
+		if doc.DataTo(universe) == nil {
+			stored[doc.Ref.ID] = universe
+			bw.universes.set(doc.Ref.ID, universe.Tickers)
+		}
+	}
+
+	path := os.Getenv("UNIVERSES_FILE")
+	if path == "" {
+		return nil
+	}
+
+	configured, err := models.LoadUniverses(path)
+	if err != nil {
+		return fmt.Errorf("error loading UNIVERSES_FILE: %v", err)
+	}
+
+	now := time.Now()
+	for name, tickers := range configured {
+		var previous []string
+		if universe, ok := stored[name]; ok {
+			previous = universe.Tickers
+		}
+
+		change := models.DiffUniverse(name, previous, tickers, now)
+		if change == nil {
+			continue
+		}
+
+		ref := bw.db.Collection(bw.collections.Universes).Doc(name)
+		batch := bw.db.Batch()
+		batch.Set(ref, &models.Universe{Tickers: tickers, UpdatedAt: now})
+		batch.Set(ref.Collection(universeChanges).NewDoc(), change)
+		_, err = batch.Commit(ctx)
+		if err != nil {
+			return fmt.Errorf("error saving universe %s: %v", name, err)
+		}
+
+		bw.universes.set(name, tickers)
+		log.Printf("universe %s changed: %d added, %d removed\n", name, len(change.Added), len(change.Removed))
+		bw.broadcast(&DataPacket{"universe_changed", change})
+	}
+
+	return nil
+}
+
+// GetUniverse returns the constituents of a universe and its most recent changes.
+// @Summary Get universe
+// @Description Retrieves the current constituents of an index universe and its most recent changes, newest first
+// @Tags competitions
+// @Produce json
+// @Param name path string true "Name of the universe"
+// @Success 200 {object} DataPacket "Universe"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 404 {object} ResultData "Unknown universe"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /universes/{name} [get]
+func (bw *BotWorker) GetUniverse(c *gin.Context) {
+	name := c.Param("name")
+	if !bw.universes.known(name) {
+		c.AbortWithStatusJSON(404, NewResultPacket("error: unknown universe", false))
+		return
+	}
+
+	ref := bw.db.Collection(bw.collections.Universes).Doc(name)
+	doc, err := ref.Get(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load universe", false))
+		return
+	}
+
+	universe := &models.Universe{}
+	err = doc.DataTo(universe)
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load universe", false))
+		return
+	}
+
+	docs, err := ref.Collection(universeChanges).OrderBy("time", firestore.Desc).Limit(universeChangeLimit).Documents(context.Background()).GetAll()
+	if err != nil {
+		c.AbortWithStatusJSON(500, NewResultPacket("error: failed to load universe changes", false))
+		return
+	}
+
+	changes := make([]*models.UniverseChange, 0, len(docs))
+	for _, doc := range docs {
+		change := &models.UniverseChange{}
+		if doc.DataTo(change) == nil {
+			changes = append(changes, change)
+		}
+	}
+
+	c.JSON(200, &DataPacket{"universe", &UniverseData{Name: name, Universe: universe, Changes: changes}})
+}
@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BotUsage contains API usage statistics for a single bot
+type BotUsage struct {
+	BotID        string           `json:"botId"`        // ID of the bot document
+	Requests     int64            `json:"requests"`     // Number of authenticated requests made
+	Errors       int64            `json:"errors"`       // Number of requests that returned a 4xx or 5xx status
+	ErrorRate    float64          `json:"errorRate"`    // Errors divided by requests
+	Transactions int64            `json:"transactions"` // Number of successfully executed transactions
+	BytesSent    int64            `json:"bytesSent"`    // Response body bytes sent, before compression
+	Endpoints    map[string]int64 `json:"endpoints"`    // Request count per endpoint
+	FirstRequest time.Time        `json:"firstRequest"` // Time of the first tracked request
+	LastRequest  time.Time        `json:"lastRequest"`  // Time of the most recent request
+}
+
+// UsageSummary aggregates the usage of every bot
+type UsageSummary struct {
+	Since        time.Time   `json:"since"`        // When usage tracking started
+	Requests     int64       `json:"requests"`     // Total requests across all bots
+	Errors       int64       `json:"errors"`       // Total errors across all bots
+	ErrorRate    float64     `json:"errorRate"`    // Errors divided by requests
+	Transactions int64       `json:"transactions"` // Total transactions across all bots
+	BytesSent    int64       `json:"bytesSent"`    // Total response bytes sent
+	Bots         []*BotUsage `json:"bots"`         // Per bot usage sorted by request count
+}
+
+// usageTracker tracks per bot API usage in memory since the server started
+type usageTracker struct {
+	mu    sync.Mutex
+	since time.Time
+	bots  map[string]*BotUsage
+}
+
+// newUsageTracker creates an empty usage tracker
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		since: time.Now(),
+		bots:  make(map[string]*BotUsage),
+	}
+}
+
+// get returns the usage entry for a bot, creating it if needed. The caller must hold mu.
+func (ut *usageTracker) get(botID string) *BotUsage {
+	usage, ok := ut.bots[botID]
+	if !ok {
+		usage = &BotUsage{
+			BotID:        botID,
+			Endpoints:    make(map[string]int64),
+			FirstRequest: time.Now(),
+		}
+		ut.bots[botID] = usage
+	}
+
+	return usage
+}
+
+// recordRequest records a finished request for a bot
+func (ut *usageTracker) recordRequest(botID, endpoint string, status, bytesSent int) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	usage := ut.get(botID)
+	usage.Requests++
+	usage.Endpoints[endpoint]++
+	usage.LastRequest = time.Now()
+
+	if status >= 400 {
+		usage.Errors++
+	}
+
+	if bytesSent > 0 {
+		usage.BytesSent += int64(bytesSent)
+	}
+}
+
+// recordTransaction records a successfully executed transaction for a bot
+func (ut *usageTracker) recordTransaction(botID string) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	ut.get(botID).Transactions++
+}
+
+// snapshot returns a copy of a bot's usage, or an empty entry if the bot has no usage
+func (ut *usageTracker) snapshot(botID string) *BotUsage {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	return copyUsage(ut.get(botID))
+}
+
+// summary returns the aggregated usage of every bot
+func (ut *usageTracker) summary() *UsageSummary {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+
+	summary := &UsageSummary{
+		Since: ut.since,
+		Bots:  make([]*BotUsage, 0, len(ut.bots)),
+	}
+
+	for _, usage := range ut.bots {
+		summary.Requests += usage.Requests
+		summary.Errors += usage.Errors
+		summary.Transactions += usage.Transactions
+		summary.BytesSent += usage.BytesSent
+		summary.Bots = append(summary.Bots, copyUsage(usage))
+	}
+
+	if summary.Requests > 0 {
+		summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+	}
+
+	sort.Slice(summary.Bots, func(a, b int) bool {
+		return summary.Bots[a].Requests > summary.Bots[b].Requests
+	})
+
+	return summary
+}
+
+// copyUsage copies a usage entry and computes its error rate. The caller must hold mu.
+func copyUsage(usage *BotUsage) *BotUsage {
+	copied := *usage
+	copied.Endpoints = make(map[string]int64, len(usage.Endpoints))
+	for endpoint, count := range usage.Endpoints {
+		copied.Endpoints[endpoint] = count
+	}
+
+	if copied.Requests > 0 {
+		copied.ErrorRate = float64(copied.Errors) / float64(copied.Requests)
+	}
+
+	return &copied
+}
+
+// UsageHandler records API usage statistics for the authenticated bot.
+// Requests on shadow portfolios count towards their bot. It must be applied after AuthHandler.
+func (bw *BotWorker) UsageHandler(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		return
+	}
+
+	c.Next()
+
+	bw.usage.recordRequest(ref.ID, c.Request.Method+" "+c.FullPath(), c.Writer.Status(), c.Writer.Size())
+}
+
+// GetUsage returns the API usage statistics of the authenticated bot.
+// @Summary Get API usage
+// @Description Retrieves request, error, transaction and data egress statistics for the authenticated bot
+// @Tags usage
+// @Produce json
+// @Success 200 {object} DataPacket "Usage statistics"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /usage [get]
+func (bw *BotWorker) GetUsage(c *gin.Context) {
+	ref, ok := ownerRef(c)
+	if !ok {
+		c.AbortWithStatusJSON(401, NewResultPacket("error: not authenticated", false))
+		return
+	}
+
+	c.JSON(200, &DataPacket{"usage", bw.usage.snapshot(ref.ID)})
+}
+
+// GetUsageSummary returns the aggregated API usage statistics of every bot.
+// @Summary Get API usage of all bots
+// @Description Retrieves usage totals and per bot usage statistics since the server started
+// @Tags admin
+// @Produce json
+// @Success 200 {object} DataPacket "Usage summary"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Router /admin/usage [get]
+func (bw *BotWorker) GetUsageSummary(c *gin.Context) {
+	c.JSON(200, &DataPacket{"usage_summary", bw.usage.summary()})
+}
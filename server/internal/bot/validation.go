@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// FieldError describes why a single field of a request body failed validation
+type FieldError struct {
+	Field   string `json:"field"`   // JSON name of the field
+	Rule    string `json:"rule"`    // Validation rule that failed, e.g. "required" or "gt"
+	Param   string `json:"param"`   // Parameter of the rule, e.g. "0" for gt=0
+	Message string `json:"message"` // Human-readable description of the failure
+}
+
+// ValidationErrorData represents a result message with the field-level errors of a rejected request body
+type ValidationErrorData struct {
+	Message string        `json:"payload"`
+	Success bool          `json:"success"`
+	Errors  []*FieldError `json:"errors"`
+}
+
+// RegisterValidators registers the custom validation rules used by the request binding structs
+// and makes validation errors report the JSON field names. It must be called before serving requests.
+func RegisterValidators() error {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unsupported binding validator")
+	}
+
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	return engine.RegisterValidation("ticker", func(fl validator.FieldLevel) bool {
+		return symbols.Valid(fl.Field().String())
+	})
+}
+
+// abortWithBindingError responds with 400 and the field-level details of a binding error
+func abortWithBindingError(c *gin.Context, err error) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		c.AbortWithStatusJSON(400, NewResultPacket("error: failed to parse request body", false))
+		return
+	}
+
+	fields := make([]*FieldError, 0, len(invalid))
+	for _, field := range invalid {
+		fields = append(fields, &FieldError{
+			Field:   field.Field(),
+			Rule:    field.Tag(),
+			Param:   field.Param(),
+			Message: fieldErrorMessage(field),
+		})
+	}
+
+	c.AbortWithStatusJSON(400, &DataPacket{"result", &ValidationErrorData{"error: invalid request body", false, fields}})
+}
+
+// fieldErrorMessage describes a failed validation rule
+func fieldErrorMessage(field validator.FieldError) string {
+	switch field.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field.Field())
+	case "required_with":
+		// The parameter is the Go name of the other field
+		other := field.Param()
+		return fmt.Sprintf("%s is required with %s", field.Field(), strings.ToLower(other[:1])+other[1:])
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field.Field(), strings.Join(strings.Fields(field.Param()), ", "))
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field.Field(), field.Param())
+	case "gte":
+		return fmt.Sprintf("%s must not be less than %s", field.Field(), field.Param())
+	case "ticker":
+		return fmt.Sprintf("%s must be a ticker symbol such as AAPL or BRK.B", field.Field())
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field.Field(), field.Tag())
+	}
+}
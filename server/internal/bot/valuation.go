@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ValuationStats reports the held tickers that portfolios were valued without a live price for
+type ValuationStats struct {
+	LastRun        time.Time            `json:"lastRun"`        // When account values were last calculated, zero if never
+	Portfolios     int                  `json:"portfolios"`     // Portfolios valued by the last run
+	Partial        int                  `json:"partial"`        // Portfolios of the last run that hold a pending ticker
+	PendingTickers []string             `json:"pendingTickers"` // Held tickers whose data is being fetched, sorted
+	PendingSince   map[string]time.Time `json:"pendingSince"`   // When each pending ticker was first found missing
+	Fetching       bool                 `json:"fetching"`       // Whether a fetch of pending tickers is running
+}
+
+// valuationTracker tracks the held tickers missing from the live prices and fetches them in the background,
+// so valuations never wait for downloads
+type valuationTracker struct {
+	mu         sync.Mutex
+	pending    map[string]time.Time // When each missing ticker was first found
+	fetching   bool
+	lastRun    time.Time
+	portfolios int
+	partial    int
+}
+
+// newValuationTracker creates a valuation tracker without pending tickers
+func newValuationTracker() *valuationTracker {
+	return &valuationTracker{pending: make(map[string]time.Time)}
+}
+
+// record stores the result of a valuation run and the held tickers that were missing.
+// Tickers that are no longer missing stop being pending.
+func (vt *valuationTracker) record(missing map[string]bool, portfolios, partial int, now time.Time) {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	for ticker := range vt.pending {
+		if !missing[ticker] {
+			delete(vt.pending, ticker)
+		}
+	}
+
+	for ticker := range missing {
+		if _, ok := vt.pending[ticker]; !ok {
+			vt.pending[ticker] = now
+		}
+	}
+
+	vt.lastRun, vt.portfolios, vt.partial = now, portfolios, partial
+}
+
+// startFetch marks a fetch as running, returns false if one is already running
+func (vt *valuationTracker) startFetch() bool {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	if vt.fetching {
+		return false
+	}
+
+	vt.fetching = true
+	return true
+}
+
+// finishFetch marks the running fetch as finished
+func (vt *valuationTracker) finishFetch() {
+	vt.mu.Lock()
+	vt.fetching = false
+	vt.mu.Unlock()
+}
+
+// stats returns a copy of the valuation statistics
+func (vt *valuationTracker) stats() *ValuationStats {
+	vt.mu.Lock()
+	defer vt.mu.Unlock()
+
+	stats := &ValuationStats{
+		LastRun:        vt.lastRun,
+		Portfolios:     vt.portfolios,
+		Partial:        vt.partial,
+		PendingTickers: make([]string, 0, len(vt.pending)),
+		PendingSince:   make(map[string]time.Time, len(vt.pending)),
+		Fetching:       vt.fetching,
+	}
+
+	for ticker, since := range vt.pending {
+		stats.PendingTickers = append(stats.PendingTickers, ticker)
+		stats.PendingSince[ticker] = since
+	}
+
+	sort.Strings(stats.PendingTickers)
+	return stats
+}
+
+// fetchPendingTickers downloads the history and live prices of held tickers that are missing in the background.
+// Held tickers rank first in the download priorities, so they are fetched before other missing tickers.
+// Only one fetch runs at a time, tickers still missing afterwards are fetched after the next valuation.
+func (bw *BotWorker) fetchPendingTickers(tickers []string) {
+	if len(tickers) == 0 || !bw.valuations.startFetch() {
+		return
+	}
+
+	go func() {
+		defer bw.valuations.finishFetch()
+
+		log.Printf("fetching %d held tickers without prices: %v\n", len(tickers), tickers)
+		err := bw.addTickers(tickers...)
+		if err != nil {
+			log.Printf("error fetching held tickers: %v\n", err)
+		}
+	}()
+}
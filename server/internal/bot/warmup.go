@@ -0,0 +1,261 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Warmup stages, in the order they run
+const (
+	WarmupLoadCache = "load_cache" // Loads the daily cache saved by the previous run
+	WarmupWatchlist = "watchlist"  // Watches every cached and held ticker and downloads the missing history
+	WarmupPrices    = "prices"     // Fetches the live prices of the watched tickers
+)
+
+// Statuses of a warmup stage
+const (
+	StagePending = "pending"
+	StageRunning = "running"
+	StageDone    = "done"
+	StageFailed  = "failed" // The last attempt failed, the stage is retried
+)
+
+// Delays between attempts of a failed warmup stage, doubling up to the maximum
+const (
+	warmupRetryMin = 5 * time.Second
+	warmupRetryMax = 2 * time.Minute
+)
+
+// WarmupStage reports the progress of a warmup stage
+type WarmupStage struct {
+	Name     string    `json:"name"`     // Name of the stage
+	Status   string    `json:"status"`   // "pending", "running", "done" or "failed"
+	Attempts int       `json:"attempts"` // Attempts of the stage so far
+	Started  time.Time `json:"started"`  // When the first attempt started, zero if pending
+	Finished time.Time `json:"finished"` // When the stage succeeded, zero until then
+	Detail   string    `json:"detail"`   // What the stage did
+	Error    string    `json:"error"`    // Error of the last failed attempt
+}
+
+// Readiness reports whether the server finished warming up and accepts trades
+type Readiness struct {
+	Ready          bool           `json:"ready"`          // Whether every stage is done
+	ReadyAt        time.Time      `json:"readyAt"`        // When the server became ready, zero until then
+	Stages         []*WarmupStage `json:"stages"`         // Progress of every stage, in order
+	MissingTickers []string       `json:"missingTickers"` // Watched tickers whose history could not be downloaded
+}
+
+// warmupTracker tracks the startup stages that must finish before the server is ready
+type warmupTracker struct {
+	mu        sync.Mutex
+	readiness Readiness
+}
+
+// newWarmupTracker creates a tracker with every stage pending
+func newWarmupTracker() *warmupTracker {
+	wt := &warmupTracker{readiness: Readiness{MissingTickers: make([]string, 0)}}
+	for _, name := range []string{WarmupLoadCache, WarmupWatchlist, WarmupPrices} {
+		wt.readiness.Stages = append(wt.readiness.Stages, &WarmupStage{Name: name, Status: StagePending})
+	}
+
+	return wt
+}
+
+// ready reports whether every stage is done
+func (wt *warmupTracker) ready() bool {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	return wt.readiness.Ready
+}
+
+// snapshot returns a copy of the readiness
+func (wt *warmupTracker) snapshot() *Readiness {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	readiness := wt.readiness
+	readiness.Stages = make([]*WarmupStage, 0, len(wt.readiness.Stages))
+	for _, stage := range wt.readiness.Stages {
+		copied := *stage
+		readiness.Stages = append(readiness.Stages, &copied)
+	}
+
+	readiness.MissingTickers = append([]string{}, wt.readiness.MissingTickers...)
+	return &readiness
+}
+
+// run runs a stage, retrying it with a growing delay until it succeeds
+func (wt *warmupTracker) run(name string, fn func() (string, error)) {
+	var stage *WarmupStage
+	for _, s := range wt.readiness.Stages {
+		if s.Name == name {
+			stage = s
+		}
+	}
+
+	delay := warmupRetryMin
+	for {
+		wt.mu.Lock()
+		stage.Status = StageRunning
+		stage.Attempts++
+		if stage.Started.IsZero() {
+			stage.Started = time.Now()
+		}
+		wt.mu.Unlock()
+
+		detail, err := fn()
+
+		wt.mu.Lock()
+		stage.Detail = detail
+		if err == nil {
+			stage.Status = StageDone
+			stage.Finished = time.Now()
+			stage.Error = ""
+			wt.mu.Unlock()
+			return
+		}
+
+		stage.Status = StageFailed
+		stage.Error = err.Error()
+		wt.mu.Unlock()
+
+		log.Printf("warmup stage %s failed, retrying in %v: %v\n", name, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, warmupRetryMax)
+	}
+}
+
+// finish marks the server as ready
+func (wt *warmupTracker) finish() {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+
+	wt.readiness.Ready = true
+	wt.readiness.ReadyAt = time.Now()
+}
+
+// loadCache loads the daily cache saved by the previous run, preferring the GOB file and falling back to the
+// JSON file. A missing cache is not an error, the watchlist stage downloads the history instead.
+// It runs before the background jobs start so that no download writes to the cache while it is replaced.
+func (bw *BotWorker) loadCache() {
+	bw.warmup.run(WarmupLoadCache, func() (string, error) {
+		err := bw.tiingo.LoadCaches(false)
+		if err != nil {
+			log.Printf("error loading the GOB cache, trying the JSON cache: %v\n", err)
+			err = bw.tiingo.LoadCaches(true)
+		}
+
+		if err != nil {
+			log.Printf("error loading the JSON cache, starting with an empty cache: %v\n", err)
+			bw.tiingo.DailyCache = models.NewHistory()
+		}
+
+		return fmt.Sprintf("loaded %d rows of %d tickers", len(bw.watchlist.Daily().Rows), len(bw.watchlist.Daily().Tickers)), nil
+	})
+}
+
+// warmUp watches every cached and held ticker, downloads the missing history and fetches the live prices once,
+// then marks the server as ready. Stages that fail are retried until they succeed.
+func (bw *BotWorker) warmUp() {
+	bw.warmup.run(WarmupWatchlist, bw.warmUpWatchlist)
+	bw.warmup.run(WarmupPrices, func() (string, error) {
+		tickers := bw.watchlist.Tickers()
+		if len(tickers) == 0 {
+			return "no watched tickers", nil
+		}
+
+		err := bw.updateCurrPrices()
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("fetched %d prices from %s", len(bw.latestPrices), bw.priceSource), nil
+	})
+
+	bw.warmup.finish()
+	log.Println("warmup finished, the server is ready")
+}
+
+// warmUpWatchlist watches the cached tickers and the tickers held by any bot or shadow portfolio, and downloads
+// the history of those missing from the cache. Tickers that still have no history are reported, not retried,
+// so a delisted holding cannot keep the server from becoming ready.
+func (bw *BotWorker) warmUpWatchlist() (string, error) {
+	for ticker := range bw.watchlist.Daily().Tickers {
+		bw.watchlist.AddTickers(ticker)
+	}
+
+	docs, err := bw.db.Collection(bw.collections.Bots).Documents(context.Background()).GetAll()
+	if err != nil {
+		return "", fmt.Errorf("error retrieving bots: %v", err)
+	}
+
+	shadows, err := bw.db.CollectionGroup(bw.collections.Shadows).Documents(context.Background()).GetAll()
+	if err != nil {
+		return "", fmt.Errorf("error retrieving shadow portfolios: %v", err)
+	}
+
+	for _, doc := range append(docs, shadows...) {
+		portfolio := &models.Portfolio{}
+		doc.DataTo(portfolio)
+		for ticker := range portfolio.Holdings {
+			bw.watchlist.AddTickers(ticker)
+		}
+	}
+
+	bw.tickers.downloadMu.Lock()
+	err = bw.tiingo.DownloadMissingTickers()
+	bw.tickers.downloadMu.Unlock()
+	if err != nil {
+		log.Printf("error downloading missing tickers during warmup: %v\n", err)
+	}
+
+	missing := make([]string, 0)
+	for _, ticker := range bw.watchlist.Tickers() {
+		if !bw.tiingo.Cached(ticker) {
+			missing = append(missing, ticker)
+		}
+	}
+
+	bw.warmup.mu.Lock()
+	bw.warmup.readiness.MissingTickers = missing
+	bw.warmup.mu.Unlock()
+
+	return fmt.Sprintf("watching %d tickers, %d without history", len(bw.watchlist.Tickers()), len(missing)), nil
+}
+
+// RequireReady rejects requests with 503 until the server finished warming up.
+// It should be applied to routes that trade at the live prices.
+func (bw *BotWorker) RequireReady(c *gin.Context) {
+	if bw.warmup.ready() {
+		return
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(warmupRetryMin.Seconds())))
+	c.AbortWithStatusJSON(503, NewResultPacket("error: the server is warming up and not accepting trades yet, see /readyz", false))
+}
+
+// GetReadiness reports whether the server finished warming up.
+// @Summary Get server readiness
+// @Description Reports the progress of the startup warmup. Returns 200 once the cache is loaded, every held ticker is watched and the live prices were fetched, and 503 until then
+// @Tags health
+// @Produce json
+// @Success 200 {object} DataPacket "Server is ready"
+// @Failure 503 {object} DataPacket "Server is warming up"
+// @Router /readyz [get]
+func (bw *BotWorker) GetReadiness(c *gin.Context) {
+	readiness := bw.warmup.snapshot()
+	if !readiness.Ready {
+		c.JSON(503, &DataPacket{"readiness", readiness})
+		return
+	}
+
+	c.JSON(200, &DataPacket{"readiness", readiness})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"urjith.dev/algobattle/internal/bot"
+)
+
+// ChaosRule configures the faults injected into requests of an endpoint.
+// Rates are probabilities between 0 and 1, rolled independently for every request.
+type ChaosRule struct {
+	LatencyRate  float64 `json:"latencyRate"`  // Probability of delaying the request
+	MinLatencyMs int     `json:"minLatencyMs"` // Minimum injected delay in milliseconds
+	MaxLatencyMs int     `json:"maxLatencyMs"` // Maximum injected delay in milliseconds
+	ErrorRate    float64 `json:"errorRate"`    // Probability of failing the request with a 5xx status
+	StaleRate    float64 `json:"staleRate"`    // Probability of serving the previous prices instead of the latest
+}
+
+// ChaosConfig configures fault injection for resilience testing.
+// It must never be enabled in production.
+type ChaosConfig struct {
+	Default   *ChaosRule            `json:"default"`   // Rule for endpoints without their own rule, nil injects nothing
+	Endpoints map[string]*ChaosRule `json:"endpoints"` // Rules by endpoint, keyed by method and route, e.g. "GET /live_stock_data"
+}
+
+// injectedStatuses are the statuses of injected errors
+var injectedStatuses = []int{500, 502, 503, 504}
+
+// LoadChaosConfig reads a chaos configuration from a JSON file
+func LoadChaosConfig(path string) (*ChaosConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ChaosConfig{}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing chaos config: %v", err)
+	}
+
+	rules := []*ChaosRule{cfg.Default}
+	for _, rule := range cfg.Endpoints {
+		rules = append(rules, rule)
+	}
+
+	for _, rule := range rules {
+		if rule != nil && rule.MaxLatencyMs < rule.MinLatencyMs {
+			return nil, fmt.Errorf("chaos maxLatencyMs must not be less than minLatencyMs")
+		}
+	}
+
+	return cfg, nil
+}
+
+// rule returns the rule of an endpoint, falling back to the default rule
+func (cfg *ChaosConfig) rule(endpoint string) *ChaosRule {
+	if rule, ok := cfg.Endpoints[endpoint]; ok {
+		return rule
+	}
+
+	return cfg.Default
+}
+
+// ChaosHandler returns middleware that injects latency, server errors and stale prices
+// according to the configuration. Every injected fault is reported in the X-Chaos header
+// so participants can tell injected faults from real ones.
+func ChaosHandler(cfg *ChaosConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := cfg.rule(c.Request.Method + " " + unversionedPath(c.FullPath()))
+		if rule == nil {
+			return
+		}
+
+		if rand.Float64() < rule.LatencyRate {
+			latency := rule.MinLatencyMs
+			if rule.MaxLatencyMs > rule.MinLatencyMs {
+				latency += rand.IntN(rule.MaxLatencyMs - rule.MinLatencyMs + 1)
+			}
+
+			c.Writer.Header().Add("X-Chaos", fmt.Sprintf("latency=%dms", latency))
+			time.Sleep(time.Duration(latency) * time.Millisecond)
+		}
+
+		if rand.Float64() < rule.ErrorRate {
+			status := injectedStatuses[rand.IntN(len(injectedStatuses))]
+			c.Writer.Header().Add("X-Chaos", "error")
+			c.AbortWithStatusJSON(status, NewResultPacket("error: injected fault", false))
+			return
+		}
+
+		if rand.Float64() < rule.StaleRate {
+			c.Writer.Header().Add("X-Chaos", "stale")
+			c.Set(bot.StalePricesKey, true)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// Encodings supported by the compression middleware, in order of preference
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+)
+
+// Pools of compressors so each response does not allocate a new one
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	brotliWriters = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}}
+)
+
+// resettableWriter is implemented by both gzip and brotli writers
+type resettableWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+	Flush() error
+}
+
+// compressWriter wraps a gin.ResponseWriter and compresses everything written to it
+type compressWriter struct {
+	gin.ResponseWriter
+	writer  resettableWriter
+	written bool
+	size    int
+}
+
+// Write compresses data and writes it to the underlying response
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	cw.Header().Del("Content-Length")
+	cw.written = true
+	n, err := cw.writer.Write(data)
+	cw.size += n
+	return n, err
+}
+
+// Size returns the number of uncompressed bytes written, or -1 if nothing was written.
+// The compressed stream is flushed when the handler flushes and once the handler chain finishes.
+func (cw *compressWriter) Size() int {
+	if !cw.written {
+		return -1
+	}
+
+	return cw.size
+}
+
+// WriteString compresses a string and writes it to the underlying response
+func (cw *compressWriter) WriteString(s string) (int, error) {
+	return cw.Write([]byte(s))
+}
+
+// Flush writes the data compressed so far to the client, so streamed responses arrive as they are written
+// instead of when the compressor's buffer fills or the handler chain finishes
+func (cw *compressWriter) Flush() {
+	if cw.written {
+		cw.writer.Flush()
+	}
+
+	cw.ResponseWriter.Flush()
+}
+
+// WriteHeader removes the stale Content-Length before writing the status code
+func (cw *compressWriter) WriteHeader(code int) {
+	cw.Header().Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// CompressionHandler returns middleware that compresses responses with brotli or gzip,
+// depending on the client's Accept-Encoding header. Brotli is preferred when both are accepted.
+// WebSocket upgrades and HEAD requests are passed through untouched.
+func CompressionHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			return
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			return
+		}
+
+		var pool *sync.Pool
+		switch encoding {
+		case encodingBrotli:
+			pool = &brotliWriters
+		case encodingGzip:
+			pool = &gzipWriters
+		}
+
+		writer := pool.Get().(resettableWriter)
+		writer.Reset(c.Writer)
+		defer pool.Put(writer)
+
+		c.Header("Content-Encoding", encoding)
+		// Add rather than set, so the Vary: Origin from the CORS middleware is kept
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: c.Writer, writer: writer}
+		c.Writer = cw
+
+		defer func() {
+			// Nothing was written, so don't send an empty compressed stream
+			if !cw.written {
+				cw.Header().Del("Content-Encoding")
+				writer.Reset(io.Discard)
+				return
+			}
+
+			writer.Close()
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the preferred supported encoding from an Accept-Encoding header.
+// Encodings with a quality value of 0 are treated as not accepted.
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err == nil {
+				quality = parsed
+			}
+		}
+
+		accepted[name] = quality > 0
+	}
+
+	switch {
+	case accepted[encodingBrotli]:
+		return encodingBrotli
+	case accepted[encodingGzip]:
+		return encodingGzip
+	default:
+		return ""
+	}
+}
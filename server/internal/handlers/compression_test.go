@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompressionKeepsCORSVary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(CORSHandler(DefaultCORSConfig("https://example.com")))
+	r.Use(CompressionHandler())
+	r.GET("/ping", func(c *gin.Context) {
+		c.String(http.StatusOK, "pong")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != encodingGzip {
+		t.Fatalf("Content-Encoding = %q, want %q", got, encodingGzip)
+	}
+
+	// A shared cache must key the response on both the origin and the encoding
+	vary := rec.Header().Values("Vary")
+	for _, want := range []string{"Origin", "Accept-Encoding"} {
+		if !slices.Contains(vary, want) {
+			t.Errorf("Vary = %q, missing %q", vary, want)
+		}
+	}
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want https://example.com", got)
+	}
+}
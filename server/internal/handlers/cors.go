@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig configures which browser origins may call the API.
+type CORSConfig struct {
+	AllowedOrigins []string      // Origins allowed to make requests, "*" allows any origin
+	AllowedHeaders []string      // Request headers browsers may send
+	AllowedMethods []string      // Methods browsers may use
+	MaxAge         time.Duration // How long browsers may cache a preflight response
+}
+
+// DefaultCORSConfig returns a CORS configuration that allows the given origins
+// to send authenticated GET, POST, PUT and DELETE requests.
+// Surrounding spaces are trimmed from the origins and empty origins are dropped.
+func DefaultCORSConfig(origins ...string) *CORSConfig {
+	allowed := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowed = append(allowed, origin)
+		}
+	}
+
+	return &CORSConfig{
+		AllowedOrigins: allowed,
+		AllowedHeaders: []string{"Authorization", "Content-Type", "X-Portfolio", VersionHeader},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		MaxAge:         12 * time.Hour,
+	}
+}
+
+// allowsOrigin checks whether an origin is in the allowed list
+func (cfg *CORSConfig) allowsOrigin(origin string) bool {
+	return slices.Contains(cfg.AllowedOrigins, "*") || cfg.listsOrigin(origin)
+}
+
+// listsOrigin checks whether an origin is listed explicitly, not only allowed by "*"
+func (cfg *CORSConfig) listsOrigin(origin string) bool {
+	return slices.Contains(cfg.AllowedOrigins, origin)
+}
+
+// CORSHandler returns middleware that adds CORS headers for allowed origins
+// and answers preflight requests before they reach authentication.
+// Requests from origins that are not allowed are passed through without CORS headers,
+// so browsers will block them while non-browser clients are unaffected.
+// Credentials are only allowed for origins that are listed explicitly, so "*" never lets
+// an arbitrary site send requests with the cookies or credentials of a browser.
+func CORSHandler(cfg *CORSConfig) gin.HandlerFunc {
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	allowedMethods := strings.Join(cfg.AllowedMethods, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !cfg.allowsOrigin(origin) {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+			}
+
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if cfg.listsOrigin(origin) {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Headers", allowedHeaders)
+			c.Header("Access-Control-Allow-Methods", allowedMethods)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+		}
+	}
+}
@@ -3,24 +3,192 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"urjith.dev/algobattle/internal/bot"
+	"urjith.dev/algobattle/pkg/models"
 )
 
+// Config holds the configuration of the HTTP routes.
+type Config struct {
+	AdminKey     string       // API key required for admin routes
+	CORS         *CORSConfig  // Allowed browser origins, nil disables CORS
+	Chaos        *ChaosConfig // Fault injection for bot routes, nil disables it
+	LegacySunset time.Time    // When the unversioned routes will be removed, zero if not scheduled
+}
+
 // SetupRoutes configures all HTTP routes for the application API.
+// Every route is served under /v1 and, for bots that predate versioning, without
+// a version prefix. The unversioned routes are deprecated and send Deprecation headers.
+// Admin routes are grouped under /admin and require the admin API key.
+func SetupRoutes(r *gin.Engine, botWorker *bot.BotWorker, cfg *Config) {
+	if cfg.CORS != nil {
+		r.Use(CORSHandler(cfg.CORS))
+	}
+
+	r.Use(CompressionHandler())
+
+	// Probes are unversioned so load balancers do not depend on the API version
+	r.GET("/readyz", botWorker.GetReadiness)
+
+	legacyRoutes := r.Group("/")
+	legacyRoutes.Use(LegacyVersionHandler(cfg.LegacySunset))
+	setupVersionRoutes(r, legacyRoutes, botWorker, cfg)
+
+	v1Routes := r.Group(versionPrefix(Version1))
+	v1Routes.Use(VersionHandler(Version1))
+	setupVersionRoutes(r, v1Routes, botWorker, cfg)
+}
+
+// setupVersionRoutes configures the routes of an API version on a route group.
 // It groups routes under authentication middleware and maps each endpoint
 // to its corresponding handler function in the BotWorker.
-func SetupRoutes(r *gin.Engine, botWorker *bot.BotWorker) {
-	httpRoutes := r.Group("/")
-	httpRoutes.Use(botWorker.AuthHandler)
+func setupVersionRoutes(r *gin.Engine, routes *gin.RouterGroup, botWorker *bot.BotWorker, cfg *Config) {
+	// Public routes are read-only and do not require an API key
+	routes.GET("/public/ws", botWorker.PublicStream)
+	routes.GET("/public/bots/:id", botWorker.GetPublicProfile)
+	routes.GET("/public/competitions", botWorker.GetOpenCompetitions)
+	routes.POST("/public/competitions/:id/join", botWorker.JoinCompetition)
+	routes.GET("/public/competitions/:id/leaderboard", botWorker.GetCompetitionLeaderboard)
+
+	httpRoutes := routes.Group("/")
+	httpRoutes.Use(botWorker.AuthHandler, botWorker.UsageHandler)
+	if cfg.Chaos != nil {
+		httpRoutes.Use(ChaosHandler(cfg.Chaos))
+	}
 
 	httpRoutes.GET("/portfolio", botWorker.GetPortfolio)
+	httpRoutes.GET("/portfolio/attribution", botWorker.GetAttribution)
+	httpRoutes.GET("/portfolio/tca", botWorker.GetTCA)
+	httpRoutes.GET("/portfolio/replay", botWorker.GetReplay)
+	httpRoutes.GET("/portfolio/projection", botWorker.GetProjection)
+	httpRoutes.GET("/compare", botWorker.ComparePortfolios)
+	httpRoutes.GET("/benchmarks", botWorker.GetBenchmarks)
+	httpRoutes.GET("/competition", botWorker.GetCompetitionConfig)
+	httpRoutes.GET("/universes/:name", botWorker.GetUniverse)
 	httpRoutes.GET("/add_ticker", botWorker.AddTicker)
-	httpRoutes.POST("/transact", botWorker.MakeTransaction, botWorker.SavePortfolio)
+	httpRoutes.GET("/ticker_status", botWorker.GetTickerStatus)
+	httpRoutes.GET("/market_status", botWorker.GetMarketStatus)
+	httpRoutes.POST("/transact", botWorker.RequireReady, botWorker.RequireEligible, botWorker.MakeTransaction)
+	httpRoutes.POST("/analyze/trade", botWorker.AnalyzeTrade)
 	httpRoutes.GET("/daily_stock_data", botWorker.GetDailyStockData)
 	httpRoutes.GET("/live_stock_data", botWorker.GetLiveStockData)
+	httpRoutes.GET("/quote", botWorker.GetQuotes)
+	httpRoutes.GET("/transactions", botWorker.GetTransactions)
+	httpRoutes.GET("/transactions/export", botWorker.ExportTransactions)
+	httpRoutes.GET("/transactions/queue/:id", botWorker.GetQueuedTransaction)
+	httpRoutes.GET("/usage", botWorker.GetUsage)
+	httpRoutes.POST("/heartbeat", botWorker.Heartbeat)
+	httpRoutes.GET("/sdk/template", SDKTemplateHandler(r))
+	httpRoutes.POST("/orders", botWorker.RequireReady, botWorker.RequireEligible, botWorker.PlaceOrders)
+	httpRoutes.GET("/orders", botWorker.GetOrders)
+	httpRoutes.DELETE("/orders/:id", botWorker.CancelOrders)
+	httpRoutes.PUT("/holdings/:ticker/protection", botWorker.RequireEligible, botWorker.SetProtection)
+	httpRoutes.DELETE("/holdings/:ticker/protection", botWorker.ClearProtection)
+	httpRoutes.POST("/alerts", botWorker.CreateAlert)
+	httpRoutes.GET("/alerts", botWorker.GetAlerts)
+	httpRoutes.GET("/alerts/history", botWorker.GetAlertHistory)
+	httpRoutes.POST("/alerts/history/:id/redeliver", botWorker.RedeliverAlert)
+	httpRoutes.DELETE("/alerts/:id", botWorker.DeleteAlert)
+	httpRoutes.GET("/ws", botWorker.Stream)
+	httpRoutes.POST("/shadows", botWorker.RequireEligible, botWorker.CreateShadow)
+	httpRoutes.GET("/shadows", botWorker.GetShadows)
+	httpRoutes.DELETE("/shadows/:id", botWorker.DeleteShadow)
+	httpRoutes.POST("/reset", botWorker.RequireEligible, botWorker.ResetPortfolio)
+	httpRoutes.GET("/profile", botWorker.GetProfile)
+	httpRoutes.PUT("/profile", botWorker.UpdateProfile)
+	httpRoutes.GET("/notifications", botWorker.GetNotifications)
+	httpRoutes.PUT("/notifications", botWorker.UpdateNotifications)
+	httpRoutes.POST("/api_key/rotate", botWorker.RotateAPIKey)
+	httpRoutes.GET("/announcements", botWorker.GetAnnouncements)
+	httpRoutes.GET("/disqualification", botWorker.GetDisqualification)
+	httpRoutes.POST("/disqualification/appeal", botWorker.AppealDisqualification)
+	httpRoutes.GET("/calendar/earnings", botWorker.GetEarningsCalendar)
+	httpRoutes.PUT("/calendar/blackout", botWorker.SetEarningsBlackout)
+
+	// Spectator keys only reach the routes their scopes allow, and never the bot routes
+	spectatorRoutes := routes.Group("/spectator")
+	spectatorRoutes.Use(botWorker.SpectatorAuthHandler)
+
+	spectatorRoutes.GET("/portfolio", botWorker.RequireScope(models.ScopePortfolio), botWorker.GetSpectatorPortfolio)
+	spectatorRoutes.GET("/competitions/:id/leaderboard", botWorker.RequireScope(models.ScopeLeaderboard), botWorker.GetCompetitionLeaderboard)
+	spectatorRoutes.GET("/daily_stock_data", botWorker.RequireScope(models.ScopeMarketData), botWorker.GetDailyStockData)
+	spectatorRoutes.GET("/live_stock_data", botWorker.RequireScope(models.ScopeMarketData), botWorker.GetLiveStockData)
+	spectatorRoutes.GET("/quote", botWorker.RequireScope(models.ScopeMarketData), botWorker.GetQuotes)
+
+	routes.GET("/metrics", AdminAuthHandler(cfg.AdminKey), botWorker.GetMetrics)
+
+	adminRoutes := routes.Group("/admin")
+	adminRoutes.Use(AdminAuthHandler(cfg.AdminKey))
+
+	adminRoutes.GET("/jobs", botWorker.GetJobs)
+	adminRoutes.POST("/jobs/:name/run", botWorker.RunJob)
+	adminRoutes.GET("/usage", botWorker.GetUsageSummary)
+	adminRoutes.GET("/dashboard", botWorker.GetDashboard)
+	adminRoutes.GET("/dashboard/watchlist", botWorker.GetDashboardWatchlist)
+	adminRoutes.GET("/dashboard/cache", botWorker.GetDashboardCache)
+	adminRoutes.GET("/dashboard/sessions", botWorker.GetDashboardSessions)
+	adminRoutes.GET("/dashboard/bots", botWorker.GetDashboardBots)
+	adminRoutes.GET("/portfolios", botWorker.GetPortfolios)
+	adminRoutes.GET("/datasources", botWorker.GetDataSources)
+	adminRoutes.GET("/indicators", botWorker.GetIndicators)
+	adminRoutes.POST("/indicators/reload", botWorker.ReloadIndicators)
+	adminRoutes.POST("/tickers/bulk", botWorker.OnboardTickers)
+	adminRoutes.GET("/tickers/bulk/:id", botWorker.GetOnboardingJob)
+	adminRoutes.GET("/halts", botWorker.GetHalts)
+	adminRoutes.POST("/halts", botWorker.HaltTrading)
+	adminRoutes.DELETE("/halts", botWorker.ResumeTrading)
+	adminRoutes.POST("/announcements", botWorker.PostAnnouncement)
+	adminRoutes.GET("/market_override", botWorker.GetMarketOverrides)
+	adminRoutes.PUT("/market_override", botWorker.OverrideMarket)
+	adminRoutes.DELETE("/market_override", botWorker.ClearMarketOverride)
+	adminRoutes.GET("/audit", botWorker.GetAuditLog)
+	adminRoutes.GET("/transactions/stream", botWorker.StreamTransactions)
+	adminRoutes.GET("/collusion", botWorker.GetCollusionReport)
+	adminRoutes.GET("/reconciliation", botWorker.GetReconciliationReport)
+	adminRoutes.GET("/reconciliation/flags", botWorker.GetReconciliationFlags)
+	adminRoutes.POST("/reconciliation/flags/:id/review", botWorker.ReviewReconciliationFlag)
+	adminRoutes.GET("/fairness", botWorker.GetFairness)
+	adminRoutes.GET("/integrity", botWorker.GetIntegrity)
+	adminRoutes.POST("/integrity/tickers/:ticker/quarantine", botWorker.QuarantineTicker)
+	adminRoutes.POST("/integrity/tickers/:ticker/rebuild", botWorker.RebuildTicker)
+	adminRoutes.GET("/anomalies", botWorker.GetAnomalies)
+	adminRoutes.POST("/anomalies/:ticker/accept", botWorker.AcceptPriceLevel)
+	adminRoutes.GET("/decisions/:id/replay", botWorker.ReplayOrderDecision)
+	adminRoutes.GET("/migrations", botWorker.GetMigrations)
+	adminRoutes.PUT("/bots/:id/moderation", botWorker.ModerateProfile)
+	adminRoutes.POST("/bots/:id/warn", botWorker.WarnBot)
+	adminRoutes.POST("/bots/:id/disqualify", botWorker.DisqualifyBot)
+	adminRoutes.POST("/bots/:id/uphold", botWorker.UpholdDisqualification)
+	adminRoutes.POST("/bots/:id/reinstate", botWorker.ReinstateBot)
+	adminRoutes.POST("/spectator_keys", botWorker.CreateSpectatorKey)
+	adminRoutes.GET("/spectator_keys", botWorker.GetSpectatorKeys)
+	adminRoutes.DELETE("/spectator_keys/:id", botWorker.RevokeSpectatorKey)
+	adminRoutes.POST("/competitions", botWorker.CreateCompetition)
+	adminRoutes.GET("/competitions", botWorker.GetCompetitions)
+	adminRoutes.PUT("/competitions/:id/ranking", botWorker.SetRankingMetric)
+	adminRoutes.PUT("/competitions/:id/scoring", botWorker.SetScoringRules)
+	adminRoutes.GET("/competitions/:id/digests", botWorker.GetCompetitionDigests)
+	adminRoutes.POST("/competitions/:id/archive", botWorker.ArchiveCompetition)
+	adminRoutes.POST("/competitions/:id/restore", botWorker.RestoreCompetition)
+	adminRoutes.POST("/datasets", botWorker.CreateDataset)
+	adminRoutes.GET("/datasets/:id", botWorker.GetDataset)
+	adminRoutes.GET("/datasets/:id/download", botWorker.DownloadDataset)
+}
+
+// AdminAuthHandler returns middleware that authenticates a request against the admin API key.
+// If no admin key is configured, all admin requests are rejected.
+func AdminAuthHandler(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Authorization")
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			c.AbortWithStatusJSON(401, NewResultPacket("error: invalid admin api key", false))
+			return
+		}
+	}
 }
 
 // DataPacket represents a data packet sent over WebSocket.
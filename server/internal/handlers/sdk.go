@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+// sdkTemplates holds the starter bot template of each language
+var sdkTemplates = template.Must(template.ParseFS(templateFiles, "templates/*.tmpl"))
+
+// sdkLanguage describes the starter bot generated for a language
+type sdkLanguage struct {
+	template    string // Name of the template file
+	filename    string // Name of the generated file
+	contentType string // MIME type of the generated file
+}
+
+// sdkLanguages maps the supported lang query values to their starter bots
+var sdkLanguages = map[string]sdkLanguage{
+	"python": {"python.tmpl", "bot.py", "text/x-python"},
+	"go":     {"go.tmpl", "main.go", "text/x-go"},
+	"js":     {"js.tmpl", "bot.js", "text/javascript"},
+}
+
+// sdkEndpoint is an API endpoint exposed as a client method in the starter bot
+type sdkEndpoint struct {
+	Method  string   // HTTP method
+	Path    string   // Route path with parameters written as :name
+	Params  []string // Names of the path parameters in order
+	HasBody bool     // Whether the endpoint takes a JSON body instead of query parameters
+	words   []string // Words of the method name, such as get, live, stock, data
+}
+
+// PyName returns the snake case method name
+func (e *sdkEndpoint) PyName() string {
+	return strings.Join(e.words, "_")
+}
+
+// GoName returns the exported camel case method name
+func (e *sdkEndpoint) GoName() string {
+	name := ""
+	for _, word := range e.words {
+		name += upperFirst(word)
+	}
+
+	return name
+}
+
+// JSName returns the camel case method name
+func (e *sdkEndpoint) JSName() string {
+	name := e.GoName()
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// PyPath returns the path as the body of a Python f-string
+func (e *sdkEndpoint) PyPath() string {
+	return e.formatPath(func(param string) string { return "{" + param + "}" })
+}
+
+// JSPath returns the path as the body of a JavaScript template literal
+func (e *sdkEndpoint) JSPath() string {
+	return e.formatPath(func(param string) string { return "${" + param + "}" })
+}
+
+// GoPath returns the path as a fmt format string with a %s verb for each parameter
+func (e *sdkEndpoint) GoPath() string {
+	return e.formatPath(func(string) string { return "%s" })
+}
+
+// formatPath replaces every path parameter with its formatted placeholder
+func (e *sdkEndpoint) formatPath(placeholder func(param string) string) string {
+	segments := strings.Split(e.Path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = placeholder(segment[1:])
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// upperFirst capitalizes the first letter of a word
+func upperFirst(word string) string {
+	if word == "" {
+		return word
+	}
+
+	runes := []rune(word)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// sdkExcludedPrefixes are route prefixes that are not exposed to bots in the starter bot
+var sdkExcludedPrefixes = []string{"/admin", "/metrics", "/public", "/sdk", "/ws"}
+
+// sdkEndpoints converts the bot routes under the version prefix of the route table into client methods.
+// Method names are built from the path without the version prefix.
+func sdkEndpoints(routes gin.RoutesInfo, version string) []*sdkEndpoint {
+	endpoints := make([]*sdkEndpoint, 0, len(routes))
+	versioned := versionPrefix(version)
+
+	for _, route := range routes {
+		path, ok := strings.CutPrefix(route.Path, versioned)
+		if !ok || !strings.HasPrefix(path, "/") {
+			continue
+		}
+
+		excluded := false
+		for _, prefix := range sdkExcludedPrefixes {
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				excluded = true
+			}
+		}
+
+		if excluded {
+			continue
+		}
+
+		endpoint := &sdkEndpoint{
+			Method:  route.Method,
+			Path:    route.Path,
+			HasBody: route.Method == http.MethodPost || route.Method == http.MethodPut,
+			words:   []string{strings.ToLower(route.Method)},
+		}
+
+		for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+			if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+				endpoint.Params = append(endpoint.Params, segment[1:])
+				continue
+			}
+
+			endpoint.words = append(endpoint.words, strings.Split(segment, "_")...)
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	sort.Slice(endpoints, func(a, b int) bool {
+		if endpoints[a].Path != endpoints[b].Path {
+			return endpoints[a].Path < endpoints[b].Path
+		}
+
+		return endpoints[a].Method < endpoints[b].Method
+	})
+
+	return endpoints
+}
+
+// sdkTemplateData is the data the starter bot templates are executed with
+type sdkTemplateData struct {
+	BaseURL   string         // URL the server was reached at
+	APIKey    string         // API key of the caller
+	Endpoints []*sdkEndpoint // Bot endpoints of the server
+}
+
+// baseURL returns the URL a request reached the server at
+func baseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	if forwarded := c.GetHeader("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+// SDKTemplateHandler returns a handler that generates a ready to run starter bot
+// wired to the caller's API key and a client method for every bot endpoint of the latest API version of r.
+// @Summary Get starter bot
+// @Description Generates a starter bot in Python, Go or JavaScript with a client for every bot endpoint of the server
+// @Tags sdk
+// @Produce plain
+// @Param lang query string true "Language of the bot: python, go or js"
+// @Success 200 {file} file "Starter bot source"
+// @Failure 400 {object} ResultData "Unknown language"
+// @Failure 401 {object} ResultData "Not authenticated"
+// @Failure 500 {object} ResultData "Server error"
+// @Router /sdk/template [get]
+func SDKTemplateHandler(r *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang, ok := sdkLanguages[c.Query("lang")]
+		if !ok {
+			c.AbortWithStatusJSON(400, NewResultPacket("error: lang must be one of python, go or js", false))
+			return
+		}
+
+		data := &sdkTemplateData{
+			BaseURL:   baseURL(c),
+			APIKey:    c.GetHeader("Authorization"),
+			Endpoints: sdkEndpoints(r.Routes(), LatestVersion),
+		}
+
+		buf := bytes.Buffer{}
+		err := sdkTemplates.ExecuteTemplate(&buf, lang.template, data)
+		if err != nil {
+			c.AbortWithStatusJSON(500, NewResultPacket("error generating template: "+err.Error(), false))
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", lang.filename))
+		c.Data(200, lang.contentType+"; charset=utf-8", buf.Bytes())
+	}
+}
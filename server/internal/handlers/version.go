@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API versions. Unversioned routes serve LegacyVersion and are deprecated.
+const (
+	LegacyVersion = "0" // Unversioned routes
+	Version1      = "1" // Routes under /v1
+	LatestVersion = Version1
+)
+
+// SupportedVersions are the API versions that can be requested with the API-Version header
+var SupportedVersions = []string{Version1}
+
+// Version negotiation headers
+const (
+	VersionHeader = "API-Version" // Requested version on requests, served version on responses
+	versionKey    = "apiVersion"  // Context key of the served version
+)
+
+// legacyDeprecatedAt is when the unversioned routes were deprecated in favor of /v1
+var legacyDeprecatedAt = time.Date(2026, time.October, 17, 0, 0, 0, 0, time.UTC)
+
+// versionPrefix returns the route prefix of an API version
+func versionPrefix(version string) string {
+	return "/v" + version
+}
+
+// unversionedPath returns a route path without the prefix of a supported API version
+func unversionedPath(path string) string {
+	for _, version := range SupportedVersions {
+		if rest, ok := strings.CutPrefix(path, versionPrefix(version)); ok && strings.HasPrefix(rest, "/") {
+			return rest
+		}
+	}
+
+	return path
+}
+
+// APIVersion returns the API version a request is served with
+func APIVersion(c *gin.Context) string {
+	return c.GetString(versionKey)
+}
+
+// VersionHandler returns middleware for the routes of an API version. Requests may repeat
+// the version in the API-Version header, but a header naming another version is rejected.
+func VersionHandler(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requested := c.GetHeader(VersionHeader); requested != "" && requested != version {
+			c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: %s %s conflicts with the /v%s route", VersionHeader, requested, version), false))
+			return
+		}
+
+		c.Set(versionKey, version)
+		c.Header(VersionHeader, version)
+	}
+}
+
+// LegacyVersionHandler returns middleware for the unversioned routes. Requests that name a supported
+// version in the API-Version header are served with that version. Other requests are served the legacy
+// version with Deprecation, Sunset and Link headers pointing to the route of the latest version.
+// A zero sunset omits the Sunset header.
+func LegacyVersionHandler(sunset time.Time) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", legacyDeprecatedAt.Unix())
+	supported := strings.Join(SupportedVersions, ", ")
+
+	return func(c *gin.Context) {
+		if requested := c.GetHeader(VersionHeader); requested != "" {
+			if !slices.Contains(SupportedVersions, requested) {
+				c.AbortWithStatusJSON(400, NewResultPacket(fmt.Sprintf("error: unsupported %s %s, supported versions are %s", VersionHeader, requested, supported), false))
+				return
+			}
+
+			c.Set(versionKey, requested)
+			c.Header(VersionHeader, requested)
+			return
+		}
+
+		c.Set(versionKey, LegacyVersion)
+		c.Header("Deprecation", deprecation)
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+
+		c.Header("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", versionPrefix(LatestVersion), c.Request.URL.Path))
+	}
+}
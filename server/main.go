@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"github.com/gin-gonic/gin"
@@ -12,7 +15,12 @@ import (
 	"google.golang.org/api/option"
 	"urjith.dev/algobattle/internal/bot"
 	"urjith.dev/algobattle/internal/handlers"
+	"urjith.dev/algobattle/pkg/market"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+	"urjith.dev/algobattle/pkg/scheduler"
 	"urjith.dev/algobattle/pkg/services"
+	"urjith.dev/algobattle/pkg/simulator"
 )
 
 func main() {
@@ -23,7 +31,22 @@ func main() {
 
 	ctx := context.Background()
 	opt := option.WithCredentialsFile(os.Getenv("GOOGLE_CREDENTIALS_FILE_PATH"))
-	app, err := firebase.NewApp(ctx, nil, opt)
+
+	// The Firestore client connects to the emulator at FIRESTORE_EMULATOR_HOST when it is set,
+	// which needs a project ID but no credentials
+	var firebaseConfig *firebase.Config
+	firebaseOpt := opt
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+		firebaseConfig = &firebase.Config{ProjectID: os.Getenv("FIRESTORE_PROJECT_ID")}
+		if firebaseConfig.ProjectID == "" {
+			firebaseConfig.ProjectID = "demo-algobattle"
+		}
+
+		firebaseOpt = option.WithoutAuthentication()
+		log.Printf("using the Firestore emulator at %s with project %s\n", host, firebaseConfig.ProjectID)
+	}
+
+	app, err := firebase.NewApp(ctx, firebaseConfig, firebaseOpt)
 	if err != nil {
 		log.Fatalf("error initializing app: %v\n", err)
 	}
@@ -39,11 +62,294 @@ func main() {
 	r.Use(gin.Logger())
 	r.Use(gin.RecoveryWithWriter(os.Stdout))
 
+	// Cash amounts are rounded to CASH_DECIMALS places with the CASH_ROUNDING mode
+	if decimals, rounding := os.Getenv("CASH_DECIMALS"), os.Getenv("CASH_ROUNDING"); decimals != "" || rounding != "" {
+		policy := money.Default()
+		if decimals != "" {
+			policy.Decimals, err = strconv.Atoi(decimals)
+			if err != nil {
+				log.Fatalf("invalid CASH_DECIMALS: %v\n", err)
+			}
+		}
+
+		if rounding != "" {
+			policy.Rounding = money.RoundingMode(rounding)
+		}
+
+		policy, err = money.NewPolicy(policy.Decimals, policy.Rounding)
+		if err != nil {
+			log.Fatalf("invalid cash rounding policy: %v\n", err)
+		}
+
+		money.SetDefault(policy)
+	}
+
+	// Cost basis method of competitions created without one, existing portfolios keep their own
+	if name := os.Getenv("COST_BASIS_METHOD"); name != "" {
+		method, err := models.ParseCostBasisMethod(name)
+		if err != nil {
+			log.Fatalf("invalid COST_BASIS_METHOD: %v\n", err)
+		}
+
+		models.SetDefaultCostBasisMethod(method)
+	}
+
+	// Every data source reports its health and quota usage to the monitor
+	monitor := services.NewSourceMonitor()
+
 	tiingo := services.NewTiingo(os.Getenv("TIINGO_TOKEN"))
+	tiingo.Monitor = monitor
+
+	// Only the most recent years of history are kept in memory, older rows are archived to disk
+	if retention := os.Getenv("HISTORY_RETENTION_YEARS"); retention != "" {
+		tiingo.RetentionYears, err = strconv.Atoi(retention)
+		if err != nil || tiingo.RetentionYears < 0 {
+			log.Fatalf("invalid HISTORY_RETENTION_YEARS: %s\n", retention)
+		}
+	}
+
+	// Indicators are loaded from INDICATORS_CONFIG and can be reloaded with /admin/indicators/reload
+	if path := os.Getenv("INDICATORS_CONFIG"); path != "" {
+		tiingo.IndicatorsPath = path
+		if _, err := tiingo.LoadIndicators(); err != nil {
+			log.Fatalf("error loading indicators: %v\n", err)
+		}
+	}
+
+	sched := scheduler.NewScheduler(time.UTC)
+	defer sched.Stop()
+
+	earnings := services.NewEarningsCalendar(os.Getenv("EARNINGS_TOKEN"))
+	earnings.Monitor = monitor
+
+	// Live prices fail over to a backup Tiingo token while the primary token is down or out of quota
+	primaryPrices := services.NewIEXPrices(services.SourceTiingo, os.Getenv("TIINGO_TOKEN"))
+	priceSources := []services.PriceSource{primaryPrices}
+	if backupToken := os.Getenv("TIINGO_BACKUP_TOKEN"); backupToken != "" {
+		priceSources = append(priceSources, services.NewIEXPrices(services.SourceTiingoBackup, backupToken))
+	}
+
+	// Validated hourly quotas by source, a source without a quota is unlimited
+	quotas := make(map[string]int)
+	for source, name := range map[string]string{
+		services.SourceTiingo:       "TIINGO_HOURLY_QUOTA",
+		services.SourceTiingoBackup: "TIINGO_BACKUP_HOURLY_QUOTA",
+	} {
+		if env := os.Getenv(name); env != "" {
+			quota, err := strconv.Atoi(env)
+			if err != nil || quota < 0 {
+				log.Fatalf("invalid %s: %s\n", name, env)
+			}
+
+			quotas[source] = quota
+			monitor.SetQuota(source, quota)
+		}
+	}
+
+	// Requests kept in reserve for held and ordered tickers once a quota runs low
+	if env := os.Getenv("TIINGO_QUOTA_RESERVE"); env != "" {
+		reserve, err := strconv.Atoi(env)
+		if err != nil || reserve < 0 {
+			log.Fatalf("invalid TIINGO_QUOTA_RESERVE: %s\n", env)
+		}
+
+		monitor.Reserve = reserve
+	}
+
+	// The hourly quota of the Tiingo token is shared between live prices, history, forex and metadata by
+	// priority, and TIINGO_BUDGET_CONFIG can reserve part of it for each of them
+	budgetConfig := services.DefaultBudgetConfig()
+	if path := os.Getenv("TIINGO_BUDGET_CONFIG"); path != "" {
+		budgetConfig, err = services.LoadBudgetConfig(path)
+		if err != nil {
+			log.Fatalf("error loading budget config: %v\n", err)
+		}
+	}
+
+	budget, err := services.NewQuotaBudget(quotas[services.SourceTiingo], budgetConfig)
+	if err != nil {
+		log.Fatalf("invalid TIINGO_BUDGET_CONFIG: %v\n", err)
+	}
+
+	tiingo.Budget = budget
+	primaryPrices.Budget = budget
+
+	// History downloads run on a bounded number of workers and can be spaced out to stay under Tiingo's rate limits
+	if env := os.Getenv("TIINGO_DOWNLOAD_WORKERS"); env != "" {
+		tiingo.DownloadWorkers, err = strconv.Atoi(env)
+		if err != nil || tiingo.DownloadWorkers <= 0 {
+			log.Fatalf("invalid TIINGO_DOWNLOAD_WORKERS: %s\n", env)
+		}
+	}
+
+	if env := os.Getenv("TIINGO_REQUESTS_PER_MINUTE"); env != "" {
+		perMinute, err := strconv.Atoi(env)
+		if err != nil || perMinute < 0 {
+			log.Fatalf("invalid TIINGO_REQUESTS_PER_MINUTE: %s\n", env)
+		}
+
+		tiingo.Limiter = services.NewRateLimiter()
+		tiingo.Limiter.SetRate(services.SourceTiingo, perMinute)
+	}
+
+	// A simulated market replaces Tiingo for history, listings and live prices, so demos run offline
+	if path := os.Getenv("SIMULATOR_CONFIG"); path != "" {
+		config, err := simulator.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("error loading simulator config: %v\n", err)
+		}
+
+		simulated, err := simulator.New(config, time.Now())
+		if err != nil {
+			log.Fatalf("error creating simulated market: %v\n", err)
+		}
+
+		tiingo.Source = simulated
+		tiingo.AddTickers(simulated.Tickers()...)
+		priceSources = []services.PriceSource{simulated}
+		log.Printf("simulating %d tickers from %s\n", len(config.Tickers), path)
+	}
+
+	prices := services.NewPriceFeed(monitor, priceSources...)
+
+	// Exchange rates convert amounts to display currencies and are cached for FX_CACHE_MINUTES
+	fx := services.NewFXRates(os.Getenv("TIINGO_TOKEN"))
+	fx.Monitor = monitor
+	fx.Budget = budget
+	if env := os.Getenv("FX_CACHE_MINUTES"); env != "" {
+		minutes, err := strconv.Atoi(env)
+		if err != nil || minutes <= 0 {
+			log.Fatalf("invalid FX_CACHE_MINUTES: %s\n", env)
+		}
 
-	botworker := bot.NewBotWorker(db, tiingo)
+		fx.TTL = time.Duration(minutes) * time.Minute
+	}
+
+	// Transaction and valuation events are published to PUBSUB_TOPIC when it is set
+	var pubsub *services.PubSub
+	if topic := os.Getenv("PUBSUB_TOPIC"); topic != "" {
+		pubsub, err = services.NewPubSub(ctx, topic, opt)
+		if err != nil {
+			log.Fatalf("invalid PUBSUB_TOPIC: %v\n", err)
+		}
+	}
 
-	handlers.SetupRoutes(r, botworker)
+	// Email notifications are sent with MAIL_PROVIDER when it is set
+	var mailer services.Mailer
+	if provider := os.Getenv("MAIL_PROVIDER"); provider != "" {
+		mailer, err = services.NewMailer(provider, os.Getenv("MAIL_FROM"), map[string]string{
+			"host":     os.Getenv("SMTP_HOST"),
+			"port":     os.Getenv("SMTP_PORT"),
+			"username": os.Getenv("SMTP_USERNAME"),
+			"password": os.Getenv("SMTP_PASSWORD"),
+			"api_key":  os.Getenv("SENDGRID_API_KEY"),
+		})
+		if err != nil {
+			log.Fatalf("invalid MAIL_PROVIDER: %v\n", err)
+		}
+	}
+
+	// Finished competitions are archived to ARCHIVE_BUCKET when it is set
+	var archive *services.ColdStorage
+	if bucket := os.Getenv("ARCHIVE_BUCKET"); bucket != "" {
+		archive, err = services.NewColdStorage(ctx, bucket, opt)
+		if err != nil {
+			log.Fatalf("invalid ARCHIVE_BUCKET: %v\n", err)
+		}
+	}
+
+	// Pre-market and after-hours sessions are optional and can have their own trading costs
+	extended := market.ExtendedHours{Enabled: os.Getenv("EXTENDED_HOURS") == "true"}
+	for name, value := range map[string]*float64{
+		"EXTENDED_FEE_BPS":      &extended.FeeBps,
+		"EXTENDED_SLIPPAGE_BPS": &extended.SlippageBps,
+	} {
+		if env := os.Getenv(name); env != "" {
+			*value, err = strconv.ParseFloat(env, 64)
+			if err != nil {
+				log.Fatalf("invalid %s: %v\n", name, err)
+			}
+		}
+	}
 
-	r.Run(":8080")
+	markets, err := market.NewRegistry(extended)
+	if err != nil {
+		log.Fatalf("error creating exchanges: %v\n", err)
+	}
+
+	// Exchange calendars, such as holidays or additional exchanges, can be loaded from a file
+	if calendarFile := os.Getenv("MARKET_CALENDAR_FILE"); calendarFile != "" {
+		err = markets.LoadCalendar(calendarFile)
+		if err != nil {
+			log.Fatalf("error loading market calendar: %v\n", err)
+		}
+	}
+
+	err = bot.RegisterValidators()
+	if err != nil {
+		log.Fatalf("error registering request validators: %v\n", err)
+	}
+
+	// Collection names can be prefixed, so staging and tests can share a project with production
+	collections, err := bot.NewCollections(os.Getenv("FIRESTORE_COLLECTION_PREFIX"))
+	if err != nil {
+		log.Fatalf("invalid FIRESTORE_COLLECTION_PREFIX: %v\n", err)
+	}
+
+	botworker, err := bot.NewBotWorker(db, tiingo, prices, bot.NewPortfolioStore(db, collections), bot.NewOrderBook(), earnings, fx, pubsub, mailer, archive, collections, markets, sched)
+	if err != nil {
+		log.Fatalf("error initializing bot worker: %v\n", err)
+	}
+
+	routesConfig := &handlers.Config{
+		AdminKey: os.Getenv("ADMIN_API_KEY"),
+	}
+
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
+		routesConfig.CORS = handlers.DefaultCORSConfig(strings.Split(origins, ",")...)
+
+		if maxAge := os.Getenv("CORS_MAX_AGE"); maxAge != "" {
+			routesConfig.CORS.MaxAge, err = time.ParseDuration(maxAge)
+			if err != nil {
+				log.Fatalf("invalid CORS_MAX_AGE: %v\n", err)
+			}
+		}
+	}
+
+	// Unversioned routes announce when they will be removed in favor of /v1
+	if sunset := os.Getenv("LEGACY_ROUTES_SUNSET"); sunset != "" {
+		routesConfig.LegacySunset, err = time.Parse(time.DateOnly, sunset)
+		if err != nil {
+			log.Fatalf("invalid LEGACY_ROUTES_SUNSET: %v\n", err)
+		}
+	}
+
+	// Fault injection is only for testing bots against a flaky server before the competition
+	if chaosFile := os.Getenv("CHAOS_CONFIG_FILE"); chaosFile != "" {
+		if gin.Mode() == gin.ReleaseMode {
+			log.Fatalf("CHAOS_CONFIG_FILE must not be set in release mode\n")
+		}
+
+		routesConfig.Chaos, err = handlers.LoadChaosConfig(chaosFile)
+		if err != nil {
+			log.Fatalf("error loading chaos config: %v\n", err)
+		}
+
+		log.Printf("chaos mode enabled from %s\n", chaosFile)
+	}
+
+	handlers.SetupRoutes(r, botworker, routesConfig)
+
+	// Serve HTTP/2 over TLS when a certificate is configured, and cleartext HTTP/2 (h2c) otherwise
+	r.UseH2C = true
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile != "" && keyFile != "" {
+		err = r.RunTLS(":8080", certFile, keyFile)
+	} else {
+		err = r.Run(":8080")
+	}
+
+	if err != nil {
+		log.Printf("error running server: %v\n", err)
+	}
 }
@@ -0,0 +1,235 @@
+package export
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Kinds of archive records
+const (
+	ArchiveManifest     = "manifest"       // First record, describes the archive
+	ArchiveCompetition  = "competition"    // The competition document
+	ArchiveBot          = "bot"            // A bot of the competition
+	ArchiveShadow       = "shadow"         // A shadow portfolio of a bot
+	ArchiveTransaction  = "transaction"    // A transaction of a bot or shadow portfolio
+	ArchiveDecision     = "order_decision" // An order decision of a bot or shadow portfolio
+	ArchiveOrderGroup   = "order_group"    // A conditional order group of a bot
+	ArchiveAlert        = "price_alert"    // A waiting price alert of a bot
+	ArchiveAlertHistory = "alert_history"  // A triggered price alert of a bot with its webhook deliveries
+	ArchiveDigest       = "digest"         // A daily digest of the competition
+	ArchiveStanding     = "standing"       // A daily leaderboard snapshot of a bot, not a document
+)
+
+// ArchiveManifestData describes a competition archive
+type ArchiveManifestData struct {
+	Competition string         `json:"competition"` // ID of the archived competition
+	CreatedAt   time.Time      `json:"createdAt"`   // When the archive was written
+	Records     map[string]int `json:"records"`     // Number of records of each kind
+}
+
+// ArchiveRecord is a line of a competition archive. Documents keep their path relative to the database root
+// and their fields in a JSON encoding that preserves integers, times, bytes and document references.
+type ArchiveRecord struct {
+	Kind string         `json:"kind"`           // Kind of the record
+	Path string         `json:"path,omitempty"` // Path of the document, empty for records that are not documents
+	Data map[string]any `json:"data"`           // Encoded fields of the document, or the data of other records
+}
+
+// ArchiveWriter writes archive records as newline delimited JSON
+type ArchiveWriter struct {
+	encoder *json.Encoder
+	Counts  map[string]int // Number of records written of each kind
+}
+
+// NewArchiveWriter creates a writer of archive records
+func NewArchiveWriter(w io.Writer) *ArchiveWriter {
+	return &ArchiveWriter{encoder: json.NewEncoder(w), Counts: make(map[string]int)}
+}
+
+// WriteDocument writes a Firestore document as a record of a kind
+func (aw *ArchiveWriter) WriteDocument(kind string, doc *firestore.DocumentSnapshot) error {
+	return aw.write(&ArchiveRecord{Kind: kind, Path: relativePath(doc.Ref), Data: encodeFields(doc.Data())})
+}
+
+// WriteData writes a record that is not a document, data is encoded through its JSON representation
+func (aw *ArchiveWriter) WriteData(kind string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]any)
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return err
+	}
+
+	return aw.write(&ArchiveRecord{Kind: kind, Data: fields})
+}
+
+// write writes a record and counts it
+func (aw *ArchiveWriter) write(record *ArchiveRecord) error {
+	aw.Counts[record.Kind]++
+	return aw.encoder.Encode(record)
+}
+
+// ReadArchive reads the records of an archive in order and passes each to fn.
+// Document fields are decoded back to Firestore values, with references resolved against db.
+func ReadArchive(r io.Reader, db *firestore.Client, fn func(*ArchiveRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+		decoder.UseNumber()
+
+		record := &ArchiveRecord{}
+		err := decoder.Decode(record)
+		if err != nil {
+			return fmt.Errorf("error parsing line %d: %v", line, err)
+		}
+
+		if record.Path != "" {
+			record.Data, err = decodeFields(record.Data, db)
+			if err != nil {
+				return fmt.Errorf("error decoding %s on line %d: %v", record.Path, line, err)
+			}
+		}
+
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// relativePath returns the path of a document relative to the database root, such as "bots/abc123"
+func relativePath(ref *firestore.DocumentRef) string {
+	if _, path, ok := strings.Cut(ref.Path, "/documents/"); ok {
+		return path
+	}
+
+	return ref.Path
+}
+
+// encodeFields encodes the fields of a document
+func encodeFields(fields map[string]any) map[string]any {
+	encoded := make(map[string]any, len(fields))
+	for key, value := range fields {
+		encoded[key] = encodeValue(value)
+	}
+
+	return encoded
+}
+
+// encodeValue encodes a Firestore value. Types JSON cannot tell apart are wrapped in an object with a single key.
+func encodeValue(value any) any {
+	switch v := value.(type) {
+	case int64:
+		return map[string]any{"$int": v}
+	case time.Time:
+		return map[string]any{"$time": v.UTC().Format(time.RFC3339Nano)}
+	case []byte:
+		return map[string]any{"$bytes": base64.StdEncoding.EncodeToString(v)}
+	case *firestore.DocumentRef:
+		if v == nil {
+			return nil
+		}
+
+		return map[string]any{"$ref": relativePath(v)}
+	case map[string]any:
+		return map[string]any{"$map": encodeFields(v)}
+	case []any:
+		values := make([]any, len(v))
+		for i, element := range v {
+			values[i] = encodeValue(element)
+		}
+
+		return values
+	default:
+		return v
+	}
+}
+
+// decodeFields decodes the fields of a document
+func decodeFields(fields map[string]any, db *firestore.Client) (map[string]any, error) {
+	decoded := make(map[string]any, len(fields))
+	for key, value := range fields {
+		var err error
+		decoded[key], err = decodeValue(value, db)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", key, err)
+		}
+	}
+
+	return decoded, nil
+}
+
+// decodeValue decodes a value encoded by encodeValue
+func decodeValue(value any, db *firestore.Client) (any, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case []any:
+		values := make([]any, len(v))
+		for i, element := range v {
+			var err error
+			values[i], err = decodeValue(element, db)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return values, nil
+	case map[string]any:
+		if len(v) != 1 {
+			return nil, fmt.Errorf("invalid encoded value")
+		}
+
+		for kind, inner := range v {
+			switch kind {
+			case "$int":
+				number, ok := inner.(json.Number)
+				if !ok {
+					return nil, fmt.Errorf("invalid integer")
+				}
+
+				return number.Int64()
+			case "$time":
+				text, _ := inner.(string)
+				return time.Parse(time.RFC3339Nano, text)
+			case "$bytes":
+				text, _ := inner.(string)
+				return base64.StdEncoding.DecodeString(text)
+			case "$ref":
+				path, _ := inner.(string)
+				ref := db.Doc(path)
+				if ref == nil {
+					return nil, fmt.Errorf("invalid document path %q", path)
+				}
+
+				return ref, nil
+			case "$map":
+				fields, ok := inner.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("invalid map")
+				}
+
+				return decodeFields(fields, db)
+			}
+		}
+
+		return nil, fmt.Errorf("invalid encoded value")
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,230 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Files of a dataset archive
+const (
+	manifestFile     = "manifest.json"
+	pricesFile       = "prices.csv"
+	transactionsFile = "transactions.csv"
+	standingsFile    = "standings.csv"
+)
+
+// DatasetManifest describes the contents of a dataset archive
+type DatasetManifest struct {
+	ID           string    `json:"id"`           // ID of the dataset
+	Competition  string    `json:"competition"`  // ID of the exported competition, empty for every bot
+	CreatedAt    time.Time `json:"createdAt"`    // When the dataset was generated
+	Start        time.Time `json:"start"`        // First date of the exported period
+	End          time.Time `json:"end"`          // Last date of the exported period
+	Bots         int       `json:"bots"`         // Number of bots
+	Transactions int       `json:"transactions"` // Number of transactions
+	Tickers      []string  `json:"tickers"`      // Tickers whose prices are included
+	Files        []string  `json:"files"`        // Files in the archive
+}
+
+// DatasetTransaction is a transaction of an anonymized bot
+type DatasetTransaction struct {
+	Bot         string              // Anonymized name of the bot
+	Transaction *models.Transaction // The transaction
+}
+
+// StandingSnapshot is the account value and rank of an anonymized bot at the end of a day
+type StandingSnapshot struct {
+	Date  time.Time // Day of the snapshot
+	Bot   string    // Anonymized name of the bot
+	Value float64   // Account value at the end of the day
+	Rank  int       // Rank by account value among the bots valued that day, starting at 1
+}
+
+// Dataset is a season of price history, transactions and standings for training or analysis
+type Dataset struct {
+	Manifest     *DatasetManifest
+	Prices       []*models.Row
+	Transactions []DatasetTransaction
+	Standings    []StandingSnapshot
+}
+
+// Standings ranks the daily account values of bots, keyed by anonymized bot name.
+// Snapshots are ordered by day and then by rank.
+func Standings(histories map[string][]*models.AccountValueHistory) []StandingSnapshot {
+	days := make(map[time.Time][]StandingSnapshot)
+	for bot, history := range histories {
+		for _, value := range history {
+			day := value.Date.UTC().Truncate(24 * time.Hour)
+			days[day] = append(days[day], StandingSnapshot{Date: day, Bot: bot, Value: value.Value})
+		}
+	}
+
+	standings := make([]StandingSnapshot, 0)
+	for _, snapshots := range days {
+		sort.Slice(snapshots, func(a, b int) bool {
+			if snapshots[a].Value != snapshots[b].Value {
+				return snapshots[a].Value > snapshots[b].Value
+			}
+
+			return snapshots[a].Bot < snapshots[b].Bot
+		})
+
+		for i := range snapshots {
+			snapshots[i].Rank = i + 1
+		}
+
+		standings = append(standings, snapshots...)
+	}
+
+	sort.Slice(standings, func(a, b int) bool {
+		if !standings[a].Date.Equal(standings[b].Date) {
+			return standings[a].Date.Before(standings[b].Date)
+		}
+
+		return standings[a].Rank < standings[b].Rank
+	})
+
+	return standings
+}
+
+// WriteDataset writes a dataset as a zip archive of a JSON manifest and CSV files
+func WriteDataset(w io.Writer, dataset *Dataset) error {
+	archive := zip.NewWriter(w)
+
+	dataset.Manifest.Files = []string{manifestFile, pricesFile, transactionsFile, standingsFile}
+	file, err := archive.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(dataset.Manifest)
+	if err != nil {
+		return err
+	}
+
+	writers := []struct {
+		name  string
+		write func(*csv.Writer) error
+	}{
+		{pricesFile, func(writer *csv.Writer) error { return writePrices(writer, dataset.Prices, dataset.Manifest.Tickers) }},
+		{transactionsFile, func(writer *csv.Writer) error { return writeDatasetTransactions(writer, dataset.Transactions) }},
+		{standingsFile, func(writer *csv.Writer) error { return writeStandings(writer, dataset.Standings) }},
+	}
+
+	for _, entry := range writers {
+		file, err := archive.Create(entry.name)
+		if err != nil {
+			return err
+		}
+
+		writer := csv.NewWriter(file)
+		err = entry.write(writer)
+		if err != nil {
+			return err
+		}
+
+		writer.Flush()
+		if err = writer.Error(); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writePrices writes the daily prices of the tickers, one row per ticker and day
+func writePrices(writer *csv.Writer, rows []*models.Row, tickers []string) error {
+	err := writer.Write([]string{"date", "ticker", "open", "high", "low", "close", "volume", "adjOpen", "adjHigh", "adjLow", "adjClose", "adjVolume", "divCash", "splitFactor"})
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		for _, ticker := range tickers {
+			period, ok := row.Data.Load(ticker)
+			if !ok {
+				continue
+			}
+
+			err = writer.Write([]string{
+				row.Date.UTC().Format(time.DateOnly),
+				ticker,
+				formatFloat(period.Open),
+				formatFloat(period.High),
+				formatFloat(period.Low),
+				formatFloat(period.Close),
+				strconv.FormatInt(period.Volume, 10),
+				formatFloat(period.AdjOpen),
+				formatFloat(period.AdjHigh),
+				formatFloat(period.AdjLow),
+				formatFloat(period.AdjClose),
+				strconv.FormatInt(period.AdjVolume, 10),
+				formatFloat(period.DivCash),
+				formatFloat(period.SplitFactor),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeDatasetTransactions writes the transactions of every bot
+func writeDatasetTransactions(writer *csv.Writer, transactions []DatasetTransaction) error {
+	err := writer.Write([]string{"time", "bot", "action", "ticker", "numShares", "unitCost", "fee", "session"})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range transactions {
+		transaction := entry.Transaction
+		err = writer.Write([]string{
+			transaction.Time.UTC().Format(time.RFC3339),
+			entry.Bot,
+			transaction.Action,
+			transaction.Ticker,
+			formatFloat(transaction.NumShares),
+			formatFloat(transaction.UnitCost),
+			formatFloat(transaction.Fee),
+			transaction.Session,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeStandings writes the daily standings
+func writeStandings(writer *csv.Writer, standings []StandingSnapshot) error {
+	err := writer.Write([]string{"date", "bot", "accountValue", "rank"})
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range standings {
+		err = writer.Write([]string{
+			snapshot.Date.Format(time.DateOnly),
+			snapshot.Bot,
+			formatFloat(snapshot.Value),
+			strconv.Itoa(snapshot.Rank),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
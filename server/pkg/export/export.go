@@ -0,0 +1,292 @@
+// Package export writes transactions in formats that brokerage tools and portfolio
+// trackers can import, so participants can analyse their simulated season elsewhere.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// Format is a transaction export format
+type Format string
+
+// Supported export formats
+const (
+	CSV Format = "csv" // Broker style CSV with one trade per row
+	QIF Format = "qif" // Quicken Interchange Format investment register
+	OFX Format = "ofx" // Open Financial Exchange 2 investment statement
+)
+
+// Currency is the default currency of an OFX statement, every row of a CSV export names its own currency
+const Currency = money.BaseCurrency
+
+// Record is a transaction with the ID of its document
+type Record struct {
+	ID          string              // ID of the transaction document
+	Transaction *models.Transaction // The exported transaction
+}
+
+// ParseFormat validates the name of an export format. An empty name selects CSV.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case "":
+		return CSV, nil
+	case CSV, QIF, OFX:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, expected one of csv, qif or ofx", name)
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case QIF:
+		return "application/qif"
+	case OFX:
+		return "application/x-ofx"
+	default:
+		return "text/csv"
+	}
+}
+
+// Write writes the records of an account in the given format
+func Write(w io.Writer, format Format, account string, records []Record) error {
+	switch format {
+	case QIF:
+		return writeQIF(w, records)
+	case OFX:
+		return writeOFX(w, account, records)
+	default:
+		return writeCSV(w, records)
+	}
+}
+
+// amount returns the signed cash movement of a transaction after fees,
+// negative for buys and positive for sells
+func amount(transaction *models.Transaction) float64 {
+	policy := money.Default()
+	if transaction.Action == "sell" {
+		return policy.Sub(transaction.Value(), transaction.Fee)
+	}
+
+	return -policy.Add(transaction.Value(), transaction.Fee)
+}
+
+// formatFloat formats a number without trailing zeros or an exponent
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// writeCSV writes the records as broker style CSV
+func writeCSV(w io.Writer, records []Record) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write([]string{"Date", "Time", "Action", "Symbol", "Quantity", "Price", "Fees", "Amount", "Currency", "Session", "Transaction ID"})
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		transaction := record.Transaction
+		executed := transaction.Time.UTC()
+
+		err = writer.Write([]string{
+			executed.Format(time.DateOnly),
+			executed.Format(time.TimeOnly),
+			strings.ToUpper(transaction.Action),
+			transaction.Ticker,
+			formatFloat(transaction.NumShares),
+			formatFloat(transaction.UnitCost),
+			formatFloat(transaction.Fee),
+			formatFloat(amount(transaction)),
+			transaction.CurrencyOfRecord(),
+			transaction.Session,
+			record.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeQIF writes the records as a QIF investment register
+func writeQIF(w io.Writer, records []Record) error {
+	builder := strings.Builder{}
+	builder.WriteString("!Type:Invst\n")
+
+	for _, record := range records {
+		transaction := record.Transaction
+		action := "Buy"
+		if transaction.Action == "sell" {
+			action = "Sell"
+		}
+
+		total := amount(transaction)
+		if total < 0 {
+			total = -total
+		}
+
+		fmt.Fprintf(&builder, "D%s\n", transaction.Time.UTC().Format("01/02/2006"))
+		fmt.Fprintf(&builder, "N%s\n", action)
+		fmt.Fprintf(&builder, "Y%s\n", transaction.Ticker)
+		fmt.Fprintf(&builder, "I%s\n", formatFloat(transaction.UnitCost))
+		fmt.Fprintf(&builder, "Q%s\n", formatFloat(transaction.NumShares))
+		fmt.Fprintf(&builder, "O%s\n", formatFloat(transaction.Fee))
+		fmt.Fprintf(&builder, "T%s\n", formatFloat(total))
+		fmt.Fprintf(&builder, "M%s\n", record.ID)
+		builder.WriteString("^\n")
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// ofxTime formats a time in the OFX date format
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+// OFX document structure, limited to the elements of an investment statement
+type (
+	ofxDocument struct {
+		XMLName xml.Name  `xml:"OFX"`
+		SignOn  ofxSignOn `xml:"SIGNONMSGSRSV1>SONRS"`
+		Invest  ofxInvest `xml:"INVSTMTMSGSRSV1>INVSTMTTRNRS"`
+	}
+
+	ofxStatus struct {
+		Code     int    `xml:"CODE"`
+		Severity string `xml:"SEVERITY"`
+	}
+
+	ofxSignOn struct {
+		Status   ofxStatus `xml:"STATUS"`
+		DTServer string    `xml:"DTSERVER"`
+		Language string    `xml:"LANGUAGE"`
+	}
+
+	ofxInvest struct {
+		TrnUID string       `xml:"TRNUID"`
+		Status ofxStatus    `xml:"STATUS"`
+		Stmt   ofxStatement `xml:"INVSTMTRS"`
+	}
+
+	ofxStatement struct {
+		DTAsOf    string         `xml:"DTASOF"`
+		Currency  string         `xml:"CURDEF"`
+		BrokerID  string         `xml:"INVACCTFROM>BROKERID"`
+		AccountID string         `xml:"INVACCTFROM>ACCTID"`
+		DTStart   string         `xml:"INVTRANLIST>DTSTART"`
+		DTEnd     string         `xml:"INVTRANLIST>DTEND"`
+		Buys      []ofxBuyStock  `xml:"INVTRANLIST>BUYSTOCK"`
+		Sells     []ofxSellStock `xml:"INVTRANLIST>SELLSTOCK"`
+	}
+
+	ofxTrade struct {
+		FitID       string `xml:"INVTRAN>FITID"`
+		DTTrade     string `xml:"INVTRAN>DTTRADE"`
+		UniqueID    string `xml:"SECID>UNIQUEID"`
+		IDType      string `xml:"SECID>UNIQUEIDTYPE"`
+		Units       string `xml:"UNITS"`
+		UnitPrice   string `xml:"UNITPRICE"`
+		Commission  string `xml:"COMMISSION"`
+		Total       string `xml:"TOTAL"`
+		SubAcctSec  string `xml:"SUBACCTSEC"`
+		SubAcctFund string `xml:"SUBACCTFUND"`
+	}
+
+	ofxBuyStock struct {
+		Trade   ofxTrade `xml:"INVBUY"`
+		BuyType string   `xml:"BUYTYPE"`
+	}
+
+	ofxSellStock struct {
+		Trade    ofxTrade `xml:"INVSELL"`
+		SellType string   `xml:"SELLTYPE"`
+	}
+)
+
+// writeOFX writes the records as an OFX 2 investment statement
+func writeOFX(w io.Writer, account string, records []Record) error {
+	now := time.Now()
+
+	// Every transaction of a portfolio is in its currency of record
+	currency := Currency
+	if len(records) > 0 {
+		currency = records[0].Transaction.CurrencyOfRecord()
+	}
+
+	statement := ofxStatement{
+		DTAsOf:    ofxTime(now),
+		Currency:  currency,
+		BrokerID:  "algobattle",
+		AccountID: account,
+		DTStart:   ofxTime(now),
+		DTEnd:     ofxTime(now),
+	}
+
+	for i, record := range records {
+		transaction := record.Transaction
+		if i == 0 {
+			statement.DTStart = ofxTime(transaction.Time)
+		}
+
+		units := transaction.NumShares
+		if transaction.Action == "sell" {
+			units = -units
+		}
+
+		trade := ofxTrade{
+			FitID:       record.ID,
+			DTTrade:     ofxTime(transaction.Time),
+			UniqueID:    transaction.Ticker,
+			IDType:      "TICKER",
+			Units:       formatFloat(units),
+			UnitPrice:   formatFloat(transaction.UnitCost),
+			Commission:  formatFloat(transaction.Fee),
+			Total:       formatFloat(amount(transaction)),
+			SubAcctSec:  "CASH",
+			SubAcctFund: "CASH",
+		}
+
+		if transaction.Action == "sell" {
+			statement.Sells = append(statement.Sells, ofxSellStock{trade, "SELL"})
+		} else {
+			statement.Buys = append(statement.Buys, ofxBuyStock{trade, "BUY"})
+		}
+	}
+
+	document := ofxDocument{
+		SignOn: ofxSignOn{
+			Status:   ofxStatus{0, "INFO"},
+			DTServer: ofxTime(now),
+			Language: "ENG",
+		},
+		Invest: ofxInvest{
+			TrnUID: "0",
+			Status: ofxStatus{0, "INFO"},
+			Stmt:   statement,
+		},
+	}
+
+	_, err := io.WriteString(w, xml.Header+`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`+"\n")
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(document)
+}
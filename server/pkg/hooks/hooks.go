@@ -0,0 +1,118 @@
+// Package hooks lets operators add custom competition rules to the execution engine without
+// changing the transaction handlers. A rule module implements TradeHook, registers a factory
+// under a name from an init function, and is enabled by listing it in the hooks file.
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// TradeHook is a custom competition rule. Hooks must not modify the portfolio or transaction they are given.
+type TradeHook interface {
+	// ValidateTrade is called before the built-in rules check a trade, including order fills, protection
+	// sales and trade analyses. Returning an error rejects the trade with the error as its reason.
+	ValidateTrade(ctx context.Context, portfolio *models.Portfolio, transaction *models.Transaction) error
+
+	// AfterFill is called once a trade was executed and stored, with the portfolio after the trade.
+	// Errors are logged, the trade is not undone.
+	AfterFill(ctx context.Context, portfolio *models.Portfolio, transaction *models.Transaction) error
+}
+
+// Factory creates a hook from its configuration in the hooks file, which is null if it has none
+type Factory func(config json.RawMessage) (TradeHook, error)
+
+// Hook is an enabled hook with the name it was registered under
+type Hook struct {
+	Name string
+	TradeHook
+}
+
+var (
+	mu        sync.Mutex
+	factories = make(map[string]Factory)
+)
+
+// Register makes a hook available under a name. It panics if the name is registered twice,
+// so it should be called from the init function of the module that implements the hook.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("hooks: %s registered twice", name))
+	}
+
+	factories[name] = factory
+}
+
+// Registered returns the names of every registered hook, sorted
+func Registered() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// HookConfig enables a hook in the hooks file
+type HookConfig struct {
+	Name   string          `json:"name"`   // Name the hook was registered under
+	Config json.RawMessage `json:"config"` // Configuration passed to the hook's factory
+}
+
+// New creates the hooks of a list of configurations, in order
+func New(configs []HookConfig) ([]*Hook, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	enabled := make([]*Hook, 0, len(configs))
+	seen := make(map[string]bool, len(configs))
+	for _, config := range configs {
+		factory, ok := factories[config.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown hook %q", config.Name)
+		}
+
+		if seen[config.Name] {
+			return nil, fmt.Errorf("hook %q is enabled twice", config.Name)
+		}
+
+		seen[config.Name] = true
+		hook, err := factory(config.Config)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring hook %s: %v", config.Name, err)
+		}
+
+		enabled = append(enabled, &Hook{Name: config.Name, TradeHook: hook})
+	}
+
+	return enabled, nil
+}
+
+// Load creates the hooks enabled in a JSON file holding an array of hook configurations
+func Load(path string) ([]*Hook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]HookConfig, 0)
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	return New(configs)
+}
@@ -0,0 +1,60 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+func init() {
+	Register("max_position", newMaxPosition)
+}
+
+// MaxPosition rejects buys that would make a single position larger than a percentage of the account value,
+// forcing bots to diversify. The position is valued at the price of the trade against the last calculated account value.
+type MaxPosition struct {
+	Percent float64 `json:"percent"` // Largest share of the account value one ticker may have, in percent
+}
+
+// newMaxPosition creates a MaxPosition hook from its configuration
+func newMaxPosition(config json.RawMessage) (TradeHook, error) {
+	hook := &MaxPosition{}
+	if len(config) > 0 {
+		err := json.Unmarshal(config, hook)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if hook.Percent <= 0 || hook.Percent > 100 {
+		return nil, fmt.Errorf("percent must be greater than 0 and at most 100, got %v", hook.Percent)
+	}
+
+	return hook, nil
+}
+
+// ValidateTrade checks the size of the position after a buy
+func (mp *MaxPosition) ValidateTrade(ctx context.Context, portfolio *models.Portfolio, transaction *models.Transaction) error {
+	if transaction.Action != "buy" || portfolio.AccountValue <= 0 {
+		return nil
+	}
+
+	shares := transaction.NumShares
+	if holding, ok := portfolio.Holdings[transaction.Ticker]; ok {
+		shares += holding.NumShares
+	}
+
+	weight := shares * transaction.UnitCost / portfolio.AccountValue * 100
+	if weight > mp.Percent {
+		return fmt.Errorf("a position of %.1f%% in %s exceeds the limit of %v%% of the account value", weight, transaction.Ticker, mp.Percent)
+	}
+
+	return nil
+}
+
+// AfterFill does nothing, the limit only applies before a trade
+func (mp *MaxPosition) AfterFill(ctx context.Context, portfolio *models.Portfolio, transaction *models.Transaction) error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package indicators
+
+import (
+	"fmt"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Beta represents the beta of a ticker against a benchmark ticker, the covariance of their daily returns
+// divided by the variance of the benchmark's returns over a rolling window
+type Beta struct {
+	Benchmark    string
+	PeriodLength int
+}
+
+// Name returns the name of the indicator
+func (b *Beta) Name() string {
+	return fmt.Sprintf("BETA %s %d", symbols.Canonical(b.Benchmark), b.PeriodLength)
+}
+
+// Apply applies the beta indicator to the rows of the series. Returns are paired between consecutive rows with data
+// of both the ticker and the benchmark, so days only one of them traded are skipped. Values are only set once
+// a full period of paired returns is available and the benchmark moved within the period.
+func (b *Beta) Apply(series Series) {
+	rows, closes, benchmarks := pairedCloses(series, b.Benchmark)
+	tickerReturns := make([]float64, 0, len(rows))
+	benchmarkReturns := make([]float64, 0, len(rows))
+
+	for k := 1; k < len(rows); k++ {
+		tickerReturns = append(tickerReturns, closes[k]/closes[k-1]-1)
+		benchmarkReturns = append(benchmarkReturns, benchmarks[k]/benchmarks[k-1]-1)
+
+		if n := len(tickerReturns); n >= b.PeriodLength {
+			if beta, ok := regressionSlope(tickerReturns[n-b.PeriodLength:], benchmarkReturns[n-b.PeriodLength:]); ok {
+				series.Set(rows[k], beta)
+			}
+		}
+	}
+}
+
+// regressionSlope returns the covariance of ys and xs divided by the variance of xs, false if xs do not vary
+func regressionSlope(ys, xs []float64) (float64, bool) {
+	meanX, meanY := 0.0, 0.0
+	for i := range xs {
+		meanX += xs[i] / float64(len(xs))
+		meanY += ys[i] / float64(len(ys))
+	}
+
+	covariance, variance := 0.0, 0.0
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+
+	if variance == 0 {
+		return 0, false
+	}
+
+	return covariance / variance, true
+}
@@ -0,0 +1,173 @@
+package indicators
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Indicator types that can be used in a config file
+const (
+	TypeEMA        = "ema"
+	TypeMACD       = "macd"
+	TypeRSI        = "rsi"
+	TypeVolatility = "volatility"
+	TypeBeta       = "beta"
+	TypeRelative   = "relative_strength"
+	TypeSpread     = "spread"
+)
+
+// defaultSmoothing is the EMA smoothing factor used when a config omits it
+const defaultSmoothing = 2
+
+// Spec describes a single indicator of a config file
+type Spec struct {
+	Type        string `json:"type" yaml:"type"`                                   // Indicator type, "ema", "macd", "rsi", "volatility", "beta", "relative_strength" or "spread"
+	Smoothing   int    `json:"smoothing,omitempty" yaml:"smoothing,omitempty"`     // EMA smoothing factor, defaults to 2
+	Period      int    `json:"period,omitempty" yaml:"period,omitempty"`           // Period length of every type except MACD
+	ShortPeriod int    `json:"shortPeriod,omitempty" yaml:"shortPeriod,omitempty"` // Short EMA period of a MACD
+	LongPeriod  int    `json:"longPeriod,omitempty" yaml:"longPeriod,omitempty"`   // Long EMA period of a MACD
+	Benchmark   string `json:"benchmark,omitempty" yaml:"benchmark,omitempty"`     // Ticker a beta, relative strength or spread is measured against
+}
+
+// Config is the set of indicators calculated for every ticker
+type Config struct {
+	Indicators []Spec `json:"indicators" yaml:"indicators"` // Indicators in calculation order
+}
+
+// LoadConfig reads an indicator config file. Files ending in .yaml or .yml are parsed as YAML,
+// every other file as JSON. The config is validated before it is returned.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, config)
+	default:
+		err = json.Unmarshal(data, config)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	if _, err := config.Build(); err != nil {
+		return nil, fmt.Errorf("invalid indicator config %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// Build creates the indicator described by the spec
+func (s Spec) Build() (Indicator, error) {
+	switch strings.ToLower(s.Type) {
+	case TypeEMA:
+		if s.Period < 1 {
+			return nil, fmt.Errorf("ema period must be at least 1")
+		}
+
+		smoothing := s.Smoothing
+		if smoothing == 0 {
+			smoothing = defaultSmoothing
+		}
+
+		if smoothing < 1 {
+			return nil, fmt.Errorf("ema smoothing must be at least 1")
+		}
+
+		return &EMA{Smoothing: smoothing, PeriodLength: s.Period}, nil
+	case TypeMACD:
+		if s.ShortPeriod < 1 || s.ShortPeriod >= s.LongPeriod {
+			return nil, fmt.Errorf("macd shortPeriod must be at least 1 and less than longPeriod")
+		}
+
+		return &MACD{ShortPeriod: s.ShortPeriod, LongPeriod: s.LongPeriod}, nil
+	case TypeRSI:
+		if s.Period < 1 {
+			return nil, fmt.Errorf("rsi period must be at least 1")
+		}
+
+		return &RSI{PeriodLength: s.Period}, nil
+	case TypeVolatility:
+		if s.Period < 2 {
+			return nil, fmt.Errorf("volatility period must be at least 2")
+		}
+
+		return &Volatility{PeriodLength: s.Period}, nil
+	case TypeBeta:
+		if s.Period < 2 {
+			return nil, fmt.Errorf("beta period must be at least 2")
+		}
+
+		if s.Benchmark == "" {
+			return nil, fmt.Errorf("beta requires a benchmark ticker")
+		}
+
+		return &Beta{Benchmark: symbols.Canonical(s.Benchmark), PeriodLength: s.Period}, nil
+	case TypeRelative:
+		if s.Period < 1 {
+			return nil, fmt.Errorf("relative_strength period must be at least 1")
+		}
+
+		if s.Benchmark == "" {
+			return nil, fmt.Errorf("relative_strength requires a benchmark ticker")
+		}
+
+		return &RelativeStrength{Benchmark: symbols.Canonical(s.Benchmark), PeriodLength: s.Period}, nil
+	case TypeSpread:
+		if s.Period < 2 {
+			return nil, fmt.Errorf("spread period must be at least 2")
+		}
+
+		if s.Benchmark == "" {
+			return nil, fmt.Errorf("spread requires a benchmark ticker")
+		}
+
+		return &Spread{Other: symbols.Canonical(s.Benchmark), PeriodLength: s.Period}, nil
+	default:
+		return nil, fmt.Errorf("unknown indicator type %q", s.Type)
+	}
+}
+
+// Build creates the indicators of the config. Indicators with the same name are rejected,
+// since they would overwrite each other's values.
+func (c *Config) Build() ([]Indicator, error) {
+	built := make([]Indicator, 0, len(c.Indicators))
+	names := make(map[string]bool, len(c.Indicators))
+
+	for i, spec := range c.Indicators {
+		indicator, err := spec.Build()
+		if err != nil {
+			return nil, fmt.Errorf("indicator %d: %v", i+1, err)
+		}
+
+		if names[indicator.Name()] {
+			return nil, fmt.Errorf("indicator %d: duplicate indicator %s", i+1, indicator.Name())
+		}
+
+		names[indicator.Name()] = true
+		built = append(built, indicator)
+	}
+
+	return built, nil
+}
+
+// ClearIndicators removes every calculated indicator value from the given history
+func ClearIndicators(history *models.History) {
+	for _, row := range history.Rows {
+		row.Data.Range(func(_ string, data *models.TickerPeriod) bool {
+			data.Indicators = nil
+			return true
+		})
+	}
+}
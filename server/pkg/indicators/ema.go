@@ -2,7 +2,6 @@ package indicators
 
 import (
 	"fmt"
-	"urjith.dev/algobattle/pkg/models"
 )
 
 // EMA represents an Exponential Moving Average indicator
@@ -16,8 +15,8 @@ func (ema *EMA) Name() string {
 	return fmt.Sprintf("EMA %d %d", ema.Smoothing, ema.PeriodLength)
 }
 
-// Apply applies the EMA indicator to the given rows
-func (ema *EMA) Apply(rows []*models.Row, getTarget func(index int) float64, setValue func(index int, value float64), getIndicator func(index int, indicator string) float64) {
+// Apply applies the EMA indicator to the rows of the series
+func (ema *EMA) Apply(series Series) {
 	name := ema.Name()
 
 	// Smoothing factor
@@ -25,12 +24,12 @@ func (ema *EMA) Apply(rows []*models.Row, getTarget func(index int) float64, set
 
 	sum := 0.0
 
-	for i := 0; i < len(rows); i++ {
+	for i := 0; i < series.Len(); i++ {
 		if i < ema.PeriodLength {
-			sum += getTarget(i)
-			setValue(i, sum/float64(i+1))
+			sum += series.Target(i)
+			series.Set(i, sum/float64(i+1))
 		} else {
-			setValue(i, getTarget(i)*sf+getIndicator(i-1, name)*(1-sf))
+			series.Set(i, series.Target(i)*sf+series.Indicator(i-1, name)*(1-sf))
 		}
 	}
 }
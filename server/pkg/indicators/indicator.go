@@ -9,56 +9,33 @@ type Indicator interface {
 	// Name returns the name of the indicator
 	Name() string
 
-	// Apply applies the indicator to the given rows
-	Apply(rows []*models.Row, getTarget func(index int) float64, setValue func(index int, value float64), getIndicator func(index int, indicator string) float64)
+	// Apply calculates the indicator on the rows of a series and sets its values
+	Apply(series Series)
 }
 
 // CalculateIndicators calculates all indicators for the given history
 func CalculateIndicators(history *models.History, indicators []Indicator) {
-	for ticker, meta := range history.Tickers {
-		startIndex, _ := history.GetClosestRowBefore(meta.Start)
-		endIndex, _ := history.GetClosestRowBefore(meta.End)
-
-		if startIndex == -1 || endIndex == -1 {
-			continue
-		}
-
-		getTarget := func(index int) float64 {
-			if _, ok := history.Rows[index+startIndex].Data.Load(ticker); !ok {
-				return -1
-			}
-
-			data, _ := history.Rows[index+startIndex].Data.Load(ticker)
-			return data.AdjClose
-		}
-
-		getIndicator := func(index int, indicator string) float64 {
-			if _, ok := history.Rows[index+startIndex].Data.Load(ticker); !ok {
-				return -1
-			}
-
-			data, _ := history.Rows[index+startIndex].Data.Load(ticker)
-			return data.Indicators[indicator]
-		}
-
-		for _, indicator := range indicators {
-			name := indicator.Name()
-
-			setValue := func(index int, value float64) {
-				data, ok := history.Rows[index+startIndex].Data.Load(ticker)
+	for ticker := range history.Tickers {
+		CalculateTickerIndicators(history, ticker, indicators)
+	}
+}
 
-				if !ok {
-					return
-				}
+// CalculateTickerIndicators calculates all indicators for a single ticker of the given history
+func CalculateTickerIndicators(history *models.History, ticker string, indicators []Indicator) {
+	meta, ok := history.Tickers[ticker]
+	if !ok {
+		return
+	}
 
-				if data.Indicators == nil {
-					data.Indicators = make(map[string]float64)
-				}
+	// The first rows of a ticker may have been evicted, so its series starts at the first row still held
+	startIndex, _ := history.CeilRow(meta.Start)
+	endIndex, _ := history.FloorRow(meta.End)
 
-				data.Indicators[name] = value
-			}
+	if startIndex > endIndex {
+		return
+	}
 
-			indicator.Apply(history.Rows[startIndex:endIndex+1], getTarget, setValue, getIndicator)
-		}
+	for _, indicator := range indicators {
+		indicator.Apply(&historySeries{history: history, ticker: ticker, start: startIndex, end: endIndex, name: indicator.Name()})
 	}
 }
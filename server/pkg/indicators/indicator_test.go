@@ -0,0 +1,106 @@
+package indicators
+
+import (
+	"testing"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// recorder is an indicator that records the series it is applied to
+type recorder struct {
+	first, last time.Time
+	rows        int
+	applied     bool
+}
+
+func (r *recorder) Name() string {
+	return "recorder"
+}
+
+func (r *recorder) Apply(series Series) {
+	r.applied = true
+	r.rows = series.Len()
+	r.first = series.Date(0)
+	r.last = series.Date(series.Len() - 1)
+}
+
+// testDay returns midnight UTC of a day in January 2024
+func testDay(d int) time.Time {
+	return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC)
+}
+
+// addDays adds bars of a ticker on the given days of January 2024 to a history
+func addDays(history *models.History, ticker string, days ...int) {
+	periods := make([]models.PackedPeriod, 0, len(days))
+	for _, d := range days {
+		periods = append(periods, models.PackedPeriod{Date: testDay(d), Close: 100, AdjClose: 100})
+	}
+
+	history.AddData(periods, ticker, 0)
+}
+
+func TestCalculateTickerIndicatorsRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		evict     time.Time // Rows before this day are evicted, zero keeps every row
+		wantRows  int
+		wantFirst time.Time
+		wantLast  time.Time
+	}{
+		{"every row held", time.Time{}, 4, testDay(3), testDay(8)},
+		{"first rows evicted", testDay(6), 2, testDay(6), testDay(8)},
+		{"evicted up to a day without a row", testDay(4), 3, testDay(5), testDay(8)},
+		{"evicted up to the last row", testDay(8), 1, testDay(8), testDay(8)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := models.NewHistory()
+			addDays(history, "AAPL", 3, 5, 6, 8)
+
+			// MSFT has rows before and after AAPL's, which must not widen AAPL's series
+			addDays(history, "MSFT", 1, 2, 3, 5, 6, 8, 9, 10)
+
+			if !tt.evict.IsZero() {
+				history.Evict(tt.evict)
+			}
+
+			r := &recorder{}
+			CalculateTickerIndicators(history, "AAPL", []Indicator{r})
+			if !r.applied {
+				t.Fatal("indicator was not applied")
+			}
+
+			// The series spans every held row between AAPL's first and last, including days only MSFT traded
+			if !r.first.Equal(tt.wantFirst) || !r.last.Equal(tt.wantLast) {
+				t.Errorf("series = %v to %v, want %v to %v", r.first, r.last, tt.wantFirst, tt.wantLast)
+			}
+
+			if r.rows != tt.wantRows {
+				t.Errorf("series has %d rows, want %d", r.rows, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestCalculateTickerIndicatorsEvictedTicker(t *testing.T) {
+	history := models.NewHistory()
+	addDays(history, "AAPL", 3, 5)
+	addDays(history, "MSFT", 3, 5, 8, 9)
+
+	// Every row of AAPL was evicted, but its metadata is kept
+	history.Evict(testDay(8))
+
+	r := &recorder{}
+	CalculateTickerIndicators(history, "AAPL", []Indicator{r})
+	if r.applied {
+		t.Errorf("indicator was applied to %d rows of a ticker without held rows", r.rows)
+	}
+
+	// Unknown tickers are skipped
+	CalculateTickerIndicators(history, "TSLA", []Indicator{r})
+	if r.applied {
+		t.Error("indicator was applied to an unknown ticker")
+	}
+}
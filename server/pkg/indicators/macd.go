@@ -2,7 +2,6 @@ package indicators
 
 import (
 	"fmt"
-	"urjith.dev/algobattle/pkg/models"
 )
 
 // MACD represents a Moving Average Convergence Divergence indicator
@@ -16,35 +15,23 @@ func (macd *MACD) Name() string {
 	return fmt.Sprintf("MACD %d %d", macd.ShortPeriod, macd.LongPeriod)
 }
 
-// Apply applies the MACD indicator to the given rows
-func (macd *MACD) Apply(rows []*models.Row, getTarget func(index int) float64, setValue func(index int, value float64), _ func(index int, indicator string) float64) {
+// Apply applies the MACD indicator to the rows of the series
+func (macd *MACD) Apply(series Series) {
 	if macd.ShortPeriod >= macd.LongPeriod {
 		panic("MACD shortPeriod should be less than longPeriod")
 	}
 
-	shortEMAIndicator := &EMA{2, macd.ShortPeriod}
-	longEMAIndicator := &EMA{2, macd.LongPeriod}
+	shortEMAs := newBufferSeries(series)
+	longEMAs := newBufferSeries(series)
 
-	shortEMAs := make([]float64, len(rows))
-	longEMAs := make([]float64, len(rows))
+	(&EMA{2, macd.ShortPeriod}).Apply(shortEMAs)
+	(&EMA{2, macd.LongPeriod}).Apply(longEMAs)
 
-	shortEMAIndicator.Apply(rows, getTarget, func(index int, value float64) {
-		shortEMAs[index] = value
-	}, func(index int, _ string) float64 {
-		return shortEMAs[index]
-	})
-
-	longEMAIndicator.Apply(rows, getTarget, func(index int, value float64) {
-		longEMAs[index] = value
-	}, func(index int, _ string) float64 {
-		return longEMAs[index]
-	})
-
-	for i := range rows {
+	for i := 0; i < series.Len(); i++ {
 		if i < macd.LongPeriod {
 			continue
 		}
 
-		setValue(i, shortEMAs[i]-longEMAs[i])
+		series.Set(i, shortEMAs.values[i]-longEMAs.values[i])
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,69 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// RelativeStrength represents how much a ticker outperformed a benchmark ticker over a rolling window,
+// the ratio of their growth over the window minus one
+type RelativeStrength struct {
+	Benchmark    string
+	PeriodLength int
+}
+
+// Name returns the name of the indicator
+func (rs *RelativeStrength) Name() string {
+	return fmt.Sprintf("RS %s %d", symbols.Canonical(rs.Benchmark), rs.PeriodLength)
+}
+
+// Apply applies the relative strength indicator to the rows of the series. The window counts rows with data
+// of both the ticker and the benchmark, and values are only set once a full window is available.
+func (rs *RelativeStrength) Apply(series Series) {
+	rows, closes, benchmarks := pairedCloses(series, rs.Benchmark)
+	for k := rs.PeriodLength; k < len(rows); k++ {
+		growth := closes[k] / closes[k-rs.PeriodLength]
+		benchmarkGrowth := benchmarks[k] / benchmarks[k-rs.PeriodLength]
+		series.Set(rows[k], growth/benchmarkGrowth-1)
+	}
+}
+
+// Spread represents the z-score of the log price ratio of a ticker to another ticker over a rolling window,
+// how many standard deviations the pair's spread is away from its mean
+type Spread struct {
+	Other        string
+	PeriodLength int
+}
+
+// Name returns the name of the indicator
+func (s *Spread) Name() string {
+	return fmt.Sprintf("SPREAD %s %d", symbols.Canonical(s.Other), s.PeriodLength)
+}
+
+// Apply applies the spread indicator to the rows of the series. The window counts rows with data of both
+// tickers, and values are only set once a full window is available and the spread moved within it.
+func (s *Spread) Apply(series Series) {
+	rows, closes, others := pairedCloses(series, s.Other)
+	spreads := make([]float64, len(rows))
+	for k := range rows {
+		spreads[k] = math.Log(closes[k] / others[k])
+	}
+
+	for k := s.PeriodLength - 1; k < len(rows); k++ {
+		window := spreads[k-s.PeriodLength+1 : k+1]
+
+		deviation := stdDev(window)
+		if deviation == 0 {
+			continue
+		}
+
+		mean := 0.0
+		for _, spread := range window {
+			mean += spread / float64(len(window))
+		}
+
+		series.Set(rows[k], (spreads[k]-mean)/deviation)
+	}
+}
@@ -0,0 +1,46 @@
+package indicators
+
+import (
+	"fmt"
+)
+
+// RSI represents a Relative Strength Index indicator using Wilder's smoothing
+type RSI struct {
+	PeriodLength int
+}
+
+// Name returns the name of the indicator
+func (rsi *RSI) Name() string {
+	return fmt.Sprintf("RSI %d", rsi.PeriodLength)
+}
+
+// Apply applies the RSI indicator to the rows of the series.
+// Values are only set once a full period of price changes is available.
+func (rsi *RSI) Apply(series Series) {
+	avgGain, avgLoss := 0.0, 0.0
+	period := float64(rsi.PeriodLength)
+
+	for i := 1; i < series.Len(); i++ {
+		change := series.Target(i) - series.Target(i-1)
+		gain, loss := max(change, 0), max(-change, 0)
+
+		if i <= rsi.PeriodLength {
+			avgGain += gain / period
+			avgLoss += loss / period
+
+			if i < rsi.PeriodLength {
+				continue
+			}
+		} else {
+			avgGain = (avgGain*(period-1) + gain) / period
+			avgLoss = (avgLoss*(period-1) + loss) / period
+		}
+
+		if avgLoss == 0 {
+			series.Set(i, 100)
+			continue
+		}
+
+		series.Set(i, 100-100/(1+avgGain/avgLoss))
+	}
+}
@@ -0,0 +1,144 @@
+package indicators
+
+import (
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Series gives an indicator access to the history it is calculated on. Indexes count the rows from the
+// first to the last row of the ticker the indicator is calculated for, and every ticker of the history
+// can be read on those rows, so indicators can relate the ticker to benchmarks or other tickers.
+type Series interface {
+	// Len returns the number of rows
+	Len() int
+
+	// Ticker returns the ticker the indicator is calculated for
+	Ticker() string
+
+	// Date returns the date of a row
+	Date(index int) time.Time
+
+	// Target returns the adjusted close of the ticker, -1 if the row has no data of the ticker
+	Target(index int) float64
+
+	// Indicator returns a value of the ticker's indicators calculated before this one, -1 if the row has no data of the ticker
+	Indicator(index int, name string) float64
+
+	// Set sets the indicator's value of the ticker on a row, rows without data of the ticker are ignored
+	Set(index int, value float64)
+
+	// Reference returns the adjusted close of any ticker on a row, -1 if the row has no data of it
+	Reference(index int, ticker string) float64
+
+	// Period returns the data of any ticker on a row, false if the row has none
+	Period(index int, ticker string) (*models.TickerPeriod, bool)
+}
+
+// historySeries is the series of a ticker's rows in a history, setting values of the named indicator
+type historySeries struct {
+	history *models.History
+	ticker  string
+	start   int    // Index of the ticker's first row in the history
+	end     int    // Index of the ticker's last row in the history
+	name    string // Name of the indicator values are set for
+}
+
+// Len returns the number of rows
+func (s *historySeries) Len() int {
+	return s.end - s.start + 1
+}
+
+// Ticker returns the ticker the indicator is calculated for
+func (s *historySeries) Ticker() string {
+	return s.ticker
+}
+
+// Date returns the date of a row
+func (s *historySeries) Date(index int) time.Time {
+	return s.history.Rows[s.start+index].Date
+}
+
+// Target returns the adjusted close of the ticker
+func (s *historySeries) Target(index int) float64 {
+	return s.Reference(index, s.ticker)
+}
+
+// Indicator returns a value of the ticker's indicators
+func (s *historySeries) Indicator(index int, name string) float64 {
+	data, ok := s.Period(index, s.ticker)
+	if !ok {
+		return -1
+	}
+
+	return data.Indicators[name]
+}
+
+// Set sets the indicator's value of the ticker on a row
+func (s *historySeries) Set(index int, value float64) {
+	data, ok := s.Period(index, s.ticker)
+	if !ok {
+		return
+	}
+
+	if data.Indicators == nil {
+		data.Indicators = make(map[string]float64)
+	}
+
+	data.Indicators[s.name] = value
+}
+
+// Reference returns the adjusted close of any ticker on a row
+func (s *historySeries) Reference(index int, ticker string) float64 {
+	data, ok := s.Period(index, ticker)
+	if !ok {
+		return -1
+	}
+
+	return data.AdjClose
+}
+
+// Period returns the data of any ticker on a row
+func (s *historySeries) Period(index int, ticker string) (*models.TickerPeriod, bool) {
+	return s.history.Rows[s.start+index].Data.Load(symbols.Canonical(ticker))
+}
+
+// bufferSeries reads the history of another series but keeps the values it is given in memory,
+// so an indicator can calculate intermediate indicators without storing them
+type bufferSeries struct {
+	Series
+	values []float64
+}
+
+// newBufferSeries creates a buffer over the rows of a series
+func newBufferSeries(series Series) *bufferSeries {
+	return &bufferSeries{Series: series, values: make([]float64, series.Len())}
+}
+
+// Indicator returns the buffered value of a row, whatever the name
+func (b *bufferSeries) Indicator(index int, _ string) float64 {
+	return b.values[index]
+}
+
+// Set buffers the value of a row
+func (b *bufferSeries) Set(index int, value float64) {
+	b.values[index] = value
+}
+
+// pairedCloses returns the rows where both the series' ticker and another ticker have data,
+// with the adjusted closes of both on those rows
+func pairedCloses(series Series, other string) (rows []int, closes, otherCloses []float64) {
+	for i := 0; i < series.Len(); i++ {
+		price, otherPrice := series.Target(i), series.Reference(i, other)
+		if price <= 0 || otherPrice <= 0 {
+			continue
+		}
+
+		rows = append(rows, i)
+		closes = append(closes, price)
+		otherCloses = append(otherCloses, otherPrice)
+	}
+
+	return rows, closes, otherCloses
+}
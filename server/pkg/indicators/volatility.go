@@ -0,0 +1,61 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+)
+
+// tradingDaysPerYear annualizes daily volatility
+const tradingDaysPerYear = 252
+
+// Volatility represents the annualized historical volatility of daily log returns over a rolling window
+type Volatility struct {
+	PeriodLength int
+}
+
+// Name returns the name of the indicator
+func (v *Volatility) Name() string {
+	return fmt.Sprintf("VOLATILITY %d", v.PeriodLength)
+}
+
+// Apply applies the volatility indicator to the rows of the series. Returns are taken between consecutive rows
+// with data of the ticker, and values are only set once a full period of returns is available.
+func (v *Volatility) Apply(series Series) {
+	returns := make([]float64, 0, series.Len())
+	previous := -1.0
+
+	for i := 0; i < series.Len(); i++ {
+		price := series.Target(i)
+		if price <= 0 {
+			continue
+		}
+
+		if previous > 0 {
+			returns = append(returns, math.Log(price/previous))
+			if len(returns) >= v.PeriodLength {
+				series.Set(i, stdDev(returns[len(returns)-v.PeriodLength:])*math.Sqrt(tradingDaysPerYear))
+			}
+		}
+
+		previous = price
+	}
+}
+
+// stdDev returns the sample standard deviation of values, 0 for fewer than two values
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, value := range values {
+		mean += value / float64(len(values))
+	}
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+
+	return math.Sqrt(variance / float64(len(values)-1))
+}
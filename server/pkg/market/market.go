@@ -0,0 +1,147 @@
+// Package market describes exchange trading sessions.
+// Each exchange has a time zone and a list of daily sessions, such as the regular session
+// and the optional pre-market and after-hours sessions, each with its own trading costs.
+package market
+
+import (
+	"fmt"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// Session names
+const (
+	SessionPreMarket  = "pre_market"  // Before the regular session opens
+	SessionRegular    = "regular"     // Regular trading hours
+	SessionAfterHours = "after_hours" // After the regular session closes
+	SessionClosed     = "closed"      // Outside every enabled session
+)
+
+// Session is a daily trading window of an exchange, in the exchange's local time
+type Session struct {
+	Name        string  `json:"name"`        // Session name
+	Open        int     `json:"open"`        // Minutes after local midnight when the session opens
+	Close       int     `json:"close"`       // Minutes after local midnight when the session closes
+	FeeBps      float64 `json:"feeBps"`      // Fee charged on the traded value in basis points
+	SlippageBps float64 `json:"slippageBps"` // Adverse price adjustment in basis points, modelling thinner liquidity
+}
+
+// Exchange is a market with trading sessions on weekdays that are not holidays
+type Exchange struct {
+	Code      string          `json:"code"`      // Exchange code
+	TimeZone  string          `json:"timeZone"`  // Name of the time zone of the sessions
+	Location  *time.Location  `json:"-"`         // Time zone of the sessions
+	Sessions  []*Session      `json:"sessions"`  // Enabled sessions in chronological order
+	Holidays  map[string]bool `json:"-"`         // Local dates in YYYY-MM-DD format when the exchange is closed
+	Precision Precision       `json:"precision"` // Tick size and share precision of the exchange's instruments
+}
+
+// ExtendedHours configures the pre-market and after-hours sessions
+type ExtendedHours struct {
+	Enabled     bool    // Whether trading is allowed outside the regular session
+	FeeBps      float64 // Fee charged on extended session trades in basis points
+	SlippageBps float64 // Adverse price adjustment of extended session trades in basis points
+}
+
+// clock converts an hour and minute to minutes after midnight
+func clock(hour, minute int) int {
+	return hour*60 + minute
+}
+
+// NewUSExchange creates a US equity exchange with the regular session from 9:30 to 16:00 Eastern
+// and, if enabled, the pre-market session from 4:00 and the after-hours session until 20:00
+func NewUSExchange(extended ExtendedHours) (*Exchange, error) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, fmt.Errorf("error loading US market time zone: %v", err)
+	}
+
+	exchange := &Exchange{Code: "US", TimeZone: location.String(), Location: location, Holidays: make(map[string]bool), Precision: DefaultPrecision}
+	if extended.Enabled {
+		exchange.Sessions = append(exchange.Sessions, &Session{SessionPreMarket, clock(4, 0), clock(9, 30), extended.FeeBps, extended.SlippageBps})
+	}
+
+	exchange.Sessions = append(exchange.Sessions, &Session{Name: SessionRegular, Open: clock(9, 30), Close: clock(16, 0)})
+
+	if extended.Enabled {
+		exchange.Sessions = append(exchange.Sessions, &Session{SessionAfterHours, clock(16, 0), clock(20, 0), extended.FeeBps, extended.SlippageBps})
+	}
+
+	return exchange, nil
+}
+
+// HasSession checks whether the exchange has an enabled session with the given name
+func (e *Exchange) HasSession(name string) bool {
+	return e.Session(name) != nil
+}
+
+// Session returns the enabled session with the given name, or nil if the exchange has none
+func (e *Exchange) Session(name string) *Session {
+	for _, session := range e.Sessions {
+		if session.Name == name {
+			return session
+		}
+	}
+
+	return nil
+}
+
+// SessionAt returns the session open at the given time, or nil if the exchange is closed
+func (e *Exchange) SessionAt(t time.Time) *Session {
+	local := t.In(e.Location)
+	if !e.TradingDay(local) {
+		return nil
+	}
+
+	minute := clock(local.Hour(), local.Minute())
+	for _, session := range e.Sessions {
+		if minute >= session.Open && minute < session.Close {
+			return session
+		}
+	}
+
+	return nil
+}
+
+// TradingDay checks whether the calendar date of a time, in the time's own location, is a weekday that is not a holiday
+func (e *Exchange) TradingDay(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday && !e.Holidays[date.Format(time.DateOnly)]
+}
+
+// LastClosedDay returns the most recent trading day whose regular session closed by t,
+// dated at midnight UTC of its local date like daily bars
+func (e *Exchange) LastClosedDay(t time.Time) time.Time {
+	local := t.In(e.Location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	closing := clock(24, 0)
+	if regular := e.Session(SessionRegular); regular != nil {
+		closing = regular.Close
+	}
+
+	if clock(local.Hour(), local.Minute()) < closing {
+		day = day.AddDate(0, 0, -1)
+	}
+
+	// Every calendar has a trading day within a few weeks, the bound only guards against misconfigured holidays
+	for i := 0; i < 366 && !e.TradingDay(day); i++ {
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return day
+}
+
+// FillPrice adjusts a quoted price for the session's slippage, against the trader
+func (s *Session) FillPrice(action string, price float64) float64 {
+	if action == "sell" {
+		return price * (1 - s.SlippageBps/10000)
+	}
+
+	return price * (1 + s.SlippageBps/10000)
+}
+
+// Fee returns the fee charged on a traded value, rounded with the cash rounding policy
+func (s *Session) Fee(value float64) float64 {
+	return money.Default().Round(value * s.FeeBps / 10000)
+}
@@ -0,0 +1,90 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultPrecision is the precision of exchanges that do not configure one: whole cents and at most 4 decimal places of shares
+var DefaultPrecision = Precision{TickSize: 0.01, ShareDecimals: 4}
+
+// Precision is the price and quantity granularity of an instrument. Orders must be expressed in it
+// and fills are rounded to it, so executions do not depend on the float precision clients send.
+type Precision struct {
+	TickSize      float64 `json:"tickSize"`      // Smallest price increment
+	ShareDecimals int     `json:"shareDecimals"` // Decimal places of share quantities, 0 for whole shares only
+}
+
+// InstrumentPrecision overrides the precision of a ticker's exchange for the ticker
+type InstrumentPrecision struct {
+	Ticker string `json:"ticker"` // Ticker the precision applies to
+	Precision
+}
+
+// Validate checks that the tick size is positive and the share decimals are between 0 and 8
+func (p Precision) Validate() error {
+	switch {
+	case p.TickSize <= 0:
+		return fmt.Errorf("tick size must be positive, got %v", p.TickSize)
+	case p.ShareDecimals < 0 || p.ShareDecimals > 8:
+		return fmt.Errorf("share decimals must be between 0 and 8, got %d", p.ShareDecimals)
+	}
+
+	return nil
+}
+
+// RoundPrice rounds a price to the nearest tick, ties away from zero
+func (p Precision) RoundPrice(price float64) float64 {
+	ticks := math.Round(price / p.TickSize)
+	return roundDecimals(ticks*p.TickSize, decimals(p.TickSize))
+}
+
+// FloorShares rounds a share quantity towards zero to the allowed decimal places,
+// so a fill never exceeds the shares it was computed from
+func (p Precision) FloorShares(shares float64) float64 {
+	text := strconv.FormatFloat(shares, 'f', -1, 64)
+	whole, fraction, _ := strings.Cut(text, ".")
+	if len(fraction) > p.ShareDecimals {
+		fraction = fraction[:p.ShareDecimals]
+	}
+
+	floored, _ := strconv.ParseFloat(whole+"."+fraction, 64)
+	return floored
+}
+
+// CheckPrice returns an error if a price is not a whole number of ticks
+func (p Precision) CheckPrice(price float64) error {
+	if p.RoundPrice(price) != price {
+		return fmt.Errorf("%v is not a multiple of the tick size %v", price, p.TickSize)
+	}
+
+	return nil
+}
+
+// CheckShares returns an error if a share quantity has more decimal places than allowed
+func (p Precision) CheckShares(shares float64) error {
+	if p.FloorShares(shares) != shares {
+		if p.ShareDecimals == 0 {
+			return fmt.Errorf("%v is not a whole number of shares", shares)
+		}
+
+		return fmt.Errorf("%v has more than %d decimal places", shares, p.ShareDecimals)
+	}
+
+	return nil
+}
+
+// decimals returns the number of decimal places of the shortest representation of a value
+func decimals(value float64) int {
+	_, fraction, _ := strings.Cut(strconv.FormatFloat(value, 'f', -1, 64), ".")
+	return len(fraction)
+}
+
+// roundDecimals rounds a value to a number of decimal places through its decimal representation,
+// removing the binary error of multiplying a tick count by the tick size
+func roundDecimals(value float64, places int) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(value, 'f', places, 64), 64)
+	return rounded
+}
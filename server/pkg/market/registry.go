@@ -0,0 +1,289 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// SessionConfig configures a session in a calendar file, with times in "HH:MM" local time
+type SessionConfig struct {
+	Name        string  `json:"name"`        // Session name
+	Open        string  `json:"open"`        // Local opening time
+	Close       string  `json:"close"`       // Local closing time
+	FeeBps      float64 `json:"feeBps"`      // Fee charged on the traded value in basis points
+	SlippageBps float64 `json:"slippageBps"` // Adverse price adjustment in basis points
+}
+
+// ExchangeConfig configures an exchange in a calendar file
+type ExchangeConfig struct {
+	Code          string           `json:"code"`          // Exchange code
+	Aliases       []string         `json:"aliases"`       // Other exchange codes that share the exchange's calendar
+	TimeZone      string           `json:"timeZone"`      // IANA time zone name
+	Sessions      []*SessionConfig `json:"sessions"`      // Sessions in chronological order
+	Holidays      []string         `json:"holidays"`      // Local dates in YYYY-MM-DD format when the exchange is closed
+	TickSize      float64          `json:"tickSize"`      // Smallest price increment, DefaultPrecision's if 0
+	ShareDecimals *int             `json:"shareDecimals"` // Decimal places of share quantities, DefaultPrecision's if omitted
+}
+
+// CalendarConfig is the format of a calendar file. Exchanges in the file replace
+// built in exchanges with the same code.
+type CalendarConfig struct {
+	Exchanges   []*ExchangeConfig      `json:"exchanges"`   // Exchange calendars
+	Instruments []*InstrumentPrecision `json:"instruments"` // Tickers whose precision differs from their exchange's
+}
+
+// usAliases are the exchange codes reported by Tiingo for US listings
+var usAliases = []string{"NYSE", "NASDAQ", "NYSE ARCA", "NYSE MKT", "AMEX", "BATS", "IEX", "OTC", "NYSE NAT"}
+
+// Registry resolves exchange codes to exchanges. Unknown codes resolve to the default exchange.
+type Registry struct {
+	exchanges   map[string]*Exchange
+	fallback    *Exchange
+	instruments map[string]*InstrumentPrecision
+}
+
+// NewRegistry creates a registry with the US, London and Toronto exchanges.
+// The US exchange is the default and the only one with extended sessions.
+func NewRegistry(extended ExtendedHours) (*Registry, error) {
+	us, err := NewUSExchange(extended)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &Registry{exchanges: make(map[string]*Exchange), fallback: us, instruments: make(map[string]*InstrumentPrecision)}
+	registry.add(us, usAliases...)
+
+	builtIn := []*ExchangeConfig{
+		{
+			Code:     "LSE",
+			Aliases:  []string{"LON"},
+			TimeZone: "Europe/London",
+			Sessions: []*SessionConfig{{Name: SessionRegular, Open: "08:00", Close: "16:30"}},
+		},
+		{
+			Code:     "TSX",
+			Aliases:  []string{"TSXV", "TOR"},
+			TimeZone: "America/Toronto",
+			Sessions: []*SessionConfig{{Name: SessionRegular, Open: "09:30", Close: "16:00"}},
+		},
+	}
+
+	for _, cfg := range builtIn {
+		err = registry.Configure(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// LoadCalendar applies the exchanges of a calendar file to the registry
+func (r *Registry) LoadCalendar(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	calendar := &CalendarConfig{}
+	err = json.Unmarshal(data, calendar)
+	if err != nil {
+		return fmt.Errorf("error parsing market calendar: %v", err)
+	}
+
+	for _, cfg := range calendar.Exchanges {
+		err = r.Configure(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, instrument := range calendar.Instruments {
+		err = r.ConfigureInstrument(instrument)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Configure adds or replaces an exchange
+func (r *Registry) Configure(cfg *ExchangeConfig) error {
+	location, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return fmt.Errorf("exchange %s: invalid time zone: %v", cfg.Code, err)
+	}
+
+	exchange := &Exchange{
+		Code:      strings.ToUpper(cfg.Code),
+		TimeZone:  location.String(),
+		Location:  location,
+		Sessions:  make([]*Session, 0, len(cfg.Sessions)),
+		Holidays:  make(map[string]bool, len(cfg.Holidays)),
+		Precision: DefaultPrecision,
+	}
+
+	if cfg.TickSize != 0 {
+		exchange.Precision.TickSize = cfg.TickSize
+	}
+
+	if cfg.ShareDecimals != nil {
+		exchange.Precision.ShareDecimals = *cfg.ShareDecimals
+	}
+
+	if err := exchange.Precision.Validate(); err != nil {
+		return fmt.Errorf("exchange %s: %v", cfg.Code, err)
+	}
+
+	for _, sessionCfg := range cfg.Sessions {
+		open, err := parseClock(sessionCfg.Open)
+		if err != nil {
+			return fmt.Errorf("exchange %s session %s: %v", cfg.Code, sessionCfg.Name, err)
+		}
+
+		closing, err := parseClock(sessionCfg.Close)
+		if err != nil {
+			return fmt.Errorf("exchange %s session %s: %v", cfg.Code, sessionCfg.Name, err)
+		}
+
+		if open >= closing {
+			return fmt.Errorf("exchange %s session %s must open before it closes", cfg.Code, sessionCfg.Name)
+		}
+
+		exchange.Sessions = append(exchange.Sessions, &Session{sessionCfg.Name, open, closing, sessionCfg.FeeBps, sessionCfg.SlippageBps})
+	}
+
+	for _, holiday := range cfg.Holidays {
+		if _, err := time.Parse(time.DateOnly, holiday); err != nil {
+			return fmt.Errorf("exchange %s: invalid holiday %q", cfg.Code, holiday)
+		}
+
+		exchange.Holidays[holiday] = true
+	}
+
+	// Codes that referred to a replaced exchange now refer to its replacement
+	if replaced, ok := r.exchanges[exchange.Code]; ok {
+		for code, existing := range r.exchanges {
+			if existing == replaced {
+				r.exchanges[code] = exchange
+			}
+		}
+
+		if r.fallback == replaced {
+			r.fallback = exchange
+		}
+	}
+
+	r.add(exchange, cfg.Aliases...)
+	return nil
+}
+
+// ConfigureInstrument adds or replaces the precision of a ticker
+func (r *Registry) ConfigureInstrument(instrument *InstrumentPrecision) error {
+	if instrument.Ticker == "" {
+		return fmt.Errorf("instrument precision requires a ticker")
+	}
+
+	if err := instrument.Validate(); err != nil {
+		return fmt.Errorf("instrument %s: %v", instrument.Ticker, err)
+	}
+
+	ticker := symbols.Canonical(instrument.Ticker)
+	r.instruments[ticker] = &InstrumentPrecision{Ticker: ticker, Precision: instrument.Precision}
+	return nil
+}
+
+// Precision returns the precision of a ticker listed on an exchange, the ticker's own if it has one
+func (r *Registry) Precision(ticker string, exchange *Exchange) Precision {
+	if instrument, ok := r.instruments[symbols.Canonical(ticker)]; ok {
+		return instrument.Precision
+	}
+
+	return exchange.Precision
+}
+
+// Instruments returns the tickers with their own precision, sorted by ticker
+func (r *Registry) Instruments() []*InstrumentPrecision {
+	instruments := make([]*InstrumentPrecision, 0, len(r.instruments))
+	for _, instrument := range r.instruments {
+		instruments = append(instruments, instrument)
+	}
+
+	sort.Slice(instruments, func(i, j int) bool {
+		return instruments[i].Ticker < instruments[j].Ticker
+	})
+
+	return instruments
+}
+
+// add registers an exchange under its code and aliases
+func (r *Registry) add(exchange *Exchange, aliases ...string) {
+	r.exchanges[exchange.Code] = exchange
+	for _, alias := range aliases {
+		r.exchanges[strings.ToUpper(alias)] = exchange
+	}
+}
+
+// Exchange returns the exchange with the given code or alias, or the default exchange if it is unknown
+func (r *Registry) Exchange(code string) *Exchange {
+	if exchange, ok := r.exchanges[strings.ToUpper(code)]; ok {
+		return exchange
+	}
+
+	return r.fallback
+}
+
+// Lookup returns the exchange with the given code or alias, and false if it is unknown
+func (r *Registry) Lookup(code string) (*Exchange, bool) {
+	exchange, ok := r.exchanges[strings.ToUpper(code)]
+	return exchange, ok
+}
+
+// Exchanges returns every exchange once, sorted by code
+func (r *Registry) Exchanges() []*Exchange {
+	exchanges := make([]*Exchange, 0, len(r.exchanges))
+	for code, exchange := range r.exchanges {
+		if code == exchange.Code {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+
+	sort.Slice(exchanges, func(i, j int) bool {
+		return exchanges[i].Code < exchanges[j].Code
+	})
+
+	return exchanges
+}
+
+// Default returns the exchange used for tickers whose exchange is unknown
+func (r *Registry) Default() *Exchange {
+	return r.fallback
+}
+
+// HasSession checks whether any exchange has an enabled session with the given name
+func (r *Registry) HasSession(name string) bool {
+	for _, exchange := range r.exchanges {
+		if exchange.HasSession(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseClock parses a "HH:MM" time to minutes after midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	return clock(parsed.Hour(), parsed.Minute()), nil
+}
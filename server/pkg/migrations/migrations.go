@@ -0,0 +1,279 @@
+// Package migrations provides versioned schema migrations for Firestore documents.
+// Every migrated document carries a schemaVersion field. Documents can be upgraded
+// lazily when they are read, or in batches by a background job, so model changes
+// roll out without manual edits to the database or breaking old documents.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// VersionField is the document field that stores the schema version
+const VersionField = "schemaVersion"
+
+// MigrateFunc upgrades the raw data of a document by one version in place
+type MigrateFunc func(data map[string]any) error
+
+// Migration upgrades documents of a collection to Version
+type Migration struct {
+	Version     int         `json:"version"`     // Version the migration upgrades documents to
+	Description string      `json:"description"` // What the migration changes
+	Migrate     MigrateFunc `json:"-"`           // Upgrades the document data
+}
+
+// Report summarises a batch migration of a collection
+type Report struct {
+	Collection string    `json:"collection"` // Migrated collection
+	Latest     int       `json:"latest"`     // Latest schema version of the collection
+	Scanned    int       `json:"scanned"`    // Number of documents checked
+	Migrated   int       `json:"migrated"`   // Number of documents upgraded
+	Failed     int       `json:"failed"`     // Number of documents that failed to upgrade
+	Errors     []string  `json:"errors"`     // Errors of the failed documents
+	Started    time.Time `json:"started"`    // When the batch started
+	Finished   time.Time `json:"finished"`   // When the batch finished
+}
+
+// Status describes the migrations of a single collection
+type Status struct {
+	Collection string      `json:"collection"` // Collection name
+	Latest     int         `json:"latest"`     // Latest schema version
+	Migrations []Migration `json:"migrations"` // Registered migrations in version order
+	LastBatch  *Report     `json:"lastBatch"`  // Report of the last batch migration, nil if none ran
+}
+
+// Migrator holds the registered migrations of every collection
+type Migrator struct {
+	db          *firestore.Client
+	mu          sync.RWMutex
+	collections map[string][]Migration
+	groups      map[string]bool // Collections migrated with a collection group query
+	reports     map[string]*Report
+}
+
+// NewMigrator creates a Migrator with no registered migrations
+func NewMigrator(db *firestore.Client) *Migrator {
+	return &Migrator{
+		db:          db,
+		collections: make(map[string][]Migration),
+		groups:      make(map[string]bool),
+		reports:     make(map[string]*Report),
+	}
+}
+
+// Register adds migrations for a collection.
+// Versions must be unique within a collection and start at 1.
+func (m *Migrator) Register(collection string, migrations ...Migration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	registered := append(m.collections[collection], migrations...)
+	sort.Slice(registered, func(a, b int) bool {
+		return registered[a].Version < registered[b].Version
+	})
+
+	for i, migration := range registered {
+		if migration.Version != i+1 {
+			return fmt.Errorf("migrations for %s must be numbered consecutively from 1, found version %d at position %d", collection, migration.Version, i+1)
+		}
+	}
+
+	m.collections[collection] = registered
+	return nil
+}
+
+// RegisterGroup adds migrations for every collection with the given ID, such as a subcollection of every document
+// of another collection. Batch migrations read their documents with a collection group query.
+func (m *Migrator) RegisterGroup(collection string, migrations ...Migration) error {
+	err := m.Register(collection, migrations...)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.groups[collection] = true
+	return nil
+}
+
+// Latest returns the latest schema version of a collection, or 0 if it has no migrations
+func (m *Migrator) Latest(collection string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.collections[collection])
+}
+
+// NeedsMigration checks whether a document of a collection is behind the latest schema version
+func (m *Migrator) NeedsMigration(collection string, doc *firestore.DocumentSnapshot) bool {
+	return documentVersion(doc.Data()) < m.Latest(collection)
+}
+
+// Apply runs every pending migration on the raw data of a document of a collection.
+// Returns true if any migration ran.
+func (m *Migrator) Apply(collection string, data map[string]any) (bool, error) {
+	m.mu.RLock()
+	migrations := m.collections[collection]
+	m.mu.RUnlock()
+
+	version := documentVersion(data)
+	if version >= len(migrations) {
+		return false, nil
+	}
+
+	for _, migration := range migrations[version:] {
+		err := migration.Migrate(data)
+		if err != nil {
+			return false, fmt.Errorf("migration %s v%d failed: %v", collection, migration.Version, err)
+		}
+
+		data[VersionField] = migration.Version
+	}
+
+	return true, nil
+}
+
+// MigrateDocument upgrades a single document to the latest schema version inside a transaction.
+// Returns true if the document was changed.
+func (m *Migrator) MigrateDocument(ctx context.Context, collection string, ref *firestore.DocumentRef) (bool, error) {
+	changed := false
+
+	err := m.db.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		data := doc.Data()
+		changed, err = m.Apply(collection, data)
+		if err != nil || !changed {
+			return err
+		}
+
+		return tx.Set(ref, data)
+	})
+
+	return changed, err
+}
+
+// MigrateCollection upgrades every out of date document of a collection.
+// Documents that fail are counted and reported without stopping the batch.
+func (m *Migrator) MigrateCollection(ctx context.Context, collection string) (*Report, error) {
+	report := &Report{
+		Collection: collection,
+		Latest:     m.Latest(collection),
+		Errors:     make([]string, 0),
+		Started:    time.Now(),
+	}
+
+	m.mu.RLock()
+	query := m.db.Collection(collection).Query
+	if m.groups[collection] {
+		query = m.db.CollectionGroup(collection).Query
+	}
+	m.mu.RUnlock()
+
+	docs := query.Documents(ctx)
+	defer docs.Stop()
+
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		report.Scanned++
+		if !m.NeedsMigration(collection, doc) {
+			continue
+		}
+
+		changed, err := m.MigrateDocument(ctx, collection, doc.Ref)
+		switch {
+		case err != nil:
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", doc.Ref.ID, err))
+		case changed:
+			report.Migrated++
+		}
+	}
+
+	report.Finished = time.Now()
+
+	m.mu.Lock()
+	m.reports[collection] = report
+	m.mu.Unlock()
+
+	return report, nil
+}
+
+// MigrateAll upgrades every collection that has registered migrations
+func (m *Migrator) MigrateAll(ctx context.Context) error {
+	m.mu.RLock()
+	collections := make([]string, 0, len(m.collections))
+	for collection := range m.collections {
+		collections = append(collections, collection)
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(collections)
+
+	for _, collection := range collections {
+		report, err := m.MigrateCollection(ctx, collection)
+		if err != nil {
+			return fmt.Errorf("error migrating %s: %v", collection, err)
+		}
+
+		if report.Failed > 0 {
+			return fmt.Errorf("%d documents in %s failed to migrate", report.Failed, collection)
+		}
+	}
+
+	return nil
+}
+
+// Status returns the migrations and last batch report of every collection sorted by name
+func (m *Migrator) Status() []*Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]*Status, 0, len(m.collections))
+	for collection, migrations := range m.collections {
+		statuses = append(statuses, &Status{
+			Collection: collection,
+			Latest:     len(migrations),
+			Migrations: migrations,
+			LastBatch:  m.reports[collection],
+		})
+	}
+
+	sort.Slice(statuses, func(a, b int) bool {
+		return statuses[a].Collection < statuses[b].Collection
+	})
+
+	return statuses
+}
+
+// documentVersion returns the schema version of raw document data, 0 if it has none
+func documentVersion(data map[string]any) int {
+	switch version := data[VersionField].(type) {
+	case int64:
+		return int(version)
+	case int:
+		return version
+	case float64:
+		return int(version)
+	default:
+		return 0
+	}
+}
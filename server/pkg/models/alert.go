@@ -0,0 +1,170 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Conditions a price alert can wait for
+const (
+	AlertAbove = "above" // The price is at or above the alert price
+	AlertBelow = "below" // The price is at or below the alert price
+)
+
+// Delivery states of a triggered alert
+const (
+	AlertPending    = "pending"     // The webhook has not accepted the alert yet and it will be retried
+	AlertDelivered  = "delivered"   // The webhook accepted the alert
+	AlertDeadLetter = "dead_letter" // Every attempt to deliver the alert failed, it is no longer retried
+	AlertStreamOnly = "stream_only" // The alert has no webhook and was only sent to the stream
+)
+
+// Webhook retry schedule of triggered alerts. The delay doubles after every failed attempt.
+const (
+	AlertRetryBase     = 30 * time.Second // Delay before the first retry
+	AlertRetryMax      = time.Hour        // Longest delay between attempts
+	AlertDeliveryLimit = 8                // Attempts before an alert is dead lettered
+)
+
+// PriceAlert is a subscription to a ticker's price crossing a level. It triggers once, on the first
+// price update that meets its condition, and is then replaced by its entry in the alert history.
+type PriceAlert struct {
+	ID        string                 `json:"id" firestore:"-"`                          // ID of the alert document
+	Ticker    string                 `json:"ticker" firestore:"ticker"`                 // Ticker symbol to watch
+	Condition string                 `json:"condition" firestore:"condition"`           // "above" or "below"
+	Price     float64                `json:"price" firestore:"price"`                   // Price level of the condition
+	Webhook   string                 `json:"webhook,omitempty" firestore:"webhook"`     // URL the triggered alert is posted to, empty to only send it to the stream
+	Note      string                 `json:"note,omitempty" firestore:"note,omitempty"` // Free text returned with the triggered alert
+	CreatedAt time.Time              `json:"createdAt" firestore:"createdAt"`           // When the alert was created
+	Bot       *firestore.DocumentRef `json:"-" firestore:"bot"`                         // Bot that created the alert
+
+	// SchemaVersion is the version of the document schema, maintained by migrations
+	SchemaVersion int `json:"-" firestore:"schemaVersion"`
+}
+
+// Validate checks the ticker, condition, price and webhook of the alert
+func (a *PriceAlert) Validate() error {
+	if !symbols.Valid(a.Ticker) {
+		return fmt.Errorf("invalid ticker %q", a.Ticker)
+	}
+
+	if a.Condition != AlertAbove && a.Condition != AlertBelow {
+		return fmt.Errorf("condition must be %q or %q", AlertAbove, AlertBelow)
+	}
+
+	if a.Price <= 0 {
+		return fmt.Errorf("price must be greater than 0")
+	}
+
+	if a.Webhook != "" {
+		parsed, err := url.Parse(a.Webhook)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("webhook must be an http or https URL")
+		}
+	}
+
+	return nil
+}
+
+// Triggered checks whether a price meets the condition of the alert
+func (a *PriceAlert) Triggered(price float64) bool {
+	if price <= 0 {
+		return false
+	}
+
+	if a.Condition == AlertAbove {
+		return price >= a.Price
+	}
+
+	return price <= a.Price
+}
+
+// TriggeredAlert is an entry of a bot's alert history, recording a triggered alert and its webhook delivery.
+// The ID is the ID of the alert, so a bot can match every entry to the alert it created.
+type TriggeredAlert struct {
+	ID          string                 `json:"id" firestore:"-"`                          // ID of the triggered alert
+	Ticker      string                 `json:"ticker" firestore:"ticker"`                 // Ticker symbol
+	Condition   string                 `json:"condition" firestore:"condition"`           // "above" or "below"
+	AlertPrice  float64                `json:"alertPrice" firestore:"alertPrice"`         // Price level of the condition
+	Price       float64                `json:"price" firestore:"price"`                   // Live price that triggered the alert
+	Note        string                 `json:"note,omitempty" firestore:"note,omitempty"` // Note of the alert
+	TriggeredAt time.Time              `json:"triggeredAt" firestore:"triggeredAt"`       // When the alert triggered
+	Webhook     string                 `json:"webhook,omitempty" firestore:"webhook"`     // URL the alert is posted to
+	Status      string                 `json:"status" firestore:"status"`                 // Delivery state
+	Attempts    int                    `json:"attempts" firestore:"attempts"`             // Delivery attempts so far
+	NextAttempt time.Time              `json:"nextAttempt" firestore:"nextAttempt"`       // When a pending alert is retried
+	DeliveredAt time.Time              `json:"deliveredAt" firestore:"deliveredAt"`       // When the webhook accepted the alert
+	LastError   string                 `json:"lastError,omitempty" firestore:"lastError"` // Error of the last failed attempt
+	Bot         *firestore.DocumentRef `json:"-" firestore:"bot"`                         // Bot that created the alert
+}
+
+// Trigger creates the history entry of an alert triggered by a price
+func (a *PriceAlert) Trigger(price float64, now time.Time) *TriggeredAlert {
+	triggered := &TriggeredAlert{
+		ID:          a.ID,
+		Ticker:      a.Ticker,
+		Condition:   a.Condition,
+		AlertPrice:  a.Price,
+		Price:       price,
+		Note:        a.Note,
+		TriggeredAt: now,
+		Webhook:     a.Webhook,
+		Status:      AlertStreamOnly,
+		Bot:         a.Bot,
+	}
+
+	if a.Webhook != "" {
+		triggered.Status = AlertPending
+		triggered.NextAttempt = now
+	}
+
+	return triggered
+}
+
+// Due checks whether a pending alert should be delivered
+func (t *TriggeredAlert) Due(now time.Time) bool {
+	return t.Status == AlertPending && !t.NextAttempt.After(now)
+}
+
+// RecordAttempt records the result of a delivery attempt. Failed attempts are retried with exponential
+// backoff until AlertDeliveryLimit attempts failed, when the alert is dead lettered.
+func (t *TriggeredAlert) RecordAttempt(err error, now time.Time) {
+	t.Attempts++
+	if err == nil {
+		t.Status = AlertDelivered
+		t.DeliveredAt = now
+		t.NextAttempt = time.Time{}
+		t.LastError = ""
+		return
+	}
+
+	t.LastError = err.Error()
+	if t.Attempts >= AlertDeliveryLimit {
+		t.Status = AlertDeadLetter
+		t.NextAttempt = time.Time{}
+		return
+	}
+
+	delay := AlertRetryBase << (t.Attempts - 1)
+	if delay > AlertRetryMax || delay <= 0 {
+		delay = AlertRetryMax
+	}
+
+	t.NextAttempt = now.Add(delay)
+}
+
+// Requeue schedules another round of delivery attempts for a dead lettered alert
+func (t *TriggeredAlert) Requeue(now time.Time) error {
+	if t.Status != AlertDeadLetter {
+		return fmt.Errorf("only dead lettered alerts can be redelivered, the alert is %s", t.Status)
+	}
+
+	t.Status = AlertPending
+	t.Attempts = 0
+	t.NextAttempt = now
+	return nil
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// UnknownSector is the sector of tickers missing from the sector map
+const UnknownSector = "unknown"
+
+// SectorMap maps ticker symbols to their sector
+type SectorMap map[string]string
+
+// LoadSectorMap loads a JSON object mapping ticker symbols to sectors
+func LoadSectorMap(path string) (SectorMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]string)
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sector map: %v", err)
+	}
+
+	sectors := make(SectorMap, len(raw))
+	for ticker, sector := range raw {
+		sectors[symbols.Canonical(ticker)] = sector
+	}
+
+	return sectors, nil
+}
+
+// Of returns the sector of a ticker, UnknownSector if it is not mapped
+func (m SectorMap) Of(ticker string) string {
+	if sector, ok := m[ticker]; ok && sector != "" {
+		return sector
+	}
+
+	return UnknownSector
+}
+
+// PositionWeight is a holding's share of a portfolio's account value
+type PositionWeight struct {
+	Ticker    string  `json:"ticker"`    // Ticker symbol
+	Sector    string  `json:"sector"`    // Sector of the ticker
+	NumShares float64 `json:"numShares"` // Shares held
+	Value     float64 `json:"value"`     // Value of the shares at the live price
+	Weight    float64 `json:"weight"`    // Value as a share of the account value
+}
+
+// RiskMetrics are risk estimates of a portfolio's current positions from their recent daily returns
+type RiskMetrics struct {
+	Days          int     `json:"days"`          // Daily returns the estimates are based on
+	Volatility    float64 `json:"volatility"`    // Annualized standard deviation of the daily returns
+	ValueAtRisk95 float64 `json:"valueAtRisk95"` // Historical one day loss not exceeded on 95% of the days, as a share of the account value
+	MaxWeight     float64 `json:"maxWeight"`     // Largest weight of a single position
+	Concentration float64 `json:"concentration"` // Herfindahl index of the position weights, 1 for a single position
+}
+
+// Exposure is the composition of a portfolio valued at live prices
+type Exposure struct {
+	AccountValue float64            `json:"accountValue"` // Cash plus the value of every position
+	Cash         float64            `json:"cash"`         // Available cash
+	BuyingPower  float64            `json:"buyingPower"`  // Cash available for buys, equal to cash because trades are not margined
+	CashWeight   float64            `json:"cashWeight"`   // Cash as a share of the account value
+	Positions    []*PositionWeight  `json:"positions"`    // Weights of the positions, largest first
+	Sectors      map[string]float64 `json:"sectors"`      // Weight of every sector held
+	Risk         *RiskMetrics       `json:"risk"`         // Estimated risk of the positions
+}
+
+// CalculateExposure values the holdings of a portfolio at the given prices and breaks the account value
+// down by position and sector. Holdings without a price are valued at zero.
+func CalculateExposure(p *Portfolio, prices map[string]float64, sectors SectorMap) *Exposure {
+	policy := money.Default()
+	exposure := &Exposure{
+		Cash:        p.Cash,
+		BuyingPower: p.Cash,
+		Positions:   make([]*PositionWeight, 0, len(p.Holdings)),
+		Sectors:     make(map[string]float64),
+	}
+
+	values := []float64{p.Cash}
+	for ticker, holding := range p.Holdings {
+		if holding.NumShares == 0 {
+			continue
+		}
+
+		value := policy.Cost(holding.NumShares, prices[ticker])
+		values = append(values, value)
+		exposure.Positions = append(exposure.Positions, &PositionWeight{
+			Ticker:    ticker,
+			Sector:    sectors.Of(ticker),
+			NumShares: holding.NumShares,
+			Value:     value,
+		})
+	}
+
+	exposure.AccountValue = policy.Sum(values...)
+	if exposure.AccountValue > 0 {
+		exposure.CashWeight = p.Cash / exposure.AccountValue
+		for _, position := range exposure.Positions {
+			position.Weight = position.Value / exposure.AccountValue
+			exposure.Sectors[position.Sector] += position.Weight
+		}
+	}
+
+	sort.Slice(exposure.Positions, func(i, j int) bool {
+		if exposure.Positions[i].Weight != exposure.Positions[j].Weight {
+			return exposure.Positions[i].Weight > exposure.Positions[j].Weight
+		}
+
+		return exposure.Positions[i].Ticker < exposure.Positions[j].Ticker
+	})
+
+	return exposure
+}
+
+// EstimateRisk estimates the risk of the positions from the cached daily returns of the last rows of the
+// history, holding the current weights constant and cash at a zero return. Days on which a position has
+// no return are skipped. Returns only the concentration without at least two daily returns.
+func (h *History) EstimateRisk(positions []*PositionWeight, days int) *RiskMetrics {
+	risk := &RiskMetrics{}
+	for _, position := range positions {
+		risk.MaxWeight = math.Max(risk.MaxWeight, position.Weight)
+		risk.Concentration += position.Weight * position.Weight
+	}
+
+	if len(h.Rows) < 2 || days <= 0 {
+		return risk
+	}
+
+	// A portfolio of cash only never moves
+	if len(positions) == 0 {
+		risk.Days = min(days, len(h.Rows)-1)
+		return risk
+	}
+
+	since := h.Rows[max(len(h.Rows)-days, 1)].Date
+	matrix := h.Returns()
+	daily := make(map[time.Time]float64)
+	counts := make(map[time.Time]int)
+
+	for _, position := range positions {
+		for _, r := range matrix.Since(position.Ticker, since) {
+			daily[r.Date] += position.Weight * math.Expm1(r.LogReturn)
+			counts[r.Date]++
+		}
+	}
+
+	returns := make([]float64, 0, len(daily))
+	for date, r := range daily {
+		if counts[date] == len(positions) {
+			returns = append(returns, r)
+		}
+	}
+
+	risk.Days = len(returns)
+	if len(returns) < 2 {
+		return risk
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+
+	variance /= float64(len(returns) - 1)
+	risk.Volatility = math.Sqrt(variance * tradingDaysPerYear)
+
+	sorted := append([]float64{}, returns...)
+	sort.Float64s(sorted)
+	risk.ValueAtRisk95 = math.Max(-sorted[int(math.Floor(0.05*float64(len(sorted)-1)))], 0)
+
+	return risk
+}
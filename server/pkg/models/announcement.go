@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Categories of announcements
+const (
+	AnnouncementGeneral    = "general"     // Any other operational message
+	AnnouncementRuleChange = "rule_change" // A change of the trading or scoring rules
+	AnnouncementDowntime   = "downtime"    // Planned or unplanned unavailability of the server or a data source
+)
+
+// AnnouncementCategories lists every category of announcement
+var AnnouncementCategories = []string{AnnouncementGeneral, AnnouncementRuleChange, AnnouncementDowntime}
+
+// Announcement is a message from the organizers to every bot, or to the bots of one competition
+type Announcement struct {
+	ID          string    `json:"id" firestore:"-"`                    // ID of the announcement document
+	Category    string    `json:"category" firestore:"category"`       // "general", "rule_change" or "downtime"
+	Title       string    `json:"title" firestore:"title"`             // Short summary
+	Message     string    `json:"message" firestore:"message"`         // Full text of the announcement
+	Competition string    `json:"competition" firestore:"competition"` // ID of the competition addressed, empty for every bot
+	CreatedAt   time.Time `json:"createdAt" firestore:"createdAt"`     // When the announcement was posted
+}
+
+// Validate trims the text, defaults the category to "general" and checks that the category is known
+func (a *Announcement) Validate() error {
+	a.Title = strings.TrimSpace(a.Title)
+	a.Message = strings.TrimSpace(a.Message)
+	if a.Category == "" {
+		a.Category = AnnouncementGeneral
+	}
+
+	switch {
+	case a.Title == "":
+		return fmt.Errorf("announcement title is required")
+	case a.Message == "":
+		return fmt.Errorf("announcement message is required")
+	case !slices.Contains(AnnouncementCategories, a.Category):
+		return fmt.Errorf("unknown announcement category %q", a.Category)
+	}
+
+	return nil
+}
+
+// Addresses checks whether the announcement is meant for a bot of the competition, empty for bots outside any competition
+func (a *Announcement) Addresses(competition string) bool {
+	return a.Competition == "" || a.Competition == competition
+}
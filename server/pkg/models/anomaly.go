@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultMaxPriceJump is the largest factor a price can move by between two consecutive data points
+// before it is flagged as an anomaly, unless configured otherwise
+const DefaultMaxPriceJump = 5.0
+
+// anomalyLookbackRows is the number of rows searched for the previous close of a ticker, so a gap
+// in its history starts a new series instead of comparing against a stale close
+const anomalyLookbackRows = 10
+
+// Sources of price anomalies
+const (
+	AnomalySourceHistory = "history" // A daily bar downloaded into the history
+	AnomalySourceLive    = "live"    // A live price update
+)
+
+// PriceAnomaly is a price that was quarantined instead of being used, because it is invalid
+// or moved implausibly far from the previous price
+type PriceAnomaly struct {
+	Ticker   string        `json:"ticker"`           // Ticker of the price
+	Source   string        `json:"source"`           // "history" or "live"
+	Date     time.Time     `json:"date"`             // Date of the bar or time of the live price
+	Previous float64       `json:"previous"`         // Price the quarantined price was compared to, 0 if there was none
+	Price    float64       `json:"price"`            // Quarantined price
+	Reason   string        `json:"reason"`           // Why the price was quarantined
+	Period   *PackedPeriod `json:"period,omitempty"` // Quarantined bar, nil for live prices
+}
+
+// CheckPrice checks a price against the previous price of the same ticker and returns why it is anomalous,
+// or an empty string if it is plausible. Prices that are not positive and finite are always anomalous.
+// A price that moved by more than maxJump times in either direction is anomalous unless the split factor
+// explains the move. A previous price of 0 or a maxJump of 0 skips the jump check.
+func CheckPrice(previous, price, splitFactor, maxJump float64) string {
+	if price <= 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return fmt.Sprintf("price %g is not a positive number", price)
+	}
+
+	if previous <= 0 || maxJump <= 0 {
+		return ""
+	}
+
+	// A 2 for 1 split halves the price, so the previous price is compared at the post-split scale
+	expected := previous
+	if splitFactor > 0 {
+		expected /= splitFactor
+	}
+
+	if ratio := price / expected; ratio > maxJump || ratio < 1/maxJump {
+		return fmt.Sprintf("price moved %.2fx from %g without a matching split factor, more than the %gx limit", ratio, previous, maxJump)
+	}
+
+	return ""
+}
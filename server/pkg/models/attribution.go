@@ -0,0 +1,196 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// UntaggedStrategy is the strategy tag of transactions without a tag
+const UntaggedStrategy = "untagged"
+
+// Contribution is the profit and loss of a ticker or strategy tag over a period
+type Contribution struct {
+	Key        string  `json:"key"`        // Ticker or strategy tag
+	Realized   float64 `json:"realized"`   // Gains realized by sales in the period
+	Unrealized float64 `json:"unrealized"` // Gains of the shares still held at the end of the period
+	Fees       float64 `json:"fees"`       // Fees paid in the period
+	Total      float64 `json:"total"`      // Realized plus unrealized gains less fees
+	Trades     int     `json:"trades"`     // Transactions in the period
+}
+
+// Attribution decomposes the profit and loss of a portfolio over a period by ticker and strategy tag
+type Attribution struct {
+	Start      time.Time       `json:"start"`      // Start of the period, zero for the inception of the portfolio
+	End        time.Time       `json:"end"`        // End of the period
+	Currency   string          `json:"currency"`   // Currency of every amount
+	Realized   float64         `json:"realized"`   // Gains realized by sales in the period
+	Unrealized float64         `json:"unrealized"` // Gains of the shares still held at the end of the period
+	Fees       float64         `json:"fees"`       // Fees paid in the period
+	Total      float64         `json:"total"`      // Realized plus unrealized gains less fees
+	ByTicker   []*Contribution `json:"byTicker"`   // Contribution of every ticker, largest total first
+	ByTag      []*Contribution `json:"byTag"`      // Contribution of every strategy tag, largest total first
+	Unpriced   []string        `json:"unpriced"`   // Held tickers without a price, whose unrealized gains are left out
+}
+
+// attributionLot is a group of shares bought by a single transaction, marked at the start of the period
+type attributionLot struct {
+	numShares float64
+	cost      float64
+	tag       string
+}
+
+// PriceLookup returns the price of a ticker, false if it has none
+type PriceLookup func(ticker string) (float64, bool)
+
+// tagOf returns the strategy tag of a transaction
+func tagOf(transaction *Transaction) string {
+	if transaction.Tag == "" {
+		return UntaggedStrategy
+	}
+
+	return transaction.Tag
+}
+
+// Attribute replays the transactions of a portfolio as FIFO lots and attributes the profit and loss between
+// start and end to the ticker and strategy tag of each lot. Shares held at the start of the period are marked
+// at startPrice and shares held at the end at endPrice, so only the change within the period counts. A sale is
+// attributed to the tag of the purchase that opened the sold shares, and fees to the tag of their transaction.
+// A zero start attributes everything since inception.
+func Attribute(transactions []*Transaction, start, end time.Time, startPrice, endPrice PriceLookup, currency string) *Attribution {
+	sorted := append([]*Transaction{}, transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	lots := make(map[string][]*attributionLot)
+	tickers := make(map[string]*Contribution)
+	tags := make(map[string]*Contribution)
+	contribution := func(contributions map[string]*Contribution, key string) *Contribution {
+		if _, ok := contributions[key]; !ok {
+			contributions[key] = &Contribution{Key: key}
+		}
+
+		return contributions[key]
+	}
+
+	marked := start.IsZero()
+	mark := func() {
+		for ticker, held := range lots {
+			if price, ok := startPrice(ticker); ok {
+				for _, lot := range held {
+					lot.cost = price
+				}
+			}
+		}
+
+		marked = true
+	}
+
+	for _, transaction := range sorted {
+		if transaction.Time.After(end) {
+			break
+		}
+
+		if !marked && !transaction.Time.Before(start) {
+			mark()
+		}
+
+		inPeriod := marked
+		ticker := transaction.Ticker
+
+		switch transaction.Action {
+		case "buy":
+			lots[ticker] = append(lots[ticker], &attributionLot{transaction.NumShares, transaction.UnitCost, tagOf(transaction)})
+		case "sell":
+			remaining := transaction.NumShares
+			for len(lots[ticker]) > 0 && remaining > 0 {
+				lot := lots[ticker][0]
+				sold := min(lot.numShares, remaining)
+				if inPeriod {
+					gain := sold * (transaction.UnitCost - lot.cost)
+					contribution(tickers, ticker).Realized += gain
+					contribution(tags, lot.tag).Realized += gain
+				}
+
+				lot.numShares -= sold
+				remaining -= sold
+				if lot.numShares <= 0 {
+					lots[ticker] = lots[ticker][1:]
+				}
+			}
+		}
+
+		if inPeriod {
+			contribution(tickers, ticker).Fees += transaction.Fee
+			contribution(tickers, ticker).Trades++
+			contribution(tags, tagOf(transaction)).Fees += transaction.Fee
+			contribution(tags, tagOf(transaction)).Trades++
+		}
+	}
+
+	if !marked {
+		mark()
+	}
+
+	attribution := &Attribution{Start: start, End: end, Currency: currency, Unpriced: make([]string, 0)}
+	for ticker, held := range lots {
+		if len(held) == 0 {
+			continue
+		}
+
+		price, ok := endPrice(ticker)
+		if !ok {
+			attribution.Unpriced = append(attribution.Unpriced, ticker)
+			continue
+		}
+
+		for _, lot := range held {
+			gain := lot.numShares * (price - lot.cost)
+			contribution(tickers, ticker).Unrealized += gain
+			contribution(tags, lot.tag).Unrealized += gain
+		}
+	}
+
+	sort.Strings(attribution.Unpriced)
+	attribution.ByTicker = finishContributions(tickers)
+	attribution.ByTag = finishContributions(tags)
+
+	policy := money.Default()
+	for _, c := range attribution.ByTicker {
+		attribution.Realized += c.Realized
+		attribution.Unrealized += c.Unrealized
+		attribution.Fees += c.Fees
+	}
+
+	attribution.Realized = policy.Round(attribution.Realized)
+	attribution.Unrealized = policy.Round(attribution.Unrealized)
+	attribution.Fees = policy.Round(attribution.Fees)
+	attribution.Total = policy.Sub(policy.Add(attribution.Realized, attribution.Unrealized), attribution.Fees)
+
+	return attribution
+}
+
+// finishContributions rounds the contributions, calculates their totals and sorts them by total, largest first
+func finishContributions(contributions map[string]*Contribution) []*Contribution {
+	policy := money.Default()
+	finished := make([]*Contribution, 0, len(contributions))
+	for _, c := range contributions {
+		c.Realized = policy.Round(c.Realized)
+		c.Unrealized = policy.Round(c.Unrealized)
+		c.Fees = policy.Round(c.Fees)
+		c.Total = policy.Sub(policy.Add(c.Realized, c.Unrealized), c.Fees)
+		finished = append(finished, c)
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		if finished[i].Total != finished[j].Total {
+			return finished[i].Total > finished[j].Total
+		}
+
+		return finished[i].Key < finished[j].Key
+	})
+
+	return finished
+}
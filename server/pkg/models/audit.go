@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// AuditEntry records an administrative action that changed how the competition runs
+type AuditEntry struct {
+	Time     time.Time `json:"time" firestore:"time"`         // When the action was taken
+	Action   string    `json:"action" firestore:"action"`     // Name of the action, such as "market_override.set"
+	Detail   string    `json:"detail" firestore:"detail"`     // Human readable description of the action
+	Data     any       `json:"data" firestore:"data"`         // State the action applied, nil if none
+	ClientIP string    `json:"clientIp" firestore:"clientIp"` // Address the request came from
+}
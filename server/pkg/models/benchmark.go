@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Kinds of instruments
+const (
+	InstrumentStock = "stock" // A company's shares, the kind of every ticker that is not a benchmark
+	InstrumentETF   = "etf"   // An exchange traded fund
+	InstrumentIndex = "index" // A market index, tracked through a ticker whose history Tiingo serves
+)
+
+// Benchmark is an index or ETF that portfolios are measured against. Benchmarks are always watched,
+// so their history and live price are available without any bot adding them to the watchlist.
+type Benchmark struct {
+	Ticker      string `json:"ticker"`      // Ticker symbol the history and prices are downloaded for
+	Kind        string `json:"kind"`        // "etf" or "index"
+	Name        string `json:"name"`        // Name of the index or fund
+	Description string `json:"description"` // What the benchmark tracks
+	Tradeable   bool   `json:"tradeable"`   // Whether bots may buy the benchmark, held shares can always be sold
+}
+
+// LoadBenchmarks loads a JSON array of benchmarks
+func LoadBenchmarks(path string) ([]*Benchmark, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmarks := make([]*Benchmark, 0)
+	err = json.Unmarshal(data, &benchmarks)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing benchmarks: %v", err)
+	}
+
+	seen := make(map[string]bool, len(benchmarks))
+	for i, benchmark := range benchmarks {
+		benchmark.Ticker = symbols.Canonical(benchmark.Ticker)
+		if benchmark.Ticker == "" {
+			return nil, fmt.Errorf("benchmark %d has no ticker", i)
+		}
+
+		if seen[benchmark.Ticker] {
+			return nil, fmt.Errorf("benchmark %s is listed more than once", benchmark.Ticker)
+		}
+
+		if benchmark.Kind != InstrumentETF && benchmark.Kind != InstrumentIndex {
+			return nil, fmt.Errorf("benchmark %s has invalid kind %q, expected %q or %q", benchmark.Ticker, benchmark.Kind, InstrumentETF, InstrumentIndex)
+		}
+
+		seen[benchmark.Ticker] = true
+	}
+
+	return benchmarks, nil
+}
+
+// BenchmarkValues returns the daily values of an investment of startValue in a ticker at the adjusted close of
+// the first row on or after start, so dividends are reinvested. Returns nil if the ticker has no close since start.
+func (h *History) BenchmarkValues(ticker string, start time.Time, startValue float64) []*AccountValueHistory {
+	var values []*AccountValueHistory
+	startClose := 0.0
+
+	for _, row := range h.Range(start, time.Time{}) {
+		period, ok := row.Data.Load(ticker)
+		if !ok || period.AdjClose <= 0 {
+			continue
+		}
+
+		if startClose == 0 {
+			startClose = period.AdjClose
+		}
+
+		values = append(values, &AccountValueHistory{Date: row.Date, Value: startValue * period.AdjClose / startClose})
+	}
+
+	return values
+}
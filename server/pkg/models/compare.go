@@ -0,0 +1,92 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// ComparisonPoint is a day on which two portfolios both have an account value
+type ComparisonPoint struct {
+	Date        time.Time `json:"date"`        // Day of the valuation
+	Value       float64   `json:"value"`       // Account value of the first portfolio
+	OtherValue  float64   `json:"otherValue"`  // Account value of the second portfolio
+	Return      float64   `json:"return"`      // Return of the first portfolio since the first point
+	OtherReturn float64   `json:"otherReturn"` // Return of the second portfolio since the first point
+}
+
+// AlignAccountValues pairs the account values of two portfolios by day, oldest first.
+// Days on which either portfolio has no positive value are skipped, and a later value
+// replaces an earlier one of the same day. Returns are relative to the first aligned day.
+func AlignAccountValues(a, b []*AccountValueHistory) []*ComparisonPoint {
+	others := make(map[time.Time]float64, len(b))
+	for _, history := range b {
+		if history.Value > 0 {
+			others[history.Date.UTC().Truncate(24*time.Hour)] = history.Value
+		}
+	}
+
+	byDay := make(map[time.Time]*ComparisonPoint, len(a))
+	for _, history := range a {
+		day := history.Date.UTC().Truncate(24 * time.Hour)
+		other, ok := others[day]
+		if !ok || history.Value <= 0 {
+			continue
+		}
+
+		byDay[day] = &ComparisonPoint{Date: day, Value: history.Value, OtherValue: other}
+	}
+
+	points := make([]*ComparisonPoint, 0, len(byDay))
+	for _, point := range byDay {
+		points = append(points, point)
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Date.Before(points[j].Date)
+	})
+
+	for _, point := range points {
+		point.Return = point.Value/points[0].Value - 1
+		point.OtherReturn = point.OtherValue/points[0].OtherValue - 1
+	}
+
+	return points
+}
+
+// ReturnCorrelation returns the Pearson correlation of the day-to-day returns of two aligned
+// portfolios. Returns 0 without at least two returns or when either portfolio never moved.
+func ReturnCorrelation(points []*ComparisonPoint) float64 {
+	if len(points) < 3 {
+		return 0
+	}
+
+	x := make([]float64, 0, len(points)-1)
+	y := make([]float64, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		x = append(x, points[i].Value/points[i-1].Value-1)
+		y = append(y, points[i].OtherValue/points[i-1].OtherValue-1)
+	}
+
+	meanX, meanY := 0.0, 0.0
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+
+	meanX /= float64(len(x))
+	meanY /= float64(len(y))
+
+	covariance, varianceX, varianceY := 0.0, 0.0, 0.0
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		varianceX += (x[i] - meanX) * (x[i] - meanX)
+		varianceY += (y[i] - meanY) * (y[i] - meanY)
+	}
+
+	if varianceX == 0 || varianceY == 0 {
+		return 0
+	}
+
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
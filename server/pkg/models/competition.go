@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ranking metrics a competition can be ranked by
+const (
+	MetricAccountValue     = "account_value"     // Current account value, favors bots that started earliest
+	MetricReturn           = "return"            // Return since the bot's own inception
+	MetricAnnualizedReturn = "annualized_return" // Return since inception, annualized for bots older than a year
+	MetricScore            = "score"             // Composite score of the last settlement, see ScoringRules
+)
+
+// Competition groups bots that trade against each other.
+// Bots join during the registration window, after which entries are locked.
+type Competition struct {
+	Name               string          `json:"name" firestore:"name"`                                 // Display name
+	Description        string          `json:"description" firestore:"description"`                   // Description shown to participants
+	StartingCash       float64         `json:"startingCash" firestore:"startingCash"`                 // Cash every bot starts with
+	RegistrationOpens  time.Time       `json:"registrationOpens" firestore:"registrationOpens"`       // When bots may start joining
+	RegistrationCloses time.Time       `json:"registrationCloses" firestore:"registrationCloses"`     // When entries lock
+	Starts             time.Time       `json:"starts" firestore:"starts"`                             // When trading starts
+	Ends               time.Time       `json:"ends" firestore:"ends"`                                 // When trading ends
+	EntryCode          string          `json:"entryCode" firestore:"entryCode"`                       // Code required to join, empty if anyone may join
+	MaxEntrants        int             `json:"maxEntrants" firestore:"maxEntrants"`                   // Maximum number of bots, 0 for no limit
+	Entrants           int             `json:"entrants" firestore:"entrants"`                         // Number of bots that joined
+	RankingMetric      string          `json:"rankingMetric" firestore:"rankingMetric"`               // Official ranking metric, empty for account_value
+	ScoringRules       []ScoringRule   `json:"scoringRules" firestore:"scoringRules"`                 // Bonuses and penalties applied to the composite score at settlement
+	Universe           string          `json:"universe" firestore:"universe"`                         // Index whose constituents bots may buy, empty if every ticker can be bought
+	CostBasisMethod    CostBasisMethod `json:"costBasisMethod" firestore:"costBasisMethod,omitempty"` // How sold shares are matched to purchases, fixed when the competition is created
+	ArchivedAt         time.Time       `json:"archivedAt,omitempty" firestore:"archivedAt,omitempty"` // When the competition was moved to cold storage, zero if it is in Firestore
+	Archive            string          `json:"archive,omitempty" firestore:"archive,omitempty"`       // Name of the cold storage object holding its archive, empty if it is not archived
+}
+
+// Validate checks that the competition's settings are consistent
+func (c *Competition) Validate() error {
+	switch {
+	case c.Name == "":
+		return fmt.Errorf("name is required")
+	case c.StartingCash <= 0:
+		return fmt.Errorf("startingCash must be positive")
+	case c.MaxEntrants < 0:
+		return fmt.Errorf("maxEntrants must not be negative")
+	case !c.RegistrationOpens.Before(c.RegistrationCloses):
+		return fmt.Errorf("registrationOpens must be before registrationCloses")
+	case !c.Starts.IsZero() && !c.Ends.IsZero() && !c.Starts.Before(c.Ends):
+		return fmt.Errorf("starts must be before ends")
+	case !ValidRankingMetric(c.RankingMetric):
+		return fmt.Errorf("rankingMetric must be account_value, return, annualized_return or score")
+	case c.CostBasisMethod != "" && c.CostBasisMethod != AverageCost && c.CostBasisMethod != FIFO:
+		return fmt.Errorf("costBasisMethod must be average or fifo")
+	}
+
+	return ValidateScoringRules(c.ScoringRules)
+}
+
+// CostBasis returns the cost basis method of the competition's portfolios.
+// Competitions created before the method was recorded use the server default.
+func (c *Competition) CostBasis() CostBasisMethod {
+	if c.CostBasisMethod == "" {
+		return DefaultCostBasisMethod()
+	}
+
+	return c.CostBasisMethod
+}
+
+// RegistrationOpen checks whether bots may join or reset at the given time
+func (c *Competition) RegistrationOpen(at time.Time) bool {
+	return !at.Before(c.RegistrationOpens) && at.Before(c.RegistrationCloses)
+}
+
+// Full checks whether the competition has reached its maximum number of entrants
+func (c *Competition) Full() bool {
+	return c.MaxEntrants > 0 && c.Entrants >= c.MaxEntrants
+}
+
+// Metric returns the official ranking metric of the competition
+func (c *Competition) Metric() string {
+	if c.RankingMetric == "" {
+		return MetricAccountValue
+	}
+
+	return c.RankingMetric
+}
+
+// ValidRankingMetric checks whether a metric can rank a competition, empty selects account_value
+func ValidRankingMetric(metric string) bool {
+	switch metric {
+	case "", MetricAccountValue, MetricReturn, MetricAnnualizedReturn, MetricScore:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateScoringRules checks every scoring rule of a competition
+func ValidateScoringRules(rules []ScoringRule) error {
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("scoring rule %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
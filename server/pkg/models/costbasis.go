@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// CostBasisMethod determines how the purchase value of a holding is tracked
+// and which shares are considered sold
+type CostBasisMethod string
+
+// Supported cost basis methods
+const (
+	AverageCost CostBasisMethod = "average" // Every share costs the weighted average purchase price
+	FIFO        CostBasisMethod = "fifo"    // Shares are sold in the order they were bought
+)
+
+var (
+	costBasisMu     sync.RWMutex
+	costBasisMethod = AverageCost
+)
+
+// ParseCostBasisMethod parses the name of a cost basis method
+func ParseCostBasisMethod(name string) (CostBasisMethod, error) {
+	method := CostBasisMethod(strings.ToLower(name))
+	switch method {
+	case AverageCost, FIFO:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown cost basis method %q", name)
+	}
+}
+
+// DefaultCostBasisMethod returns the cost basis method of competitions created without one
+func DefaultCostBasisMethod() CostBasisMethod {
+	costBasisMu.RLock()
+	defer costBasisMu.RUnlock()
+
+	return costBasisMethod
+}
+
+// SetDefaultCostBasisMethod replaces the cost basis method of competitions created without one.
+// Existing competitions and portfolios keep the method they were created with.
+func SetDefaultCostBasisMethod(method CostBasisMethod) {
+	costBasisMu.Lock()
+	defer costBasisMu.Unlock()
+
+	costBasisMethod = method
+}
+
+// Lot is a group of shares bought in a single transaction
+type Lot struct {
+	NumShares float64   `json:"numShares" firestore:"numShares"` // Number of shares remaining from the purchase
+	UnitCost  float64   `json:"unitCost" firestore:"unitCost"`   // Price per share paid
+	Time      time.Time `json:"time" firestore:"time"`           // When the shares were bought
+}
+
+// Buy adds purchased shares to a holding and updates its purchase value
+func (m CostBasisMethod) Buy(holding *Holding, numShares, unitCost float64, at time.Time) {
+	switch m {
+	case FIFO:
+		holding.seedLots()
+		holding.Lots = append(holding.Lots, &Lot{numShares, unitCost, at})
+		holding.NumShares += numShares
+		holding.PurchaseValue = averageLotCost(holding.Lots)
+	default:
+		total := holding.NumShares + numShares
+		if total > 0 {
+			holding.PurchaseValue = (holding.PurchaseValue*holding.NumShares + numShares*unitCost) / total
+		}
+
+		holding.NumShares = total
+	}
+}
+
+// Sell removes sold shares from a holding, updates its purchase value and returns the realized gain.
+// The purchase value of the remaining shares does not depend on the sale price.
+func (m CostBasisMethod) Sell(holding *Holding, numShares, unitPrice float64) float64 {
+	policy := money.Default()
+	var realized float64
+
+	switch m {
+	case FIFO:
+		holding.seedLots()
+
+		remaining := numShares
+		proceeds := make([]float64, 0, len(holding.Lots))
+		for len(holding.Lots) > 0 && remaining > 0 {
+			lot := holding.Lots[0]
+			sold := min(lot.NumShares, remaining)
+
+			proceeds = append(proceeds, policy.Cost(sold, unitPrice-lot.UnitCost))
+			lot.NumShares -= sold
+			remaining -= sold
+
+			if lot.NumShares <= 0 {
+				holding.Lots = holding.Lots[1:]
+			}
+		}
+
+		realized = policy.Sum(proceeds...)
+		holding.NumShares -= numShares
+		holding.PurchaseValue = averageLotCost(holding.Lots)
+	default:
+		realized = policy.Cost(numShares, unitPrice-holding.PurchaseValue)
+		holding.NumShares -= numShares
+	}
+
+	holding.RealizedGain = policy.Add(holding.RealizedGain, realized)
+	return realized
+}
+
+// seedLots converts shares bought before lots were tracked into a single lot at the purchase value
+func (h *Holding) seedLots() {
+	tracked := 0.0
+	for _, lot := range h.Lots {
+		tracked += lot.NumShares
+	}
+
+	if untracked := h.NumShares - tracked; untracked > 0 {
+		h.Lots = append([]*Lot{{NumShares: untracked, UnitCost: h.PurchaseValue}}, h.Lots...)
+	}
+}
+
+// averageLotCost returns the weighted average cost per share of the lots, or 0 if there are no shares
+func averageLotCost(lots []*Lot) float64 {
+	var shares, cost float64
+	for _, lot := range lots {
+		shares += lot.NumShares
+		cost += lot.NumShares * lot.UnitCost
+	}
+
+	if shares <= 0 {
+		return 0
+	}
+
+	return cost / shares
+}
+
+// Copy returns a deep copy of the holding
+func (h *Holding) Copy() *Holding {
+	copied := *h
+	if h.Lots != nil {
+		copied.Lots = make([]*Lot, len(h.Lots))
+		for i, lot := range h.Lots {
+			lotCopy := *lot
+			copied.Lots[i] = &lotCopy
+		}
+	}
+
+	return &copied
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// day returns midnight UTC of a day in January 2024
+func day(d int) time.Time {
+	return time.Date(2024, time.January, d, 0, 0, 0, 0, time.UTC)
+}
+
+// closeTo checks whether two amounts are equal up to floating point error
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// checkLots fails the test if the lots of a holding differ from the expected shares and unit costs, oldest first
+func checkLots(t *testing.T, holding *Holding, want ...Lot) {
+	t.Helper()
+
+	if len(holding.Lots) != len(want) {
+		t.Fatalf("got %d lots, want %d", len(holding.Lots), len(want))
+	}
+
+	for i, lot := range holding.Lots {
+		if !closeTo(lot.NumShares, want[i].NumShares) || !closeTo(lot.UnitCost, want[i].UnitCost) {
+			t.Errorf("lot %d = %g shares at %g, want %g shares at %g", i, lot.NumShares, lot.UnitCost, want[i].NumShares, want[i].UnitCost)
+		}
+	}
+}
+
+func TestAverageCostBuy(t *testing.T) {
+	tests := []struct {
+		name          string
+		holding       Holding
+		numShares     float64
+		unitCost      float64
+		wantShares    float64
+		wantPurchased float64
+	}{
+		{"first purchase", Holding{}, 5, 10, 5, 10},
+		{"same price", Holding{NumShares: 10, PurchaseValue: 100}, 10, 100, 20, 100},
+		// The old shares are weighted by the shares held before the buy, not the updated total
+		{"weighted by previous shares", Holding{NumShares: 10, PurchaseValue: 100}, 10, 200, 20, 150},
+		{"uneven weights", Holding{NumShares: 30, PurchaseValue: 10}, 10, 50, 40, 20},
+		{"fractional shares", Holding{NumShares: 0.5, PurchaseValue: 40}, 1.5, 80, 2, 70},
+		{"no shares", Holding{NumShares: 3, PurchaseValue: 12}, 0, 50, 3, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holding := tt.holding
+			AverageCost.Buy(&holding, tt.numShares, tt.unitCost, day(1))
+
+			if !closeTo(holding.NumShares, tt.wantShares) {
+				t.Errorf("NumShares = %g, want %g", holding.NumShares, tt.wantShares)
+			}
+
+			if !closeTo(holding.PurchaseValue, tt.wantPurchased) {
+				t.Errorf("PurchaseValue = %g, want %g", holding.PurchaseValue, tt.wantPurchased)
+			}
+
+			if len(holding.Lots) != 0 {
+				t.Errorf("average cost tracked %d lots", len(holding.Lots))
+			}
+		})
+	}
+}
+
+func TestAverageCostSell(t *testing.T) {
+	holding := &Holding{NumShares: 20, PurchaseValue: 150, RealizedGain: 5}
+
+	realized := AverageCost.Sell(holding, 5, 170)
+	if realized != 100 {
+		t.Errorf("realized = %g, want 100", realized)
+	}
+
+	if holding.RealizedGain != 105 {
+		t.Errorf("RealizedGain = %g, want 105", holding.RealizedGain)
+	}
+
+	// The purchase value of the remaining shares does not depend on the sale price
+	if holding.NumShares != 15 || holding.PurchaseValue != 150 {
+		t.Errorf("holding = %g shares at %g, want 15 at 150", holding.NumShares, holding.PurchaseValue)
+	}
+
+	realized = AverageCost.Sell(holding, 15, 140)
+	if realized != -150 {
+		t.Errorf("realized = %g, want -150", realized)
+	}
+
+	if holding.NumShares != 0 || holding.RealizedGain != -45 {
+		t.Errorf("holding = %g shares with %g realized, want 0 with -45", holding.NumShares, holding.RealizedGain)
+	}
+}
+
+func TestFIFOBuy(t *testing.T) {
+	holding := &Holding{}
+	FIFO.Buy(holding, 10, 100, day(1))
+	FIFO.Buy(holding, 30, 120, day(2))
+
+	checkLots(t, holding, Lot{NumShares: 10, UnitCost: 100}, Lot{NumShares: 30, UnitCost: 120})
+	if holding.NumShares != 40 || !closeTo(holding.PurchaseValue, 115) {
+		t.Errorf("holding = %g shares at %g, want 40 at 115", holding.NumShares, holding.PurchaseValue)
+	}
+
+	if !holding.Lots[1].Time.Equal(day(2)) {
+		t.Errorf("lot time = %v, want %v", holding.Lots[1].Time, day(2))
+	}
+}
+
+func TestFIFOSell(t *testing.T) {
+	tests := []struct {
+		name          string
+		numShares     float64
+		unitPrice     float64
+		wantRealized  float64
+		wantLots      []Lot
+		wantPurchased float64
+	}{
+		{"part of the first lot", 4, 110, 40, []Lot{{NumShares: 6, UnitCost: 100}, {NumShares: 20, UnitCost: 120}, {NumShares: 10, UnitCost: 90}}, 3900.0 / 36},
+		{"exactly the first lot", 10, 110, 100, []Lot{{NumShares: 20, UnitCost: 120}, {NumShares: 10, UnitCost: 90}}, 110},
+		{"spanning lots", 25, 130, 10*30 + 15*10, []Lot{{NumShares: 5, UnitCost: 120}, {NumShares: 10, UnitCost: 90}}, 1500.0 / 15},
+		{"spanning every lot", 40, 100, 0 - 20*20 + 10*10, nil, 0},
+		{"at a loss", 12, 95, 10*-5 + 2*-25, []Lot{{NumShares: 18, UnitCost: 120}, {NumShares: 10, UnitCost: 90}}, 3060.0 / 28},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holding := &Holding{}
+			FIFO.Buy(holding, 10, 100, day(1))
+			FIFO.Buy(holding, 20, 120, day(2))
+			FIFO.Buy(holding, 10, 90, day(3))
+
+			realized := FIFO.Sell(holding, tt.numShares, tt.unitPrice)
+			if !closeTo(realized, tt.wantRealized) {
+				t.Errorf("realized = %g, want %g", realized, tt.wantRealized)
+			}
+
+			if !closeTo(holding.RealizedGain, tt.wantRealized) {
+				t.Errorf("RealizedGain = %g, want %g", holding.RealizedGain, tt.wantRealized)
+			}
+
+			if !closeTo(holding.NumShares, 40-tt.numShares) {
+				t.Errorf("NumShares = %g, want %g", holding.NumShares, 40-tt.numShares)
+			}
+
+			if !closeTo(holding.PurchaseValue, tt.wantPurchased) {
+				t.Errorf("PurchaseValue = %g, want %g", holding.PurchaseValue, tt.wantPurchased)
+			}
+
+			checkLots(t, holding, tt.wantLots...)
+		})
+	}
+}
+
+func TestFIFOSeedsLots(t *testing.T) {
+	// Shares bought before lots were tracked become the oldest lot, at the average purchase value
+	holding := &Holding{NumShares: 10, PurchaseValue: 50}
+	FIFO.Buy(holding, 10, 70, day(5))
+
+	checkLots(t, holding, Lot{NumShares: 10, UnitCost: 50}, Lot{NumShares: 10, UnitCost: 70})
+	if !holding.Lots[0].Time.IsZero() {
+		t.Errorf("seeded lot time = %v, want zero", holding.Lots[0].Time)
+	}
+
+	if !closeTo(holding.PurchaseValue, 60) {
+		t.Errorf("PurchaseValue = %g, want 60", holding.PurchaseValue)
+	}
+
+	// A sell seeds the untracked shares too, and sells them first
+	holding = &Holding{NumShares: 8, PurchaseValue: 25}
+	realized := FIFO.Sell(holding, 3, 30)
+	if realized != 15 {
+		t.Errorf("realized = %g, want 15", realized)
+	}
+
+	checkLots(t, holding, Lot{NumShares: 5, UnitCost: 25})
+
+	// Only the shares not covered by lots are seeded
+	holding = &Holding{NumShares: 12, PurchaseValue: 40, Lots: []*Lot{{NumShares: 4, UnitCost: 60}}}
+	holding.seedLots()
+	checkLots(t, holding, Lot{NumShares: 8, UnitCost: 40}, Lot{NumShares: 4, UnitCost: 60})
+
+	// Fully tracked holdings are left alone
+	holding.seedLots()
+	checkLots(t, holding, Lot{NumShares: 8, UnitCost: 40}, Lot{NumShares: 4, UnitCost: 60})
+}
+
+func TestParseCostBasisMethod(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    CostBasisMethod
+		wantErr bool
+	}{
+		{"average", AverageCost, false},
+		{"fifo", FIFO, false},
+		{"FIFO", FIFO, false},
+		{"Average", AverageCost, false},
+		{"", "", true},
+		{"lifo", "", true},
+		{" fifo", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCostBasisMethod(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("method = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortfolioCostBasis(t *testing.T) {
+	// Portfolios keep their own method whatever the server default is
+	SetDefaultCostBasisMethod(FIFO)
+	defer SetDefaultCostBasisMethod(AverageCost)
+
+	tests := []struct {
+		name         string
+		method       CostBasisMethod
+		wantRealized float64
+		wantLots     []Lot
+	}{
+		{"fifo", FIFO, 5 * 15, []Lot{{NumShares: 5, UnitCost: 100}, {NumShares: 10, UnitCost: 130}}},
+		{"average", AverageCost, 5 * 0, nil},
+		{"unset", "", 5 * 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portfolio := NewPortfolio(10000)
+			portfolio.CostBasisMethod = tt.method
+
+			for _, transaction := range []*Transaction{
+				{Action: "buy", Ticker: "AAPL", NumShares: 10, UnitCost: 100, Time: day(1)},
+				{Action: "buy", Ticker: "AAPL", NumShares: 10, UnitCost: 130, Time: day(2)},
+				{Action: "sell", Ticker: "AAPL", NumShares: 5, UnitCost: 115, Time: day(3)},
+			} {
+				if err := portfolio.Execute(transaction); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			holding := portfolio.Holdings["AAPL"]
+			if !closeTo(holding.RealizedGain, tt.wantRealized) {
+				t.Errorf("RealizedGain = %g, want %g", holding.RealizedGain, tt.wantRealized)
+			}
+
+			checkLots(t, holding, tt.wantLots...)
+		})
+	}
+}
+
+func TestCompetitionCostBasis(t *testing.T) {
+	competition := &Competition{}
+	if got := competition.CostBasis(); got != AverageCost {
+		t.Errorf("CostBasis() = %q, want the default %q", got, AverageCost)
+	}
+
+	SetDefaultCostBasisMethod(FIFO)
+	defer SetDefaultCostBasisMethod(AverageCost)
+
+	if got := competition.CostBasis(); got != FIFO {
+		t.Errorf("CostBasis() = %q, want the default %q", got, FIFO)
+	}
+
+	competition.CostBasisMethod = AverageCost
+	if got := competition.CostBasis(); got != AverageCost {
+		t.Errorf("CostBasis() = %q, want the competition's %q", got, AverageCost)
+	}
+}
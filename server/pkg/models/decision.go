@@ -0,0 +1,114 @@
+// Package models defines the data structures used throughout the AlgoBattle application.
+// It includes models for portfolios, transactions, stock data, and related entities.
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// RuleEvaluation is the outcome of checking a single trading rule against a transaction.
+type RuleEvaluation struct {
+	Rule   string `json:"rule" firestore:"rule"`     // Name of the rule
+	Passed bool   `json:"passed" firestore:"passed"` // Whether the transaction satisfied the rule
+	Detail string `json:"detail" firestore:"detail"` // Reason the rule failed, empty if it passed
+}
+
+// OrderDecision records every input used to accept or reject a transaction request.
+// Decisions are stored for rejected requests as well as fills, so that disputes
+// can be resolved by replaying the recorded state.
+type OrderDecision struct {
+	Time             time.Time              `json:"time" firestore:"time"`                                 // When the request was evaluated
+	Bot              *firestore.DocumentRef `json:"-" firestore:"bot"`                                     // Reference to the bot that made the request
+	Action           string                 `json:"action" firestore:"action"`                             // Requested action, "buy" or "sell"
+	Ticker           string                 `json:"ticker" firestore:"ticker"`                             // Requested ticker symbol
+	NumShares        float64                `json:"numShares" firestore:"numShares"`                       // Requested number of shares
+	Price            float64                `json:"price" firestore:"price"`                               // Price used for the fill, after session slippage
+	Fee              float64                `json:"fee" firestore:"fee"`                                   // Fee charged for the fill
+	Session          string                 `json:"session" firestore:"session"`                           // Trading session at the time of the request
+	LimitPrice       float64                `json:"limitPrice" firestore:"limitPrice"`                     // Worst acceptable fill price requested by the bot, 0 if none
+	ReferencePrice   float64                `json:"referencePrice" firestore:"referencePrice"`             // Price the bot based its decision on, 0 if none
+	MaxSlippageBps   float64                `json:"maxSlippageBps" firestore:"maxSlippageBps"`             // Largest acceptable adverse move from the reference price in basis points, 0 if none
+	PriceTime        time.Time              `json:"priceTime" firestore:"priceTime"`                       // When the price was last updated
+	PriceSource      string                 `json:"priceSource" firestore:"priceSource"`                   // Data source that provided the price
+	CashBefore       float64                `json:"cashBefore" firestore:"cashBefore"`                     // Cash balance before the request
+	HoldingBefore    *Holding               `json:"holdingBefore" firestore:"holdingBefore"`               // Holding of the ticker before the request, nil if none
+	CostBasisMethod  CostBasisMethod        `json:"costBasisMethod" firestore:"costBasisMethod,omitempty"` // Cost basis method of the portfolio, empty for decisions recorded before it was stored
+	Rules            []RuleEvaluation       `json:"rules" firestore:"rules"`                               // Outcome of every portfolio rule that was checked
+	CompetitionRules []RuleEvaluation       `json:"competitionRules" firestore:"competitionRules"`         // Outcome of every competition rule that was checked
+	Accepted         bool                   `json:"accepted" firestore:"accepted"`                         // Whether the transaction was executed
+	Error            string                 `json:"error" firestore:"error"`                               // Reason for rejection, empty if accepted
+	Transaction      *firestore.DocumentRef `json:"-" firestore:"transaction"`                             // Reference to the executed transaction, nil if rejected
+}
+
+// FirstFailure returns the detail of the first failed rule as an error, or nil if every rule passed.
+func FirstFailure(rules []RuleEvaluation) error {
+	for _, rule := range rules {
+		if !rule.Passed {
+			return errors.New(rule.Detail)
+		}
+	}
+
+	return nil
+}
+
+// PriceRules checks the fill price against the price protection requested by the bot.
+// Rules the bot did not request are omitted.
+func (d *OrderDecision) PriceRules() []RuleEvaluation {
+	rules := make([]RuleEvaluation, 0, 2)
+
+	if d.LimitPrice > 0 {
+		passed := d.Price <= d.LimitPrice
+		if d.Action == "sell" {
+			passed = d.Price >= d.LimitPrice
+		}
+
+		rules = append(rules, newRuleEvaluation("limit_price", passed,
+			fmt.Sprintf("fill price %.4f of %s violates the limit price %.4f", d.Price, d.Ticker, d.LimitPrice)))
+	}
+
+	if d.MaxSlippageBps > 0 && d.ReferencePrice > 0 {
+		slippage := (d.Price - d.ReferencePrice) / d.ReferencePrice * 10000
+		if d.Action == "sell" {
+			slippage = -slippage
+		}
+
+		rules = append(rules, newRuleEvaluation("max_slippage", slippage <= d.MaxSlippageBps,
+			fmt.Sprintf("fill price %.4f of %s is %.1f bps worse than the reference price %.4f, the maximum is %.1f bps",
+				d.Price, d.Ticker, slippage, d.ReferencePrice, d.MaxSlippageBps)))
+	}
+
+	return rules
+}
+
+// ReplayPortfolio rebuilds the portion of a portfolio that the decision depended on.
+func (d *OrderDecision) ReplayPortfolio() *Portfolio {
+	portfolio := NewPortfolio(d.CashBefore)
+	portfolio.CostBasisMethod = d.CostBasisMethod
+	if portfolio.CostBasisMethod == "" && d.HoldingBefore != nil && len(d.HoldingBefore.Lots) > 0 {
+		// Decisions recorded before the method was stored only show it through the holding's lots
+		portfolio.CostBasisMethod = FIFO
+	}
+	if d.HoldingBefore != nil {
+		portfolio.Holdings[d.Ticker] = d.HoldingBefore.Copy()
+	}
+
+	return portfolio
+}
+
+// ReplayTransaction rebuilds the transaction that was evaluated for the decision.
+func (d *OrderDecision) ReplayTransaction() *Transaction {
+	return &Transaction{
+		Time:      d.Time,
+		NumShares: d.NumShares,
+		UnitCost:  d.Price,
+		Ticker:    d.Ticker,
+		Action:    d.Action,
+		Fee:       d.Fee,
+		Session:   d.Session,
+		Bot:       d.Bot,
+	}
+}
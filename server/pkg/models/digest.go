@@ -0,0 +1,100 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// DigestBot is a bot highlighted by a competition digest
+type DigestBot struct {
+	BotID  string  `json:"botId" firestore:"botId"`   // ID of the bot document
+	Name   string  `json:"name" firestore:"name"`     // Public display name of the bot, its ID if it has none
+	Return float64 `json:"return" firestore:"return"` // Return over the day, 0.05 is 5%
+}
+
+// ReturnPercent returns the return over the day in percent
+func (b *DigestBot) ReturnPercent() float64 {
+	return b.Return * 100
+}
+
+// TickerVolume is the trading volume of a ticker over the day of a digest
+type TickerVolume struct {
+	Ticker   string  `json:"ticker" firestore:"ticker"`     // Stock ticker symbol
+	Currency string  `json:"currency" firestore:"currency"` // Currency the ticker trades in
+	Trades   int     `json:"trades" firestore:"trades"`     // Number of transactions
+	Shares   float64 `json:"shares" firestore:"shares"`     // Shares bought and sold
+	Value    float64 `json:"value" firestore:"value"`       // Traded value before fees
+}
+
+// CompetitionDigest summarizes a day of trading in a competition for its organizers
+type CompetitionDigest struct {
+	CompetitionID    string          `json:"competitionId" firestore:"competitionId"`       // ID of the competition
+	Name             string          `json:"name" firestore:"name"`                         // Display name of the competition
+	Day              time.Time       `json:"day" firestore:"day"`                           // Midnight UTC of the summarized day
+	Bots             int             `json:"bots" firestore:"bots"`                         // Number of bots in the competition
+	ActiveBots       int             `json:"activeBots" firestore:"activeBots"`             // Number of bots that traded during the day
+	Trades           int             `json:"trades" firestore:"trades"`                     // Number of transactions, including those of shadow portfolios
+	Tickers          []*TickerVolume `json:"tickers" firestore:"tickers"`                   // Volume by ticker, most trades first
+	MostImproved     *DigestBot      `json:"mostImproved" firestore:"mostImproved"`         // Bot with the highest return over the day, nil if no bot was valued
+	Violations       int             `json:"violations" firestore:"violations"`             // Number of requests rejected by a trading rule
+	ViolationsByRule map[string]int  `json:"violationsByRule" firestore:"violationsByRule"` // Number of rejected requests by the first rule they failed
+	CreatedAt        time.Time       `json:"createdAt" firestore:"createdAt"`               // When the digest was produced
+}
+
+// AddTransactions adds the volume of transactions to the digest
+func (d *CompetitionDigest) AddTransactions(transactions []*Transaction) {
+	volumes := make(map[string]*TickerVolume)
+	for _, volume := range d.Tickers {
+		volumes[volume.Ticker] = volume
+	}
+
+	policy := money.Default()
+	for _, transaction := range transactions {
+		volume, ok := volumes[transaction.Ticker]
+		if !ok {
+			volume = &TickerVolume{Ticker: transaction.Ticker, Currency: transaction.CurrencyOfRecord()}
+			volumes[transaction.Ticker] = volume
+		}
+
+		volume.Trades++
+		volume.Shares += transaction.NumShares
+		volume.Value = policy.Add(volume.Value, transaction.Value())
+		d.Trades++
+	}
+
+	d.Tickers = make([]*TickerVolume, 0, len(volumes))
+	for _, volume := range volumes {
+		d.Tickers = append(d.Tickers, volume)
+	}
+
+	sort.Slice(d.Tickers, func(a, b int) bool {
+		if d.Tickers[a].Trades != d.Tickers[b].Trades {
+			return d.Tickers[a].Trades > d.Tickers[b].Trades
+		}
+
+		return d.Tickers[a].Ticker < d.Tickers[b].Ticker
+	})
+}
+
+// AddViolation counts a rejected request by the first rule it failed, requests without a failed rule are not violations
+func (d *CompetitionDigest) AddViolation(decision *OrderDecision) {
+	if decision.Accepted {
+		return
+	}
+
+	for _, rules := range [][]RuleEvaluation{decision.Rules, decision.CompetitionRules} {
+		for _, rule := range rules {
+			if !rule.Passed {
+				if d.ViolationsByRule == nil {
+					d.ViolationsByRule = make(map[string]int)
+				}
+
+				d.ViolationsByRule[rule.Rule]++
+				d.Violations++
+				return
+			}
+		}
+	}
+}
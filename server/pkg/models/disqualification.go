@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"time"
+)
+
+// States of a disqualification
+const (
+	DisqualificationActive     = "disqualified" // The bot is disqualified and has not appealed
+	DisqualificationAppealed   = "appealed"     // The bot appealed and awaits a decision
+	DisqualificationUpheld     = "upheld"       // The appeal was rejected, the disqualification is final
+	DisqualificationReinstated = "reinstated"   // The bot was reinstated and competes again
+)
+
+// Disqualification records why a bot was disqualified and the progress of its appeal.
+// The bot document is kept, so a reinstated bot resumes with its portfolio and history.
+type Disqualification struct {
+	Status         string                    `json:"status" firestore:"status"`                             // "disqualified", "appealed", "upheld" or "reinstated"
+	Reason         string                    `json:"reason" firestore:"reason"`                             // Rule the bot broke, shown to the bot
+	EffectiveAt    time.Time                 `json:"effectiveAt" firestore:"effectiveAt"`                   // When the disqualification took effect, standings are frozen at this time
+	DisqualifiedAt time.Time                 `json:"disqualifiedAt" firestore:"disqualifiedAt"`             // When an admin disqualified the bot
+	Snapshot       *DisqualificationSnapshot `json:"snapshot" firestore:"snapshot"`                         // Portfolio of the bot when it was disqualified
+	Appeal         string                    `json:"appeal,omitempty" firestore:"appeal,omitempty"`         // Statement of the bot's appeal, empty if it did not appeal
+	AppealedAt     time.Time                 `json:"appealedAt,omitempty" firestore:"appealedAt,omitempty"` // When the bot appealed
+	Decision       string                    `json:"decision,omitempty" firestore:"decision,omitempty"`     // Reason an admin gave for upholding or reinstating
+	DecidedAt      time.Time                 `json:"decidedAt,omitempty" firestore:"decidedAt,omitempty"`   // When the appeal was decided or the bot reinstated
+}
+
+// DisqualificationSnapshot is the frozen state of a disqualified bot's portfolio
+type DisqualificationSnapshot struct {
+	AccountValue float64             `json:"accountValue" firestore:"accountValue"` // Account value at the effective time
+	Cash         float64             `json:"cash" firestore:"cash"`                 // Cash when the bot was disqualified
+	Holdings     map[string]*Holding `json:"holdings" firestore:"holdings"`         // Holdings when the bot was disqualified
+}
+
+// NewDisqualification disqualifies a portfolio at the effective time. The account value of the
+// snapshot is the last recorded valuation at the effective time, or the current value if there is none.
+func NewDisqualification(portfolio *Portfolio, reason string, effectiveAt, now time.Time) *Disqualification {
+	value := portfolio.AccountValue
+	if effectiveAt.Before(now) {
+		for _, history := range portfolio.HistoricalAccountValue {
+			if !history.Date.After(effectiveAt) {
+				value = history.Value
+			}
+		}
+	}
+
+	holdings := make(map[string]*Holding, len(portfolio.Holdings))
+	maps.Copy(holdings, portfolio.Holdings)
+
+	return &Disqualification{
+		Status:         DisqualificationActive,
+		Reason:         reason,
+		EffectiveAt:    effectiveAt,
+		DisqualifiedAt: now,
+		Snapshot:       &DisqualificationSnapshot{AccountValue: value, Cash: portfolio.Cash, Holdings: holdings},
+	}
+}
+
+// Active checks whether the disqualification bars the bot from trading and the leaderboards, false for nil
+func (d *Disqualification) Active() bool {
+	return d != nil && d.Status != DisqualificationReinstated
+}
+
+// FileAppeal records the bot's appeal. A bot can appeal once, while it is disqualified.
+func (d *Disqualification) FileAppeal(statement string, now time.Time) error {
+	if d.Status != DisqualificationActive {
+		return fmt.Errorf("cannot appeal a disqualification that is %s", d.Status)
+	}
+
+	d.Status = DisqualificationAppealed
+	d.Appeal = statement
+	d.AppealedAt = now
+	return nil
+}
+
+// Uphold rejects the bot's appeal, which makes the disqualification final
+func (d *Disqualification) Uphold(decision string, now time.Time) error {
+	if d.Status != DisqualificationAppealed {
+		return fmt.Errorf("only an appealed disqualification can be upheld, this one is %s", d.Status)
+	}
+
+	d.Status = DisqualificationUpheld
+	d.Decision = decision
+	d.DecidedAt = now
+	return nil
+}
+
+// Reinstate lifts the disqualification, whether or not the bot appealed
+func (d *Disqualification) Reinstate(decision string, now time.Time) error {
+	if d.Status == DisqualificationReinstated {
+		return fmt.Errorf("the bot was already reinstated")
+	}
+
+	d.Status = DisqualificationReinstated
+	d.Decision = decision
+	d.DecidedAt = now
+	return nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventSchemaVersion is the version of the event payloads. It is incremented whenever a field
+// is removed or changes meaning, adding fields does not change the version.
+const EventSchemaVersion = 1
+
+// Types of the events published to integrations
+const (
+	EventTransactionExecuted = "transaction.executed"          // A transaction was executed, directly or by filling an order
+	EventPortfolioValued     = "portfolio.valued"              // The account value of a portfolio changed after a valuation
+	EventProtectionTriggered = "position.protection_triggered" // A position protection closed a holding
+)
+
+// Event is the schema versioned envelope of an event published to integrations.
+// Events are delivered at least once, so consumers should deduplicate them by ID.
+type Event struct {
+	ID            string          `json:"id"`                  // Unique ID of the event, the same for every delivery
+	Type          string          `json:"type"`                // Type of the event
+	SchemaVersion int             `json:"schemaVersion"`       // Version of the payload schema
+	Time          time.Time       `json:"time"`                // When the event occurred
+	Bot           string          `json:"bot"`                 // ID of the bot
+	Portfolio     string          `json:"portfolio,omitempty"` // ID of the shadow portfolio, empty for the bot's own portfolio
+	Data          json.RawMessage `json:"data"`                // Payload of the event, depending on its type
+}
+
+// NewEvent creates an event with the current schema version and a JSON encoded payload
+func NewEvent(id, eventType string, at time.Time, bot, portfolio string, data any) (*Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		ID:            id,
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		Time:          at,
+		Bot:           bot,
+		Portfolio:     portfolio,
+		Data:          encoded,
+	}, nil
+}
+
+// OutboxEntry is an event waiting in the outbox until it is published
+type OutboxEntry struct {
+	Type          string    `firestore:"type"`          // Type of the event
+	SchemaVersion int       `firestore:"schemaVersion"` // Version of the payload schema
+	Payload       string    `firestore:"payload"`       // JSON encoded event
+	CreatedAt     time.Time `firestore:"createdAt"`     // When the event was added to the outbox
+	Attempts      int       `firestore:"attempts"`      // Failed attempts to publish the event
+	LastError     string    `firestore:"lastError"`     // Error of the last failed attempt
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Kinds of history integrity violations
+const (
+	ViolationUnsortedRows    = "unsorted_rows"    // A row is dated before the row preceding it
+	ViolationDuplicateDate   = "duplicate_date"   // Two rows have the same date
+	ViolationMissingMetadata = "missing_metadata" // A ticker has rows but no metadata
+	ViolationRangeMismatch   = "range_mismatch"   // A ticker's rows do not match its metadata range
+	ViolationMissingRows     = "missing_rows"     // A ticker's metadata range is in memory but it has no rows
+	ViolationInvalidValue    = "invalid_value"    // A price or indicator is NaN or infinite
+)
+
+// maxReportedViolations caps the violations listed in a report, the counts include every violation
+const maxReportedViolations = 1000
+
+// IntegrityViolation describes a broken invariant of a history
+type IntegrityViolation struct {
+	Kind   string    `json:"kind"`   // Kind of violation
+	Ticker string    `json:"ticker"` // Affected ticker, empty for violations of the row order
+	Date   time.Time `json:"date"`   // Date of the affected row, zero if the violation is not tied to a row
+	Detail string    `json:"detail"` // Description of the violation
+}
+
+// IntegrityReport is the result of checking the invariants of a history
+type IntegrityReport struct {
+	CheckedAt  time.Time             `json:"checkedAt"`            // When the check ran
+	Duration   time.Duration         `json:"duration"`             // How long the check took in nanoseconds
+	Rows       int                   `json:"rows"`                 // Rows checked
+	Tickers    int                   `json:"tickers"`              // Tickers with metadata
+	Count      int                   `json:"count"`                // Number of violations
+	ByKind     map[string]int        `json:"byKind"`               // Number of violations of each kind
+	Affected   []string              `json:"affected"`             // Tickers with at least one violation, sorted
+	Violations []*IntegrityViolation `json:"violations,omitempty"` // The first violations found
+}
+
+// add records a violation in the report
+func (r *IntegrityReport) add(violation *IntegrityViolation) {
+	r.Count++
+	r.ByKind[violation.Kind]++
+	if len(r.Violations) < maxReportedViolations {
+		r.Violations = append(r.Violations, violation)
+	}
+}
+
+// Summary returns a copy of the report without the list of violations
+func (r *IntegrityReport) Summary() *IntegrityReport {
+	summary := *r
+	summary.Violations = nil
+	return &summary
+}
+
+// invalid checks whether a value is NaN or infinite
+func invalid(value float64) bool {
+	return math.IsNaN(value) || math.IsInf(value, 0)
+}
+
+// CheckIntegrity validates the invariants of the history: rows are sorted by date without
+// duplicates, every ticker's metadata range matches its rows, and no price or indicator is
+// NaN or infinite. Rows evicted by retention may be older than a ticker's metadata start.
+func (h *History) CheckIntegrity() *IntegrityReport {
+	start := time.Now()
+	report := &IntegrityReport{
+		CheckedAt:  start,
+		Rows:       len(h.Rows),
+		Tickers:    len(h.Tickers),
+		ByKind:     make(map[string]int),
+		Violations: make([]*IntegrityViolation, 0),
+	}
+
+	first := make(map[string]time.Time)
+	last := make(map[string]time.Time)
+	affected := make(map[string]bool)
+
+	for i, row := range h.Rows {
+		if i > 0 {
+			switch previous := h.Rows[i-1].Date; {
+			case row.Date.Before(previous):
+				report.add(&IntegrityViolation{Kind: ViolationUnsortedRows, Date: row.Date,
+					Detail: fmt.Sprintf("row %d is dated before the previous row (%s)", i, previous.Format(time.DateOnly))})
+			case row.Date.Equal(previous):
+				report.add(&IntegrityViolation{Kind: ViolationDuplicateDate, Date: row.Date,
+					Detail: fmt.Sprintf("rows %d and %d have the same date", i-1, i)})
+			}
+		}
+
+		row.Data.Range(func(ticker string, period *TickerPeriod) bool {
+			if f, ok := first[ticker]; !ok || row.Date.Before(f) {
+				first[ticker] = row.Date
+			}
+
+			if l, ok := last[ticker]; !ok || row.Date.After(l) {
+				last[ticker] = row.Date
+			}
+
+			for name, value := range map[string]float64{"open": period.Open, "high": period.High, "low": period.Low,
+				"close": period.Close, "adjClose": period.AdjClose, "adjOpen": period.AdjOpen, "adjHigh": period.AdjHigh,
+				"adjLow": period.AdjLow, "divCash": period.DivCash, "splitFactor": period.SplitFactor} {
+				if invalid(value) {
+					affected[ticker] = true
+					report.add(&IntegrityViolation{Kind: ViolationInvalidValue, Ticker: ticker, Date: row.Date,
+						Detail: fmt.Sprintf("%s is %v", name, value)})
+				}
+			}
+
+			for name, value := range period.Indicators {
+				if invalid(value) {
+					affected[ticker] = true
+					report.add(&IntegrityViolation{Kind: ViolationInvalidValue, Ticker: ticker, Date: row.Date,
+						Detail: fmt.Sprintf("indicator %s is %v", name, value)})
+				}
+			}
+
+			return true
+		})
+	}
+
+	var oldest time.Time
+	if len(h.Rows) > 0 {
+		oldest = h.Rows[0].Date
+	}
+
+	for ticker := range first {
+		if _, ok := h.Tickers[ticker]; !ok {
+			affected[ticker] = true
+			report.add(&IntegrityViolation{Kind: ViolationMissingMetadata, Ticker: ticker,
+				Detail: fmt.Sprintf("%s has rows from %s to %s but no metadata", ticker, first[ticker].Format(time.DateOnly), last[ticker].Format(time.DateOnly))})
+		}
+	}
+
+	for ticker, meta := range h.Tickers {
+		f, ok := first[ticker]
+		switch {
+		case !ok && len(h.Rows) > 0 && !meta.End.Before(oldest):
+			affected[ticker] = true
+			report.add(&IntegrityViolation{Kind: ViolationMissingRows, Ticker: ticker,
+				Detail: fmt.Sprintf("%s has data until %s but no rows in memory", ticker, meta.End.Format(time.DateOnly))})
+		case ok && (f.Before(meta.Start) || !last[ticker].Equal(meta.End)):
+			affected[ticker] = true
+			report.add(&IntegrityViolation{Kind: ViolationRangeMismatch, Ticker: ticker,
+				Detail: fmt.Sprintf("%s has rows from %s to %s but metadata from %s to %s", ticker,
+					f.Format(time.DateOnly), last[ticker].Format(time.DateOnly), meta.Start.Format(time.DateOnly), meta.End.Format(time.DateOnly))})
+		}
+	}
+
+	report.Affected = make([]string, 0, len(affected))
+	for ticker := range affected {
+		report.Affected = append(report.Affected, ticker)
+	}
+
+	sort.Strings(report.Affected)
+	report.Duration = time.Since(start)
+	return report
+}
+
+// SortRows sorts the rows by date and merges rows with the same date, the data of a later row
+// replacing the data of an earlier one for the same ticker.
+func (h *History) SortRows() {
+	sort.SliceStable(h.Rows, func(i, j int) bool {
+		return h.Rows[i].Date.Before(h.Rows[j].Date)
+	})
+
+	merged := make([]*Row, 0, len(h.Rows))
+	for _, row := range h.Rows {
+		if n := len(merged); n > 0 && merged[n-1].Date.Equal(row.Date) {
+			row.Data.Range(func(ticker string, period *TickerPeriod) bool {
+				merged[n-1].Data.Store(ticker, period)
+				return true
+			})
+
+			continue
+		}
+
+		merged = append(merged, row)
+	}
+
+	h.Rows = merged
+
+	// Merged rows can change any ticker's previous bar, so the returns are derived again on next use
+	returnsInit.Lock()
+	h.returns = nil
+	returnsInit.Unlock()
+}
+
+// RemoveTicker removes every period and the metadata of a ticker from the history and returns the
+// removed periods, oldest first. Rows that are left without any data are removed as well.
+func (h *History) RemoveTicker(ticker string) []PackedPeriod {
+	removed := make([]PackedPeriod, 0)
+	kept := make([]*Row, 0, len(h.Rows))
+
+	for _, row := range h.Rows {
+		if period, ok := row.Data.LoadAndDelete(ticker); ok {
+			removed = append(removed, period.Pack(row.Date))
+		}
+
+		if row.Data.Size() > 0 {
+			kept = append(kept, row)
+		}
+	}
+
+	h.Rows = kept
+	delete(h.Tickers, ticker)
+
+	if returns := h.builtReturns(); returns != nil {
+		returns.update(h.Rows, ticker, time.Time{})
+	}
+
+	return removed
+}
+
+// Pack converts a period into the format received from the API, dated at the given date
+func (p *TickerPeriod) Pack(date time.Time) PackedPeriod {
+	return PackedPeriod{
+		Date:        date,
+		Open:        p.Open,
+		High:        p.High,
+		Low:         p.Low,
+		Close:       p.Close,
+		Volume:      p.Volume,
+		AdjClose:    p.AdjClose,
+		AdjHigh:     p.AdjHigh,
+		AdjLow:      p.AdjLow,
+		AdjOpen:     p.AdjOpen,
+		AdjVolume:   p.AdjVolume,
+		DivCash:     p.DivCash,
+		SplitFactor: p.SplitFactor,
+	}
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"time"
+)
+
+// Kinds of email notifications a bot can opt into
+const (
+	NotificationMarginCall              = "margin_call"              // The account value fell below the margin call threshold
+	NotificationDisqualificationWarning = "disqualification_warning" // An admin warned the bot that it may be disqualified
+	NotificationWeeklySummary           = "weekly_summary"           // Weekly performance summary
+	NotificationAPIKeyRotated           = "api_key_rotated"          // Confirmation that the API key was rotated
+)
+
+// NotificationKinds lists every kind of email notification
+var NotificationKinds = []string{
+	NotificationMarginCall,
+	NotificationDisqualificationWarning,
+	NotificationWeeklySummary,
+	NotificationAPIKeyRotated,
+}
+
+// NotificationSettings are the email notifications a bot's owner opted into
+type NotificationSettings struct {
+	Email    string               `json:"email" firestore:"email"`                 // Address notifications are sent to
+	Kinds    []string             `json:"kinds" firestore:"kinds"`                 // Kinds of notifications to send
+	LastSent map[string]time.Time `json:"lastSent" firestore:"lastSent,omitempty"` // When each kind was last sent
+}
+
+// Validate normalizes the email address and checks that every kind is known.
+// An empty address is only valid without kinds, which turns notifications off.
+func (n *NotificationSettings) Validate() error {
+	if n.Email != "" {
+		address, err := mail.ParseAddress(n.Email)
+		if err != nil {
+			return fmt.Errorf("invalid email address %q", n.Email)
+		}
+
+		n.Email = address.Address
+	} else if len(n.Kinds) > 0 {
+		return fmt.Errorf("an email address is required to receive notifications")
+	}
+
+	kinds := make([]string, 0, len(n.Kinds))
+	for _, kind := range n.Kinds {
+		if !slices.Contains(NotificationKinds, kind) {
+			return fmt.Errorf("unknown notification kind %q", kind)
+		}
+
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	n.Kinds = kinds
+	return nil
+}
+
+// Wants checks whether the owner opted into a kind of notification, false for nil settings
+func (n *NotificationSettings) Wants(kind string) bool {
+	return n != nil && n.Email != "" && slices.Contains(n.Kinds, kind)
+}
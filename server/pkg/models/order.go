@@ -0,0 +1,457 @@
+// Package models defines the data structures used throughout the AlgoBattle application.
+// It includes models for portfolios, transactions, stock data, and related entities.
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Order types
+const (
+	OrderTypeMarket = "market" // Fills at the next available price
+	OrderTypeLimit  = "limit"  // Buys at or below, or sells at or above, the limit price
+	OrderTypeStop   = "stop"   // Buys at or above, or sells at or below, the stop price
+)
+
+// Order statuses
+const (
+	OrderStatusWaiting   = "waiting"          // Not active yet, e.g. bracket exits before the entry fills any shares
+	OrderStatusQueued    = "queued_for_open"  // Placed while the market was closed, fills at the next session's opening price
+	OrderStatusOpen      = "open"             // Active and waiting for its trigger price
+	OrderStatusPartial   = "partially_filled" // Part of the shares filled, the rest fill on later price updates
+	OrderStatusFilled    = "filled"           // Executed
+	OrderStatusCancelled = "cancelled"        // Cancelled by the bot or by a linked order
+	OrderStatusRejected  = "rejected"         // Triggered but failed the trading rules
+	OrderStatusExpired   = "expired"          // Expired according to its group's time in force
+)
+
+// Order group types
+const (
+	OrderGroupSingle  = "single"  // A single conditional order
+	OrderGroupOCO     = "oco"     // One-cancels-other: the first leg to fill any shares cancels the rest
+	OrderGroupBracket = "bracket" // Entry order followed by linked take-profit and stop-loss exits
+)
+
+// Order group statuses
+const (
+	OrderGroupActive    = "active"    // At least one order can still fill
+	OrderGroupCompleted = "completed" // No more orders can fill after a fill
+	OrderGroupCancelled = "cancelled" // Cancelled before completing
+	OrderGroupExpired   = "expired"   // Expired according to its time in force
+)
+
+// Time in force values, which control how long an order group stays active
+const (
+	TimeInForceDay = "DAY" // Expires at the end-of-day settlement of the day it was placed
+	TimeInForceGTC = "GTC" // Good til cancelled, never expires
+	TimeInForceGTD = "GTD" // Good til date, expires at ExpiresAt
+)
+
+// Order roles within a group
+const (
+	OrderRoleLeg        = "leg"         // A leg of a single or OCO group
+	OrderRoleEntry      = "entry"       // Entry order of a bracket
+	OrderRoleTakeProfit = "take_profit" // Take-profit exit of a bracket
+	OrderRoleStopLoss   = "stop_loss"   // Stop-loss exit of a bracket
+)
+
+// Order represents a conditional order that is executed server-side once its price condition is met.
+type Order struct {
+	ID           string                 `json:"id" firestore:"id"`                     // Unique order ID
+	GroupID      string                 `json:"groupId" firestore:"groupId"`           // ID of the group the order belongs to
+	Role         string                 `json:"role" firestore:"role"`                 // Role of the order within its group
+	Type         string                 `json:"type" firestore:"type"`                 // "market", "limit" or "stop"
+	Action       string                 `json:"action" firestore:"action"`             // "buy" or "sell"
+	Ticker       string                 `json:"ticker" firestore:"ticker"`             // Stock ticker symbol
+	NumShares    float64                `json:"numShares" firestore:"numShares"`       // Number of shares to buy or sell
+	LimitPrice   float64                `json:"limitPrice" firestore:"limitPrice"`     // Limit price for limit orders
+	StopPrice    float64                `json:"stopPrice" firestore:"stopPrice"`       // Stop price for stop orders
+	Status       string                 `json:"status" firestore:"status"`             // Current status of the order
+	Reason       string                 `json:"reason" firestore:"reason"`             // Why the order was cancelled or rejected
+	CreatedAt    time.Time              `json:"createdAt" firestore:"createdAt"`       // When the order was placed
+	UpdatedAt    time.Time              `json:"updatedAt" firestore:"updatedAt"`       // When the status last changed
+	FillPrice    float64                `json:"fillPrice" firestore:"fillPrice"`       // Average price of the filled shares
+	FilledShares float64                `json:"filledShares" firestore:"filledShares"` // Number of shares filled so far
+	Fills        []*OrderFill           `json:"fills" firestore:"fills"`               // Every fill of the order, oldest first
+	Bot          *firestore.DocumentRef `json:"-" firestore:"bot"`                     // Reference to the bot that placed the order
+	Transaction  *firestore.DocumentRef `json:"-" firestore:"transaction"`             // Reference to the last fill transaction
+}
+
+// OrderFill records the execution of some or all of an order's shares.
+type OrderFill struct {
+	NumShares   float64                `json:"numShares" firestore:"numShares"` // Number of shares filled
+	Price       float64                `json:"price" firestore:"price"`         // Price the shares filled at
+	Time        time.Time              `json:"time" firestore:"time"`           // When the shares filled
+	Transaction *firestore.DocumentRef `json:"-" firestore:"transaction"`       // Reference to the fill transaction
+}
+
+// Validate checks that the order is well formed.
+func (o *Order) Validate() error {
+	switch {
+	case o.Action != "buy" && o.Action != "sell":
+		return fmt.Errorf("invalid order action: %s", o.Action)
+	case o.Ticker == "":
+		return fmt.Errorf("order ticker is required")
+	case !symbols.Valid(o.Ticker):
+		return fmt.Errorf("invalid order ticker: %s", o.Ticker)
+	case o.NumShares <= 0:
+		return fmt.Errorf("order must be for a positive number of shares")
+	}
+
+	switch o.Type {
+	case OrderTypeMarket:
+	case OrderTypeLimit:
+		if o.LimitPrice <= 0 {
+			return fmt.Errorf("limit order requires a positive limit price")
+		}
+	case OrderTypeStop:
+		if o.StopPrice <= 0 {
+			return fmt.Errorf("stop order requires a positive stop price")
+		}
+	default:
+		return fmt.Errorf("invalid order type: %s", o.Type)
+	}
+
+	return nil
+}
+
+// Remaining returns the number of shares that have not filled yet.
+func (o *Order) Remaining() float64 {
+	return max(o.NumShares-o.FilledShares, 0)
+}
+
+// Active checks whether the order is waiting for its trigger price, with or without earlier partial fills.
+func (o *Order) Active() bool {
+	return o.Status == OrderStatusOpen || o.Status == OrderStatusPartial
+}
+
+// Queued checks whether the order waits for the next session's opening price.
+func (o *Order) Queued() bool {
+	return o.Status == OrderStatusQueued
+}
+
+// Triggered checks whether the order should fill at the given price.
+func (o *Order) Triggered(price float64) bool {
+	if !o.Active() || o.Remaining() <= 0 || price <= 0 {
+		return false
+	}
+
+	switch o.Type {
+	case OrderTypeMarket:
+		return true
+	case OrderTypeLimit:
+		if o.Action == "buy" {
+			return price <= o.LimitPrice
+		}
+
+		return price >= o.LimitPrice
+	case OrderTypeStop:
+		if o.Action == "buy" {
+			return price >= o.StopPrice
+		}
+
+		return price <= o.StopPrice
+	default:
+		return false
+	}
+}
+
+// Done checks whether the order can no longer fill.
+func (o *Order) Done() bool {
+	switch o.Status {
+	case OrderStatusFilled, OrderStatusCancelled, OrderStatusRejected, OrderStatusExpired:
+		return true
+	default:
+		return false
+	}
+}
+
+// OrderGroup links orders that are managed together, such as OCO pairs and brackets.
+type OrderGroup struct {
+	ID          string                 `json:"id" firestore:"id"`                       // Unique group ID
+	Type        string                 `json:"type" firestore:"type"`                   // "single", "oco" or "bracket"
+	Status      string                 `json:"status" firestore:"status"`               // Current status of the group
+	TimeInForce string                 `json:"timeInForce" firestore:"timeInForce"`     // "DAY", "GTC" or "GTD"
+	ExpiresAt   time.Time              `json:"expiresAt" firestore:"expiresAt"`         // When a GTD group expires
+	Orders      []*Order               `json:"orders" firestore:"orders"`               // Orders in the group
+	CreatedAt   time.Time              `json:"createdAt" firestore:"createdAt"`         // When the group was placed
+	UpdatedAt   time.Time              `json:"updatedAt" firestore:"updatedAt"`         // When the group last changed
+	Transitions []*OrderTransition     `json:"transitions" firestore:"transitions"`     // Every status change of the group's orders, oldest first
+	Tag         string                 `json:"tag,omitempty" firestore:"tag,omitempty"` // Strategy tag of the fills of the group's orders
+	Bot         *firestore.DocumentRef `json:"-" firestore:"bot"`                       // Reference to the bot that placed the group
+
+	// SchemaVersion is the version of the document schema, maintained by migrations
+	SchemaVersion int `json:"-" firestore:"schemaVersion"`
+}
+
+// OrderTransition records a status change of an order within its group.
+type OrderTransition struct {
+	OrderID string    `json:"orderId" firestore:"orderId"` // ID of the order that changed
+	From    string    `json:"from" firestore:"from"`       // Previous status, empty when the order was placed
+	To      string    `json:"to" firestore:"to"`           // New status
+	Reason  string    `json:"reason" firestore:"reason"`   // Why the status changed, if known
+	Time    time.Time `json:"time" firestore:"time"`       // When the status changed
+}
+
+// Place records the initial status of every order in the group.
+func (g *OrderGroup) Place(now time.Time) {
+	for _, order := range g.Orders {
+		g.Transitions = append(g.Transitions, &OrderTransition{OrderID: order.ID, To: order.Status, Time: now})
+	}
+}
+
+// Copy returns a deep copy of the group, so that changes can be persisted before they are applied.
+func (g *OrderGroup) Copy() *OrderGroup {
+	copied := *g
+
+	copied.Orders = make([]*Order, len(g.Orders))
+	for i, order := range g.Orders {
+		o := *order
+		o.Fills = append([]*OrderFill(nil), order.Fills...)
+		copied.Orders[i] = &o
+	}
+
+	copied.Transitions = make([]*OrderTransition, len(g.Transitions))
+	for i, transition := range g.Transitions {
+		t := *transition
+		copied.Transitions[i] = &t
+	}
+
+	return &copied
+}
+
+// Order returns the order with the given ID, or nil if it is not in the group.
+func (g *OrderGroup) Order(id string) *Order {
+	for _, order := range g.Orders {
+		if order.ID == id {
+			return order
+		}
+	}
+
+	return nil
+}
+
+// entry returns the entry order of a bracket, or nil for other groups.
+func (g *OrderGroup) entry() *Order {
+	for _, order := range g.Orders {
+		if order.Role == OrderRoleEntry {
+			return order
+		}
+	}
+
+	return nil
+}
+
+// Fill records the fill of numShares of an order in the group and applies the group's linking rules.
+// An order with shares left is partially filled and stays active for later price updates.
+// OCO groups cancel their remaining legs on the first fill of any leg, and bracket exits are sized
+// to the entry shares that have not been sold yet, see sizeExits.
+// Returns every order whose status changed.
+func (g *OrderGroup) Fill(order *Order, numShares, price float64, transaction *firestore.DocumentRef, now time.Time) []*Order {
+	order.FillPrice = (order.FillPrice*order.FilledShares + price*numShares) / (order.FilledShares + numShares)
+	order.FilledShares += numShares
+	order.Fills = append(order.Fills, &OrderFill{NumShares: numShares, Price: price, Time: now, Transaction: transaction})
+	order.Transaction = transaction
+	order.UpdatedAt = now
+	changed := []*Order{order}
+
+	complete := order.Remaining() <= 0
+	if g.Type == OrderGroupBracket && order.Role != OrderRoleEntry {
+		// A partially filled entry can still buy shares for the exit to sell
+		complete = complete && g.entry().Done()
+	}
+
+	switch {
+	case complete:
+		g.transition(order, OrderStatusFilled, "", now)
+	case order.Status != OrderStatusPartial:
+		g.transition(order, OrderStatusPartial, fmt.Sprintf("%g of %g shares filled", order.FilledShares, order.NumShares), now)
+	}
+
+	switch g.Type {
+	case OrderGroupBracket:
+		changed = append(changed, g.sizeExits(order, now)...)
+	case OrderGroupOCO:
+		for _, other := range g.Orders {
+			if other != order && !other.Done() {
+				reason := fmt.Sprintf("linked order %s filled", order.ID)
+				g.transition(other, OrderStatusCancelled, reason, now)
+				other.Reason = reason
+				changed = append(changed, other)
+			}
+		}
+	}
+
+	g.updateStatus(now)
+	return changed
+}
+
+// sizeExits sizes the exits of a bracket to the entry shares that have not been sold yet, so a partial fill of
+// the entry is protected right away and a fill of one exit reduces the other. Waiting exits become active once
+// the entry filled any shares. When nothing is left to sell and the entry can no longer fill, exits that sold
+// shares are filled and the others are cancelled.
+func (g *OrderGroup) sizeExits(filled *Order, now time.Time) []*Order {
+	entry := g.entry()
+	sold := 0.0
+	for _, order := range g.Orders {
+		if order != entry {
+			sold += order.FilledShares
+		}
+	}
+
+	held := max(entry.FilledShares-sold, 0)
+	changed := make([]*Order, 0, len(g.Orders))
+	for _, exit := range g.Orders {
+		if exit == entry || exit.Done() {
+			continue
+		}
+
+		exit.NumShares = exit.FilledShares + held
+		switch {
+		case exit.Status == OrderStatusWaiting && held > 0:
+			g.transition(exit, OrderStatusOpen, fmt.Sprintf("bracket entry %s filled", entry.ID), now)
+		case held > 0 || !entry.Done():
+			continue
+		case exit.FilledShares > 0:
+			g.transition(exit, OrderStatusFilled, "", now)
+		default:
+			reason := fmt.Sprintf("linked order %s filled", filled.ID)
+			g.transition(exit, OrderStatusCancelled, reason, now)
+			exit.Reason = reason
+		}
+
+		if exit != filled {
+			changed = append(changed, exit)
+		}
+	}
+
+	return changed
+}
+
+// QueueForOpen holds an order placed while the market is closed until the next session opens.
+func (g *OrderGroup) QueueForOpen(order *Order, reason string, now time.Time) {
+	g.transition(order, OrderStatusQueued, reason, now)
+	g.UpdatedAt = now
+}
+
+// Open activates an order queued for the open, so it fills at the opening price.
+func (g *OrderGroup) Open(order *Order, reason string, now time.Time) {
+	g.transition(order, OrderStatusOpen, reason, now)
+	g.UpdatedAt = now
+}
+
+// Reject marks an order in the group as rejected. A rejected bracket entry cancels its exits.
+// Returns every order whose status changed.
+func (g *OrderGroup) Reject(order *Order, reason string, now time.Time) []*Order {
+	g.transition(order, OrderStatusRejected, reason, now)
+	order.Reason = reason
+	changed := []*Order{order}
+
+	// Exits keep protecting the shares a partially filled entry bought
+	switch {
+	case g.Type == OrderGroupBracket && order.Role == OrderRoleEntry && order.FilledShares > 0:
+		changed = append(changed, g.sizeExits(order, now)...)
+	case g.Type == OrderGroupBracket && order.Role == OrderRoleEntry:
+		changed = append(changed, g.cancelRemaining("bracket entry was rejected", now)...)
+	}
+
+	g.updateStatus(now)
+	return changed
+}
+
+// Cancel cancels every order in the group that has not filled yet.
+// Returns every order whose status changed.
+func (g *OrderGroup) Cancel(reason string, now time.Time) []*Order {
+	changed := g.cancelRemaining(reason, now)
+	g.updateStatus(now)
+	return changed
+}
+
+// Expire expires every order in the group that has not filled yet.
+// Returns every order whose status changed.
+func (g *OrderGroup) Expire(now time.Time) []*Order {
+	changed := g.endRemaining(OrderStatusExpired, fmt.Sprintf("%s order group expired", g.TimeInForce), now)
+	g.updateStatus(now)
+
+	// A group that expired without any fill is marked expired rather than cancelled
+	if g.Status == OrderGroupCancelled {
+		g.Status = OrderGroupExpired
+	}
+
+	return changed
+}
+
+// Expired checks whether the group should expire at the given time.
+// DAY groups expire at the first end-of-day settlement after they were placed.
+func (g *OrderGroup) Expired(now time.Time, endOfDay bool) bool {
+	if g.Status != OrderGroupActive {
+		return false
+	}
+
+	switch g.TimeInForce {
+	case TimeInForceDay:
+		return endOfDay && g.CreatedAt.Before(now)
+	case TimeInForceGTD:
+		return !now.Before(g.ExpiresAt)
+	default:
+		return false
+	}
+}
+
+// cancelRemaining cancels every order that is not done yet
+func (g *OrderGroup) cancelRemaining(reason string, now time.Time) []*Order {
+	return g.endRemaining(OrderStatusCancelled, reason, now)
+}
+
+// endRemaining moves every order that is not done yet to the given final status
+func (g *OrderGroup) endRemaining(status, reason string, now time.Time) []*Order {
+	changed := make([]*Order, 0, len(g.Orders))
+	for _, order := range g.Orders {
+		if !order.Done() {
+			g.transition(order, status, reason, now)
+			order.Reason = reason
+			changed = append(changed, order)
+		}
+	}
+
+	return changed
+}
+
+// transition moves an order to a new status and records the change in the group
+func (g *OrderGroup) transition(order *Order, status, reason string, now time.Time) {
+	g.Transitions = append(g.Transitions, &OrderTransition{
+		OrderID: order.ID,
+		From:    order.Status,
+		To:      status,
+		Reason:  reason,
+		Time:    now,
+	})
+
+	order.Status = status
+	order.UpdatedAt = now
+}
+
+// updateStatus derives the group status from the status of its orders
+func (g *OrderGroup) updateStatus(now time.Time) {
+	g.UpdatedAt = now
+
+	filled := false
+	for _, order := range g.Orders {
+		if !order.Done() {
+			g.Status = OrderGroupActive
+			return
+		}
+
+		filled = filled || order.FilledShares > 0
+	}
+
+	if filled {
+		g.Status = OrderGroupCompleted
+	} else {
+		g.Status = OrderGroupCancelled
+	}
+}
@@ -3,9 +3,11 @@
 package models
 
 import (
-	"cloud.google.com/go/firestore"
 	"fmt"
 	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/money"
 )
 
 // Portfolio represents a user's portfolio of stocks.
@@ -18,17 +20,81 @@ type Portfolio struct {
 	// HistoricalAccountValue tracks the portfolio value over time
 	HistoricalAccountValue []*AccountValueHistory `json:"historicalAccountValue" firestore:"historicalAccountValue"`
 
+	// Currency is the currency of record of the cash, holdings and account values, empty for the base currency
+	Currency string `json:"currency" firestore:"currency"`
+
 	// Cash is the available cash balance
 	Cash float64 `json:"cash" firestore:"cash"`
 
-	// Holdings maps ticker symbols to stock holdings
+	// Holdings maps ticker symbols to stock holdings, positions that were sold completely are removed
 	Holdings map[string]*Holding `json:"holdings" firestore:"holdings"`
 
+	// ClosedPositions records every position that was sold completely, oldest first
+	ClosedPositions []*ClosedPosition `json:"closedPositions" firestore:"closedPositions"`
+
 	// Transactions is the list of transactions (not stored in Firestore)
 	Transactions []*Transaction `json:"transactions" firestore:"-"`
 
 	// TransactionReferences stores references to transaction documents in Firestore
 	TransactionReferences []*firestore.DocumentRef `json:"-" firestore:"transactions"`
+
+	// EarningsBlackoutMinutes is how many minutes around an earnings release the bot blocks its own trades
+	EarningsBlackoutMinutes int `json:"earningsBlackoutMinutes" firestore:"earningsBlackoutMinutes"`
+
+	// APIKey authenticates the bot, empty for shadow portfolios
+	APIKey string `json:"-" firestore:"apiKey,omitempty"`
+
+	// Competition references the competition the bot joined, nil for bots created outside a competition
+	Competition *firestore.DocumentRef `json:"-" firestore:"competition,omitempty"`
+
+	// CostBasisMethod is how sold shares are matched to purchases, taken from the competition when the portfolio is created
+	CostBasisMethod CostBasisMethod `json:"costBasisMethod" firestore:"costBasisMethod,omitempty"`
+
+	// Profile is the public display information of a bot, nil if it never set one
+	Profile *BotProfile `json:"profile,omitempty" firestore:"profile,omitempty"`
+
+	// Shadow marks a secondary portfolio of a bot, which is excluded from the leaderboard
+	Shadow bool `json:"shadow,omitempty" firestore:"shadow,omitempty"`
+
+	// ShadowName is the display name of a shadow portfolio
+	ShadowName string `json:"shadowName,omitempty" firestore:"shadowName,omitempty"`
+
+	// Notifications are the email notifications the bot's owner opted into, nil if it never opted in
+	Notifications *NotificationSettings `json:"-" firestore:"notifications,omitempty"`
+
+	// Owner references the bot that owns a shadow portfolio
+	Owner *firestore.DocumentRef `json:"-" firestore:"owner,omitempty"`
+
+	// InceptionValue is the account value the bot started with, used for returns
+	InceptionValue float64 `json:"inceptionValue,omitempty" firestore:"inceptionValue,omitempty"`
+
+	// InceptionDate is when the bot started trading, used for returns
+	InceptionDate time.Time `json:"inceptionDate,omitempty" firestore:"inceptionDate,omitempty"`
+
+	// LastHeartbeat is when the bot last reported that its automation is running, zero if it never did
+	LastHeartbeat time.Time `json:"lastHeartbeat,omitempty" firestore:"lastHeartbeat,omitempty"`
+
+	// PendingTickers are held tickers that were valued at a fallback price in the last valuation because their
+	// live price is still being fetched, empty once every holding was valued at a live price
+	PendingTickers []string `json:"pendingTickers,omitempty" firestore:"pendingTickers,omitempty"`
+
+	// Disqualification is the bot's disqualification and appeal, nil if it was never disqualified
+	Disqualification *Disqualification `json:"disqualification,omitempty" firestore:"disqualification,omitempty"`
+
+	// Score is the composite score of the last settlement, nil if the bot was never scored
+	Score *Score `json:"score,omitempty" firestore:"score,omitempty"`
+
+	// Turnover is the value traded on the UTC day of the last trade, nil if the portfolio never traded
+	Turnover *Turnover `json:"turnover,omitempty" firestore:"turnover,omitempty"`
+
+	// TurnoverAllowance is how much more the portfolio can buy today when a daily turnover cap is configured (not stored in Firestore)
+	TurnoverAllowance *TurnoverAllowance `json:"turnoverAllowance,omitempty" firestore:"-"`
+
+	// Display holds the main amounts converted to a display currency when requested (not stored in Firestore)
+	Display *DisplayValues `json:"display,omitempty" firestore:"-"`
+
+	// SchemaVersion is the version of the document schema, maintained by migrations
+	SchemaVersion int `json:"-" firestore:"schemaVersion"`
 }
 
 // AccountValueHistory represents a historical account value at a specific date.
@@ -41,79 +107,233 @@ type AccountValueHistory struct {
 // Holding represents a stock holding in a portfolio.
 // It tracks the number of shares and their average purchase value.
 type Holding struct {
-	NumShares     float64 `json:"numShares" firestore:"numShares"`         // Number of shares held
-	PurchaseValue float64 `json:"purchaseValue" firestore:"purchaseValue"` // Average purchase price per share
+	NumShares     float64 `json:"numShares" firestore:"numShares"`           // Number of shares held
+	PurchaseValue float64 `json:"purchaseValue" firestore:"purchaseValue"`   // Average purchase price per share of the shares held
+	RealizedGain  float64 `json:"realizedGain" firestore:"realizedGain"`     // Total gain realized by selling shares of the ticker
+	Lots          []*Lot  `json:"lots,omitempty" firestore:"lots,omitempty"` // Remaining purchase lots, oldest first, tracked with the FIFO cost basis method
+
+	Protection *PositionProtection `json:"protection,omitempty" firestore:"protection,omitempty"` // Stop-loss and take-profit levels that close the whole holding, nil if unprotected
+}
+
+// DustShares is the largest number of shares left by rounding errors that still counts as a closed position
+const DustShares = 1e-9
+
+// ClosedPosition records a position that was sold completely and removed from the holdings.
+// The trades of the position remain available through the transactions.
+type ClosedPosition struct {
+	Ticker       string    `json:"ticker" firestore:"ticker"`             // Ticker of the position
+	RealizedGain float64   `json:"realizedGain" firestore:"realizedGain"` // Total gain realized by the position's sales
+	ClosedAt     time.Time `json:"closedAt" firestore:"closedAt"`         // When the last shares were sold
 }
 
-// NewPortfolio creates a new portfolio with the given starting cash.
+// DisplayValues are the main amounts of a portfolio converted from its currency of record to a display
+// currency. They are for display only, the portfolio is always valued and traded in its currency of record.
+type DisplayValues struct {
+	Currency       string    `json:"currency"`       // Display currency
+	Rate           float64   `json:"rate"`           // Units of the display currency per unit of the currency of record
+	RateTime       time.Time `json:"rateTime"`       // When the exchange rate was quoted
+	Stale          bool      `json:"stale"`          // Whether the exchange rate could not be refreshed
+	AccountValue   float64   `json:"accountValue"`   // Account value in the display currency
+	Cash           float64   `json:"cash"`           // Cash in the display currency
+	InceptionValue float64   `json:"inceptionValue"` // Inception value in the display currency
+}
+
+// NewPortfolio creates a new portfolio with the given starting cash in the base currency.
 // It initializes all the necessary maps and slices for a new portfolio.
 func NewPortfolio(startingCash float64) *Portfolio {
 	return &Portfolio{
+		Currency:              money.BaseCurrency,
 		Cash:                  startingCash,
 		Holdings:              make(map[string]*Holding),
+		ClosedPositions:       make([]*ClosedPosition, 0),
 		Transactions:          make([]*Transaction, 0),
 		TransactionReferences: make([]*firestore.DocumentRef, 0),
 	}
 }
 
+// CostBasis returns the cost basis method of the portfolio, average cost if it has none
+func (p *Portfolio) CostBasis() CostBasisMethod {
+	if p.CostBasisMethod == "" {
+		return AverageCost
+	}
+
+	return p.CostBasisMethod
+}
+
+// CurrencyOfRecord returns the currency the portfolio is valued in
+func (p *Portfolio) CurrencyOfRecord() string {
+	return money.OrBase(p.Currency)
+}
+
+// Disqualified checks whether the bot is currently disqualified
+func (p *Portfolio) Disqualified() bool {
+	return p.Disqualification.Active()
+}
+
+// AccountValueAmount returns the account value with its currency
+func (p *Portfolio) AccountValueAmount() money.Amount {
+	return money.Amount{Value: p.AccountValue, Currency: p.CurrencyOfRecord()}
+}
+
+// CashAmount returns the cash balance with its currency
+func (p *Portfolio) CashAmount() money.Amount {
+	return money.Amount{Value: p.Cash, Currency: p.CurrencyOfRecord()}
+}
+
+// DisplayIn converts the main amounts of the portfolio to a display currency at an exchange rate
+func (p *Portfolio) DisplayIn(currency string, rate float64, rateTime time.Time, stale bool) *DisplayValues {
+	policy := money.Default()
+	return &DisplayValues{
+		Currency:       currency,
+		Rate:           rate,
+		RateTime:       rateTime,
+		Stale:          stale,
+		AccountValue:   policy.Convert(p.AccountValue, rate),
+		Cash:           policy.Convert(p.Cash, rate),
+		InceptionValue: policy.Convert(p.InceptionValue, rate),
+	}
+}
+
+// Evaluate checks a transaction against the portfolio's trading rules without modifying the portfolio.
+// The returned evaluations are in the order the rules are checked.
+func (p *Portfolio) Evaluate(transaction *Transaction) []RuleEvaluation {
+	switch transaction.Action {
+	case "buy":
+		return []RuleEvaluation{
+			newRuleEvaluation("sufficient_cash", p.Cash >= money.Default().Sum(transaction.Value(), transaction.Fee),
+				fmt.Sprintf("not enough cash to buy %f shares of %s", transaction.NumShares, transaction.Ticker)),
+			newRuleEvaluation("non_negative_shares", transaction.NumShares >= 0,
+				"cannot buy negative number of shares"),
+		}
+	case "sell":
+		holding, held := p.Holdings[transaction.Ticker]
+
+		return []RuleEvaluation{
+			newRuleEvaluation("sufficient_shares", held && holding.NumShares >= transaction.NumShares,
+				fmt.Sprintf("not enough shares to sell %f shares of %s", transaction.NumShares, transaction.Ticker)),
+			newRuleEvaluation("non_negative_shares", transaction.NumShares >= 0,
+				"cannot sell negative number of shares"),
+		}
+	default:
+		return []RuleEvaluation{
+			newRuleEvaluation("valid_action", false, fmt.Sprintf("invalid transaction action: %s", transaction.Action)),
+		}
+	}
+}
+
+// newRuleEvaluation creates a rule evaluation, keeping the failure detail only if the rule failed
+func newRuleEvaluation(rule string, passed bool, failureDetail string) RuleEvaluation {
+	evaluation := RuleEvaluation{Rule: rule, Passed: passed}
+	if !passed {
+		evaluation.Detail = failureDetail
+	}
+
+	return evaluation
+}
+
 // Buy adds a stock purchase to the portfolio.
 // It validates the transaction, updates the cash balance, and adds or updates
-// the holding in the portfolio. The purchase value is recalculated as a weighted
-// average when adding to an existing position.
+// the holding in the portfolio using the cost basis method.
 func (p *Portfolio) Buy(transaction *Transaction) error {
 	// Validate the transaction
-	switch {
-	case p.Cash < transaction.NumShares*transaction.UnitCost:
-		return fmt.Errorf("not enough cash to buy %f shares of %s", transaction.NumShares, transaction.Ticker)
-	case transaction.NumShares < 0:
-		return fmt.Errorf("cannot buy negative number of shares")
+	if err := FirstFailure(p.Evaluate(transaction)); err != nil {
+		return err
 	}
 
 	if p.Holdings == nil {
 		p.Holdings = make(map[string]*Holding)
 	}
 
-	p.Cash -= transaction.NumShares * transaction.UnitCost
-	if holding, ok := p.Holdings[transaction.Ticker]; !ok {
-		p.Holdings[transaction.Ticker] = &Holding{
-			NumShares:     transaction.NumShares,
-			PurchaseValue: transaction.UnitCost,
-		}
-	} else {
-		holding.NumShares += transaction.NumShares
-		holding.PurchaseValue = (holding.PurchaseValue*holding.NumShares + transaction.NumShares*transaction.UnitCost) / (holding.NumShares + transaction.NumShares)
+	policy := money.Default()
+	p.Cash = policy.Sub(p.Cash, policy.Sum(transaction.Value(), transaction.Fee))
+
+	holding, ok := p.Holdings[transaction.Ticker]
+	if !ok {
+		holding = &Holding{}
+		p.Holdings[transaction.Ticker] = holding
 	}
 
+	p.CostBasis().Buy(holding, transaction.NumShares, transaction.UnitCost, transaction.Time)
+
 	return nil
 }
 
 // Sell removes shares from a stock holding in the portfolio.
-// It validates the transaction, updates the cash balance, and reduces
-// the number of shares in the holding.
+// It validates the transaction, updates the cash balance, reduces
+// the number of shares in the holding and records the realized gain.
+// A holding that is sold completely is closed, see ClosePosition.
 func (p *Portfolio) Sell(transaction *Transaction) error {
-	switch {
-	case p.Holdings[transaction.Ticker].NumShares < transaction.NumShares:
-		return fmt.Errorf("not enough shares to sell %f shares of %s", transaction.NumShares, transaction.Ticker)
-	case transaction.NumShares < 0:
-		return fmt.Errorf("cannot sell negative number of shares")
+	// Validate the transaction
+	if err := FirstFailure(p.Evaluate(transaction)); err != nil {
+		return err
 	}
 
-	p.Cash += transaction.NumShares * transaction.UnitCost
-	p.Holdings[transaction.Ticker].NumShares -= transaction.NumShares
-	p.Holdings[transaction.Ticker].PurchaseValue = transaction.UnitCost
+	policy := money.Default()
+	p.Cash = policy.Add(p.Cash, policy.Sub(transaction.Value(), transaction.Fee))
+
+	holding := p.Holdings[transaction.Ticker]
+	p.CostBasis().Sell(holding, transaction.NumShares, transaction.UnitCost)
+
+	if holding.NumShares <= DustShares {
+		p.ClosePosition(transaction.Ticker, transaction.Time)
+	}
+
+	return nil
+}
+
+// ClosePosition removes a holding from the portfolio and records it as a closed position, so tickers that
+// are no longer held are not valued or returned with the holdings. Returns nil if the ticker is not held.
+func (p *Portfolio) ClosePosition(ticker string, at time.Time) *ClosedPosition {
+	holding, ok := p.Holdings[ticker]
+	if !ok {
+		return nil
+	}
+
+	closed := &ClosedPosition{Ticker: ticker, RealizedGain: holding.RealizedGain, ClosedAt: at}
+	delete(p.Holdings, ticker)
+	p.ClosedPositions = append(p.ClosedPositions, closed)
+
+	return closed
+}
+
+// Position returns the holding of a ticker. A position that was just closed is returned without shares
+// and with its realized gain, and nil is returned if the ticker was never held.
+func (p *Portfolio) Position(ticker string) *Holding {
+	if holding, ok := p.Holdings[ticker]; ok {
+		return holding.Copy()
+	}
+
+	for i := len(p.ClosedPositions) - 1; i >= 0; i-- {
+		if closed := p.ClosedPositions[i]; closed.Ticker == ticker {
+			return &Holding{RealizedGain: closed.RealizedGain}
+		}
+	}
 
 	return nil
 }
 
 // Execute executes a transaction (buy or sell) on the portfolio.
 // It routes the transaction to the appropriate handler based on the action.
+// Transactions in another currency than the portfolio's currency of record are rejected.
 func (p *Portfolio) Execute(transaction *Transaction) error {
+	if transaction.CurrencyOfRecord() != p.CurrencyOfRecord() {
+		return fmt.Errorf("transaction currency %s does not match portfolio currency %s", transaction.CurrencyOfRecord(), p.CurrencyOfRecord())
+	}
+
+	var err error
 	switch transaction.Action {
 	case "buy":
-		return p.Buy(transaction)
+		err = p.Buy(transaction)
 	case "sell":
-		return p.Sell(transaction)
+		err = p.Sell(transaction)
 	default:
-		return fmt.Errorf("invalid transaction action: %s", transaction.Action)
+		err = fmt.Errorf("invalid transaction action: %s", transaction.Action)
+	}
+
+	if err != nil {
+		return err
 	}
+
+	p.RecordTurnover(transaction)
+	return nil
 }
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on profile fields
+const (
+	MaxDisplayNameLength = 32  // Maximum characters in a display name
+	MaxDescriptionLength = 500 // Maximum characters in a strategy description
+	MaxLinkLabelLength   = 32  // Maximum characters in a link label
+	MaxURLLength         = 512 // Maximum characters in an avatar or link URL
+	MaxProfileLinks      = 5   // Maximum number of links
+)
+
+// Moderation states of a profile
+const (
+	ProfileVisible = "visible" // Shown publicly
+	ProfileFlagged = "flagged" // Automatically flagged, hidden until an admin reviews it
+	ProfileHidden  = "hidden"  // Hidden by an admin
+)
+
+// ProfileLink is a labelled link shown on a bot's profile
+type ProfileLink struct {
+	Label string `json:"label" firestore:"label"` // Text shown for the link
+	URL   string `json:"url" firestore:"url"`     // HTTP or HTTPS URL
+}
+
+// BotProfile contains the public display information of a bot
+type BotProfile struct {
+	DisplayName      string         `json:"displayName" firestore:"displayName"`           // Name shown instead of the bot ID
+	AvatarURL        string         `json:"avatarUrl" firestore:"avatarUrl"`               // HTTPS URL of the avatar image
+	Description      string         `json:"description" firestore:"description"`           // Description of the bot's strategy
+	Links            []*ProfileLink `json:"links" firestore:"links"`                       // Links such as a repository or write-up
+	Moderation       string         `json:"moderation" firestore:"moderation"`             // Moderation state
+	ModerationReason string         `json:"moderationReason" firestore:"moderationReason"` // Why the profile was flagged or hidden
+	UpdatedAt        time.Time      `json:"updatedAt" firestore:"updatedAt"`               // When the bot last changed its profile
+}
+
+// Validate normalizes the profile fields and checks them against the profile limits
+func (p *BotProfile) Validate() error {
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	p.Description = strings.TrimSpace(p.Description)
+	p.AvatarURL = strings.TrimSpace(p.AvatarURL)
+
+	if err := validateText("displayName", p.DisplayName, MaxDisplayNameLength, false); err != nil {
+		return err
+	}
+
+	if err := validateText("description", p.Description, MaxDescriptionLength, true); err != nil {
+		return err
+	}
+
+	if p.AvatarURL != "" {
+		if err := validateURL("avatarUrl", p.AvatarURL, "https"); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Links) > MaxProfileLinks {
+		return fmt.Errorf("a profile may have at most %d links", MaxProfileLinks)
+	}
+
+	for i, link := range p.Links {
+		if link == nil {
+			return fmt.Errorf("links[%d] is empty", i)
+		}
+
+		link.Label = strings.TrimSpace(link.Label)
+		link.URL = strings.TrimSpace(link.URL)
+
+		if link.Label == "" {
+			return fmt.Errorf("links[%d].label is required", i)
+		}
+
+		if err := validateText(fmt.Sprintf("links[%d].label", i), link.Label, MaxLinkLabelLength, false); err != nil {
+			return err
+		}
+
+		if err := validateURL(fmt.Sprintf("links[%d].url", i), link.URL, "https", "http"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Moderate flags the profile if any of its text contains a blocked word, and marks it visible otherwise.
+// Profiles hidden by an admin stay hidden.
+func (p *BotProfile) Moderate(blockedWords []string) {
+	if p.Moderation == ProfileHidden {
+		return
+	}
+
+	text := strings.ToLower(p.DisplayName + " " + p.Description)
+	for _, link := range p.Links {
+		text += " " + strings.ToLower(link.Label)
+	}
+
+	for _, word := range blockedWords {
+		if word != "" && strings.Contains(text, strings.ToLower(word)) {
+			p.Moderation = ProfileFlagged
+			p.ModerationReason = "contains a blocked word"
+			return
+		}
+	}
+
+	p.Moderation = ProfileVisible
+	p.ModerationReason = ""
+}
+
+// Public checks whether the profile may be shown publicly
+func (p *BotProfile) Public() bool {
+	return p != nil && (p.Moderation == ProfileVisible || p.Moderation == "")
+}
+
+// PublicName returns the name to show publicly for a bot, its ID if it has no visible display name
+func (p *BotProfile) PublicName(botID string) string {
+	if p.Public() && p.DisplayName != "" {
+		return p.DisplayName
+	}
+
+	return botID
+}
+
+// validateText checks the length of a text field and rejects control characters
+func validateText(field, text string, maxLength int, allowNewlines bool) error {
+	if utf8.RuneCountInString(text) > maxLength {
+		return fmt.Errorf("%s must be at most %d characters", field, maxLength)
+	}
+
+	for _, r := range text {
+		if unicode.IsControl(r) && !(allowNewlines && r == '\n') {
+			return fmt.Errorf("%s must not contain control characters", field)
+		}
+	}
+
+	return nil
+}
+
+// validateURL checks that a URL is absolute, within the length limit and uses an allowed scheme
+func validateURL(field, rawURL string, schemes ...string) error {
+	if len(rawURL) > MaxURLLength {
+		return fmt.Errorf("%s must be at most %d characters", field, MaxURLLength)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("%s must be an absolute URL", field)
+	}
+
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s must use %s", field, strings.Join(schemes, " or "))
+}
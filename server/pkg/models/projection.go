@@ -0,0 +1,152 @@
+package models
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// ProjectionPercentiles are the percentiles of the simulated account values reported by a projection
+var ProjectionPercentiles = []float64{5, 25, 50, 75, 95}
+
+// ProjectedValue is a percentile of the account values at the end of a projection
+type ProjectedValue struct {
+	Percentile   float64 `json:"percentile"`   // Percentile of the simulations, 50 is the median
+	AccountValue float64 `json:"accountValue"` // Account value not exceeded by this share of the simulations
+	Return       float64 `json:"return"`       // Return from the current account value, 0.05 is 5%
+}
+
+// Projection is the distribution of a portfolio's account value after a horizon, simulated by drawing whole days of
+// historical returns of its current holdings
+type Projection struct {
+	Horizon           int               `json:"horizon"`           // Trading days projected
+	Simulations       int               `json:"simulations"`       // Number of simulated paths
+	Days              int               `json:"days"`              // Historical days the returns were drawn from
+	Seed              uint64            `json:"seed"`              // Seed of the random draws, the same seed and history project the same values
+	AccountValue      float64           `json:"accountValue"`      // Account value at the live prices
+	Mean              float64           `json:"mean"`              // Mean simulated account value
+	ProbabilityOfLoss float64           `json:"probabilityOfLoss"` // Share of the simulations that end below the current account value
+	Percentiles       []*ProjectedValue `json:"percentiles"`       // Percentiles of the simulated account values, lowest first
+}
+
+// ProjectValue projects the account value of an exposure after horizon trading days with a Monte Carlo bootstrap.
+// Each simulation draws horizon days with replacement from the last days rows of the history on which every
+// position has a return, and applies the returns of all positions of the drawn day together, so the correlation of
+// the holdings is kept. Positions are held without trading and cash earns nothing. Days on which a position has no
+// return are skipped, so fewer days than requested may be drawn from. Returns nil if positions are held but fewer
+// than two days can be drawn from.
+func (h *History) ProjectValue(exposure *Exposure, days, horizon, simulations int, seed uint64) *Projection {
+	projection := &Projection{
+		Horizon:      horizon,
+		Simulations:  simulations,
+		Seed:         seed,
+		AccountValue: exposure.AccountValue,
+	}
+
+	values := make([]float64, simulations)
+	if len(exposure.Positions) == 0 {
+		// A portfolio of cash only never moves
+		for i := range values {
+			values[i] = exposure.AccountValue
+		}
+	} else {
+		growth := h.jointReturns(exposure.Positions, days)
+		projection.Days = len(growth)
+		if len(growth) < 2 {
+			return nil
+		}
+
+		rng := rand.New(rand.NewPCG(seed, seed))
+		positions := make([]float64, len(exposure.Positions))
+		for i := range values {
+			for j, position := range exposure.Positions {
+				positions[j] = position.Value
+			}
+
+			for range horizon {
+				day := growth[rng.IntN(len(growth))]
+				for j := range positions {
+					positions[j] *= day[j]
+				}
+			}
+
+			value := exposure.Cash
+			for _, position := range positions {
+				value += position
+			}
+
+			values[i] = value
+		}
+	}
+
+	policy := money.Default()
+	sort.Float64s(values)
+	sum, losses := 0.0, 0
+	for _, value := range values {
+		sum += value
+		if value < exposure.AccountValue {
+			losses++
+		}
+	}
+
+	projection.Mean = policy.Round(sum / float64(len(values)))
+	projection.ProbabilityOfLoss = float64(losses) / float64(len(values))
+	projection.Percentiles = make([]*ProjectedValue, 0, len(ProjectionPercentiles))
+	for _, percentile := range ProjectionPercentiles {
+		value := values[int(math.Round(percentile/100*float64(len(values)-1)))]
+		projected := &ProjectedValue{Percentile: percentile, AccountValue: policy.Round(value)}
+		if exposure.AccountValue > 0 {
+			projected.Return = value/exposure.AccountValue - 1
+		}
+
+		projection.Percentiles = append(projection.Percentiles, projected)
+	}
+
+	return projection
+}
+
+// jointReturns returns the growth factor of every position on each of the last days rows of the history on which
+// every position has a return, in the order of the positions
+func (h *History) jointReturns(positions []*PositionWeight, days int) [][]float64 {
+	if len(h.Rows) < 2 || days <= 0 {
+		return nil
+	}
+
+	since := h.Rows[max(len(h.Rows)-days, 1)].Date
+	matrix := h.Returns()
+	growth := make(map[time.Time][]float64)
+	for j, position := range positions {
+		for _, r := range matrix.Since(position.Ticker, since) {
+			day, ok := growth[r.Date]
+			if !ok {
+				day = make([]float64, len(positions))
+				growth[r.Date] = day
+			}
+
+			day[j] = math.Exp(r.LogReturn)
+		}
+	}
+
+	dates := make([]time.Time, 0, len(growth))
+	for date, day := range growth {
+		if !slices.Contains(day, 0) {
+			dates = append(dates, date)
+		}
+	}
+
+	// Days are drawn by index, so they are ordered to make a seed reproducible
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	joint := make([][]float64, 0, len(dates))
+	for _, date := range dates {
+		joint = append(joint, growth[date])
+	}
+
+	return joint
+}
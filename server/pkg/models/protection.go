@@ -0,0 +1,46 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Triggers of a position protection
+const (
+	ProtectionStopLoss   = "stop_loss"   // The price fell to or below the stop-loss level
+	ProtectionTakeProfit = "take_profit" // The price rose to or above the take-profit level
+)
+
+// PositionProtection closes a whole holding when the price crosses one of its levels.
+// It belongs to the holding, so it covers shares bought later and ends when the position is closed.
+type PositionProtection struct {
+	StopLoss   float64   `json:"stopLoss,omitempty" firestore:"stopLoss,omitempty"`     // Price at or below which the position is closed, 0 if unset
+	TakeProfit float64   `json:"takeProfit,omitempty" firestore:"takeProfit,omitempty"` // Price at or above which the position is closed, 0 if unset
+	SetAt      time.Time `json:"setAt" firestore:"setAt"`                               // When the levels were set, identifies the protection
+}
+
+// Validate checks that at least one level is set and that the stop-loss is below the take-profit
+func (p *PositionProtection) Validate() error {
+	switch {
+	case p.StopLoss < 0 || p.TakeProfit < 0:
+		return fmt.Errorf("stopLoss and takeProfit must not be negative")
+	case p.StopLoss == 0 && p.TakeProfit == 0:
+		return fmt.Errorf("a stopLoss or takeProfit is required")
+	case p.StopLoss > 0 && p.TakeProfit > 0 && p.StopLoss >= p.TakeProfit:
+		return fmt.Errorf("stopLoss must be below takeProfit")
+	}
+
+	return nil
+}
+
+// Triggered returns the trigger the price crosses, empty if the price is between the levels
+func (p *PositionProtection) Triggered(price float64) string {
+	switch {
+	case p.StopLoss > 0 && price <= p.StopLoss:
+		return ProtectionStopLoss
+	case p.TakeProfit > 0 && price >= p.TakeProfit:
+		return ProtectionTakeProfit
+	default:
+		return ""
+	}
+}
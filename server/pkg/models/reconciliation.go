@@ -0,0 +1,156 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// Fields of a portfolio compared by the reconciliation
+const (
+	DivergenceCash         = "cash"         // Cash balance
+	DivergenceShares       = "shares"       // Shares held of a ticker
+	DivergenceTransactions = "transactions" // Transactions referenced by the portfolio
+)
+
+// Review states of a reconciliation flag
+const (
+	ReconciliationOpen      = "open"      // Waiting for an admin to review the divergence
+	ReconciliationResolved  = "resolved"  // An admin corrected the portfolio, the flag reopens if it still diverges
+	ReconciliationDismissed = "dismissed" // An admin accepted the divergence, the flag reopens only if it changes
+	ReconciliationCleared   = "cleared"   // The portfolio matched its transactions again before it was reviewed
+)
+
+// ReconcileTolerance is how far the stored portfolio may be from the recomputed one before it is flagged
+type ReconcileTolerance struct {
+	Cash   float64 `json:"cash"`   // Difference of the cash balance in the currency of record
+	Shares float64 `json:"shares"` // Difference of the shares held of any ticker
+}
+
+// Divergence is a field of a stored portfolio that differs from the value recomputed from its transactions
+type Divergence struct {
+	Field      string  `json:"field" firestore:"field"`                       // "cash", "shares" or "transactions"
+	Ticker     string  `json:"ticker,omitempty" firestore:"ticker,omitempty"` // Ticker of a shares divergence
+	Stored     float64 `json:"stored" firestore:"stored"`                     // Value in the portfolio document
+	Recomputed float64 `json:"recomputed" firestore:"recomputed"`             // Value recomputed from the transactions
+	Difference float64 `json:"difference" firestore:"difference"`             // Stored minus recomputed
+}
+
+// Reconcile recomputes the cash and shares of a portfolio by applying its transactions in time order to its inception
+// value, and returns the fields of the stored portfolio that differ from them by more than the tolerance. The number of
+// transactions must match the transactions the portfolio references exactly.
+func Reconcile(portfolio *Portfolio, transactions []*Transaction, tolerance ReconcileTolerance) []*Divergence {
+	sorted := append([]*Transaction{}, transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	policy := money.Default()
+	cash := portfolio.InceptionValue
+	shares := make(map[string]float64)
+	for _, transaction := range sorted {
+		if transaction.Action == "buy" {
+			cash = policy.Sub(cash, policy.Sum(transaction.Value(), transaction.Fee))
+			shares[transaction.Ticker] += transaction.NumShares
+		} else {
+			cash = policy.Add(cash, policy.Sub(transaction.Value(), transaction.Fee))
+			shares[transaction.Ticker] -= transaction.NumShares
+		}
+	}
+
+	divergences := make([]*Divergence, 0)
+	if math.Abs(portfolio.Cash-cash) > tolerance.Cash {
+		divergences = append(divergences, newDivergence(DivergenceCash, "", portfolio.Cash, cash))
+	}
+
+	tickers := make([]string, 0, len(shares)+len(portfolio.Holdings))
+	for ticker := range shares {
+		tickers = append(tickers, ticker)
+	}
+
+	for ticker := range portfolio.Holdings {
+		if _, ok := shares[ticker]; !ok {
+			tickers = append(tickers, ticker)
+		}
+	}
+
+	sort.Strings(tickers)
+	for _, ticker := range tickers {
+		stored := 0.0
+		if holding, ok := portfolio.Holdings[ticker]; ok {
+			stored = holding.NumShares
+		}
+
+		// Positions sold down to rounding dust are closed, so dust never counts as a divergence
+		recomputed := shares[ticker]
+		if math.Abs(recomputed) <= DustShares {
+			recomputed = 0
+		}
+
+		if math.Abs(stored-recomputed) > tolerance.Shares {
+			divergences = append(divergences, newDivergence(DivergenceShares, ticker, stored, recomputed))
+		}
+	}
+
+	if referenced := len(portfolio.TransactionReferences); referenced != len(transactions) {
+		divergences = append(divergences, newDivergence(DivergenceTransactions, "", float64(referenced), float64(len(transactions))))
+	}
+
+	return divergences
+}
+
+// newDivergence creates a divergence between a stored and a recomputed value
+func newDivergence(field, ticker string, stored, recomputed float64) *Divergence {
+	return &Divergence{Field: field, Ticker: ticker, Stored: stored, Recomputed: recomputed, Difference: stored - recomputed}
+}
+
+// SameDivergences checks whether two lists of divergences report the same fields with the same values
+func SameDivergences(a, b []*Divergence) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if *a[i] != *b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ReconciliationFlag is a portfolio whose stored cash or holdings diverged from its transactions, kept for admin review.
+// Each portfolio has at most one flag, stored under the ID of the portfolio document.
+type ReconciliationFlag struct {
+	ID          string                 `json:"id" firestore:"-"`                                      // ID of the portfolio document
+	Bot         *firestore.DocumentRef `json:"-" firestore:"bot"`                                     // Portfolio that diverged, a bot or a shadow portfolio
+	BotID       string                 `json:"botId" firestore:"botId"`                               // ID of the bot, the owner for shadow portfolios
+	Shadow      bool                   `json:"shadow" firestore:"shadow"`                             // Whether the portfolio is a shadow portfolio
+	Status      string                 `json:"status" firestore:"status"`                             // "open", "resolved", "dismissed" or "cleared"
+	Divergences []*Divergence          `json:"divergences" firestore:"divergences"`                   // Fields that diverged in the last run that found a divergence
+	FirstSeen   time.Time              `json:"firstSeen" firestore:"firstSeen"`                       // When the divergence was first found since the flag was last opened
+	LastSeen    time.Time              `json:"lastSeen" firestore:"lastSeen"`                         // When a run last found the divergence
+	ReviewedAt  time.Time              `json:"reviewedAt,omitempty" firestore:"reviewedAt,omitempty"` // When an admin last reviewed the flag
+	ReviewNote  string                 `json:"reviewNote,omitempty" firestore:"reviewNote,omitempty"` // Note of the last review
+}
+
+// Observe records divergences found by a run. A dismissed flag stays dismissed while the divergences are unchanged,
+// and any other flag is opened again. Returns whether the flag is open afterwards.
+func (f *ReconciliationFlag) Observe(divergences []*Divergence, now time.Time) bool {
+	if f.Status == ReconciliationDismissed && SameDivergences(f.Divergences, divergences) {
+		f.LastSeen = now
+		return false
+	}
+
+	if f.Status != ReconciliationOpen {
+		f.Status = ReconciliationOpen
+		f.FirstSeen = now
+	}
+
+	f.Divergences = divergences
+	f.LastSeen = now
+	return true
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// Replay frame types
+const (
+	ReplayValuation   = "valuation"   // The portfolio was valued
+	ReplayTransaction = "transaction" // The portfolio traded
+)
+
+// ReplayFrame is the state of a portfolio at a valuation or right after a transaction
+type ReplayFrame struct {
+	Time         time.Time          `json:"time"`                  // When the portfolio was valued or traded
+	Type         string             `json:"type"`                  // "valuation" or "transaction"
+	AccountValue float64            `json:"accountValue"`          // Value of the valuation, the most recent valuation for transactions
+	Cash         float64            `json:"cash"`                  // Cash after every transaction up to this frame
+	Positions    map[string]float64 `json:"positions"`             // Shares held by ticker after every transaction up to this frame
+	Transaction  *Transaction       `json:"transaction,omitempty"` // The transaction, only on transaction frames
+}
+
+// Replay is the history of a portfolio as a time-ordered stream of valuations and transactions
+type Replay struct {
+	Currency     string         `json:"currency"`     // Currency of every amount
+	StartingCash float64        `json:"startingCash"` // Cash before the first transaction
+	Tickers      []string       `json:"tickers"`      // Every ticker held in a frame, sorted
+	Frames       []*ReplayFrame `json:"frames"`       // Frames ordered by time, transactions before valuations at the same time
+}
+
+// BuildReplay merges the valuations and transactions of a portfolio into frames with the cash and positions at
+// each point. The starting cash is derived from the current cash, so frames end at the portfolio's current cash.
+// Only frames between start and end are returned, zero times leave the range open.
+func BuildReplay(portfolio *Portfolio, transactions []*Transaction, start, end time.Time) *Replay {
+	sorted := append([]*Transaction{}, transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	policy := money.Default()
+	cash := portfolio.Cash
+	for _, transaction := range sorted {
+		if transaction.Action == "buy" {
+			cash = policy.Add(cash, policy.Sum(transaction.Value(), transaction.Fee))
+		} else {
+			cash = policy.Sub(cash, policy.Sub(transaction.Value(), transaction.Fee))
+		}
+	}
+
+	replay := &Replay{
+		Currency:     portfolio.CurrencyOfRecord(),
+		StartingCash: cash,
+		Tickers:      make([]string, 0),
+		Frames:       make([]*ReplayFrame, 0, len(sorted)+len(portfolio.HistoricalAccountValue)),
+	}
+
+	inRange := func(at time.Time) bool {
+		return (start.IsZero() || !at.Before(start)) && (end.IsZero() || at.Before(end))
+	}
+
+	tickers := make(map[string]bool)
+	positions := make(map[string]float64)
+	snapshot := func() map[string]float64 {
+		copied := make(map[string]float64, len(positions))
+		for ticker, shares := range positions {
+			copied[ticker] = shares
+			tickers[ticker] = true
+		}
+
+		return copied
+	}
+
+	value := 0.0
+	valuations := portfolio.HistoricalAccountValue
+	for i := 0; i < len(sorted) || len(valuations) > 0; {
+		// Transactions come first at the same time, so the valuation reflects them
+		if len(valuations) > 0 && (i == len(sorted) || valuations[0].Date.Before(sorted[i].Time)) {
+			valuation := valuations[0]
+			valuations = valuations[1:]
+			value = valuation.Value
+
+			if inRange(valuation.Date) {
+				replay.Frames = append(replay.Frames, &ReplayFrame{
+					Time:         valuation.Date,
+					Type:         ReplayValuation,
+					AccountValue: value,
+					Cash:         cash,
+					Positions:    snapshot(),
+				})
+			}
+
+			continue
+		}
+
+		transaction := sorted[i]
+		i++
+
+		if transaction.Action == "buy" {
+			cash = policy.Sub(cash, policy.Sum(transaction.Value(), transaction.Fee))
+			positions[transaction.Ticker] += transaction.NumShares
+		} else {
+			cash = policy.Add(cash, policy.Sub(transaction.Value(), transaction.Fee))
+			positions[transaction.Ticker] -= transaction.NumShares
+		}
+
+		if positions[transaction.Ticker] <= DustShares {
+			delete(positions, transaction.Ticker)
+		}
+
+		if inRange(transaction.Time) {
+			replay.Frames = append(replay.Frames, &ReplayFrame{
+				Time:         transaction.Time,
+				Type:         ReplayTransaction,
+				AccountValue: value,
+				Cash:         cash,
+				Positions:    snapshot(),
+				Transaction:  transaction,
+			})
+		}
+	}
+
+	for ticker := range tickers {
+		replay.Tickers = append(replay.Tickers, ticker)
+	}
+
+	sort.Strings(replay.Tickers)
+	return replay
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// Frequency is the period length of a resampled history
+type Frequency string
+
+// Supported history frequencies
+const (
+	Daily   Frequency = "daily"   // One row per trading day
+	Weekly  Frequency = "weekly"  // One row per week, weeks start on Monday
+	Monthly Frequency = "monthly" // One row per calendar month
+)
+
+// ParseFrequency converts a name into a Frequency, an empty name is Daily
+func ParseFrequency(name string) (Frequency, error) {
+	switch frequency := Frequency(name); frequency {
+	case "":
+		return Daily, nil
+	case Daily, Weekly, Monthly:
+		return frequency, nil
+	default:
+		return "", fmt.Errorf("unknown frequency %q, must be daily, weekly or monthly", name)
+	}
+}
+
+// periodStart returns the start of the period of the frequency that contains date
+func (f Frequency) periodStart(date time.Time) time.Time {
+	year, month, day := date.Date()
+	switch f {
+	case Weekly:
+		offset := (int(date.Weekday()) + 6) % 7 // Days since Monday
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, date.Location())
+	case Monthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, date.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, date.Location())
+	}
+}
+
+// Resample aggregates chronological daily rows into rows of the given frequency.
+// Each resampled row is dated on the last trading day of its period. Prices open at the
+// first day and close at the last day a ticker traded in the period, highs and lows are
+// the extremes of the period, and volumes and dividends are summed. Split factors are
+// multiplied and indicators are taken from the last trading day.
+func Resample(rows []*Row, frequency Frequency) []*Row {
+	if frequency == Daily || frequency == "" {
+		return rows
+	}
+
+	resampled := make([]*Row, 0)
+	var current *Row
+	var start time.Time
+
+	for _, row := range rows {
+		if periodStart := frequency.periodStart(row.Date); current == nil || !periodStart.Equal(start) {
+			start = periodStart
+			current = &Row{Data: xsync.NewMapOf[string, *TickerPeriod]()}
+			resampled = append(resampled, current)
+		}
+
+		current.Date = row.Date
+		row.Data.Range(func(ticker string, period *TickerPeriod) bool {
+			aggregate, ok := current.Data.Load(ticker)
+			if !ok {
+				copied := *period
+				copied.Indicators = maps.Clone(period.Indicators)
+				current.Data.Store(ticker, &copied)
+				return true
+			}
+
+			aggregate.merge(period)
+			return true
+		})
+	}
+
+	return resampled
+}
+
+// merge folds the next period of the same ticker into an aggregated period
+func (tp *TickerPeriod) merge(next *TickerPeriod) {
+	tp.High = max(tp.High, next.High)
+	tp.Low = min(tp.Low, next.Low)
+	tp.Close = next.Close
+	tp.Volume += next.Volume
+	tp.AdjHigh = max(tp.AdjHigh, next.AdjHigh)
+	tp.AdjLow = min(tp.AdjLow, next.AdjLow)
+	tp.AdjClose = next.AdjClose
+	tp.AdjVolume += next.AdjVolume
+	tp.DivCash += next.DivCash
+	tp.SplitFactor *= next.SplitFactor
+	tp.Indicators = maps.Clone(next.Indicators)
+}
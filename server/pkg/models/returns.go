@@ -0,0 +1,91 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// daysPerYear is the average length of a year used to annualize returns
+const daysPerYear = 365.25
+
+// Inception returns when the portfolio started and the value it started with.
+// Portfolios created before inception was recorded fall back to their first historical
+// account value, or to their current value if they have no history.
+func (p *Portfolio) Inception() (time.Time, float64) {
+	if p.InceptionValue > 0 {
+		return p.InceptionDate, p.InceptionValue
+	}
+
+	for _, history := range p.HistoricalAccountValue {
+		if history.Value > 0 {
+			return history.Date, history.Value
+		}
+	}
+
+	return time.Time{}, p.AccountValue
+}
+
+// Returns calculates the return of an account value since the portfolio's inception,
+// and the same return annualized. Returns of portfolios younger than a year are not
+// annualized, since extrapolating a few days of trading would exaggerate them.
+func (p *Portfolio) Returns(value float64, at time.Time) (total, annualized float64) {
+	inceptionDate, inceptionValue := p.Inception()
+	if inceptionValue <= 0 {
+		return 0, 0
+	}
+
+	total = value/inceptionValue - 1
+
+	years := at.Sub(inceptionDate).Hours() / 24 / daysPerYear
+	if inceptionDate.IsZero() || years < 1 || value <= 0 {
+		return total, total
+	}
+
+	return total, math.Pow(value/inceptionValue, 1/years) - 1
+}
+
+// PeriodReturn is the return of a portfolio between two valuations
+type PeriodReturn struct {
+	Since      time.Time `json:"since"`      // Date of the valuation the period is measured from
+	StartValue float64   `json:"startValue"` // Account value at the start of the period
+	Until      time.Time `json:"until"`      // Date of the valuation the period is measured to
+	EndValue   float64   `json:"endValue"`   // Account value at the end of the period
+	Return     float64   `json:"return"`     // Return over the period, 0.05 is 5%
+}
+
+// ReturnBetween calculates the return from the last valuation on or before start to the last valuation before end.
+// Portfolios whose inception is after start are measured from their inception, so late joiners are compared by their
+// return since joining. Returns nil if the portfolio has no valuation since its inception before end.
+func (p *Portfolio) ReturnBetween(start, end time.Time) *PeriodReturn {
+	inceptionDate, inceptionValue := p.Inception()
+
+	var from, to *AccountValueHistory
+	for _, history := range p.HistoricalAccountValue {
+		if history.Value <= 0 || !history.Date.Before(end) || history.Date.Before(inceptionDate) {
+			continue
+		}
+
+		if !history.Date.After(start) || from == nil {
+			from = history
+		}
+
+		to = history
+	}
+
+	if to == nil {
+		return nil
+	}
+
+	// Valuations of late joiners start after the window, their inception value is where they started
+	if from.Date.After(start) && inceptionDate.After(start) && inceptionValue > 0 {
+		from = &AccountValueHistory{Date: inceptionDate, Value: inceptionValue}
+	}
+
+	return &PeriodReturn{
+		Since:      from.Date,
+		StartValue: from.Value,
+		Until:      to.Date,
+		EndValue:   to.Value,
+		Return:     to.Value/from.Value - 1,
+	}
+}
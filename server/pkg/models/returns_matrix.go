@@ -0,0 +1,149 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// returnsInit serializes building the returns matrix of a history on first use
+var returnsInit sync.Mutex
+
+// DailyReturn is the log return of a ticker's adjusted close from its previous bar
+type DailyReturn struct {
+	Date      time.Time `json:"date"`      // Date of the bar
+	LogReturn float64   `json:"logReturn"` // Natural log of the adjusted close over the previous bar's adjusted close
+}
+
+// ReturnsMatrix caches the daily log returns of every ticker of a history, derived from the adjusted closes.
+// It is updated incrementally as bars are added, so analytics do not recompute returns from the full history.
+type ReturnsMatrix struct {
+	mu     sync.RWMutex
+	series map[string][]DailyReturn // Returns by ticker, oldest first
+}
+
+// newReturnsMatrix derives the returns of every ticker from the rows of a history
+func newReturnsMatrix(h *History) *ReturnsMatrix {
+	m := &ReturnsMatrix{series: make(map[string][]DailyReturn, len(h.Tickers))}
+
+	previous := make(map[string]float64, len(h.Tickers))
+	for _, row := range h.Rows {
+		row.Data.Range(func(ticker string, period *TickerPeriod) bool {
+			if period.AdjClose <= 0 {
+				return true
+			}
+
+			if last, ok := previous[ticker]; ok {
+				m.series[ticker] = append(m.series[ticker], DailyReturn{row.Date, math.Log(period.AdjClose / last)})
+			}
+
+			previous[ticker] = period.AdjClose
+			return true
+		})
+	}
+
+	return m
+}
+
+// update recomputes the returns of a ticker dated on or after from, after its bars from that date changed
+func (m *ReturnsMatrix) update(rows []*Row, ticker string, from time.Time) {
+	start := sort.Search(len(rows), func(i int) bool {
+		return !rows[i].Date.Before(from)
+	})
+
+	last := 0.0
+	for i := start - 1; i >= 0; i-- {
+		if period, ok := rows[i].Data.Load(ticker); ok && period.AdjClose > 0 {
+			last = period.AdjClose
+			break
+		}
+	}
+
+	updated := make([]DailyReturn, 0, len(rows)-start)
+	for _, row := range rows[start:] {
+		period, ok := row.Data.Load(ticker)
+		if !ok || period.AdjClose <= 0 {
+			continue
+		}
+
+		if last > 0 {
+			updated = append(updated, DailyReturn{row.Date, math.Log(period.AdjClose / last)})
+		}
+
+		last = period.AdjClose
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.series[ticker]
+	kept := sort.Search(len(series), func(i int) bool {
+		return !series[i].Date.Before(from)
+	})
+
+	m.series[ticker] = append(series[:kept:kept], updated...)
+	if len(m.series[ticker]) == 0 {
+		delete(m.series, ticker)
+	}
+}
+
+// evict removes the returns dated before the given time
+func (m *ReturnsMatrix) evict(before time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for ticker, series := range m.series {
+		i := sort.Search(len(series), func(i int) bool {
+			return !series[i].Date.Before(before)
+		})
+
+		m.series[ticker] = append([]DailyReturn{}, series[i:]...)
+	}
+}
+
+// Since returns a copy of the returns of a ticker dated on or after the given time, oldest first
+func (m *ReturnsMatrix) Since(ticker string, since time.Time) []DailyReturn {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	series := m.series[ticker]
+	i := sort.Search(len(series), func(i int) bool {
+		return !series[i].Date.Before(since)
+	})
+
+	return append([]DailyReturn{}, series[i:]...)
+}
+
+// Points returns the number of cached returns across all tickers
+func (m *ReturnsMatrix) Points() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	points := 0
+	for _, series := range m.series {
+		points += len(series)
+	}
+
+	return points
+}
+
+// Returns returns the daily returns matrix of the history, deriving it from the rows on first use
+func (h *History) Returns() *ReturnsMatrix {
+	returnsInit.Lock()
+	defer returnsInit.Unlock()
+
+	if h.returns == nil {
+		h.returns = newReturnsMatrix(h)
+	}
+
+	return h.returns
+}
+
+// builtReturns returns the returns matrix if it was built, nil otherwise
+func (h *History) builtReturns() *ReturnsMatrix {
+	returnsInit.Lock()
+	defer returnsInit.Unlock()
+
+	return h.returns
+}
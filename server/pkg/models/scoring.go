@@ -0,0 +1,233 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Metrics that scoring rules can test
+const (
+	ScoreMetricReturn           = "return"            // Return since inception, 0.05 is 5%
+	ScoreMetricAnnualizedReturn = "annualized_return" // Return since inception, annualized for portfolios older than a year
+	ScoreMetricSharpe           = "sharpe"            // Annualized Sharpe ratio of the daily returns
+	ScoreMetricMaxDrawdown      = "max_drawdown"      // Largest fall from a peak account value, 0.1 is 10%
+	ScoreMetricTurnover         = "turnover"          // Traded value divided by the average account value
+	ScoreMetricTrades           = "trades"            // Number of transactions
+)
+
+// tradingDaysPerYear annualizes the Sharpe ratio of daily returns
+const tradingDaysPerYear = 252
+
+// ScoringRule adjusts the score of a bot whose metric passes a threshold.
+// Positive points are bonuses and negative points are penalties.
+type ScoringRule struct {
+	Name      string  `json:"name" firestore:"name"`           // Name shown with the adjustment
+	Metric    string  `json:"metric" firestore:"metric"`       // Metric tested by the rule
+	Operator  string  `json:"operator" firestore:"operator"`   // Comparison with the threshold, ">", ">=", "<" or "<="
+	Threshold float64 `json:"threshold" firestore:"threshold"` // Value the metric is compared with
+	Points    float64 `json:"points" firestore:"points"`       // Points added to the score when the rule matches
+}
+
+// ScoreMetrics are the performance statistics of a bot that scoring rules test
+type ScoreMetrics struct {
+	Return           float64 `json:"return" firestore:"return"`                     // Return since inception
+	AnnualizedReturn float64 `json:"annualizedReturn" firestore:"annualizedReturn"` // Annualized return since inception
+	Sharpe           float64 `json:"sharpe" firestore:"sharpe"`                     // Annualized Sharpe ratio of the daily returns
+	MaxDrawdown      float64 `json:"maxDrawdown" firestore:"maxDrawdown"`           // Largest fall from a peak account value
+	Turnover         float64 `json:"turnover" firestore:"turnover"`                 // Traded value divided by the average account value
+	Trades           int     `json:"trades" firestore:"trades"`                     // Number of transactions
+}
+
+// ScoreAdjustment is a bonus or penalty applied by a matching scoring rule
+type ScoreAdjustment struct {
+	Rule   string  `json:"rule" firestore:"rule"`     // Name of the rule
+	Metric string  `json:"metric" firestore:"metric"` // Metric tested by the rule
+	Value  float64 `json:"value" firestore:"value"`   // Value of the metric at settlement
+	Points float64 `json:"points" firestore:"points"` // Points added to the score
+}
+
+// Score is the composite score of a bot at its last settlement. The base score is the
+// return since inception in percent, so one point is worth one percentage point of return.
+type Score struct {
+	Base        float64           `json:"base" firestore:"base"`               // Return since inception in percent
+	Adjustments []ScoreAdjustment `json:"adjustments" firestore:"adjustments"` // Bonuses and penalties of matching rules
+	Composite   float64           `json:"composite" firestore:"composite"`     // Base score plus every adjustment
+	Metrics     *ScoreMetrics     `json:"metrics" firestore:"metrics"`         // Metrics the rules were evaluated against
+	SettledAt   time.Time         `json:"settledAt" firestore:"settledAt"`     // When the score was calculated
+}
+
+// Validate checks that the rule tests a known metric with a known operator
+func (r *ScoringRule) Validate() error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("name is required")
+	case !validScoreMetric(r.Metric):
+		return fmt.Errorf("metric must be return, annualized_return, sharpe, max_drawdown, turnover or trades")
+	case r.Operator != ">" && r.Operator != ">=" && r.Operator != "<" && r.Operator != "<=":
+		return fmt.Errorf("operator must be >, >=, < or <=")
+	case r.Points == 0:
+		return fmt.Errorf("points must not be zero")
+	}
+
+	return nil
+}
+
+// Matches checks whether a metric value passes the threshold of the rule
+func (r *ScoringRule) Matches(value float64) bool {
+	switch r.Operator {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	default:
+		return false
+	}
+}
+
+// validScoreMetric checks whether scoring rules can test a metric
+func validScoreMetric(metric string) bool {
+	switch metric {
+	case ScoreMetricReturn, ScoreMetricAnnualizedReturn, ScoreMetricSharpe, ScoreMetricMaxDrawdown, ScoreMetricTurnover, ScoreMetricTrades:
+		return true
+	default:
+		return false
+	}
+}
+
+// Value returns the value of a metric
+func (m *ScoreMetrics) Value(metric string) float64 {
+	switch metric {
+	case ScoreMetricReturn:
+		return m.Return
+	case ScoreMetricAnnualizedReturn:
+		return m.AnnualizedReturn
+	case ScoreMetricSharpe:
+		return m.Sharpe
+	case ScoreMetricMaxDrawdown:
+		return m.MaxDrawdown
+	case ScoreMetricTurnover:
+		return m.Turnover
+	case ScoreMetricTrades:
+		return float64(m.Trades)
+	default:
+		return 0
+	}
+}
+
+// CalculateScoreMetrics calculates the performance statistics of a portfolio valued at value at the given time.
+// Only daily account values and transactions since the portfolio's inception are included.
+func CalculateScoreMetrics(p *Portfolio, transactions []*Transaction, value float64, at time.Time) *ScoreMetrics {
+	inceptionDate, inceptionValue := p.Inception()
+	metrics := &ScoreMetrics{}
+	metrics.Return, metrics.AnnualizedReturn = p.Returns(value, at)
+
+	// The history value of the current day is replaced by the given value
+	today := at.Truncate(24 * time.Hour)
+	values := make([]float64, 0, len(p.HistoricalAccountValue)+1)
+	for _, history := range p.HistoricalAccountValue {
+		if !history.Date.Before(inceptionDate) && history.Date.Before(today) && history.Value > 0 {
+			values = append(values, history.Value)
+		}
+	}
+
+	values = append(values, value)
+	metrics.Sharpe = sharpeRatio(values)
+	metrics.MaxDrawdown = maxDrawdown(values)
+
+	traded := 0.0
+	for _, transaction := range transactions {
+		if transaction.Time.Before(inceptionDate) {
+			continue
+		}
+
+		traded += transaction.Value()
+		metrics.Trades++
+	}
+
+	average := inceptionValue
+	if len(values) > 0 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+
+		average = sum / float64(len(values))
+	}
+
+	if average > 0 {
+		metrics.Turnover = traded / average
+	}
+
+	return metrics
+}
+
+// sharpeRatio returns the annualized Sharpe ratio of the returns between daily values,
+// assuming a risk free rate of zero. Returns 0 without at least two returns or any variation.
+func sharpeRatio(values []float64) float64 {
+	if len(values) < 3 {
+		return 0
+	}
+
+	returns := make([]float64, 0, len(values)-1)
+	mean := 0.0
+	for i := 1; i < len(values); i++ {
+		r := values[i]/values[i-1] - 1
+		returns = append(returns, r)
+		mean += r
+	}
+
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+
+	return mean / std * math.Sqrt(tradingDaysPerYear)
+}
+
+// maxDrawdown returns the largest fall from a peak as a fraction of the peak
+func maxDrawdown(values []float64) float64 {
+	peak, drawdown := 0.0, 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+		if peak > 0 {
+			drawdown = max(drawdown, (peak-v)/peak)
+		}
+	}
+
+	return drawdown
+}
+
+// EvaluateScore applies scoring rules to the metrics of a bot
+func EvaluateScore(rules []ScoringRule, metrics *ScoreMetrics, at time.Time) *Score {
+	score := &Score{
+		Base:        metrics.Return * 100,
+		Adjustments: make([]ScoreAdjustment, 0),
+		Metrics:     metrics,
+		SettledAt:   at,
+	}
+
+	score.Composite = score.Base
+	for _, rule := range rules {
+		value := metrics.Value(rule.Metric)
+		if !rule.Matches(value) {
+			continue
+		}
+
+		score.Adjustments = append(score.Adjustments, ScoreAdjustment{Rule: rule.Name, Metric: rule.Metric, Value: value, Points: rule.Points})
+		score.Composite += rule.Points
+	}
+
+	return score
+}
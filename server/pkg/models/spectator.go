@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Scopes a spectator key can be granted
+const (
+	ScopeLeaderboard = "leaderboard" // Read competition leaderboards
+	ScopeMarketData  = "market_data" // Read stock prices and quotes
+	ScopePortfolio   = "portfolio"   // Read the sanitized portfolio of the designated bot
+)
+
+// SpectatorScopes lists every scope, which is what a spectator key is granted unless scopes are given
+var SpectatorScopes = []string{ScopeLeaderboard, ScopeMarketData, ScopePortfolio}
+
+// SpectatorKey is a read-only API key for someone observing a bot, such as a mentor or teacher.
+// It cannot trade and is only accepted by the spectator routes its scopes allow.
+type SpectatorKey struct {
+	ID        string                 `json:"id" firestore:"-"`                // ID of the spectator key document
+	Name      string                 `json:"name" firestore:"name"`           // Who the key was issued to
+	BotID     string                 `json:"bot" firestore:"-"`               // ID of the designated bot
+	Scopes    []string               `json:"scopes" firestore:"scopes"`       // What the key may read
+	CreatedAt time.Time              `json:"createdAt" firestore:"createdAt"` // When the key was issued
+	APIKey    string                 `json:"-" firestore:"apiKey"`            // Secret sent in the Authorization header
+	Bot       *firestore.DocumentRef `json:"-" firestore:"bot"`               // The designated bot
+}
+
+// Validate trims the name, grants every scope if none are given and checks that the scopes are known
+func (k *SpectatorKey) Validate() error {
+	k.Name = strings.TrimSpace(k.Name)
+	if len(k.Scopes) == 0 {
+		k.Scopes = slices.Clone(SpectatorScopes)
+	}
+
+	if k.Name == "" {
+		return fmt.Errorf("spectator key name is required")
+	}
+
+	for _, scope := range k.Scopes {
+		if !slices.Contains(SpectatorScopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	slices.Sort(k.Scopes)
+	k.Scopes = slices.Compact(k.Scopes)
+	return nil
+}
+
+// Allows checks whether the key was granted a scope
+func (k *SpectatorKey) Allows(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
@@ -6,9 +6,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"slices"
+	"sort"
 	"time"
+	"unsafe"
 
 	"github.com/puzpuzpuz/xsync/v3"
+	"urjith.dev/algobattle/pkg/symbols"
 )
 
 // TickerPeriod represents stock data for a specific ticker and time period.
@@ -127,6 +130,7 @@ func (pr *PackedRow) Unpack() *Row {
 type History struct {
 	Tickers map[string]TickerMeta `json:"tickers"` // Metadata for each ticker
 	Rows    []*Row                `json:"rows"`    // Chronological rows of stock data
+	returns *ReturnsMatrix        // Daily log returns derived from the rows, nil until first used
 }
 
 // PackedHistory is a serializable version of History.
@@ -140,8 +144,8 @@ type PackedHistory struct {
 // The rows slice is pre-allocated with capacity for 5 years of daily data.
 func NewHistory() *History {
 	history := &History{
-		make(map[string]TickerMeta),
-		make([]*Row, 0, 365*5), // Pre-allocate 5 years of daily data
+		Tickers: make(map[string]TickerMeta),
+		Rows:    make([]*Row, 0, 365*5), // Pre-allocate 5 years of daily data
 	}
 
 	return history
@@ -177,45 +181,109 @@ func (ph *PackedHistory) Unpack() *History {
 	return history
 }
 
-// GetClosestRowBefore finds the row closest to but before the given date.
-// It uses binary search to efficiently find the row in the sorted array.
-// Returns the index and row if found, or (-1, nil) if not found or history is empty.
-func (h *History) GetClosestRowBefore(date time.Time) (index int, row *Row) {
-	if len(h.Rows) == 0 {
-		return -1, nil
+// Canonicalize respells every ticker of the history with symbols.Canonical, so a cache written before symbols were
+// normalized knows each security by one spelling, such as "BRK.B" for a cached "BRK-B". Columns of the same security
+// are merged, keeping the data of the canonical spelling on dates both have. Returns the number of tickers respelled.
+func (h *History) Canonicalize() int {
+	respelled := 0
+	for ticker, meta := range h.Tickers {
+		canonical := symbols.Canonical(ticker)
+		if canonical == ticker {
+			continue
+		}
+
+		if existing, ok := h.Tickers[canonical]; ok {
+			if existing.Start.Before(meta.Start) {
+				meta.Start = existing.Start
+			}
+
+			if existing.End.After(meta.End) {
+				meta.End = existing.End
+			}
+		}
+
+		h.Tickers[canonical] = meta
+		delete(h.Tickers, ticker)
+		respelled++
+	}
+
+	for _, row := range h.Rows {
+		row.Data.Range(func(ticker string, period *TickerPeriod) bool {
+			if canonical := symbols.Canonical(ticker); canonical != ticker {
+				row.Data.LoadOrStore(canonical, period)
+				row.Data.Delete(ticker)
+			}
+
+			return true
+		})
+	}
+
+	// The returns are rebuilt under the new spellings when they are next used
+	if respelled > 0 {
+		returnsInit.Lock()
+		h.returns = nil
+		returnsInit.Unlock()
 	}
 
-	// Binary search implementation
-	left, right := 0, len(h.Rows)-1
-	closest := (*Row)(nil)
-	target := date.Unix()
-
-	for left <= right {
-		mid := left + (right-left)/2
-
-		if h.Rows[mid].Date.Unix() == target {
-			return mid, h.Rows[mid]
-		} else if h.Rows[mid].Date.Unix() < target {
-			closest = h.Rows[mid]
-			left = mid + 1
-		} else {
-			right = mid - 1
+	return respelled
+}
+
+// Canonicalize respells the tickers of a packed row like History.Canonicalize
+func (r *PackedRow) Canonicalize() {
+	for ticker, period := range r.Data {
+		canonical := symbols.Canonical(ticker)
+		if canonical == ticker {
+			continue
 		}
+
+		if _, ok := r.Data[canonical]; !ok {
+			r.Data[canonical] = period
+		}
+
+		delete(r.Data, ticker)
 	}
+}
 
-	if closest == nil {
+// FloorRow finds the last row dated on or before the given time, so a row dated exactly at the time is returned.
+// Returns (-1, nil) if every row is dated after the time or the history is empty. The rows on or before the time
+// are Rows[:index+1].
+func (h *History) FloorRow(date time.Time) (index int, row *Row) {
+	index = sort.Search(len(h.Rows), func(i int) bool {
+		return h.Rows[i].Date.After(date)
+	}) - 1
+
+	if index < 0 {
 		return -1, nil
 	}
 
-	return right, closest
+	return index, h.Rows[index]
+}
+
+// CeilRow finds the first row dated on or after the given time, so a row dated exactly at the time is returned.
+// Returns (len(Rows), nil) if every row is dated before the time or the history is empty. The rows strictly before
+// the time are Rows[:index], so the last of them is at index-1.
+func (h *History) CeilRow(date time.Time) (index int, row *Row) {
+	index = sort.Search(len(h.Rows), func(i int) bool {
+		return !h.Rows[i].Date.Before(date)
+	})
+
+	if index == len(h.Rows) {
+		return index, nil
+	}
+
+	return index, h.Rows[index]
 }
 
 // AddData adds stock data for a ticker to the history.
 // It updates the ticker metadata and inserts the data points in chronological order.
 // If a row already exists for a date, the ticker data is added to that row.
-func (h *History) AddData(periods []PackedPeriod, ticker string) {
+// Bars whose close is invalid or moved more than maxJump times from the previous close without
+// a matching split factor are quarantined: they are left out of the history and returned as anomalies.
+// A maxJump of 0 only quarantines invalid closes. The ticker's daily returns are updated from the first added bar.
+func (h *History) AddData(periods []PackedPeriod, ticker string, maxJump float64) []*PriceAnomaly {
+	anomalies := make([]*PriceAnomaly, 0)
 	if len(periods) == 0 {
-		return
+		return anomalies
 	}
 
 	h.Tickers[ticker] = TickerMeta{
@@ -223,9 +291,34 @@ func (h *History) AddData(periods []PackedPeriod, ticker string) {
 		periods[len(periods)-1].Date, // End date
 	}
 
-	i, _ := h.GetClosestRowBefore(periods[0].Date)
+	i, _ := h.FloorRow(periods[0].Date)
+
+	// Bars are checked against the close of the ticker before the new data, if one of the previous rows has it
+	previous := 0.0
+	for j := i; j >= 0 && j > i-anomalyLookbackRows; j-- {
+		if period, ok := h.Rows[j].Data.Load(ticker); ok && h.Rows[j].Date.Before(periods[0].Date) {
+			previous = period.Close
+			break
+		}
+	}
 
 	for _, p := range periods {
+		if reason := CheckPrice(previous, p.Close, p.SplitFactor, maxJump); reason != "" {
+			anomalies = append(anomalies, &PriceAnomaly{
+				Ticker:   ticker,
+				Source:   AnomalySourceHistory,
+				Date:     p.Date,
+				Previous: previous,
+				Price:    p.Close,
+				Reason:   reason,
+				Period:   &p,
+			})
+
+			continue
+		}
+
+		previous = p.Close
+
 		if i == -1 {
 			h.Rows = slices.Insert(h.Rows, 0, &Row{p.Date, xsync.NewMapOf[string, *TickerPeriod]()})
 			i++
@@ -235,7 +328,8 @@ func (h *History) AddData(periods []PackedPeriod, ticker string) {
 			i++
 		}
 
-		if i == len(h.Rows) {
+		// Insert a row for dates missing from the history, such as dates evicted by retention
+		if i == len(h.Rows) || !h.Rows[i].Date.Equal(p.Date) {
 			h.Rows = slices.Insert(h.Rows, i, &Row{p.Date, xsync.NewMapOf[string, *TickerPeriod]()})
 		}
 
@@ -255,4 +349,123 @@ func (h *History) AddData(periods []PackedPeriod, ticker string) {
 			make(map[string]float64), // Initialize empty indicators map
 		})
 	}
+
+	if returns := h.builtReturns(); returns != nil {
+		returns.update(h.Rows, ticker, periods[0].Date)
+	}
+
+	return anomalies
+}
+
+// Evict removes every row dated before the given time from the history and returns them.
+// Ticker metadata is kept, since the evicted rows remain available elsewhere.
+func (h *History) Evict(before time.Time) []*Row {
+	i := sort.Search(len(h.Rows), func(i int) bool {
+		return !h.Rows[i].Date.Before(before)
+	})
+
+	if i == 0 {
+		return nil
+	}
+
+	evicted := h.Rows[:i]
+	h.Rows = slices.Clone(h.Rows[i:]) // Copy so the evicted rows can be garbage collected
+
+	if returns := h.builtReturns(); returns != nil {
+		returns.evict(before)
+	}
+
+	return evicted
+}
+
+// Range returns the rows dated between start and end inclusive.
+// A zero end includes every row after start.
+func (h *History) Range(start, end time.Time) []*Row {
+	from := sort.Search(len(h.Rows), func(i int) bool {
+		return !h.Rows[i].Date.Before(start)
+	})
+
+	to := len(h.Rows)
+	if !end.IsZero() {
+		to = sort.Search(len(h.Rows), func(i int) bool {
+			return h.Rows[i].Date.After(end)
+		})
+	}
+
+	if from >= to {
+		return nil
+	}
+
+	return h.Rows[from:to]
+}
+
+// Approximate sizes used to estimate the memory held by a history
+const (
+	rowOverhead       = int64(unsafe.Sizeof(Row{})) + 256                    // Row and an empty thread-safe map
+	periodOverhead    = int64(unsafe.Sizeof(TickerPeriod{})) + 64            // Period, its map entry and indicators map header
+	indicatorOverhead = int64(unsafe.Sizeof(float64(0)) + unsafe.Sizeof("")) // Indicator map entry without the key bytes
+)
+
+// HistoryMemory reports how much data a history holds in memory.
+type HistoryMemory struct {
+	Tickers        int       `json:"tickers"`        // Number of tickers with metadata
+	Rows           int       `json:"rows"`           // Number of rows in memory
+	Periods        int       `json:"periods"`        // Number of ticker periods across all rows
+	Indicators     int       `json:"indicators"`     // Number of indicator values across all periods
+	Returns        int       `json:"returns"`        // Number of cached daily returns, 0 until the returns are first used
+	EstimatedBytes int64     `json:"estimatedBytes"` // Approximate memory used by the rows
+	Oldest         time.Time `json:"oldest"`         // Date of the oldest row in memory, zero if empty
+	Newest         time.Time `json:"newest"`         // Date of the newest row in memory, zero if empty
+}
+
+// LastDates returns the date of the newest row of every ticker in the history
+func (h *History) LastDates() map[string]time.Time {
+	dates := make(map[string]time.Time, len(h.Tickers))
+	for i := len(h.Rows) - 1; i >= 0 && len(dates) < len(h.Tickers); i-- {
+		h.Rows[i].Data.Range(func(ticker string, period *TickerPeriod) bool {
+			if _, ok := dates[ticker]; !ok {
+				dates[ticker] = h.Rows[i].Date
+			}
+
+			return true
+		})
+	}
+
+	return dates
+}
+
+// MemoryUsage estimates the memory held by the rows of the history.
+// The estimate walks every row, so it should not be called on hot paths.
+func (h *History) MemoryUsage() *HistoryMemory {
+	rows := h.Rows
+	usage := &HistoryMemory{
+		Tickers: len(h.Tickers),
+		Rows:    len(rows),
+	}
+
+	if len(rows) > 0 {
+		usage.Oldest = rows[0].Date
+		usage.Newest = rows[len(rows)-1].Date
+	}
+
+	usage.EstimatedBytes = int64(len(rows)) * rowOverhead
+	if returns := h.builtReturns(); returns != nil {
+		usage.Returns = returns.Points()
+		usage.EstimatedBytes += int64(usage.Returns) * int64(unsafe.Sizeof(DailyReturn{}))
+	}
+	for _, row := range rows {
+		row.Data.Range(func(ticker string, period *TickerPeriod) bool {
+			usage.Periods++
+			usage.EstimatedBytes += periodOverhead + int64(len(ticker))
+
+			for name := range period.Indicators {
+				usage.Indicators++
+				usage.EstimatedBytes += indicatorOverhead + int64(len(name))
+			}
+
+			return true
+		})
+	}
+
+	return usage
 }
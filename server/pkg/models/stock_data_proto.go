@@ -0,0 +1,173 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the messages in proto/stock_data.proto. The messages are encoded by hand,
+// so changes to the schema must be mirrored here and field numbers must never be reused.
+const (
+	protoPacketType    = 1 // StockDataPacket.type
+	protoPacketPayload = 2 // StockDataPacket.payload
+
+	protoHistoryTickers = 1 // StockData.tickers
+	protoHistoryRows    = 2 // StockData.rows
+
+	protoMetaStart = 1 // TickerMeta.data_start
+	protoMetaEnd   = 2 // TickerMeta.data_end
+
+	protoRowDate = 1 // Row.date
+	protoRowData = 2 // Row.data
+
+	protoPeriodOpen        = 1  // TickerPeriod.open
+	protoPeriodHigh        = 2  // TickerPeriod.high
+	protoPeriodLow         = 3  // TickerPeriod.low
+	protoPeriodClose       = 4  // TickerPeriod.close
+	protoPeriodVolume      = 5  // TickerPeriod.volume
+	protoPeriodAdjClose    = 6  // TickerPeriod.adj_close
+	protoPeriodAdjHigh     = 7  // TickerPeriod.adj_high
+	protoPeriodAdjLow      = 8  // TickerPeriod.adj_low
+	protoPeriodAdjOpen     = 9  // TickerPeriod.adj_open
+	protoPeriodAdjVolume   = 10 // TickerPeriod.adj_volume
+	protoPeriodDivCash     = 11 // TickerPeriod.div_cash
+	protoPeriodSplitFactor = 12 // TickerPeriod.split_factor
+	protoPeriodIndicators  = 13 // TickerPeriod.indicators
+
+	protoTimestampSeconds = 1 // google.protobuf.Timestamp.seconds
+	protoTimestampNanos   = 2 // google.protobuf.Timestamp.nanos
+
+	protoMapKey   = 1 // Key of a map entry
+	protoMapValue = 2 // Value of a map entry
+)
+
+// MarshalProto encodes the history as a StockDataPacket of proto/stock_data.proto with the packet type.
+// Map entries are sorted by key, so the same history always encodes to the same bytes.
+func (h *PackedHistory) MarshalProto(packetType string) []byte {
+	b := appendProtoString(nil, protoPacketType, packetType)
+	return appendProtoMessage(b, protoPacketPayload, h.appendProto(nil))
+}
+
+// appendProto appends the history as a StockData message
+func (h *PackedHistory) appendProto(b []byte) []byte {
+	for _, ticker := range sortedKeys(h.Tickers) {
+		meta := h.Tickers[ticker]
+		var value []byte
+		value = appendProtoTimestamp(value, protoMetaStart, meta.Start)
+		value = appendProtoTimestamp(value, protoMetaEnd, meta.End)
+		b = appendProtoMapEntry(b, protoHistoryTickers, ticker, value)
+	}
+
+	for _, row := range h.Rows {
+		b = appendProtoMessage(b, protoHistoryRows, row.appendProto(nil))
+	}
+
+	return b
+}
+
+// appendProto appends the row as a Row message
+func (r *PackedRow) appendProto(b []byte) []byte {
+	b = appendProtoTimestamp(b, protoRowDate, r.Date)
+	for _, ticker := range sortedKeys(r.Data) {
+		b = appendProtoMapEntry(b, protoRowData, ticker, r.Data[ticker].appendProto(nil))
+	}
+
+	return b
+}
+
+// appendProto appends the period as a TickerPeriod message
+func (p *TickerPeriod) appendProto(b []byte) []byte {
+	b = appendProtoDouble(b, protoPeriodOpen, p.Open)
+	b = appendProtoDouble(b, protoPeriodHigh, p.High)
+	b = appendProtoDouble(b, protoPeriodLow, p.Low)
+	b = appendProtoDouble(b, protoPeriodClose, p.Close)
+	b = appendProtoInt64(b, protoPeriodVolume, p.Volume)
+	b = appendProtoDouble(b, protoPeriodAdjClose, p.AdjClose)
+	b = appendProtoDouble(b, protoPeriodAdjHigh, p.AdjHigh)
+	b = appendProtoDouble(b, protoPeriodAdjLow, p.AdjLow)
+	b = appendProtoDouble(b, protoPeriodAdjOpen, p.AdjOpen)
+	b = appendProtoInt64(b, protoPeriodAdjVolume, p.AdjVolume)
+	b = appendProtoDouble(b, protoPeriodDivCash, p.DivCash)
+	b = appendProtoDouble(b, protoPeriodSplitFactor, p.SplitFactor)
+	for _, name := range sortedKeys(p.Indicators) {
+		b = appendProtoDoubleEntry(b, protoPeriodIndicators, name, p.Indicators[name])
+	}
+
+	return b
+}
+
+// sortedKeys returns the keys of a map in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+// appendProtoMapEntry appends an entry of a map field with a string key and a message value
+func appendProtoMapEntry(b []byte, field protowire.Number, key string, message []byte) []byte {
+	entry := appendProtoString(nil, protoMapKey, key)
+	entry = appendProtoMessage(entry, protoMapValue, message)
+	return appendProtoMessage(b, field, entry)
+}
+
+// appendProtoDoubleEntry appends an entry of a map field with a string key and a double value
+func appendProtoDoubleEntry(b []byte, field protowire.Number, key string, value float64) []byte {
+	entry := appendProtoString(nil, protoMapKey, key)
+	entry = appendProtoDouble(entry, protoMapValue, value)
+	return appendProtoMessage(b, field, entry)
+}
+
+// appendProtoMessage appends an embedded message field
+func appendProtoMessage(b []byte, field protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// appendProtoString appends a string field, omitting empty strings like proto3
+func appendProtoString(b []byte, field protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, field, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// appendProtoDouble appends a double field, omitting zeros like proto3
+func appendProtoDouble(b []byte, field protowire.Number, value float64) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, field, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(value))
+}
+
+// appendProtoInt64 appends an int64 field, omitting zeros like proto3
+func appendProtoInt64(b []byte, field protowire.Number, value int64) []byte {
+	if value == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, field, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(value))
+}
+
+// appendProtoTimestamp appends a google.protobuf.Timestamp field, omitting zero times
+func appendProtoTimestamp(b []byte, field protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+
+	var timestamp []byte
+	timestamp = appendProtoInt64(timestamp, protoTimestampSeconds, t.Unix())
+	timestamp = appendProtoInt64(timestamp, protoTimestampNanos, int64(t.Nanosecond()))
+	return appendProtoMessage(b, field, timestamp)
+}
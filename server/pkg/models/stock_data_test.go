@@ -0,0 +1,128 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// testHistory returns a history of AAPL with a row on each of the given days of January 2024
+func testHistory(days ...int) *History {
+	periods := make([]PackedPeriod, 0, len(days))
+	for _, d := range days {
+		periods = append(periods, PackedPeriod{Date: day(d), Close: float64(100 + d), AdjClose: float64(100 + d)})
+	}
+
+	history := NewHistory()
+	history.AddData(periods, "AAPL", 0)
+	return history
+}
+
+func TestFloorRow(t *testing.T) {
+	history := testHistory(3, 5, 8)
+
+	tests := []struct {
+		name      string
+		history   *History
+		date      time.Time
+		wantIndex int
+	}{
+		{"empty history", NewHistory(), day(5), -1},
+		{"before the first row", history, day(1), -1},
+		{"just before the first row", history, day(3).Add(-time.Nanosecond), -1},
+		{"exactly the first row", history, day(3), 0},
+		{"between the first and middle rows", history, day(4), 0},
+		{"exactly the middle row", history, day(5), 1},
+		{"later on the day of the middle row", history, day(5).Add(12 * time.Hour), 1},
+		{"between the middle and last rows", history, day(7), 1},
+		{"exactly the last row", history, day(8), 2},
+		{"after the last row", history, day(20), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, row := tt.history.FloorRow(tt.date)
+			if index != tt.wantIndex {
+				t.Fatalf("index = %d, want %d", index, tt.wantIndex)
+			}
+
+			if tt.wantIndex < 0 {
+				if row != nil {
+					t.Errorf("row = %v, want nil", row.Date)
+				}
+
+				return
+			}
+
+			if row != tt.history.Rows[tt.wantIndex] {
+				t.Errorf("row = %v, want the row at %d", row.Date, tt.wantIndex)
+			}
+
+			if row.Date.After(tt.date) {
+				t.Errorf("row dated %v is after %v", row.Date, tt.date)
+			}
+		})
+	}
+}
+
+func TestCeilRow(t *testing.T) {
+	history := testHistory(3, 5, 8)
+
+	tests := []struct {
+		name      string
+		history   *History
+		date      time.Time
+		wantIndex int
+	}{
+		{"empty history", NewHistory(), day(5), 0},
+		{"before the first row", history, day(1), 0},
+		{"exactly the first row", history, day(3), 0},
+		{"just after the first row", history, day(3).Add(time.Nanosecond), 1},
+		{"between the first and middle rows", history, day(4), 1},
+		{"exactly the middle row", history, day(5), 1},
+		{"between the middle and last rows", history, day(7), 2},
+		{"exactly the last row", history, day(8), 2},
+		{"after the last row", history, day(20), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, row := tt.history.CeilRow(tt.date)
+			if index != tt.wantIndex {
+				t.Fatalf("index = %d, want %d", index, tt.wantIndex)
+			}
+
+			if tt.wantIndex == len(tt.history.Rows) {
+				if row != nil {
+					t.Errorf("row = %v, want nil", row.Date)
+				}
+
+				return
+			}
+
+			if row != tt.history.Rows[tt.wantIndex] {
+				t.Errorf("row = %v, want the row at %d", row.Date, tt.wantIndex)
+			}
+
+			if row.Date.Before(tt.date) {
+				t.Errorf("row dated %v is before %v", row.Date, tt.date)
+			}
+		})
+	}
+}
+
+func TestFloorAndCeilRowAgree(t *testing.T) {
+	// On a row's date both find it, between rows they find the neighbours
+	history := testHistory(3, 5, 8)
+	for d := 1; d <= 10; d++ {
+		floor, _ := history.FloorRow(day(d))
+		ceil, _ := history.CeilRow(day(d))
+
+		exact := floor >= 0 && history.Rows[floor].Date.Equal(day(d))
+		switch {
+		case exact && floor != ceil:
+			t.Errorf("day %d: floor %d and ceil %d differ on an exact match", d, floor, ceil)
+		case !exact && ceil != floor+1:
+			t.Errorf("day %d: ceil %d is not right after floor %d", d, ceil, floor)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// BarLookup returns the daily bar of a ticker on the UTC day of a time, false if the day is not cached
+type BarLookup func(ticker string, day time.Time) (*TickerPeriod, bool)
+
+// DailyVWAP estimates the volume weighted average price of a day from its bar with the typical price
+// (high + low + close) / 3, since the cache has no intraday volume. Returns 0 for bars without a range.
+func DailyVWAP(bar *TickerPeriod) float64 {
+	if bar == nil || bar.High <= 0 || bar.Low <= 0 || bar.Close <= 0 {
+		return 0
+	}
+
+	return (bar.High + bar.Low + bar.Close) / 3
+}
+
+// HoldingPeriods summarizes how long shares were held, in days. Closed lots are weighted by their shares.
+type HoldingPeriods struct {
+	ClosedLots      int     `json:"closedLots"`      // Purchase lots, or parts of lots, that were sold
+	AverageDays     float64 `json:"averageDays"`     // Average holding period of the sold shares
+	ShortestDays    float64 `json:"shortestDays"`    // Shortest holding period of a sold lot
+	LongestDays     float64 `json:"longestDays"`     // Longest holding period of a sold lot
+	OpenLots        int     `json:"openLots"`        // Purchase lots that are still held
+	OpenAverageDays float64 `json:"openAverageDays"` // Average age of the shares still held
+}
+
+// TickerCosts are the execution costs of the trades of one ticker, or of every trade for the totals
+type TickerCosts struct {
+	Ticker        string          `json:"ticker,omitempty"` // Ticker symbol, empty for the totals
+	Trades        int             `json:"trades"`           // Number of trades
+	TradedValue   float64         `json:"tradedValue"`      // Value traded before fees
+	Fees          float64         `json:"fees"`             // Fees paid
+	FeeBps        float64         `json:"feeBps"`           // Fees in basis points of the traded value
+	Benchmarked   int             `json:"benchmarked"`      // Trades on days with a cached bar, the others have no slippage estimate
+	Slippage      float64         `json:"slippage"`         // Cost against the daily VWAP of the benchmarked trades, positive when worse than VWAP
+	SlippageBps   float64         `json:"slippageBps"`      // Slippage in basis points of the value of the benchmarked trades
+	HoldingPeriod *HoldingPeriods `json:"holdingPeriod"`    // How long the shares were held
+}
+
+// TransactionCostAnalysis summarizes what the execution of a portfolio's trades cost
+type TransactionCostAnalysis struct {
+	Currency string         `json:"currency"` // Currency of every amount
+	Time     time.Time      `json:"time"`     // When the analysis was calculated, used for the age of open lots
+	Total    *TickerCosts   `json:"total"`    // Costs of every trade
+	ByTicker []*TickerCosts `json:"byTicker"` // Costs of every ticker, highest total cost first
+}
+
+// tcaLot is a group of shares bought by a single transaction
+type tcaLot struct {
+	numShares float64
+	time      time.Time
+}
+
+// tickerCostsBuilder accumulates the costs of a ticker before they are rounded
+type tickerCostsBuilder struct {
+	costs          *TickerCosts
+	benchmarkValue float64
+	heldShareDays  float64
+	soldShares     float64
+	openShareDays  float64
+	openShares     float64
+	closedLotDays  []float64
+}
+
+// AnalyzeTransactionCosts measures the fees, the slippage against each day's estimated VWAP and the holding
+// periods of a portfolio's trades. Sold shares are matched to purchases first in, first out, whatever cost basis
+// method the competition uses. Trades on days without a cached bar, such as today, are left out of the slippage.
+func AnalyzeTransactionCosts(transactions []*Transaction, bar BarLookup, currency string, now time.Time) *TransactionCostAnalysis {
+	sorted := append([]*Transaction{}, transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	lots := make(map[string][]*tcaLot)
+	builders := make(map[string]*tickerCostsBuilder)
+	total := &tickerCostsBuilder{costs: &TickerCosts{}}
+
+	for _, transaction := range sorted {
+		ticker := transaction.Ticker
+		builder, ok := builders[ticker]
+		if !ok {
+			builder = &tickerCostsBuilder{costs: &TickerCosts{Ticker: ticker}}
+			builders[ticker] = builder
+		}
+
+		value := transaction.Value()
+		slippage, benchmarked := 0.0, false
+		if dayBar, ok := bar(ticker, transaction.Time); ok {
+			if vwap := DailyVWAP(dayBar); vwap > 0 {
+				benchmarked = true
+				slippage = transaction.NumShares * (transaction.UnitCost - vwap)
+				if transaction.Action == "sell" {
+					slippage = -slippage
+				}
+			}
+		}
+
+		for _, b := range []*tickerCostsBuilder{builder, total} {
+			b.costs.Trades++
+			b.costs.TradedValue += value
+			b.costs.Fees += transaction.Fee
+			if benchmarked {
+				b.costs.Benchmarked++
+				b.costs.Slippage += slippage
+				b.benchmarkValue += value
+			}
+		}
+
+		switch transaction.Action {
+		case "buy":
+			lots[ticker] = append(lots[ticker], &tcaLot{transaction.NumShares, transaction.Time})
+		case "sell":
+			remaining := transaction.NumShares
+			for len(lots[ticker]) > 0 && remaining > 0 {
+				lot := lots[ticker][0]
+				sold := min(lot.numShares, remaining)
+				days := transaction.Time.Sub(lot.time).Hours() / 24
+				for _, b := range []*tickerCostsBuilder{builder, total} {
+					b.heldShareDays += sold * days
+					b.soldShares += sold
+					b.closedLotDays = append(b.closedLotDays, days)
+				}
+
+				lot.numShares -= sold
+				remaining -= sold
+				if lot.numShares <= DustShares {
+					lots[ticker] = lots[ticker][1:]
+				}
+			}
+		}
+	}
+
+	for ticker, held := range lots {
+		for _, lot := range held {
+			days := now.Sub(lot.time).Hours() / 24
+			for _, b := range []*tickerCostsBuilder{builders[ticker], total} {
+				b.openShareDays += lot.numShares * days
+				b.openShares += lot.numShares
+				b.holdingPeriods().OpenLots++
+			}
+		}
+	}
+
+	analysis := &TransactionCostAnalysis{Currency: currency, Time: now, Total: total.finish(), ByTicker: make([]*TickerCosts, 0, len(builders))}
+	for _, builder := range builders {
+		analysis.ByTicker = append(analysis.ByTicker, builder.finish())
+	}
+
+	sort.Slice(analysis.ByTicker, func(i, j int) bool {
+		a, b := analysis.ByTicker[i], analysis.ByTicker[j]
+		if costA, costB := a.Fees+a.Slippage, b.Fees+b.Slippage; costA != costB {
+			return costA > costB
+		}
+
+		return a.Ticker < b.Ticker
+	})
+
+	return analysis
+}
+
+// holdingPeriods returns the holding periods of the builder, creating them on first use
+func (b *tickerCostsBuilder) holdingPeriods() *HoldingPeriods {
+	if b.costs.HoldingPeriod == nil {
+		b.costs.HoldingPeriod = &HoldingPeriods{}
+	}
+
+	return b.costs.HoldingPeriod
+}
+
+// finish rounds the amounts, calculates the ratios and holding periods and returns the costs
+func (b *tickerCostsBuilder) finish() *TickerCosts {
+	policy := money.Default()
+	costs := b.costs
+
+	if costs.TradedValue > 0 {
+		costs.FeeBps = roundBps(costs.Fees / costs.TradedValue)
+	}
+
+	if b.benchmarkValue > 0 {
+		costs.SlippageBps = roundBps(costs.Slippage / b.benchmarkValue)
+	}
+
+	costs.TradedValue = policy.Round(costs.TradedValue)
+	costs.Fees = policy.Round(costs.Fees)
+	costs.Slippage = policy.Round(costs.Slippage)
+
+	periods := b.holdingPeriods()
+	periods.ClosedLots = len(b.closedLotDays)
+	if b.soldShares > 0 {
+		periods.AverageDays = b.heldShareDays / b.soldShares
+		periods.ShortestDays = slices.Min(b.closedLotDays)
+		periods.LongestDays = slices.Max(b.closedLotDays)
+	}
+
+	if b.openShares > 0 {
+		periods.OpenAverageDays = b.openShareDays / b.openShares
+	}
+
+	return costs
+}
+
+// roundBps converts a ratio to basis points rounded to hundredths
+func roundBps(ratio float64) float64 {
+	return math.Round(ratio*1000000) / 100
+}
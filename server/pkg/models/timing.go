@@ -0,0 +1,145 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// Sources that execute transactions
+const (
+	SourceRequest    = "request"    // A transact request of the bot
+	SourceOrder      = "order"      // A conditional order filled when prices were updated
+	SourceProtection = "protection" // A position protection triggered when prices were updated
+)
+
+// ExecutionTiming records when a transaction was requested and when its fill price was fetched,
+// so organizers can audit how long trades waited and how stale the prices they filled at were
+type ExecutionTiming struct {
+	Source     string    `json:"source" firestore:"source"`         // What executed the transaction
+	ReceivedAt time.Time `json:"receivedAt" firestore:"receivedAt"` // When the server received the request, zero for order and protection fills
+	PriceTime  time.Time `json:"priceTime" firestore:"priceTime"`   // When the fill price was fetched from the data source
+}
+
+// Latency returns how long the transaction took from the request to its execution, false for fills without a request
+func (t *Transaction) Latency() (time.Duration, bool) {
+	if t.Timing == nil || t.Timing.ReceivedAt.IsZero() {
+		return 0, false
+	}
+
+	return t.Time.Sub(t.Timing.ReceivedAt), true
+}
+
+// PriceAge returns how old the fill price was when the transaction executed, false if it was not recorded
+func (t *Transaction) PriceAge() (time.Duration, bool) {
+	if t.Timing == nil || t.Timing.PriceTime.IsZero() {
+		return 0, false
+	}
+
+	return t.Time.Sub(t.Timing.PriceTime), true
+}
+
+// DurationStats summarizes durations in milliseconds
+type DurationStats struct {
+	Count int     `json:"count"` // Number of durations
+	Mean  float64 `json:"mean"`  // Average duration
+	P50   float64 `json:"p50"`   // Median duration
+	P95   float64 `json:"p95"`   // 95th percentile duration
+	Max   float64 `json:"max"`   // Longest duration
+}
+
+// summarizeDurations calculates the statistics of durations, nearest rank percentiles are used
+func summarizeDurations(durations []time.Duration) *DurationStats {
+	stats := &DurationStats{Count: len(durations)}
+	if len(durations) == 0 {
+		return stats
+	}
+
+	millis := make([]float64, len(durations))
+	for i, duration := range durations {
+		millis[i] = float64(duration) / float64(time.Millisecond)
+		stats.Mean += millis[i]
+	}
+
+	sort.Float64s(millis)
+	stats.Mean /= float64(len(millis))
+	stats.P50 = millis[(len(millis)-1)/2]
+	stats.P95 = millis[(len(millis)*95+99)/100-1]
+	stats.Max = millis[len(millis)-1]
+	return stats
+}
+
+// FairnessGroup summarizes the timing of a group of transactions
+type FairnessGroup struct {
+	Transactions int            `json:"transactions"` // Number of timed transactions
+	Latency      *DurationStats `json:"latency"`      // From request to execution, only transactions executed by requests
+	PriceAge     *DurationStats `json:"priceAge"`     // Age of the fill price at execution
+}
+
+// FairnessReport summarizes how long trades waited and how stale their fill prices were, overall, by source and
+// by bot, so organizers can check that no group of bots is advantaged by when it trades relative to price updates
+type FairnessReport struct {
+	Start    time.Time                 `json:"start"`    // Start of the reported period
+	End      time.Time                 `json:"end"`      // End of the reported period
+	Untimed  int                       `json:"untimed"`  // Transactions executed before timing was recorded, excluded from the groups
+	Overall  *FairnessGroup            `json:"overall"`  // Every timed transaction
+	BySource map[string]*FairnessGroup `json:"bySource"` // Timed transactions by what executed them
+	ByBot    map[string]*FairnessGroup `json:"byBot"`    // Timed transactions by the ID of their bot, including its shadow portfolios
+}
+
+// SummarizeFairness builds the fairness report of transactions, botOf returns the ID of the bot of a transaction
+func SummarizeFairness(transactions []*Transaction, botOf func(*Transaction) string, start, end time.Time) *FairnessReport {
+	type durations struct {
+		transactions int
+		latencies    []time.Duration
+		priceAges    []time.Duration
+	}
+
+	overall := &durations{}
+	bySource := make(map[string]*durations)
+	byBot := make(map[string]*durations)
+	group := func(groups map[string]*durations, key string) *durations {
+		if _, ok := groups[key]; !ok {
+			groups[key] = &durations{}
+		}
+
+		return groups[key]
+	}
+
+	report := &FairnessReport{Start: start, End: end}
+	for _, transaction := range transactions {
+		if transaction.Timing == nil {
+			report.Untimed++
+			continue
+		}
+
+		latency, hasLatency := transaction.Latency()
+		priceAge, hasPriceAge := transaction.PriceAge()
+		for _, d := range []*durations{overall, group(bySource, transaction.Timing.Source), group(byBot, botOf(transaction))} {
+			d.transactions++
+			if hasLatency {
+				d.latencies = append(d.latencies, latency)
+			}
+
+			if hasPriceAge {
+				d.priceAges = append(d.priceAges, priceAge)
+			}
+		}
+	}
+
+	summarize := func(d *durations) *FairnessGroup {
+		return &FairnessGroup{Transactions: d.transactions, Latency: summarizeDurations(d.latencies), PriceAge: summarizeDurations(d.priceAges)}
+	}
+
+	report.Overall = summarize(overall)
+	report.BySource = make(map[string]*FairnessGroup, len(bySource))
+	for source, d := range bySource {
+		report.BySource[source] = summarize(d)
+	}
+
+	report.ByBot = make(map[string]*FairnessGroup, len(byBot))
+	for bot, d := range byBot {
+		report.ByBot[bot] = summarize(d)
+	}
+
+	return report
+}
@@ -3,18 +3,36 @@
 package models
 
 import (
-	"cloud.google.com/go/firestore"
 	"time"
+
+	"cloud.google.com/go/firestore"
+	"urjith.dev/algobattle/pkg/money"
 )
 
 // Transaction represents a buy or sell transaction for a stock.
 // It records all details of the transaction including time, shares, cost,
 // ticker symbol, action type (buy/sell), and a reference to the bot that executed it.
 type Transaction struct {
-	Time      time.Time              `json:"time" firestore:"time"`           // When the transaction occurred
-	NumShares float64                `json:"numShares" firestore:"numShares"` // Number of shares bought or sold
-	UnitCost  float64                `json:"unitCost" firestore:"unitCost"`   // Price per share at transaction time
-	Ticker    string                 `json:"ticker" firestore:"ticker"`       // Stock ticker symbol
-	Action    string                 `json:"action" firestore:"action"`       // "buy" or "sell"
-	Bot       *firestore.DocumentRef `json:"-" firestore:"bot"`               // Reference to the bot that executed the transaction
+	Time      time.Time              `json:"time" firestore:"time"`                         // When the transaction occurred
+	NumShares float64                `json:"numShares" firestore:"numShares"`               // Number of shares bought or sold
+	UnitCost  float64                `json:"unitCost" firestore:"unitCost"`                 // Price per share at transaction time
+	Ticker    string                 `json:"ticker" firestore:"ticker"`                     // Stock ticker symbol
+	Action    string                 `json:"action" firestore:"action"`                     // "buy" or "sell"
+	Fee       float64                `json:"fee" firestore:"fee"`                           // Fee charged for the transaction
+	Currency  string                 `json:"currency" firestore:"currency"`                 // Currency of the unit cost and fee, empty for the base currency
+	Session   string                 `json:"session" firestore:"session"`                   // Trading session the transaction was executed in
+	Tag       string                 `json:"tag,omitempty" firestore:"tag,omitempty"`       // Strategy tag chosen by the bot, used for performance attribution
+	Timing    *ExecutionTiming       `json:"timing,omitempty" firestore:"timing,omitempty"` // When the transaction was requested and its price fetched, nil for transactions executed before timing was recorded
+	Bot       *firestore.DocumentRef `json:"-" firestore:"bot"`                             // Reference to the bot that executed the transaction
+	Decision  *firestore.DocumentRef `json:"-" firestore:"decision"`                        // Reference to the recorded order decision
+}
+
+// Value returns the traded value of the transaction before fees, rounded with the cash rounding policy
+func (t *Transaction) Value() float64 {
+	return money.Default().Cost(t.NumShares, t.UnitCost)
+}
+
+// CurrencyOfRecord returns the currency of the unit cost and fee
+func (t *Transaction) CurrencyOfRecord() string {
+	return money.OrBase(t.Currency)
 }
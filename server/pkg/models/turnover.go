@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"urjith.dev/algobattle/pkg/money"
+)
+
+// Turnover is the value a portfolio traded on a UTC day
+type Turnover struct {
+	Day    time.Time `json:"day" firestore:"day"`       // Midnight UTC of the day
+	Equity float64   `json:"equity" firestore:"equity"` // Account value before the first trade of the day
+	Traded float64   `json:"traded" firestore:"traded"` // Value bought and sold before fees
+}
+
+// TurnoverAllowance is how much more a portfolio can buy today under a daily turnover cap
+type TurnoverAllowance struct {
+	Cap       float64   `json:"cap"`       // Multiple of the equity that can be traded per UTC day
+	Equity    float64   `json:"equity"`    // Account value the day's limit is based on
+	Limit     float64   `json:"limit"`     // Value that can be traded today
+	Traded    float64   `json:"traded"`    // Value bought and sold today
+	Remaining float64   `json:"remaining"` // Value that can still be bought today
+	Resets    time.Time `json:"resets"`    // When the allowance resets
+}
+
+// TurnoverOn returns the turnover of the UTC day of at. A day without trades starts at the current account value.
+func (p *Portfolio) TurnoverOn(at time.Time) *Turnover {
+	day := at.UTC().Truncate(24 * time.Hour)
+	if p.Turnover != nil && p.Turnover.Day.Equal(day) {
+		return p.Turnover
+	}
+
+	return &Turnover{Day: day, Equity: p.AccountValue}
+}
+
+// RecordTurnover adds the value of an executed transaction to the turnover of its day
+func (p *Portfolio) RecordTurnover(transaction *Transaction) {
+	turnover := p.TurnoverOn(transaction.Time)
+	turnover.Traded = money.Default().Add(turnover.Traded, transaction.Value())
+	p.Turnover = turnover
+}
+
+// AllowanceAt returns the turnover allowance of the UTC day of at under a cap of the given multiple of the equity
+func (p *Portfolio) AllowanceAt(cap float64, at time.Time) *TurnoverAllowance {
+	turnover := p.TurnoverOn(at)
+	policy := money.Default()
+	limit := policy.Round(cap * turnover.Equity)
+
+	return &TurnoverAllowance{
+		Cap:       cap,
+		Equity:    turnover.Equity,
+		Limit:     limit,
+		Traded:    turnover.Traded,
+		Remaining: max(policy.Sub(limit, turnover.Traded), 0),
+		Resets:    turnover.Day.AddDate(0, 0, 1),
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Universe is the set of constituents of an index that bots of a competition restricted to it can buy
+type Universe struct {
+	Tickers   []string  `json:"tickers" firestore:"tickers"`     // Constituents, sorted
+	UpdatedAt time.Time `json:"updatedAt" firestore:"updatedAt"` // When the constituents last changed
+}
+
+// UniverseChange records the constituents added to and removed from a universe by a refresh
+type UniverseChange struct {
+	Universe string    `json:"universe" firestore:"universe"` // Name of the universe
+	Time     time.Time `json:"time" firestore:"time"`         // When the change was detected
+	Added    []string  `json:"added" firestore:"added"`       // Tickers that joined the universe, sorted
+	Removed  []string  `json:"removed" firestore:"removed"`   // Tickers that left the universe, sorted
+}
+
+// LoadUniverses loads a JSON object mapping universe names, such as "sp500", to their constituents.
+// Tickers are upper-cased, deduplicated and sorted.
+func LoadUniverses(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string][]string)
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing universes: %v", err)
+	}
+
+	universes := make(map[string][]string, len(raw))
+	for name, tickers := range raw {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid universe name %q", name)
+		}
+
+		seen := make(map[string]bool, len(tickers))
+		constituents := make([]string, 0, len(tickers))
+		for _, ticker := range tickers {
+			ticker = symbols.Canonical(ticker)
+			if ticker != "" && !seen[ticker] {
+				seen[ticker] = true
+				constituents = append(constituents, ticker)
+			}
+		}
+
+		if len(constituents) == 0 {
+			return nil, fmt.Errorf("universe %s has no constituents", name)
+		}
+
+		sort.Strings(constituents)
+		universes[name] = constituents
+	}
+
+	return universes, nil
+}
+
+// DiffUniverse compares the previous and current constituents of a universe.
+// Returns nil if the constituents did not change.
+func DiffUniverse(universe string, previous, current []string, at time.Time) *UniverseChange {
+	change := &UniverseChange{Universe: universe, Time: at, Added: make([]string, 0), Removed: make([]string, 0)}
+
+	before := make(map[string]bool, len(previous))
+	for _, ticker := range previous {
+		before[ticker] = true
+	}
+
+	after := make(map[string]bool, len(current))
+	for _, ticker := range current {
+		after[ticker] = true
+		if !before[ticker] {
+			change.Added = append(change.Added, ticker)
+		}
+	}
+
+	for _, ticker := range previous {
+		if !after[ticker] {
+			change.Removed = append(change.Removed, ticker)
+		}
+	}
+
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return nil
+	}
+
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	return change
+}
@@ -0,0 +1,46 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// BaseCurrency is the currency of record of portfolios and transactions that do not name one
+const BaseCurrency = "USD"
+
+// Amount is a cash amount in an explicit currency
+type Amount struct {
+	Value    float64 `json:"value"`    // Amount in units of the currency
+	Currency string  `json:"currency"` // ISO 4217 code of the currency
+}
+
+// ParseCurrency validates a three letter ISO 4217 currency code and converts it to upper case
+func ParseCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency %q, expected a three letter ISO 4217 code", code)
+	}
+
+	for _, letter := range code {
+		if letter < 'A' || letter > 'Z' {
+			return "", fmt.Errorf("invalid currency %q, expected a three letter ISO 4217 code", code)
+		}
+	}
+
+	return code, nil
+}
+
+// OrBase returns the currency, or BaseCurrency if it is empty
+func OrBase(currency string) string {
+	if currency == "" {
+		return BaseCurrency
+	}
+
+	return currency
+}
+
+// Convert returns an amount converted at an exchange rate, rounded according to the policy
+func (p Policy) Convert(amount, rate float64) float64 {
+	return p.round(new(big.Rat).Mul(rat(amount), rat(rate)))
+}
@@ -0,0 +1,141 @@
+// Package money provides exact decimal arithmetic for cash amounts.
+// Amounts are stored as float64 throughout the application, but every operation
+// is computed exactly with big.Rat and rounded to a fixed number of decimals with an
+// explicit rounding mode, so repeated fills do not accumulate floating point drift.
+package money
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RoundingMode determines how amounts between two representable values are rounded
+type RoundingMode string
+
+// Supported rounding modes
+const (
+	HalfEven RoundingMode = "half_even" // Round to nearest, ties to the even digit (banker's rounding)
+	HalfUp   RoundingMode = "half_up"   // Round to nearest, ties away from zero
+	Down     RoundingMode = "down"      // Round towards zero
+	Up       RoundingMode = "up"        // Round away from zero
+)
+
+// Policy is a precision and rounding policy for cash amounts
+type Policy struct {
+	Decimals int          `json:"decimals"` // Number of decimal places kept
+	Rounding RoundingMode `json:"rounding"` // How amounts are rounded to Decimals places
+}
+
+var (
+	mu            sync.RWMutex
+	defaultPolicy = Policy{Decimals: 2, Rounding: HalfEven}
+)
+
+// NewPolicy creates a policy after validating its settings
+func NewPolicy(decimals int, rounding RoundingMode) (Policy, error) {
+	if decimals < 0 || decimals > 8 {
+		return Policy{}, fmt.Errorf("decimals must be between 0 and 8, got %d", decimals)
+	}
+
+	rounding = RoundingMode(strings.ToLower(string(rounding)))
+	switch rounding {
+	case HalfEven, HalfUp, Down, Up:
+	default:
+		return Policy{}, fmt.Errorf("unknown rounding mode %q", rounding)
+	}
+
+	return Policy{decimals, rounding}, nil
+}
+
+// Default returns the policy used for every cash amount
+func Default() Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return defaultPolicy
+}
+
+// SetDefault replaces the policy used for every cash amount. It should be called once at startup.
+func SetDefault(policy Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultPolicy = policy
+}
+
+// Round rounds an amount according to the policy
+func (p Policy) Round(amount float64) float64 {
+	return p.round(rat(amount))
+}
+
+// Add returns a + b rounded according to the policy
+func (p Policy) Add(a, b float64) float64 {
+	return p.round(new(big.Rat).Add(rat(a), rat(b)))
+}
+
+// Sub returns a - b rounded according to the policy
+func (p Policy) Sub(a, b float64) float64 {
+	return p.round(new(big.Rat).Sub(rat(a), rat(b)))
+}
+
+// Cost returns the value of a number of shares at a unit price rounded according to the policy
+func (p Policy) Cost(numShares, unitPrice float64) float64 {
+	return p.round(new(big.Rat).Mul(rat(numShares), rat(unitPrice)))
+}
+
+// Sum returns the total of the amounts, rounded once according to the policy
+func (p Policy) Sum(amounts ...float64) float64 {
+	total := new(big.Rat)
+	for _, amount := range amounts {
+		total.Add(total, rat(amount))
+	}
+
+	return p.round(total)
+}
+
+// round rounds an exact amount to the policy's decimals and converts it to a float64
+func (p Policy) round(amount *big.Rat) float64 {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.Decimals)), nil)
+	scaled := new(big.Rat).Mul(amount, new(big.Rat).SetInt(scale))
+
+	// Split into an integer quotient truncated towards zero and a remainder
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		// Compare twice the remainder with the denominator to find which half the amount is in
+		half := new(big.Int).Abs(remainder)
+		half.Lsh(half, 1)
+		cmp := half.Cmp(scaled.Denom())
+
+		awayFromZero := false
+		switch p.Rounding {
+		case Up:
+			awayFromZero = true
+		case HalfUp:
+			awayFromZero = cmp >= 0
+		case HalfEven:
+			awayFromZero = cmp > 0 || (cmp == 0 && quotient.Bit(0) == 1)
+		}
+
+		if awayFromZero {
+			quotient.Add(quotient, big.NewInt(int64(scaled.Sign())))
+		}
+	}
+
+	result, _ := new(big.Rat).SetFrac(quotient, scale).Float64()
+	return result
+}
+
+// rat converts a float64 to the exact rational of its shortest decimal representation,
+// so 1.005 is treated as 1.005 rather than its binary approximation. Non finite values are treated as zero.
+func rat(amount float64) *big.Rat {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return new(big.Rat)
+	}
+
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(amount, 'g', -1, 64))
+	return r
+}
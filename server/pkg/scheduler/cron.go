@@ -0,0 +1,192 @@
+// Package scheduler provides a small in-process job scheduler driven by
+// cron expressions. It is used by the AlgoBattle server to run periodic
+// work such as live price updates and daily history downloads.
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField describes the valid range of a single cron field
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+// Fields of a standard five field cron expression, in order
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// Schedule is a parsed cron expression.
+// Each field is stored as a bitset of the values that match.
+type Schedule struct {
+	expr     string
+	minute   uint64
+	hour     uint64
+	dom      uint64
+	month    uint64
+	dow      uint64
+	location *time.Location
+}
+
+// ParseCron parses a standard five field cron expression
+// ("minute hour day-of-month month day-of-week") evaluated in the given location.
+// Each field supports "*", single values, ranges ("1-5"), lists ("1,3,5")
+// and steps ("*/5", "10-30/10").
+func ParseCron(expr string, location *time.Location) (*Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected %d fields, got %d", expr, len(cronFields), len(parts))
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	sets := make([]uint64, len(cronFields))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+
+		sets[i] = set
+	}
+
+	return &Schedule{
+		expr:     expr,
+		minute:   sets[0],
+		hour:     sets[1],
+		dom:      sets[2],
+		month:    sets[3],
+		dow:      sets[4],
+		location: location,
+	}, nil
+}
+
+// parseCronField parses a single comma separated cron field into a bitset
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, spec.name)
+			}
+		}
+
+		low, high := spec.min, spec.max
+		if rangePart != "*" {
+			lowStr, highStr, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			low, err = strconv.Atoi(lowStr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s field", lowStr, spec.name)
+			}
+
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highStr)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s field", highStr, spec.name)
+				}
+			} else if hasStep {
+				high = spec.max
+			}
+		}
+
+		if low < spec.min || high > spec.max || low > high {
+			return 0, fmt.Errorf("value out of range in %s field: %q", spec.name, item)
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// String returns the original cron expression
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time strictly after t that matches the schedule.
+// Returns the zero time if no matching time is found within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchesDay checks the day of month and day of week fields.
+// As in standard cron, if both fields are restricted a day matches when either does.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	allDom := s.dom == fullSet(cronFields[2])
+	allDow := s.dow == fullSet(cronFields[4])
+
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case allDom && allDow:
+		return true
+	case allDom:
+		return dowMatch
+	case allDow:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// fullSet returns the bitset that matches every value of a field
+func fullSet(spec cronField) uint64 {
+	var set uint64
+	for v := spec.min; v <= spec.max; v++ {
+		set |= 1 << uint(v)
+	}
+
+	return set
+}
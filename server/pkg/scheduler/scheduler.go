@@ -0,0 +1,235 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobFunc is the work performed by a scheduled job
+type JobFunc func() error
+
+// JobStatus is a snapshot of a job's configuration and run metrics.
+// It is returned by the admin endpoint to make scheduled work observable.
+type JobStatus struct {
+	Name         string        `json:"name"`         // Unique job name
+	Schedule     string        `json:"schedule"`     // Cron expression the job runs on
+	Jitter       time.Duration `json:"jitter"`       // Maximum random delay added to each run
+	Running      bool          `json:"running"`      // Whether the job is currently executing
+	NextRun      time.Time     `json:"nextRun"`      // When the job is next due
+	LastStart    time.Time     `json:"lastStart"`    // When the last run started
+	LastDuration time.Duration `json:"lastDuration"` // How long the last run took
+	LastError    string        `json:"lastError"`    // Error returned by the last run, if any
+	Runs         int64         `json:"runs"`         // Number of completed runs
+	Failures     int64         `json:"failures"`     // Number of runs that returned an error
+	Skipped      int64         `json:"skipped"`      // Number of runs skipped because the previous run was still going
+}
+
+// job is a registered job and its run state
+type job struct {
+	mu         sync.Mutex
+	fn         JobFunc
+	schedule   *Schedule
+	runOnStart bool
+	status     JobStatus
+}
+
+// Scheduler runs registered jobs according to their cron schedules.
+// A job never overlaps with itself: if a run is due while the previous
+// run is still executing, the new run is skipped and counted.
+type Scheduler struct {
+	mu       sync.RWMutex
+	jobs     map[string]*job
+	location *time.Location
+	stop     chan struct{}
+	started  bool
+}
+
+// NewScheduler creates a new Scheduler that evaluates cron expressions in the given location.
+// If location is nil, UTC is used.
+func NewScheduler(location *time.Location) *Scheduler {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &Scheduler{
+		jobs:     make(map[string]*job),
+		location: location,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Add registers a job with the scheduler.
+// The job runs whenever the cron expression matches, delayed by a random
+// duration up to jitter. If runOnStart is true, the job also runs once as
+// soon as the scheduler starts. Jobs added after Start begin immediately.
+func (s *Scheduler) Add(name, cronExpr string, jitter time.Duration, runOnStart bool, fn JobFunc) error {
+	schedule, err := ParseCron(cronExpr, s.location)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job %q is already registered", name)
+	}
+
+	j := &job{
+		fn:         fn,
+		schedule:   schedule,
+		runOnStart: runOnStart,
+		status: JobStatus{
+			Name:     name,
+			Schedule: schedule.String(),
+			Jitter:   jitter,
+		},
+	}
+	s.jobs[name] = j
+
+	if s.started {
+		go s.loop(j)
+	}
+
+	return nil
+}
+
+// Start starts a goroutine for every registered job
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+
+	s.started = true
+	for _, j := range s.jobs {
+		go s.loop(j)
+	}
+}
+
+// Stop stops scheduling new runs. Runs already in progress are not interrupted.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started {
+		return
+	}
+
+	close(s.stop)
+	s.started = false
+}
+
+// RunNow triggers a job immediately, outside of its schedule.
+// Returns an error if the job does not exist.
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.RLock()
+	j, ok := s.jobs[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("job %q not found", name)
+	}
+
+	go s.run(j)
+	return nil
+}
+
+// Status returns a snapshot of every job's status sorted by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		j.mu.Lock()
+		statuses = append(statuses, j.status)
+		j.mu.Unlock()
+	}
+
+	sort.Slice(statuses, func(a, b int) bool {
+		return statuses[a].Name < statuses[b].Name
+	})
+
+	return statuses
+}
+
+// loop waits for each scheduled time of a job and runs it
+func (s *Scheduler) loop(j *job) {
+	if j.runOnStart {
+		go s.run(j)
+	}
+
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("job %q has no upcoming runs, stopping\n", j.status.Name)
+			return
+		}
+
+		delay := time.Until(next)
+		if j.status.Jitter > 0 {
+			delay += rand.N(j.status.Jitter)
+		}
+
+		j.mu.Lock()
+		j.status.NextRun = time.Now().Add(delay)
+		j.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			go s.run(j)
+		case <-s.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// run executes a job once, skipping it if the previous run is still in progress
+func (s *Scheduler) run(j *job) {
+	j.mu.Lock()
+	if j.status.Running {
+		j.status.Skipped++
+		j.mu.Unlock()
+		log.Printf("skipping job %q because the previous run is still in progress\n", j.status.Name)
+		return
+	}
+
+	j.status.Running = true
+	j.status.LastStart = time.Now()
+	j.mu.Unlock()
+
+	err := s.safeCall(j)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.Running = false
+	j.status.LastDuration = time.Since(j.status.LastStart)
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		log.Printf("job %q failed: %v\n", j.status.Name, err)
+	}
+}
+
+// safeCall calls the job function, converting a panic into an error
+func (s *Scheduler) safeCall(j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return j.fn()
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+)
+
+// Constants for the on-disk archive of rows evicted from the daily cache
+const (
+	archiveFolder = "shards" // Folder inside the cache folder holding the yearly shards
+	shardPrefix   = "daily-" // Filename prefix of a shard, followed by its year
+	shardSuffix   = ".gob"   // Filename suffix of a shard
+)
+
+// ArchiveStats describes the yearly shards holding rows evicted from the daily cache.
+type ArchiveStats struct {
+	RetentionYears int   `json:"retentionYears"` // Years of history kept in memory, 0 keeps everything
+	Shards         int   `json:"shards"`         // Number of yearly shards on disk
+	Bytes          int64 `json:"bytes"`          // Size of all shards on disk
+	OldestYear     int   `json:"oldestYear"`     // Year of the oldest shard, 0 if there are none
+	NewestYear     int   `json:"newestYear"`     // Year of the newest shard, 0 if there are none
+}
+
+// RetentionCutoff returns the first date kept in memory, or the zero time if
+// retention is disabled. The cutoff is aligned to the start of a year so every
+// shard holds complete years.
+func (t *Tiingo) RetentionCutoff() time.Time {
+	if t.RetentionYears <= 0 {
+		return time.Time{}
+	}
+
+	return time.Date(time.Now().Year()-t.RetentionYears+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// shardPath returns the path of the shard holding the rows of a year
+func shardPath(year int) string {
+	return filepath.Join(cacheFolder, archiveFolder, shardPrefix+strconv.Itoa(year)+shardSuffix)
+}
+
+// archiveOldRows moves rows older than the retention cutoff from the daily cache
+// into their yearly shards, merging them with rows archived earlier.
+func (t *Tiingo) archiveOldRows() error {
+	cutoff := t.RetentionCutoff()
+	if cutoff.IsZero() {
+		return nil
+	}
+
+	evicted := t.DailyCache.Evict(cutoff)
+	if len(evicted) == 0 {
+		return nil
+	}
+
+	t.archiveMu.Lock()
+	defer t.archiveMu.Unlock()
+
+	err := os.MkdirAll(filepath.Join(cacheFolder, archiveFolder), 0777)
+	if err != nil {
+		return err
+	}
+
+	years := make(map[int][]*models.Row)
+	for _, row := range evicted {
+		years[row.Date.Year()] = append(years[row.Date.Year()], row)
+	}
+
+	for year, rows := range years {
+		archived, err := readShard(year)
+		if err != nil {
+			return err
+		}
+
+		err = writeShard(year, mergeRows(archived, rows))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeRows merges newer rows into archived rows by date. Ticker data of the newer
+// rows replaces archived ticker data of the same date.
+func mergeRows(archived []*models.PackedRow, rows []*models.Row) []*models.PackedRow {
+	byDate := make(map[time.Time]*models.PackedRow, len(archived)+len(rows))
+	for _, row := range archived {
+		byDate[row.Date] = row
+	}
+
+	for _, row := range rows {
+		packed := row.Pack()
+		existing, ok := byDate[row.Date]
+		if !ok {
+			byDate[row.Date] = packed
+			continue
+		}
+
+		for ticker, period := range packed.Data {
+			existing.Data[ticker] = period
+		}
+	}
+
+	merged := make([]*models.PackedRow, 0, len(byDate))
+	for _, row := range byDate {
+		merged = append(merged, row)
+	}
+
+	sort.Slice(merged, func(a, b int) bool {
+		return merged[a].Date.Before(merged[b].Date)
+	})
+
+	return merged
+}
+
+// readShard reads the rows of a yearly shard, returning no rows if the shard does not exist
+func readShard(year int) ([]*models.PackedRow, error) {
+	file, err := os.Open(shardPath(year))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	rows := make([]*models.PackedRow, 0)
+	err = gob.NewDecoder(file).Decode(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard %d: %v", year, err)
+	}
+
+	// Shards written before symbols were normalized may spell tickers differently
+	for _, row := range rows {
+		row.Canonicalize()
+	}
+
+	return rows, nil
+}
+
+// writeShard replaces the rows of a yearly shard
+func writeShard(year int, rows []*models.PackedRow) error {
+	file, err := os.OpenFile(shardPath(year), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return gob.NewEncoder(file).Encode(rows)
+}
+
+// ArchivedRows loads the rows dated between start and end inclusive from the yearly shards.
+// Rows are read from disk on every call and are not added back to the daily cache.
+// A zero end reads every shard after start.
+func (t *Tiingo) ArchivedRows(start, end time.Time) ([]*models.Row, error) {
+	cutoff := t.RetentionCutoff()
+	if cutoff.IsZero() || !start.Before(cutoff) {
+		return nil, nil
+	}
+
+	if end.IsZero() || !end.Before(cutoff) {
+		end = cutoff.Add(-time.Nanosecond)
+	}
+
+	t.archiveMu.Lock()
+	defer t.archiveMu.Unlock()
+
+	rows := make([]*models.Row, 0)
+	for year := start.Year(); year <= end.Year(); year++ {
+		archived, err := readShard(year)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range archived {
+			if !row.Date.Before(start) && !row.Date.After(end) {
+				rows = append(rows, row.Unpack())
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// ArchiveStats reports the yearly shards on disk.
+func (t *Tiingo) ArchiveStats() (*ArchiveStats, error) {
+	stats := &ArchiveStats{RetentionYears: t.RetentionYears}
+
+	t.archiveMu.Lock()
+	defer t.archiveMu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(cacheFolder, archiveFolder))
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, shardPrefix) || !strings.HasSuffix(name, shardSuffix) {
+			continue
+		}
+
+		year, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, shardPrefix), shardSuffix))
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Shards++
+		stats.Bytes += info.Size()
+
+		if stats.OldestYear == 0 || year < stats.OldestYear {
+			stats.OldestYear = year
+		}
+
+		if year > stats.NewestYear {
+			stats.NewestYear = year
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,437 @@
+package services
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Feature is a part of the server that spends requests of the Tiingo quota
+type Feature string
+
+// Features that share the Tiingo quota
+const (
+	FeaturePrices       Feature = "prices"       // Live price refreshes
+	FeatureHistory      Feature = "history"      // Daily history backfills
+	FeatureFundamentals Feature = "fundamentals" // Ticker metadata such as the listing exchange
+	FeatureNews         Feature = "news"         // News requests
+	FeatureFX           Feature = "fx"           // Forex quotes for display conversions
+)
+
+// defaultBudgetWait is how long Acquire waits for quota unless MaxWait is set
+const defaultBudgetWait = time.Minute
+
+// FeatureQuota is a feature's share of the hourly quota
+type FeatureQuota struct {
+	Priority int `json:"priority" yaml:"priority"` // Waiting requests of lower priorities are granted first, 0 being the most important
+	PerHour  int `json:"perHour" yaml:"perHour"`   // Requests reserved for the feature every hour, which other features cannot borrow
+}
+
+// BudgetConfig is the share of the quota of each feature. Features without an entry get their default priority
+// and no reserved requests.
+type BudgetConfig map[Feature]FeatureQuota
+
+// DefaultBudgetConfig returns the default priorities: live prices first, then history, forex, fundamentals and news
+func DefaultBudgetConfig() BudgetConfig {
+	return BudgetConfig{
+		FeaturePrices:       {Priority: 0},
+		FeatureHistory:      {Priority: 1},
+		FeatureFX:           {Priority: 2},
+		FeatureFundamentals: {Priority: 3},
+		FeatureNews:         {Priority: 4},
+	}
+}
+
+// LoadBudgetConfig reads the share of each feature from a JSON or YAML file.
+// Features missing from the file keep their defaults.
+func LoadBudgetConfig(path string) (BudgetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := BudgetConfig{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &loaded)
+	default:
+		err = json.Unmarshal(data, &loaded)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	config := DefaultBudgetConfig()
+	for feature, quota := range loaded {
+		if _, ok := config[feature]; !ok {
+			return nil, fmt.Errorf("invalid budget config %s: unknown feature %s", path, feature)
+		}
+
+		if quota.PerHour < 0 || quota.Priority < 0 {
+			return nil, fmt.Errorf("invalid budget config %s: priority and perHour of %s must not be negative", path, feature)
+		}
+
+		config[feature] = quota
+	}
+
+	return config, nil
+}
+
+// FeatureUsage reports how much of the quota a feature has used
+type FeatureUsage struct {
+	Feature  Feature `json:"feature"`  // Name of the feature
+	Priority int     `json:"priority"` // Priority of the feature, 0 being the most important
+	PerHour  int     `json:"perHour"`  // Requests reserved for the feature every hour
+	Used     int     `json:"used"`     // Requests granted in the current hour
+	Borrowed int     `json:"borrowed"` // Requests granted in the current hour beyond the reserved ones
+	Waiting  int     `json:"waiting"`  // Requests currently waiting for quota
+	Granted  int64   `json:"granted"`  // Requests granted since the server started
+	Denied   int64   `json:"denied"`   // Requests refused or timed out since the server started
+	Waited   int64   `json:"waited"`   // Granted requests that had to wait for quota since the server started
+}
+
+// BudgetUsage reports how the hourly quota is shared between the features
+type BudgetUsage struct {
+	Limit    int             `json:"limit"`    // Requests allowed per hour, 0 if unlimited
+	Used     int             `json:"used"`     // Requests granted in the current hour
+	ResetsAt time.Time       `json:"resetsAt"` // When the current hour ends
+	Features []*FeatureUsage `json:"features"` // Usage of each feature, most important first
+}
+
+// featureBudget is the share and usage of a feature
+type featureBudget struct {
+	FeatureUsage
+}
+
+// reservedLeft returns how many of the feature's reserved requests are unused this hour
+func (f *featureBudget) reservedLeft() int {
+	return max(f.PerHour-f.Used, 0)
+}
+
+// budgetWaiter is a request waiting for quota
+type budgetWaiter struct {
+	feature *featureBudget
+	seq     uint64        // Arrival order, breaks ties between features of the same priority
+	ready   chan struct{} // Closed once the request is granted
+	granted bool
+	index   int // Position in the heap, maintained by waiterHeap
+}
+
+// waiterHeap is a min heap of waiting requests by priority and arrival for container/heap
+type waiterHeap []*budgetWaiter
+
+func (h waiterHeap) Len() int { return len(h) }
+func (h waiterHeap) Less(a, b int) bool {
+	if h[a].feature.Priority != h[b].feature.Priority {
+		return h[a].feature.Priority < h[b].feature.Priority
+	}
+
+	return h[a].seq < h[b].seq
+}
+func (h waiterHeap) Swap(a, b int) {
+	h[a], h[b] = h[b], h[a]
+	h[a].index, h[b].index = a, b
+}
+func (h *waiterHeap) Push(x any) {
+	waiter := x.(*budgetWaiter)
+	waiter.index = len(*h)
+	*h = append(*h, waiter)
+}
+func (h *waiterHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	item.index = -1
+	return item
+}
+
+// QuotaBudget shares the hourly request quota of a Tiingo token between the features that use it.
+// Every feature may spend the requests reserved for it, and borrows from the unreserved rest of the quota
+// only if no more important request is waiting, so one feature cannot starve the others. Requests that
+// cannot be granted wait in a priority queue until the quota resets. A nil budget grants every request.
+// It is safe for concurrent use.
+type QuotaBudget struct {
+	MaxWait  time.Duration // How long Acquire waits for quota, 0 uses the default
+	limit    int
+	mu       sync.Mutex
+	features map[Feature]*featureBudget
+	waiting  waiterHeap
+	seq      uint64
+	used     int
+	resetsAt time.Time
+	timer    *time.Timer // Grants waiting requests when the quota resets, nil if none are waiting
+}
+
+// NewQuotaBudget creates a budget over a quota of limit requests per hour, 0 for unlimited.
+// Returns an error if the features reserve more requests than the quota allows.
+func NewQuotaBudget(limit int, config BudgetConfig) (*QuotaBudget, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("quota must not be negative")
+	}
+
+	b := &QuotaBudget{limit: limit, features: make(map[Feature]*featureBudget)}
+	reserved := 0
+	for feature, quota := range DefaultBudgetConfig() {
+		if configured, ok := config[feature]; ok {
+			quota = configured
+		}
+
+		b.features[feature] = &featureBudget{FeatureUsage{Feature: feature, Priority: quota.Priority, PerHour: quota.PerHour}}
+		reserved += quota.PerHour
+	}
+
+	if limit > 0 && reserved > limit {
+		return nil, fmt.Errorf("features reserve %d requests, more than the hourly quota of %d", reserved, limit)
+	}
+
+	return b, nil
+}
+
+// reset starts a new hour once the current one has ended. The caller must hold mu.
+func (b *QuotaBudget) reset(now time.Time) {
+	if now.Before(b.resetsAt) {
+		return
+	}
+
+	b.used = 0
+	b.resetsAt = now.Truncate(time.Hour).Add(time.Hour)
+	for _, feature := range b.features {
+		feature.Used = 0
+		feature.Borrowed = 0
+	}
+}
+
+// allowed checks whether a request of a feature can be granted now, and whether it borrows from the
+// unreserved quota. Borrowing is refused while a more important request waits. The caller must hold mu.
+func (b *QuotaBudget) allowed(feature *featureBudget) (ok, borrows bool) {
+	if b.limit <= 0 {
+		return true, false
+	}
+
+	if b.used >= b.limit {
+		return false, false
+	}
+
+	if feature.reservedLeft() > 0 {
+		return true, false
+	}
+
+	free := b.limit - b.used
+	for _, other := range b.features {
+		if other != feature {
+			free -= other.reservedLeft()
+		}
+	}
+
+	if free <= 0 {
+		return false, false
+	}
+
+	if len(b.waiting) > 0 && b.waiting[0].feature.Priority < feature.Priority {
+		return false, false
+	}
+
+	return true, true
+}
+
+// grant spends a request of the feature's share. The caller must hold mu.
+func (b *QuotaBudget) grant(feature *featureBudget, borrows bool) {
+	b.used++
+	feature.Used++
+	feature.Granted++
+	if borrows {
+		feature.Borrowed++
+	}
+}
+
+// get returns the share of a feature. The caller must hold mu.
+func (b *QuotaBudget) get(name Feature) (*featureBudget, error) {
+	feature, ok := b.features[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown feature %s", name)
+	}
+
+	return feature, nil
+}
+
+// TryAcquire grants a request of a feature if the quota allows it right away, without waiting
+func (b *QuotaBudget) TryAcquire(name Feature) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	feature, err := b.get(name)
+	if err != nil {
+		return false
+	}
+
+	b.reset(time.Now())
+	ok, borrows := b.allowed(feature)
+	if !ok {
+		feature.Denied++
+		return false
+	}
+
+	b.grant(feature, borrows)
+	return true
+}
+
+// Acquire grants a request of a feature, waiting in priority order for the quota to reset if it is used up.
+// Returns a *SourceError with the over_budget reason if the request is not granted within MaxWait or
+// before the context is done.
+func (b *QuotaBudget) Acquire(ctx context.Context, name Feature) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	feature, err := b.get(name)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+
+	b.reset(time.Now())
+	if ok, borrows := b.allowed(feature); ok {
+		b.grant(feature, borrows)
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.seq++
+	waiter := &budgetWaiter{feature: feature, seq: b.seq, ready: make(chan struct{})}
+	heap.Push(&b.waiting, waiter)
+	feature.Waiting++
+	b.schedule()
+	b.mu.Unlock()
+
+	wait := b.MaxWait
+	if wait <= 0 {
+		wait = defaultBudgetWait
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+	case <-timeout.C:
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The request may have been granted while the wait ended
+	if waiter.granted {
+		return nil
+	}
+
+	heap.Remove(&b.waiting, waiter.index)
+	feature.Waiting--
+	feature.Denied++
+	return &SourceError{Source: SourceTiingo, Op: string(name) + " request", Reason: ReasonOverBudget}
+}
+
+// schedule grants waiting requests once the quota resets. The caller must hold mu.
+func (b *QuotaBudget) schedule() {
+	if b.timer != nil || len(b.waiting) == 0 {
+		return
+	}
+
+	b.timer = time.AfterFunc(time.Until(b.resetsAt), func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.timer = nil
+		b.reset(time.Now())
+		b.drain()
+		b.schedule()
+	})
+}
+
+// drain grants waiting requests in priority order until the most important one cannot be granted.
+// The caller must hold mu.
+func (b *QuotaBudget) drain() {
+	for len(b.waiting) > 0 {
+		waiter := b.waiting[0]
+		ok, borrows := b.allowed(waiter.feature)
+		if !ok {
+			return
+		}
+
+		heap.Pop(&b.waiting)
+		waiter.feature.Waiting--
+		waiter.feature.Waited++
+		waiter.granted = true
+		b.grant(waiter.feature, borrows)
+		close(waiter.ready)
+	}
+}
+
+// Remaining returns how many requests a feature could be granted this hour, counting its reserved requests
+// and the unreserved rest of the quota, or -1 if the quota is unlimited
+func (b *QuotaBudget) Remaining(name Feature) int {
+	if b == nil || b.limit <= 0 {
+		return -1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	feature, err := b.get(name)
+	if err != nil {
+		return 0
+	}
+
+	b.reset(time.Now())
+	free := b.limit - b.used
+	for _, other := range b.features {
+		if other != feature {
+			free -= other.reservedLeft()
+		}
+	}
+
+	return max(free, 0)
+}
+
+// Usage returns the quota usage of every feature, most important first
+func (b *QuotaBudget) Usage() *BudgetUsage {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.reset(time.Now())
+	usage := &BudgetUsage{Limit: b.limit, Used: b.used, ResetsAt: b.resetsAt, Features: make([]*FeatureUsage, 0, len(b.features))}
+	for _, feature := range b.features {
+		snapshot := feature.FeatureUsage
+		usage.Features = append(usage.Features, &snapshot)
+	}
+
+	slices.SortFunc(usage.Features, func(a, b *FeatureUsage) int {
+		if a.Priority != b.Priority {
+			return a.Priority - b.Priority
+		}
+
+		return strings.Compare(string(a.Feature), string(b.Feature))
+	})
+
+	return usage
+}
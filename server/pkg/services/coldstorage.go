@@ -0,0 +1,84 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// ColdStorage keeps gzip compressed objects in a Google Cloud Storage bucket
+type ColdStorage struct {
+	Bucket string // Name of the bucket
+	client *storage.Client
+}
+
+// NewColdStorage creates a cold storage for a bucket, authenticated with the client options
+func NewColdStorage(ctx context.Context, bucket string, opts ...option.ClientOption) (*ColdStorage, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("missing bucket name")
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage client: %v", err)
+	}
+
+	return &ColdStorage{Bucket: bucket, client: client}, nil
+}
+
+// Upload compresses what write writes and stores it as the named object, replacing any previous object.
+// The object is only created if write and the upload succeed.
+func (cs *ColdStorage) Upload(ctx context.Context, name, contentType string, write func(io.Writer) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	object := cs.client.Bucket(cs.Bucket).Object(name).NewWriter(ctx)
+	object.ContentType = contentType
+
+	compressed := gzip.NewWriter(object)
+	err := write(compressed)
+	if err == nil {
+		err = compressed.Close()
+	}
+
+	if err != nil {
+		// Cancelling the context aborts the upload, so no partial object is created
+		cancel()
+		object.Close()
+		return err
+	}
+
+	err = object.Close()
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// Download decompresses the named object and passes it to read
+func (cs *ColdStorage) Download(ctx context.Context, name string, read func(io.Reader) error) error {
+	object, err := cs.client.Bucket(cs.Bucket).Object(name).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("object %s does not exist", name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %v", name, err)
+	}
+
+	defer object.Close()
+
+	decompressed, err := gzip.NewReader(object)
+	if err != nil {
+		return fmt.Errorf("error decompressing %s: %v", name, err)
+	}
+
+	defer decompressed.Close()
+	return read(decompressed)
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Constants for the Alpha Vantage earnings calendar
+const (
+	earningsURL     = "https://www.alphavantage.co/query" // Base URL for Alpha Vantage API
+	earningsHorizon = "3month"                            // How far ahead the calendar reaches
+)
+
+// Approximate release times for earnings, in UTC. Releases before the open affect
+// the opening price and releases after the close affect the next open, so they are
+// mapped to the US market open and close respectively.
+const (
+	preMarketReleaseHour  = 14 // Approximate market open hour
+	preMarketReleaseMin   = 30 // Approximate market open minute
+	postMarketReleaseHour = 21 // Approximate market close hour
+)
+
+// EarningsEvent represents a scheduled earnings release for a ticker.
+type EarningsEvent struct {
+	Ticker           string    `json:"ticker"`           // Ticker symbol
+	Name             string    `json:"name"`             // Company name
+	ReportDate       time.Time `json:"reportDate"`       // Date of the release
+	ReportTime       time.Time `json:"reportTime"`       // Approximate time of the release in UTC
+	TimeOfDay        string    `json:"timeOfDay"`        // "pre-market", "post-market" or "" if unknown
+	FiscalDateEnding time.Time `json:"fiscalDateEnding"` // End of the reported fiscal period
+	Estimate         string    `json:"estimate"`         // Consensus EPS estimate, empty if unavailable
+	Currency         string    `json:"currency"`         // Currency of the estimate
+}
+
+// EarningsCalendar is a client for the Alpha Vantage earnings calendar.
+// It caches the upcoming earnings of every listed company in memory.
+type EarningsCalendar struct {
+	Token     string                      // API token for authentication
+	Monitor   *SourceMonitor              // Records the health of calendar requests, nil disables tracking
+	mu        sync.RWMutex                // Protects events and updatedAt
+	events    map[string][]*EarningsEvent // Upcoming events by ticker, soonest first
+	updatedAt time.Time                   // When the calendar was last refreshed
+}
+
+// NewEarningsCalendar creates a new earnings calendar client with the provided API token.
+func NewEarningsCalendar(token string) *EarningsCalendar {
+	return &EarningsCalendar{
+		Token:  token,
+		events: make(map[string][]*EarningsEvent),
+	}
+}
+
+// Refresh downloads the upcoming earnings calendar and replaces the cached events.
+// Failures are returned as a *SourceError and leave the cached events unchanged.
+func (ec *EarningsCalendar) Refresh() (err error) {
+	const op = "earnings calendar"
+
+	if ec.Token == "" {
+		return &SourceError{Source: SourceEarnings, Op: op, Reason: ReasonNotConfigured}
+	}
+
+	defer func() { ec.Monitor.Record(SourceEarnings, err) }()
+
+	response, err := http.Get(fmt.Sprintf("%s?function=EARNINGS_CALENDAR&horizon=%s&apikey=%s", earningsURL, earningsHorizon, ec.Token))
+	if err != nil {
+		return networkError(SourceEarnings, op, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return statusError(SourceEarnings, op, response)
+	}
+
+	records, err := csv.NewReader(response.Body).ReadAll()
+	if err != nil {
+		return decodeError(SourceEarnings, op, err)
+	}
+
+	events, err := parseEarningsRecords(records)
+	if err != nil {
+		return decodeError(SourceEarnings, op, err)
+	}
+
+	ec.mu.Lock()
+	ec.events = events
+	ec.updatedAt = time.Now()
+	ec.mu.Unlock()
+
+	return nil
+}
+
+// parseEarningsRecords converts the CSV records of the calendar into events grouped by ticker
+func parseEarningsRecords(records [][]string) (map[string][]*EarningsEvent, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("earnings calendar is empty")
+	}
+
+	columns := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+
+	for _, required := range []string{"symbol", "reportDate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("earnings calendar is missing the %s column", required)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return record[i]
+	}
+
+	events := make(map[string][]*EarningsEvent)
+	for _, record := range records[1:] {
+		reportDate, err := time.Parse(time.DateOnly, field(record, "reportDate"))
+		if err != nil {
+			continue
+		}
+
+		fiscalDateEnding, _ := time.Parse(time.DateOnly, field(record, "fiscalDateEnding"))
+
+		event := &EarningsEvent{
+			Ticker:           symbols.Canonical(field(record, "symbol")),
+			Name:             field(record, "name"),
+			ReportDate:       reportDate,
+			TimeOfDay:        field(record, "timeOfTheDay"),
+			FiscalDateEnding: fiscalDateEnding,
+			Estimate:         field(record, "estimate"),
+			Currency:         field(record, "currency"),
+		}
+
+		switch event.TimeOfDay {
+		case "post-market":
+			event.ReportTime = reportDate.Add(postMarketReleaseHour * time.Hour)
+		default:
+			event.ReportTime = reportDate.Add(preMarketReleaseHour*time.Hour + preMarketReleaseMin*time.Minute)
+		}
+
+		events[event.Ticker] = append(events[event.Ticker], event)
+	}
+
+	for _, tickerEvents := range events {
+		sort.Slice(tickerEvents, func(a, b int) bool {
+			return tickerEvents[a].ReportTime.Before(tickerEvents[b].ReportTime)
+		})
+	}
+
+	return events, nil
+}
+
+// Upcoming returns the cached earnings events of the given tickers, soonest first.
+func (ec *EarningsCalendar) Upcoming(tickers ...string) []*EarningsEvent {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+
+	upcoming := make([]*EarningsEvent, 0)
+	for _, ticker := range tickers {
+		upcoming = append(upcoming, ec.events[symbols.Canonical(ticker)]...)
+	}
+
+	sort.Slice(upcoming, func(a, b int) bool {
+		return upcoming[a].ReportTime.Before(upcoming[b].ReportTime)
+	})
+
+	return upcoming
+}
+
+// Nearest returns the event of a ticker closest to the given time, or nil if it has none.
+func (ec *EarningsCalendar) Nearest(ticker string, at time.Time) *EarningsEvent {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+
+	var nearest *EarningsEvent
+	for _, event := range ec.events[symbols.Canonical(ticker)] {
+		if nearest == nil || absDuration(event.ReportTime.Sub(at)) < absDuration(nearest.ReportTime.Sub(at)) {
+			nearest = event
+		}
+	}
+
+	return nearest
+}
+
+// UpdatedAt returns when the calendar was last refreshed.
+func (ec *EarningsCalendar) UpdatedAt() time.Time {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+
+	return ec.updatedAt
+}
+
+// absDuration returns the absolute value of a duration
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
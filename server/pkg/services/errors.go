@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// FailureReason classifies why a request to a data source failed
+type FailureReason string
+
+// Failure reasons reported by the data source clients
+const (
+	ReasonNotConfigured FailureReason = "not_configured" // The client has no API token
+	ReasonNetwork       FailureReason = "network"        // The data source could not be reached
+	ReasonUnauthorized  FailureReason = "unauthorized"   // The API token was rejected
+	ReasonRateLimited   FailureReason = "rate_limited"   // The request quota of the API token is used up
+	ReasonOverBudget    FailureReason = "over_budget"    // The request was held back to leave quota for other features
+	ReasonNotFound      FailureReason = "not_found"      // The requested ticker does not exist
+	ReasonUnavailable   FailureReason = "unavailable"    // The data source returned a server error
+	ReasonBadResponse   FailureReason = "bad_response"   // The response could not be parsed
+)
+
+// Names of the data sources
+const (
+	SourceTiingo       = "tiingo"        // Tiingo prices, history and metadata
+	SourceTiingoBackup = "tiingo_backup" // Tiingo live prices with the backup token
+	SourceEarnings     = "alphavantage"  // Alpha Vantage earnings calendar
+	SourceFX           = "tiingo_fx"     // Tiingo forex quotes used for display conversions
+)
+
+// SourceError is returned when a request to an external data source fails.
+// Use errors.As to inspect the reason, for example to tell a missing ticker
+// apart from an outage of the data source.
+type SourceError struct {
+	Source     string        // Data source that failed
+	Op         string        // What was being fetched
+	Reason     FailureReason // Why the request failed
+	StatusCode int           // HTTP status of the response, 0 if there was none
+	Err        error         // Underlying error, nil if the status describes the failure
+}
+
+// Error implements the error interface
+func (e *SourceError) Error() string {
+	message := fmt.Sprintf("%s: error fetching %s: %s", e.Source, e.Op, e.Reason)
+	if e.StatusCode != 0 {
+		message += fmt.Sprintf(" (%d %s)", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+
+	return message
+}
+
+// Unwrap returns the underlying error
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Outage checks whether the failure is caused by the data source rather than the request,
+// meaning the data source is unreachable, out of quota or broken.
+func (e *SourceError) Outage() bool {
+	switch e.Reason {
+	case ReasonNetwork, ReasonRateLimited, ReasonOverBudget, ReasonUnavailable, ReasonBadResponse:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsOutage checks whether an error is a data source outage
+func IsOutage(err error) bool {
+	var sourceErr *SourceError
+	return errors.As(err, &sourceErr) && sourceErr.Outage()
+}
+
+// IsNotFound checks whether an error reports a ticker missing from the data source
+func IsNotFound(err error) bool {
+	var sourceErr *SourceError
+	return errors.As(err, &sourceErr) && sourceErr.Reason == ReasonNotFound
+}
+
+// networkError creates an error for a request that did not receive a response
+func networkError(source, op string, err error) *SourceError {
+	return &SourceError{Source: source, Op: op, Reason: ReasonNetwork, Err: err}
+}
+
+// statusError creates an error for a response with an unsuccessful status
+func statusError(source, op string, response *http.Response) *SourceError {
+	reason := ReasonBadResponse
+	switch {
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		reason = ReasonUnauthorized
+	case response.StatusCode == http.StatusTooManyRequests:
+		reason = ReasonRateLimited
+	case response.StatusCode == http.StatusNotFound:
+		reason = ReasonNotFound
+	case response.StatusCode >= 500:
+		reason = ReasonUnavailable
+	}
+
+	return &SourceError{Source: source, Op: op, Reason: reason, StatusCode: response.StatusCode}
+}
+
+// decodeError creates an error for a response that could not be parsed
+func decodeError(source, op string, err error) *SourceError {
+	return &SourceError{Source: source, Op: op, Reason: ReasonBadResponse, Err: err}
+}
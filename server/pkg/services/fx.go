@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultFXTTL is how long an exchange rate is cached unless TTL is set
+const defaultFXTTL = time.Hour
+
+// FXRate is the exchange rate between two currencies
+type FXRate struct {
+	From  string    `json:"from"`  // Currency converted from
+	To    string    `json:"to"`    // Currency converted to
+	Rate  float64   `json:"rate"`  // Units of To per unit of From
+	Time  time.Time `json:"time"`  // When the rate was quoted
+	Stale bool      `json:"stale"` // Whether the rate is older than the cache TTL because the refresh failed
+}
+
+// fxQuote is a forex quote of Tiingo's top of book endpoint
+type fxQuote struct {
+	Ticker         string    `json:"ticker"`
+	QuoteTimestamp time.Time `json:"quoteTimestamp"`
+	MidPrice       float64   `json:"midPrice"`
+}
+
+// FXRates is a client for Tiingo's forex quotes that caches exchange rates in memory.
+// Rates are only used to display amounts in another currency, never for trading.
+type FXRates struct {
+	Token   string               // API token for authentication
+	TTL     time.Duration        // How long a rate is cached, 0 uses the default
+	Monitor *SourceMonitor       // Records the health of forex requests, nil disables tracking
+	Budget  *QuotaBudget         // Shares the hourly quota of the token with other features, nil grants every request
+	mu      sync.Mutex           // Protects rates
+	rates   map[string]*fxCached // Cached rates by pair, such as "usdeur"
+}
+
+// fxCached is a cached exchange rate
+type fxCached struct {
+	rate      *FXRate
+	fetchedAt time.Time
+}
+
+// NewFXRates creates a new forex client with the provided API token
+func NewFXRates(token string) *FXRates {
+	return &FXRates{
+		Token: token,
+		rates: make(map[string]*fxCached),
+	}
+}
+
+// Rate returns the exchange rate from one currency to another. Cached rates are refreshed once they
+// are older than the TTL, and a stale rate is returned when the refresh fails. Returns a *SourceError
+// if the rate was never fetched and cannot be downloaded.
+func (f *FXRates) Rate(from, to string) (*FXRate, error) {
+	if from == to {
+		return &FXRate{From: from, To: to, Rate: 1, Time: time.Now()}, nil
+	}
+
+	ttl := f.TTL
+	if ttl <= 0 {
+		ttl = defaultFXTTL
+	}
+
+	pair := strings.ToLower(from + to)
+
+	f.mu.Lock()
+	cached, ok := f.rates[pair]
+	f.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < ttl {
+		return cached.rate, nil
+	}
+
+	rate, err := f.fetch(from, to)
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+
+		stale := *cached.rate
+		stale.Stale = true
+		return &stale, nil
+	}
+
+	f.mu.Lock()
+	f.rates[pair] = &fxCached{rate: rate, fetchedAt: time.Now()}
+	f.mu.Unlock()
+
+	return rate, nil
+}
+
+// fetch downloads the current exchange rate of a currency pair
+func (f *FXRates) fetch(from, to string) (rate *FXRate, err error) {
+	op := "exchange rate " + from + "/" + to
+	if f.Token == "" {
+		return nil, &SourceError{Source: SourceFX, Op: op, Reason: ReasonNotConfigured}
+	}
+
+	if !f.Budget.TryAcquire(FeatureFX) {
+		return nil, &SourceError{Source: SourceFX, Op: op, Reason: ReasonOverBudget}
+	}
+
+	defer func() { f.Monitor.Record(SourceFX, err) }()
+
+	response, err := http.Get(fmt.Sprintf("%s/tiingo/fx/top?tickers=%s&token=%s", baseURL, strings.ToLower(from+to), f.Token))
+	if err != nil {
+		return nil, networkError(SourceFX, op, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(SourceFX, op, response)
+	}
+
+	quotes := make([]*fxQuote, 0, 1)
+	err = json.NewDecoder(response.Body).Decode(&quotes)
+	if err != nil {
+		return nil, decodeError(SourceFX, op, err)
+	}
+
+	if len(quotes) == 0 || quotes[0].MidPrice <= 0 {
+		return nil, &SourceError{Source: SourceFX, Op: op, Reason: ReasonNotFound}
+	}
+
+	return &FXRate{From: from, To: to, Rate: quotes[0].MidPrice, Time: quotes[0].QuoteTimestamp}, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// quarantineFolder is the folder inside the cache folder holding the history of quarantined tickers
+const quarantineFolder = "quarantine"
+
+// CheckCache validates the invariants of the daily cache
+func (t *Tiingo) CheckCache() *models.IntegrityReport {
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	return t.DailyCache.CheckIntegrity()
+}
+
+// SortCache sorts the rows of the daily cache by date and merges rows with the same date
+func (t *Tiingo) SortCache() {
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	t.DailyCache.SortRows()
+}
+
+// QuarantineTicker removes a ticker from the daily cache and writes its removed history to a file
+// in the quarantine folder for inspection. The ticker stays on the watchlist, so its history is
+// downloaded again by the next full download. Returns the number of removed rows and the file path.
+func (t *Tiingo) QuarantineTicker(ticker string) (int, string, error) {
+	ticker = symbols.Canonical(ticker)
+
+	t.cacheMu.Lock()
+	meta := t.DailyCache.Tickers[ticker]
+	removed := t.DailyCache.RemoveTicker(ticker)
+	t.cacheMu.Unlock()
+
+	folder := filepath.Join(cacheFolder, quarantineFolder)
+	err := os.MkdirAll(folder, 0777)
+	if err != nil {
+		return len(removed), "", err
+	}
+
+	marshalled, err := json.Marshal(map[string]any{"ticker": ticker, "meta": meta, "periods": removed})
+	if err != nil {
+		return len(removed), "", err
+	}
+
+	path := filepath.Join(folder, ticker+"-"+strconv.FormatInt(time.Now().Unix(), 10)+".json")
+	return len(removed), path, os.WriteFile(path, marshalled, 0644)
+}
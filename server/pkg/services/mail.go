@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendGridEndpoint is SendGrid's v3 mail send endpoint
+const sendGridEndpoint = "https://api.sendgrid.com/v3/mail/send"
+
+// Email is a message with a plain text and an HTML body
+type Email struct {
+	To      string // Address of the recipient
+	Subject string // Subject line
+	Text    string // Plain text body
+	HTML    string // HTML body, sent as an alternative to the plain text body if not empty
+}
+
+// Mailer sends emails
+type Mailer interface {
+	// Send sends an email to its recipient
+	Send(ctx context.Context, email *Email) error
+}
+
+// NewMailer creates a mailer for the provider "smtp" or "sendgrid", configured by the settings
+// of that provider. Emails are sent from the from address.
+func NewMailer(provider, from string, settings map[string]string) (Mailer, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %v", from, err)
+	}
+
+	switch provider {
+	case "smtp":
+		port := 587
+		if env := settings["port"]; env != "" {
+			parsed, err := strconv.Atoi(env)
+			if err != nil || parsed <= 0 || parsed > 65535 {
+				return nil, fmt.Errorf("invalid SMTP port: %s", env)
+			}
+
+			port = parsed
+		}
+
+		if settings["host"] == "" {
+			return nil, fmt.Errorf("missing SMTP host")
+		}
+
+		return &SMTPMailer{
+			Host:     settings["host"],
+			Port:     port,
+			Username: settings["username"],
+			Password: settings["password"],
+			From:     from,
+		}, nil
+	case "sendgrid":
+		if settings["api_key"] == "" {
+			return nil, fmt.Errorf("missing SendGrid API key")
+		}
+
+		return &SendGridMailer{APIKey: settings["api_key"], From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q, expected smtp or sendgrid", provider)
+	}
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading the connection with STARTTLS when the server supports it
+type SMTPMailer struct {
+	Host     string // Host name of the SMTP server
+	Port     int    // Port of the SMTP server
+	Username string // Username for PLAIN authentication, empty to send without authenticating
+	Password string // Password for PLAIN authentication
+	From     string // Sender address
+}
+
+// Send sends an email as a multipart/alternative message when it has an HTML body
+func (m *SMTPMailer) Send(ctx context.Context, email *Email) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	message, err := m.message(email)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(address, auth, m.From, []string{email.To}, message)
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			return fmt.Errorf("error sending email through %s: %v", address, err)
+		}
+
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message encodes an email as an RFC 5322 message
+func (m *SMTPMailer) message(email *Email) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "From: %s\r\n", m.From)
+	fmt.Fprintf(buffer, "To: %s\r\n", email.To)
+	fmt.Fprintf(buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+
+	if email.HTML == "" {
+		buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buffer.WriteString(crlf(email.Text))
+		return buffer.Bytes(), nil
+	}
+
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("error generating MIME boundary: %v", err)
+	}
+
+	boundary := hex.EncodeToString(random)
+	fmt.Fprintf(buffer, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", boundary)
+	for _, part := range []struct{ contentType, body string }{{"text/plain", email.Text}, {"text/html", email.HTML}} {
+		fmt.Fprintf(buffer, "--%s\r\nContent-Type: %s; charset=utf-8\r\n\r\n%s\r\n", boundary, part.contentType, crlf(part.body))
+	}
+
+	fmt.Fprintf(buffer, "--%s--\r\n", boundary)
+	return buffer.Bytes(), nil
+}
+
+// crlf normalizes the line endings of a body to CRLF as SMTP requires
+func crlf(body string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// SendGridMailer sends emails through SendGrid's v3 API
+type SendGridMailer struct {
+	APIKey   string // SendGrid API key with the mail send permission
+	From     string // Sender address, which must be verified in SendGrid
+	Endpoint string // Mail send endpoint, empty for SendGrid's
+}
+
+// sendGridAddress is an address of a SendGrid request
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+// sendGridContent is a body of a SendGrid request
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// sendGridRequest is the request body of SendGrid's mail send endpoint
+type sendGridRequest struct {
+	Personalizations []struct {
+		To []sendGridAddress `json:"to"`
+	} `json:"personalizations"`
+	From    sendGridAddress   `json:"from"`
+	Subject string            `json:"subject"`
+	Content []sendGridContent `json:"content"`
+}
+
+// Send sends an email with SendGrid
+func (m *SendGridMailer) Send(ctx context.Context, email *Email) error {
+	request := &sendGridRequest{
+		From:    sendGridAddress{m.From},
+		Subject: email.Subject,
+		Content: []sendGridContent{{"text/plain", email.Text}},
+	}
+
+	request.Personalizations = make([]struct {
+		To []sendGridAddress `json:"to"`
+	}, 1)
+	request.Personalizations[0].To = []sendGridAddress{{email.To}}
+
+	if email.HTML != "" {
+		request.Content = append(request.Content, sendGridContent{"text/html", email.HTML})
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("error encoding email: %v", err)
+	}
+
+	endpoint := m.Endpoint
+	if endpoint == "" {
+		endpoint = sendGridEndpoint
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating SendGrid request: %v", err)
+	}
+
+	httpRequest.Header.Set("Authorization", "Bearer "+m.APIKey)
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		return fmt.Errorf("error sending email with SendGrid: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("error sending email with SendGrid: %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults for deciding when a data source is down
+const (
+	defaultFailureThreshold = 3               // Consecutive failures after which a source is down
+	defaultRetryAfter       = 5 * time.Minute // How long a down source is skipped before it is retried
+)
+
+// Health states of a data source
+const (
+	HealthHealthy  = "healthy"  // The last request succeeded
+	HealthDegraded = "degraded" // Recent requests failed, but fewer than the failure threshold
+	HealthDown     = "down"     // The failure threshold was reached or the quota is used up
+)
+
+// QuotaUsage reports how much of a data source's hourly request quota has been used
+type QuotaUsage struct {
+	Limit    int       `json:"limit"`    // Requests allowed per hour, 0 if unlimited
+	Used     int       `json:"used"`     // Requests made in the current hour
+	ResetsAt time.Time `json:"resetsAt"` // When the current hour ends
+}
+
+// SourceHealth describes the recent reliability of a data source
+type SourceHealth struct {
+	Source              string        `json:"source"`              // Name of the data source
+	Status              string        `json:"status"`              // "healthy", "degraded" or "down"
+	ConsecutiveFailures int           `json:"consecutiveFailures"` // Failures since the last success
+	Requests            int64         `json:"requests"`            // Requests made since the server started
+	Failures            int64         `json:"failures"`            // Failed requests since the server started
+	LastSuccess         time.Time     `json:"lastSuccess"`         // Time of the last successful request
+	LastFailure         time.Time     `json:"lastFailure"`         // Time of the last failed request
+	LastReason          FailureReason `json:"lastReason"`          // Reason of the last failure
+	LastError           string        `json:"lastError"`           // Message of the last failure
+	Quota               QuotaUsage    `json:"quota"`               // Usage of the hourly request quota
+}
+
+// SourceMonitor tracks the health and quota usage of every data source.
+// It is safe for concurrent use.
+type SourceMonitor struct {
+	FailureThreshold int           // Consecutive failures after which a source is down
+	RetryAfter       time.Duration // How long a down source is skipped before it is retried
+	Reserve          int           // Requests of each hourly quota held back for held and ordered tickers
+	mu               sync.Mutex
+	sources          map[string]*SourceHealth
+}
+
+// NewSourceMonitor creates a monitor with the default failure threshold and retry delay
+func NewSourceMonitor() *SourceMonitor {
+	return &SourceMonitor{
+		FailureThreshold: defaultFailureThreshold,
+		RetryAfter:       defaultRetryAfter,
+		sources:          make(map[string]*SourceHealth),
+	}
+}
+
+// get returns the health of a source, creating it if needed. The caller must hold mu.
+func (m *SourceMonitor) get(source string) *SourceHealth {
+	health, ok := m.sources[source]
+	if !ok {
+		health = &SourceHealth{Source: source}
+		m.sources[source] = health
+	}
+
+	now := time.Now()
+	if !now.Before(health.Quota.ResetsAt) {
+		health.Quota.Used = 0
+		health.Quota.ResetsAt = now.Truncate(time.Hour).Add(time.Hour)
+	}
+
+	return health
+}
+
+// SetQuota sets the number of requests a source allows per hour, 0 for unlimited
+func (m *SourceMonitor) SetQuota(source string, perHour int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.get(source).Quota.Limit = perHour
+}
+
+// Record records the outcome of a request to a source. Errors that describe the
+// request rather than the source, such as an unknown ticker, do not count as failures.
+// Requests the quota budget held back were never sent and are not recorded.
+func (m *SourceMonitor) Record(source string, err error) {
+	var sourceErr *SourceError
+	if m == nil || (errors.As(err, &sourceErr) && sourceErr.Reason == ReasonOverBudget) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := m.get(source)
+	health.Requests++
+	health.Quota.Used++
+
+	if err == nil || (errors.As(err, &sourceErr) && sourceErr.Reason == ReasonNotFound) {
+		health.ConsecutiveFailures = 0
+		health.LastSuccess = time.Now()
+		return
+	}
+
+	health.Failures++
+	health.ConsecutiveFailures++
+	health.LastFailure = time.Now()
+	health.LastError = err.Error()
+	health.LastReason = ReasonUnavailable
+	if sourceErr != nil {
+		health.LastReason = sourceErr.Reason
+	}
+}
+
+// status returns the health state of a source. The caller must hold mu.
+func (m *SourceMonitor) status(health *SourceHealth) string {
+	switch {
+	case health.Quota.Limit > 0 && health.Quota.Used >= health.Quota.Limit:
+		return HealthDown
+	case health.ConsecutiveFailures >= m.FailureThreshold:
+		return HealthDown
+	case health.ConsecutiveFailures > 0:
+		return HealthDegraded
+	default:
+		return HealthHealthy
+	}
+}
+
+// Budget returns how many requests can be made to a source before its reserve is reached,
+// or -1 if the source has no quota.
+func (m *SourceMonitor) Budget(source string) int {
+	if m == nil {
+		return -1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := m.get(source)
+	if health.Quota.Limit <= 0 {
+		return -1
+	}
+
+	return max(health.Quota.Limit-health.Quota.Used-m.Reserve, 0)
+}
+
+// Constrained checks whether a source has used up its quota down to the reserve
+func (m *SourceMonitor) Constrained(source string) bool {
+	return m.Budget(source) == 0
+}
+
+// Available checks whether requests should be sent to a source. Sources that are
+// down because of failures are retried once RetryAfter has passed since the last failure.
+func (m *SourceMonitor) Available(source string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	health := m.get(source)
+	if health.Quota.Limit > 0 && health.Quota.Used >= health.Quota.Limit {
+		return false
+	}
+
+	return health.ConsecutiveFailures < m.FailureThreshold || time.Since(health.LastFailure) >= m.RetryAfter
+}
+
+// Health returns the health of every source that has been used, sorted by name
+func (m *SourceMonitor) Health() []*SourceHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	healths := make([]*SourceHealth, 0, len(m.sources))
+	for source := range m.sources {
+		health := *m.get(source)
+		health.Status = m.status(&health)
+		healths = append(healths, &health)
+	}
+
+	sort.Slice(healths, func(a, b int) bool {
+		return healths[a].Source < healths[b].Source
+	})
+
+	return healths
+}
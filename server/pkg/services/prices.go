@@ -0,0 +1,152 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// PriceSource is a provider of live prices
+type PriceSource interface {
+	// Name returns the name the source is reported under
+	Name() string
+
+	// FetchPrices fetches the latest price of each ticker
+	FetchPrices(tickers []string) (map[string]float64, error)
+}
+
+// LastPriceResponse represents the response from the Tiingo API for last price.
+// This struct maps to the JSON response from the IEX endpoint.
+type LastPriceResponse struct {
+	Ticker   string  `json:"ticker"`   // Ticker symbol
+	TngoLast float64 `json:"tngoLast"` // Latest price
+}
+
+// IEXPrices fetches live prices from the Tiingo IEX endpoint.
+// Several instances with different tokens can be used to spread requests over quotas.
+type IEXPrices struct {
+	Budget *QuotaBudget // Shares the hourly quota of the token with other features, nil grants every request
+	name   string       // Name the source is reported under
+	token  string       // API token for authentication
+}
+
+// NewIEXPrices creates a live price source for a Tiingo API token
+func NewIEXPrices(name, token string) *IEXPrices {
+	return &IEXPrices{name: name, token: token}
+}
+
+// Name returns the name the source is reported under
+func (p *IEXPrices) Name() string {
+	return p.name
+}
+
+// FetchPrices fetches the latest price of each ticker with a single API call.
+// If the request fails, no prices are returned and the error is a *SourceError.
+func (p *IEXPrices) FetchPrices(tickers []string) (map[string]float64, error) {
+	const op = "live prices"
+	if !p.Budget.TryAcquire(FeaturePrices) {
+		return nil, &SourceError{Source: p.name, Op: op, Reason: ReasonOverBudget}
+	}
+
+	request, err := http.NewRequest(http.MethodGet,
+		fmt.Sprintf("%s/iex/?tickers=%s&token=%s",
+			baseURL,
+			strings.Join(tickers, ","),
+			p.token,
+		),
+		nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Add("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, networkError(p.name, op, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(p.name, op, response)
+	}
+
+	result := make([]LastPriceResponse, len(tickers))
+	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, decodeError(p.name, op, err)
+	}
+
+	prices := make(map[string]float64, len(tickers))
+	for _, pair := range result {
+		prices[symbols.Canonical(pair.Ticker)] = pair.TngoLast
+	}
+
+	return prices, nil
+}
+
+// PriceFeed fetches live prices from the first available of several sources.
+// Sources are tried in order, skipping sources the monitor reports as down,
+// so requests fail over to backup sources while the primary source is unhealthy.
+type PriceFeed struct {
+	sources []PriceSource  // Sources in order of preference
+	monitor *SourceMonitor // Health of the sources
+}
+
+// NewPriceFeed creates a price feed over sources in order of preference
+func NewPriceFeed(monitor *SourceMonitor, sources ...PriceSource) *PriceFeed {
+	return &PriceFeed{sources, monitor}
+}
+
+// Monitor returns the monitor tracking the health of the sources
+func (f *PriceFeed) Monitor() *SourceMonitor {
+	return f.monitor
+}
+
+// Constrained checks whether every source has used its quota down to the reserve of the monitor,
+// in which case only the most important tickers should be refreshed
+func (f *PriceFeed) Constrained() bool {
+	for _, source := range f.sources {
+		if !f.monitor.Constrained(source.Name()) {
+			return false
+		}
+	}
+
+	return len(f.sources) > 0
+}
+
+// Fetch fetches the latest price of each ticker and returns the name of the source that provided them.
+// If every available source fails, the error of each attempt is returned. If no source is
+// available, the preferred source is tried anyway so that prices recover as soon as it does.
+func (f *PriceFeed) Fetch(tickers []string) (map[string]float64, string, error) {
+	if len(f.sources) == 0 {
+		return nil, "", errors.New("no price sources configured")
+	}
+
+	attempts := make([]PriceSource, 0, len(f.sources))
+	for _, source := range f.sources {
+		if f.monitor.Available(source.Name()) {
+			attempts = append(attempts, source)
+		}
+	}
+
+	if len(attempts) == 0 {
+		attempts = f.sources[:1]
+	}
+
+	errs := make([]error, 0, len(attempts))
+	for _, source := range attempts {
+		prices, err := source.FetchPrices(tickers)
+		f.monitor.Record(source.Name(), err)
+		if err == nil {
+			return prices, source.Name(), nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, "", errors.Join(errs...)
+}
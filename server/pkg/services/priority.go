@@ -0,0 +1,128 @@
+package services
+
+import (
+	"container/heap"
+	"sync"
+
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Tier is how important fresh data for a ticker is
+type Tier int
+
+// Ticker tiers, from least to most important
+const (
+	TierWatched Tier = iota // Only on the watchlist
+	TierOrdered             // Has open conditional orders
+	TierHeld                // Held by at least one portfolio
+)
+
+// TickerPriority is the priority of a ticker for downloads and price refreshes
+type TickerPriority struct {
+	Ticker string  `json:"ticker"` // Ticker symbol
+	Tier   Tier    `json:"tier"`   // Importance tier
+	Weight float64 `json:"weight"` // Orders tickers within a tier, such as the total value held
+}
+
+// before checks whether p should be refreshed before other
+func (p *TickerPriority) before(other *TickerPriority) bool {
+	if p.Tier != other.Tier {
+		return p.Tier > other.Tier
+	}
+
+	if p.Weight != other.Weight {
+		return p.Weight > other.Weight
+	}
+
+	return p.Ticker < other.Ticker
+}
+
+// priorityHeap is a max heap of ticker priorities for container/heap
+type priorityHeap []*TickerPriority
+
+func (h priorityHeap) Len() int           { return len(h) }
+func (h priorityHeap) Less(a, b int) bool { return h[a].before(h[b]) }
+func (h priorityHeap) Swap(a, b int)      { h[a], h[b] = h[b], h[a] }
+func (h *priorityHeap) Push(x any)        { *h = append(*h, x.(*TickerPriority)) }
+func (h *priorityHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// TickerQueue orders tickers so that data the valuations depend on is fetched first
+// when the request budget of a data source is constrained. It is safe for concurrent use.
+type TickerQueue struct {
+	mu         sync.RWMutex
+	priorities map[string]*TickerPriority
+}
+
+// NewTickerQueue creates a queue where every ticker has the watched tier
+func NewTickerQueue() *TickerQueue {
+	return &TickerQueue{priorities: make(map[string]*TickerPriority)}
+}
+
+// Replace replaces the priorities of every ticker. Tickers without a priority are watched.
+func (q *TickerQueue) Replace(priorities []*TickerPriority) {
+	replaced := make(map[string]*TickerPriority, len(priorities))
+	for _, priority := range priorities {
+		priority.Ticker = symbols.Canonical(priority.Ticker)
+		replaced[priority.Ticker] = priority
+	}
+
+	q.mu.Lock()
+	q.priorities = replaced
+	q.mu.Unlock()
+}
+
+// priority returns the priority of a ticker. The caller must hold mu.
+func (q *TickerQueue) priority(ticker string) *TickerPriority {
+	if priority, ok := q.priorities[ticker]; ok {
+		copied := *priority
+		return &copied
+	}
+
+	return &TickerPriority{Ticker: ticker, Tier: TierWatched}
+}
+
+// Order returns the priorities of the tickers, most important first
+func (q *TickerQueue) Order(tickers []string) []*TickerPriority {
+	q.mu.RLock()
+	h := make(priorityHeap, 0, len(tickers))
+	for _, ticker := range tickers {
+		h = append(h, q.priority(ticker))
+	}
+	q.mu.RUnlock()
+
+	heap.Init(&h)
+
+	ordered := make([]*TickerPriority, 0, len(h))
+	for h.Len() > 0 {
+		ordered = append(ordered, heap.Pop(&h).(*TickerPriority))
+	}
+
+	return ordered
+}
+
+// Critical returns the tickers that are held or have open orders, most important first
+func (q *TickerQueue) Critical(tickers []string) []string {
+	critical := make([]string, 0)
+	for _, priority := range q.Order(tickers) {
+		if priority.Tier > TierWatched {
+			critical = append(critical, priority.Ticker)
+		}
+	}
+
+	return critical
+}
+
+// Tickers returns the tickers in order of importance
+func (q *TickerQueue) Tickers(tickers []string) []string {
+	ordered := make([]string, 0, len(tickers))
+	for _, priority := range q.Order(tickers) {
+		ordered = append(ordered, priority.Ticker)
+	}
+
+	return ordered
+}
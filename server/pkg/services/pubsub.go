@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+// maxPublishBatch is the largest number of messages Pub/Sub accepts in a single publish request
+const maxPublishBatch = 1000
+
+// topicPattern matches the full resource name of a Pub/Sub topic
+var topicPattern = regexp.MustCompile(`^projects/[^/]+/topics/[^/]+$`)
+
+// PubSubMessage is a message published to a Pub/Sub topic
+type PubSubMessage struct {
+	Data       []byte            // Payload of the message
+	Attributes map[string]string // Attributes subscribers can filter on
+}
+
+// PubSub publishes messages to a Google Cloud Pub/Sub topic
+type PubSub struct {
+	Topic   string // Full resource name of the topic, such as "projects/my-project/topics/algobattle"
+	service *pubsub.Service
+}
+
+// NewPubSub creates a publisher for a topic, authenticated with the client options
+func NewPubSub(ctx context.Context, topic string, opts ...option.ClientOption) (*PubSub, error) {
+	if !topicPattern.MatchString(topic) {
+		return nil, fmt.Errorf("invalid topic %q, expected projects/PROJECT/topics/TOPIC", topic)
+	}
+
+	service, err := pubsub.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pubsub client: %v", err)
+	}
+
+	return &PubSub{Topic: topic, service: service}, nil
+}
+
+// Publish publishes messages to the topic in batches and returns their server assigned IDs.
+// Messages of a failed batch are not published, but earlier batches may have been.
+func (p *PubSub) Publish(ctx context.Context, messages []*PubSubMessage) ([]string, error) {
+	ids := make([]string, 0, len(messages))
+	for start := 0; start < len(messages); start += maxPublishBatch {
+		batch := messages[start:min(start+maxPublishBatch, len(messages))]
+
+		request := &pubsub.PublishRequest{Messages: make([]*pubsub.PubsubMessage, 0, len(batch))}
+		for _, message := range batch {
+			request.Messages = append(request.Messages, &pubsub.PubsubMessage{
+				Data:       base64.StdEncoding.EncodeToString(message.Data),
+				Attributes: message.Attributes,
+			})
+		}
+
+		response, err := p.service.Projects.Topics.Publish(p.Topic, request).Context(ctx).Do()
+		if err != nil {
+			return ids, fmt.Errorf("error publishing to %s: %v", p.Topic, err)
+		}
+
+		ids = append(ids, response.MessageIds...)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out the requests to each data source so that bursts of downloads
+// do not trip the source's rate limits. It is safe for concurrent use.
+type RateLimiter struct {
+	mu        sync.Mutex
+	intervals map[string]time.Duration // Minimum time between two requests to a source
+	next      map[string]time.Time     // Earliest time of the next request to a source
+}
+
+// NewRateLimiter creates a rate limiter without any limits
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		intervals: make(map[string]time.Duration),
+		next:      make(map[string]time.Time),
+	}
+}
+
+// SetRate sets how many requests a source allows per minute, 0 for unlimited
+func (l *RateLimiter) SetRate(source string, perMinute int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if perMinute <= 0 {
+		delete(l.intervals, source)
+		return
+	}
+
+	l.intervals[source] = time.Minute / time.Duration(perMinute)
+}
+
+// Wait blocks until a request may be sent to a source. A nil limiter never blocks.
+func (l *RateLimiter) Wait(source string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	interval, ok := l.intervals[source]
+	if !ok {
+		l.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	at := l.next[source]
+	if at.Before(now) {
+		at = now
+	}
+
+	l.next[source] = at.Add(interval)
+	l.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+}
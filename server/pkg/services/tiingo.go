@@ -9,15 +9,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"slices"
+	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 	"urjith.dev/algobattle/pkg/indicators"
 	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/symbols"
 	"urjith.dev/algobattle/pkg/utils"
 )
 
@@ -29,26 +33,58 @@ const (
 	cacheFolder    = "./data"                 // Folder for caching data
 	dailyCacheJSON = "dailycache.json"        // JSON cache filename
 	dailyCacheGOB  = "dailycache.gob"         // GOB cache filename
+
+	defaultDownloadWorkers = 4   // Concurrent history downloads unless DownloadWorkers is set
+	historyProgressBars    = 500 // Decoded bars between two progress reports of a download
 )
 
+// HistorySource provides daily history and ticker metadata in place of the Tiingo API,
+// such as a simulated market. Missing tickers are reported with a not found *SourceError.
+type HistorySource interface {
+	// FetchHistory returns the full daily history of a ticker
+	FetchHistory(ticker string) ([]models.PackedPeriod, error)
+
+	// Metadata returns the name and listing exchange of a ticker
+	Metadata(ticker string) (*TickerMetadata, error)
+}
+
 // Tiingo is a client for the Tiingo API that provides stock market data.
 // It manages a list of watched tickers, caches historical data, and
-// calculates technical indicators.
+// calculates technical indicators. Rows older than the retention period are
+// moved from the daily cache into yearly shards on disk when the cache is saved.
 type Tiingo struct {
-	Token      string                 // API token for authentication
-	tickers    *utils.TreeSet[string] // Set of watched ticker symbols
-	DailyCache *models.History        // Cache of historical daily data
-	Indicators []indicators.Indicator // Technical indicators to calculate
+	Token           string                        // API token for authentication
+	tickers         *utils.TreeSet[string]        // Set of watched ticker symbols
+	DailyCache      *models.History               // Cache of historical daily data
+	Indicators      []indicators.Indicator        // Technical indicators to calculate
+	IndicatorsPath  string                        // Config file the indicators are loaded from, empty if they are set in code
+	RetentionYears  int                           // Years of history kept in memory, 0 keeps everything
+	Monitor         *SourceMonitor                // Records the health of Tiingo requests, nil disables tracking
+	Priorities      *TickerQueue                  // Order in which tickers are downloaded when the quota is constrained
+	Limiter         *RateLimiter                  // Spaces out requests to Tiingo, nil disables rate limiting
+	Budget          *QuotaBudget                  // Shares the hourly quota with the other features of the token, nil grants every request
+	Source          HistorySource                 // Replaces the Tiingo API for history and metadata, nil uses the API
+	DownloadWorkers int                           // Concurrent history downloads, 0 uses the default
+	MaxPriceJump    float64                       // Factor a close can move by between bars before the bar is quarantined, 0 only rejects invalid closes
+	OnAnomaly       func(*models.PriceAnomaly)    // Called for every quarantined bar, nil logs them
+	OnProgress      func(ticker string, bars int) // Called with the bars decoded so far while a history downloads, nil disables progress reports
+	archiveMu       sync.Mutex                    // Serializes access to the yearly shards
+	cacheMu         sync.Mutex                    // Serializes writes to the daily cache
+	downloadsMu     sync.Mutex                    // Protects downloads
+	downloads       map[string]*download          // History downloads in flight by ticker
+	indicatorsMu    sync.RWMutex                  // Protects Indicators while they are reloaded
 }
 
 // NewTiingo creates a new Tiingo client with the provided API token.
 // It initializes the ticker set, daily cache, and indicators list.
 func NewTiingo(token string) *Tiingo {
 	return &Tiingo{
-		token,
-		utils.NewTreeSet[string](cmp.Compare), // Create sorted set for tickers
-		models.NewHistory(),                   // Initialize empty history
-		make([]indicators.Indicator, 0),       // Initialize empty indicators list
+		Token:      token,
+		tickers:    utils.NewTreeSet[string](cmp.Compare), // Create sorted set for tickers
+		DailyCache: models.NewHistory(),                   // Initialize empty history
+		Indicators: make([]indicators.Indicator, 0),       // Initialize empty indicators list
+		Priorities: NewTickerQueue(),                      // Every ticker starts as watched
+		downloads:  make(map[string]*download),
 	}
 }
 
@@ -57,76 +93,158 @@ func NewTiingo(token string) *Tiingo {
 func (t *Tiingo) AddTickers(newTickers ...string) {
 	// Convert all tickers to uppercase
 	for i, ticker := range newTickers {
-		newTickers[i] = strings.ToUpper(ticker)
+		newTickers[i] = symbols.Canonical(ticker)
 	}
 
 	// Add tickers to the set
 	t.tickers.Insert(newTickers...)
 }
 
-// LastPriceResponse represents the response from the Tiingo API for last price.
-// This struct maps to the JSON response from the IEX endpoint.
-type LastPriceResponse struct {
-	Ticker   string  `json:"ticker"`   // Ticker symbol
-	TngoLast float64 `json:"tngoLast"` // Latest price
+// Tickers returns the watched ticker symbols in sorted order.
+func (t *Tiingo) Tickers() []string {
+	return t.tickers.AsSlice()
 }
 
-// FetchCurrPrices fetches the current prices for all tickers in the watchlist.
-// It makes a single API call to get prices for all tickers and returns a map
-// of ticker symbols to their current prices.
-func (t *Tiingo) FetchCurrPrices() map[string]float64 {
-	tickers := t.tickers.AsSlice()
-	tickersStr := strings.Join(tickers, ",")
+// Daily returns the cached daily history of the watched tickers.
+func (t *Tiingo) Daily() *models.History {
+	return t.DailyCache
+}
 
-	request, err := http.NewRequest(http.MethodGet,
-		fmt.Sprintf("%s/iex/?tickers=%s&token=%s",
-			baseURL,
-			tickersStr,
-			t.Token,
-		),
-		nil)
-	if err != nil {
-		log.Println(err)
+// Prioritize replaces the order in which tickers are downloaded when the quota is constrained.
+func (t *Tiingo) Prioritize(priorities []*TickerPriority) {
+	t.Priorities.Replace(priorities)
+}
+
+// Critical returns the tickers that are held or have open orders, most important first.
+func (t *Tiingo) Critical(tickers []string) []string {
+	return t.Priorities.Critical(tickers)
+}
+
+// TickerMetadata describes a ticker as reported by Tiingo
+type TickerMetadata struct {
+	Ticker       string `json:"ticker"`       // Ticker symbol
+	Name         string `json:"name"`         // Company or fund name
+	ExchangeCode string `json:"exchangeCode"` // Exchange the ticker is listed on
+	Description  string `json:"description"`  // Description of the company or fund
+}
+
+// Metadata fetches the name and listing exchange of a ticker, from the Source if one is set.
+func (t *Tiingo) Metadata(ticker string) (metadata *TickerMetadata, err error) {
+	if t.Source != nil {
+		return t.Source.Metadata(ticker)
 	}
 
-	request.Header.Add("Content-Type", "application/json")
-	response, err := http.DefaultClient.Do(request)
+	op := "metadata of " + ticker
+	if !t.Budget.TryAcquire(FeatureFundamentals) {
+		return nil, &SourceError{Source: SourceTiingo, Op: op, Reason: ReasonOverBudget}
+	}
+
+	t.Limiter.Wait(SourceTiingo)
+	defer func() { t.Monitor.Record(SourceTiingo, err) }()
+
+	response, err := http.Get(fmt.Sprintf("%s/tiingo/daily/%s?token=%s", baseURL, symbols.Daily(ticker), t.Token))
 	if err != nil {
-		log.Println(err)
+		return nil, networkError(SourceTiingo, op, err)
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		if response.StatusCode == http.StatusNotFound {
-			log.Println(tickers, "not found")
-		}
-
-		log.Println(response.Status+" when fetching ", tickers)
+		return nil, statusError(SourceTiingo, op, response)
 	}
 
-	result := make([]LastPriceResponse, len(tickers))
-	if err = json.NewDecoder(response.Body).Decode(&result); err != nil {
-		log.Println(err)
+	metadata = &TickerMetadata{}
+	err = json.NewDecoder(response.Body).Decode(metadata)
+	if err != nil {
+		return nil, decodeError(SourceTiingo, op, err)
 	}
 
-	prices := make(map[string]float64, len(tickers))
-	for _, pair := range result {
-		prices[pair.Ticker] = pair.TngoLast
-	}
+	metadata.Ticker = symbols.Canonical(metadata.Ticker)
+	return metadata, nil
+}
 
-	return prices
+// download is a history download in flight, shared by every caller that requests the same ticker
+type download struct {
+	done chan struct{} // Closed once the history is merged or the download failed
+	err  error         // Error of the download, set before done is closed
 }
 
 // HistoricalDaily fetches historical daily data for a specific ticker.
 // It retrieves data from the earliest available date and adds it to the daily cache.
-// Returns an error if the API request fails or if the ticker is not found.
+// Concurrent calls for the same ticker share a single download and all return once
+// its history is in the cache. Returns a *SourceError if the API request fails.
+// Tickers that are not found are removed from the watchlist.
 func (t *Tiingo) HistoricalDaily(ticker string) error {
+	ticker = symbols.Canonical(ticker)
+
+	t.downloadsMu.Lock()
+	if inflight, ok := t.downloads[ticker]; ok {
+		t.downloadsMu.Unlock()
+		<-inflight.done
+		return inflight.err
+	}
+
+	current := &download{done: make(chan struct{})}
+	t.downloads[ticker] = current
+	t.downloadsMu.Unlock()
+
+	results, err := t.fetchHistory(ticker)
+	if err == nil {
+		t.cacheMu.Lock()
+		anomalies := t.DailyCache.AddData(results, ticker, t.MaxPriceJump)
+		t.cacheMu.Unlock()
+
+		t.reportAnomalies(anomalies)
+	}
+
+	t.downloadsMu.Lock()
+	delete(t.downloads, ticker)
+	t.downloadsMu.Unlock()
+
+	current.err = err
+	close(current.done)
+
+	return err
+}
+
+// reportAnomalies passes the bars quarantined while adding a history to OnAnomaly, or logs them if it is nil
+func (t *Tiingo) reportAnomalies(anomalies []*models.PriceAnomaly) {
+	for _, anomaly := range anomalies {
+		if t.OnAnomaly != nil {
+			t.OnAnomaly(anomaly)
+			continue
+		}
+
+		log.Printf("quarantined %s bar of %s: %s\n", anomaly.Date.Format(time.DateOnly), anomaly.Ticker, anomaly.Reason)
+	}
+}
+
+// fetchHistory downloads the full daily history of a ticker without adding it to the daily cache,
+// from the Source if one is set.
+// Tickers that are not found are removed from the watchlist.
+func (t *Tiingo) fetchHistory(ticker string) (results []models.PackedPeriod, err error) {
+	if t.Source != nil {
+		results, err = t.Source.FetchHistory(ticker)
+		if IsNotFound(err) {
+			t.tickers.Remove(ticker)
+		}
+
+		return results, err
+	}
+
+	op := "history of " + ticker
+	if err := t.Budget.Acquire(context.Background(), FeatureHistory); err != nil {
+		return nil, err
+	}
+
+	t.Limiter.Wait(SourceTiingo)
+	defer func() { t.Monitor.Record(SourceTiingo, err) }()
+
 	request, err := http.NewRequest(http.MethodGet,
 		fmt.Sprintf(
 			"%s/tiingo/daily/%s/prices?startDate=%s&resampleFreq=%s&format=%s&token=%s",
 			baseURL,
-			ticker,
+			symbols.Daily(ticker),
 			dataStart,
 			dailyFreq,
 			"json",
@@ -136,34 +254,83 @@ func (t *Tiingo) HistoricalDaily(ticker string) error {
 	)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	request.Header.Add("Content-Type", "application/json")
 	response, err := http.DefaultClient.Do(request)
 	if err != nil {
-		return err
+		return nil, networkError(SourceTiingo, op, err)
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
 		if response.StatusCode == http.StatusNotFound {
-			log.Println(ticker, "not found")
 			t.tickers.Remove(ticker)
 		}
 
-		return fmt.Errorf(response.Status + " when fetching " + ticker)
+		return nil, statusError(SourceTiingo, op, response)
+	}
+
+	results, err = t.decodeHistory(ticker, response.Body)
+	if err != nil {
+		return nil, decodeError(SourceTiingo, op, err)
+	}
+
+	return results, nil
+}
+
+// decodeHistory decodes a JSON array of daily bars one bar at a time, so a history of several decades is never
+// buffered as a whole before it is decoded. The bars decoded so far are reported to OnProgress.
+func (t *Tiingo) decodeHistory(ticker string, body io.Reader) ([]models.PackedPeriod, error) {
+	decoder := json.NewDecoder(body)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token == nil {
+		return make([]models.PackedPeriod, 0), nil
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected an array of bars, got %v", token)
 	}
 
 	results := make([]models.PackedPeriod, 0, 365*5) // Pre-allocate 5 years of daily data
-	if err = json.NewDecoder(response.Body).Decode(&results); err != nil {
-		return err
+	for decoder.More() {
+		results = append(results, models.PackedPeriod{})
+		err = decoder.Decode(&results[len(results)-1])
+		if err != nil {
+			return nil, err
+		}
+
+		if t.OnProgress != nil && len(results)%historyProgressBars == 0 {
+			t.OnProgress(ticker, len(results))
+		}
 	}
 
-	t.DailyCache.AddData(results, ticker)
+	// Consume the closing bracket, so a truncated response is reported as an error
+	_, err = decoder.Token()
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	if t.OnProgress != nil {
+		t.OnProgress(ticker, len(results))
+	}
+
+	return results, nil
+}
+
+// Workers returns how many history downloads may run at the same time
+func (t *Tiingo) Workers() int {
+	if t.DownloadWorkers > 0 {
+		return t.DownloadWorkers
+	}
+
+	return defaultDownloadWorkers
 }
 
 // LoadData loads data from cache and downloads missing data for all tickers.
@@ -179,33 +346,41 @@ func (t *Tiingo) LoadData(useJSON bool) error {
 		return err
 	}
 
-	errs, _ := errgroup.WithContext(context.Background())
-
 	log.Println("Downloading uncached tickers...")
+	return t.downloadPrioritized(t.missingTickers())
+}
+
+// missingTickers returns the watched tickers that are not in the daily cache
+func (t *Tiingo) missingTickers() []string {
+	missing := make([]string, 0)
 	for ticker := range t.tickers.All() {
 		if _, ok := t.DailyCache.Tickers[ticker]; !ok {
-			// Use a closure to capture the ticker value correctly
-			ticker := ticker // Create a new variable for the closure
-			errs.Go(func() error {
-				return t.HistoricalDaily(ticker)
-			})
+			missing = append(missing, ticker)
 		}
 	}
 
-	err = errs.Wait()
+	return missing
+}
 
-	if err := t.SaveCaches(); err != nil {
-		return err
+// downloadPrioritized downloads the history of tickers, most important first, and saves the caches.
+// At most Workers downloads run at the same time.
+// When the request quota is constrained, tickers beyond the remaining budget are left for the next download.
+func (t *Tiingo) downloadPrioritized(tickers []string) error {
+	ordered := t.Priorities.Tickers(tickers)
+	budget := t.Monitor.Budget(SourceTiingo)
+	if remaining := t.Budget.Remaining(FeatureHistory); remaining >= 0 && (budget < 0 || remaining < budget) {
+		budget = remaining
 	}
 
-	return err
-}
+	if budget >= 0 && budget < len(ordered) {
+		log.Printf("request quota is constrained, deferring the download of %d tickers\n", len(ordered)-budget)
+		ordered = ordered[:budget]
+	}
 
-// DownloadAllTickers downloads data for all tickers
-func (t *Tiingo) DownloadAllTickers() error {
 	errs, _ := errgroup.WithContext(context.Background())
+	errs.SetLimit(t.Workers())
 
-	for ticker := range t.tickers.All() {
+	for _, ticker := range ordered {
 		errs.Go(func() error {
 			return t.HistoricalDaily(ticker)
 		})
@@ -213,6 +388,10 @@ func (t *Tiingo) DownloadAllTickers() error {
 
 	err := errs.Wait()
 
+	for _, ticker := range ordered {
+		t.CalculateTickerIndicators(ticker)
+	}
+
 	if err := t.SaveCaches(); err != nil {
 		return err
 	}
@@ -220,25 +399,35 @@ func (t *Tiingo) DownloadAllTickers() error {
 	return err
 }
 
-// DownloadMissingTickers downloads data for tickers not in the cache
-func (t *Tiingo) DownloadMissingTickers() error {
-	errs, _ := errgroup.WithContext(context.Background())
+// DownloadAllTickers downloads data for all tickers
+func (t *Tiingo) DownloadAllTickers() error {
+	return t.downloadPrioritized(t.tickers.AsSlice())
+}
 
-	for ticker := range t.tickers.All() {
-		if _, ok := t.DailyCache.Tickers[ticker]; !ok {
-			errs.Go(func() error {
-				return t.HistoricalDaily(ticker)
-			})
+// DownloadStaleTickers downloads the tickers whose cached history ends before the date expected returns for them,
+// such as the last trading day of their exchange. Fresh tickers are skipped, so runs on weekends and holidays
+// download nothing and leave the caches untouched.
+func (t *Tiingo) DownloadStaleTickers(expected func(ticker string) time.Time) error {
+	tickers := t.tickers.AsSlice()
+	stale := make([]string, 0)
+	for _, ticker := range tickers {
+		meta, ok := t.DailyCache.Tickers[ticker]
+		if !ok || meta.End.Before(expected(ticker)) {
+			stale = append(stale, ticker)
 		}
 	}
 
-	err := errs.Wait()
-
-	if err := t.SaveCaches(); err != nil {
-		return err
+	log.Printf("%d of %d watched tickers are stale\n", len(stale), len(tickers))
+	if len(stale) == 0 {
+		return nil
 	}
 
-	return err
+	return t.downloadPrioritized(stale)
+}
+
+// DownloadMissingTickers downloads data for tickers not in the cache
+func (t *Tiingo) DownloadMissingTickers() error {
+	return t.downloadPrioritized(t.missingTickers())
 }
 
 // LoadCaches loads historical stock data caches from disk.
@@ -248,7 +437,7 @@ func (t *Tiingo) LoadCaches(useJSON bool) error {
 	if useJSON {
 		err := os.Mkdir(cacheFolder, 0777)
 		if err != nil && !os.IsExist(err) {
-			log.Fatal(err)
+			return err
 		}
 
 		if _, err = os.Stat(filepath.Join(cacheFolder, dailyCacheJSON)); !errors.Is(err, os.ErrNotExist) {
@@ -263,6 +452,7 @@ func (t *Tiingo) LoadCaches(useJSON bool) error {
 			}
 		}
 
+		t.canonicalizeCache()
 		return nil
 	}
 
@@ -271,6 +461,8 @@ func (t *Tiingo) LoadCaches(useJSON bool) error {
 		return err
 	}
 
+	defer file.Close()
+
 	packed := &models.PackedHistory{}
 	err = gob.NewDecoder(file).Decode(packed)
 	if err != nil {
@@ -278,30 +470,50 @@ func (t *Tiingo) LoadCaches(useJSON bool) error {
 	}
 
 	t.DailyCache = packed.Unpack()
+	t.canonicalizeCache()
 
 	return nil
 }
 
+// canonicalizeCache respells the tickers of a loaded cache with their canonical symbols, so caches written before
+// symbols were normalized do not keep a column of a security next to the one AddTickers creates
+func (t *Tiingo) canonicalizeCache() {
+	if respelled := t.DailyCache.Canonicalize(); respelled > 0 {
+		log.Printf("respelled %d cached tickers with their canonical symbols\n", respelled)
+	}
+}
+
 // SaveCaches saves the daily cache to disk in both GOB and JSON formats.
 // GOB format is used for efficient loading, while JSON is more portable.
-// It creates the cache directory if it doesn't exist.
+// It creates the cache directory if it doesn't exist. Rows older than the
+// retention period are archived to their shards first and evicted from memory.
 func (t *Tiingo) SaveCaches() error {
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
 	err := os.Mkdir(cacheFolder, 0777)
 	if err != nil && !os.IsExist(err) {
 		return err
 	}
 
+	err = t.archiveOldRows()
+	if err != nil {
+		return fmt.Errorf("error archiving history: %v", err)
+	}
+
 	packed := t.DailyCache.Pack()
 
 	file, err := os.OpenFile(filepath.Join(cacheFolder, dailyCacheGOB), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
 	if err != nil {
-		log.Println(err)
+		return err
 	}
 
+	defer file.Close()
+
 	enc := gob.NewEncoder(file)
 	err = enc.Encode(packed)
 	if err != nil {
-		log.Println(err)
+		return err
 	}
 
 	marshalled, err := json.Marshal(packed)
@@ -317,16 +529,88 @@ func (t *Tiingo) SaveCaches() error {
 	return nil
 }
 
+// CacheSavedAt returns when the daily cache was last saved to disk, zero if it was never saved
+func (t *Tiingo) CacheSavedAt() time.Time {
+	info, err := os.Stat(filepath.Join(cacheFolder, dailyCacheGOB))
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
 // AddIndicator adds an indicator to the list
 func (t *Tiingo) AddIndicator(indicator indicators.Indicator) {
+	t.indicatorsMu.Lock()
+	defer t.indicatorsMu.Unlock()
+
 	t.Indicators = append(t.Indicators, indicator)
 }
 
+// CurrentIndicators returns a copy of the indicators that are calculated
+func (t *Tiingo) CurrentIndicators() []indicators.Indicator {
+	t.indicatorsMu.RLock()
+	defer t.indicatorsMu.RUnlock()
+
+	return slices.Clone(t.Indicators)
+}
+
+// LoadIndicators replaces the indicators with the ones in the config file at IndicatorsPath.
+// The indicators are left unchanged if the file is invalid. Values of the new indicators
+// are only available after RecalculateIndicators.
+func (t *Tiingo) LoadIndicators() ([]indicators.Indicator, error) {
+	if t.IndicatorsPath == "" {
+		return nil, fmt.Errorf("no indicator config file is configured")
+	}
+
+	config, err := indicators.LoadConfig(t.IndicatorsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded, err := config.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	t.indicatorsMu.Lock()
+	t.Indicators = loaded
+	t.indicatorsMu.Unlock()
+
+	return slices.Clone(loaded), nil
+}
+
+// CalculateTickerIndicators calculates all indicators for a single ticker of the daily cache
+func (t *Tiingo) CalculateTickerIndicators(ticker string) {
+	t.cacheMu.Lock()
+	defer t.cacheMu.Unlock()
+
+	indicators.CalculateTickerIndicators(t.DailyCache, symbols.Canonical(ticker), t.CurrentIndicators())
+}
+
+// Cached checks whether the daily cache contains history for a ticker
+func (t *Tiingo) Cached(ticker string) bool {
+	_, ok := t.DailyCache.Tickers[symbols.Canonical(ticker)]
+	return ok
+}
+
 // CalculateIndicators calculates all indicators for the daily cache
 func (t *Tiingo) CalculateIndicators() error {
 	log.Println("Calculating indicators...")
 
-	indicators.CalculateIndicators(t.DailyCache, t.Indicators)
+	t.cacheMu.Lock()
+	indicators.CalculateIndicators(t.DailyCache, t.CurrentIndicators())
+	t.cacheMu.Unlock()
 
 	return t.SaveCaches()
 }
+
+// RecalculateIndicators removes every indicator value from the daily cache and calculates
+// the current indicators again, so values of removed indicators do not linger.
+func (t *Tiingo) RecalculateIndicators() error {
+	t.cacheMu.Lock()
+	indicators.ClearIndicators(t.DailyCache)
+	t.cacheMu.Unlock()
+
+	return t.CalculateIndicators()
+}
@@ -0,0 +1,355 @@
+// Package simulator generates a synthetic stock market for demos, load tests and classrooms.
+// Prices follow correlated geometric Brownian motions, and the market serves both the daily
+// history and the live prices the server normally downloads from Tiingo, so it runs without
+// any external API.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"urjith.dev/algobattle/pkg/models"
+	"urjith.dev/algobattle/pkg/services"
+	"urjith.dev/algobattle/pkg/symbols"
+)
+
+// Source is the name the simulated market is reported under
+const Source = "simulator"
+
+// Defaults of the optional configuration fields
+const (
+	defaultHistoryDays = 504       // About two years of trading days
+	defaultVolume      = 1_000_000 // Average daily volume of a ticker
+	defaultExchange    = "NASDAQ"  // Exchange simulated tickers are listed on
+)
+
+const (
+	tradingDaysPerYear  = 252
+	tradingHoursPerYear = tradingDaysPerYear * 6.5 // Trading hours in a year of regular sessions
+	stepsPerDay         = 13                       // Half-hour steps a simulated day is made of
+	volumeVolatility    = 0.25                     // Volatility of the log of the daily volume
+)
+
+// TickerConfig configures the simulated price path of a ticker
+type TickerConfig struct {
+	Ticker     string  `json:"ticker"`     // Ticker symbol
+	Name       string  `json:"name"`       // Company name, defaults to the ticker
+	Exchange   string  `json:"exchange"`   // Exchange code the ticker is listed on, defaults to NASDAQ
+	StartPrice float64 `json:"startPrice"` // Price at the start of the generated history
+	Drift      float64 `json:"drift"`      // Annualized expected return, e.g. 0.08 for 8%
+	Volatility float64 `json:"volatility"` // Annualized volatility, e.g. 0.25 for 25%
+	Volume     int64   `json:"volume"`     // Average daily volume, defaults to 1,000,000
+}
+
+// Config configures a simulated market
+type Config struct {
+	Tickers     []*TickerConfig `json:"tickers"`     // Simulated tickers
+	Correlation float64         `json:"correlation"` // Correlation of the returns of every pair of tickers, from 0 to 1
+	Seed        uint64          `json:"seed"`        // Seed of the random numbers, the same seed generates the same history
+	HistoryDays int             `json:"historyDays"` // Trading days of history generated before today, defaults to 504
+	Speed       float64         `json:"speed"`       // How many times faster than real time live prices move, defaults to 1
+}
+
+// LoadConfig loads a simulated market configuration from a JSON file and validates it
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing simulator config: %v", err)
+	}
+
+	return config, config.validate()
+}
+
+// validate checks the configuration and fills in the defaults
+func (c *Config) validate() error {
+	switch {
+	case len(c.Tickers) == 0:
+		return fmt.Errorf("simulator config has no tickers")
+	case c.Correlation < 0 || c.Correlation > 1:
+		return fmt.Errorf("correlation must be between 0 and 1, got %g", c.Correlation)
+	case c.HistoryDays < 0:
+		return fmt.Errorf("historyDays must not be negative, got %d", c.HistoryDays)
+	case c.Speed < 0:
+		return fmt.Errorf("speed must not be negative, got %g", c.Speed)
+	}
+
+	if c.HistoryDays == 0 {
+		c.HistoryDays = defaultHistoryDays
+	}
+
+	if c.Speed == 0 {
+		c.Speed = 1
+	}
+
+	seen := make(map[string]bool, len(c.Tickers))
+	for i, ticker := range c.Tickers {
+		ticker.Ticker = symbols.Canonical(ticker.Ticker)
+		switch {
+		case ticker.Ticker == "":
+			return fmt.Errorf("simulated ticker %d has no ticker", i)
+		case seen[ticker.Ticker]:
+			return fmt.Errorf("simulated ticker %s is listed more than once", ticker.Ticker)
+		case ticker.StartPrice <= 0:
+			return fmt.Errorf("simulated ticker %s needs a positive startPrice", ticker.Ticker)
+		case ticker.Volatility < 0:
+			return fmt.Errorf("simulated ticker %s has a negative volatility", ticker.Ticker)
+		}
+
+		if ticker.Name == "" {
+			ticker.Name = ticker.Ticker
+		}
+
+		if ticker.Exchange == "" {
+			ticker.Exchange = defaultExchange
+		}
+
+		if ticker.Volume <= 0 {
+			ticker.Volume = defaultVolume
+		}
+
+		seen[ticker.Ticker] = true
+	}
+
+	return nil
+}
+
+// tickerState is the simulated price path of a ticker
+type tickerState struct {
+	config *TickerConfig
+	price  float64               // Live price
+	bars   []models.PackedPeriod // Completed daily bars, oldest first
+	today  models.PackedPeriod   // Bar of the current trading day, built from the live prices
+}
+
+// Market is a simulated market. It implements services.PriceSource for live prices and
+// services.HistorySource for the daily history and listings.
+type Market struct {
+	mu      sync.Mutex
+	config  *Config
+	rng     *rand.Rand
+	tickers []*tickerState
+	byName  map[string]*tickerState
+	day     time.Time // Trading day of the live prices
+	updated time.Time // When the live prices last moved
+}
+
+// New creates a simulated market whose history ends on the trading day before now
+func New(config *Config, now time.Time) (*Market, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Market{
+		config: config,
+		rng:    rand.New(rand.NewPCG(config.Seed, config.Seed)),
+		byName: make(map[string]*tickerState, len(config.Tickers)),
+	}
+
+	for _, ticker := range config.Tickers {
+		state := &tickerState{config: ticker, price: ticker.StartPrice}
+		m.tickers = append(m.tickers, state)
+		m.byName[ticker.Ticker] = state
+	}
+
+	today := date(now)
+	start := today
+	for days := 0; days < config.HistoryDays; {
+		start = start.AddDate(0, 0, -1)
+		if tradingDay(start) {
+			days++
+		}
+	}
+
+	for day := start; day.Before(today); day = day.AddDate(0, 0, 1) {
+		if tradingDay(day) {
+			m.simulateDay(day)
+		}
+	}
+
+	m.openDay(today, now)
+	return m, nil
+}
+
+// Name returns the name the market is reported under
+func (m *Market) Name() string {
+	return Source
+}
+
+// Tickers returns the simulated tickers in configuration order
+func (m *Market) Tickers() []string {
+	tickers := make([]string, 0, len(m.tickers))
+	for _, state := range m.tickers {
+		tickers = append(tickers, state.config.Ticker)
+	}
+
+	return tickers
+}
+
+// FetchPrices moves the market to the current time and returns the live price of each simulated ticker.
+// Tickers that are not simulated are left out, like tickers a live source does not know.
+func (m *Market) FetchPrices(tickers []string) (map[string]float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(time.Now())
+
+	prices := make(map[string]float64, len(tickers))
+	for _, ticker := range tickers {
+		if state, ok := m.byName[symbols.Canonical(ticker)]; ok {
+			prices[state.config.Ticker] = state.price
+		}
+	}
+
+	return prices, nil
+}
+
+// FetchHistory returns the completed daily bars of a simulated ticker.
+// Returns a not found *services.SourceError for tickers that are not simulated.
+func (m *Market) FetchHistory(ticker string) ([]models.PackedPeriod, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance(time.Now())
+
+	state, ok := m.byName[symbols.Canonical(ticker)]
+	if !ok {
+		return nil, &services.SourceError{Source: Source, Op: "history of " + ticker, Reason: services.ReasonNotFound}
+	}
+
+	bars := make([]models.PackedPeriod, len(state.bars))
+	copy(bars, state.bars)
+	return bars, nil
+}
+
+// Metadata returns the name and exchange of a simulated ticker.
+// Returns a not found *services.SourceError for tickers that are not simulated.
+func (m *Market) Metadata(ticker string) (*services.TickerMetadata, error) {
+	state, ok := m.byName[symbols.Canonical(ticker)]
+	if !ok {
+		return nil, &services.SourceError{Source: Source, Op: "metadata of " + ticker, Reason: services.ReasonNotFound}
+	}
+
+	return &services.TickerMetadata{
+		Ticker:       state.config.Ticker,
+		Name:         state.config.Name,
+		ExchangeCode: state.config.Exchange,
+		Description:  "Simulated ticker",
+	}, nil
+}
+
+// advance closes the trading days that ended since the last update, simulates the days the market was not
+// observed, and moves the live prices by the time that passed. Prices do not move on weekends.
+// The caller must hold mu.
+func (m *Market) advance(now time.Time) {
+	today := date(now)
+	if today.After(m.day) {
+		m.closeDay()
+		for day := m.day.AddDate(0, 0, 1); day.Before(today); day = day.AddDate(0, 0, 1) {
+			if tradingDay(day) {
+				m.simulateDay(day)
+			}
+		}
+
+		m.openDay(today, now)
+	}
+
+	elapsed := now.Sub(m.updated)
+	m.updated = now
+	if elapsed <= 0 || !tradingDay(m.day) {
+		return
+	}
+
+	m.step(elapsed.Hours() * m.config.Speed / tradingHoursPerYear)
+	for _, state := range m.tickers {
+		state.today.High = max(state.today.High, state.price)
+		state.today.Low = min(state.today.Low, state.price)
+		state.today.Close = state.price
+	}
+}
+
+// openDay starts the bar of a trading day at the live prices. The caller must hold mu.
+func (m *Market) openDay(day, now time.Time) {
+	m.day = day
+	m.updated = now
+	for _, state := range m.tickers {
+		state.today = models.PackedPeriod{Date: day, Open: state.price, High: state.price, Low: state.price, Close: state.price}
+	}
+}
+
+// closeDay completes the bar of the current trading day. The caller must hold mu.
+func (m *Market) closeDay() {
+	if !tradingDay(m.day) {
+		return
+	}
+
+	for _, state := range m.tickers {
+		state.bars = append(state.bars, m.completeBar(state, state.today))
+	}
+}
+
+// simulateDay simulates a whole trading day in half-hour steps and adds its bar. The caller must hold mu.
+func (m *Market) simulateDay(day time.Time) {
+	bars := make([]models.PackedPeriod, len(m.tickers))
+	for i, state := range m.tickers {
+		bars[i] = models.PackedPeriod{Date: day, Open: state.price, High: state.price, Low: state.price}
+	}
+
+	for range stepsPerDay {
+		m.step(1.0 / tradingDaysPerYear / stepsPerDay)
+		for i, state := range m.tickers {
+			bars[i].High = max(bars[i].High, state.price)
+			bars[i].Low = min(bars[i].Low, state.price)
+		}
+	}
+
+	for i, state := range m.tickers {
+		bars[i].Close = state.price
+		state.bars = append(state.bars, m.completeBar(state, bars[i]))
+	}
+}
+
+// completeBar fills in the volume and the adjusted prices of a daily bar.
+// Simulated tickers pay no dividends and never split, so adjusted prices equal the raw prices.
+func (m *Market) completeBar(state *tickerState, bar models.PackedPeriod) models.PackedPeriod {
+	noise := math.Exp(volumeVolatility*m.rng.NormFloat64() - volumeVolatility*volumeVolatility/2)
+	bar.Volume = int64(float64(state.config.Volume) * noise)
+	bar.AdjOpen, bar.AdjHigh, bar.AdjLow, bar.AdjClose = bar.Open, bar.High, bar.Low, bar.Close
+	bar.AdjVolume = bar.Volume
+	bar.SplitFactor = 1
+	return bar
+}
+
+// step moves every price by a time step of dt years. The shocks share a common market factor,
+// so the returns of every pair of tickers have the configured correlation. The caller must hold mu.
+func (m *Market) step(dt float64) {
+	rho := m.config.Correlation
+	common := m.rng.NormFloat64()
+
+	for _, state := range m.tickers {
+		shock := math.Sqrt(rho)*common + math.Sqrt(1-rho)*m.rng.NormFloat64()
+		drift := state.config.Drift - state.config.Volatility*state.config.Volatility/2
+		state.price *= math.Exp(drift*dt + state.config.Volatility*math.Sqrt(dt)*shock)
+	}
+}
+
+// date returns the UTC date of a time, the way daily bars are dated
+func date(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// tradingDay checks whether a date is a weekday
+func tradingDay(day time.Time) bool {
+	return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday
+}
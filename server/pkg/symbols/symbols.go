@@ -0,0 +1,55 @@
+// Package symbols normalizes ticker symbols, so a security is known by a single spelling in holdings, orders,
+// alerts and the price caches however a bot or a data source writes it.
+//
+// The canonical form is upper case without surrounding spaces, with share classes separated by a dot, such as
+// "BRK.B". Tiingo spells share classes with a hyphen on its daily endpoints ("BRK-B") and with a dot on its IEX
+// endpoint, so symbols are converted with Daily before they are requested from a daily endpoint, and the symbols of
+// every response are read back with Canonical.
+package symbols
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxLength is the length of the longest accepted symbol
+const MaxLength = 10
+
+// pattern matches canonical symbols
+var pattern = regexp.MustCompile(`^[A-Z][A-Z0-9]*(\.[A-Z0-9]+)*$`)
+
+// classSeparators are the separators of share classes that are written in place of the canonical dot
+var classSeparators = strings.NewReplacer("-", ".", "/", ".", "_", ".")
+
+// Canonical returns the canonical spelling of a symbol without validating it, for symbols that were already
+// validated or that come from a data source
+func Canonical(symbol string) string {
+	return classSeparators.Replace(strings.ToUpper(strings.TrimSpace(symbol)))
+}
+
+// Normalize returns the canonical spelling of a symbol written by a user, such as "brk-b" or " BRK/B ", or an error
+// if it is not a valid symbol
+func Normalize(symbol string) (string, error) {
+	canonical := Canonical(symbol)
+	if canonical == "" {
+		return "", fmt.Errorf("ticker is required")
+	}
+
+	if len(canonical) > MaxLength || !pattern.MatchString(canonical) {
+		return "", fmt.Errorf("invalid ticker %q", strings.TrimSpace(symbol))
+	}
+
+	return canonical, nil
+}
+
+// Valid checks whether a symbol written by a user normalizes to a valid symbol
+func Valid(symbol string) bool {
+	_, err := Normalize(symbol)
+	return err == nil
+}
+
+// Daily returns the spelling of a canonical symbol on Tiingo's daily endpoints
+func Daily(symbol string) string {
+	return strings.ReplaceAll(symbol, ".", "-")
+}
@@ -52,6 +52,15 @@ func (t *TreeSet[T]) Remove(values ...T) {
 	defer t.mu.Unlock()
 
 	for _, value := range values {
+		// delete expects the value to be in the tree
+		if !t.contains(value) {
+			continue
+		}
+
+		if !t.root.left.isRed() && !t.root.right.isRed() {
+			t.root.color = RED
+		}
+
 		t.root = t.delete(t.root, value)
 		if t.root != nil {
 			t.root.color = BLACK
@@ -64,6 +73,11 @@ func (t *TreeSet[T]) Contains(value T) bool {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
+	return t.contains(value)
+}
+
+// contains checks if the TreeSet contains the given value. The caller must hold the lock.
+func (t *TreeSet[T]) contains(value T) bool {
 	x := t.root
 	for x != nil {
 		if compareResult := t.comparator(value, x.value); compareResult < 0 {
@@ -113,6 +127,53 @@ func (t *TreeSet[T]) AsSlice() []T {
 	return slice
 }
 
+// Below returns, in ascending order, every value v for which position(v) <= 0.
+// position must agree with the TreeSet's ordering: it returns a negative number for values
+// before the bound, zero for values at the bound and a positive number for values after it.
+// Only the matching part of the tree is visited.
+func (t *TreeSet[T]) Below(position func(T) int) []T {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	slice := make([]T, 0)
+	var traverse func(*node[T])
+	traverse = func(n *node[T]) {
+		if n == nil {
+			return
+		}
+		traverse(n.left)
+		if position(n.value) <= 0 {
+			slice = append(slice, n.value)
+			traverse(n.right)
+		}
+	}
+	traverse(t.root)
+	return slice
+}
+
+// Above returns, in ascending order, every value v for which position(v) >= 0.
+// position must agree with the TreeSet's ordering, as described for Below.
+// Only the matching part of the tree is visited.
+func (t *TreeSet[T]) Above(position func(T) int) []T {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	slice := make([]T, 0)
+	var traverse func(*node[T])
+	traverse = func(n *node[T]) {
+		if n == nil {
+			return
+		}
+		if position(n.value) >= 0 {
+			traverse(n.left)
+			slice = append(slice, n.value)
+		}
+		traverse(n.right)
+	}
+	traverse(t.root)
+	return slice
+}
+
 func (n *node[T]) isRed() bool {
 	if n == nil {
 		return false
@@ -138,13 +199,15 @@ func (n *node[T]) rotateRight() *node[T] {
 	return x
 }
 
+// flipColors inverts the colors of a node and its children. Insertions use it to split a node with two red
+// children, deletions to merge a node with its children.
 func (n *node[T]) flipColors() {
-	n.color = RED
+	n.color = !n.color
 	if n.left != nil {
-		n.left.color = BLACK
+		n.left.color = !n.left.color
 	}
 	if n.right != nil {
-		n.right.color = BLACK
+		n.right.color = !n.right.color
 	}
 }
 
@@ -178,20 +241,18 @@ func (t *TreeSet[T]) delete(h *node[T], value T) *node[T] {
 	}
 
 	if compareResult := t.comparator(value, h.value); compareResult < 0 {
-		if (h.left == nil || !h.left.isRed()) && (h.left == nil || h.left.left == nil || !h.left.left.isRed()) {
+		if !h.left.isRed() && (h.left == nil || !h.left.left.isRed()) {
 			h = h.moveRedLeft()
 		}
-		if h.left != nil {
-			h.left = t.delete(h.left, value)
-		}
+		h.left = t.delete(h.left, value)
 	} else {
-		if h.left != nil && h.left.isRed() {
+		if h.left.isRed() {
 			h = h.rotateRight()
 		}
 		if t.comparator(value, h.value) == 0 && h.right == nil {
 			return nil
 		}
-		if (h.right == nil || !h.right.isRed()) && (h.right == nil || h.right.left == nil || !h.right.left.isRed()) {
+		if !h.right.isRed() && (h.right == nil || !h.right.left.isRed()) {
 			h = h.moveRedRight()
 		}
 		if t.comparator(value, h.value) == 0 {
@@ -199,9 +260,7 @@ func (t *TreeSet[T]) delete(h *node[T], value T) *node[T] {
 			h.value = smallest.value
 			h.right = h.right.deleteMin()
 		} else {
-			if h.right != nil {
-				h.right = t.delete(h.right, value)
-			}
+			h.right = t.delete(h.right, value)
 		}
 	}
 	return h.balance()
@@ -226,7 +285,7 @@ func (n *node[T]) deleteMin() *node[T] {
 		return nil
 	}
 
-	if (n.left == nil || !n.left.isRed()) && (n.left.left == nil || !n.left.left.isRed()) {
+	if !n.left.isRed() && !n.left.left.isRed() {
 		n = n.moveRedLeft()
 	}
 
@@ -257,11 +316,11 @@ func (n *node[T]) balance() *node[T] {
 	if n == nil {
 		return nil
 	}
-	if n.right != nil && n.right.isRed() {
+	if n.right.isRed() && !n.left.isRed() {
 		n = n.rotateLeft()
 	}
 
-	if n.left != nil && n.left.isRed() && (n.left.left != nil && n.left.left.isRed()) {
+	if n.left.isRed() && n.left.left.isRed() {
 		n = n.rotateRight()
 	}
 
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// checkTree fails the test if the tree is not a left-leaning red-black tree holding exactly the given sorted values
+func checkTree(t *testing.T, set *TreeSet[int], want []int) {
+	t.Helper()
+
+	if set.root.isRed() {
+		t.Fatalf("root is red")
+	}
+
+	// blackHeight returns the number of black nodes on every path below n, or -1 if the paths differ
+	var blackHeight func(n *node[int]) int
+	blackHeight = func(n *node[int]) int {
+		if n == nil {
+			return 0
+		}
+
+		if n.right.isRed() {
+			t.Fatalf("%d has a red right child", n.value)
+		}
+
+		if n.isRed() && n.left.isRed() {
+			t.Fatalf("%d and its left child are both red", n.value)
+		}
+
+		left, right := blackHeight(n.left), blackHeight(n.right)
+		if left < 0 || left != right {
+			return -1
+		}
+
+		if !n.isRed() {
+			left++
+		}
+
+		return left
+	}
+
+	if blackHeight(set.root) < 0 {
+		t.Fatalf("paths have different black heights")
+	}
+
+	if got := set.AsSlice(); !slices.Equal(got, want) {
+		t.Fatalf("values = %v, want %v", got, want)
+	}
+}
+
+func TestTreeSetRemove(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		set := NewTreeSet[int](cmp.Compare[int])
+		want := make([]int, 0)
+
+		for _, value := range rng.Perm(64) {
+			set.Insert(value)
+			want = append(want, value)
+		}
+
+		slices.Sort(want)
+		checkTree(t, set, want)
+
+		// Removing missing values leaves the tree alone
+		set.Remove(-1, 64)
+		checkTree(t, set, want)
+
+		for _, value := range rng.Perm(64) {
+			set.Remove(value)
+			want = slices.DeleteFunc(want, func(v int) bool { return v == value })
+			checkTree(t, set, want)
+
+			if set.Contains(value) {
+				t.Fatalf("removed value %d is still contained", value)
+			}
+		}
+	}
+}
+
+func TestTreeSetBelowAbove(t *testing.T) {
+	set := NewTreeSet[int](cmp.Compare[int])
+	set.Insert(5, 1, 9, 3, 7)
+	set.Remove(3)
+
+	bound := func(b int) func(int) int {
+		return func(v int) int { return cmp.Compare(v, b) }
+	}
+
+	if got := set.Below(bound(7)); !slices.Equal(got, []int{1, 5, 7}) {
+		t.Errorf("Below(7) = %v, want [1 5 7]", got)
+	}
+
+	if got := set.Above(bound(4)); !slices.Equal(got, []int{5, 7, 9}) {
+		t.Errorf("Above(4) = %v, want [5 7 9]", got)
+	}
+}